@@ -8,10 +8,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/satindergrewal/peer-up/internal/auth"
 	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/internal/identity"
 	"github.com/satindergrewal/peer-up/internal/termcolor"
 )
 
@@ -28,6 +31,12 @@ func runAuth(args []string) {
 		runAuthList(args[1:])
 	case "remove":
 		runAuthRemove(args[1:])
+	case "revoke":
+		runAuthRevoke(args[1:])
+	case "revocations":
+		runAuthRevocations(args[1:])
+	case "role":
+		runAuthRole(args[1:])
 	case "validate":
 		runAuthValidate(args[1:])
 	default:
@@ -44,6 +53,9 @@ func printAuthUsage() {
 	fmt.Println("  add      <peer-id> [--comment \"label\"]   Authorize a peer")
 	fmt.Println("  list                                     List authorized peers")
 	fmt.Println("  remove   <peer-id>                       Revoke a peer's access")
+	fmt.Println("  revoke   <peer-id> [--reason \"text\"]    Revoke a pairing group member on every node")
+	fmt.Println("  revocations                              List stored group revocations")
+	fmt.Println("  role     add|remove <peer-id> <role>     Assign or unassign a named role")
 	fmt.Println("  validate [file]                          Validate authorized_keys format")
 	fmt.Println()
 	fmt.Println("All commands support --config <path> and --file <path>.")
@@ -158,6 +170,9 @@ func doAuthList(args []string, stdout io.Writer) error {
 		if entry.Group != "" {
 			attrs += " [group=" + entry.Group + "]"
 		}
+		if len(entry.Roles) > 0 {
+			attrs += " [role=" + strings.Join(entry.Roles, ",") + "]"
+		}
 		if entry.Verified != "" {
 			attrs += " [verified=" + entry.Verified + "]"
 		} else {
@@ -207,6 +222,199 @@ func doAuthRemove(args []string, stdout io.Writer) error {
 	return nil
 }
 
+// authRevoker is the daemon API used by doAuthRevoke (satisfied by
+// *daemon.Client).
+type authRevoker interface {
+	AuthRevoke(peerID, reason string) (*daemon.AuthRevokeResponse, error)
+}
+
+func runAuthRevoke(args []string) {
+	var c authRevoker
+	if dc := tryDaemonClient(); dc != nil {
+		c = dc
+	}
+	if err := doAuthRevoke(args, c, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+// doAuthRevoke revokes a peer that joined through a pairing group. The
+// signed notice removes it here and, through gossip, on every other member
+// of the group and the relay. With a running daemon the notice is signed
+// and sent immediately; otherwise it is signed with the key file and
+// stored, and the daemon delivers it as group members connect.
+func doAuthRevoke(args []string, c authRevoker, stdout io.Writer) error {
+	fs := flag.NewFlagSet("auth revoke", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFlag := fs.String("config", "", "path to config file")
+	fileFlag := fs.String("file", "", "path to authorized_keys file (overrides config)")
+	keyFlag := fs.String("key", "", "path to identity key file (overrides config)")
+	reasonFlag := fs.String("reason", "", "reason recorded in the notice")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: peerup auth revoke <peer-id> [--reason \"text\"]")
+	}
+	peerIDStr := fs.Arg(0)
+	pid, err := peer.Decode(peerIDStr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", auth.ErrInvalidPeerID, err)
+	}
+	short := peerIDStr[:16] + "..."
+
+	if c != nil {
+		resp, err := c.AuthRevoke(peerIDStr, *reasonFlag)
+		if err != nil {
+			return fmt.Errorf("failed to revoke peer: %w", err)
+		}
+		termcolor.Green("Revoked peer: %s (group %s)", short, resp.Group)
+		fmt.Fprintf(stdout, "  Delivered to %d connected peer(s)\n", len(resp.Delivered))
+		for _, p := range resp.Delivered {
+			fmt.Fprintf(stdout, "    %s\n", p)
+		}
+		fmt.Fprintln(stdout, "  Members offline now receive the notice when they next connect.")
+		return nil
+	}
+
+	// No daemon: sign with the key file and store the notice locally.
+	authKeysPath, err := resolveAuthKeysPathErr(*fileFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+	idCfg, err := resolveKeyIdentity(*keyFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+	priv, err := identity.LoadIdentity(idCfg.KeyFile, keyPassphrase(idCfg))
+	if err != nil {
+		return err
+	}
+	self, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		return err
+	}
+
+	group, err := auth.PeerGroup(authKeysPath, pid)
+	if err != nil {
+		return err
+	}
+	rev, err := auth.NewRevocation(priv, group, pid, *reasonFlag, time.Now())
+	if err != nil {
+		return err
+	}
+	store, err := auth.OpenRevocationStore(auth.RevocationsPath(authKeysPath))
+	if err != nil {
+		return err
+	}
+	if _, _, err := store.Apply(authKeysPath, rev, self, time.Now()); err != nil {
+		return fmt.Errorf("failed to revoke peer: %w", err)
+	}
+
+	termcolor.Green("Revoked peer: %s (group %s)", short, group)
+	fmt.Fprintf(stdout, "  File: %s\n", authKeysPath)
+	termcolor.Yellow("Daemon not running: the notice is stored and sent to group members once 'peerup daemon' starts.")
+	return nil
+}
+
+func runAuthRevocations(args []string) {
+	if err := doAuthRevocations(args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+// doAuthRevocations lists the stored group revocations.
+func doAuthRevocations(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("auth revocations", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFlag := fs.String("config", "", "path to config file")
+	fileFlag := fs.String("file", "", "path to authorized_keys file (overrides config)")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+
+	authKeysPath, err := resolveAuthKeysPathErr(*fileFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+	store, err := auth.OpenRevocationStore(auth.RevocationsPath(authKeysPath))
+	if err != nil {
+		return err
+	}
+
+	revs := store.List()
+	if len(revs) == 0 {
+		fmt.Fprintln(stdout, "No revocations.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Revocations (%d):\n\n", len(revs))
+	for i, r := range revs {
+		fmt.Fprintf(stdout, "  %d. %s  group=%s\n", i+1, r.PeerID, r.Group)
+		detail := fmt.Sprintf("by %s at %s", r.Issuer[:16]+"...", time.Unix(r.IssuedAt, 0).Format(time.RFC3339))
+		if r.Reason != "" {
+			detail += " (" + r.Reason + ")"
+		}
+		termcolor.Faint("     %s\n", detail)
+	}
+	return nil
+}
+
+func runAuthRole(args []string) {
+	if err := doAuthRole(args, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+// doAuthRole adds or removes a named role on a peer's authorized_keys line.
+// Services reference roles with allowed_roles.
+func doAuthRole(args []string, stdout io.Writer) error {
+	const usage = "usage: peerup auth role add|remove <peer-id> <role>"
+	if len(args) < 1 {
+		return fmt.Errorf(usage)
+	}
+	action := args[0]
+	if action != "add" && action != "remove" {
+		return fmt.Errorf("unknown role command %q\n%s", action, usage)
+	}
+
+	fs := flag.NewFlagSet("auth role "+action, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFlag := fs.String("config", "", "path to config file")
+	fileFlag := fs.String("file", "", "path to authorized_keys file (overrides config)")
+	if err := fs.Parse(reorderArgs(args[1:], nil)); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf(usage)
+	}
+
+	peerIDStr, role := fs.Arg(0), fs.Arg(1)
+	authKeysPath, err := resolveAuthKeysPathErr(*fileFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+
+	short := peerIDStr[:min(16, len(peerIDStr))] + "..."
+	if action == "add" {
+		if err := auth.AddPeerRole(authKeysPath, peerIDStr, role); err != nil {
+			return fmt.Errorf("failed to add role: %w", err)
+		}
+		termcolor.Green("Added role %s to peer: %s", role, short)
+	} else {
+		if err := auth.RemovePeerRole(authKeysPath, peerIDStr, role); err != nil {
+			return fmt.Errorf("failed to remove role: %w", err)
+		}
+		termcolor.Green("Removed role %s from peer: %s", role, short)
+	}
+	fmt.Fprintf(stdout, "  File: %s\n", authKeysPath)
+	return nil
+}
+
 func runAuthValidate(args []string) {
 	if err := doAuthValidate(args, os.Stdout); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
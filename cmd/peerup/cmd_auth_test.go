@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +10,9 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+	"github.com/satindergrewal/peer-up/internal/daemon"
 )
 
 // generateTestPeerID creates a fresh valid Ed25519 peer ID for testing.
@@ -316,6 +320,63 @@ func TestDoAuthRemove_PeerActuallyRemoved(t *testing.T) {
 	}
 }
 
+// ----- doAuthRole tests -----
+
+func TestDoAuthRole(t *testing.T) {
+	dir := t.TempDir()
+	peerID := generateTestPeerID(t)
+	akPath := writeAuthKeysFile(t, dir, peerID+"  # teammate\n")
+
+	var stdout bytes.Buffer
+	if err := doAuthRole([]string{"add", peerID, "ops", "--file", akPath}, &stdout); err != nil {
+		t.Fatalf("role add: %v", err)
+	}
+	data, _ := os.ReadFile(akPath)
+	if !strings.Contains(string(data), "role=ops") {
+		t.Errorf("authorized_keys should contain role=ops, got:\n%s", data)
+	}
+
+	if err := doAuthRole([]string{"add", peerID, "ops", "--file", akPath}, &stdout); err == nil ||
+		!strings.Contains(err.Error(), "role already assigned") {
+		t.Errorf("duplicate role: err = %v", err)
+	}
+
+	if err := doAuthRole([]string{"remove", peerID, "ops", "--file", akPath}, &stdout); err != nil {
+		t.Fatalf("role remove: %v", err)
+	}
+	data, _ = os.ReadFile(akPath)
+	if strings.Contains(string(data), "role=") {
+		t.Errorf("authorized_keys should not contain role=, got:\n%s", data)
+	}
+}
+
+func TestDoAuthRole_BadArgs(t *testing.T) {
+	dir := t.TempDir()
+	peerID := generateTestPeerID(t)
+	akPath := writeAuthKeysFile(t, dir, peerID+"\n")
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"no action", nil, "usage"},
+		{"unknown action", []string{"rename", peerID, "ops", "--file", akPath}, "unknown role command"},
+		{"missing role", []string{"add", peerID, "--file", akPath}, "usage"},
+		{"invalid role", []string{"add", peerID, "Ops", "--file", akPath}, "invalid role name"},
+		{"unknown peer", []string{"add", generateTestPeerID(t), "ops", "--file", akPath}, "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := doAuthRole(tt.args, &stdout)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want mention of %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 // ----- doAuthValidate tests -----
 
 func TestDoAuthValidate(t *testing.T) {
@@ -504,3 +565,74 @@ func TestDoAuthValidate_ErrorLinesInOutput(t *testing.T) {
 		t.Errorf("output should reference the invalid line, got:\n%s", out)
 	}
 }
+
+// ----- doAuthRevoke tests -----
+
+// fakeAuthRevoker records the revoke request sent to the daemon.
+type fakeAuthRevoker struct {
+	peerID, reason string
+}
+
+func (f *fakeAuthRevoker) AuthRevoke(peerID, reason string) (*daemon.AuthRevokeResponse, error) {
+	f.peerID, f.reason = peerID, reason
+	return &daemon.AuthRevokeResponse{PeerID: peerID, Group: "g1", Removed: true, Delivered: []string{"peer-a"}}, nil
+}
+
+func TestDoAuthRevoke_ViaDaemon(t *testing.T) {
+	target := generateTestPeerID(t)
+	c := &fakeAuthRevoker{}
+	var out bytes.Buffer
+	if err := doAuthRevoke([]string{target, "--reason", "stolen"}, c, &out); err != nil {
+		t.Fatalf("doAuthRevoke() error = %v", err)
+	}
+	if c.peerID != target || c.reason != "stolen" {
+		t.Errorf("daemon got %q, %q", c.peerID, c.reason)
+	}
+	if !strings.Contains(out.String(), "peer-a") {
+		t.Errorf("output missing delivered peer: %q", out.String())
+	}
+}
+
+func TestDoAuthRevoke_Offline(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := newTestKeyFile(t)
+	target := generateTestPeerID(t)
+	manual := generateTestPeerID(t)
+	akPath := writeAuthKeysFile(t, dir, target+"  group=g1  # laptop\n"+manual+"\n")
+
+	var out bytes.Buffer
+	args := []string{target, "--file", akPath, "--key", keyPath, "--reason", "stolen"}
+	if err := doAuthRevoke(args, nil, &out); err != nil {
+		t.Fatalf("doAuthRevoke() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(akPath)
+	if strings.Contains(string(data), target) {
+		t.Error("revoked peer still in authorized_keys")
+	}
+	store, err := auth.OpenRevocationStore(auth.RevocationsPath(akPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revs := store.List()
+	if len(revs) != 1 || revs[0].PeerID != target || revs[0].Group != "g1" || revs[0].Reason != "stolen" {
+		t.Fatalf("stored revocations = %+v", revs)
+	}
+	if _, _, err := revs[0].Verify(); err != nil {
+		t.Errorf("stored notice does not verify: %v", err)
+	}
+
+	out.Reset()
+	if err := doAuthRevocations([]string{"--file", akPath}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), target) {
+		t.Errorf("revocations output missing peer: %q", out.String())
+	}
+
+	// Peers added by hand have no group to propagate to.
+	err = doAuthRevoke([]string{manual, "--file", akPath, "--key", keyPath}, nil, &out)
+	if !errors.Is(err, auth.ErrNoPairingGroup) {
+		t.Errorf("manual peer: err = %v, want ErrNoPairingGroup", err)
+	}
+}
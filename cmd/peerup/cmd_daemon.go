@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -28,6 +29,7 @@ func (rt *serveRuntime) StartTime() time.Time                 { return rt.startT
 func (rt *serveRuntime) PingProtocolID() string               { return rt.config.Protocols.PingPong.ID }
 func (rt *serveRuntime) Interfaces() *p2pnet.InterfaceSummary { return rt.ifSummary }
 func (rt *serveRuntime) PathTracker() *p2pnet.PathTracker     { return rt.pathTracker }
+func (rt *serveRuntime) RelayHealth() *p2pnet.RelayHealth     { return rt.relayHealth }
 func (rt *serveRuntime) STUNResult() *p2pnet.STUNResult {
 	if rt.stunProber == nil {
 		return nil
@@ -45,14 +47,41 @@ func (rt *serveRuntime) GaterForHotReload() daemon.GaterReloader {
 	if rt.gater == nil || rt.authKeys == "" {
 		return nil
 	}
-	return &gaterReloader{gater: rt.gater, authKeysPath: rt.authKeys}
+	return &gaterReloader{gater: rt.gater, authKeysPath: rt.authKeys, tunnels: rt.tunnels}
+}
+
+func (rt *serveRuntime) Revoker() daemon.Revoker {
+	if rt.revokes == nil {
+		return nil
+	}
+	return rt
+}
+
+func (rt *serveRuntime) Tunnels() *p2pnet.ReverseTunnels {
+	return rt.tunnels
+}
+
+func (rt *serveRuntime) Inviter() daemon.Inviter {
+	if rt.invites == nil {
+		return nil
+	}
+	return rt
+}
+
+func (rt *serveRuntime) Directory() daemon.DirectorySyncer {
+	if rt.directory == nil {
+		return nil
+	}
+	return rt
 }
 
 // gaterReloader implements daemon.GaterReloader by re-reading the
-// authorized_keys file and updating the live connection gater.
+// authorized_keys file and updating the live connection gater. Reverse
+// tunnels of peers that lost access are closed.
 type gaterReloader struct {
 	gater        *auth.AuthorizedPeerGater
 	authKeysPath string
+	tunnels      *p2pnet.ReverseTunnels // nil-safe
 }
 
 func (g *gaterReloader) ReloadFromFile() error {
@@ -60,7 +89,13 @@ func (g *gaterReloader) ReloadFromFile() error {
 	if err != nil {
 		return fmt.Errorf("failed to reload authorized_keys: %w", err)
 	}
+	roles, err := auth.LoadPeerRoles(g.authKeysPath)
+	if err != nil {
+		return fmt.Errorf("failed to reload authorized_keys roles: %w", err)
+	}
 	g.gater.UpdateAuthorizedPeers(peers)
+	g.gater.UpdatePeerRoles(roles)
+	g.tunnels.Recheck()
 	return nil
 }
 
@@ -106,6 +141,8 @@ func runDaemon(args []string) {
 		runDaemonPeers(args[1:])
 	case "paths":
 		runDaemonPaths(args[1:])
+	case "events":
+		runDaemonEvents(args[1:])
 	case "connect":
 		runDaemonConnect(args[1:])
 	case "disconnect":
@@ -128,6 +165,7 @@ func printDaemonUsage() {
 	fmt.Println("  services [--json]")
 	fmt.Println("  peers [--all] [--json]")
 	fmt.Println("  paths [--json]")
+	fmt.Println("  events [--type peer,path,...] [--peer <name>] [--json]")
 	fmt.Println("  connect --peer <name> --service <svc> --listen <addr>")
 	fmt.Println("  disconnect <id>")
 }
@@ -155,14 +193,30 @@ func runDaemonStart(args []string) {
 	// the relay tries to deliver peer introductions before the handler exists.
 	rt.SetupPingPong()
 	rt.SetupPeerNotify()
+	rt.SetupKeyRotation()
+	if err := rt.SetupRevocations(); err != nil {
+		fatal("Revocation store error: %v", err)
+	}
+	if err := rt.SetupDirectory(); err != nil {
+		fatal("Directory store error: %v", err)
+	}
+	if err := rt.SetupAsyncInvites(); err != nil {
+		fatal("Pending invites error: %v", err)
+	}
+	rt.SetupReverseTunnels()
 
 	if err := rt.Bootstrap(); err != nil {
 		rt.Shutdown()
 		fatal("Bootstrap failed: %v", err)
 	}
 
+	rt.StartLANDiscovery()
 	rt.ExposeConfiguredServices()
+	rt.StartDirectorySync()
+	rt.StartNameServer()
+	rt.StartMeshProxy()
 	rt.StartPeerHistorySaver()
+	rt.StartQuotaSaver()
 
 	// Start daemon API server
 	socketPath := daemonSocketPath()
@@ -170,6 +224,8 @@ func runDaemonStart(args []string) {
 
 	srv := daemon.NewServer(rt, socketPath, cookiePath, version)
 	srv.SetInstrumentation(rt.metrics, rt.audit)
+	keepaliveInterval, _ := time.ParseDuration(rt.config.Proxy.KeepaliveInterval) // validated by config loader
+	srv.SetProxyWarmup(rt.config.Proxy.Warmup, keepaliveInterval)
 	if err := srv.Start(); err != nil {
 		rt.Shutdown()
 		fatal("Daemon API failed to start: %v", err)
@@ -385,20 +441,71 @@ func runDaemonPaths(args []string) {
 	}
 }
 
+func runDaemonEvents(args []string) {
+	fs := flag.NewFlagSet("daemon events", flag.ExitOnError)
+	typeFlag := fs.String("type", "", "comma-separated event types or prefixes (e.g. peer,path.upgraded)")
+	peerFlag := fs.String("peer", "", "only events for this peer (name or ID)")
+	jsonFlag := fs.Bool("json", false, "output one JSON event per line")
+	fs.Parse(args)
+
+	req := daemon.EventsRequest{Peer: *peerFlag}
+	if *typeFlag != "" {
+		req.Types = strings.Split(*typeFlag, ",")
+	}
+
+	c := daemonClient()
+
+	// Stream until Ctrl+C or the daemon stops.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	if *jsonFlag {
+		enc := json.NewEncoder(os.Stdout)
+		err = c.Events(ctx, req, func(e p2pnet.Event) error {
+			return enc.Encode(e)
+		})
+	} else {
+		err = c.EventsText(ctx, req, os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
 func runDaemonConnect(args []string) {
 	fs := flag.NewFlagSet("daemon connect", flag.ExitOnError)
 	peerFlag := fs.String("peer", "", "peer name or ID")
 	serviceFlag := fs.String("service", "", "service name")
 	listenFlag := fs.String("listen", "", "local listen address (e.g. 127.0.0.1:2222)")
+	udpFlag := fs.Bool("udp", false, "forward UDP datagrams instead of TCP")
+	warmupFlag := fs.Bool("warmup", false, "keep the connection to the peer alive between client connections")
+	socketModeFlag := fs.String("socket-mode", "", "permissions for a unix: listen socket (e.g. 0660)")
+	socketGroupFlag := fs.String("socket-group", "", "group to own a unix: listen socket")
 	fs.Parse(args)
 
 	if *peerFlag == "" || *serviceFlag == "" || *listenFlag == "" {
-		fmt.Fprintln(os.Stderr, "Usage: peerup daemon connect --peer <name> --service <svc> --listen <addr>")
+		fmt.Fprintln(os.Stderr, "Usage: peerup daemon connect --peer <name> --service <svc> --listen <addr|unix:path> [--udp] [--warmup] [--socket-mode 0660] [--socket-group <g>]")
 		osExit(1)
 	}
 
+	protocol := p2pnet.ServiceTransportTCP
+	if *udpFlag {
+		protocol = p2pnet.ServiceTransportUDP
+	}
+
 	c := daemonClient()
-	resp, err := c.Connect(*peerFlag, *serviceFlag, *listenFlag)
+	resp, err := c.ConnectWith(daemon.ConnectRequest{
+		Peer:     *peerFlag,
+		Service:  *serviceFlag,
+		Listen:   absLocalAddr(*listenFlag),
+		Protocol: protocol,
+		Warmup:   *warmupFlag,
+
+		SocketMode:  *socketModeFlag,
+		SocketGroup: *socketGroupFlag,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		osExit(1)
@@ -27,13 +27,35 @@ import (
 const inviteProtocol = "/peerup/invite/1.0.0"
 
 func runInvite(args []string) {
+	if runInviteAsyncCommand(args) {
+		return
+	}
+
 	fs := flag.NewFlagSet("invite", flag.ExitOnError)
 	configFlag := fs.String("config", "", "path to config file")
 	nameFlag := fs.String("name", "", "friendly name for this peer (e.g., \"home\")")
-	ttlFlag := fs.Duration("ttl", 10*time.Minute, "invite code expiry duration")
+	ttlFlag := fs.Duration("ttl", 10*time.Minute, "invite code expiry duration (async default: 24h)")
 	nonInteractive := fs.Bool("non-interactive", false, "machine-friendly output (no QR, bare code to stdout)")
+	asyncFlag := fs.Bool("async", false, "leave the invite at the relays; the joiner can redeem it while this machine is offline")
 	fs.Parse(args)
 
+	if *asyncFlag {
+		ttl := time.Duration(0) // daemon default
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "ttl" {
+				ttl = *ttlFlag
+			}
+		})
+		var c inviteClient
+		if dc := tryDaemonClient(); dc != nil {
+			c = dc
+		}
+		if err := doInviteAsync(*nameFlag, ttl, *nonInteractive, c, os.Stdout); err != nil {
+			fatal("Error: %v", err)
+		}
+		return
+	}
+
 	// In non-interactive mode, progress goes to stderr so stdout has only the invite code.
 	out := fmt.Printf
 	outln := fmt.Println
@@ -66,6 +88,7 @@ func runInvite(args []string) {
 	// Create P2P network (no connection gating - we need the joiner to reach us)
 	p2pNetwork, err := p2pnet.New(&p2pnet.Config{
 		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
 		Config:             &config.Config{Network: cfg.Network},
 		UserAgent:          "peerup/" + version,
 		EnableRelay:        true,
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/internal/qr"
+	"github.com/satindergrewal/peer-up/internal/termcolor"
+)
+
+// inviteClient is the daemon API surface used by asynchronous invites.
+type inviteClient interface {
+	CreateInvite(name string, ttl time.Duration) (*daemon.InviteInfo, error)
+	Invites() ([]daemon.InviteInfo, error)
+	CancelInvite(id string) error
+}
+
+// runInviteAsyncCommand handles "peerup invite list|cancel". Reports false
+// when args are not an asynchronous invite subcommand.
+func runInviteAsyncCommand(args []string) bool {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "cancel") {
+		return false
+	}
+
+	var c inviteClient
+	if dc := tryDaemonClient(); dc != nil {
+		c = dc
+	}
+	var err error
+	if args[0] == "list" {
+		err = doInviteList(args[1:], c, os.Stdout)
+	} else {
+		err = doInviteCancel(args[1:], c, os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+	return true
+}
+
+// requireInviteDaemon returns an error when no daemon is running. The
+// daemon keeps the invite's reply key and completes authorization, so
+// asynchronous invites need one.
+func requireInviteDaemon(c inviteClient) error {
+	if c == nil {
+		return fmt.Errorf("daemon is not running; start it with 'peerup daemon' to use asynchronous invites")
+	}
+	return nil
+}
+
+// doInviteAsync creates an asynchronous invite through the daemon. The
+// joiner can redeem the code while this machine is offline.
+func doInviteAsync(name string, ttl time.Duration, nonInteractive bool, c inviteClient, stdout io.Writer) error {
+	if err := requireInviteDaemon(c); err != nil {
+		return err
+	}
+	inv, err := c.CreateInvite(name, ttl)
+	if err != nil {
+		return fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	if nonInteractive {
+		fmt.Fprintln(stdout, inv.Code)
+		return nil
+	}
+
+	expires := inv.Expires
+	if t, err := time.Parse(time.RFC3339, inv.Expires); err == nil {
+		expires = t.Local().Format("2006-01-02 15:04 MST")
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintf(stdout, "=== Asynchronous Invite Code (expires %s) ===\n", expires)
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, inv.Code)
+	fmt.Fprintln(stdout)
+	if q, err := qr.New(inv.Code, qr.Medium); err == nil {
+		fmt.Fprintln(stdout, "Scan this QR code to join:")
+		fmt.Fprintln(stdout)
+		fmt.Fprint(stdout, q.ToSmallString(false))
+	}
+	fmt.Fprintln(stdout, "Or on that device, run:  peerup join <code>")
+	fmt.Fprintln(stdout)
+	fmt.Fprintf(stdout, "Held by %d relay(s). This machine does not need to stay online:\n", len(inv.Relays))
+	fmt.Fprintln(stdout, "the daemon authorizes the joiner the next time it reaches a relay.")
+	fmt.Fprintf(stdout, "Cancel with: peerup invite cancel %s\n", inv.ID)
+	return nil
+}
+
+func doInviteList(args []string, c inviteClient, stdout io.Writer) error {
+	fs := flag.NewFlagSet("invite list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonFlag := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(reorderArgs(args, map[string]bool{"json": true})); err != nil {
+		return err
+	}
+	if err := requireInviteDaemon(c); err != nil {
+		return err
+	}
+
+	invites, err := c.Invites()
+	if err != nil {
+		return err
+	}
+	if *jsonFlag {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(invites)
+	}
+
+	if len(invites) == 0 {
+		fmt.Fprintln(stdout, "No pending invites.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Pending invites (%d):\n\n", len(invites))
+	for _, inv := range invites {
+		name := inv.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(stdout, "  %s  %-16s %d relay(s)  expires %s\n", inv.ID, name, len(inv.Relays), inv.Expires)
+	}
+	return nil
+}
+
+func doInviteCancel(args []string, c inviteClient, stdout io.Writer) error {
+	fs := flag.NewFlagSet("invite cancel", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: peerup invite cancel <id>")
+	}
+	if err := requireInviteDaemon(c); err != nil {
+		return err
+	}
+
+	if err := c.CancelInvite(fs.Arg(0)); err != nil {
+		return err
+	}
+	termcolor.Green("Invite %s cancelled", fs.Arg(0))
+	return nil
+}
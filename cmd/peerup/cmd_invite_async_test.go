@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satindergrewal/peer-up/internal/daemon"
+)
+
+// fakeInviteClient records invite requests and returns canned results.
+type fakeInviteClient struct {
+	invites   []daemon.InviteInfo
+	name      string
+	ttl       time.Duration
+	cancelled []string
+}
+
+func (f *fakeInviteClient) CreateInvite(name string, ttl time.Duration) (*daemon.InviteInfo, error) {
+	f.name, f.ttl = name, ttl
+	return &daemon.InviteInfo{ID: "0123abcd", Code: "AAAA-BBBB-CCCC", Name: name, Relays: []string{"r1", "r2"}, Expires: "2026-01-02T15:04:05Z"}, nil
+}
+
+func (f *fakeInviteClient) Invites() ([]daemon.InviteInfo, error) { return f.invites, nil }
+
+func (f *fakeInviteClient) CancelInvite(id string) error {
+	f.cancelled = append(f.cancelled, id)
+	return nil
+}
+
+func TestDoInviteAsync(t *testing.T) {
+	c := &fakeInviteClient{}
+	var out bytes.Buffer
+	if err := doInviteAsync("home", 48*time.Hour, false, c, &out); err != nil {
+		t.Fatalf("doInviteAsync() error = %v", err)
+	}
+	if c.name != "home" || c.ttl != 48*time.Hour {
+		t.Errorf("request = %q, %v", c.name, c.ttl)
+	}
+	for _, want := range []string{"AAAA-BBBB-CCCC", "Held by 2 relay(s)", "peerup invite cancel 0123abcd"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := doInviteAsync("", 0, true, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "AAAA-BBBB-CCCC\n" {
+		t.Errorf("non-interactive output = %q, want the bare code", out.String())
+	}
+
+	if err := doInviteAsync("", 0, false, nil, &out); err == nil || !strings.Contains(err.Error(), "daemon is not running") {
+		t.Errorf("no daemon error = %v", err)
+	}
+}
+
+func TestDoInviteList(t *testing.T) {
+	c := &fakeInviteClient{invites: []daemon.InviteInfo{
+		{ID: "0123abcd", Name: "home", Relays: []string{"r1"}, Expires: "2026-01-02T15:04:05Z"},
+	}}
+	var out bytes.Buffer
+	if err := doInviteList(nil, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "0123abcd  home") {
+		t.Errorf("output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := doInviteList([]string{"--json"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	var invites []daemon.InviteInfo
+	if err := json.Unmarshal(out.Bytes(), &invites); err != nil || len(invites) != 1 {
+		t.Errorf("JSON output = %q (err %v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := doInviteList(nil, &fakeInviteClient{}, &out); err != nil || !strings.Contains(out.String(), "No pending invites") {
+		t.Errorf("empty list = %q, %v", out.String(), err)
+	}
+}
+
+func TestDoInviteCancel(t *testing.T) {
+	c := &fakeInviteClient{}
+	var out bytes.Buffer
+	if err := doInviteCancel([]string{"0123abcd"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.cancelled) != 1 || c.cancelled[0] != "0123abcd" {
+		t.Errorf("cancelled = %v", c.cancelled)
+	}
+	if err := doInviteCancel(nil, c, &out); err == nil {
+		t.Error("expected usage error without an ID")
+	}
+}
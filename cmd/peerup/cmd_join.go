@@ -6,6 +6,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"flag"
 
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -39,6 +41,8 @@ func runJoin(args []string) {
 	configFlag := fs.String("config", "", "path to config file")
 	nameFlag := fs.String("name", "", "friendly name for this peer (e.g., \"laptop\")")
 	nonInteractive := fs.Bool("non-interactive", false, "machine-friendly output for scripting")
+	var relayFlags stringsFlag
+	fs.Var(&relayFlags, "relay", "fallback relay for pairing codes (repeatable; federated relays)")
 	fs.Parse(args)
 
 	// In non-interactive mode, progress goes to stderr so stdout is clean.
@@ -65,7 +69,7 @@ func runJoin(args []string) {
 	}
 
 	if code == "" {
-		fmt.Println("Usage: peerup join <invite-code> [--name \"laptop\"] [--non-interactive]")
+		fmt.Println("Usage: peerup join <invite-code> [--name \"laptop\"] [--relay <multiaddr>]... [--non-interactive]")
 		fmt.Println()
 		fmt.Println("The invite code is generated by 'peerup invite' on the other machine.")
 		fmt.Println()
@@ -77,14 +81,23 @@ func runJoin(args []string) {
 
 	// Decode invite
 	data, err := invite.Decode(code)
+	if errors.Is(err, invite.ErrChecksum) {
+		fatal("Invalid invite code: %v (check the code for typos)", err)
+	}
 	if err != nil {
 		fatal("Invalid invite code: %v", err)
 	}
+	if data.Expired() {
+		fatal("This invite code expired at %s. Ask for a new one.", data.Expires.Format(time.RFC3339))
+	}
 
 	// Dispatch based on version.
-	switch data.Version {
-	case invite.VersionV2:
-		runPairJoin(data, *nameFlag, *configFlag, *nonInteractive, out, outln)
+	switch {
+	case data.Mailbox:
+		runMailboxJoin(data, pairRelayAddrs(data.RelayAddrs, relayFlags), *nameFlag, *configFlag, *nonInteractive, out, outln)
+		return
+	case data.Version == invite.VersionV2, data.Version == invite.VersionV3:
+		runPairJoin(data, pairRelayAddrs(data.RelayAddrs, relayFlags), *nameFlag, *configFlag, *nonInteractive, out, outln)
 		return
 	}
 
@@ -111,6 +124,7 @@ func runJoin(args []string) {
 	// Create P2P network (no connection gating for joining)
 	p2pNetwork, err := p2pnet.New(&p2pnet.Config{
 		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
 		Config:             &config.Config{Network: cfg.Network},
 		UserAgent:          "peerup/" + version,
 		EnableRelay:        true,
@@ -250,13 +264,29 @@ func joinPAKE(s network.Stream, token [8]byte, joinerName string) string {
 	return strings.TrimSpace(inviterName)
 }
 
-// runPairJoin handles v2 relay pairing codes.
-func runPairJoin(data *invite.InviteData, nameFlag, configFlag string, nonInteractive bool,
+// pairRelayAddrs lists the relays to try for a pairing code: the code's own
+// relays first, then any federated relays given with --relay.
+func pairRelayAddrs(codeRelays []string, extra []string) []string {
+	addrs := slices.Clone(codeRelays)
+	for _, a := range extra {
+		if !slices.Contains(addrs, a) {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// runPairJoin handles v2 and v3 relay pairing codes. relayAddrs are tried in
+// order; federated relays share pairing groups, so any of them can
+// redeem the code.
+func runPairJoin(data *invite.InviteData, relayAddrs []string, nameFlag, configFlag string, nonInteractive bool,
 	out func(string, ...any) (int, error), outln func(...any) (int, error)) {
 
 	outln("=== peer-up pair-join ===")
 	outln()
-	out("Relay:   %s\n", data.RelayAddr)
+	for _, addr := range relayAddrs {
+		out("Relay:   %s\n", addr)
+	}
 	if data.Network != "" {
 		out("Network: %s\n", data.Network)
 	}
@@ -271,21 +301,17 @@ func runPairJoin(data *invite.InviteData, nameFlag, configFlag string, nonIntera
 	}
 	outln()
 
-	// Ensure relay address from invite code is in config.
-	// New configs include it via template, but existing configs
-	// may not have it (e.g., after "relay remove").
-	hasRelay := false
-	for _, a := range cfg.Relay.Addresses {
-		if a == data.RelayAddr {
-			hasRelay = true
-			break
+	// Ensure the relay addresses are in config.
+	// New configs include the code's relay via template, but existing
+	// configs may not have it (e.g., after "relay remove").
+	for _, addr := range relayAddrs {
+		if slices.Contains(cfg.Relay.Addresses, addr) {
+			continue
 		}
-	}
-	if !hasRelay {
-		if err := addRelayToConfigFile(cfgFile, data.RelayAddr); err != nil {
+		if err := addRelayToConfigFile(cfgFile, addr); err != nil {
 			log.Printf("Warning: could not add relay to config: %v", err)
 		} else {
-			cfg.Relay.Addresses = append(cfg.Relay.Addresses, data.RelayAddr)
+			cfg.Relay.Addresses = append(cfg.Relay.Addresses, addr)
 			out("Added relay address to config.\n")
 		}
 	}
@@ -293,10 +319,11 @@ func runPairJoin(data *invite.InviteData, nameFlag, configFlag string, nonIntera
 	// Create P2P network (no connection gating for joining).
 	p2pNetwork, err := p2pnet.New(&p2pnet.Config{
 		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
 		Config:             &config.Config{Network: cfg.Network},
 		UserAgent:          "peerup/" + version,
 		EnableRelay:        true,
-		RelayAddrs:         []string{data.RelayAddr},
+		RelayAddrs:         relayAddrs,
 		ForcePrivate:       cfg.Network.ForcePrivateReachability,
 		EnableNATPortMap:   true,
 		EnableHolePunching: true,
@@ -313,28 +340,35 @@ func runPairJoin(data *invite.InviteData, nameFlag, configFlag string, nonIntera
 	out("Your Peer ID: %s\n", h.ID())
 	outln()
 
-	// Connect to relay.
-	outln("Connecting to relay...")
-	relayInfos, err := p2pnet.ParseRelayAddrs([]string{data.RelayAddr})
+	// Connect to the first reachable relay and open a pairing stream.
+	relayInfos, err := p2pnet.ParseRelayAddrs(relayAddrs)
 	if err != nil {
 		fatal("Failed to parse relay address: %v", err)
 	}
+	var s network.Stream
 	for _, ai := range relayInfos {
+		outln("Connecting to relay...")
 		if err := h.Connect(ctx, ai); err != nil {
-			fatal("Failed to connect to relay: %v", err)
+			out("Relay %s unreachable: %v\n", ai.ID.String()[:16]+"...", err)
+			continue
 		}
+		pairCtx := network.WithAllowLimitedConn(ctx, relay.PairingProtocol)
+		s, err = h.NewStream(pairCtx, ai.ID, protocol.ID(relay.PairingProtocol))
+		if err != nil {
+			out("Relay %s does not accept pairing: %v\n", ai.ID.String()[:16]+"...", err)
+			continue
+		}
+		break
+	}
+	if s == nil {
+		fatal("Failed to connect to relay: no relay reachable")
 	}
+	defer s.Close()
 	outln("Connected to relay.")
 
-	// Open pairing protocol stream to relay.
+	// Send the pairing code. A rejected code is final: federated relays
+	// share pairing state, so another relay would answer the same.
 	outln("Sending pairing code...")
-	relayPeerID := relayInfos[0].ID
-	pairCtx := network.WithAllowLimitedConn(ctx, relay.PairingProtocol)
-	s, err := h.NewStream(pairCtx, relayPeerID, protocol.ID(relay.PairingProtocol))
-	if err != nil {
-		fatal("Failed to open pairing stream: %v", err)
-	}
-	defer s.Close()
 
 	// Send token + name.
 	reqBytes := relay.EncodePairingRequest(data.TokenV2, nameFlag)
@@ -360,22 +394,26 @@ func runPairJoin(data *invite.InviteData, nameFlag, configFlag string, nonIntera
 	// Add discovered peers to authorized_keys and config names.
 	authKeysPath := cfg.Security.AuthorizedKeysFile
 
-	// Authorize relay and annotate with group ID so hasGroupMembership() works
-	// for peer-notify validation (even if this peer joined first with 0 peers).
+	// Authorize the relays and annotate them with the group ID so
+	// hasGroupMembership() works for peer-notify validation (even if this
+	// peer joined first with 0 peers). Federated relays deliver
+	// introductions for the group too.
 	if groupID != "" {
-		if err := auth.AddPeer(authKeysPath, relayPeerID.String(), "relay"); err != nil {
-			if !strings.Contains(err.Error(), "already authorized") {
-				log.Printf("Warning: failed to authorize relay: %v", err)
-			}
-		}
-		auth.SetPeerAttr(authKeysPath, relayPeerID.String(), "group", groupID)
-
-		// Compute and store own HMAC commitment proof for this group.
+		// Compute own HMAC commitment proof for this group.
 		// proof = HMAC-SHA256(token, groupID) - matches what the relay stored.
 		mac := hmac.New(sha256.New, data.TokenV2)
 		mac.Write([]byte(groupID))
-		ownProof := mac.Sum(nil)
-		auth.SetPeerAttr(authKeysPath, relayPeerID.String(), "hmac_proof", hex.EncodeToString(ownProof))
+		ownProof := hex.EncodeToString(mac.Sum(nil))
+
+		for _, ai := range relayInfos {
+			if err := auth.AddPeer(authKeysPath, ai.ID.String(), "relay"); err != nil {
+				if !strings.Contains(err.Error(), "already authorized") {
+					log.Printf("Warning: failed to authorize relay: %v", err)
+				}
+			}
+			auth.SetPeerAttr(authKeysPath, ai.ID.String(), "group", groupID)
+			auth.SetPeerAttr(authKeysPath, ai.ID.String(), "hmac_proof", ownProof)
+		}
 	}
 
 	// Load existing names for conflict resolution.
@@ -448,6 +486,161 @@ func runPairJoin(data *invite.InviteData, nameFlag, configFlag string, nonIntera
 	}
 }
 
+// runMailboxJoin redeems an asynchronous invite: the inviter's sealed
+// introduction is fetched from the first relay that holds it and answered
+// with this node's identity. The inviter is authorized here right away; the
+// inviter's daemon authorizes this node when the relay delivers the reply.
+func runMailboxJoin(data *invite.InviteData, relayAddrs []string, nameFlag, configFlag string, nonInteractive bool,
+	out func(string, ...any) (int, error), outln func(...any) (int, error)) {
+
+	outln("=== peer-up join (asynchronous invite) ===")
+	outln()
+	for _, addr := range relayAddrs {
+		out("Relay:   %s\n", addr)
+	}
+	if data.Network != "" {
+		out("Network: %s\n", data.Network)
+	}
+	outln()
+
+	cfgFile, cfg, configDir, created := loadOrCreateConfig(configFlag, data.RelayAddr, data.Network)
+	if created {
+		out("Created new config: %s\n", cfgFile)
+	} else {
+		out("Using config: %s\n", cfgFile)
+	}
+	outln()
+
+	// The inviter's daemon may be offline, so both sides meet at these relays.
+	for _, addr := range relayAddrs {
+		if slices.Contains(cfg.Relay.Addresses, addr) {
+			continue
+		}
+		if err := addRelayToConfigFile(cfgFile, addr); err != nil {
+			log.Printf("Warning: could not add relay to config: %v", err)
+		} else {
+			cfg.Relay.Addresses = append(cfg.Relay.Addresses, addr)
+			out("Added relay address to config.\n")
+		}
+	}
+
+	p2pNetwork, err := p2pnet.New(&p2pnet.Config{
+		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
+		Config:             &config.Config{Network: cfg.Network},
+		UserAgent:          "peerup/" + version,
+		EnableRelay:        true,
+		RelayAddrs:         relayAddrs,
+		ForcePrivate:       cfg.Network.ForcePrivateReachability,
+		EnableNATPortMap:   true,
+		EnableHolePunching: true,
+	})
+	if err != nil {
+		fatal("P2P network error: %v", err)
+	}
+	defer p2pNetwork.Close()
+
+	h := p2pNetwork.Host()
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	out("Your Peer ID: %s\n", h.ID())
+	outln()
+
+	relayInfos, err := p2pnet.ParseRelayAddrs(relayAddrs)
+	if err != nil {
+		fatal("Failed to parse relay address: %v", err)
+	}
+
+	// Redeem at the first relay that still holds the introduction. A relay
+	// that does not know the invite may simply not be the one it was left at.
+	token := data.TokenV2
+	id := invite.MailboxID(token)
+	var intro *invite.MailboxIntro
+	var redeemedAt peer.ID
+	for _, ai := range relayInfos {
+		outln("Connecting to relay...")
+		if err := h.Connect(ctx, ai); err != nil {
+			out("Relay %s unreachable: %v\n", ai.ID.String()[:16]+"...", err)
+			continue
+		}
+		err := relay.RedeemMailbox(ctx, h, ai.ID, id, func(sealed []byte) ([]byte, error) {
+			var err error
+			if intro, err = invite.OpenIntro(token, sealed); err != nil {
+				return nil, err
+			}
+			return invite.SealReply(token, intro.PublicKey, &invite.MailboxReply{PeerID: h.ID(), Name: nameFlag})
+		})
+		if err != nil {
+			intro = nil
+			out("Relay %s: %v\n", ai.ID.String()[:16]+"...", err)
+			if errors.Is(err, invite.ErrMailboxSeal) {
+				fatal("This invite code does not match the relay's invite. Ask for a new one.")
+			}
+			continue
+		}
+		redeemedAt = ai.ID
+		break
+	}
+	if intro == nil {
+		fatal("Failed to redeem invite: no relay holds it (already used, cancelled or expired)")
+	}
+
+	outln()
+	outln("=== Invite redeemed! ===")
+	outln()
+
+	authKeysPath := cfg.Security.AuthorizedKeysFile
+	existingNames := make(map[string]bool)
+	for n := range cfg.Names {
+		existingNames[n] = true
+	}
+	peerName := sanitizeYAMLName(intro.Name)
+	if peerName == "" {
+		peerName = "peer-" + intro.PeerID.String()[:8]
+	}
+	finalName := uniqueName(peerName, existingNames)
+	if finalName != peerName {
+		out("Name \"%s\" already in use. Registered as \"%s\".\n", peerName, finalName)
+		out("  Rename with: peerup config rename %s <newname>\n", finalName)
+	}
+	if err := auth.AddPeer(authKeysPath, intro.PeerID.String(), finalName); err != nil {
+		if !strings.Contains(err.Error(), "already authorized") {
+			log.Printf("Warning: failed to authorize peer: %v", err)
+		}
+	}
+	updateConfigNames(cfgFile, configDir, finalName, intro.PeerID.String())
+
+	emoji, numeric := p2pnet.ComputeFingerprint(h.ID(), intro.PeerID)
+	out("Peer \"%s\" authorized. [UNVERIFIED]\n", finalName)
+	out("  Verification code: %s  (%s)\n", emoji, numeric)
+	out("  Verify with: peerup verify %s\n", finalName)
+	outln()
+	out("Relay %s holds your reply. %s authorizes you, here and on the\n", redeemedAt.String()[:16]+"...", finalName)
+	outln("relay, the next time its daemon reaches the relay; until then connections are refused.")
+	outln()
+
+	out("Config: %s\n", cfgFile)
+	out("Authorized keys: %s\n", authKeysPath)
+	outln()
+
+	outln("Starting daemon...")
+	daemonCmd := exec.Command(os.Args[0], "daemon")
+	daemonCmd.Stdout = os.Stdout
+	daemonCmd.Stderr = os.Stderr
+	if err := daemonCmd.Start(); err != nil {
+		out("Could not auto-start daemon: %v\n", err)
+		out("Start manually with: peerup daemon\n")
+	} else {
+		outln("Daemon started.")
+		if !nonInteractive {
+			outln()
+			outln("Once the inviter's daemon is back online, try:")
+			out("  peerup ping %s\n", finalName)
+		}
+	}
+}
+
 // uniqueName appends a numeric suffix if name already exists in the set.
 func uniqueName(name string, existing map[string]bool) string {
 	if !existing[name] {
@@ -190,3 +190,14 @@ func TestUpdateConfigNames(t *testing.T) {
 		}
 	})
 }
+
+func TestPairRelayAddrs(t *testing.T) {
+	got := pairRelayAddrs([]string{"/ip4/203.0.113.5/tcp/7777/p2p/A"}, []string{
+		"/ip6/2001:db8::5/tcp/7777/p2p/B",
+		"/ip4/203.0.113.5/tcp/7777/p2p/A",
+	})
+	want := "/ip4/203.0.113.5/tcp/7777/p2p/A /ip6/2001:db8::5/tcp/7777/p2p/B"
+	if strings.Join(got, " ") != want {
+		t.Errorf("pairRelayAddrs() = %v, want the code's relay first without duplicates", got)
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/internal/identity"
+	"github.com/satindergrewal/peer-up/internal/termcolor"
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
+)
+
+func runKey(args []string) {
+	if len(args) < 1 {
+		printKeyUsage()
+		osExit(1)
+	}
+
+	var err error
+	switch args[0] {
+	case "encrypt":
+		err = doKeyEncrypt(args[1:], os.Stdout)
+	case "decrypt":
+		err = doKeyDecrypt(args[1:], os.Stdout)
+	case "change-passphrase":
+		err = doKeyChangePassphrase(args[1:], os.Stdout)
+	case "rotate":
+		var c keyRotator
+		if dc := tryDaemonClient(); dc != nil {
+			c = dc
+		}
+		err = doKeyRotate(args[1:], c, os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown key command: %s\n\n", args[0])
+		printKeyUsage()
+		osExit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+func printKeyUsage() {
+	fmt.Println("Usage: peerup key <command> [options]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  encrypt                                  Protect the identity key with a passphrase")
+	fmt.Println("  decrypt                                  Store the identity key in plaintext again")
+	fmt.Println("  change-passphrase [--new-passphrase-file <path>]")
+	fmt.Println("                                           Re-encrypt under a new passphrase")
+	fmt.Println("  rotate                                   Replace the key and tell authorized peers")
+	fmt.Println()
+	fmt.Println("All commands support --config <path> and --file <key-file>.")
+	fmt.Println()
+	fmt.Println("The passphrase is read from $" + identity.PassphraseEnv + ", then")
+	fmt.Println("identity.passphrase_file in the config, then a terminal prompt.")
+}
+
+// resolveKeyIdentity finds the identity key file and its passphrase settings.
+// Priority: --file flag > config's identity section.
+func resolveKeyIdentity(fileFlag, configFlag string) (config.IdentityConfig, error) {
+	if fileFlag != "" {
+		return config.IdentityConfig{KeyFile: fileFlag}, nil
+	}
+
+	cfgFile, err := config.FindConfigFile(configFlag)
+	if err != nil {
+		return config.IdentityConfig{}, fmt.Errorf("config error: %w\nUse --file to specify the key file directly", err)
+	}
+	cfg, err := config.LoadNodeConfig(cfgFile)
+	if err != nil {
+		return config.IdentityConfig{}, fmt.Errorf("config error: %w", err)
+	}
+	config.ResolveConfigPaths(cfg, filepath.Dir(cfgFile))
+
+	if cfg.Identity.KeyFile == "" {
+		return config.IdentityConfig{}, fmt.Errorf("no identity.key_file in config. Use --file to specify path")
+	}
+	return cfg.Identity, nil
+}
+
+// readKeyFile reads an existing key file after checking its permissions.
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if err := identity.CheckKeyFilePermissions(path); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func keyFlagSet(name string) (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFlag := fs.String("config", "", "path to config file")
+	fileFlag := fs.String("file", "", "path to identity key file (overrides config)")
+	return fs, configFlag, fileFlag
+}
+
+func doKeyEncrypt(args []string, stdout io.Writer) error {
+	fs, configFlag, fileFlag := keyFlagSet("key encrypt")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+
+	idCfg, err := resolveKeyIdentity(*fileFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+	data, err := readKeyFile(idCfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	if identity.IsEncryptedKey(data) {
+		return identity.ErrKeyAlreadyEncrypted
+	}
+	priv, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal key: %w", err)
+	}
+
+	// A scripted setup supplies the passphrase the same way the daemon will
+	// read it later; otherwise ask twice.
+	var pass []byte
+	switch {
+	case os.Getenv(identity.PassphraseEnv) != "" || idCfg.PassphraseFile != "":
+		pass, err = keyPassphrase(idCfg)()
+	default:
+		pass, err = newKeyPassphrase()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeEncryptedKey(idCfg.KeyFile, priv, pass); err != nil {
+		return err
+	}
+	termcolor.Green("Encrypted identity key: %s", idCfg.KeyFile)
+	printKeyPeerID(stdout, priv)
+	fmt.Fprintf(stdout, "  Unlock with $%s, identity.passphrase_file, or the terminal prompt.\n", identity.PassphraseEnv)
+	return nil
+}
+
+func doKeyDecrypt(args []string, stdout io.Writer) error {
+	fs, configFlag, fileFlag := keyFlagSet("key decrypt")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+
+	idCfg, err := resolveKeyIdentity(*fileFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+	priv, err := loadEncryptedKey(idCfg)
+	if err != nil {
+		return err
+	}
+
+	raw, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key: %w", err)
+	}
+	if err := identity.WriteKeyFile(idCfg.KeyFile, raw); err != nil {
+		return err
+	}
+	termcolor.Yellow("Decrypted identity key: %s (now protected only by file permissions)", idCfg.KeyFile)
+	printKeyPeerID(stdout, priv)
+	return nil
+}
+
+func doKeyChangePassphrase(args []string, stdout io.Writer) error {
+	fs, configFlag, fileFlag := keyFlagSet("key change-passphrase")
+	newFileFlag := fs.String("new-passphrase-file", "", "read the new passphrase from this file")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+
+	idCfg, err := resolveKeyIdentity(*fileFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+	priv, err := loadEncryptedKey(idCfg)
+	if err != nil {
+		return err
+	}
+
+	var pass []byte
+	if *newFileFlag != "" {
+		pass, err = identity.ReadPassphraseFile(*newFileFlag)
+	} else {
+		pass, err = newKeyPassphrase()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := writeEncryptedKey(idCfg.KeyFile, priv, pass); err != nil {
+		return err
+	}
+	termcolor.Green("Changed passphrase for: %s", idCfg.KeyFile)
+	printKeyPeerID(stdout, priv)
+	if idCfg.PassphraseFile != "" && *newFileFlag != idCfg.PassphraseFile {
+		fmt.Fprintf(stdout, "  Update %s with the new passphrase before restarting the daemon.\n", idCfg.PassphraseFile)
+	}
+	return nil
+}
+
+// keyRotator announces a signed key rotation (implemented by *daemon.Client).
+type keyRotator interface {
+	KeyRotate(kr *p2pnet.KeyRotation) (*daemon.KeyRotateResponse, error)
+}
+
+// doKeyRotate generates a new identity key, has the running daemon announce
+// the signed "old -> new" statement to connected authorized peers, then
+// swaps the key file. The old key is kept as <key>.old; an encrypted key
+// stays encrypted under the same passphrase.
+func doKeyRotate(args []string, c keyRotator, stdout io.Writer) error {
+	fs, configFlag, fileFlag := keyFlagSet("key rotate")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+
+	idCfg, err := resolveKeyIdentity(*fileFlag, *configFlag)
+	if err != nil {
+		return err
+	}
+	data, err := readKeyFile(idCfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	var pass []byte
+	oldKey, err := identity.ParseKeyFile(data, func() ([]byte, error) {
+		p, err := keyPassphrase(idCfg)()
+		pass = p
+		return p, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", idCfg.KeyFile, err)
+	}
+
+	// Peers learn the new ID over the old identity's live connections.
+	if c == nil {
+		return fmt.Errorf("daemon is not running; start it with 'peerup daemon' so peers can be notified")
+	}
+
+	newKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		return fmt.Errorf("failed to generate keypair: %w", err)
+	}
+	var newData []byte
+	if identity.IsEncryptedKey(data) {
+		newData, err = identity.EncryptKey(newKey, pass)
+	} else {
+		newData, err = crypto.MarshalPrivateKey(newKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode new key: %w", err)
+	}
+
+	// Stage the new key before announcing, so it can't be lost once peers
+	// have switched to it.
+	stagedPath := idCfg.KeyFile + ".new"
+	if err := identity.WriteKeyFile(stagedPath, newData); err != nil {
+		return err
+	}
+
+	kr, err := p2pnet.NewKeyRotation(oldKey, newKey, time.Now())
+	if err != nil {
+		os.Remove(stagedPath)
+		return err
+	}
+	resp, err := c.KeyRotate(kr)
+	if err != nil {
+		os.Remove(stagedPath)
+		return fmt.Errorf("announce failed (key file unchanged): %w", err)
+	}
+
+	backupPath := idCfg.KeyFile + ".old"
+	if err := identity.WriteKeyFile(backupPath, data); err != nil {
+		return fmt.Errorf("failed to back up old key (new key left at %s): %w", stagedPath, err)
+	}
+	if err := os.Rename(stagedPath, idCfg.KeyFile); err != nil {
+		return fmt.Errorf("failed to install new key (new key left at %s): %w", stagedPath, err)
+	}
+
+	termcolor.Green("Rotated identity key: %s", idCfg.KeyFile)
+	fmt.Fprintf(stdout, "  Old peer ID: %s\n", kr.OldPeerID)
+	fmt.Fprintf(stdout, "  New peer ID: %s\n", kr.NewPeerID)
+	fmt.Fprintf(stdout, "  Old key saved to: %s\n", backupPath)
+	fmt.Fprintf(stdout, "  Notified %d peer(s)\n", len(resp.Notified))
+	for _, f := range resp.Failed {
+		fmt.Fprintf(stdout, "  Failed: %s: %s\n", f.PeerID, f.Error)
+	}
+	if n := len(resp.Failed) + len(resp.NotConnected); n > 0 {
+		termcolor.Yellow("%d authorized peer(s) were not updated; on each, run: peerup auth add %s", n, kr.NewPeerID)
+		for _, p := range resp.NotConnected {
+			fmt.Fprintf(stdout, "  Not connected: %s\n", p)
+		}
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, "Restart the daemon to use the new identity:")
+	fmt.Fprintln(stdout, "  peerup daemon stop && peerup daemon")
+	fmt.Fprintln(stdout, "Relays with connection gating must also authorize the new peer ID:")
+	fmt.Fprintf(stdout, "  peerup relay authorize %s\n", kr.NewPeerID)
+	return nil
+}
+
+// loadEncryptedKey reads a key file that must be encrypted and unlocks it.
+func loadEncryptedKey(idCfg config.IdentityConfig) (crypto.PrivKey, error) {
+	data, err := readKeyFile(idCfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if !identity.IsEncryptedKey(data) {
+		return nil, identity.ErrKeyNotEncrypted
+	}
+	priv, err := identity.ParseKeyFile(data, keyPassphrase(idCfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock %s: %w", idCfg.KeyFile, err)
+	}
+	return priv, nil
+}
+
+func writeEncryptedKey(path string, priv crypto.PrivKey, pass []byte) error {
+	enc, err := identity.EncryptKey(priv, pass)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt key: %w", err)
+	}
+	return identity.WriteKeyFile(path, enc)
+}
+
+func printKeyPeerID(w io.Writer, priv crypto.PrivKey) {
+	if pid, err := peer.IDFromPrivateKey(priv); err == nil {
+		fmt.Fprintf(w, "  Peer ID: %s\n", pid)
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/internal/identity"
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
+)
+
+// scriptPassphrases replaces the terminal prompt with canned answers.
+func scriptPassphrases(t *testing.T, answers ...string) {
+	t.Helper()
+	orig := promptPassphrase
+	t.Cleanup(func() { promptPassphrase = orig })
+	promptPassphrase = func(string) ([]byte, error) {
+		if len(answers) == 0 {
+			t.Fatal("unexpected passphrase prompt")
+		}
+		a := answers[0]
+		answers = answers[1:]
+		return []byte(a), nil
+	}
+}
+
+func newTestKeyFile(t *testing.T) string {
+	t.Helper()
+	keyPath := filepath.Join(t.TempDir(), "identity.key")
+	if _, err := identity.LoadOrCreateIdentity(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath
+}
+
+func TestDoKeyEncryptDecrypt(t *testing.T) {
+	keyPath := newTestKeyFile(t)
+	wantID, err := identity.PeerIDFromKeyFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scriptPassphrases(t, "pw1", "pw1")
+	var out bytes.Buffer
+	if err := doKeyEncrypt([]string{"--file", keyPath}, &out); err != nil {
+		t.Fatalf("doKeyEncrypt() error = %v", err)
+	}
+	if !strings.Contains(out.String(), wantID.String()) {
+		t.Errorf("output missing peer ID: %q", out.String())
+	}
+	data, _ := os.ReadFile(keyPath)
+	if !identity.IsEncryptedKey(data) {
+		t.Fatal("key file not encrypted")
+	}
+
+	if err := doKeyEncrypt([]string{"--file", keyPath}, &out); !errors.Is(err, identity.ErrKeyAlreadyEncrypted) {
+		t.Errorf("second encrypt: err = %v, want ErrKeyAlreadyEncrypted", err)
+	}
+
+	scriptPassphrases(t, "pw1")
+	if err := doKeyDecrypt([]string{"--file", keyPath}, &out); err != nil {
+		t.Fatalf("doKeyDecrypt() error = %v", err)
+	}
+	gotID, err := identity.PeerIDFromKeyFileWith(keyPath, nil)
+	if err != nil {
+		t.Fatalf("plaintext key after decrypt: %v", err)
+	}
+	if gotID != wantID {
+		t.Errorf("peer ID changed: %s != %s", gotID, wantID)
+	}
+
+	if err := doKeyDecrypt([]string{"--file", keyPath}, &out); !errors.Is(err, identity.ErrKeyNotEncrypted) {
+		t.Errorf("second decrypt: err = %v, want ErrKeyNotEncrypted", err)
+	}
+}
+
+func TestDoKeyEncrypt_Mismatch(t *testing.T) {
+	keyPath := newTestKeyFile(t)
+	scriptPassphrases(t, "one", "two")
+	var out bytes.Buffer
+	err := doKeyEncrypt([]string{"--file", keyPath}, &out)
+	if err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Fatalf("err = %v, want mismatch", err)
+	}
+	data, _ := os.ReadFile(keyPath)
+	if identity.IsEncryptedKey(data) {
+		t.Error("key file changed after failed encrypt")
+	}
+}
+
+func TestDoKeyChangePassphrase(t *testing.T) {
+	keyPath := newTestKeyFile(t)
+	t.Setenv(identity.PassphraseEnv, "old")
+	var out bytes.Buffer
+	if err := doKeyEncrypt([]string{"--file", keyPath}, &out); err != nil {
+		t.Fatalf("doKeyEncrypt() error = %v", err)
+	}
+
+	newFile := filepath.Join(t.TempDir(), "new-pass")
+	if err := os.WriteFile(newFile, []byte("new\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := doKeyChangePassphrase([]string{"--file", keyPath, "--new-passphrase-file", newFile}, &out); err != nil {
+		t.Fatalf("doKeyChangePassphrase() error = %v", err)
+	}
+
+	if _, err := identity.PeerIDFromKeyFile(keyPath); !errors.Is(err, identity.ErrWrongPassphrase) {
+		t.Errorf("old passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+	t.Setenv(identity.PassphraseEnv, "new")
+	if _, err := identity.PeerIDFromKeyFile(keyPath); err != nil {
+		t.Errorf("new passphrase: %v", err)
+	}
+}
+
+func TestKeyPassphrase_FileFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	passFile := filepath.Join(dir, "pass")
+	if err := os.WriteFile(passFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(identity.PassphraseEnv, "")
+	os.Unsetenv(identity.PassphraseEnv)
+	scriptPassphrases(t) // any prompt fails the test
+
+	got, err := keyPassphrase(config.IdentityConfig{PassphraseFile: passFile})()
+	if err != nil {
+		t.Fatalf("keyPassphrase() error = %v", err)
+	}
+	if string(got) != "from-file" {
+		t.Errorf("passphrase = %q, want from-file", got)
+	}
+
+	t.Setenv(identity.PassphraseEnv, "from-env")
+	got, _ = keyPassphrase(config.IdentityConfig{PassphraseFile: passFile})()
+	if string(got) != "from-env" {
+		t.Errorf("passphrase = %q, want env to take precedence", got)
+	}
+}
+
+// fakeKeyRotator records the statement it was asked to announce.
+type fakeKeyRotator struct {
+	got *p2pnet.KeyRotation
+	err error
+}
+
+func (f *fakeKeyRotator) KeyRotate(kr *p2pnet.KeyRotation) (*daemon.KeyRotateResponse, error) {
+	f.got = kr
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &daemon.KeyRotateResponse{
+		OldPeerID:    kr.OldPeerID,
+		NewPeerID:    kr.NewPeerID,
+		Notified:     []string{"peer-a"},
+		NotConnected: []string{"peer-b"},
+	}, nil
+}
+
+func TestDoKeyRotate(t *testing.T) {
+	keyPath := newTestKeyFile(t)
+	oldData, _ := os.ReadFile(keyPath)
+	oldID, _ := identity.PeerIDFromKeyFile(keyPath)
+
+	c := &fakeKeyRotator{}
+	var out bytes.Buffer
+	if err := doKeyRotate([]string{"--file", keyPath}, c, &out); err != nil {
+		t.Fatalf("doKeyRotate() error = %v", err)
+	}
+	if c.got == nil {
+		t.Fatal("rotation was not announced")
+	}
+	if _, _, err := c.got.Verify(time.Now()); err != nil {
+		t.Errorf("announced statement does not verify: %v", err)
+	}
+	if c.got.OldPeerID != oldID.String() {
+		t.Errorf("OldPeerID = %s, want %s", c.got.OldPeerID, oldID)
+	}
+
+	newID, err := identity.PeerIDFromKeyFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newID.String() != c.got.NewPeerID {
+		t.Errorf("key file holds %s, want %s", newID, c.got.NewPeerID)
+	}
+	backup, _ := os.ReadFile(keyPath + ".old")
+	if !bytes.Equal(backup, oldData) {
+		t.Error("old key was not backed up")
+	}
+	if _, err := os.Stat(keyPath + ".new"); !os.IsNotExist(err) {
+		t.Error("staged key left behind")
+	}
+	if !strings.Contains(out.String(), "peer-b") {
+		t.Errorf("output missing unreached peer: %q", out.String())
+	}
+}
+
+func TestDoKeyRotate_Encrypted(t *testing.T) {
+	keyPath := newTestKeyFile(t)
+	scriptPassphrases(t, "pw", "pw")
+	if err := doKeyEncrypt([]string{"--file", keyPath}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(identity.PassphraseEnv, "pw")
+	c := &fakeKeyRotator{}
+	if err := doKeyRotate([]string{"--file", keyPath}, c, io.Discard); err != nil {
+		t.Fatalf("doKeyRotate() error = %v", err)
+	}
+	data, _ := os.ReadFile(keyPath)
+	if !identity.IsEncryptedKey(data) {
+		t.Fatal("rotated key is not encrypted")
+	}
+	priv, err := identity.DecryptKey(data, []byte("pw"))
+	if err != nil {
+		t.Fatalf("decrypt rotated key: %v", err)
+	}
+	id, _ := peer.IDFromPrivateKey(priv)
+	if id.String() != c.got.NewPeerID {
+		t.Errorf("key file holds %s, want %s", id, c.got.NewPeerID)
+	}
+}
+
+func TestDoKeyRotate_AnnounceFails(t *testing.T) {
+	keyPath := newTestKeyFile(t)
+	oldData, _ := os.ReadFile(keyPath)
+
+	c := &fakeKeyRotator{err: errors.New("boom")}
+	if err := doKeyRotate([]string{"--file", keyPath}, c, io.Discard); err == nil {
+		t.Fatal("expected error")
+	}
+	data, _ := os.ReadFile(keyPath)
+	if !bytes.Equal(data, oldData) {
+		t.Error("key file changed after failed announce")
+	}
+	if _, err := os.Stat(keyPath + ".new"); !os.IsNotExist(err) {
+		t.Error("staged key left behind")
+	}
+
+	if err := doKeyRotate([]string{"--file", keyPath}, nil, io.Discard); err == nil {
+		t.Error("expected error without a daemon")
+	}
+}
+
+func TestReplaceConfigPeerID(t *testing.T) {
+	dir := t.TempDir()
+	cfgFile := filepath.Join(dir, "config.yaml")
+	content := "names:\n  laptop: 12D3KooWOld  # rotated\nservices:\n  ssh:\n    allowed_peers: [12D3KooWOld]\n"
+	os.WriteFile(cfgFile, []byte(content), 0600)
+
+	if err := replaceConfigPeerID(cfgFile, "12D3KooWOld", "12D3KooWNew"); err != nil {
+		t.Fatalf("replaceConfigPeerID: %v", err)
+	}
+	data, _ := os.ReadFile(cfgFile)
+	if want := strings.ReplaceAll(content, "12D3KooWOld", "12D3KooWNew"); string(data) != want {
+		t.Errorf("config =\n%s\nwant\n%s", data, want)
+	}
+	if info, err := os.Stat(cfgFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("config mode = %v, err = %v", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+}
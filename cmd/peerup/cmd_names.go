@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/internal/termcolor"
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
+)
+
+// namesClient is the daemon API surface used by the names commands.
+type namesClient interface {
+	Names() (*daemon.NamesResponse, error)
+	NamesSync(peer string) (*daemon.NamesSyncResponse, error)
+}
+
+func runNames(args []string) {
+	if len(args) < 1 {
+		printNamesUsage()
+		osExit(1)
+	}
+
+	var c namesClient
+	if dc := tryDaemonClient(); dc != nil {
+		c = dc
+	}
+
+	var err error
+	switch args[0] {
+	case "list":
+		err = doNamesList(args[1:], c, os.Stdout)
+	case "sync":
+		err = doNamesSync(args[1:], c, os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown names command: %s\n\n", args[0])
+		printNamesUsage()
+		osExit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+func printNamesUsage() {
+	fmt.Println("Usage: peerup names <command> [options]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  list [--json]    Show the merged name directory and where each name came from")
+	fmt.Println("  sync [peer]      Publish local name changes and sync with authorized peers")
+	fmt.Println()
+	fmt.Println("Directory sync is opt-in: set directory.enabled in peerup.yaml.")
+}
+
+// doNamesList prints the merged name view. With a running daemon it shows
+// the live view; otherwise it reads directory.json (falling back to the
+// config's names) from the config directory.
+func doNamesList(args []string, c namesClient, stdout io.Writer) error {
+	fs := flag.NewFlagSet("names list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFlag := fs.String("config", "", "path to config file")
+	jsonFlag := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(reorderArgs(args, map[string]bool{"json": true})); err != nil {
+		return err
+	}
+
+	var resp *daemon.NamesResponse
+	var err error
+	if c != nil {
+		resp, err = c.Names()
+	} else {
+		resp, err = loadNamesOffline(*configFlag)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	if len(resp.Names) == 0 {
+		fmt.Fprintln(stdout, "No names.")
+	} else {
+		fmt.Fprintf(stdout, "Names (%d):\n\n", len(resp.Names))
+		for _, e := range resp.Names {
+			fmt.Fprintf(stdout, "  %-16s %s\n", e.Name, e.PeerID)
+			detail := "origin " + shortPeerID(e.Origin)
+			if e.Updated != "" {
+				detail += " at " + e.Updated
+			}
+			termcolor.Faint("  %-16s %s\n", "", detail)
+		}
+	}
+	if len(resp.Services) > 0 {
+		fmt.Fprintf(stdout, "\nAdvertised services (%d):\n\n", len(resp.Services))
+		for _, s := range resp.Services {
+			name := s.Name
+			if s.Protocol != "" {
+				name += " (" + s.Protocol + ")"
+			}
+			fmt.Fprintf(stdout, "  %-16s %s\n", name, shortPeerID(s.Origin))
+		}
+	}
+	if !resp.Directory {
+		termcolor.Faint("\nDirectory sync is off; showing names from this node's config.\n")
+	}
+	return nil
+}
+
+// loadNamesOffline builds the names view without a daemon.
+func loadNamesOffline(configFlag string) (*daemon.NamesResponse, error) {
+	cfgFile, err := config.FindConfigFile(configFlag)
+	if err != nil {
+		return nil, fmt.Errorf("config error: %w", err)
+	}
+	cfg, err := config.LoadNodeConfig(cfgFile)
+	if err != nil {
+		return nil, fmt.Errorf("config error: %w", err)
+	}
+
+	resp := &daemon.NamesResponse{Names: []daemon.NameEntry{}, Services: []daemon.AdvertisedService{}}
+	if cfg.Directory.Enabled {
+		dir, err := p2pnet.OpenDirectory(filepath.Join(filepath.Dir(cfgFile), p2pnet.DirectoryFileName))
+		if err != nil {
+			return nil, err
+		}
+		if len(dir.Records()) > 0 {
+			resp.Directory = true
+			for _, e := range dir.Names() {
+				resp.Names = append(resp.Names, daemon.NameEntry{
+					Name:    e.Name,
+					PeerID:  e.PeerID.String(),
+					Origin:  e.Origin.String(),
+					Clock:   e.Clock,
+					Updated: e.Updated.UTC().Format(time.RFC3339),
+				})
+			}
+			for _, s := range dir.Services() {
+				resp.Services = append(resp.Services, daemon.AdvertisedService{
+					Origin:   s.Origin.String(),
+					Name:     s.Name,
+					Protocol: s.Protocol,
+				})
+			}
+			return resp, nil
+		}
+	}
+
+	for name, pid := range cfg.Names {
+		resp.Names = append(resp.Names, daemon.NameEntry{Name: name, PeerID: pid, Origin: "local config"})
+	}
+	sort.Slice(resp.Names, func(i, j int) bool { return resp.Names[i].Name < resp.Names[j].Name })
+	return resp, nil
+}
+
+// doNamesSync asks the daemon to publish this node's names and services
+// and run a directory exchange with one peer or every connected
+// authorized peer.
+func doNamesSync(args []string, c namesClient, stdout io.Writer) error {
+	fs := flag.NewFlagSet("names sync", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: peerup names sync [peer]")
+	}
+	if c == nil {
+		return fmt.Errorf("daemon is not running; start it with 'peerup daemon' to sync names")
+	}
+
+	resp, err := c.NamesSync(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("sync failed: %w", err)
+	}
+
+	if resp.Published {
+		termcolor.Green("Published local name changes")
+	}
+	if len(resp.Results) == 0 {
+		termcolor.Yellow("No connected authorized peers to sync with.")
+		return nil
+	}
+	synced := 0
+	for _, r := range resp.Results {
+		if r.Error != "" {
+			fmt.Fprintf(stdout, "  %s  failed: %s\n", shortPeerID(r.PeerID), r.Error)
+			continue
+		}
+		synced++
+		fmt.Fprintf(stdout, "  %s  %d record(s) updated\n", shortPeerID(r.PeerID), r.Updated)
+	}
+	termcolor.Green("Synced with %d of %d peer(s)", synced, len(resp.Results))
+	return nil
+}
+
+// shortPeerID abbreviates a peer ID for display.
+func shortPeerID(s string) string {
+	if len(s) <= 16 {
+		return s
+	}
+	return s[:16] + "..."
+}
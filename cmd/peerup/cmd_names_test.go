@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
+)
+
+// fakeNamesClient returns canned directory responses.
+type fakeNamesClient struct {
+	names    *daemon.NamesResponse
+	sync     *daemon.NamesSyncResponse
+	syncPeer string
+}
+
+func (f *fakeNamesClient) Names() (*daemon.NamesResponse, error) { return f.names, nil }
+
+func (f *fakeNamesClient) NamesSync(peer string) (*daemon.NamesSyncResponse, error) {
+	f.syncPeer = peer
+	return f.sync, nil
+}
+
+func TestDoNamesList_ViaDaemon(t *testing.T) {
+	laptop, origin := generateTestPeerID(t), generateTestPeerID(t)
+	c := &fakeNamesClient{names: &daemon.NamesResponse{
+		Directory: true,
+		Names:     []daemon.NameEntry{{Name: "laptop", PeerID: laptop, Origin: origin, Clock: 2}},
+		Services:  []daemon.AdvertisedService{{Origin: origin, Name: "ssh"}},
+	}}
+
+	var out bytes.Buffer
+	if err := doNamesList(nil, c, &out); err != nil {
+		t.Fatalf("doNamesList() error = %v", err)
+	}
+	if !strings.Contains(out.String(), laptop) || !strings.Contains(out.String(), "ssh") {
+		t.Errorf("output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := doNamesList([]string{"--json"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	var resp daemon.NamesResponse
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil || len(resp.Names) != 1 || resp.Names[0].Origin != origin {
+		t.Errorf("JSON output = %q (err %v)", out.String(), err)
+	}
+}
+
+func TestDoNamesList_Offline(t *testing.T) {
+	home := generateTestPeerID(t)
+
+	t.Run("config names when directory sync is off", func(t *testing.T) {
+		cfgPath := writeTestConfigWithNames(t, map[string]string{"home": home})
+		var out bytes.Buffer
+		if err := doNamesList([]string{"--config", cfgPath, "--json"}, nil, &out); err != nil {
+			t.Fatalf("doNamesList() error = %v", err)
+		}
+		var resp daemon.NamesResponse
+		json.Unmarshal(out.Bytes(), &resp)
+		if resp.Directory || len(resp.Names) != 1 || resp.Names[0].PeerID != home || resp.Names[0].Origin != "local config" {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+
+	t.Run("merged view from directory.json", func(t *testing.T) {
+		cfgPath := writeTestConfigWithNames(t, map[string]string{"home": home})
+		f, err := os.OpenFile(cfgPath, os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("directory:\n  enabled: true\n")
+		f.Close()
+
+		remoteKey, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+		dir, err := p2pnet.OpenDirectory(filepath.Join(filepath.Dir(cfgPath), p2pnet.DirectoryFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nas := generateTestPeerID(t)
+		rec, _, err := dir.Publish(remoteKey, map[string]string{"nas": nas}, nil, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := doNamesList([]string{"--config", cfgPath, "--json"}, nil, &out); err != nil {
+			t.Fatalf("doNamesList() error = %v", err)
+		}
+		var resp daemon.NamesResponse
+		json.Unmarshal(out.Bytes(), &resp)
+		if !resp.Directory || len(resp.Names) != 1 || resp.Names[0].Name != "nas" || resp.Names[0].Origin != rec.Origin {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+}
+
+func TestDoNamesSync(t *testing.T) {
+	if err := doNamesSync(nil, nil, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "daemon is not running") {
+		t.Errorf("nil client: err = %v", err)
+	}
+
+	c := &fakeNamesClient{sync: &daemon.NamesSyncResponse{
+		Published: true,
+		Results: []daemon.NamesSyncResult{
+			{PeerID: generateTestPeerID(t), Updated: 3},
+			{PeerID: generateTestPeerID(t), Error: "stream reset"},
+		},
+	}}
+	var out bytes.Buffer
+	if err := doNamesSync([]string{"laptop"}, c, &out); err != nil {
+		t.Fatalf("doNamesSync() error = %v", err)
+	}
+	if c.syncPeer != "laptop" {
+		t.Errorf("synced peer = %q, want laptop", c.syncPeer)
+	}
+	if !strings.Contains(out.String(), "3 record(s) updated") || !strings.Contains(out.String(), "stream reset") {
+		t.Errorf("output = %q", out.String())
+	}
+
+	if err := doNamesSync([]string{"a", "b"}, c, &out); err == nil {
+		t.Error("expected usage error for two peers")
+	}
+}
+
+func TestApplyDirectoryNames_ConfigWins(t *testing.T) {
+	net, err := p2pnet.New(&p2pnet.Config{KeyFile: filepath.Join(t.TempDir(), "test.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer net.Close()
+
+	home, evil, nas := generateTestPeerID(t), generateTestPeerID(t), generateTestPeerID(t)
+	local := map[string]string{"home": home}
+	net.LoadNames(local)
+	dir, err := p2pnet.OpenDirectory(filepath.Join(t.TempDir(), p2pnet.DirectoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := &serveRuntime{
+		network:   net,
+		directory: &p2pnet.DirectorySync{Directory: dir},
+		dirNames:  make(map[string]peer.ID),
+		dirLocal:  local,
+	}
+
+	// An authorized origin tries to rebind a configured name.
+	remoteKey, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if _, _, err := dir.Publish(remoteKey, map[string]string{"home": evil, "nas": nas}, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	rt.applyDirectoryNames()
+	if got, _ := net.ResolveName("home"); got.String() != home {
+		t.Errorf("home resolves to %s, want the configured %s", got, home)
+	}
+	if got, _ := net.ResolveName("nas"); got.String() != nas {
+		t.Errorf("nas resolves to %s, want %s from the directory", got, nas)
+	}
+
+	// Its tombstones drop the names it contributed, not configured ones.
+	if _, _, err := dir.Publish(remoteKey, nil, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	rt.applyDirectoryNames()
+	if got, err := net.ResolveName("home"); err != nil || got.String() != home {
+		t.Errorf("home after remote removal = %s, %v", got, err)
+	}
+	if _, err := net.ResolveName("nas"); err == nil {
+		t.Error("nas still resolves after its origin removed it")
+	}
+}
@@ -86,6 +86,7 @@ func runPing(args []string) {
 	// Create P2P network
 	p2pNetwork, err := p2pnet.New(&p2pnet.Config{
 		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
 		Config:             &config.Config{Network: cfg.Network},
 		UserAgent:          "peerup/" + version,
 		EnableRelay:        true,
@@ -21,15 +21,23 @@ import (
 func runProxy(args []string) {
 	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
 	configFlag := fs.String("config", "", "path to config file")
+	udpFlag := fs.Bool("udp", false, "forward UDP datagrams instead of TCP")
+	warmupFlag := fs.Bool("warmup", false, "keep the connection to the target alive (also proxy.warmup in config)")
+	socketModeFlag := fs.String("socket-mode", "", "permissions for a unix: socket (e.g. 0660)")
+	socketGroupFlag := fs.String("socket-group", "", "group to own a unix: socket")
 	fs.Parse(args)
 
 	remaining := fs.Args()
 	if len(remaining) < 3 {
-		fmt.Println("Usage: peerup proxy [--config <path>] <target> <service> <local-port>")
+		fmt.Println("Usage: peerup proxy [--config <path>] [--udp] [--warmup] <target> <service> <local-port|unix:path>")
+		fmt.Println("                    [--socket-mode 0660] [--socket-group <group>]")
 		fmt.Println()
 		fmt.Println("Examples:")
 		fmt.Println("  peerup proxy home ssh 2222")
 		fmt.Println("  peerup proxy home xrdp 13389")
+		fmt.Println("  peerup proxy --udp home wireguard 51820")
+		fmt.Println("  peerup proxy --warmup home ssh 2222")
+		fmt.Println("  peerup proxy --socket-mode 0600 home docker unix:/tmp/home-docker.sock")
 		fmt.Println("  peerup proxy --config /path/to/config.yaml home ssh 2222")
 		osExit(1)
 	}
@@ -38,6 +46,21 @@ func runProxy(args []string) {
 	serviceName := remaining[1]
 	localPort := remaining[2]
 
+	// A unix: socket instead of a port: stream-only, with optional permissions
+	localAddr := fmt.Sprintf("localhost:%s", localPort)
+	var sockOpts *p2pnet.SocketOptions
+	if p2pnet.IsUnixAddr(localPort) {
+		if *udpFlag {
+			fatal("Unix sockets cannot carry UDP")
+		}
+		localAddr = absLocalAddr(localPort)
+		mode, err := p2pnet.ParseSocketMode(*socketModeFlag)
+		if err != nil {
+			fatal("%v", err)
+		}
+		sockOpts = &p2pnet.SocketOptions{Mode: mode, Group: *socketGroupFlag}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -52,7 +75,12 @@ func runProxy(args []string) {
 	}
 	config.ResolveConfigPaths(cfg, filepath.Dir(cfgFile))
 
-	fmt.Printf("=== TCP Proxy via P2P ===\n")
+	proto := "TCP"
+	if *udpFlag {
+		proto = "UDP"
+	}
+
+	fmt.Printf("=== %s Proxy via P2P ===\n", proto)
 	fmt.Printf("Config: %s\n", cfgFile)
 	fmt.Printf("Service: %s\n", serviceName)
 	fmt.Println()
@@ -60,6 +88,7 @@ func runProxy(args []string) {
 	// Create P2P network
 	p2pNetwork, err := p2pnet.New(&p2pnet.Config{
 		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
 		Config:             &config.Config{Network: cfg.Network},
 		UserAgent:          "peerup/" + version,
 		EnableRelay:        true,
@@ -116,6 +145,9 @@ func runProxy(args []string) {
 	// Connect to target using parallel path racing (DHT + relay simultaneously)
 	fmt.Println("Connecting to target peer...")
 	pd := p2pnet.NewPathDialer(h, kdht, cfg.Relay.Addresses, nil)
+	relayHealth := p2pnet.NewRelayHealth(h, cfg.Relay.Addresses, nil)
+	pd.SetRelayHealth(relayHealth, 0)
+	go relayHealth.Start(ctx, 0) // ranks relays for keepalive redials
 	connectCtx, connectCancel := context.WithTimeout(ctx, 45*time.Second)
 	result, err := pd.DialPeer(connectCtx, homePeerID)
 	connectCancel()
@@ -123,23 +155,48 @@ func runProxy(args []string) {
 		fatal("Failed to connect to target: %v", err)
 	}
 	fmt.Printf("Connected [%s] via %s (%s)\n", result.PathType, result.Address, result.Duration.Round(time.Millisecond))
+
+	// Keep the path warm: periodic pings hold relay circuits and NAT
+	// mappings open, and a dropped connection is redialed in the background
+	// instead of on the next client connection.
+	if *warmupFlag || cfg.Proxy.Warmup {
+		interval, _ := time.ParseDuration(cfg.Proxy.KeepaliveInterval) // validated by config loader
+		keepalive := p2pnet.NewPeerKeepalive(h, p2pnet.PathDialerFunc(pd), homePeerID, cfg.Protocols.PingPong.ID, interval)
+		keepalive.Start(ctx)
+		defer keepalive.Stop()
+		fmt.Printf("Keepalive: every %s\n", interval)
+	}
 	fmt.Println()
 
-	// Create TCP listener with retry-enabled dial function.
-	// Each incoming TCP connection triggers a P2P stream dial with
-	// exponential backoff (3 retries: 1s, 2s, 4s) to handle transient
-	// relay disconnections without failing the user's connection.
-	localAddr := fmt.Sprintf("localhost:%s", localPort)
-	dialFunc := p2pnet.DialWithRetry(func() (p2pnet.ServiceConn, error) {
-		return p2pNetwork.ConnectToService(homePeerID, serviceName)
-	}, 3)
-	listener, err := p2pnet.NewTCPListener(localAddr, dialFunc)
+	// Create listener with retry-enabled dial function.
+	// Each incoming TCP connection (or new UDP source address) triggers a
+	// P2P stream dial with exponential backoff (3 retries: 1s, 2s, 4s) to
+	// handle transient relay disconnections without failing the user's connection.
+	var listener interface {
+		Serve() error
+		Close() error
+	}
+	if *udpFlag {
+		dialFunc := p2pnet.DialWithRetry(func() (p2pnet.ServiceConn, error) {
+			return p2pNetwork.ConnectToUDPService(homePeerID, serviceName)
+		}, 3)
+		listener, err = p2pnet.NewUDPListener(localAddr, dialFunc)
+	} else {
+		// Keep a few negotiated streams ready so each new TCP connection
+		// skips stream setup (several round trips over a relay).
+		if cfg.Proxy.StreamPool.Enabled {
+			pool := p2pNetwork.EnableStreamPool(streamPoolConfig(cfg.Proxy.StreamPool), nil)
+			pool.Warm(homePeerID, serviceName)
+		}
+		dialFunc := p2pnet.DialWithRetry(p2pNetwork.ServiceDialFunc(homePeerID, serviceName), 3)
+		listener, err = p2pnet.NewTCPListenerWithOptions(localAddr, sockOpts, dialFunc)
+	}
 	if err != nil {
 		fatal("Failed to create listener: %v", err)
 	}
 	defer listener.Close()
 
-	fmt.Printf("TCP proxy listening on %s\n", localAddr)
+	fmt.Printf("%s proxy listening on %s\n", proto, localAddr)
 	fmt.Println()
 	fmt.Println("Connect to the service:")
 	fmt.Printf("   %s -> %s service on target\n", localAddr, serviceName)
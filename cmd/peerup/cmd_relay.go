@@ -11,6 +11,7 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/satindergrewal/peer-up/internal/config"
 	"github.com/satindergrewal/peer-up/internal/termcolor"
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
 )
 
 func runRelay(args []string) {
@@ -57,6 +58,18 @@ func runRelay(args []string) {
 		runRelayInfo(serverConfigFile)
 	case "pair":
 		runRelayPair(args[1:], serverConfigFile)
+	case "reservations":
+		runRelayAdminCommand(doRelayReservations, args[1:], serverConfigFile)
+	case "circuits":
+		runRelayAdminCommand(doRelayCircuits, args[1:], serverConfigFile)
+	case "kick":
+		runRelayAdminCommand(doRelayKick, args[1:], serverConfigFile)
+	case "ban":
+		runRelayAdminCommand(doRelayBan, args[1:], serverConfigFile)
+	case "unban":
+		runRelayAdminCommand(doRelayUnban, args[1:], serverConfigFile)
+	case "bans":
+		runRelayAdminCommand(doRelayBans, args[1:], serverConfigFile)
 	case "config":
 		runRelayServerConfig(args[1:], serverConfigFile)
 	case "version":
@@ -279,14 +292,49 @@ func doRelayList(args []string, stdout io.Writer) error {
 		return nil
 	}
 
+	// Live health is only known to a running daemon, which probes each relay.
+	health := make(map[string]p2pnet.RelayHealthStatus)
+	if client := tryDaemonClient(); client != nil {
+		if status, err := client.Status(); err == nil {
+			for _, rs := range status.Relays {
+				health[rs.Address] = rs
+			}
+		}
+	}
+
 	fmt.Fprintf(stdout, "Relay addresses (%d):\n\n", len(cfg.Relay.Addresses))
 	for i, addr := range cfg.Relay.Addresses {
 		fmt.Fprintf(stdout, "  %d. %s\n", i+1, addr)
+		if rs, ok := health[addr]; ok {
+			fmt.Fprintf(stdout, "     %s\n", formatRelayHealth(rs))
+		}
 	}
 	fmt.Fprintf(stdout, "\nConfig: %s\n", cfgFile)
 	return nil
 }
 
+// formatRelayHealth renders one relay's health for relay list output.
+func formatRelayHealth(rs p2pnet.RelayHealthStatus) string {
+	state := "usable"
+	if !rs.Healthy {
+		state = "UNHEALTHY"
+	} else if rs.LastProbe.IsZero() {
+		state = "not probed yet"
+	}
+	line := fmt.Sprintf("%s, score %.2f", state, rs.Score)
+	if rs.RTTMs > 0 {
+		line += fmt.Sprintf(", rtt %.1fms", rs.RTTMs)
+	}
+	if rs.Reserved {
+		line += ", reserved"
+	}
+	line += fmt.Sprintf(", %d ok / %d failed", rs.Successes, rs.Failures)
+	if rs.LastError != "" {
+		line += fmt.Sprintf(" (last error: %s)", rs.LastError)
+	}
+	return line
+}
+
 func runRelayRemove(args []string) {
 	if err := doRelayRemove(args, os.Stdout); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/relay"
+	"github.com/satindergrewal/peer-up/internal/termcolor"
+)
+
+// relayCircuitClient is the relay admin API surface used by the circuit
+// and ban commands.
+type relayCircuitClient interface {
+	Reservations() ([]relay.ReservationInfo, error)
+	Circuits() ([]relay.CircuitInfo, error)
+	CloseCircuit(id string) error
+	Bans() ([]relay.BanInfo, error)
+	Ban(target string, d time.Duration, reason string) (*relay.BanInfo, error)
+	Unban(target string) error
+}
+
+// runRelayAdminCommand connects to the running relay and runs a circuit or
+// ban command against it.
+func runRelayAdminCommand(do func([]string, relayCircuitClient, io.Writer) error, args []string, serverConfigFile string) {
+	client := connectRelayAdmin(serverConfigFile)
+	if err := do(args, client, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+// newRelayAdminFlagSet returns a flag set that also accepts --config, which
+// runRelay has already consumed.
+func newRelayAdminFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String("config", "", "path to relay server config")
+	return fs
+}
+
+func doRelayReservations(args []string, c relayCircuitClient, stdout io.Writer) error {
+	fs := newRelayAdminFlagSet("relay reservations")
+	jsonFlag := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(reorderArgs(args, map[string]bool{"json": true})); err != nil {
+		return err
+	}
+
+	rsvps, err := c.Reservations()
+	if err != nil {
+		return err
+	}
+	if *jsonFlag {
+		return writeIndentedJSON(stdout, rsvps)
+	}
+
+	if len(rsvps) == 0 {
+		fmt.Fprintln(stdout, "No active reservations.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Active reservations (%d):\n\n", len(rsvps))
+	for _, r := range rsvps {
+		fmt.Fprintf(stdout, "  %-19s  %-28s  age %-8s  expires in %s\n",
+			shortPeerID(r.PeerID), remoteLabel(r.RemoteIP, r.ASN),
+			sinceLabel(r.Created), time.Until(r.Expires).Truncate(time.Second))
+	}
+	return nil
+}
+
+func doRelayCircuits(args []string, c relayCircuitClient, stdout io.Writer) error {
+	fs := newRelayAdminFlagSet("relay circuits")
+	jsonFlag := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(reorderArgs(args, map[string]bool{"json": true})); err != nil {
+		return err
+	}
+
+	circuits, err := c.Circuits()
+	if err != nil {
+		return err
+	}
+	if *jsonFlag {
+		return writeIndentedJSON(stdout, circuits)
+	}
+
+	if len(circuits) == 0 {
+		fmt.Fprintln(stdout, "No active circuits.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Active circuits (%d):\n\n", len(circuits))
+	for _, ci := range circuits {
+		fmt.Fprintf(stdout, "  %s  age %s\n", ci.ID, sinceLabel(ci.Started))
+		fmt.Fprintf(stdout, "    %-19s  %-28s  sent     %s\n",
+			shortPeerID(ci.Src), remoteLabel(ci.SrcIP, ci.SrcASN), dataUsage(ci.BytesToDst, ci.DataLimit))
+		fmt.Fprintf(stdout, "    -> %-16s  %-28s  received %s\n",
+			shortPeerID(ci.Dst), remoteLabel(ci.DstIP, ci.DstASN), dataUsage(ci.BytesToSrc, ci.DataLimit))
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, "Close one with: peerup relay kick <id>")
+	return nil
+}
+
+func doRelayKick(args []string, c relayCircuitClient, stdout io.Writer) error {
+	fs := newRelayAdminFlagSet("relay kick")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: peerup relay kick <circuit-id>")
+	}
+
+	if err := c.CloseCircuit(fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Closed circuit %s\n", fs.Arg(0))
+	return nil
+}
+
+func doRelayBan(args []string, c relayCircuitClient, stdout io.Writer) error {
+	fs := newRelayAdminFlagSet("relay ban")
+	forFlag := fs.Duration("for", time.Hour, "how long the ban lasts")
+	reasonFlag := fs.String("reason", "", "note shown in the ban list")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: peerup relay ban <peer-id|ip|cidr> [--for 1h] [--reason text]")
+	}
+	if *forFlag < time.Second {
+		return fmt.Errorf("--for must be at least 1s")
+	}
+
+	ban, err := c.Ban(fs.Arg(0), *forFlag, *reasonFlag)
+	if err != nil {
+		return err
+	}
+	termcolor.Green("Banned %s until %s", ban.Target, ban.Expires.Local().Format(time.DateTime))
+	fmt.Fprintln(stdout, "  Its reservations and circuits were closed. authorized_keys is unchanged.")
+	fmt.Fprintf(stdout, "  Lift early with: peerup relay unban %s\n", ban.Target)
+	return nil
+}
+
+func doRelayUnban(args []string, c relayCircuitClient, stdout io.Writer) error {
+	fs := newRelayAdminFlagSet("relay unban")
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: peerup relay unban <peer-id|ip|cidr>")
+	}
+
+	if err := c.Unban(fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Unbanned %s\n", fs.Arg(0))
+	return nil
+}
+
+func doRelayBans(args []string, c relayCircuitClient, stdout io.Writer) error {
+	fs := newRelayAdminFlagSet("relay bans")
+	jsonFlag := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(reorderArgs(args, map[string]bool{"json": true})); err != nil {
+		return err
+	}
+
+	bans, err := c.Bans()
+	if err != nil {
+		return err
+	}
+	if *jsonFlag {
+		return writeIndentedJSON(stdout, bans)
+	}
+
+	if len(bans) == 0 {
+		fmt.Fprintln(stdout, "No active bans.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Active bans (%d):\n\n", len(bans))
+	for _, b := range bans {
+		line := fmt.Sprintf("  %-52s  %s left", b.Target, time.Until(b.Expires).Truncate(time.Second))
+		if b.Reason != "" {
+			line += "  # " + b.Reason
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	return nil
+}
+
+func writeIndentedJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// remoteLabel renders a remote IP with its ASN when known.
+func remoteLabel(ip string, asn uint32) string {
+	if ip == "" {
+		return "-"
+	}
+	if asn != 0 {
+		return fmt.Sprintf("%s (AS%d)", ip, asn)
+	}
+	return ip
+}
+
+func sinceLabel(t time.Time) string {
+	return time.Since(t).Truncate(time.Second).String()
+}
+
+// dataUsage renders bytes relayed against the per-direction session limit.
+func dataUsage(n, limit int64) string {
+	if limit <= 0 {
+		return formatDataSize(n)
+	}
+	return fmt.Sprintf("%s / %s (%d%%)", formatDataSize(n), formatDataSize(limit), n*100/limit)
+}
+
+// formatDataSize renders a byte count in the units config.ParseDataSize
+// accepts.
+func formatDataSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// loadRelayUsage returns per-peer relay usage from the running relay, or
+// from the usage file when the relay is stopped. live reports which.
+func loadRelayUsage(cfg *config.RelayServerConfig, configFile string) (usage []relay.PeerUsage, live bool, err error) {
+	dir := filepath.Dir(configFile)
+	if client, err := relay.NewAdminClient(filepath.Join(dir, ".relay-admin.sock"), filepath.Join(dir, ".relay-admin.cookie")); err == nil {
+		if usage, err := client.Usage(); err == nil {
+			return usage, true, nil
+		}
+	}
+
+	tracker, err := relay.NewUsageTracker(filepath.Join(dir, relay.UsageFileName), 0, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if cfg.Security.AuthorizedKeysFile != "" {
+		limits, err := relay.LoadPeerLimits(cfg.Security.AuthorizedKeysFile)
+		if err != nil {
+			return nil, false, err
+		}
+		tracker.SetLimits(limits)
+	}
+	return tracker.Usage(), false, nil
+}
+
+// relayPeerNames maps peer IDs to their authorized_keys comments.
+func relayPeerNames(authKeysPath string) map[string]string {
+	names := make(map[string]string)
+	if authKeysPath == "" {
+		return names
+	}
+	peers, _ := auth.ListPeers(authKeysPath)
+	for _, p := range peers {
+		if p.Comment != "" {
+			names[p.PeerID.String()] = p.Comment
+		}
+	}
+	return names
+}
+
+// writeRelayUsage renders per-peer relay usage for relay info.
+func writeRelayUsage(w io.Writer, usage []relay.PeerUsage, names map[string]string, live bool) {
+	source := "saved"
+	if live {
+		source = "live"
+	}
+	if len(usage) == 0 {
+		fmt.Fprintf(w, "Relay usage (%s): none recorded\n", source)
+		return
+	}
+	fmt.Fprintf(w, "Relay usage (%s, today is UTC):\n", source)
+	for _, u := range usage {
+		label := shortPeerID(u.PeerID)
+		if name := names[u.PeerID]; name != "" {
+			label += " (" + name + ")"
+		}
+		line := fmt.Sprintf("  %-36s  today %s  total %-9s  %s circuit time  weight %d",
+			label, dataUsage(u.DayBytes, u.DailyQuota), formatDataSize(u.Bytes),
+			(time.Duration(u.CircuitSeconds) * time.Second).Truncate(time.Minute), u.Weight)
+		if u.ActiveCircuits > 0 {
+			line += fmt.Sprintf("  %d open", u.ActiveCircuits)
+		}
+		if u.DailyQuota > 0 && u.DayBytes >= u.DailyQuota {
+			line += "  QUOTA REACHED"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
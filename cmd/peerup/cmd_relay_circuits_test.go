@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satindergrewal/peer-up/internal/relay"
+)
+
+// fakeRelayCircuitClient records admin requests and returns canned results.
+type fakeRelayCircuitClient struct {
+	rsvps    []relay.ReservationInfo
+	circuits []relay.CircuitInfo
+	bans     []relay.BanInfo
+	kicked   []string
+	banned   []string
+	unbanned []string
+}
+
+func (f *fakeRelayCircuitClient) Reservations() ([]relay.ReservationInfo, error) { return f.rsvps, nil }
+func (f *fakeRelayCircuitClient) Circuits() ([]relay.CircuitInfo, error)         { return f.circuits, nil }
+func (f *fakeRelayCircuitClient) Bans() ([]relay.BanInfo, error)                 { return f.bans, nil }
+
+func (f *fakeRelayCircuitClient) CloseCircuit(id string) error {
+	f.kicked = append(f.kicked, id)
+	return nil
+}
+
+func (f *fakeRelayCircuitClient) Ban(target string, d time.Duration, reason string) (*relay.BanInfo, error) {
+	f.banned = append(f.banned, target, d.String(), reason)
+	return &relay.BanInfo{Target: target, Reason: reason, Expires: time.Now().Add(d)}, nil
+}
+
+func (f *fakeRelayCircuitClient) Unban(target string) error {
+	f.unbanned = append(f.unbanned, target)
+	return nil
+}
+
+func TestDoRelayCircuits(t *testing.T) {
+	src, dst := generateTestPeerID(t), generateTestPeerID(t)
+	c := &fakeRelayCircuitClient{circuits: []relay.CircuitInfo{{
+		ID: "c1", Src: src, SrcIP: "2001:db8::1", SrcASN: 64500, Dst: dst, DstIP: "203.0.113.9",
+		Started: time.Now().Add(-time.Minute), BytesToDst: 48 << 20, BytesToSrc: 512, DataLimit: 64 << 20,
+	}}}
+
+	var out bytes.Buffer
+	if err := doRelayCircuits(nil, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"c1", "2001:db8::1 (AS64500)", "203.0.113.9", "48.0MB / 64.0MB (75%)", "512B / 64.0MB (0%)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := doRelayCircuits([]string{"--json", "--config", "relay-server.yaml"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	var circuits []relay.CircuitInfo
+	if err := json.Unmarshal(out.Bytes(), &circuits); err != nil || len(circuits) != 1 {
+		t.Errorf("JSON output = %q (err %v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := doRelayCircuits(nil, &fakeRelayCircuitClient{}, &out); err != nil || !strings.Contains(out.String(), "No active circuits") {
+		t.Errorf("empty list = %q, %v", out.String(), err)
+	}
+}
+
+func TestDoRelayReservations(t *testing.T) {
+	c := &fakeRelayCircuitClient{rsvps: []relay.ReservationInfo{{
+		PeerID: generateTestPeerID(t), RemoteIP: "198.51.100.4",
+		Created: time.Now().Add(-time.Hour), Expires: time.Now().Add(time.Hour),
+	}}}
+	var out bytes.Buffer
+	if err := doRelayReservations(nil, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "198.51.100.4") || !strings.Contains(out.String(), "Active reservations (1)") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestDoRelayKick(t *testing.T) {
+	c := &fakeRelayCircuitClient{}
+	var out bytes.Buffer
+	if err := doRelayKick([]string{"c1"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.kicked) != 1 || c.kicked[0] != "c1" {
+		t.Errorf("kicked = %v", c.kicked)
+	}
+	if err := doRelayKick(nil, c, &out); err == nil {
+		t.Error("expected usage error without an ID")
+	}
+}
+
+func TestDoRelayBan(t *testing.T) {
+	c := &fakeRelayCircuitClient{}
+	var out bytes.Buffer
+	if err := doRelayBan([]string{"203.0.113.0/24", "--for", "6h", "--reason", "bandwidth"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.banned, " ") != "203.0.113.0/24 6h0m0s bandwidth" {
+		t.Errorf("request = %v", c.banned)
+	}
+	if !strings.Contains(out.String(), "peerup relay unban 203.0.113.0/24") {
+		t.Errorf("output = %q", out.String())
+	}
+
+	if err := doRelayBan(nil, c, &out); err == nil {
+		t.Error("expected usage error without a target")
+	}
+	if err := doRelayBan([]string{"203.0.113.7", "--for", "0s"}, c, &out); err == nil {
+		t.Error("expected error for a zero duration")
+	}
+
+	if err := doRelayUnban([]string{"203.0.113.0/24"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.unbanned) != 1 {
+		t.Errorf("unbanned = %v", c.unbanned)
+	}
+}
+
+func TestDoRelayBans(t *testing.T) {
+	c := &fakeRelayCircuitClient{bans: []relay.BanInfo{
+		{Target: "203.0.113.0/24", Reason: "bandwidth", Expires: time.Now().Add(time.Hour)},
+	}}
+	var out bytes.Buffer
+	if err := doRelayBans(nil, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "203.0.113.0/24") || !strings.Contains(out.String(), "# bandwidth") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestFormatDataSize(t *testing.T) {
+	tests := map[int64]string{0: "0B", 1023: "1023B", 1536: "1.5KB", 64 << 20: "64.0MB", 3 << 30: "3.0GB"}
+	for in, want := range tests {
+		if got := formatDataSize(in); got != want {
+			t.Errorf("formatDataSize(%d) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWriteRelayUsage(t *testing.T) {
+	kid, laptop := generateTestPeerID(t), generateTestPeerID(t)
+	usage := []relay.PeerUsage{
+		{PeerID: kid, Bytes: 12 << 30, CircuitSeconds: 5400, DayBytes: 5 << 30, DailyQuota: 5 << 30, Weight: 1, ActiveCircuits: 2},
+		{PeerID: laptop, Bytes: 3 << 20, DayBytes: 1 << 20, Weight: 2},
+	}
+
+	var out bytes.Buffer
+	writeRelayUsage(&out, usage, map[string]string{kid: "kid"}, true)
+	for _, want := range []string{"Relay usage (live", "(kid)", "5.0GB / 5.0GB (100%)", "total 12.0GB", "1h30m0s circuit time", "2 open", "QUOTA REACHED", "1.0MB", "weight 2"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	writeRelayUsage(&out, nil, nil, false)
+	if !strings.Contains(out.String(), "Relay usage (saved): none recorded") {
+		t.Errorf("empty usage = %q", out.String())
+	}
+}
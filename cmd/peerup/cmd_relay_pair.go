@@ -4,11 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/peer"
+
 	"github.com/satindergrewal/peer-up/internal/config"
 	"github.com/satindergrewal/peer-up/internal/identity"
+	"github.com/satindergrewal/peer-up/internal/invite"
 	"github.com/satindergrewal/peer-up/internal/relay"
 )
 
@@ -34,6 +38,7 @@ func runRelayPairCreate(args []string, serverConfigFile string) {
 	ttlFlag := fs.Duration("ttl", time.Hour, "how long codes are valid")
 	expiresFlag := fs.Duration("expires", 0, "authorization expiry for joined peers (0 = never)")
 	nsFlag := fs.String("namespace", "", "DHT namespace (default: from config)")
+	legacyFlag := fs.Bool("legacy-code", false, "issue v2 codes for peerup builds that cannot read v3 (one IPv4 TCP relay, no expiry)")
 	fs.Parse(args)
 
 	client := connectRelayAdmin(serverConfigFile)
@@ -41,7 +46,7 @@ func runRelayPairCreate(args []string, serverConfigFile string) {
 	ttlSec := int(ttlFlag.Seconds())
 	expiresSec := int(expiresFlag.Seconds())
 
-	resp, err := client.CreateGroup(*countFlag, ttlSec, expiresSec, *nsFlag)
+	resp, err := client.CreateGroup(*countFlag, ttlSec, expiresSec, *nsFlag, *legacyFlag)
 	if err != nil {
 		fatal("Failed to create pairing group: %v", err)
 	}
@@ -66,9 +71,36 @@ func runRelayPairCreate(args []string, serverConfigFile string) {
 		fmt.Printf("\nAuthorization expires after %s.\n", *expiresFlag)
 	}
 
+	if len(resp.Relays) > 0 {
+		fmt.Println("\nThe codes also work through these federated relays:")
+		for _, addr := range resp.Relays {
+			fmt.Printf("  %s\n", addr)
+		}
+		// Relays the code format cannot carry have to be passed by hand.
+		if missing := relaysNotInCode(resp.Codes[0], resp.Relays); len(missing) > 0 {
+			fmt.Printf("If this relay is unreachable, join with: peerup join <code> --relay %s\n", missing[0])
+		}
+	}
+
 	fmt.Printf("\nGroup ID: %s\n", resp.GroupID)
 }
 
+// relaysNotInCode returns the relays in addrs that the pairing code does
+// not already carry.
+func relaysNotInCode(code string, addrs []string) []string {
+	data, err := invite.Decode(code)
+	if err != nil {
+		return addrs
+	}
+	var missing []string
+	for _, a := range addrs {
+		if !slices.Contains(data.RelayAddrs, a) {
+			missing = append(missing, a)
+		}
+	}
+	return missing
+}
+
 func runRelayPairList(serverConfigFile string) {
 	client := connectRelayAdmin(serverConfigFile)
 
@@ -116,39 +148,60 @@ func connectRelayAdmin(serverConfigFile string) *relay.AdminClient {
 	return client
 }
 
-// buildRelayAddrFromConfig constructs a relay multiaddr from the relay server config.
-func buildRelayAddrFromConfig(cfg *config.RelayServerConfig) (string, error) {
+// maxInviteRelayAddrs caps how many of the relay's own addresses go into
+// a pairing code, keeping codes short enough to type.
+const maxInviteRelayAddrs = 4
+
+// buildRelayAddrsFromConfig lists the relay multiaddrs to put in pairing
+// codes, with unspecified listen addresses replaced by detected public IPs.
+func buildRelayAddrsFromConfig(cfg *config.RelayServerConfig) ([]string, error) {
 	if len(cfg.Network.ListenAddresses) == 0 {
-		return "", fmt.Errorf("no listen addresses in relay config")
+		return nil, fmt.Errorf("no listen addresses in relay config")
 	}
 
 	// Load peer ID from key file.
-	pid, err := identity.PeerIDFromKeyFile(cfg.Identity.KeyFile)
+	pid, err := identity.PeerIDFromKeyFileWith(cfg.Identity.KeyFile, keyPassphrase(cfg.Identity))
 	if err != nil {
-		return "", fmt.Errorf("failed to load relay identity: %w", err)
+		return nil, fmt.Errorf("failed to load relay identity: %w", err)
 	}
 
-	// Find a suitable listen address (prefer TCP for invite code encoding).
-	var addr string
-	for _, a := range cfg.Network.ListenAddresses {
-		if strings.Contains(a, "/tcp/") && !strings.Contains(a, "/ws") {
-			addr = a
-			break
-		}
-	}
-	if addr == "" {
-		addr = cfg.Network.ListenAddresses[0]
+	addrs := inviteRelayAddrs(cfg.Network.ListenAddresses, detectPublicIPs(), pid)
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no public TCP or QUIC address to put in pairing codes; specify a public address in config")
 	}
+	return addrs, nil
+}
 
-	// Replace 0.0.0.0 with a detected public IP.
-	if strings.Contains(addr, "/0.0.0.0/") {
-		publicIPs := detectPublicIPs()
-		if len(publicIPs) > 0 {
-			addr = strings.Replace(addr, "/0.0.0.0/", "/"+publicIPs[0]+"/", 1)
+// inviteRelayAddrs picks the listen addresses that pairing codes can carry:
+// TCP (not WebSocket) over IPv4 or IPv6, or QUIC when the relay has no TCP
+// listener. Unspecified addresses expand to each public IP of the same family.
+func inviteRelayAddrs(listenAddrs, publicIPs []string, pid peer.ID) []string {
+	var tcp, quic []string
+	for _, a := range listenAddrs {
+		isTCP := strings.Contains(a, "/tcp/") && !strings.Contains(a, "/ws")
+		isQUIC := strings.HasSuffix(a, "/quic-v1")
+		if !isTCP && !isQUIC {
+			continue
+		}
+		var resolved []string
+		if strings.HasPrefix(a, "/ip4/0.0.0.0/") || strings.HasPrefix(a, "/ip6/::/") {
+			resolved = buildPublicMultiaddrs([]string{a}, publicIPs, pid)
+		} else {
+			resolved = []string{a + "/p2p/" + pid.String()}
+		}
+		if isTCP {
+			tcp = append(tcp, resolved...)
 		} else {
-			return "", fmt.Errorf("relay listens on 0.0.0.0 but no public IP detected; specify a public address in config")
+			quic = append(quic, resolved...)
 		}
 	}
 
-	return addr + "/p2p/" + pid.String(), nil
+	addrs := tcp
+	if len(addrs) == 0 {
+		addrs = quic
+	}
+	if len(addrs) > maxInviteRelayAddrs {
+		addrs = addrs[:maxInviteRelayAddrs]
+	}
+	return addrs
 }
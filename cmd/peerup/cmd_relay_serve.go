@@ -20,7 +20,6 @@ import (
 
 	"github.com/libp2p/go-libp2p"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
-	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
@@ -82,11 +81,18 @@ func runRelayServe(args []string) {
 	fmt.Printf("Authentication: %v\n", cfg.Security.EnableConnectionGating)
 	fmt.Println()
 
-	priv, err := identity.LoadOrCreateIdentity(cfg.Identity.KeyFile)
+	priv, err := identity.LoadOrCreateIdentityWith(cfg.Identity.KeyFile, keyPassphrase(cfg.Identity))
 	if err != nil {
 		fatal("Identity error: %v", err)
 	}
 
+	// Federated relays share pairing groups and authorized peers with this
+	// one. They are always let through the gater.
+	fedRelays, err := p2pnet.ParseRelayAddrs(cfg.Federation.Peers)
+	if err != nil {
+		fatal("federation.peers: %v", err)
+	}
+
 	// Load authorized keys if connection gating is enabled
 	var gater *auth.AuthorizedPeerGater
 	if cfg.Security.EnableConnectionGating {
@@ -94,7 +100,7 @@ func runRelayServe(args []string) {
 			fatal("Connection gating enabled but no authorized_keys_file specified")
 		}
 
-		authorizedPeers, err := auth.LoadAuthorizedKeys(cfg.Security.AuthorizedKeysFile)
+		authorizedPeers, err := loadRelayGaterPeers(cfg.Security.AuthorizedKeysFile, fedRelays)
 		if err != nil {
 			fatal("Failed to load authorized keys: %v", err)
 		}
@@ -107,6 +113,9 @@ func runRelayServe(args []string) {
 		}
 
 		gater = auth.NewAuthorizedPeerGater(authorizedPeers)
+		if len(fedRelays) > 0 {
+			fmt.Printf("Federated with %d relay(s)\n", len(fedRelays))
+		}
 	} else {
 		fmt.Println("WARNING: Connection gating is DISABLED - any peer can use this relay!")
 	}
@@ -150,15 +159,67 @@ func runRelayServe(args []string) {
 	}
 	defer h.Close()
 
-	// Start the relay service with configured resource limits
+	// Initialize relay observability (opt-in)
+	var relayMetrics *p2pnet.Metrics
+	if cfg.Telemetry.Metrics.Enabled {
+		relayMetrics = p2pnet.NewMetrics(version, runtime.Version())
+		slog.Info("telemetry: metrics enabled", "addr", cfg.Telemetry.Metrics.ListenAddress)
+	}
+	var relayAudit *p2pnet.AuditLogger
+	if cfg.Telemetry.Audit.Enabled {
+		relayAudit = p2pnet.NewAuditLogger(slog.NewJSONHandler(os.Stderr, nil))
+		slog.Info("telemetry: audit logging enabled")
+	}
+
+	// Per-peer relay usage is persisted next to the config. Daily quotas and
+	// bandwidth weights come from authorized_keys attributes.
+	var relayBandwidth int64
+	if cfg.Resources.Bandwidth != "" {
+		relayBandwidth, _ = config.ParseDataSize(cfg.Resources.Bandwidth) // validated at load
+	}
+	usagePath := filepath.Join(filepath.Dir(configFile), relay.UsageFileName)
+	usageTracker, err := relay.NewUsageTracker(usagePath, relayBandwidth, relayMetrics)
+	if err != nil {
+		fatal("Failed to load relay usage: %v", err)
+	}
+	reloadRelayLimits := func() {
+		if cfg.Security.AuthorizedKeysFile == "" {
+			return
+		}
+		limits, err := relay.LoadPeerLimits(cfg.Security.AuthorizedKeysFile)
+		if err != nil {
+			slog.Warn("relay usage: failed to load peer limits", "err", err)
+			return
+		}
+		usageTracker.SetLimits(limits)
+	}
+	reloadRelayLimits()
+	defer func() {
+		if err := usageTracker.Save(); err != nil {
+			slog.Warn("relay usage: save failed", "err", err)
+		}
+	}()
+
+	// Start the relay service with configured resource limits. The circuit
+	// monitor sees every reservation and circuit, enforces admin bans, and
+	// feeds the usage tracker.
 	relayResources, relayLimit := buildRelayResources(&cfg.Resources)
-	_, err = relayv2.New(h, relayv2.WithResources(relayResources), relayv2.WithLimit(relayLimit))
+	circuitMonitor := relay.NewCircuitMonitor(h, relayLimit.Data)
+	circuitMonitor.SetUsage(usageTracker)
+	_, err = relayv2.New(circuitMonitor.Host(),
+		relayv2.WithResources(relayResources),
+		relayv2.WithLimit(relayLimit),
+		relayv2.WithACL(circuitMonitor),
+	)
 	if err != nil {
 		fatal("Failed to start relay service: %v", err)
 	}
 	fmt.Printf("Relay limits: max_reservations=%d, max_circuits=%d, session=%s, data=%s/direction\n",
 		cfg.Resources.MaxReservations, cfg.Resources.MaxCircuits,
 		cfg.Resources.SessionDuration, cfg.Resources.SessionDataLimit)
+	if relayBandwidth > 0 {
+		fmt.Printf("Relay bandwidth: %s/s shared by relay_weight\n", cfg.Resources.Bandwidth)
+	}
 
 	// Bootstrap into the private peerup DHT as a server.
 	// The relay is the primary bootstrap peer - all peerup nodes connect here first
@@ -181,31 +242,172 @@ func runRelayServe(args []string) {
 		fmt.Printf("Private DHT active (protocol: %s/kad/1.0.0)\n", dhtPrefix)
 	}
 
-	// Initialize token store and pairing protocol handler.
-	tokenStore := relay.NewTokenStore()
+	// Initialize token store and pairing protocol handler. Pairing groups are
+	// persisted next to the config so outstanding codes survive a restart.
+	tokenStorePath := filepath.Join(filepath.Dir(configFile), relay.TokenStoreFileName)
+	tokenStore, err := relay.NewFileTokenStore(tokenStorePath)
+	if err != nil {
+		fatal("Pairing token store error: %v", err)
+	}
+	if active := tokenStore.ActiveGroupCount(); active > 0 {
+		slog.Info("restored pairing groups", "active", active, "path", tokenStorePath)
+		// Re-open enrollment so holders of outstanding codes can still connect.
+		if gater != nil {
+			gater.SetEnrollmentMode(true, 10, 15*time.Second)
+		}
+	}
+	// reloadGater picks up authorized_keys changes made by revocations and
+	// federation updates.
+	reloadGater := func() {
+		if gater == nil {
+			return
+		}
+		peers, err := loadRelayGaterPeers(cfg.Security.AuthorizedKeysFile, fedRelays)
+		if err != nil {
+			slog.Error("gater reload failed", "err", err)
+			return
+		}
+		gater.UpdateAuthorizedPeers(peers)
+	}
+
+	// Federation: replicate pairing groups, authorized peers and
+	// introductions with the relays in federation.peers, so codes from any
+	// of them can be redeemed here. Local changes go through the wrapped store.
+	var pairingStore relay.TokenStore = tokenStore
+	var federation *relay.Federation
+	if len(fedRelays) > 0 {
+		federation, err = relay.NewFederation(h, fedRelays, tokenStore, cfg.Security.AuthorizedKeysFile,
+			filepath.Join(filepath.Dir(configFile), relay.FederationStateFileName))
+		if err != nil {
+			fatal("Federation error: %v", err)
+		}
+		pairingStore = federation.Store()
+	}
+
 	pairingHandler := &relay.PairingHandler{
-		Store:        tokenStore,
+		Store:        pairingStore,
 		AuthKeysPath: cfg.Security.AuthorizedKeysFile,
 		Gater:        gater,
 	}
-	notifier := &relay.PeerNotifier{Host: h, AuthKeysPath: cfg.Security.AuthorizedKeysFile, Store: tokenStore}
+	notifier := &relay.PeerNotifier{Host: h, AuthKeysPath: cfg.Security.AuthorizedKeysFile, Store: pairingStore}
+
+	// Revocation post office: accept signed revocations from group members,
+	// drop the peer from authorized_keys and replay stored notices to
+	// members as they reconnect.
+	if cfg.Security.AuthorizedKeysFile != "" {
+		revStore, err := auth.OpenRevocationStore(auth.RevocationsPath(cfg.Security.AuthorizedKeysFile))
+		if err != nil {
+			fatal("Revocation store error: %v", err)
+		}
+		revGossip := &relay.RevocationGossip{
+			Host:         h,
+			AuthKeysPath: cfg.Security.AuthorizedKeysFile,
+			Store:        revStore,
+			OnApplied: func(from peer.ID, r *auth.Revocation, removed bool) {
+				slog.Info("revocation: applied",
+					"peer", r.PeerID[:16]+"...", "group", r.Group,
+					"issuer", r.Issuer[:16]+"...", "removed", removed)
+				if removed {
+					reloadGater()
+				}
+				if federation != nil {
+					go federation.ForwardRevocation(ctx, r, from)
+				}
+			},
+			OnRejected: func(from peer.ID, r *auth.Revocation, err error) {
+				slog.Warn("revocation: rejected", "from", from.String()[:16]+"...", "err", err)
+			},
+		}
+		notifier.Revocations = revGossip
+		h.SetStreamHandler(protocol.ID(relay.RevocationProtocol), revGossip.HandleStream)
+		slog.Info("revocation protocol registered", "protocol", relay.RevocationProtocol, "stored", len(revStore.List()))
+	}
 	h.SetStreamHandler(protocol.ID(relay.PairingProtocol), func(s network.Stream) {
 		joinedPeer, groupID := pairingHandler.HandleStream(s)
 		if joinedPeer != "" && groupID != "" {
 			go notifier.NotifyGroupMembers(ctx, groupID, joinedPeer)
+			if federation != nil {
+				go federation.PeerJoined(ctx, groupID, joinedPeer)
+			}
 		}
 	})
 	slog.Info("pairing protocol registered", "protocol", relay.PairingProtocol)
 
-	// Start admin socket for relay pair CLI.
+	// Relay mailbox (security.invite_mailbox): authorized peers leave sealed
+	// introductions for asynchronous invites; joiners redeem them later and
+	// the replies wait here until the inviter's daemon reconnects. Joiners
+	// are authorized only once the inviter accepts their reply.
+	var mailbox *relay.Mailbox
+	if cfg.Security.InviteMailbox {
+		mailboxPath := filepath.Join(filepath.Dir(configFile), relay.MailboxFileName)
+		mailbox, err = relay.NewMailbox(mailboxPath)
+		if err != nil {
+			fatal("Relay mailbox error: %v", err)
+		}
+		if open := mailbox.OpenCount(); open > 0 {
+			slog.Info("restored mailbox invites", "open", open, "path", mailboxPath)
+			if gater != nil {
+				gater.SetEnrollmentMode(true, 10, 15*time.Second)
+			}
+		}
+		notifier.Mailbox = mailbox
+		notifier.OnInviteAccepted = func(owner, joiner peer.ID) { reloadGater() }
+		mailboxHandler := &relay.MailboxHandler{
+			Mailbox:      mailbox,
+			AuthKeysPath: cfg.Security.AuthorizedKeysFile,
+			OnDeposit: func() {
+				// Joiners are not authorized yet; they connect through enrollment.
+				if gater != nil && !gater.IsEnrollmentEnabled() {
+					gater.SetEnrollmentMode(true, 10, 15*time.Second)
+				}
+			},
+			OnRedeemed: func(owner, joiner peer.ID) {
+				if h.Network().Connectedness(owner) == network.Connected {
+					go func() {
+						if err := notifier.DeliverMailbox(ctx, owner); err != nil {
+							slog.Warn("mailbox: delivery failed", "owner", owner.String()[:16]+"...", "err", err)
+						}
+					}()
+				}
+			},
+		}
+		h.SetStreamHandler(protocol.ID(relay.MailboxProtocol), mailboxHandler.HandleStream)
+		slog.Info("mailbox protocol registered", "protocol", relay.MailboxProtocol)
+	}
+
+	if federation != nil {
+		federation.Notifier = notifier
+		federation.OnPeersChanged = func(expiry map[peer.ID]time.Time) {
+			reloadGater()
+			if gater != nil {
+				for p, t := range expiry {
+					gater.SetPeerExpiry(p, t)
+				}
+			}
+		}
+		federation.OnGroupsChanged = func() {
+			// Codes created on another relay can be redeemed here too.
+			if gater != nil && tokenStore.ActiveGroupCount() > 0 && !gater.IsEnrollmentEnabled() {
+				gater.SetEnrollmentMode(true, 10, 15*time.Second)
+			}
+		}
+		h.SetStreamHandler(protocol.ID(relay.FederationProtocol), federation.HandleStream)
+		go federation.Run(ctx)
+		slog.Info("relay federation enabled", "protocol", relay.FederationProtocol, "relays", len(fedRelays))
+	}
+
+	// Start admin socket for relay pair and circuit CLI commands.
 	adminSocketPath := filepath.Join(filepath.Dir(configFile), ".relay-admin.sock")
 	adminCookiePath := filepath.Join(filepath.Dir(configFile), ".relay-admin.cookie")
-	relayAddrStr, err := buildRelayAddrFromConfig(cfg)
+	inviteAddrs, err := buildRelayAddrsFromConfig(cfg)
 	if err != nil {
-		slog.Warn("admin socket: could not build relay addr for code encoding", "err", err)
-		relayAddrStr = "" // non-fatal: admin socket still works, code encoding will fail
+		slog.Warn("admin socket: could not build relay addrs for code encoding", "err", err)
+		inviteAddrs = nil // non-fatal: admin socket still works, code encoding will fail
 	}
-	adminSrv := relay.NewAdminServer(tokenStore, gater, relayAddrStr, cfg.Discovery.Network, adminSocketPath, adminCookiePath)
+	adminSrv := relay.NewAdminServer(pairingStore, gater, inviteAddrs, cfg.Discovery.Network, adminSocketPath, adminCookiePath)
+	adminSrv.SetCircuitMonitor(circuitMonitor)
+	adminSrv.SetUsageTracker(usageTracker)
+	adminSrv.SetFederatedRelays(cfg.Federation.Peers)
 	if err := adminSrv.Start(); err != nil {
 		slog.Error("failed to start admin socket", "err", err)
 		// Non-fatal: relay still functions, just no CLI pairing
@@ -228,14 +430,38 @@ func runRelayServe(args []string) {
 				if removed := tokenStore.CleanExpired(); removed > 0 {
 					slog.Info("cleaned expired pairing groups", "removed", removed)
 				}
-				// Auto-disable enrollment when no active groups.
-				if gater != nil && tokenStore.ActiveGroupCount() == 0 && gater.IsEnrollmentEnabled() {
+				openInvites := 0
+				if mailbox != nil {
+					if removed := mailbox.CleanExpired(); removed > 0 {
+						slog.Info("cleaned expired mailbox invites", "removed", removed)
+					}
+					openInvites = mailbox.OpenCount()
+				}
+				// Auto-disable enrollment when no active groups or open invites.
+				if gater != nil && tokenStore.ActiveGroupCount() == 0 && openInvites == 0 && gater.IsEnrollmentEnabled() {
 					gater.SetEnrollmentMode(false, 0, 0)
 				}
 			}
 		}
 	}()
 
+	// Relay usage: persist counters and pick up authorized_keys edits.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reloadRelayLimits()
+				if err := usageTracker.Save(); err != nil {
+					slog.Warn("relay usage: save failed", "err", err)
+				}
+			}
+		}
+	}()
+
 	// Probation cleanup goroutine (evict stale probation peers).
 	if gater != nil {
 		go func() {
@@ -311,18 +537,6 @@ func runRelayServe(args []string) {
 		},
 	})
 
-	// Initialize relay observability (opt-in)
-	var relayMetrics *p2pnet.Metrics
-	if cfg.Telemetry.Metrics.Enabled {
-		relayMetrics = p2pnet.NewMetrics(version, runtime.Version())
-		slog.Info("telemetry: metrics enabled", "addr", cfg.Telemetry.Metrics.ListenAddress)
-	}
-	var relayAudit *p2pnet.AuditLogger
-	if cfg.Telemetry.Audit.Enabled {
-		relayAudit = p2pnet.NewAuditLogger(slog.NewJSONHandler(os.Stderr, nil))
-		slog.Info("telemetry: audit logging enabled")
-	}
-
 	// Wire auth decision callback on relay gater
 	if gater != nil && (relayMetrics != nil || relayAudit != nil) {
 		gater.SetDecisionCallback(func(peerID, result string) {
@@ -554,11 +768,10 @@ func runRelayInfo(configFile string) {
 	}
 
 	// Read identity key (don't auto-create  - info is read-only)
-	data, err := os.ReadFile(cfg.Identity.KeyFile)
-	if err != nil {
+	if _, err := os.Stat(cfg.Identity.KeyFile); err != nil {
 		fatal("Cannot read identity key %s: %v\n  Run the relay server once to generate a key.", cfg.Identity.KeyFile, err)
 	}
-	priv, err := crypto.UnmarshalPrivateKey(data)
+	priv, err := identity.LoadIdentity(cfg.Identity.KeyFile, keyPassphrase(cfg.Identity))
 	if err != nil {
 		fatal("Invalid identity key: %v", err)
 	}
@@ -583,8 +796,22 @@ func runRelayInfo(configFile string) {
 			fmt.Printf("Authorized peers: %d\n", len(peers))
 		}
 	}
+	if len(cfg.Federation.Peers) > 0 {
+		fmt.Printf("Federated relays: %d\n", len(cfg.Federation.Peers))
+		for _, addr := range cfg.Federation.Peers {
+			fmt.Printf("  %s\n", addr)
+		}
+	}
 	fmt.Println()
 
+	// Per-peer relay usage: live from the running relay, else from disk.
+	if usage, live, err := loadRelayUsage(cfg, configFile); err != nil {
+		fmt.Printf("Relay usage: unavailable (%v)\n\n", err)
+	} else {
+		writeRelayUsage(os.Stdout, usage, relayPeerNames(cfg.Security.AuthorizedKeysFile), live)
+		fmt.Println()
+	}
+
 	// Detect public IPs and construct multiaddrs for all configured transports
 	publicIPs := detectPublicIPs()
 	multiaddrs := buildPublicMultiaddrs(cfg.Network.ListenAddresses, publicIPs, peerID)
@@ -788,6 +1015,12 @@ func printRelayServeUsage() {
 	fmt.Println("  authorize <peer-id> [comment]       Allow a peer to use this relay")
 	fmt.Println("  deauthorize <peer-id>               Remove a peer's access")
 	fmt.Println("  list-peers                          List authorized peers")
+	fmt.Println("  reservations [--json]               Show peers holding a relay slot")
+	fmt.Println("  circuits [--json]                   Show relayed connections and data used")
+	fmt.Println("  kick <circuit-id>                   Close a circuit")
+	fmt.Println("  ban <peer-id|ip|cidr> [--for 1h]    Refuse relay service temporarily")
+	fmt.Println("  unban <peer-id|ip|cidr>             Lift a ban")
+	fmt.Println("  bans [--json]                       List active bans")
 	fmt.Println("  config validate                     Validate relay config without starting")
 	fmt.Println("  config rollback                     Restore last-known-good config")
 	fmt.Println()
@@ -797,7 +1030,21 @@ func printRelayServeUsage() {
 	fmt.Println("  peerup relay serve --config /etc/peerup/relay-server.yaml")
 	fmt.Println("  peerup relay authorize 12D3KooW... home-node")
 	fmt.Println("  peerup relay info")
+	fmt.Println("  peerup relay ban 203.0.113.0/24 --for 6h --reason \"bandwidth spike\"")
 	fmt.Println()
 	fmt.Println("Server commands use relay-server.yaml in the working directory by default.")
 	fmt.Println("All commands support --config <path>.")
 }
+
+// loadRelayGaterPeers returns the peers the relay gater lets in: those in
+// authorized_keys plus the federated relays.
+func loadRelayGaterPeers(authKeysPath string, fedRelays []peer.AddrInfo) (map[peer.ID]bool, error) {
+	peers, err := auth.LoadAuthorizedKeys(authKeysPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, ai := range fedRelays {
+		peers[ai.ID] = true
+	}
+	return peers, nil
+}
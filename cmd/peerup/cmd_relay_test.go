@@ -6,9 +6,12 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
 )
 
 // writeTestConfigDir creates a full test config directory with a valid
@@ -645,6 +648,51 @@ func TestBuildPublicMultiaddrs(t *testing.T) {
 
 // ----- doStatus tests -----
 
+func TestInviteRelayAddrs(t *testing.T) {
+	pid, err := peer.Decode("12D3KooWLCavCP1Pma9NGJQnGDQhgwSjgQgupWprZJH4w1P3HCVL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffix := "/p2p/" + pid.String()
+
+	tests := []struct {
+		name      string
+		listen    []string
+		publicIPs []string
+		want      []string
+	}{
+		{
+			name:      "dual stack TCP, QUIC and WebSocket skipped",
+			listen:    []string{"/ip4/0.0.0.0/tcp/7777", "/ip6/::/tcp/7777", "/ip4/0.0.0.0/udp/7777/quic-v1", "/ip4/0.0.0.0/tcp/7778/ws"},
+			publicIPs: []string{"203.0.113.5", "2001:db8::1"},
+			want:      []string{"/ip4/203.0.113.5/tcp/7777" + suffix, "/ip6/2001:db8::1/tcp/7777" + suffix},
+		},
+		{
+			name:      "QUIC only",
+			listen:    []string{"/ip6/::/udp/443/quic-v1"},
+			publicIPs: []string{"2001:db8::1"},
+			want:      []string{"/ip6/2001:db8::1/udp/443/quic-v1" + suffix},
+		},
+		{
+			name:   "explicit address needs no detection",
+			listen: []string{"/ip6/2001:db8::9/tcp/7777"},
+			want:   []string{"/ip6/2001:db8::9/tcp/7777" + suffix},
+		},
+		{
+			name:   "unspecified without public IPs",
+			listen: []string{"/ip4/0.0.0.0/tcp/7777"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := inviteRelayAddrs(tt.listen, tt.publicIPs, pid)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestDoStatus(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -1020,3 +1068,35 @@ func TestResolveConfigFileErr(t *testing.T) {
 		}
 	})
 }
+
+func TestFormatRelayHealth(t *testing.T) {
+	healthy := formatRelayHealth(p2pnet.RelayHealthStatus{
+		Score:     0.87,
+		Healthy:   true,
+		RTTMs:     42.5,
+		Reserved:  true,
+		Successes: 5,
+		LastProbe: time.Now(),
+	})
+	for _, want := range []string{"usable", "score 0.87", "rtt 42.5ms", "reserved", "5 ok / 0 failed"} {
+		if !strings.Contains(healthy, want) {
+			t.Errorf("healthy output %q missing %q", healthy, want)
+		}
+	}
+
+	dead := formatRelayHealth(p2pnet.RelayHealthStatus{
+		Score:     0.02,
+		Failures:  4,
+		LastProbe: time.Now(),
+		LastError: "dial timeout",
+	})
+	for _, want := range []string{"UNHEALTHY", "0 ok / 4 failed", "last error: dial timeout"} {
+		if !strings.Contains(dead, want) {
+			t.Errorf("unhealthy output %q missing %q", dead, want)
+		}
+	}
+
+	if got := formatRelayHealth(p2pnet.RelayHealthStatus{Healthy: true, Score: 0.55}); !strings.Contains(got, "not probed yet") {
+		t.Errorf("unprobed output %q missing %q", got, "not probed yet")
+	}
+}
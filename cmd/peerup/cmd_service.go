@@ -1,15 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/daemon"
 	"github.com/satindergrewal/peer-up/internal/termcolor"
 	"github.com/satindergrewal/peer-up/internal/validate"
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
 )
 
 func runService(args []string) {
@@ -29,6 +34,8 @@ func runService(args []string) {
 		runServiceSetEnabled(args[1:], true)
 	case "disable":
 		runServiceSetEnabled(args[1:], false)
+	case "browse":
+		runServiceBrowse(args[1:])
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown service command: %s\n\n", args[0])
 		printServiceUsage()
@@ -45,17 +52,20 @@ func printServiceUsage() {
 	fmt.Println("  remove  <name>            Remove a service")
 	fmt.Println("  enable  <name>            Enable a service")
 	fmt.Println("  disable <name>            Disable a service")
+	fmt.Println("  browse  <peer>            List the services a peer lets you use")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  peerup service add ssh localhost:22")
 	fmt.Println("  peerup service add ollama localhost:11434")
+	fmt.Println("  peerup service add docker unix:/var/run/docker.sock")
 	fmt.Println("  peerup service add web localhost:8080 --protocol my-web")
 	fmt.Println("  peerup service list")
 	fmt.Println("  peerup service disable web")
 	fmt.Println("  peerup service enable web")
 	fmt.Println("  peerup service remove web")
+	fmt.Println("  peerup service browse home-server")
 	fmt.Println()
-	fmt.Println("All commands support --config <path>.")
+	fmt.Println("All commands except browse support --config <path>.")
 }
 
 func runServiceAdd(args []string) {
@@ -70,12 +80,13 @@ func doServiceAdd(args []string, stdout io.Writer) error {
 	fs.SetOutput(io.Discard)
 	configFlag := fs.String("config", "", "path to config file")
 	protocolFlag := fs.String("protocol", "", "custom protocol ID (optional)")
+	descriptionFlag := fs.String("description", "", "description shown to peers that browse this node (optional)")
 	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
 		return err
 	}
 
 	if fs.NArg() < 2 {
-		return fmt.Errorf("usage: peerup service add <name> <local-address> [--protocol <id>]")
+		return fmt.Errorf("usage: peerup service add <name> <local-address> [--protocol <id>] [--description <text>]")
 	}
 
 	name := fs.Arg(0)
@@ -86,9 +97,13 @@ func doServiceAdd(args []string, stdout io.Writer) error {
 		return fmt.Errorf("invalid service name: %w", err)
 	}
 
-	// Validate address has host:port
-	if _, _, err := net.SplitHostPort(address); err != nil {
-		return fmt.Errorf("invalid address %q: must be host:port (e.g., localhost:22)\n  Error: %v", address, err)
+	if len(*descriptionFlag) > config.MaxServiceDescriptionLen {
+		return fmt.Errorf("description must be at most %d characters", config.MaxServiceDescriptionLen)
+	}
+
+	// Validate address is host:port or unix:/path
+	if err := validate.LocalAddress(address); err != nil {
+		return fmt.Errorf("invalid address %q: must be host:port (e.g., localhost:22) or unix:/path/to.sock\n  Error: %v", address, err)
 	}
 
 	cfgFile, cfg, err := resolveConfigFileErr(*configFlag)
@@ -111,6 +126,9 @@ func doServiceAdd(args []string, stdout io.Writer) error {
 	} else {
 		block = fmt.Sprintf("  %s:\n    enabled: true\n    local_address: \"%s\"", name, address)
 	}
+	if *descriptionFlag != "" {
+		block += fmt.Sprintf("\n    description: %s", strconv.Quote(*descriptionFlag))
+	}
 
 	// Read config file and insert service
 	data, err := os.ReadFile(cfgFile)
@@ -232,11 +250,39 @@ func doServiceList(args []string, stdout io.Writer) error {
 			proto = fmt.Sprintf("  protocol: %s", svc.Protocol)
 		}
 		fmt.Fprintf(stdout, "  %-12s -> %-20s (%s)%s\n", name, svc.LocalAddress, state, proto)
+		if svc.Description != "" {
+			fmt.Fprintf(stdout, "  %-12s    %s\n", "", svc.Description)
+		}
+
+		// Access windows, with whether each is open right now
+		rules, err := accessRulesFromConfig(svc.Access)
+		if err != nil {
+			fmt.Fprintf(stdout, "  %-12s    access: invalid (%v)\n", "", err)
+			continue
+		}
+		now := time.Now()
+		for _, rule := range rules {
+			fmt.Fprintf(stdout, "  %-12s    access: %s [%s]\n", "", describeAccessRule(rule), accessRuleStatus(rule, now))
+		}
 	}
 	fmt.Fprintf(stdout, "\nConfig: %s\n", cfgFile)
 	return nil
 }
 
+// accessRuleStatus describes whether rule lets peers in at now.
+func accessRuleStatus(rule *p2pnet.AccessRule, now time.Time) string {
+	switch rule.Check(now) {
+	case "":
+		return "open now"
+	case p2pnet.AccessDeniedNotYetValid:
+		return "not yet valid"
+	case p2pnet.AccessDeniedExpired:
+		return "expired"
+	default:
+		return "closed now"
+	}
+}
+
 func runServiceSetEnabled(args []string, enabled bool) {
 	if err := doServiceSetEnabled(args, enabled, os.Stdout); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -471,3 +517,65 @@ func doServiceRemove(args []string, stdout io.Writer) error {
 	fmt.Fprintln(stdout, "Restart 'peerup daemon' to apply.")
 	return nil
 }
+
+// serviceBrowser is the daemon API surface used by service browse.
+type serviceBrowser interface {
+	PeerServices(peer string) (*daemon.PeerServicesResponse, error)
+}
+
+func runServiceBrowse(args []string) {
+	var c serviceBrowser
+	if dc := tryDaemonClient(); dc != nil {
+		c = dc
+	}
+	if err := doServiceBrowse(args, c, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+// doServiceBrowse asks a peer, through the daemon, which of its services
+// this node may use. The peer only answers with services its ACLs and
+// access windows allow us right now.
+func doServiceBrowse(args []string, c serviceBrowser, stdout io.Writer) error {
+	fs := flag.NewFlagSet("service browse", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonFlag := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(reorderArgs(args, map[string]bool{"json": true})); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: peerup service browse <peer> [--json]")
+	}
+	if c == nil {
+		return fmt.Errorf("daemon is not running; start it with 'peerup daemon' to browse services")
+	}
+
+	target := fs.Arg(0)
+	resp, err := c.PeerServices(target)
+	if err != nil {
+		return fmt.Errorf("browse failed: %w", err)
+	}
+
+	if *jsonFlag {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(resp)
+	}
+
+	if len(resp.Services) == 0 {
+		fmt.Fprintf(stdout, "%s offers no services to this node.\n", target)
+		return nil
+	}
+	fmt.Fprintf(stdout, "Services on %s (%d):\n\n", target, len(resp.Services))
+	for _, svc := range resp.Services {
+		name := svc.Name
+		if svc.Transport == p2pnet.ServiceTransportUDP {
+			name += " (udp)"
+		}
+		fmt.Fprintf(stdout, "  %-16s %s\n", name, svc.Description)
+	}
+	fmt.Fprintln(stdout)
+	fmt.Fprintf(stdout, "Connect with: peerup proxy %s <service> <local-port>\n", target)
+	return nil
+}
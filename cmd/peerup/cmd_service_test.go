@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/daemon"
 )
 
 // writeServiceTestConfig creates a full test config directory with a valid
@@ -126,6 +128,22 @@ func TestDoServiceAdd(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "add service with description",
+			args: func(cfgPath string) []string {
+				return []string{"--config", cfgPath, "nas", "localhost:445", "--description", `Family "photos" share`}
+			},
+			wantOutput: []string{"Config:", "Restart"},
+			checkFile: func(t *testing.T, cfgPath string) {
+				cfg, err := config.LoadNodeConfig(cfgPath)
+				if err != nil {
+					t.Fatalf("config no longer loads: %v", err)
+				}
+				if got := cfg.Services["nas"].Description; got != `Family "photos" share` {
+					t.Errorf("description = %q", got)
+				}
+			},
+		},
 		{
 			name: "add duplicate service",
 			servicesYAML: `services:
@@ -185,6 +203,30 @@ func TestDoServiceAdd(t *testing.T) {
 			wantErr:    true,
 			wantErrStr: "invalid address",
 		},
+		{
+			name: "add unix socket service",
+			args: func(cfgPath string) []string {
+				return []string{"--config", cfgPath, "docker", "unix:/var/run/docker.sock"}
+			},
+			wantOutput: []string{"Config:", "Restart"},
+			checkFile: func(t *testing.T, cfgPath string) {
+				data, err := os.ReadFile(cfgPath)
+				if err != nil {
+					t.Fatalf("read config: %v", err)
+				}
+				if !strings.Contains(string(data), `local_address: "unix:/var/run/docker.sock"`) {
+					t.Error("config should contain the unix socket local_address")
+				}
+			},
+		},
+		{
+			name: "invalid relative unix socket",
+			args: func(cfgPath string) []string {
+				return []string{"--config", cfgPath, "docker", "unix:docker.sock"}
+			},
+			wantErr:    true,
+			wantErrStr: "invalid address",
+		},
 		{
 			name: "add to existing services",
 			servicesYAML: `services:
@@ -364,6 +406,29 @@ func TestDoServiceList(t *testing.T) {
     protocol: "my-web"`,
 			wantOutput: []string{"web", "my-web"},
 		},
+		{
+			name: "shows access windows",
+			servicesYAML: `services:
+  rdp:
+    enabled: true
+    local_address: "localhost:3389"
+    access:
+      - peers: ["12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"]
+        windows: ["mon-fri 09:00-18:00"]
+        timezone: "Europe/Berlin"
+      - not_after: "2000-01-01T00:00:00Z"`,
+			wantOutput: []string{"access: 1 peer, mon-fri 09:00-18:00 (Europe/Berlin)", "access: all peers, until 2000-01-01T00:00:00Z [expired]"},
+		},
+		{
+			name: "flags invalid access window",
+			servicesYAML: `services:
+  rdp:
+    enabled: true
+    local_address: "localhost:3389"
+    access:
+      - windows: ["someday"]`,
+			wantOutput: []string{"access: invalid", "someday"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1095,3 +1160,61 @@ func TestSanitizeYAMLNameRoundTrip(t *testing.T) {
 		t.Fatalf("expected 1 name (empty should be skipped), got %d: %v", len(cfg.Names), cfg.Names)
 	}
 }
+
+// ----- doServiceBrowse tests -----
+
+// fakeServiceBrowser returns a canned service list.
+type fakeServiceBrowser struct {
+	resp *daemon.PeerServicesResponse
+	peer string
+}
+
+func (f *fakeServiceBrowser) PeerServices(peer string) (*daemon.PeerServicesResponse, error) {
+	f.peer = peer
+	return f.resp, nil
+}
+
+func TestDoServiceBrowse(t *testing.T) {
+	if err := doServiceBrowse([]string{"home"}, nil, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "daemon is not running") {
+		t.Errorf("nil client: err = %v", err)
+	}
+	if err := doServiceBrowse(nil, &fakeServiceBrowser{}, &bytes.Buffer{}); err == nil {
+		t.Error("expected usage error without a peer")
+	}
+
+	c := &fakeServiceBrowser{resp: &daemon.PeerServicesResponse{
+		PeerID: "12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN",
+		Services: []daemon.RemoteServiceInfo{
+			{Name: "dns", Transport: "udp"},
+			{Name: "ssh", Transport: "tcp", Description: "Shell on the NAS"},
+		},
+	}}
+	var out bytes.Buffer
+	if err := doServiceBrowse([]string{"home"}, c, &out); err != nil {
+		t.Fatalf("doServiceBrowse() error = %v", err)
+	}
+	if c.peer != "home" {
+		t.Errorf("queried peer = %q, want home", c.peer)
+	}
+	for _, want := range []string{"dns (udp)", "Shell on the NAS", "peerup proxy home"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := doServiceBrowse([]string{"home", "--json"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	var resp daemon.PeerServicesResponse
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil || len(resp.Services) != 2 {
+		t.Errorf("JSON output = %q (err %v)", out.String(), err)
+	}
+
+	out.Reset()
+	c.resp = &daemon.PeerServicesResponse{Services: []daemon.RemoteServiceInfo{}}
+	doServiceBrowse([]string{"home"}, c, &out)
+	if !strings.Contains(out.String(), "offers no services") {
+		t.Errorf("empty output = %q", out.String())
+	}
+}
@@ -46,7 +46,7 @@ func doStatus(args []string, stdout io.Writer) error {
 	config.ResolveConfigPaths(cfg, filepath.Dir(cfgFile))
 
 	// Peer ID
-	peerID, err := p2pnet.PeerIDFromKeyFile(cfg.Identity.KeyFile)
+	peerID, err := p2pnet.PeerIDFromKeyFileWith(cfg.Identity.KeyFile, keyPassphrase(cfg.Identity))
 	if err != nil {
 		fmt.Fprintf(stdout, "Peer ID:  error (%v)\n", err)
 	} else {
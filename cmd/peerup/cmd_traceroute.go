@@ -61,6 +61,7 @@ func runTraceroute(args []string) {
 	// Create P2P network
 	p2pNetwork, err := p2pnet.New(&p2pnet.Config{
 		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
 		Config:             &config.Config{Network: cfg.Network},
 		UserAgent:          "peerup/" + version,
 		EnableRelay:        true,
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/internal/termcolor"
+)
+
+// tunnelClient is the daemon API surface used by the tunnel commands.
+type tunnelClient interface {
+	Tunnels() ([]daemon.TunnelInfo, error)
+	ReverseTunnel(peer, remoteListen, localAddr string) (*daemon.TunnelInfo, error)
+	CloseTunnel(id string) error
+}
+
+func runTunnel(args []string) {
+	if len(args) < 1 {
+		printTunnelUsage()
+		osExit(1)
+	}
+
+	var c tunnelClient
+	if dc := tryDaemonClient(); dc != nil {
+		c = dc
+	}
+
+	var err error
+	switch args[0] {
+	case "reverse":
+		err = doTunnelReverse(args[1:], c, os.Stdout)
+	case "list":
+		err = doTunnelList(args[1:], c, os.Stdout)
+	case "close":
+		err = doTunnelClose(args[1:], c, os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown tunnel command: %s\n\n", args[0])
+		printTunnelUsage()
+		osExit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		osExit(1)
+	}
+}
+
+func printTunnelUsage() {
+	fmt.Println("Usage: peerup tunnel <command> [options]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  reverse <peer> <remote-listen> <local-addr>   Have a peer listen and forward to a local port")
+	fmt.Println("  list [--json]                                 Show reverse tunnels in both directions")
+	fmt.Println("  close <id>                                    Tear down a reverse tunnel")
+	fmt.Println()
+	fmt.Println("Example (like ssh -R):")
+	fmt.Println("  peerup tunnel reverse home 0.0.0.0:8080 localhost:3000")
+	fmt.Println()
+	fmt.Println("The remote peer must allow the listen address under reverse_tunnels.allow")
+	fmt.Println("in its peerup.yaml. Tunnels last until closed or either daemon stops.")
+}
+
+// requireTunnelDaemon returns an error when no daemon is running. Tunnels
+// live in the daemon, so every tunnel command needs one.
+func requireTunnelDaemon(c tunnelClient) error {
+	if c == nil {
+		return fmt.Errorf("daemon is not running; start it with 'peerup daemon' to use tunnels")
+	}
+	return nil
+}
+
+// doTunnelReverse asks a peer to listen on remote-listen and forward
+// accepted connections back to local-addr on this node.
+func doTunnelReverse(args []string, c tunnelClient, stdout io.Writer) error {
+	fs := flag.NewFlagSet("tunnel reverse", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		return fmt.Errorf("usage: peerup tunnel reverse <peer> <remote-listen> <local-addr>")
+	}
+	if err := requireTunnelDaemon(c); err != nil {
+		return err
+	}
+
+	t, err := c.ReverseTunnel(fs.Arg(0), fs.Arg(1), absLocalAddr(fs.Arg(2)))
+	if err != nil {
+		return fmt.Errorf("reverse tunnel failed: %w", err)
+	}
+	termcolor.Green("Reverse tunnel %s open", t.ID)
+	fmt.Fprintf(stdout, "  %s on %s -> %s here\n", t.Listen, fs.Arg(0), t.LocalAddr)
+	fmt.Fprintf(stdout, "  Close with: peerup tunnel close %s\n", t.ID)
+	return nil
+}
+
+func doTunnelList(args []string, c tunnelClient, stdout io.Writer) error {
+	fs := flag.NewFlagSet("tunnel list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	jsonFlag := fs.Bool("json", false, "output as JSON")
+	if err := fs.Parse(reorderArgs(args, map[string]bool{"json": true})); err != nil {
+		return err
+	}
+	if err := requireTunnelDaemon(c); err != nil {
+		return err
+	}
+
+	tunnels, err := c.Tunnels()
+	if err != nil {
+		return err
+	}
+	if *jsonFlag {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tunnels)
+	}
+
+	if len(tunnels) == 0 {
+		fmt.Fprintln(stdout, "No reverse tunnels.")
+		return nil
+	}
+	fmt.Fprintf(stdout, "Reverse tunnels (%d):\n\n", len(tunnels))
+	for _, t := range tunnels {
+		if t.Direction == "incoming" {
+			fmt.Fprintf(stdout, "  %s  %-22s listening here for %s\n", t.ID, t.Listen, shortPeerID(t.PeerID))
+		} else {
+			fmt.Fprintf(stdout, "  %s  %-22s on %s -> %s\n", t.ID, t.Listen, shortPeerID(t.PeerID), t.LocalAddr)
+		}
+	}
+	return nil
+}
+
+func doTunnelClose(args []string, c tunnelClient, stdout io.Writer) error {
+	fs := flag.NewFlagSet("tunnel close", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(reorderArgs(args, nil)); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: peerup tunnel close <id>")
+	}
+	if err := requireTunnelDaemon(c); err != nil {
+		return err
+	}
+
+	if err := c.CloseTunnel(fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Closed tunnel %s\n", fs.Arg(0))
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/satindergrewal/peer-up/internal/daemon"
+)
+
+// fakeTunnelClient records tunnel requests and returns canned results.
+type fakeTunnelClient struct {
+	tunnels []daemon.TunnelInfo
+	opened  []string
+	closed  []string
+}
+
+func (f *fakeTunnelClient) Tunnels() ([]daemon.TunnelInfo, error) { return f.tunnels, nil }
+
+func (f *fakeTunnelClient) ReverseTunnel(peer, remoteListen, localAddr string) (*daemon.TunnelInfo, error) {
+	f.opened = append(f.opened, peer, remoteListen, localAddr)
+	return &daemon.TunnelInfo{ID: "abc123", Direction: "outgoing", Listen: "0.0.0.0:8080", LocalAddr: localAddr}, nil
+}
+
+func (f *fakeTunnelClient) CloseTunnel(id string) error {
+	f.closed = append(f.closed, id)
+	return nil
+}
+
+func TestDoTunnelReverse(t *testing.T) {
+	c := &fakeTunnelClient{}
+	var out bytes.Buffer
+	if err := doTunnelReverse([]string{"home", "0.0.0.0:8080", "localhost:3000"}, c, &out); err != nil {
+		t.Fatalf("doTunnelReverse() error = %v", err)
+	}
+	if strings.Join(c.opened, " ") != "home 0.0.0.0:8080 localhost:3000" {
+		t.Errorf("request = %v", c.opened)
+	}
+	if !strings.Contains(out.String(), "peerup tunnel close abc123") {
+		t.Errorf("output = %q", out.String())
+	}
+
+	if err := doTunnelReverse([]string{"home", "0.0.0.0:8080"}, c, &out); err == nil {
+		t.Error("expected usage error with two arguments")
+	}
+	if err := doTunnelReverse([]string{"home", "0.0.0.0:8080", "localhost:3000"}, nil, &out); err == nil || !strings.Contains(err.Error(), "daemon is not running") {
+		t.Errorf("no daemon error = %v", err)
+	}
+}
+
+func TestDoTunnelList(t *testing.T) {
+	peerID := generateTestPeerID(t)
+	c := &fakeTunnelClient{tunnels: []daemon.TunnelInfo{
+		{ID: "out1", PeerID: peerID, Direction: "outgoing", Listen: "0.0.0.0:8080", LocalAddr: "localhost:3000"},
+		{ID: "in1", PeerID: peerID, Direction: "incoming", Listen: "127.0.0.1:9000"},
+	}}
+
+	var out bytes.Buffer
+	if err := doTunnelList(nil, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "-> localhost:3000") || !strings.Contains(out.String(), "listening here for") {
+		t.Errorf("output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := doTunnelList([]string{"--json"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	var tunnels []daemon.TunnelInfo
+	if err := json.Unmarshal(out.Bytes(), &tunnels); err != nil || len(tunnels) != 2 {
+		t.Errorf("JSON output = %q (err %v)", out.String(), err)
+	}
+
+	out.Reset()
+	if err := doTunnelList(nil, &fakeTunnelClient{}, &out); err != nil || !strings.Contains(out.String(), "No reverse tunnels") {
+		t.Errorf("empty list = %q, %v", out.String(), err)
+	}
+}
+
+func TestDoTunnelClose(t *testing.T) {
+	c := &fakeTunnelClient{}
+	var out bytes.Buffer
+	if err := doTunnelClose([]string{"abc123"}, c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.closed) != 1 || c.closed[0] != "abc123" {
+		t.Errorf("closed = %v", c.closed)
+	}
+	if err := doTunnelClose(nil, c, &out); err == nil {
+		t.Error("expected usage error without an ID")
+	}
+}
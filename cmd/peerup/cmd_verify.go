@@ -72,7 +72,7 @@ func runVerify(args []string) {
 	}
 
 	// Load our own identity.
-	ourPeerID, err := identity.PeerIDFromKeyFile(cfg.Identity.KeyFile)
+	ourPeerID, err := identity.PeerIDFromKeyFileWith(cfg.Identity.KeyFile, keyPassphrase(cfg.Identity))
 	if err != nil {
 		fatal("Failed to load identity: %v", err)
 	}
@@ -36,7 +36,7 @@ func doWhoami(args []string, stdout io.Writer) error {
 	}
 	config.ResolveConfigPaths(cfg, filepath.Dir(cfgFile))
 
-	peerID, err := p2pnet.PeerIDFromKeyFile(cfg.Identity.KeyFile)
+	peerID, err := p2pnet.PeerIDFromKeyFileWith(cfg.Identity.KeyFile, keyPassphrase(cfg.Identity))
 	if err != nil {
 		return fmt.Errorf("failed to load identity: %w", err)
 	}
@@ -60,6 +60,10 @@ protocols:
 #   web:
 #     enabled: false
 #     local_address: "localhost:80"
+#   wireguard:
+#     enabled: false
+#     local_address: "localhost:51820"
+#     protocol: udp  # forward UDP datagrams instead of TCP
 
 # Map friendly names to peer IDs:
 names: {}
@@ -126,6 +130,12 @@ security:
   # When false, any peer on the internet can relay through your VPS
   enable_connection_gating: true
 
+  # Asynchronous invites (off by default). When true, peers in authorized_keys
+  # may leave sealed invites here for joiners (peerup invite --async), and
+  # enrollment stays open while any invite is pending. A joiner is authorized
+  # only after the inviter's daemon has accepted its reply.
+  # invite_mailbox: true
+
 # Relay resource limits (defaults shown - uncomment to customize)
 # These control how much relay capacity each peer and session can consume.
 # Tuned for private relays serving 2-10 peers with SSH/XRDP workloads.
@@ -138,6 +148,17 @@ security:
 #   reservation_ttl: "1h"        # How long a reservation lasts
 #   session_duration: "10m"      # Max duration per relayed session
 #   session_data_limit: "64MB"   # Max data per session per direction
+#   bandwidth: "20MB"            # Total relayed bytes/sec, shared by relay_weight (default: unlimited)
+# Per-peer daily budgets and bandwidth weights go on authorized_keys lines:
+#   <peer-id>  relay_quota=5GB relay_weight=2  # kid's laptop
+
+# Relay federation (off by default)
+# Relays listed here share pairing codes, authorized peers and introductions
+# with this one, so a code from either relay can be redeemed on both.
+# Each relay must list every other relay. Requires authorized_keys_file.
+# federation:
+#   peers:
+#     - "/ip4/203.0.113.20/tcp/7777/p2p/12D3KooW..."
 
 # Health check endpoint for monitoring (Prometheus, UptimeKuma, etc.)
 # Disabled by default. Binds to localhost only - not exposed to the internet.
@@ -1,6 +1,11 @@
 package main
 
-import "strings"
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
+)
 
 // reorderArgs moves flags before positional arguments so Go's flag
 // parser sees them regardless of order. boolFlags names flags that
@@ -40,3 +45,28 @@ func reorderArgs(args []string, boolFlags map[string]bool) []string {
 	}
 	return append(flags, positional...)
 }
+
+// stringsFlag collects the values of a repeatable string flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// absLocalAddr makes a relative unix: socket path absolute, so the daemon
+// (which runs in its own working directory) sees the path the user meant.
+// Other addresses are returned unchanged.
+func absLocalAddr(addr string) string {
+	path, ok := strings.CutPrefix(addr, p2pnet.UnixAddrPrefix)
+	if !ok || path == "" || filepath.IsAbs(path) {
+		return addr
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return addr
+	}
+	return p2pnet.UnixAddrPrefix + abs
+}
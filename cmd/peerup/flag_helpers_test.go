@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -69,3 +71,21 @@ func TestReorderArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestAbsLocalAddr(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ in, want string }{
+		{"127.0.0.1:2222", "127.0.0.1:2222"},
+		{"unix:/tmp/agent.sock", "unix:/tmp/agent.sock"},
+		{"unix:agent.sock", "unix:" + filepath.Join(wd, "agent.sock")},
+		{"unix:", "unix:"},
+	}
+	for _, tt := range tests {
+		if got := absLocalAddr(tt.in); got != tt.want {
+			t.Errorf("absLocalAddr(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -39,10 +39,16 @@ func main() {
 		runTraceroute(os.Args[2:])
 	case "resolve":
 		runResolve(os.Args[2:])
+	case "names":
+		runNames(os.Args[2:])
+	case "tunnel":
+		runTunnel(os.Args[2:])
 	case "whoami":
 		runWhoami(os.Args[2:])
 	case "auth":
 		runAuth(os.Args[2:])
+	case "key":
+		runKey(os.Args[2:])
 	case "relay":
 		runRelay(os.Args[2:])
 	case "config":
@@ -81,20 +87,29 @@ func printUsage() {
 	fmt.Println("  daemon ping <target> [-c N] [--json]     Ping via daemon")
 	fmt.Println("  daemon services [--json]                 List services via daemon")
 	fmt.Println("  daemon peers [--all] [--json]            List connected peers via daemon")
-	fmt.Println("  daemon connect --peer <p> --service <s> --listen <addr>")
+	fmt.Println("  daemon events [--type t] [--peer p]      Stream live daemon events")
+	fmt.Println("  daemon connect --peer <p> --service <s> --listen <addr|unix:path> [--udp] [--warmup]")
 	fmt.Println("  daemon disconnect <id>                   Tear down proxy")
 	fmt.Println()
 	fmt.Println("Network tools (standalone, no daemon required):")
 	fmt.Println("  ping <target> [-c N] [--interval 1s] [--json]  P2P ping")
 	fmt.Println("  traceroute <target> [--json]                    P2P traceroute")
 	fmt.Println("  resolve <name> [--json]                         Resolve name to peer ID")
-	fmt.Println("  proxy <target> <service> <local-port>           Forward TCP port")
+	fmt.Println("  names list [--json]                             Merged name directory with origins")
+	fmt.Println("  names sync [peer]                               Sync names with authorized peers (daemon)")
+	fmt.Println("  proxy [--udp] [--warmup] <target> <svc> <port>  Forward TCP (or UDP) port, or unix:<path>")
+	fmt.Println("  tunnel reverse <peer> <remote-listen> <local>    Have a peer forward a port to you (daemon)")
+	fmt.Println("  tunnel list|close <id>                          Manage reverse tunnels (daemon)")
 	fmt.Println()
 	fmt.Println("Identity & access:")
 	fmt.Println("  whoami                                  Show your peer ID")
 	fmt.Println("  auth add <peer-id> [--comment \"...\"]    Authorize a peer")
 	fmt.Println("  auth list                               List authorized peers")
 	fmt.Println("  auth remove <peer-id>                   Revoke a peer's access")
+	fmt.Println("  auth revoke <peer-id> [--reason \"...\"]  Revoke a group member on every node")
+	fmt.Println("  auth role add|remove <peer-id> <role>   Assign a named role")
+	fmt.Println("  key encrypt|decrypt|change-passphrase   Manage identity key encryption")
+	fmt.Println("  key rotate                              New identity key; notify authorized peers")
 	fmt.Println()
 	fmt.Println("Configuration:")
 	fmt.Println("  init                                    Set up peerup configuration")
@@ -115,6 +130,9 @@ func printUsage() {
 	fmt.Println("  relay list-peers                         List authorized peers")
 	fmt.Println("  relay info                               Show peer ID and multiaddrs")
 	fmt.Println("  relay pair [--count N] [--ttl 1h]        Generate pairing codes")
+	fmt.Println("  relay circuits [--json]                  Show relayed connections")
+	fmt.Println("  relay kick <circuit-id>                  Close a circuit")
+	fmt.Println("  relay ban <peer-id|ip|cidr> [--for 1h]   Temporarily refuse relay service")
 	fmt.Println("  relay config validate                    Validate relay config")
 	fmt.Println("  relay config rollback                    Restore last-known-good config")
 	fmt.Println()
@@ -123,10 +141,14 @@ func printUsage() {
 	fmt.Println("  service enable <name>                    Enable a service")
 	fmt.Println("  service disable <name>                   Disable a service")
 	fmt.Println("  service list                             List configured services")
+	fmt.Println("  service browse <peer> [--json]           List services a peer lets you use")
 	fmt.Println()
 	fmt.Println("Pairing:")
 	fmt.Println("  invite [--name \"home\"] [--non-interactive]")
-	fmt.Println("  join <code> [--name \"laptop\"] [--non-interactive]")
+	fmt.Println("  invite --async [--ttl 24h] [--name \"home\"]  Invite that can be redeemed while you are offline")
+	fmt.Println("  invite list [--json]                    List pending asynchronous invites")
+	fmt.Println("  invite cancel <id>                      Withdraw an asynchronous invite")
+	fmt.Println("  join <code> [--name \"laptop\"] [--relay <addr>]... [--non-interactive]")
 	fmt.Println("  verify <peer>                           Verify a peer's identity (SAS)")
 	fmt.Println()
 	fmt.Println("  status [--config path]                  Show local config and services")
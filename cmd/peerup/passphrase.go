@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/identity"
+)
+
+// promptPassphrase asks for a passphrase on the terminal without echo.
+// Tests replace it to script answers.
+var promptPassphrase = readPassphraseTerminal
+
+// keyPassphrase returns the unlock source for an encrypted identity key:
+// PEERUP_KEY_PASSPHRASE, then identity.passphrase_file, then a terminal
+// prompt. It is only consulted when the key file is actually encrypted.
+func keyPassphrase(idCfg config.IdentityConfig) identity.PassphraseFunc {
+	return func() ([]byte, error) {
+		if p, ok := os.LookupEnv(identity.PassphraseEnv); ok {
+			return []byte(p), nil
+		}
+		if idCfg.PassphraseFile != "" {
+			return identity.ReadPassphraseFile(idCfg.PassphraseFile)
+		}
+		return promptPassphrase(fmt.Sprintf("Passphrase for %s: ", idCfg.KeyFile))
+	}
+}
+
+// newKeyPassphrase asks for a new passphrase twice and checks they match.
+func newKeyPassphrase() ([]byte, error) {
+	pass, err := promptPassphrase("New passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, identity.ErrEmptyPassphrase
+	}
+	confirm, err := promptPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pass, confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return pass, nil
+}
+
+// readPassphraseTerminal prints prompt to stderr and reads one line from
+// stdin with echo disabled. It fails when stdin is not a terminal, so
+// daemons under systemd get a clear error instead of hanging.
+func readPassphraseTerminal(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !isTerminal(fd) {
+		return nil, fmt.Errorf("%w: stdin is not a terminal (set %s or identity.passphrase_file)",
+			identity.ErrPassphraseRequired, identity.PassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := readNoEcho(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return pass, nil
+}
+
+// readLine reads stdin up to a newline, without buffering past it.
+func readLine() ([]byte, error) {
+	var line []byte
+	buf := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n == 1 {
+			if buf[0] == '\n' {
+				return bytes.TrimSuffix(line, []byte("\r")), nil
+			}
+			line = append(line, buf[0])
+		}
+		if err != nil {
+			if len(line) > 0 {
+				return line, nil
+			}
+			return nil, err
+		}
+	}
+}
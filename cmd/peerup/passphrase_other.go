@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+import "errors"
+
+// Echo control is not implemented on this platform; use
+// PEERUP_KEY_PASSPHRASE or identity.passphrase_file instead.
+func isTerminal(fd int) bool { return false }
+
+func readNoEcho(fd int) ([]byte, error) {
+	return nil, errors.New("terminal passphrase prompt not supported on this platform")
+}
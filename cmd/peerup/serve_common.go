@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
@@ -27,6 +28,8 @@ import (
 
 	"github.com/satindergrewal/peer-up/internal/auth"
 	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/daemon"
+	"github.com/satindergrewal/peer-up/internal/invite"
 	"github.com/satindergrewal/peer-up/internal/relay"
 	"github.com/satindergrewal/peer-up/internal/reputation"
 	"github.com/satindergrewal/peer-up/internal/watchdog"
@@ -40,6 +43,23 @@ type serveRuntime struct {
 	configFile string
 	gater      *auth.AuthorizedPeerGater // nil if connection gating disabled
 	authKeys   string                    // path to authorized_keys file
+	revokes    *relay.RevocationGossip   // nil until SetupRevocations (gating enabled)
+	directory  *p2pnet.DirectorySync     // nil unless directory.enabled
+	lan        *p2pnet.LANDiscovery      // nil unless discovery.mdns
+	nameServer *p2pnet.NameServer        // nil unless dns.enabled
+	meshProxy  *p2pnet.MeshProxy         // nil unless proxy.socks.enabled
+	tunnels    *p2pnet.ReverseTunnels    // nil until SetupReverseTunnels
+	invites    *invite.PendingStore      // nil until SetupAsyncInvites (gating and relays configured)
+
+	// Loopback proxies opened for peers resolved through the name server
+	dnsMu      sync.Mutex
+	dnsProxies map[peer.ID][]*p2pnet.TCPListener
+
+	// Names currently registered from the merged directory view, and the
+	// config file's names, which directory entries never override
+	dirMu    sync.Mutex
+	dirNames map[string]peer.ID
+	dirLocal map[string]string
 	ctx        context.Context
 	cancel     context.CancelFunc
 	version    string
@@ -52,9 +72,15 @@ type serveRuntime struct {
 	// Path dialer for parallel connection racing
 	pathDialer *p2pnet.PathDialer
 
+	// Per-relay health scoring (drives relay selection in pathDialer)
+	relayHealth *p2pnet.RelayHealth
+
 	// Path tracker for per-peer connection visibility
 	pathTracker *p2pnet.PathTracker
 
+	// Runtime event feed (GET /v1/events); shared with rt.network
+	events *p2pnet.EventFeed
+
 	// STUN prober for NAT type detection and external address discovery
 	stunProber *p2pnet.STUNProber
 
@@ -68,6 +94,10 @@ type serveRuntime struct {
 
 	// Sovereign per-peer interaction history
 	peerHistory *reputation.PeerHistory
+
+	// Per-service rate limits and quotas (quota usage persisted to disk)
+	bandwidth  *p2pnet.BandwidthManager
+	quotaStore *p2pnet.QuotaStore
 }
 
 // newServeRuntime creates a new serve runtime: loads config, creates P2P network,
@@ -129,7 +159,12 @@ func newServeRuntime(ctx context.Context, cancel context.CancelFunc, configFlag,
 		if err != nil {
 			return nil, fmt.Errorf("failed to load authorized_keys: %w", err)
 		}
+		roles, err := auth.LoadPeerRoles(authorizedKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load authorized_keys roles: %w", err)
+		}
 		rt.gater = auth.NewAuthorizedPeerGater(authorizedPeers)
+		rt.gater.UpdatePeerRoles(roles)
 	} else {
 		fmt.Println("WARNING: Connection gating is DISABLED - any peer can connect!")
 	}
@@ -145,8 +180,9 @@ func newServeRuntime(ctx context.Context, cancel context.CancelFunc, configFlag,
 		fmt.Println("Telemetry: audit logging enabled")
 	}
 
-	// Wire auth decision callback (metrics + audit)
-	if rt.gater != nil && (rt.metrics != nil || rt.audit != nil) {
+	// Wire auth decision callback (metrics + audit + event feed)
+	rt.events = p2pnet.NewEventFeed()
+	if rt.gater != nil {
 		rt.gater.SetDecisionCallback(func(peerID, result string) {
 			if rt.metrics != nil {
 				rt.metrics.AuthDecisionsTotal.WithLabelValues(result).Inc()
@@ -154,16 +190,22 @@ func newServeRuntime(ctx context.Context, cancel context.CancelFunc, configFlag,
 			if rt.audit != nil {
 				rt.audit.AuthDecision(peerID, "inbound", result)
 			}
+			rt.events.Publish(p2pnet.EventAuthDecision, peerID, map[string]any{
+				"direction": "inbound",
+				"result":    result,
+			})
 		})
 	}
 
 	// Create P2P network
 	netCfg := &p2pnet.Config{
 		KeyFile:            cfg.Identity.KeyFile,
+		KeyPassphrase:      keyPassphrase(cfg.Identity),
 		Gater:              rt.gater,
 		Config:             &config.Config{Network: cfg.Network},
 		UserAgent:          "peerup/" + ver,
 		Metrics:            rt.metrics,
+		Events:             rt.events,
 		EnableRelay:           true,
 		RelayAddrs:            cfg.Relay.Addresses,
 		ForcePrivate:          cfg.Network.ForcePrivateReachability,
@@ -178,6 +220,26 @@ func newServeRuntime(ctx context.Context, cancel context.CancelFunc, configFlag,
 	}
 	rt.network = net
 
+	// Warm streams for daemon proxies (POST /v1/connect)
+	if cfg.Proxy.StreamPool.Enabled {
+		net.EnableStreamPool(streamPoolConfig(cfg.Proxy.StreamPool), rt.metrics)
+	}
+
+	// Proxy sessions survive stream loss and move to direct paths on upgrade
+	if cfg.Proxy.SessionResume {
+		net.EnableSessionResume()
+	}
+
+	// Per-service bandwidth shaping and quotas (limits applied on expose)
+	quotaPath := filepath.Join(filepath.Dir(cfgFile), p2pnet.QuotaStoreFileName)
+	rt.quotaStore, err = p2pnet.NewQuotaStore(quotaPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load service quotas: %w", err)
+	}
+	rt.bandwidth = p2pnet.NewBandwidthManager(rt.quotaStore, rt.metrics, rt.audit)
+	net.SetBandwidthManager(rt.bandwidth)
+	net.SetAuditLogger(rt.audit)
+
 	// Load name mappings from config
 	if cfg.Names != nil {
 		if err := net.LoadNames(cfg.Names); err != nil {
@@ -195,6 +257,16 @@ func newServeRuntime(ctx context.Context, cancel context.CancelFunc, configFlag,
 	return rt, nil
 }
 
+// streamPoolConfig converts the YAML stream pool settings into a
+// p2pnet.StreamPoolConfig. Values were validated at load time.
+func streamPoolConfig(sc config.StreamPoolConfig) p2pnet.StreamPoolConfig {
+	idle, _ := time.ParseDuration(sc.IdleTimeout)
+	return p2pnet.StreamPoolConfig{
+		Size:        sc.Size,
+		IdleTimeout: idle,
+	}
+}
+
 // Bootstrap connects to relay servers, bootstraps the DHT, and starts
 // background advertising. This is the "bring the network up" step.
 func (rt *serveRuntime) Bootstrap() error {
@@ -371,8 +443,15 @@ func (rt *serveRuntime) Bootstrap() error {
 	// Initialize path dialer for parallel connection racing
 	rt.pathDialer = p2pnet.NewPathDialer(h, kdht, cfg.Relay.Addresses, rt.metrics)
 
+	// Probe each relay individually so dials race only the healthiest ones
+	rt.relayHealth = p2pnet.NewRelayHealth(h, cfg.Relay.Addresses, rt.metrics)
+	rt.pathDialer.SetRelayHealth(rt.relayHealth, 0)
+	go rt.relayHealth.Start(rt.ctx, 0)
+
 	// Initialize path tracker for per-peer connection visibility
 	rt.pathTracker = p2pnet.NewPathTracker(h, rt.metrics)
+	rt.pathTracker.SetEventFeed(rt.events)
+	rt.pathTracker.OnPathUpgrade(rt.network.HandlePathUpgrade)
 	go rt.pathTracker.Start(rt.ctx)
 
 	// Start network change monitor (event-driven on macOS/Linux, polling fallback)
@@ -404,6 +483,12 @@ func (rt *serveRuntime) Bootstrap() error {
 
 		fmt.Printf("Network change: +%d -%d IPs (ipv6=%v ipv4=%v)\n",
 			len(change.Added), len(change.Removed), change.IPv6Changed, change.IPv4Changed)
+		rt.events.Publish(p2pnet.EventNetworkChanged, "", map[string]any{
+			"added":        change.Added,
+			"removed":      change.Removed,
+			"ipv6_changed": change.IPv6Changed,
+			"ipv4_changed": change.IPv4Changed,
+		})
 
 		// Re-probe STUN on network change (external address may have changed)
 		if rt.stunProber != nil {
@@ -483,7 +568,11 @@ func (rt *serveRuntime) ExposeConfiguredServices() {
 	}
 	for name, svc := range rt.config.Services {
 		if svc.Enabled {
-			fmt.Printf("Exposing service: %s -> %s\n", name, svc.LocalAddress)
+			if svc.IsUDP() {
+				fmt.Printf("Exposing service: %s -> %s (udp)\n", name, svc.LocalAddress)
+			} else {
+				fmt.Printf("Exposing service: %s -> %s\n", name, svc.LocalAddress)
+			}
 
 			// Convert AllowedPeers string slice to peer.ID set
 			var allowedPeers map[peer.ID]struct{}
@@ -499,15 +588,115 @@ func (rt *serveRuntime) ExposeConfiguredServices() {
 				}
 				fmt.Printf("  ACL: %d allowed peers\n", len(allowedPeers))
 			}
+			rt.network.SetServiceAllowedRoles(name, svc.AllowedRoles)
+			if len(svc.AllowedRoles) > 0 {
+				fmt.Printf("  ACL: allowed roles %s\n", strings.Join(svc.AllowedRoles, ", "))
+			}
+
+			// Access rules must be in place before the service is reachable.
+			// A rule that fails to parse keeps the service closed.
+			rules, err := accessRulesFromConfig(svc.Access)
+			if err != nil {
+				log.Printf("Failed to expose service %s: %v", name, err)
+				continue
+			}
+			rt.network.SetServiceAccessRules(name, rules)
+			for _, rule := range rules {
+				fmt.Printf("  Access: %s\n", describeAccessRule(rule))
+			}
+
+			rt.network.SetServiceDescription(name, svc.Description)
 
-			if err := rt.network.ExposeService(name, svc.LocalAddress, allowedPeers); err != nil {
+			expose := rt.network.ExposeService
+			if svc.IsUDP() {
+				expose = rt.network.ExposeUDPService
+			}
+			if err := expose(name, svc.LocalAddress, allowedPeers); err != nil {
 				log.Printf("Failed to expose service %s: %v", name, err)
+				continue
+			}
+
+			perPeer, total, daily, monthly := config.ServiceLimitBytes(svc)
+			limits := p2pnet.ServiceLimits{PerPeerRate: perPeer, TotalRate: total, DailyQuota: daily, MonthlyQuota: monthly}
+			if !limits.IsZero() {
+				rt.bandwidth.SetLimits(name, limits)
+				if svc.RateLimit != nil {
+					fmt.Printf("  Rate limit: per_peer=%s total=%s\n", orUnlimited(svc.RateLimit.PerPeer), orUnlimited(svc.RateLimit.Total))
+				}
+				if svc.Quota != nil {
+					fmt.Printf("  Quota: daily=%s monthly=%s\n", orUnlimited(svc.Quota.Daily), orUnlimited(svc.Quota.Monthly))
+				}
 			}
 		}
 	}
 	fmt.Println()
 }
 
+// accessRulesFromConfig converts a service's access config into rules.
+func accessRulesFromConfig(access []config.ServiceAccess) ([]*p2pnet.AccessRule, error) {
+	var rules []*p2pnet.AccessRule
+	for i, a := range access {
+		rule := &p2pnet.AccessRule{}
+		if len(a.Peers) > 0 {
+			rule.Peers = make(map[peer.ID]struct{}, len(a.Peers))
+			for _, pidStr := range a.Peers {
+				pid, err := peer.Decode(pidStr)
+				if err != nil {
+					return nil, fmt.Errorf("access[%d]: invalid peer ID %q: %w", i, pidStr, err)
+				}
+				rule.Peers[pid] = struct{}{}
+			}
+		}
+		for _, spec := range a.Windows {
+			w, err := p2pnet.ParseAccessWindow(spec)
+			if err != nil {
+				return nil, fmt.Errorf("access[%d]: %w", i, err)
+			}
+			rule.Windows = append(rule.Windows, w)
+		}
+		if a.Timezone != "" {
+			loc, err := time.LoadLocation(a.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("access[%d]: %w", i, err)
+			}
+			rule.Location = loc
+		}
+		var err error
+		if a.NotBefore != "" {
+			if rule.NotBefore, err = time.Parse(time.RFC3339, a.NotBefore); err != nil {
+				return nil, fmt.Errorf("access[%d].not_before: %w", i, err)
+			}
+		}
+		if a.NotAfter != "" {
+			if rule.NotAfter, err = time.Parse(time.RFC3339, a.NotAfter); err != nil {
+				return nil, fmt.Errorf("access[%d].not_after: %w", i, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// describeAccessRule returns a one-line summary of who a rule covers and when.
+func describeAccessRule(rule *p2pnet.AccessRule) string {
+	who := "all peers"
+	switch n := len(rule.Peers); {
+	case n == 1:
+		who = "1 peer"
+	case n > 1:
+		who = fmt.Sprintf("%d peers", n)
+	}
+	return who + ", " + rule.String()
+}
+
+// orUnlimited returns s, or "unlimited" when s is empty.
+func orUnlimited(s string) string {
+	if s == "" {
+		return "unlimited"
+	}
+	return s
+}
+
 // SetupPingPong registers the ping-pong stream handler if enabled in config.
 func (rt *serveRuntime) SetupPingPong() {
 	if !rt.config.Protocols.PingPong.Enabled {
@@ -594,6 +783,12 @@ func (rt *serveRuntime) SetupPeerNotify() {
 		// Add each introduced peer to authorized_keys.
 		added := 0
 		for _, p := range peers {
+			// A stale introduction must not re-authorize a revoked peer.
+			if pid, err := peer.Decode(p.PeerID); err == nil && rt.revokes != nil && rt.revokes.Store.IsRevoked(pid) {
+				slog.Warn("peer-notify: skipped revoked peer",
+					"peer", p.PeerID[:16]+"...", "group", groupID)
+				continue
+			}
 			comment := p.Name
 			if comment == "" {
 				comment = "introduced-" + time.Now().Format("2006-01-02")
@@ -646,17 +841,804 @@ func (rt *serveRuntime) SetupPeerNotify() {
 
 		// Hot-reload gater so new peers are immediately allowed.
 		if added > 0 && rt.gater != nil {
-			newPeers, err := auth.LoadAuthorizedKeys(rt.authKeys)
-			if err != nil {
+			if err := rt.reloadGater(); err != nil {
 				slog.Error("peer-notify: gater reload failed", "err", err)
 			} else {
-				rt.gater.UpdateAuthorizedPeers(newPeers)
-				slog.Info("peer-notify: gater reloaded", "peers", len(newPeers))
+				slog.Info("peer-notify: gater reloaded", "peers", rt.gater.GetAuthorizedPeersCount())
 			}
 		}
 	})
 }
 
+// reloadGater re-reads authorized_keys into the live connection gater and
+// closes reverse tunnels of peers that lost access. No-op when connection
+// gating is disabled.
+func (rt *serveRuntime) reloadGater() error {
+	if rt.gater == nil {
+		return nil
+	}
+	peers, err := auth.LoadAuthorizedKeys(rt.authKeys)
+	if err != nil {
+		return err
+	}
+	roles, err := auth.LoadPeerRoles(rt.authKeys)
+	if err != nil {
+		return err
+	}
+	rt.gater.UpdateAuthorizedPeers(peers)
+	rt.gater.UpdatePeerRoles(roles)
+	rt.tunnels.Recheck()
+	return nil
+}
+
+// SetupKeyRotation registers the key-rotation stream handler. An
+// authorized peer that rotates its identity key sends a statement signed
+// by both keys over its old identity; the daemon verifies it, moves the
+// authorized_keys entry, names and service ACLs to the new peer ID, and
+// reloads the gater.
+func (rt *serveRuntime) SetupKeyRotation() {
+	if rt.authKeys == "" {
+		return // no authorized_keys = no gating = nothing to update
+	}
+
+	h := rt.network.Host()
+	h.SetStreamHandler(protocol.ID(p2pnet.KeyRotationProtocol), func(s network.Stream) {
+		defer s.Close()
+		remotePeer := s.Conn().RemotePeer()
+		s.SetDeadline(time.Now().Add(30 * time.Second))
+
+		kr, err := p2pnet.ReadKeyRotation(s)
+		if err == nil {
+			err = rt.applyKeyRotation(remotePeer, kr)
+		}
+		oldStr, newStr := "", ""
+		if kr != nil {
+			oldStr, newStr = kr.OldPeerID, kr.NewPeerID
+		}
+		if err != nil {
+			slog.Warn("key-rotation: rejected", "peer", remotePeer.String()[:16]+"...", "err", err)
+			rt.audit.KeyRotation("rejected", oldStr, newStr, remotePeer.String(), err.Error())
+		} else {
+			slog.Info("key-rotation: peer moved to new identity",
+				"old", oldStr[:16]+"...", "new", newStr[:16]+"...")
+			rt.audit.KeyRotation("applied", oldStr, newStr, remotePeer.String(), "")
+			rt.events.Publish(p2pnet.EventPeerKeyRotated, oldStr, map[string]any{"new_peer": newStr})
+		}
+		p2pnet.WriteKeyRotationReply(s, err)
+	})
+}
+
+// applyKeyRotation verifies a rotation statement received from remotePeer
+// and moves every local reference from the old peer ID to the new one.
+func (rt *serveRuntime) applyKeyRotation(remotePeer peer.ID, kr *p2pnet.KeyRotation) error {
+	oldID, newID, err := kr.Verify(time.Now())
+	if err != nil {
+		return err
+	}
+	// The statement must arrive over the old identity's own connection, so
+	// a third party cannot replay it to redirect someone else's entry.
+	if remotePeer != oldID {
+		return fmt.Errorf("%w: sender is not the old peer ID", p2pnet.ErrInvalidKeyRotation)
+	}
+	if rt.gater != nil && !rt.gater.IsAuthorized(oldID) {
+		return fmt.Errorf("%w: old peer ID is not authorized", p2pnet.ErrInvalidKeyRotation)
+	}
+
+	if err := auth.ReplacePeerID(rt.authKeys, oldID, newID); err != nil {
+		return fmt.Errorf("failed to update authorized_keys: %w", err)
+	}
+	if err := rt.reloadGater(); err != nil {
+		return fmt.Errorf("failed to reload gater: %w", err)
+	}
+
+	// Names and per-service allowed_peers follow the peer to its new ID,
+	// both live and in the config file for the next restart.
+	for name, pid := range rt.network.ListNames() {
+		if pid == oldID {
+			rt.network.RegisterName(name, newID)
+		}
+	}
+	rt.network.ReplaceAllowedPeer(oldID, newID)
+	if err := replaceConfigPeerID(rt.configFile, oldID.String(), newID.String()); err != nil {
+		slog.Warn("key-rotation: config not updated", "err", err)
+	}
+	return nil
+}
+
+// SetupRevocations registers the revocation gossip handler. Signed notices
+// from members of a shared pairing group remove the revoked peer from
+// authorized_keys, are stored in revocations.json next to it, and are
+// passed on to the rest of the group; stored notices are replayed to group
+// members (and relays) whenever they connect.
+func (rt *serveRuntime) SetupRevocations() error {
+	if rt.authKeys == "" {
+		return nil // no authorized_keys = no gating = nothing to revoke
+	}
+
+	store, err := auth.OpenRevocationStore(auth.RevocationsPath(rt.authKeys))
+	if err != nil {
+		return err
+	}
+	h := rt.network.Host()
+	rt.revokes = &relay.RevocationGossip{
+		Host:         h,
+		AuthKeysPath: rt.authKeys,
+		Store:        store,
+		OnApplied: func(from peer.ID, r *auth.Revocation, removed bool) {
+			action := "applied"
+			if from == h.ID() {
+				action = "issued"
+			}
+			slog.Info("revocation: "+action,
+				"peer", r.PeerID[:16]+"...", "group", r.Group,
+				"issuer", r.Issuer[:16]+"...", "removed", removed)
+			rt.audit.Revocation(action, r.PeerID, r.Group, r.Issuer, from.String(), r.Reason)
+			rt.events.Publish(p2pnet.EventPeerRevoked, r.PeerID, map[string]any{
+				"group":  r.Group,
+				"issuer": r.Issuer,
+				"reason": r.Reason,
+			})
+			if removed {
+				if err := rt.reloadGater(); err != nil {
+					slog.Error("revocation: gater reload failed", "err", err)
+				}
+			}
+		},
+		OnRejected: func(from peer.ID, r *auth.Revocation, err error) {
+			slog.Warn("revocation: rejected", "from", from.String()[:16]+"...", "err", err)
+			rt.audit.Revocation("rejected", r.PeerID, r.Group, r.Issuer, from.String(), err.Error())
+		},
+	}
+	h.SetStreamHandler(protocol.ID(relay.RevocationProtocol), rt.revokes.HandleStream)
+	go rt.revokes.Run(rt.ctx)
+	return nil
+}
+
+// Revoke signs a revocation of p with this node's key for p's pairing
+// group, applies it locally and gossips it to the connected members.
+func (rt *serveRuntime) Revoke(ctx context.Context, p peer.ID, reason string) (*auth.Revocation, bool, []peer.ID, error) {
+	group, err := auth.PeerGroup(rt.authKeys, p)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	h := rt.network.Host()
+	r, err := auth.NewRevocation(h.Peerstore().PrivKey(h.ID()), group, p, reason, time.Now())
+	if err != nil {
+		return nil, false, nil, err
+	}
+	removed, delivered, err := rt.revokes.Issue(ctx, r)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	return r, removed, delivered, nil
+}
+
+// SetupAsyncInvites opens pending_invites.json and registers the relay
+// mailbox handler. Relays deliver redeemed asynchronous invites on it the
+// next time this daemon connects; each reply is opened with the key kept
+// for its invite and the joiner is authorized.
+func (rt *serveRuntime) SetupAsyncInvites() error {
+	if rt.authKeys == "" || len(rt.config.Relay.Addresses) == 0 {
+		return nil
+	}
+	store, err := invite.OpenPendingStore(filepath.Join(filepath.Dir(rt.configFile), invite.PendingFileName))
+	if err != nil {
+		return err
+	}
+	rt.invites = store
+	rt.network.Host().SetStreamHandler(protocol.ID(relay.MailboxProtocol), rt.handleMailboxDelivery)
+	return nil
+}
+
+// handleMailboxDelivery accepts redeemed invites from a configured relay
+// and acknowledges the ones it is done with, so the relay forgets them.
+func (rt *serveRuntime) handleMailboxDelivery(s network.Stream) {
+	defer s.Close()
+	remotePeer := s.Conn().RemotePeer()
+
+	if !rt.isConfiguredRelay(remotePeer) {
+		slog.Warn("mailbox: rejected delivery from non-relay",
+			"peer", remotePeer.String()[:16]+"...")
+		return
+	}
+	deliveries, err := relay.ReadMailboxDelivery(s)
+	if err != nil {
+		slog.Warn("mailbox: parse error", "err", err)
+		return
+	}
+
+	acks := make(map[string]bool)
+	for _, d := range deliveries {
+		if done, accepted := rt.acceptInvite(remotePeer, d); done {
+			acks[d.ID] = accepted
+		}
+	}
+	if err := relay.WriteMailboxAck(s, acks); err != nil {
+		slog.Warn("mailbox: acknowledgement failed", "err", err)
+	}
+}
+
+// acceptInvite completes one redeemed invite. done is false only for a
+// local failure worth retrying on the next delivery; replies for unknown
+// invites and replies that do not open are dropped. accepted tells the
+// relay whether to authorize the joiner.
+func (rt *serveRuntime) acceptInvite(from peer.ID, d relay.MailboxDelivery) (done, accepted bool) {
+	p, ok := rt.invites.Get(d.ID)
+	if !ok {
+		slog.Warn("mailbox: reply for unknown invite", "invite", d.ID[:8])
+		return true, false
+	}
+
+	reply, err := invite.OpenReply(p.Token, p.PrivateKey, d.Reply)
+	if err == nil && reply.PeerID != d.Joiner {
+		err = fmt.Errorf("reply is for %s but was redeemed by %s", reply.PeerID, d.Joiner)
+	}
+	if err == nil && rt.revokes != nil && rt.revokes.Store.IsRevoked(reply.PeerID) {
+		err = fmt.Errorf("joiner has been revoked")
+	}
+	if err != nil {
+		slog.Warn("mailbox: invite reply rejected",
+			"invite", d.ID[:8], "joiner", d.Joiner.String()[:16]+"...", "err", err)
+		rt.audit.Invite("rejected", d.ID, d.Joiner.String(), from.String(), err.Error())
+		return true, false
+	}
+
+	joiner := reply.PeerID.String()
+	name := sanitizeYAMLName(reply.Name)
+	comment := name
+	if comment == "" {
+		comment = "invited-" + time.Now().Format("2006-01-02")
+	}
+	if err := auth.AddPeer(rt.authKeys, joiner, comment); err != nil && !errors.Is(err, auth.ErrPeerAlreadyAuthorized) {
+		slog.Error("mailbox: add failed", "peer", joiner[:16]+"...", "err", err)
+		return false, false
+	}
+	if name != "" {
+		updateConfigNames(rt.configFile, filepath.Dir(rt.configFile), name, joiner)
+		rt.network.RegisterName(name, reply.PeerID)
+	}
+	if err := rt.reloadGater(); err != nil {
+		slog.Error("mailbox: gater reload failed", "err", err)
+	}
+	if _, err := rt.invites.Remove(d.ID); err != nil {
+		slog.Warn("mailbox: failed to remove pending invite", "invite", d.ID[:8], "err", err)
+	}
+
+	if rt.peerHistory != nil {
+		rt.peerHistory.RecordIntroduction(joiner, from.String(), "async-invite")
+	}
+	rt.audit.Invite("accepted", d.ID, joiner, from.String(), reply.Name)
+	rt.events.Publish(p2pnet.EventPeerInvited, joiner, map[string]any{
+		"invite": d.ID,
+		"name":   name,
+		"relay":  from.String(),
+	})
+	slog.Info("mailbox: invite accepted",
+		"name", name, "peer", joiner[:16]+"...",
+		"invite", d.ID[:8], "relay", from.String()[:16]+"...")
+
+	// The other relays still hold the introduction; take it back.
+	go func() {
+		ctx, cancel := context.WithTimeout(rt.ctx, 30*time.Second)
+		defer cancel()
+		rt.withdrawInvite(ctx, p, from)
+	}()
+	return true, true
+}
+
+// CreateInvite seals an introduction for whoever holds the new code and
+// deposits it at every reachable relay. The token and the reply key stay in
+// pending_invites.json until the joiner's reply is delivered.
+func (rt *serveRuntime) CreateInvite(ctx context.Context, name string, ttl time.Duration) (*daemon.InviteInfo, error) {
+	if ttl > relay.MaxMailboxTTL {
+		return nil, fmt.Errorf("invite lifetime %s exceeds the relay limit of %s", ttl, relay.MaxMailboxTTL)
+	}
+	token, err := invite.GenerateMailboxToken()
+	if err != nil {
+		return nil, err
+	}
+	priv, pub, err := invite.GenerateMailboxKey()
+	if err != nil {
+		return nil, err
+	}
+	h := rt.network.Host()
+	sealed, err := invite.SealIntro(token, &invite.MailboxIntro{
+		PeerID:    h.ID(),
+		Name:      name,
+		Network:   rt.config.Discovery.Network,
+		PublicKey: pub,
+	})
+	if err != nil {
+		return nil, err
+	}
+	relayInfos, err := p2pnet.ParseRelayAddrs(rt.config.Relay.Addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deposit everywhere we can; the code lists the relays that took it.
+	id := invite.MailboxID(token)
+	now := time.Now()
+	var held, codeAddrs []string
+	var lastErr error
+	for _, ai := range relayInfos {
+		err := h.Connect(ctx, ai)
+		if err == nil {
+			err = relay.DepositMailbox(ctx, h, ai.ID, id, sealed, ttl)
+		}
+		if err != nil {
+			slog.Warn("mailbox: deposit failed", "relay", ai.ID.String()[:16]+"...", "err", err)
+			lastErr = fmt.Errorf("relay %s: %w", ai.ID.String()[:16]+"...", err)
+			continue
+		}
+		for _, addr := range rt.config.Relay.Addresses {
+			if a, err := peer.AddrInfoFromString(addr); err != nil || a.ID != ai.ID {
+				continue
+			}
+			held = append(held, addr)
+			if invite.ValidateV3RelayAddr(addr) == nil {
+				codeAddrs = append(codeAddrs, addr)
+			}
+		}
+	}
+	if len(held) == 0 {
+		return nil, fmt.Errorf("no relay accepted the invite: %w", lastErr)
+	}
+
+	p := invite.PendingInvite{
+		Token:      token,
+		PrivateKey: priv,
+		Name:       name,
+		Relays:     held,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	code, err := invite.EncodeMailbox(token, codeAddrs, rt.config.Discovery.Network, p.ExpiresAt)
+	if err == nil {
+		err = rt.invites.Add(p)
+	}
+	if err != nil {
+		rt.withdrawInvite(ctx, p, "")
+		return nil, err
+	}
+
+	p, _ = rt.invites.Get(hex.EncodeToString(id[:]))
+	info := pendingInviteInfo(p)
+	info.Code = code
+	rt.audit.Invite("created", p.ID, "", strings.Join(info.Relays, ","), name)
+	return &info, nil
+}
+
+// Invites lists the pending asynchronous invites.
+func (rt *serveRuntime) Invites() []daemon.InviteInfo {
+	out := []daemon.InviteInfo{}
+	for _, p := range rt.invites.List() {
+		out = append(out, pendingInviteInfo(p))
+	}
+	return out
+}
+
+// CancelInvite forgets a pending invite and removes its introduction from
+// the relays that are reachable now. Relays drop the rest at expiry.
+func (rt *serveRuntime) CancelInvite(ctx context.Context, id string) error {
+	p, ok := rt.invites.Get(id)
+	if !ok || time.Now().After(p.ExpiresAt) {
+		return fmt.Errorf("%w: %s", daemon.ErrInviteNotFound, id)
+	}
+	if _, err := rt.invites.Remove(id); err != nil {
+		return err
+	}
+	rt.withdrawInvite(ctx, p, "")
+	rt.audit.Invite("cancelled", id, "", "", "")
+	return nil
+}
+
+// withdrawInvite removes an invite's introduction from its relays, except
+// skip. Failures are logged only: the relays forget it at expiry anyway.
+func (rt *serveRuntime) withdrawInvite(ctx context.Context, p invite.PendingInvite, skip peer.ID) {
+	relayInfos, err := p2pnet.ParseRelayAddrs(p.Relays)
+	if err != nil {
+		return
+	}
+	h := rt.network.Host()
+	id := invite.MailboxID(p.Token)
+	for _, ai := range relayInfos {
+		if ai.ID == skip {
+			continue
+		}
+		err := h.Connect(ctx, ai)
+		if err == nil {
+			err = relay.CancelMailbox(ctx, h, ai.ID, id)
+		}
+		if err != nil && !errors.Is(err, relay.ErrMailboxNotFound) {
+			slog.Debug("mailbox: withdraw failed", "relay", ai.ID.String()[:16]+"...", "err", err)
+		}
+	}
+}
+
+// pendingInviteInfo converts a pending invite for the daemon API.
+func pendingInviteInfo(p invite.PendingInvite) daemon.InviteInfo {
+	info := daemon.InviteInfo{
+		ID:      p.ID,
+		Name:    p.Name,
+		Relays:  []string{},
+		Created: p.CreatedAt.UTC().Format(time.RFC3339),
+		Expires: p.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if relayInfos, err := p2pnet.ParseRelayAddrs(p.Relays); err == nil {
+		for _, ai := range relayInfos {
+			info.Relays = append(info.Relays, ai.ID.String())
+		}
+	}
+	return info
+}
+
+// StartLANDiscovery announces this node on the local network and dials
+// authorized peers found there when discovery.mdns is set. Call after
+// Bootstrap so the path tracker sees the resulting LAN connections.
+func (rt *serveRuntime) StartLANDiscovery() {
+	if !rt.config.Discovery.MDNS || rt.gater == nil {
+		return
+	}
+	lan := p2pnet.NewLANDiscovery(rt.network.Host(), rt.config.Discovery.Network, rt.gater.IsAuthorized, rt.metrics)
+	if err := lan.Start(); err != nil {
+		fmt.Printf("Warning: LAN discovery failed to start: %v\n", err)
+		return
+	}
+	rt.lan = lan
+	if rt.pathTracker != nil {
+		rt.pathTracker.SetLANDiscovery(lan)
+	}
+	fmt.Printf("LAN discovery: mDNS (%s)\n", p2pnet.LANServiceName(rt.config.Discovery.Network))
+}
+
+// StartNameServer starts the local name server when dns.enabled is set.
+// Peer names resolve to a per-peer loopback address; the dns.ports
+// proxies for a peer are opened the first time its name is resolved.
+func (rt *serveRuntime) StartNameServer() {
+	if !rt.config.DNS.Enabled {
+		return
+	}
+	rt.dnsProxies = make(map[peer.ID][]*p2pnet.TCPListener)
+	ns := p2pnet.NewNameServer(rt.config.DNS.Domain, rt.network.ListNames, rt.openDNSProxies, rt.metrics)
+	if err := ns.Start(rt.config.DNS.Listen); err != nil {
+		fmt.Printf("Warning: name server failed to start: %v\n", err)
+		return
+	}
+	rt.nameServer = ns
+	fmt.Printf("Name server: *.%s on %s\n", rt.config.DNS.Domain, ns.Addr())
+}
+
+// openDNSProxies opens a TCP proxy on ip for each service in dns.ports,
+// once per peer. Each proxy connects to the peer on first use, so
+// resolving a name costs nothing until something connects.
+func (rt *serveRuntime) openDNSProxies(p peer.ID, ip net.IP) {
+	rt.dnsMu.Lock()
+	defer rt.dnsMu.Unlock()
+	if _, ok := rt.dnsProxies[p]; ok {
+		return
+	}
+
+	listeners := []*p2pnet.TCPListener{}
+	for service, port := range rt.config.DNS.Ports {
+		dial := p2pnet.DialWithRetry(rt.network.ServiceDialFunc(p, service), 3)
+		addr := net.JoinHostPort(ip.String(), fmt.Sprint(port))
+		l, err := p2pnet.NewTCPListener(addr, func() (p2pnet.ServiceConn, error) {
+			ctx, cancel := context.WithTimeout(rt.ctx, 30*time.Second)
+			err := rt.ensureConnected(ctx, p)
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+			return dial()
+		})
+		if err != nil {
+			slog.Warn("dns: proxy listen failed", "service", service, "addr", addr, "err", err)
+			continue
+		}
+		go l.Serve()
+		listeners = append(listeners, l)
+		slog.Info("dns: proxy opened", "peer", p.String()[:16]+"...", "service", service, "listen", addr)
+	}
+	rt.dnsProxies[p] = listeners
+}
+
+// StartMeshProxy starts the local SOCKS5 / HTTP CONNECT proxy when
+// proxy.socks.enabled is set. Destinations use the dns.domain names and
+// dns.ports map, so both front doors agree on what "nas.peerup:22" means.
+func (rt *serveRuntime) StartMeshProxy() {
+	if !rt.config.Proxy.SOCKS.Enabled {
+		return
+	}
+	portServices := make(map[int]string, len(rt.config.DNS.Ports))
+	for service, port := range rt.config.DNS.Ports {
+		portServices[port] = service
+	}
+	mp := &p2pnet.MeshProxy{
+		Domain:       rt.config.DNS.Domain,
+		PortServices: portServices,
+		Resolve:      rt.network.ResolveName,
+		Dial: func(ctx context.Context, p peer.ID, service string) (p2pnet.ServiceConn, error) {
+			if err := rt.ensureConnected(ctx, p); err != nil {
+				return nil, err
+			}
+			return rt.network.ConnectToServiceContext(ctx, p, service)
+		},
+		Metrics: rt.metrics,
+	}
+	if err := mp.Start(rt.ctx, rt.config.Proxy.SOCKS.Listen); err != nil {
+		fmt.Printf("Warning: SOCKS proxy failed to start: %v\n", err)
+		return
+	}
+	rt.meshProxy = mp
+	fmt.Printf("SOCKS5/HTTP proxy: %s (*.%s)\n", mp.Addr(), rt.config.DNS.Domain)
+}
+
+// SetupReverseTunnels registers the reverse tunnel handlers. Every node can
+// open tunnels on peers that allow it; this node only listens for peers
+// named in reverse_tunnels.allow, on the addresses listed there.
+func (rt *serveRuntime) SetupReverseTunnels() {
+	var allowed func(peer.ID, string) bool
+	if rt.gater != nil && len(rt.config.ReverseTunnels.Allow) > 0 {
+		rules := make(map[peer.ID][]string, len(rt.config.ReverseTunnels.Allow))
+		for id, listens := range rt.config.ReverseTunnels.Allow {
+			p, err := peer.Decode(id)
+			if err != nil {
+				slog.Warn("reverse tunnels: ignoring invalid peer ID", "peer", id, "err", err)
+				continue
+			}
+			rules[p] = listens
+		}
+		allowed = func(p peer.ID, listen string) bool {
+			if !rt.gater.IsAuthorized(p) {
+				return false
+			}
+			for _, rule := range rules[p] {
+				if p2pnet.MatchListenRule(rule, listen) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	rt.tunnels = p2pnet.NewReverseTunnels(rt.network.Host(), allowed, rt.events, rt.metrics)
+}
+
+// ensureConnected dials p unless a connection is already open.
+func (rt *serveRuntime) ensureConnected(ctx context.Context, p peer.ID) error {
+	if rt.network.Host().Network().Connectedness(p) == network.Connected {
+		return nil
+	}
+	return rt.ConnectToPeer(ctx, p)
+}
+
+// SetupDirectory opens directory.json and registers the directory sync
+// handler when directory.enabled is set. Syncing starts with
+// StartDirectorySync once the configured services are exposed.
+func (rt *serveRuntime) SetupDirectory() error {
+	if !rt.config.Directory.Enabled || rt.gater == nil {
+		return nil
+	}
+
+	dir, err := p2pnet.OpenDirectory(filepath.Join(filepath.Dir(rt.configFile), p2pnet.DirectoryFileName))
+	if err != nil {
+		return err
+	}
+	h := rt.network.Host()
+	rt.directory = &p2pnet.DirectorySync{
+		Host:       h,
+		Directory:  dir,
+		Authorized: rt.gater.IsAuthorized,
+		OnUpdate: func(from peer.ID, updated []*p2pnet.DirectoryRecord) {
+			origins := make([]string, 0, len(updated))
+			for _, r := range updated {
+				origins = append(origins, r.Origin)
+			}
+			slog.Info("directory: merged records", "from", from.String()[:16]+"...", "records", len(updated))
+			rt.events.Publish(p2pnet.EventDirectoryUpdated, from.String(), map[string]any{"origins": origins})
+			rt.applyDirectoryNames()
+		},
+	}
+
+	// Config names are registered at startup and stay in charge of their
+	// names; the merged view only adds the rest.
+	rt.dirNames = make(map[string]peer.ID)
+	rt.dirLocal = rt.config.Names
+	h.SetStreamHandler(protocol.ID(p2pnet.DirectoryProtocol), rt.directory.HandleStream)
+	return nil
+}
+
+// StartDirectorySync publishes this node's record, applies the merged
+// names and syncs with authorized peers as they connect and every
+// directory.sync_interval.
+func (rt *serveRuntime) StartDirectorySync() {
+	if rt.directory == nil {
+		return
+	}
+	if _, err := rt.publishDirectory(); err != nil {
+		slog.Error("directory: publish failed", "err", err)
+	}
+	rt.applyDirectoryNames()
+	go rt.directory.Run(rt.ctx)
+
+	interval, err := time.ParseDuration(rt.config.Directory.SyncInterval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rt.ctx.Done():
+				return
+			case <-ticker.C:
+				if _, _, err := rt.SyncDirectory(rt.ctx, ""); err != nil {
+					slog.Warn("directory: periodic sync failed", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// publishDirectory signs a new record if this node's names (re-read from
+// the config file, so edits apply without a restart) or exposed services
+// changed since the last one.
+func (rt *serveRuntime) publishDirectory() (bool, error) {
+	names := rt.config.Names
+	if cfg, err := config.LoadNodeConfig(rt.configFile); err == nil {
+		names = cfg.Names
+	} else {
+		slog.Warn("directory: using startup names", "err", err)
+	}
+	rt.dirMu.Lock()
+	rt.dirLocal = names
+	rt.dirMu.Unlock()
+
+	// The signed record reaches every authorized peer, so services limited
+	// to some peers or hours stay out of it; those peers find them with a
+	// service query, which filters per peer.
+	var services []p2pnet.DirectoryService
+	for _, svc := range rt.network.ListServices() {
+		if !svc.Enabled || rt.network.IsServiceRestricted(svc) {
+			continue
+		}
+		ds := p2pnet.DirectoryService{Name: svc.Name}
+		if svc.IsUDP() {
+			ds.Protocol = p2pnet.ServiceTransportUDP
+		}
+		services = append(services, ds)
+	}
+
+	h := rt.network.Host()
+	_, published, err := rt.directory.Directory.Publish(h.Peerstore().PrivKey(h.ID()), names, services, time.Now())
+	return published, err
+}
+
+// applyDirectoryNames registers the merged directory names with the name
+// resolver and drops the ones it registered that left the merged view.
+// Names in the config file always win: a record from another origin, even
+// with a higher clock, never rebinds or removes them.
+func (rt *serveRuntime) applyDirectoryNames() {
+	rt.dirMu.Lock()
+	defer rt.dirMu.Unlock()
+
+	current := make(map[string]peer.ID)
+	for _, e := range rt.directory.Directory.Names() {
+		if _, local := rt.dirLocal[e.Name]; local {
+			continue
+		}
+		current[e.Name] = e.PeerID
+		if rt.dirNames[e.Name] != e.PeerID {
+			rt.network.RegisterName(e.Name, e.PeerID)
+		}
+	}
+	for name := range rt.dirNames {
+		_, kept := current[name]
+		_, local := rt.dirLocal[name]
+		if !kept && !local {
+			rt.network.UnregisterName(name)
+		}
+	}
+	rt.dirNames = current
+
+	// Restores config bindings a directory name held before it was added
+	// to the file, and picks up names added since startup.
+	if err := rt.network.LoadNames(rt.dirLocal); err != nil {
+		slog.Warn("directory: failed to apply config names", "err", err)
+	}
+}
+
+// DirectoryNames returns the merged name view.
+func (rt *serveRuntime) DirectoryNames() []p2pnet.DirectoryEntry {
+	return rt.directory.Directory.Names()
+}
+
+// DirectoryServices returns the services advertised by every origin.
+func (rt *serveRuntime) DirectoryServices() []p2pnet.DirectoryServiceEntry {
+	return rt.directory.Directory.Services()
+}
+
+// SyncDirectory publishes local changes, drops records from origins that
+// are no longer authorized, then syncs with p (connecting first) or, if p
+// is empty, with every connected authorized peer.
+func (rt *serveRuntime) SyncDirectory(ctx context.Context, p peer.ID) (bool, []p2pnet.DirectorySyncResult, error) {
+	published, err := rt.publishDirectory()
+	if err != nil {
+		return false, nil, err
+	}
+	self := rt.network.Host().ID()
+	if _, err := rt.directory.Directory.Prune(func(origin peer.ID) bool {
+		return origin == self || rt.gater.IsAuthorized(origin)
+	}); err != nil {
+		return published, nil, err
+	}
+	defer rt.applyDirectoryNames()
+
+	if p == "" {
+		return published, rt.directory.SyncAll(ctx), nil
+	}
+	if !rt.gater.IsAuthorized(p) {
+		return published, nil, fmt.Errorf("%w: %s", auth.ErrPeerNotFound, p.String()[:16]+"...")
+	}
+	if err := rt.ConnectToPeer(ctx, p); err != nil {
+		return published, []p2pnet.DirectorySyncResult{{Peer: p, Err: err}}, nil
+	}
+	n, err := rt.directory.SyncPeer(ctx, p)
+	return published, []p2pnet.DirectorySyncResult{{Peer: p, Updated: n, Err: err}}, nil
+}
+
+// replaceConfigPeerID rewrites every occurrence of oldID in the config file
+// (names and allowed_peers) as newID. Text replacement keeps comments and
+// formatting; peer IDs are long enough that a false match is impossible.
+func replaceConfigPeerID(cfgFile, oldID, newID string) error {
+	if cfgFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	if !strings.Contains(content, oldID) {
+		return nil
+	}
+	return atomicWriteFile(cfgFile, []byte(strings.ReplaceAll(content, oldID, newID)))
+}
+
+// atomicWriteFile replaces path with data via temp file + fsync + rename, so
+// a crash mid-write never leaves a truncated config behind.
+func atomicWriteFile(path string, data []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempPath := tempFile.Name()
+
+	if err := tempFile.Chmod(0600); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	tempFile.Close()
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to update file: %w", err)
+	}
+	return nil
+}
+
 // isConfiguredRelay checks if a peer ID matches one of the configured relay addresses.
 func (rt *serveRuntime) isConfiguredRelay(p peer.ID) bool {
 	for _, addr := range rt.config.Relay.Addresses {
@@ -902,6 +1884,28 @@ func (rt *serveRuntime) StartPeerHistorySaver() {
 	}()
 }
 
+// StartQuotaSaver runs a background goroutine that periodically saves
+// service quota usage to disk.
+func (rt *serveRuntime) StartQuotaSaver() {
+	if rt.quotaStore == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-rt.ctx.Done():
+				return
+			case <-ticker.C:
+				if err := rt.quotaStore.Save(); err != nil {
+					slog.Warn("quota: save failed", "err", err)
+				}
+			}
+		}
+	}()
+}
+
 // Shutdown cancels the context, stops the metrics server, disables the peer relay,
 // and closes the P2P network.
 func (rt *serveRuntime) Shutdown() {
@@ -911,9 +1915,33 @@ func (rt *serveRuntime) Shutdown() {
 			slog.Warn("peer-history: final save failed", "err", err)
 		}
 	}
+	if rt.quotaStore != nil {
+		if err := rt.quotaStore.Save(); err != nil {
+			slog.Warn("quota: final save failed", "err", err)
+		}
+	}
 	if rt.peerRelay != nil {
 		rt.peerRelay.Disable()
 	}
+	if rt.lan != nil {
+		rt.lan.Close()
+	}
+	if rt.meshProxy != nil {
+		rt.meshProxy.Close()
+	}
+	if rt.tunnels != nil {
+		rt.tunnels.CloseAll()
+	}
+	if rt.nameServer != nil {
+		rt.nameServer.Close()
+		rt.dnsMu.Lock()
+		for _, listeners := range rt.dnsProxies {
+			for _, l := range listeners {
+				l.Close()
+			}
+		}
+		rt.dnsMu.Unlock()
+	}
 	if rt.metricsServer != nil {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 3*time.Second)
 		rt.metricsServer.Shutdown(shutdownCtx)
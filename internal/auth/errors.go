@@ -13,4 +13,23 @@ var (
 
 	// ErrInvalidPeerID is returned when a peer ID string cannot be decoded.
 	ErrInvalidPeerID = errors.New("invalid peer ID")
+
+	// ErrRoleAlreadyAssigned is returned when adding a role a peer already has.
+	ErrRoleAlreadyAssigned = errors.New("role already assigned")
+
+	// ErrRoleNotAssigned is returned when removing a role a peer doesn't have.
+	ErrRoleNotAssigned = errors.New("role not assigned")
+
+	// ErrInvalidRevocation is returned when a revocation notice is malformed
+	// or its signature does not verify.
+	ErrInvalidRevocation = errors.New("invalid revocation")
+
+	// ErrRevocationNotAllowed is returned when a valid revocation notice
+	// may not be applied locally (issuer not in the group, revoked peer not
+	// listed locally or outside the group, or the store is full).
+	ErrRevocationNotAllowed = errors.New("revocation not allowed")
+
+	// ErrNoPairingGroup is returned when revoking a peer that has no group=
+	// attribute, so there is no group to propagate the revocation to.
+	ErrNoPairingGroup = errors.New("peer is not a pairing group member")
 )
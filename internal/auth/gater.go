@@ -3,6 +3,7 @@ package auth
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,8 +13,8 @@ import (
 	"github.com/multiformats/go-multiaddr"
 )
 
-// AuthDecisionFunc is called on every inbound auth decision with the peer ID
-// (truncated) and result ("allow" or "deny"). Used for metrics and audit logging
+// AuthDecisionFunc is called on every inbound auth decision with the full
+// peer ID and result ("allow" or "deny"). Used for metrics and audit logging
 // without creating a circular dependency on pkg/p2pnet.
 type AuthDecisionFunc func(peerID, result string)
 
@@ -23,6 +24,7 @@ type AuthDecisionFunc func(peerID, result string)
 type AuthorizedPeerGater struct {
 	authorizedPeers map[peer.ID]bool
 	peerExpiry      map[peer.ID]time.Time // zero = never expires
+	peerRoles       map[peer.ID][]string  // role= attribute from authorized_keys
 	onDecision      AuthDecisionFunc      // nil-safe
 	mu              sync.RWMutex
 
@@ -38,6 +40,7 @@ func NewAuthorizedPeerGater(authorizedPeers map[peer.ID]bool) *AuthorizedPeerGat
 	return &AuthorizedPeerGater{
 		authorizedPeers: authorizedPeers,
 		peerExpiry:      make(map[peer.ID]time.Time),
+		peerRoles:       make(map[peer.ID][]string),
 		probationPeers:  make(map[peer.ID]time.Time),
 		probationLimit:  10,
 		probationTimeout: 15 * time.Second,
@@ -81,13 +84,13 @@ func (g *AuthorizedPeerGater) InterceptSecured(dir network.Direction, p peer.ID,
 		if exp, ok := g.peerExpiry[p]; ok && !exp.IsZero() && time.Now().After(exp) {
 			slog.Warn("inbound connection denied (expired)", "peer", short)
 			if g.onDecision != nil {
-				g.onDecision(short, "deny")
+				g.onDecision(p.String(), "deny")
 			}
 			return false
 		}
 		slog.Info("inbound connection allowed", "peer", short)
 		if g.onDecision != nil {
-			g.onDecision(short, "allow")
+			g.onDecision(p.String(), "allow")
 		}
 		return true
 	}
@@ -102,7 +105,7 @@ func (g *AuthorizedPeerGater) InterceptSecured(dir network.Direction, p peer.ID,
 			g.probationPeers[p] = time.Now()
 			slog.Info("inbound connection allowed (probation)", "peer", short)
 			if g.onDecision != nil {
-				g.onDecision(short, "allow")
+				g.onDecision(p.String(), "allow")
 			}
 			g.mu.Unlock()
 			g.mu.RLock()
@@ -114,7 +117,7 @@ func (g *AuthorizedPeerGater) InterceptSecured(dir network.Direction, p peer.ID,
 
 	slog.Warn("inbound connection denied", "peer", short)
 	if g.onDecision != nil {
-		g.onDecision(short, "deny")
+		g.onDecision(p.String(), "deny")
 	}
 	return false
 }
@@ -147,6 +150,42 @@ func (g *AuthorizedPeerGater) IsAuthorized(p peer.ID) bool {
 	return g.authorizedPeers[p]
 }
 
+// UpdatePeerRoles replaces the role assignments (for hot-reload support).
+func (g *AuthorizedPeerGater) UpdatePeerRoles(roles map[peer.ID][]string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if roles == nil {
+		roles = make(map[peer.ID][]string)
+	}
+	g.peerRoles = roles
+}
+
+// PeerRoles returns the roles assigned to a peer.
+func (g *AuthorizedPeerGater) PeerRoles(p peer.ID) []string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return slices.Clone(g.peerRoles[p])
+}
+
+// HasAnyRole reports whether an authorized, unexpired peer holds at least
+// one of the given roles. Probation peers never hold roles.
+func (g *AuthorizedPeerGater) HasAnyRole(p peer.ID, roles []string) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if !g.authorizedPeers[p] {
+		return false
+	}
+	if exp, ok := g.peerExpiry[p]; ok && !exp.IsZero() && time.Now().After(exp) {
+		return false
+	}
+	for _, r := range g.peerRoles[p] {
+		if slices.Contains(roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
 // SetDecisionCallback sets a callback invoked on every inbound auth decision.
 // This is used by the observability layer to record metrics and audit events
 // without creating a circular import from internal/auth to pkg/p2pnet.
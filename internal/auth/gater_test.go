@@ -303,3 +303,45 @@ func TestClearExpiry(t *testing.T) {
 		t.Error("should be allowed after clearing expiry")
 	}
 }
+
+// --- Role tests ---
+
+func TestHasAnyRole(t *testing.T) {
+	ops := genPeerID(t)
+	dev := genPeerID(t)
+	g := NewAuthorizedPeerGater(map[peer.ID]bool{ops: true, dev: true})
+	g.UpdatePeerRoles(map[peer.ID][]string{
+		ops: {"admin", "ops"},
+		dev: {"dev"},
+	})
+
+	if !g.HasAnyRole(ops, []string{"ops"}) {
+		t.Error("ops peer should hold ops role")
+	}
+	if g.HasAnyRole(dev, []string{"ops", "admin"}) {
+		t.Error("dev peer should not hold ops or admin role")
+	}
+	if g.HasAnyRole(genPeerID(t), []string{"ops"}) {
+		t.Error("unknown peer should hold no roles")
+	}
+	if got := g.PeerRoles(ops); len(got) != 2 {
+		t.Errorf("PeerRoles = %v, want 2 roles", got)
+	}
+}
+
+func TestHasAnyRoleRequiresAuthorization(t *testing.T) {
+	p := genPeerID(t)
+	g := NewAuthorizedPeerGater(map[peer.ID]bool{p: true})
+	g.UpdatePeerRoles(map[peer.ID][]string{p: {"ops"}})
+
+	g.SetPeerExpiry(p, time.Now().Add(-time.Hour))
+	if g.HasAnyRole(p, []string{"ops"}) {
+		t.Error("expired peer should not hold roles")
+	}
+
+	g.SetPeerExpiry(p, time.Time{})
+	g.UpdateAuthorizedPeers(map[peer.ID]bool{})
+	if g.HasAnyRole(p, []string{"ops"}) {
+		t.Error("revoked peer should not hold roles")
+	}
+}
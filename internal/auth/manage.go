@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/satindergrewal/peer-up/internal/validate"
 )
 
 // PeerEntry represents an authorized peer with optional comment and attributes.
@@ -18,6 +23,11 @@ type PeerEntry struct {
 	ExpiresAt time.Time // zero = never expires
 	Verified  string    // empty = unverified, otherwise fingerprint prefix
 	Group     string    // pairing group ID (empty = manually added or invited)
+	Roles     []string  // named roles for service authorization (role=admin,ops)
+
+	// Relay server allowances. Only the relay reads these.
+	RelayQuota  string // daily relay data budget in data-size syntax (relay_quota=5GB)
+	RelayWeight int    // share of the relay bandwidth (relay_weight=2); 0 = default
 }
 
 // sanitizeComment strips characters that could corrupt the authorized_keys
@@ -88,14 +98,15 @@ func formatLine(peerIDStr string, attrs map[string]string, comment string) strin
 	}
 	writeAttr("expires")
 	writeAttr("verified")
-	for k, v := range attrs {
-		if k == "expires" || k == "verified" {
-			continue
+	others := make([]string, 0, len(attrs))
+	for k := range attrs {
+		if k != "expires" && k != "verified" {
+			others = append(others, k)
 		}
-		b.WriteString("  ")
-		b.WriteString(k)
-		b.WriteString("=")
-		b.WriteString(v)
+	}
+	sort.Strings(others)
+	for _, k := range others {
+		writeAttr(k)
 	}
 
 	if comment != "" {
@@ -109,6 +120,75 @@ func formatLine(peerIDStr string, attrs map[string]string, comment string) strin
 // SetPeerAttr sets or updates an attribute on an existing peer in the
 // authorized_keys file. Uses atomic write via temp file + rename.
 func SetPeerAttr(authKeysPath, peerIDStr, key, value string) error {
+	return updatePeerAttrs(authKeysPath, peerIDStr, func(attrs map[string]string) error {
+		if value == "" {
+			delete(attrs, key)
+		} else {
+			attrs[key] = value
+		}
+		return nil
+	})
+}
+
+// parseRoles splits a role= attribute value into role names.
+func parseRoles(v string) []string {
+	var roles []string
+	for _, r := range strings.Split(v, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// AddPeerRole adds a named role to an existing peer's role= attribute.
+// Returns ErrRoleAlreadyAssigned if the peer already has the role.
+func AddPeerRole(authKeysPath, peerIDStr, role string) error {
+	if err := validate.RoleName(role); err != nil {
+		return err
+	}
+	return updatePeerAttrs(authKeysPath, peerIDStr, func(attrs map[string]string) error {
+		roles := parseRoles(attrs["role"])
+		if slices.Contains(roles, role) {
+			return fmt.Errorf("%w: %s", ErrRoleAlreadyAssigned, role)
+		}
+		attrs["role"] = strings.Join(append(roles, role), ",")
+		return nil
+	})
+}
+
+// RemovePeerRole removes a named role from an existing peer. The role=
+// attribute is dropped when no roles remain. Returns ErrRoleNotAssigned if
+// the peer doesn't have the role.
+func RemovePeerRole(authKeysPath, peerIDStr, role string) error {
+	return updatePeerAttrs(authKeysPath, peerIDStr, func(attrs map[string]string) error {
+		roles := parseRoles(attrs["role"])
+		i := slices.Index(roles, role)
+		if i < 0 {
+			return fmt.Errorf("%w: %s", ErrRoleNotAssigned, role)
+		}
+		roles = slices.Delete(roles, i, i+1)
+		if len(roles) == 0 {
+			delete(attrs, "role")
+		} else {
+			attrs["role"] = strings.Join(roles, ",")
+		}
+		return nil
+	})
+}
+
+// updatePeerAttrs rewrites the attributes of an existing peer in the
+// authorized_keys file. update may return an error to abort without writing.
+// Uses atomic write via temp file + rename.
+func updatePeerAttrs(authKeysPath, peerIDStr string, update func(attrs map[string]string) error) error {
+	return updatePeerEntry(authKeysPath, peerIDStr, func(_ *string, attrs map[string]string) error {
+		return update(attrs)
+	})
+}
+
+// updatePeerEntry is updatePeerAttrs with the line's peer ID also open to
+// rewriting, for moving an entry to a new identity.
+func updatePeerEntry(authKeysPath, peerIDStr string, update func(pidStr *string, attrs map[string]string) error) error {
 	targetID, err := peer.Decode(peerIDStr)
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrInvalidPeerID, err)
@@ -143,10 +223,9 @@ func SetPeerAttr(authKeysPath, peerIDStr, key, value string) error {
 			if attrs == nil {
 				attrs = make(map[string]string)
 			}
-			if value == "" {
-				delete(attrs, key)
-			} else {
-				attrs[key] = value
+			if err := update(&pidStr, attrs); err != nil {
+				file.Close()
+				return err
 			}
 			newLines = append(newLines, formatLine(pidStr, attrs, comment))
 		} else {
@@ -292,6 +371,24 @@ func RemovePeer(authKeysPath, peerIDStr string) error {
 	return atomicWriteLines(authKeysPath, newLines)
 }
 
+// ReplacePeerID moves an authorized peer to a new peer ID, keeping the
+// line's attributes and comment, after a verified key rotation. If newID is
+// already authorized, the old line is dropped and the existing entry kept.
+// Uses atomic write via temp file + rename.
+func ReplacePeerID(authKeysPath string, oldID, newID peer.ID) error {
+	authorized, err := LoadAuthorizedKeys(authKeysPath)
+	if err != nil {
+		return err
+	}
+	if authorized[newID] && authorized[oldID] {
+		return RemovePeer(authKeysPath, oldID.String())
+	}
+	return updatePeerEntry(authKeysPath, oldID.String(), func(pidStr *string, _ map[string]string) error {
+		*pidStr = newID.String()
+		return nil
+	})
+}
+
 // ListPeers reads the authorized_keys file and returns all peer entries
 // including attributes (expires, verified).
 func ListPeers(authKeysPath string) ([]PeerEntry, error) {
@@ -331,6 +428,17 @@ func ListPeers(authKeysPath string) ([]PeerEntry, error) {
 		if v, ok := attrs["group"]; ok {
 			entry.Group = v
 		}
+		if v, ok := attrs["role"]; ok {
+			entry.Roles = parseRoles(v)
+		}
+		if v, ok := attrs["relay_quota"]; ok {
+			entry.RelayQuota = v
+		}
+		if v, ok := attrs["relay_weight"]; ok {
+			if w, err := strconv.Atoi(v); err == nil && w > 0 {
+				entry.RelayWeight = w
+			}
+		}
 
 		entries = append(entries, entry)
 	}
@@ -341,3 +449,19 @@ func ListPeers(authKeysPath string) ([]PeerEntry, error) {
 
 	return entries, nil
 }
+
+// LoadPeerRoles reads the role= attribute of every peer in the
+// authorized_keys file. Peers without roles are omitted.
+func LoadPeerRoles(authKeysPath string) (map[peer.ID][]string, error) {
+	entries, err := ListPeers(authKeysPath)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[peer.ID][]string)
+	for _, e := range entries {
+		if len(e.Roles) > 0 {
+			roles[e.PeerID] = e.Roles
+		}
+	}
+	return roles, nil
+}
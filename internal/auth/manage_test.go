@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -167,6 +168,26 @@ func TestListPeersPreservesComments(t *testing.T) {
 	}
 }
 
+func TestListPeersRelayAttrs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "authorized_keys")
+
+	pid1, pid2, pid3 := genPeerIDStr(t), genPeerIDStr(t), genPeerIDStr(t)
+	content := pid1 + "  relay_quota=5GB relay_weight=2  # kid\n" + pid2 + "  relay_weight=zero\n" + pid3 + "\n"
+	os.WriteFile(path, []byte(content), 0600)
+
+	entries, err := ListPeers(path)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("ListPeers = %v, %v", entries, err)
+	}
+	if entries[0].RelayQuota != "5GB" || entries[0].RelayWeight != 2 || entries[0].Comment != "kid" {
+		t.Errorf("entry = %+v", entries[0])
+	}
+	if entries[1].RelayWeight != 0 || entries[2].RelayQuota != "" {
+		t.Errorf("invalid or missing attributes parsed: %+v, %+v", entries[1], entries[2])
+	}
+}
+
 func TestRemovePeerPreservesInvalidLines(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "authorized_keys")
@@ -221,3 +242,131 @@ func TestRemovePeerPreservesFileComments(t *testing.T) {
 		t.Error("other peer should be preserved")
 	}
 }
+
+func TestPeerRoles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "authorized_keys")
+
+	pid := genPeerIDStr(t)
+	if err := AddPeer(path, pid, "teammate"); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddPeerRole(path, pid, "admin"); err != nil {
+		t.Fatalf("AddPeerRole: %v", err)
+	}
+	if err := AddPeerRole(path, pid, "ops"); err != nil {
+		t.Fatalf("AddPeerRole: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "role=admin,ops") {
+		t.Errorf("file should contain role=admin,ops, got: %s", data)
+	}
+	if !strings.Contains(string(data), "# teammate") {
+		t.Error("comment should be preserved")
+	}
+
+	if err := AddPeerRole(path, pid, "ops"); !errors.Is(err, ErrRoleAlreadyAssigned) {
+		t.Errorf("duplicate role: got %v, want ErrRoleAlreadyAssigned", err)
+	}
+	if err := AddPeerRole(path, pid, "Bad,Role"); err == nil {
+		t.Error("expected error for invalid role name")
+	}
+
+	entries, err := ListPeers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || strings.Join(entries[0].Roles, ",") != "admin,ops" {
+		t.Errorf("Roles = %v, want [admin ops]", entries[0].Roles)
+	}
+
+	if err := RemovePeerRole(path, pid, "admin"); err != nil {
+		t.Fatalf("RemovePeerRole: %v", err)
+	}
+	if err := RemovePeerRole(path, pid, "admin"); !errors.Is(err, ErrRoleNotAssigned) {
+		t.Errorf("missing role: got %v, want ErrRoleNotAssigned", err)
+	}
+	if err := RemovePeerRole(path, pid, "ops"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if strings.Contains(string(data), "role=") {
+		t.Errorf("role= should be dropped when no roles remain, got: %s", data)
+	}
+}
+
+func TestLoadPeerRoles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "authorized_keys")
+
+	pid1 := genPeerIDStr(t)
+	pid2 := genPeerIDStr(t)
+	os.WriteFile(path, []byte(pid1+"  role=ops,admin\n"+pid2+"\n"), 0600)
+
+	roles, err := LoadPeerRoles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 {
+		t.Fatalf("expected 1 peer with roles, got %d", len(roles))
+	}
+	for _, r := range roles {
+		if strings.Join(r, ",") != "ops,admin" {
+			t.Errorf("roles = %v, want [ops admin]", r)
+		}
+	}
+}
+
+func TestReplacePeerID(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "authorized_keys")
+
+	oldID, newID, other := genPeerID(t), genPeerID(t), genPeerID(t)
+	content := "# header\n" +
+		oldID.String() + "  role=ops verified=sha256:ab  # laptop\n" +
+		other.String() + "  # desktop\n"
+	os.WriteFile(path, []byte(content), 0600)
+
+	if err := ReplacePeerID(path, oldID, newID); err != nil {
+		t.Fatalf("ReplacePeerID: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	got := string(data)
+	if strings.Contains(got, oldID.String()) {
+		t.Error("old peer ID still present")
+	}
+	peers, _ := ListPeers(path)
+	if len(peers) != 2 || peers[0].PeerID != newID {
+		t.Fatalf("peers = %+v, want new ID first", peers)
+	}
+	if p := peers[0]; p.Comment != "laptop" || p.Verified != "sha256:ab" || strings.Join(p.Roles, ",") != "ops" {
+		t.Errorf("new entry lost attributes or comment: %+v", p)
+	}
+	if !strings.HasPrefix(got, "# header\n") || !strings.Contains(got, other.String()+"  # desktop") {
+		t.Errorf("other lines not preserved:\n%s", got)
+	}
+
+	if err := ReplacePeerID(path, oldID, newID); !errors.Is(err, ErrPeerNotFound) {
+		t.Errorf("second replace: err = %v, want ErrPeerNotFound", err)
+	}
+}
+
+func TestReplacePeerIDNewAlreadyAuthorized(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "authorized_keys")
+
+	oldID, newID := genPeerID(t), genPeerID(t)
+	os.WriteFile(path, []byte(oldID.String()+"  # old\n"+newID.String()+"  # new\n"), 0600)
+
+	if err := ReplacePeerID(path, oldID, newID); err != nil {
+		t.Fatalf("ReplacePeerID: %v", err)
+	}
+	peers, err := ListPeers(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 || peers[0].PeerID != newID || peers[0].Comment != "new" {
+		t.Errorf("peers = %+v, want only the existing new entry", peers)
+	}
+}
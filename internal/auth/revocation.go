@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// RevocationsFileName is the revocation store kept next to authorized_keys.
+const RevocationsFileName = "revocations.json"
+
+// revocationsFileVersion is bumped when the on-disk format changes incompatibly.
+const revocationsFileVersion = 1
+
+// maxRevocationSkew is the tolerated clock skew for future-dated notices.
+const maxRevocationSkew = 5 * time.Minute
+
+// maxStoredRevocations bounds the store. Every stored notice removed a
+// peer listed locally, so a real node stays far below this.
+const maxStoredRevocations = 4096
+
+// Revocation is a signed notice that PeerID must no longer be authorized by
+// members of pairing group Group. Any member of the group may issue one;
+// receivers check the issuer against their own authorized_keys.
+type Revocation struct {
+	Group    string `json:"group"`
+	PeerID   string `json:"peer_id"`
+	Issuer   string `json:"issuer"`
+	IssuedAt int64  `json:"issued_at"` // unix seconds
+	Reason   string `json:"reason,omitempty"`
+	Sig      []byte `json:"sig"`
+}
+
+// RevocationsPath returns the revocation store path for an authorized_keys file.
+func RevocationsPath(authKeysPath string) string {
+	return filepath.Join(filepath.Dir(authKeysPath), RevocationsFileName)
+}
+
+// NewRevocation builds and signs a revocation of revoked in group.
+func NewRevocation(issuerKey crypto.PrivKey, group string, revoked peer.ID, reason string, now time.Time) (*Revocation, error) {
+	issuer, err := peer.IDFromPrivateKey(issuerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive issuer peer ID: %w", err)
+	}
+	if group == "" {
+		return nil, fmt.Errorf("%w: group is required", ErrInvalidRevocation)
+	}
+	if issuer == revoked {
+		return nil, fmt.Errorf("%w: a peer cannot revoke itself", ErrInvalidRevocation)
+	}
+
+	r := &Revocation{
+		Group:    group,
+		PeerID:   revoked.String(),
+		Issuer:   issuer.String(),
+		IssuedAt: now.Unix(),
+		Reason:   sanitizeComment(reason),
+	}
+	if r.Sig, err = issuerKey.Sign(r.signedBytes()); err != nil {
+		return nil, fmt.Errorf("failed to sign revocation: %w", err)
+	}
+	return r, nil
+}
+
+// signedBytes is the message the issuer signs.
+func (r *Revocation) signedBytes() []byte {
+	return fmt.Appendf(nil, "peerup-revocation/1\ngroup=%s\npeer=%s\nissuer=%s\nts=%d\nreason=%s",
+		r.Group, r.PeerID, r.Issuer, r.IssuedAt, r.Reason)
+}
+
+// ID identifies a notice for deduplication during gossip.
+func (r *Revocation) ID() string {
+	sum := sha256.Sum256(r.signedBytes())
+	return hex.EncodeToString(sum[:16])
+}
+
+// Verify checks the issuer's signature and returns the decoded issuer and
+// revoked peer IDs. It does not check whether the issuer may revoke; see
+// RevocationStore.Check.
+func (r *Revocation) Verify() (issuer, revoked peer.ID, err error) {
+	if r.Group == "" {
+		return "", "", fmt.Errorf("%w: missing group", ErrInvalidRevocation)
+	}
+	if issuer, err = peer.Decode(r.Issuer); err != nil {
+		return "", "", fmt.Errorf("%w: bad issuer peer ID: %w", ErrInvalidRevocation, err)
+	}
+	if revoked, err = peer.Decode(r.PeerID); err != nil {
+		return "", "", fmt.Errorf("%w: bad revoked peer ID: %w", ErrInvalidRevocation, err)
+	}
+	if issuer == revoked {
+		return "", "", fmt.Errorf("%w: issuer revokes itself", ErrInvalidRevocation)
+	}
+	pub, err := issuer.ExtractPublicKey()
+	if err != nil {
+		return "", "", fmt.Errorf("%w: cannot extract issuer public key: %w", ErrInvalidRevocation, err)
+	}
+	ok, err := pub.Verify(r.signedBytes(), r.Sig)
+	if err != nil || !ok {
+		return "", "", fmt.Errorf("%w: bad signature", ErrInvalidRevocation)
+	}
+	return issuer, revoked, nil
+}
+
+// revocationsFile is the on-disk representation of a RevocationStore.
+type revocationsFile struct {
+	Version     int           `json:"version"`
+	Revocations []*Revocation `json:"revocations"`
+}
+
+// RevocationStore persists accepted revocations so they can be replayed to
+// group members that were offline when the notice was issued. Every
+// addition rewrites the file atomically (temp file + rename).
+type RevocationStore struct {
+	path string
+	mu   sync.RWMutex
+	byID map[string]*Revocation
+}
+
+// OpenRevocationStore loads the store at path. A missing file yields an
+// empty store; the file is created on the first addition.
+func OpenRevocationStore(path string) (*RevocationStore, error) {
+	s := &RevocationStore{path: path, byID: make(map[string]*Revocation)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read revocations: %w", err)
+	}
+
+	var file revocationsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse revocations %s: %w", path, err)
+	}
+	if file.Version != revocationsFileVersion {
+		return nil, fmt.Errorf("unsupported revocations version %d in %s", file.Version, path)
+	}
+	for _, r := range file.Revocations {
+		s.byID[r.ID()] = r
+	}
+	return s, nil
+}
+
+// Has reports whether the notice is already stored.
+func (s *RevocationStore) Has(r *Revocation) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.byID[r.ID()]
+	return ok
+}
+
+// Add stores r and persists the store. Returns false if it was already
+// stored, and an error wrapping ErrRevocationNotAllowed if the store is full.
+func (s *RevocationStore) Add(r *Revocation) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.ID()
+	if _, ok := s.byID[id]; ok {
+		return false, nil
+	}
+	if len(s.byID) >= maxStoredRevocations {
+		return false, fmt.Errorf("%w: revocation store is full (%d notices)", ErrRevocationNotAllowed, maxStoredRevocations)
+	}
+	s.byID[id] = r
+	if err := s.saveLocked(); err != nil {
+		delete(s.byID, id)
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns all stored revocations, oldest first.
+func (s *RevocationStore) List() []*Revocation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedLocked("")
+}
+
+// ForGroup returns the stored revocations for a pairing group, oldest first.
+func (s *RevocationStore) ForGroup(group string) []*Revocation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedLocked(group)
+}
+
+// IsRevoked reports whether p has been revoked in any group.
+func (s *RevocationStore) IsRevoked(p peer.ID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.byID {
+		if r.PeerID == p.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check decides whether r may be applied locally. self is the local peer
+// ID; entries are the local authorized_keys entries. A notice is accepted
+// when its signature is valid, it is not dated in the future, the issuer
+// is self or an authorized member of the notice's group (not itself
+// revoked in that group before issuing it), and the revoked peer is listed
+// locally as a member of the same group. Notices for peers this node does
+// not know are refused, so they are neither stored nor replayed.
+func (s *RevocationStore) Check(r *Revocation, self peer.ID, entries []PeerEntry, now time.Time) error {
+	issuer, revoked, err := r.Verify()
+	if err != nil {
+		return err
+	}
+	if time.Unix(r.IssuedAt, 0).After(now.Add(maxRevocationSkew)) {
+		return fmt.Errorf("%w: issued in the future", ErrInvalidRevocation)
+	}
+	if revoked == self {
+		return fmt.Errorf("%w: notice revokes this node", ErrRevocationNotAllowed)
+	}
+
+	if issuer != self {
+		member := false
+		for _, e := range entries {
+			if e.PeerID == issuer && e.Group == r.Group {
+				member = true
+				break
+			}
+		}
+		if !member {
+			return fmt.Errorf("%w: issuer is not a member of group %s", ErrRevocationNotAllowed, r.Group)
+		}
+	}
+	listed := false
+	for _, e := range entries {
+		if e.PeerID != revoked {
+			continue
+		}
+		if e.Group != r.Group {
+			return fmt.Errorf("%w: revoked peer is not a member of group %s", ErrRevocationNotAllowed, r.Group)
+		}
+		listed = true
+	}
+	if !listed {
+		return fmt.Errorf("%w: revoked peer is not authorized here", ErrRevocationNotAllowed)
+	}
+
+	// A revoked peer keeps its key, so anything it signs after being
+	// revoked is ignored.
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, prior := range s.byID {
+		if prior.Group == r.Group && prior.PeerID == r.Issuer && prior.IssuedAt <= r.IssuedAt {
+			return fmt.Errorf("%w: issuer was revoked", ErrRevocationNotAllowed)
+		}
+	}
+	return nil
+}
+
+func (s *RevocationStore) sortedLocked(group string) []*Revocation {
+	var out []*Revocation
+	for _, r := range s.byID {
+		if group == "" || r.Group == group {
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].IssuedAt != out[j].IssuedAt {
+			return out[i].IssuedAt < out[j].IssuedAt
+		}
+		return out[i].PeerID < out[j].PeerID
+	})
+	return out
+}
+
+func (s *RevocationStore) saveLocked() error {
+	data, err := json.MarshalIndent(revocationsFile{
+		Version:     revocationsFileVersion,
+		Revocations: s.sortedLocked(""),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode revocations: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".revocations.*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op after a successful rename
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to update revocations: %w", err)
+	}
+	return nil
+}
+
+// PeerGroup returns the pairing group of an authorized peer. Returns
+// ErrPeerNotFound if the peer is not listed and ErrNoPairingGroup if it
+// has no group= attribute.
+func PeerGroup(authKeysPath string, p peer.ID) (string, error) {
+	entries, err := ListPeers(authKeysPath)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if e.PeerID != p {
+			continue
+		}
+		if e.Group == "" {
+			return "", fmt.Errorf("%w: %s (use 'peerup auth remove')", ErrNoPairingGroup, p.String()[:16]+"...")
+		}
+		return e.Group, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrPeerNotFound, p.String()[:16]+"...")
+}
+
+// Apply checks r against the local authorized_keys, stores it and removes
+// the revoked peer. added is false if the notice was already stored;
+// removed reports whether the peer was still listed. Errors wrapping
+// ErrInvalidRevocation or ErrRevocationNotAllowed mean the notice was
+// refused.
+func (s *RevocationStore) Apply(authKeysPath string, r *Revocation, self peer.ID, now time.Time) (added, removed bool, err error) {
+	if s.Has(r) {
+		return false, false, nil
+	}
+	entries, err := ListPeers(authKeysPath)
+	if err != nil {
+		return false, false, fmt.Errorf("failed to read authorized_keys: %w", err)
+	}
+	if err := s.Check(r, self, entries, now); err != nil {
+		return false, false, err
+	}
+	if added, err = s.Add(r); err != nil || !added {
+		return false, false, err
+	}
+
+	err = RemovePeer(authKeysPath, r.PeerID)
+	switch {
+	case err == nil:
+		return true, true, nil
+	case errors.Is(err, ErrPeerNotFound), errors.Is(err, fs.ErrNotExist):
+		return true, false, nil
+	default:
+		return true, false, fmt.Errorf("failed to update authorized_keys: %w", err)
+	}
+}
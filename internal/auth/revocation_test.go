@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func genKey(t *testing.T) (crypto.PrivKey, peer.ID) {
+	t.Helper()
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := peer.IDFromPrivateKey(priv)
+	return priv, pid
+}
+
+func TestRevocationVerify(t *testing.T) {
+	issuerKey, issuer := genKey(t)
+	_, target := genKey(t)
+
+	r, err := NewRevocation(issuerKey, "g1", target, "stolen\nlaptop", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Reason != "stolenlaptop" {
+		t.Errorf("Reason = %q, want sanitized", r.Reason)
+	}
+	gotIssuer, gotRevoked, err := r.Verify()
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if gotIssuer != issuer || gotRevoked != target {
+		t.Errorf("Verify() = %s, %s", gotIssuer, gotRevoked)
+	}
+
+	tampered := *r
+	tampered.Group = "g2"
+	if _, _, err := tampered.Verify(); !errors.Is(err, ErrInvalidRevocation) {
+		t.Errorf("tampered group: err = %v, want ErrInvalidRevocation", err)
+	}
+	if tampered.ID() == r.ID() {
+		t.Error("ID() should change with the signed content")
+	}
+
+	if _, err := NewRevocation(issuerKey, "g1", issuer, "", time.Now()); !errors.Is(err, ErrInvalidRevocation) {
+		t.Errorf("self-revocation: err = %v, want ErrInvalidRevocation", err)
+	}
+}
+
+func TestRevocationStoreCheck(t *testing.T) {
+	_, self := genKey(t)
+	memberKey, member := genKey(t)
+	outsiderKey, _ := genKey(t)
+	_, target := genKey(t)
+	_, other := genKey(t)
+	now := time.Now()
+
+	entries := []PeerEntry{
+		{PeerID: member, Group: "g1"},
+		{PeerID: target, Group: "g1"},
+		{PeerID: other, Group: "g2"},
+	}
+	s, err := OpenRevocationStore(filepath.Join(t.TempDir(), RevocationsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, _ := NewRevocation(memberKey, "g1", target, "", now)
+	if err := s.Check(ok, self, entries, now); err != nil {
+		t.Errorf("member revoking member: err = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		rev  func() *Revocation
+		want error
+	}{
+		{"issuer outside group", func() *Revocation {
+			r, _ := NewRevocation(outsiderKey, "g1", target, "", now)
+			return r
+		}, ErrRevocationNotAllowed},
+		{"revoked peer in another group", func() *Revocation {
+			r, _ := NewRevocation(memberKey, "g1", other, "", now)
+			return r
+		}, ErrRevocationNotAllowed},
+		{"revoked peer not listed", func() *Revocation {
+			_, stranger := genKey(t)
+			r, _ := NewRevocation(memberKey, "g1", stranger, "", now)
+			return r
+		}, ErrRevocationNotAllowed},
+		{"revokes this node", func() *Revocation {
+			r, _ := NewRevocation(memberKey, "g1", self, "", now)
+			return r
+		}, ErrRevocationNotAllowed},
+		{"future timestamp", func() *Revocation {
+			r, _ := NewRevocation(memberKey, "g1", target, "", now.Add(time.Hour))
+			return r
+		}, ErrInvalidRevocation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Check(tt.rev(), self, entries, now); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Once the member is revoked, notices it signs afterwards are refused
+	// but earlier ones still apply.
+	targetKey, target2 := genKey(t)
+	entries = append(entries, PeerEntry{PeerID: target2, Group: "g1"})
+	before, _ := NewRevocation(memberKey, "g1", target, "", now.Add(-time.Minute))
+	revokeMember, _ := NewRevocation(targetKey, "g1", member, "", now)
+	after, _ := NewRevocation(memberKey, "g1", target, "", now.Add(time.Minute))
+	if _, err := s.Add(revokeMember); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Check(before, self, entries, now.Add(time.Hour)); err != nil {
+		t.Errorf("notice issued before issuer was revoked: err = %v", err)
+	}
+	if err := s.Check(after, self, entries, now.Add(time.Hour)); !errors.Is(err, ErrRevocationNotAllowed) {
+		t.Errorf("notice issued after issuer was revoked: err = %v, want ErrRevocationNotAllowed", err)
+	}
+}
+
+func TestRevocationStoreApply(t *testing.T) {
+	dir := t.TempDir()
+	_, self := genKey(t)
+	memberKey, member := genKey(t)
+	_, target := genKey(t)
+	authPath := writeAuthKeys(t, dir,
+		member.String()+"  group=g1  # phone\n"+
+			target.String()+"  group=g1  # laptop\n")
+	storePath := RevocationsPath(authPath)
+
+	s, err := OpenRevocationStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := NewRevocation(memberKey, "g1", target, "stolen", time.Now())
+
+	added, removed, err := s.Apply(authPath, r, self, time.Now())
+	if err != nil || !added || !removed {
+		t.Fatalf("Apply() = %v, %v, %v; want true, true, nil", added, removed, err)
+	}
+	entries, _ := ListPeers(authPath)
+	if len(entries) != 1 || entries[0].PeerID != member {
+		t.Errorf("authorized_keys after revoke = %v, want only the issuer", entries)
+	}
+
+	added, _, err = s.Apply(authPath, r, self, time.Now())
+	if err != nil || added {
+		t.Errorf("second Apply() = %v, %v; want false, nil", added, err)
+	}
+
+	// Late-joining view: a fresh store reads the notice back from disk.
+	reopened, err := OpenRevocationStore(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.ForGroup("g1"); len(got) != 1 || got[0].ID() != r.ID() {
+		t.Errorf("ForGroup(g1) after reopen = %v", got)
+	}
+	if !reopened.IsRevoked(target) || reopened.IsRevoked(member) {
+		t.Error("IsRevoked mismatch after reopen")
+	}
+}
+
+func TestPeerGroup(t *testing.T) {
+	dir := t.TempDir()
+	_, grouped := genKey(t)
+	_, manual := genKey(t)
+	_, missing := genKey(t)
+	authPath := writeAuthKeys(t, dir, grouped.String()+"  group=g1\n"+manual.String()+"\n")
+
+	if g, err := PeerGroup(authPath, grouped); err != nil || g != "g1" {
+		t.Errorf("PeerGroup(grouped) = %q, %v", g, err)
+	}
+	if _, err := PeerGroup(authPath, manual); !errors.Is(err, ErrNoPairingGroup) {
+		t.Errorf("PeerGroup(manual) err = %v, want ErrNoPairingGroup", err)
+	}
+	if _, err := PeerGroup(authPath, missing); !errors.Is(err, ErrPeerNotFound) {
+		t.Errorf("PeerGroup(missing) err = %v, want ErrPeerNotFound", err)
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"time"
 )
 
@@ -20,6 +21,11 @@ type HomeNodeConfig struct {
 	Services  ServicesConfig  `yaml:"services,omitempty"`
 	Names     NamesConfig     `yaml:"names,omitempty"`
 	Telemetry TelemetryConfig `yaml:"telemetry,omitempty"`
+	Proxy     ProxyConfig     `yaml:"proxy,omitempty"`
+	Directory DirectoryConfig `yaml:"directory,omitempty"`
+	DNS       DNSConfig       `yaml:"dns,omitempty"`
+
+	ReverseTunnels ReverseTunnelsConfig `yaml:"reverse_tunnels,omitempty"`
 }
 
 // ClientNodeConfig represents configuration for the client node
@@ -35,14 +41,15 @@ type ClientNodeConfig struct {
 
 // RelayServerConfig represents configuration for the relay server
 type RelayServerConfig struct {
-	Version   int                  `yaml:"version,omitempty"`
-	Identity  IdentityConfig       `yaml:"identity"`
-	Network   RelayNetworkConfig   `yaml:"network"`
-	Discovery RelayDiscoveryConfig `yaml:"discovery,omitempty"`
-	Security  RelaySecurityConfig  `yaml:"security"`
-	Resources RelayResourcesConfig `yaml:"resources,omitempty"`
-	Health    HealthConfig         `yaml:"health,omitempty"`
-	Telemetry TelemetryConfig      `yaml:"telemetry,omitempty"`
+	Version    int                   `yaml:"version,omitempty"`
+	Identity   IdentityConfig        `yaml:"identity"`
+	Network    RelayNetworkConfig    `yaml:"network"`
+	Discovery  RelayDiscoveryConfig  `yaml:"discovery,omitempty"`
+	Security   RelaySecurityConfig   `yaml:"security"`
+	Resources  RelayResourcesConfig  `yaml:"resources,omitempty"`
+	Federation RelayFederationConfig `yaml:"federation,omitempty"`
+	Health     HealthConfig          `yaml:"health,omitempty"`
+	Telemetry  TelemetryConfig       `yaml:"telemetry,omitempty"`
 }
 
 // TelemetryConfig holds observability settings.
@@ -71,7 +78,8 @@ type HealthConfig struct {
 
 // IdentityConfig holds identity-related configuration
 type IdentityConfig struct {
-	KeyFile string `yaml:"key_file"`
+	KeyFile        string `yaml:"key_file"`
+	PassphraseFile string `yaml:"passphrase_file,omitempty"` // unlocks an encrypted key_file (e.g. for systemd)
 }
 
 // NetworkConfig holds network-related configuration
@@ -97,6 +105,7 @@ type DiscoveryConfig struct {
 	Rendezvous     string   `yaml:"rendezvous"`
 	Network        string   `yaml:"network,omitempty"`  // DHT namespace for private networks (empty = global)
 	BootstrapPeers []string `yaml:"bootstrap_peers"`
+	MDNS           bool     `yaml:"mdns,omitempty"` // find authorized peers on the local network via mDNS
 }
 
 // RelayDiscoveryConfig holds relay server discovery configuration
@@ -114,6 +123,9 @@ type SecurityConfig struct {
 type RelaySecurityConfig struct {
 	AuthorizedKeysFile     string `yaml:"authorized_keys_file"`
 	EnableConnectionGating bool   `yaml:"enable_connection_gating"`
+	// InviteMailbox lets authorized peers leave asynchronous invites here.
+	// Enrollment stays open while any invite is pending. Off by default.
+	InviteMailbox bool `yaml:"invite_mailbox,omitempty"`
 }
 
 // RelayResourcesConfig holds relay v2 resource limit configuration.
@@ -127,6 +139,70 @@ type RelayResourcesConfig struct {
 	ReservationTTL       string `yaml:"reservation_ttl"`          // default: "1h"
 	SessionDuration      string `yaml:"session_duration"`         // default: "10m"
 	SessionDataLimit     string `yaml:"session_data_limit"`       // default: "64MB"
+	// Bandwidth caps all relayed traffic (bytes/sec, ParseDataSize syntax).
+	// Peers with open circuits share it by their relay_weight. "" = unlimited.
+	Bandwidth string `yaml:"bandwidth,omitempty"`
+}
+
+// RelayFederationConfig lists other relays that share pairing groups and
+// authorized peers with this one. Every relay in a federation lists all of
+// the others; updates are not forwarded between relays.
+type RelayFederationConfig struct {
+	Peers []string `yaml:"peers,omitempty"` // full multiaddrs ending in /p2p/<relay-peer-id>
+}
+
+// ProxyConfig holds settings for outgoing service proxies
+// (peerup proxy and daemon connect).
+type ProxyConfig struct {
+	StreamPool        StreamPoolConfig `yaml:"stream_pool,omitempty"`
+	Warmup            bool             `yaml:"warmup"`             // dial the target at startup and keep the path alive
+	KeepaliveInterval string           `yaml:"keepalive_interval"` // ping interval when warmup is on; default: "30s"
+	SessionResume     bool             `yaml:"session_resume"`     // daemon proxies use resumable sessions (/peerup/resume/1.0.0)
+	SOCKS             SOCKSConfig      `yaml:"socks,omitempty"`
+}
+
+// ReverseTunnelsConfig lists the peers that may open reverse tunnels
+// (peerup tunnel reverse) on this node and where they may listen. Keys are
+// peer IDs; values are "ip:port" or "ip:*" (any port from 1024).
+// Requires connection gating.
+type ReverseTunnelsConfig struct {
+	Allow map[string][]string `yaml:"allow,omitempty"`
+}
+
+// SOCKSConfig controls the daemon's local SOCKS5 and HTTP CONNECT proxy
+// into the mesh. Destinations name a peer and service under dns.domain
+// (ssh.home.peerup:22, or home.peerup:22 via dns.ports); anything else is
+// refused.
+type SOCKSConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // default: "127.0.0.1:1080"
+}
+
+// StreamPoolConfig controls the warm, pre-negotiated streams kept per
+// (peer, service) so new proxy connections skip stream setup.
+// Zero values are replaced with defaults at load time.
+type StreamPoolConfig struct {
+	Enabled     bool   `yaml:"enabled"`      // off by default
+	Size        int    `yaml:"size"`         // default: 2
+	IdleTimeout string `yaml:"idle_timeout"` // default: "30s"
+}
+
+// DirectoryConfig controls the opt-in name and service directory shared
+// with authorized peers. Requires connection gating.
+type DirectoryConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	SyncInterval string `yaml:"sync_interval"` // periodic full sync; default: "10m"
+}
+
+// DNSConfig controls the opt-in local name server that answers
+// <name>.<domain> queries for peer names with a per-peer loopback address.
+// Ports maps remote service names to the local port opened on each peer's
+// loopback address, so "ssh nas.peerup" reaches the nas peer's ssh service.
+type DNSConfig struct {
+	Enabled bool           `yaml:"enabled"`
+	Listen  string         `yaml:"listen"` // default: "127.0.0.53:5353"
+	Domain  string         `yaml:"domain"` // pseudo-TLD; default: "peerup"
+	Ports   map[string]int `yaml:"ports,omitempty"`
 }
 
 // ProtocolsConfig holds protocol-specific configuration
@@ -143,12 +219,57 @@ type PingPongConfig struct {
 // ServicesConfig holds service exposure configuration
 type ServicesConfig map[string]ServiceConfig
 
+// ServiceProtocolUDP is the reserved protocol value that exposes a UDP
+// service (DNS, WireGuard, game servers) instead of a TCP one.
+const ServiceProtocolUDP = "udp"
+
+// MaxServiceDescriptionLen caps a service's description shown to browsing peers.
+const MaxServiceDescriptionLen = 200
+
 // ServiceConfig holds configuration for a single exposed service
 type ServiceConfig struct {
-	Enabled      bool     `yaml:"enabled"`
-	LocalAddress string   `yaml:"local_address"`
-	Protocol     string   `yaml:"protocol,omitempty"`        // Optional custom protocol ID
-	AllowedPeers []string `yaml:"allowed_peers,omitempty"`   // Restrict to specific peer IDs (nil = all authorized peers)
+	Enabled      bool              `yaml:"enabled"`
+	LocalAddress string            `yaml:"local_address"`           // host:port, or unix:/path/to.sock
+	Protocol     string            `yaml:"protocol,omitempty"`      // Optional custom protocol ID, or "udp" for UDP forwarding
+	Description  string            `yaml:"description,omitempty"`   // Shown to peers that browse this node's services
+	AllowedPeers []string          `yaml:"allowed_peers,omitempty"` // Restrict to specific peer IDs (nil = all authorized peers)
+	AllowedRoles []string          `yaml:"allowed_roles,omitempty"` // Also allow peers with these authorized_keys roles (role=ops)
+	RateLimit    *ServiceRateLimit `yaml:"rate_limit,omitempty"`    // Bandwidth shaping (nil = unlimited)
+	Quota        *ServiceQuota     `yaml:"quota,omitempty"`         // Data allowance (nil = unlimited)
+	Access       []ServiceAccess   `yaml:"access,omitempty"`        // Time-based access rules (nil = any time)
+}
+
+// ServiceAccess restricts when peers may use a service. A peer listed in (or,
+// with no peers, covered by) any rule may connect only while one of its rules
+// is open; other peers are unaffected. Access rules never grant access that
+// allowed_peers or allowed_roles denies. Open connections are closed when access ends.
+type ServiceAccess struct {
+	Peers     []string `yaml:"peers,omitempty"`      // Peer IDs the rule applies to (empty = all peers)
+	Windows   []string `yaml:"windows,omitempty"`    // Recurring windows, e.g. "mon-fri 09:00-18:00" (empty = any time)
+	Timezone  string   `yaml:"timezone,omitempty"`   // IANA timezone for windows (default: local time)
+	NotBefore string   `yaml:"not_before,omitempty"` // RFC 3339 start of validity
+	NotAfter  string   `yaml:"not_after,omitempty"`  // RFC 3339 end of validity
+}
+
+// ServiceRateLimit caps a service's bandwidth in bytes per second, counting
+// both directions. Values use ParseDataSize syntax ("512KB" = 512 KiB/s).
+// Empty fields are unlimited.
+type ServiceRateLimit struct {
+	PerPeer string `yaml:"per_peer,omitempty"` // each remote peer
+	Total   string `yaml:"total,omitempty"`    // all peers combined
+}
+
+// ServiceQuota caps the data a service transfers per UTC calendar day or
+// month, across all peers and both directions. Usage survives restarts.
+// Values use ParseDataSize syntax ("10GB"). Empty fields are unlimited.
+type ServiceQuota struct {
+	Daily   string `yaml:"daily,omitempty"`
+	Monthly string `yaml:"monthly,omitempty"`
+}
+
+// IsUDP reports whether the service forwards UDP datagrams.
+func (s ServiceConfig) IsUDP() bool {
+	return strings.EqualFold(s.Protocol, ServiceProtocolUDP)
 }
 
 // NamesConfig holds name resolution configuration
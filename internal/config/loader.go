@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -54,6 +56,11 @@ func LoadHomeNodeConfig(path string) (*HomeNodeConfig, error) {
 		Services  ServicesConfig  `yaml:"services,omitempty"`
 		Names     NamesConfig     `yaml:"names,omitempty"`
 		Telemetry TelemetryConfig `yaml:"telemetry,omitempty"`
+		Proxy     ProxyConfig     `yaml:"proxy,omitempty"`
+		Directory DirectoryConfig `yaml:"directory,omitempty"`
+		DNS       DNSConfig       `yaml:"dns,omitempty"`
+
+		ReverseTunnels ReverseTunnelsConfig `yaml:"reverse_tunnels,omitempty"`
 	}
 
 	if err := yaml.Unmarshal(data, &rawConfig); err != nil {
@@ -85,6 +92,11 @@ func LoadHomeNodeConfig(path string) (*HomeNodeConfig, error) {
 		Services:  rawConfig.Services,
 		Names:     rawConfig.Names,
 		Telemetry: rawConfig.Telemetry,
+		Proxy:     rawConfig.Proxy,
+		Directory: rawConfig.Directory,
+		DNS:       rawConfig.DNS,
+
+		ReverseTunnels: rawConfig.ReverseTunnels,
 		Relay: RelayConfig{
 			Addresses:           rawConfig.Relay.Addresses,
 			ReservationInterval: reservationInterval,
@@ -92,6 +104,9 @@ func LoadHomeNodeConfig(path string) (*HomeNodeConfig, error) {
 	}
 
 	applyTelemetryDefaults(&config.Telemetry)
+	applyProxyDefaults(&config.Proxy)
+	applyDirectoryDefaults(&config.Directory)
+	applyDNSDefaults(&config.DNS)
 
 	return config, nil
 }
@@ -268,6 +283,9 @@ func ResolveConfigPaths(cfg *NodeConfig, configDir string) {
 	if cfg.Identity.KeyFile != "" && !filepath.IsAbs(cfg.Identity.KeyFile) {
 		cfg.Identity.KeyFile = filepath.Join(configDir, cfg.Identity.KeyFile)
 	}
+	if cfg.Identity.PassphraseFile != "" && !filepath.IsAbs(cfg.Identity.PassphraseFile) {
+		cfg.Identity.PassphraseFile = filepath.Join(configDir, cfg.Identity.PassphraseFile)
+	}
 	if cfg.Security.AuthorizedKeysFile != "" && !filepath.IsAbs(cfg.Security.AuthorizedKeysFile) {
 		cfg.Security.AuthorizedKeysFile = filepath.Join(configDir, cfg.Security.AuthorizedKeysFile)
 	}
@@ -299,15 +317,227 @@ func ValidateNodeConfig(cfg *NodeConfig) error {
 			return fmt.Errorf("discovery.network: %w", err)
 		}
 	}
+	if cfg.Discovery.MDNS && !cfg.Security.EnableConnectionGating {
+		return fmt.Errorf("discovery.mdns requires security.enable_connection_gating")
+	}
 	// Validate service names (prevent protocol ID injection)
-	for name := range cfg.Services {
+	for name, svc := range cfg.Services {
 		if err := validate.ServiceName(name); err != nil {
 			return fmt.Errorf("services: %w", err)
 		}
+		if err := validate.LocalAddress(svc.LocalAddress); err != nil {
+			return fmt.Errorf("services.%s.local_address: %w", name, err)
+		}
+		if svc.Protocol == ServiceProtocolUDP && strings.HasPrefix(svc.LocalAddress, "unix:") {
+			return fmt.Errorf("services.%s: unix sockets cannot carry UDP", name)
+		}
+		if len(svc.Description) > MaxServiceDescriptionLen {
+			return fmt.Errorf("services.%s.description must be at most %d characters", name, MaxServiceDescriptionLen)
+		}
+		for _, role := range svc.AllowedRoles {
+			if err := validate.RoleName(role); err != nil {
+				return fmt.Errorf("services.%s.allowed_roles: %w", name, err)
+			}
+		}
+		if err := validateServiceLimits(name, svc); err != nil {
+			return err
+		}
+		if err := validateServiceAccess(name, svc); err != nil {
+			return err
+		}
+	}
+	if cfg.Proxy.KeepaliveInterval != "" {
+		d, err := time.ParseDuration(cfg.Proxy.KeepaliveInterval)
+		if err != nil {
+			return fmt.Errorf("proxy.keepalive_interval: %w", err)
+		}
+		if d < time.Second {
+			return fmt.Errorf("proxy.keepalive_interval must be at least 1s")
+		}
+	}
+	if cfg.Proxy.StreamPool.Size < 0 {
+		return fmt.Errorf("proxy.stream_pool.size must not be negative")
+	}
+	if cfg.Proxy.StreamPool.IdleTimeout != "" {
+		if _, err := time.ParseDuration(cfg.Proxy.StreamPool.IdleTimeout); err != nil {
+			return fmt.Errorf("proxy.stream_pool.idle_timeout: %w", err)
+		}
+	}
+	if cfg.Proxy.SOCKS.Listen != "" {
+		if err := validateLoopbackListen("proxy.socks.listen", cfg.Proxy.SOCKS.Listen); err != nil {
+			return err
+		}
+	}
+	if cfg.Directory.Enabled && !cfg.Security.EnableConnectionGating {
+		return fmt.Errorf("directory.enabled requires security.enable_connection_gating")
+	}
+	if cfg.Directory.SyncInterval != "" {
+		d, err := time.ParseDuration(cfg.Directory.SyncInterval)
+		if err != nil {
+			return fmt.Errorf("directory.sync_interval: %w", err)
+		}
+		if d < 10*time.Second {
+			return fmt.Errorf("directory.sync_interval must be at least 10s")
+		}
+	}
+	if err := validateDNS(cfg.DNS); err != nil {
+		return err
+	}
+	if len(cfg.ReverseTunnels.Allow) > 0 && !cfg.Security.EnableConnectionGating {
+		return fmt.Errorf("reverse_tunnels requires security.enable_connection_gating")
+	}
+	for peerID, rules := range cfg.ReverseTunnels.Allow {
+		for _, rule := range rules {
+			if err := validateListenRule(rule); err != nil {
+				return fmt.Errorf("reverse_tunnels.allow.%s: %w", peerID, err)
+			}
+		}
 	}
 	return nil
 }
 
+// validateListenRule checks a reverse tunnel listen rule: an IP address
+// and a port or "*".
+func validateListenRule(rule string) error {
+	host, port, err := net.SplitHostPort(rule)
+	if err != nil {
+		return err
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("%q: host must be an IP address", rule)
+	}
+	if port == "*" {
+		return nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%q: port must be 1-65535 or *", rule)
+	}
+	return nil
+}
+
+// perPeerLoopback reports whether all of 127.0.0.0/8 reaches loopback, as
+// the name server's per-peer dns.ports proxies need. Linux routes the whole
+// block; macOS and the BSDs only configure 127.0.0.1. A var for tests.
+var perPeerLoopback = runtime.GOOS == "linux"
+
+// validateDNS checks the local name server settings. The server only
+// listens on loopback: its answers are loopback addresses, useless to
+// anyone else.
+func validateDNS(dc DNSConfig) error {
+	if dc.Enabled && len(dc.Ports) > 0 && !perPeerLoopback {
+		return fmt.Errorf("dns.ports with dns.enabled is only supported on Linux: the proxies listen on per-peer 127.x.y.z addresses that %s does not route; use proxy.socks instead", runtime.GOOS)
+	}
+	if dc.Listen != "" {
+		if err := validateLoopbackListen("dns.listen", dc.Listen); err != nil {
+			return err
+		}
+	}
+	if dc.Domain != "" {
+		if err := validate.NetworkName(dc.Domain); err != nil {
+			return fmt.Errorf("dns.domain must be a single lowercase DNS label such as \"peerup\", got %q", dc.Domain)
+		}
+	}
+	byPort := make(map[int]string)
+	for name, port := range dc.Ports {
+		if err := validate.ServiceName(name); err != nil {
+			return fmt.Errorf("dns.ports: %w", err)
+		}
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("dns.ports.%s must be between 1 and 65535", name)
+		}
+		if other, ok := byPort[port]; ok {
+			return fmt.Errorf("dns.ports: %s and %s both use port %d", other, name, port)
+		}
+		byPort[port] = name
+	}
+	return nil
+}
+
+// validateServiceLimits checks that a service's rate_limit and quota sizes
+// parse and are positive.
+func validateServiceLimits(name string, svc ServiceConfig) error {
+	check := func(field, value string) error {
+		if value == "" {
+			return nil
+		}
+		n, err := ParseDataSize(value)
+		if err != nil {
+			return fmt.Errorf("services.%s.%s: %w", name, field, err)
+		}
+		if n == 0 {
+			return fmt.Errorf("services.%s.%s must be greater than zero", name, field)
+		}
+		return nil
+	}
+	if rl := svc.RateLimit; rl != nil {
+		if err := check("rate_limit.per_peer", rl.PerPeer); err != nil {
+			return err
+		}
+		if err := check("rate_limit.total", rl.Total); err != nil {
+			return err
+		}
+	}
+	if q := svc.Quota; q != nil {
+		if err := check("quota.daily", q.Daily); err != nil {
+			return err
+		}
+		if err := check("quota.monthly", q.Monthly); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateServiceAccess checks a service's access rule timezones and
+// validity timestamps. Peer IDs and window syntax are checked when the
+// service is exposed (like allowed_peers).
+func validateServiceAccess(name string, svc ServiceConfig) error {
+	for i, rule := range svc.Access {
+		field := fmt.Sprintf("services.%s.access[%d]", name, i)
+		if rule.Timezone != "" {
+			if _, err := time.LoadLocation(rule.Timezone); err != nil {
+				return fmt.Errorf("%s.timezone: %w", field, err)
+			}
+		}
+		var notBefore, notAfter time.Time
+		var err error
+		if rule.NotBefore != "" {
+			if notBefore, err = time.Parse(time.RFC3339, rule.NotBefore); err != nil {
+				return fmt.Errorf("%s.not_before: %w", field, err)
+			}
+		}
+		if rule.NotAfter != "" {
+			if notAfter, err = time.Parse(time.RFC3339, rule.NotAfter); err != nil {
+				return fmt.Errorf("%s.not_after: %w", field, err)
+			}
+		}
+		if !notBefore.IsZero() && !notAfter.IsZero() && !notAfter.After(notBefore) {
+			return fmt.Errorf("%s: not_after must be after not_before", field)
+		}
+	}
+	return nil
+}
+
+// ServiceLimitBytes returns the service's rate limits (bytes/sec) and quotas
+// (bytes) with unset or invalid fields as zero. Call ValidateNodeConfig first
+// to reject invalid values.
+func ServiceLimitBytes(svc ServiceConfig) (perPeerRate, totalRate, dailyQuota, monthlyQuota int64) {
+	size := func(s string) int64 {
+		if s == "" {
+			return 0
+		}
+		n, _ := ParseDataSize(s)
+		return n
+	}
+	if rl := svc.RateLimit; rl != nil {
+		perPeerRate, totalRate = size(rl.PerPeer), size(rl.Total)
+	}
+	if q := svc.Quota; q != nil {
+		dailyQuota, monthlyQuota = size(q.Daily), size(q.Monthly)
+	}
+	return
+}
+
 // DefaultConfigDir returns the default peerup config directory (~/.config/peerup).
 func DefaultConfigDir() (string, error) {
 	home, err := os.UserHomeDir()
@@ -344,12 +574,30 @@ func ValidateRelayServerConfig(cfg *RelayServerConfig) error {
 			return fmt.Errorf("resources.session_data_limit: %w", err)
 		}
 	}
+	if cfg.Resources.Bandwidth != "" {
+		if _, err := ParseDataSize(cfg.Resources.Bandwidth); err != nil {
+			return fmt.Errorf("resources.bandwidth: %w", err)
+		}
+	}
 	// Validate network namespace if set
 	if cfg.Discovery.Network != "" {
 		if err := validate.NetworkName(cfg.Discovery.Network); err != nil {
 			return fmt.Errorf("discovery.network: %w", err)
 		}
 	}
+	if cfg.Security.InviteMailbox && cfg.Security.AuthorizedKeysFile == "" {
+		return fmt.Errorf("security.authorized_keys_file is required when security.invite_mailbox is enabled")
+	}
+	if len(cfg.Federation.Peers) > 0 && cfg.Security.AuthorizedKeysFile == "" {
+		return fmt.Errorf("security.authorized_keys_file is required when federation.peers is set")
+	}
+	// Federation peers are dialed by peer ID, so each needs a /p2p/ suffix.
+	// Full multiaddr parsing happens when the relay starts.
+	for i, addr := range cfg.Federation.Peers {
+		if !strings.HasPrefix(addr, "/") || !strings.Contains(addr, "/p2p/") {
+			return fmt.Errorf("federation.peers[%d]: %q must be a multiaddr ending in /p2p/<peer-id>", i, addr)
+		}
+	}
 	return nil
 }
 
@@ -404,6 +652,66 @@ func applyTelemetryDefaults(tc *TelemetryConfig) {
 	}
 }
 
+// DefaultStreamPool returns the default stream pool configuration.
+// Pooling itself is off until proxy.stream_pool.enabled is set.
+func DefaultStreamPool() StreamPoolConfig {
+	return StreamPoolConfig{
+		Size:        2,
+		IdleTimeout: "30s",
+	}
+}
+
+// applyProxyDefaults fills zero-valued proxy fields with defaults.
+func applyProxyDefaults(pc *ProxyConfig) {
+	if pc.KeepaliveInterval == "" {
+		pc.KeepaliveInterval = "30s"
+	}
+	if pc.SOCKS.Listen == "" {
+		pc.SOCKS.Listen = "127.0.0.1:1080"
+	}
+	applyStreamPoolDefaults(&pc.StreamPool)
+}
+
+// applyDirectoryDefaults fills zero-valued directory fields with defaults.
+func applyDirectoryDefaults(dc *DirectoryConfig) {
+	if dc.SyncInterval == "" {
+		dc.SyncInterval = "10m"
+	}
+}
+
+// validateLoopbackListen checks that addr is host:port with a loopback IP.
+func validateLoopbackListen(field, addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("%s must be a loopback address, got %q", field, host)
+	}
+	return nil
+}
+
+// applyDNSDefaults fills zero-valued name server fields with defaults.
+func applyDNSDefaults(dc *DNSConfig) {
+	if dc.Listen == "" {
+		dc.Listen = "127.0.0.53:5353"
+	}
+	if dc.Domain == "" {
+		dc.Domain = "peerup"
+	}
+}
+
+// applyStreamPoolDefaults fills zero-valued fields with defaults.
+func applyStreamPoolDefaults(sp *StreamPoolConfig) {
+	defaults := DefaultStreamPool()
+	if sp.Size == 0 {
+		sp.Size = defaults.Size
+	}
+	if sp.IdleTimeout == "" {
+		sp.IdleTimeout = defaults.IdleTimeout
+	}
+}
+
 // ParseDataSize parses a human-readable data size string (e.g., "128KB", "64MB", "1GB")
 // and returns the value in bytes. Supported suffixes: B, KB, MB, GB (case-insensitive).
 func ParseDataSize(s string) (int64, error) {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -446,6 +447,165 @@ func TestValidateNodeConfigServiceNames(t *testing.T) {
 	}
 }
 
+func TestValidateNodeConfigServiceLimits(t *testing.T) {
+	base := NodeConfig{
+		Identity:  IdentityConfig{KeyFile: "x"},
+		Network:   NetworkConfig{ListenAddresses: []string{"x"}},
+		Relay:     RelayConfig{Addresses: []string{"x"}},
+		Discovery: DiscoveryConfig{Rendezvous: "x"},
+		Protocols: ProtocolsConfig{PingPong: PingPongConfig{ID: "x"}},
+	}
+
+	valid := base
+	valid.Services = ServicesConfig{
+		"backup": {
+			Enabled:      true,
+			LocalAddress: "localhost:873",
+			RateLimit:    &ServiceRateLimit{PerPeer: "512KB", Total: "2MB"},
+			Quota:        &ServiceQuota{Daily: "10GB", Monthly: "100GB"},
+		},
+	}
+	if err := ValidateNodeConfig(&valid); err != nil {
+		t.Fatalf("valid limits rejected: %v", err)
+	}
+	perPeer, total, daily, monthly := ServiceLimitBytes(valid.Services["backup"])
+	if perPeer != 512<<10 || total != 2<<20 || daily != 10<<30 || monthly != 100<<30 {
+		t.Errorf("ServiceLimitBytes = %d, %d, %d, %d", perPeer, total, daily, monthly)
+	}
+
+	tests := []struct {
+		name string
+		svc  ServiceConfig
+		want string
+	}{
+		{"bad rate", ServiceConfig{RateLimit: &ServiceRateLimit{PerPeer: "fast"}}, "rate_limit.per_peer"},
+		{"zero rate", ServiceConfig{RateLimit: &ServiceRateLimit{Total: "0B"}}, "rate_limit.total"},
+		{"bad quota", ServiceConfig{Quota: &ServiceQuota{Monthly: "lots"}}, "quota.monthly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			tt.svc.LocalAddress = "localhost:873"
+			cfg.Services = ServicesConfig{"backup": tt.svc}
+			err := ValidateNodeConfig(&cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want mention of %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNodeConfigServiceAccess(t *testing.T) {
+	base := NodeConfig{
+		Identity:  IdentityConfig{KeyFile: "x"},
+		Network:   NetworkConfig{ListenAddresses: []string{"x"}},
+		Relay:     RelayConfig{Addresses: []string{"x"}},
+		Discovery: DiscoveryConfig{Rendezvous: "x"},
+		Protocols: ProtocolsConfig{PingPong: PingPongConfig{ID: "x"}},
+	}
+
+	tests := []struct {
+		name   string
+		access ServiceAccess
+		want   string // "" = valid
+	}{
+		{"valid", ServiceAccess{Windows: []string{"mon-fri 09:00-18:00"}, Timezone: "UTC", NotAfter: "2026-10-18T12:00:00Z"}, ""},
+		{"bad timezone", ServiceAccess{Timezone: "Mars/Olympus_Mons"}, "access[0].timezone"},
+		{"bad not_before", ServiceAccess{NotBefore: "tomorrow"}, "access[0].not_before"},
+		{"reversed validity", ServiceAccess{NotBefore: "2026-10-18T00:00:00Z", NotAfter: "2026-10-17T00:00:00Z"}, "not_after must be after not_before"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.Services = ServicesConfig{
+				"rdp": {Enabled: true, LocalAddress: "localhost:3389", Access: []ServiceAccess{tt.access}},
+			}
+			err := ValidateNodeConfig(&cfg)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("valid access rejected: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want mention of %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNodeConfigServiceAllowedRoles(t *testing.T) {
+	cfg := NodeConfig{
+		Identity:  IdentityConfig{KeyFile: "x"},
+		Network:   NetworkConfig{ListenAddresses: []string{"x"}},
+		Relay:     RelayConfig{Addresses: []string{"x"}},
+		Discovery: DiscoveryConfig{Rendezvous: "x"},
+		Protocols: ProtocolsConfig{PingPong: PingPongConfig{ID: "x"}},
+		Services: ServicesConfig{
+			"grafana": {Enabled: true, LocalAddress: "localhost:3000", AllowedRoles: []string{"ops", "on-call"}},
+		},
+	}
+	if err := ValidateNodeConfig(&cfg); err != nil {
+		t.Fatalf("valid roles rejected: %v", err)
+	}
+
+	cfg.Services["grafana"] = ServiceConfig{Enabled: true, LocalAddress: "localhost:3000", AllowedRoles: []string{"admin,ops"}}
+	err := ValidateNodeConfig(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "services.grafana.allowed_roles") {
+		t.Errorf("err = %v, want mention of services.grafana.allowed_roles", err)
+	}
+}
+
+func TestValidateNodeConfigServiceDescription(t *testing.T) {
+	cfg := NodeConfig{
+		Identity:  IdentityConfig{KeyFile: "x"},
+		Network:   NetworkConfig{ListenAddresses: []string{"x"}},
+		Relay:     RelayConfig{Addresses: []string{"x"}},
+		Discovery: DiscoveryConfig{Rendezvous: "x"},
+		Protocols: ProtocolsConfig{PingPong: PingPongConfig{ID: "x"}},
+		Services: ServicesConfig{
+			"grafana": {Enabled: true, LocalAddress: "localhost:3000", Description: "Team dashboards"},
+		},
+	}
+	if err := ValidateNodeConfig(&cfg); err != nil {
+		t.Fatalf("valid description rejected: %v", err)
+	}
+
+	cfg.Services["grafana"] = ServiceConfig{Enabled: true, LocalAddress: "localhost:3000", Description: strings.Repeat("x", MaxServiceDescriptionLen+1)}
+	err := ValidateNodeConfig(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "services.grafana.description") {
+		t.Errorf("err = %v, want mention of services.grafana.description", err)
+	}
+}
+
+func TestValidateNodeConfigServiceLocalAddress(t *testing.T) {
+	cfg := NodeConfig{
+		Identity:  IdentityConfig{KeyFile: "x"},
+		Network:   NetworkConfig{ListenAddresses: []string{"x"}},
+		Relay:     RelayConfig{Addresses: []string{"x"}},
+		Discovery: DiscoveryConfig{Rendezvous: "x"},
+		Protocols: ProtocolsConfig{PingPong: PingPongConfig{ID: "x"}},
+		Services: ServicesConfig{
+			"docker": {Enabled: true, LocalAddress: "unix:/var/run/docker.sock"},
+		},
+	}
+	if err := ValidateNodeConfig(&cfg); err != nil {
+		t.Fatalf("unix socket address rejected: %v", err)
+	}
+
+	for _, svc := range []ServiceConfig{
+		{Enabled: true, LocalAddress: "unix:docker.sock"},
+		{Enabled: true, LocalAddress: "localhost"},
+		{Enabled: true, LocalAddress: "unix:/run/dns.sock", Protocol: ServiceProtocolUDP},
+	} {
+		cfg.Services["docker"] = svc
+		err := ValidateNodeConfig(&cfg)
+		if err == nil || !strings.Contains(err.Error(), "services.docker") {
+			t.Errorf("%+v: err = %v, want mention of services.docker", svc, err)
+		}
+	}
+}
+
 func TestParseDataSize(t *testing.T) {
 	tests := []struct {
 		input string
@@ -578,6 +738,22 @@ func TestValidateRelayServerConfigBadDataSize(t *testing.T) {
 	}
 }
 
+func TestValidateRelayServerConfigBadBandwidth(t *testing.T) {
+	cfg := &RelayServerConfig{
+		Identity:  IdentityConfig{KeyFile: "key"},
+		Network:   RelayNetworkConfig{ListenAddresses: []string{"/ip4/0.0.0.0/tcp/7777"}},
+		Resources: RelayResourcesConfig{Bandwidth: "fast"},
+	}
+
+	if err := ValidateRelayServerConfig(cfg); err == nil {
+		t.Error("expected error for invalid bandwidth")
+	}
+	cfg.Resources.Bandwidth = "20MB"
+	if err := ValidateRelayServerConfig(cfg); err != nil {
+		t.Errorf("valid bandwidth rejected: %v", err)
+	}
+}
+
 func TestDefaultConfigDir(t *testing.T) {
 	dir, err := DefaultConfigDir()
 	if err != nil {
@@ -723,3 +899,319 @@ func TestValidateClientNodeConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceConfigIsUDP(t *testing.T) {
+	tests := []struct {
+		protocol string
+		want     bool
+	}{
+		{"", false},
+		{"/custom/proto/1.0.0", false},
+		{"udp", true},
+		{"UDP", true},
+	}
+	for _, tt := range tests {
+		svc := ServiceConfig{Protocol: tt.protocol}
+		if got := svc.IsUDP(); got != tt.want {
+			t.Errorf("IsUDP(%q) = %v, want %v", tt.protocol, got, tt.want)
+		}
+	}
+}
+
+func TestLoadNodeConfigStreamPoolDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, testConfigYAML)
+
+	cfg, err := LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if cfg.Proxy.StreamPool != DefaultStreamPool() {
+		t.Errorf("StreamPool = %+v, want defaults %+v", cfg.Proxy.StreamPool, DefaultStreamPool())
+	}
+
+	custom := testConfigYAML + `
+proxy:
+  stream_pool:
+    size: 4
+    idle_timeout: "10s"
+`
+	path = writeTestConfig(t, dir, custom)
+	cfg, err = LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if cfg.Proxy.StreamPool.Size != 4 || cfg.Proxy.StreamPool.IdleTimeout != "10s" {
+		t.Errorf("StreamPool = %+v, want size 4, idle 10s", cfg.Proxy.StreamPool)
+	}
+	if err := ValidateNodeConfig(cfg); err != nil {
+		t.Errorf("ValidateNodeConfig: %v", err)
+	}
+
+	cfg.Proxy.StreamPool.IdleTimeout = "soon"
+	if err := ValidateNodeConfig(cfg); err == nil {
+		t.Error("expected error for invalid idle_timeout")
+	}
+	cfg.Proxy.StreamPool.IdleTimeout = "10s"
+	cfg.Proxy.StreamPool.Size = -1
+	if err := ValidateNodeConfig(cfg); err == nil {
+		t.Error("expected error for negative size")
+	}
+}
+
+func TestLoadNodeConfigProxyWarmup(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, testConfigYAML)
+
+	cfg, err := LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if cfg.Proxy.Warmup {
+		t.Error("warmup should be off by default")
+	}
+	if cfg.Proxy.KeepaliveInterval != "30s" {
+		t.Errorf("KeepaliveInterval = %q, want 30s", cfg.Proxy.KeepaliveInterval)
+	}
+
+	custom := testConfigYAML + `
+proxy:
+  warmup: true
+  keepalive_interval: "15s"
+`
+	path = writeTestConfig(t, dir, custom)
+	cfg, err = LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if !cfg.Proxy.Warmup || cfg.Proxy.KeepaliveInterval != "15s" {
+		t.Errorf("Proxy = %+v, want warmup with 15s interval", cfg.Proxy)
+	}
+	if err := ValidateNodeConfig(cfg); err != nil {
+		t.Errorf("ValidateNodeConfig: %v", err)
+	}
+
+	cfg.Proxy.KeepaliveInterval = "100ms"
+	if err := ValidateNodeConfig(cfg); err == nil {
+		t.Error("expected error for keepalive_interval below 1s")
+	}
+	cfg.Proxy.KeepaliveInterval = "often"
+	if err := ValidateNodeConfig(cfg); err == nil {
+		t.Error("expected error for invalid keepalive_interval")
+	}
+}
+
+func TestLoadNodeConfigDirectory(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, testConfigYAML+`
+directory:
+  enabled: true
+`)
+
+	cfg, err := LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if !cfg.Directory.Enabled {
+		t.Error("directory should be enabled")
+	}
+	if cfg.Directory.SyncInterval != "10m" {
+		t.Errorf("SyncInterval = %q, want 10m", cfg.Directory.SyncInterval)
+	}
+	if err := ValidateNodeConfig(cfg); err != nil {
+		t.Errorf("ValidateNodeConfig: %v", err)
+	}
+
+	cfg.Directory.SyncInterval = "1s"
+	if err := ValidateNodeConfig(cfg); err == nil {
+		t.Error("expected error for sync_interval below 10s")
+	}
+	cfg.Directory.SyncInterval = "10m"
+	cfg.Security.EnableConnectionGating = false
+	if err := ValidateNodeConfig(cfg); err == nil {
+		t.Error("expected error when connection gating is disabled")
+	}
+}
+
+func TestLoadNodeConfigMDNS(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, strings.Replace(testConfigYAML, "discovery:\n", "discovery:\n  mdns: true\n", 1))
+
+	cfg, err := LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if !cfg.Discovery.MDNS {
+		t.Error("discovery.mdns should be enabled")
+	}
+	if err := ValidateNodeConfig(cfg); err != nil {
+		t.Errorf("ValidateNodeConfig: %v", err)
+	}
+
+	cfg.Security.EnableConnectionGating = false
+	if err := ValidateNodeConfig(cfg); err == nil || !strings.Contains(err.Error(), "discovery.mdns") {
+		t.Errorf("err = %v, want discovery.mdns gating error", err)
+	}
+}
+
+func TestLoadNodeConfigDNS(t *testing.T) {
+	defer func(v bool) { perPeerLoopback = v }(perPeerLoopback)
+	perPeerLoopback = true
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, testConfigYAML+`
+dns:
+  enabled: true
+  ports:
+    ssh: 22
+    web: 8080
+`)
+
+	cfg, err := LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if !cfg.DNS.Enabled || cfg.DNS.Ports["ssh"] != 22 {
+		t.Errorf("DNS = %+v", cfg.DNS)
+	}
+	if cfg.DNS.Listen != "127.0.0.53:5353" || cfg.DNS.Domain != "peerup" {
+		t.Errorf("defaults: listen = %q, domain = %q", cfg.DNS.Listen, cfg.DNS.Domain)
+	}
+	if err := ValidateNodeConfig(cfg); err != nil {
+		t.Errorf("ValidateNodeConfig: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*DNSConfig)
+	}{
+		{"non-loopback listen", func(dc *DNSConfig) { dc.Listen = "0.0.0.0:53" }},
+		{"missing port", func(dc *DNSConfig) { dc.Listen = "127.0.0.1" }},
+		{"dotted domain", func(dc *DNSConfig) { dc.Domain = "peer.up" }},
+		{"port out of range", func(dc *DNSConfig) { dc.Ports["ssh"] = 70000 }},
+		{"duplicate port", func(dc *DNSConfig) { dc.Ports["web"] = 22 }},
+		{"invalid service name", func(dc *DNSConfig) { dc.Ports["Bad_Name"] = 9000 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *cfg
+			c.DNS = DNSConfig{Listen: cfg.DNS.Listen, Domain: cfg.DNS.Domain, Ports: map[string]int{"ssh": 22, "web": 8080}}
+			tt.modify(&c.DNS)
+			if err := ValidateNodeConfig(&c); err == nil || !strings.Contains(err.Error(), "dns.") {
+				t.Errorf("ValidateNodeConfig() error = %v, want dns error", err)
+			}
+		})
+	}
+
+	// Without per-peer loopback addresses the proxies can't listen, but
+	// dns.ports still serves the SOCKS proxy with the name server off.
+	perPeerLoopback = false
+	if err := ValidateNodeConfig(cfg); err == nil || !strings.Contains(err.Error(), "only supported on Linux") {
+		t.Errorf("ValidateNodeConfig() off Linux error = %v", err)
+	}
+	c := *cfg
+	c.DNS.Enabled = false
+	if err := ValidateNodeConfig(&c); err != nil {
+		t.Errorf("ValidateNodeConfig() with dns.enabled off: %v", err)
+	}
+}
+
+func TestLoadNodeConfigSOCKS(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, testConfigYAML+`
+proxy:
+  socks:
+    enabled: true
+`)
+
+	cfg, err := LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if !cfg.Proxy.SOCKS.Enabled || cfg.Proxy.SOCKS.Listen != "127.0.0.1:1080" {
+		t.Errorf("SOCKS = %+v, want enabled on 127.0.0.1:1080", cfg.Proxy.SOCKS)
+	}
+	if err := ValidateNodeConfig(cfg); err != nil {
+		t.Errorf("ValidateNodeConfig: %v", err)
+	}
+
+	cfg.Proxy.SOCKS.Listen = "0.0.0.0:1080"
+	if err := ValidateNodeConfig(cfg); err == nil || !strings.Contains(err.Error(), "proxy.socks.listen") {
+		t.Errorf("expected loopback error, got %v", err)
+	}
+}
+
+func TestLoadNodeConfigReverseTunnels(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, testConfigYAML+`
+reverse_tunnels:
+  allow:
+    12D3KooWLaptop:
+      - "0.0.0.0:8080"
+      - "127.0.0.1:*"
+`)
+
+	cfg, err := LoadNodeConfig(path)
+	if err != nil {
+		t.Fatalf("LoadNodeConfig: %v", err)
+	}
+	if got := cfg.ReverseTunnels.Allow["12D3KooWLaptop"]; len(got) != 2 {
+		t.Fatalf("Allow = %v", cfg.ReverseTunnels.Allow)
+	}
+	if err := ValidateNodeConfig(cfg); err != nil {
+		t.Errorf("ValidateNodeConfig: %v", err)
+	}
+
+	for _, rule := range []string{"localhost:8080", "0.0.0.0:0", "0.0.0.0:http", "8080"} {
+		cfg.ReverseTunnels.Allow["12D3KooWLaptop"] = []string{rule}
+		if err := ValidateNodeConfig(cfg); err == nil {
+			t.Errorf("expected error for rule %q", rule)
+		}
+	}
+
+	cfg.ReverseTunnels.Allow["12D3KooWLaptop"] = []string{"0.0.0.0:8080"}
+	cfg.Security.EnableConnectionGating = false
+	if err := ValidateNodeConfig(cfg); err == nil {
+		t.Error("expected error when connection gating is disabled")
+	}
+}
+
+func TestValidateRelayServerConfigFederationPeers(t *testing.T) {
+	cfg := &RelayServerConfig{
+		Identity: IdentityConfig{KeyFile: "key"},
+		Network:  RelayNetworkConfig{ListenAddresses: []string{"/ip4/0.0.0.0/tcp/7777"}},
+		Security: RelaySecurityConfig{AuthorizedKeysFile: "relay_authorized_keys"},
+		Federation: RelayFederationConfig{Peers: []string{
+			"/ip4/203.0.113.5/tcp/7777/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN",
+		}},
+	}
+	if err := ValidateRelayServerConfig(cfg); err != nil {
+		t.Errorf("valid federation peer rejected: %v", err)
+	}
+
+	cfg.Federation.Peers = append(cfg.Federation.Peers, "/ip4/203.0.113.6/tcp/7777")
+	if err := ValidateRelayServerConfig(cfg); err == nil {
+		t.Error("expected error for a federation peer without /p2p/")
+	}
+
+	cfg.Federation.Peers = cfg.Federation.Peers[:1]
+	cfg.Security.AuthorizedKeysFile = ""
+	if err := ValidateRelayServerConfig(cfg); err == nil {
+		t.Error("expected error for federation without authorized_keys_file")
+	}
+}
+
+func TestValidateRelayServerConfigInviteMailbox(t *testing.T) {
+	cfg := &RelayServerConfig{
+		Identity: IdentityConfig{KeyFile: "key"},
+		Network:  RelayNetworkConfig{ListenAddresses: []string{"/ip4/0.0.0.0/tcp/7777"}},
+		Security: RelaySecurityConfig{AuthorizedKeysFile: "relay_authorized_keys", InviteMailbox: true},
+	}
+	if err := ValidateRelayServerConfig(cfg); err != nil {
+		t.Errorf("valid invite mailbox config rejected: %v", err)
+	}
+
+	cfg.Security.AuthorizedKeysFile = ""
+	if err := ValidateRelayServerConfig(cfg); err == nil {
+		t.Error("expected error for invite_mailbox without authorized_keys_file")
+	}
+}
@@ -7,8 +7,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/satindergrewal/peer-up/pkg/p2pnet"
 )
@@ -215,6 +217,28 @@ func (c *Client) AuthAdd(peerID, comment string) error {
 	return c.doJSON("POST", "/v1/auth", strings.NewReader(string(body)), nil)
 }
 
+// AuthRevoke revokes a pairing group member and gossips the notice to the
+// rest of the group.
+func (c *Client) AuthRevoke(peerID, reason string) (*AuthRevokeResponse, error) {
+	body, _ := json.Marshal(AuthRevokeRequest{PeerID: peerID, Reason: reason})
+	var resp AuthRevokeResponse
+	if err := c.doJSON("POST", "/v1/auth/revoke", strings.NewReader(string(body)), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// KeyRotate asks the daemon to announce a signed key rotation statement to
+// its connected authorized peers.
+func (c *Client) KeyRotate(kr *p2pnet.KeyRotation) (*KeyRotateResponse, error) {
+	body, _ := json.Marshal(kr)
+	var resp KeyRotateResponse
+	if err := c.doJSON("POST", "/v1/key/rotate", strings.NewReader(string(body)), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // AuthRemove removes an authorized peer.
 func (c *Client) AuthRemove(peerID string) error {
 	return c.doJSON("DELETE", "/v1/auth/"+peerID, nil, nil)
@@ -274,9 +298,43 @@ func (c *Client) ResolveText(name string) (string, error) {
 	return c.doText("POST", "/v1/resolve", strings.NewReader(string(body)))
 }
 
+// Names returns the merged name view with each entry's origin.
+func (c *Client) Names() (*NamesResponse, error) {
+	var resp NamesResponse
+	if err := c.doJSON("GET", "/v1/names", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// NamesSync publishes local name changes and syncs the directory with
+// peer, or with every connected authorized peer if peer is empty.
+func (c *Client) NamesSync(peer string) (*NamesSyncResponse, error) {
+	body, _ := json.Marshal(NamesSyncRequest{Peer: peer})
+	var resp NamesSyncResponse
+	if err := c.doJSON("POST", "/v1/names/sync", strings.NewReader(string(body)), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PeerServices asks peer which of its services this node may use.
+func (c *Client) PeerServices(peer string) (*PeerServicesResponse, error) {
+	var resp PeerServicesResponse
+	if err := c.doJSON("GET", "/v1/peers/"+url.PathEscape(peer)+"/services", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
 // Connect creates a TCP proxy to a remote service via the daemon.
 func (c *Client) Connect(peer, service, listen string) (*ConnectResponse, error) {
-	req := ConnectRequest{Peer: peer, Service: service, Listen: listen}
+	return c.ConnectWith(ConnectRequest{Peer: peer, Service: service, Listen: listen})
+}
+
+// ConnectWith creates a proxy with the full set of request options
+// (protocol, warmup) to a remote service via the daemon.
+func (c *Client) ConnectWith(req ConnectRequest) (*ConnectResponse, error) {
 	body, _ := json.Marshal(req)
 	var resp ConnectResponse
 	if err := c.doJSON("POST", "/v1/connect", strings.NewReader(string(body)), &resp); err != nil {
@@ -290,6 +348,56 @@ func (c *Client) Disconnect(id string) error {
 	return c.doJSON("DELETE", "/v1/connect/"+id, nil, nil)
 }
 
+// Tunnels lists reverse tunnels in both directions.
+func (c *Client) Tunnels() ([]TunnelInfo, error) {
+	var resp []TunnelInfo
+	if err := c.doJSON("GET", "/v1/tunnels", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ReverseTunnel asks peer to listen on remoteListen and forward accepted
+// connections to localAddr on this node.
+func (c *Client) ReverseTunnel(peer, remoteListen, localAddr string) (*TunnelInfo, error) {
+	body, _ := json.Marshal(ReverseTunnelRequest{Peer: peer, RemoteListen: remoteListen, LocalAddr: localAddr})
+	var resp TunnelInfo
+	if err := c.doJSON("POST", "/v1/tunnels/reverse", strings.NewReader(string(body)), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CloseTunnel tears down a reverse tunnel.
+func (c *Client) CloseTunnel(id string) error {
+	return c.doJSON("DELETE", "/v1/tunnels/"+url.PathEscape(id), nil, nil)
+}
+
+// CreateInvite creates an asynchronous invite that the joiner can redeem
+// while this daemon is offline.
+func (c *Client) CreateInvite(name string, ttl time.Duration) (*InviteInfo, error) {
+	body, _ := json.Marshal(InviteRequest{Name: name, TTLSeconds: int(ttl / time.Second)})
+	var resp InviteInfo
+	if err := c.doJSON("POST", "/v1/invites", strings.NewReader(string(body)), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Invites lists pending asynchronous invites.
+func (c *Client) Invites() ([]InviteInfo, error) {
+	var resp []InviteInfo
+	if err := c.doJSON("GET", "/v1/invites", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CancelInvite withdraws a pending asynchronous invite.
+func (c *Client) CancelInvite(id string) error {
+	return c.doJSON("DELETE", "/v1/invites/"+url.PathEscape(id), nil, nil)
+}
+
 // Expose registers a service on the P2P host.
 func (c *Client) Expose(name, localAddress string) error {
 	req := ExposeRequest{Name: name, LocalAddress: localAddress}
@@ -306,3 +414,82 @@ func (c *Client) Unexpose(name string) error {
 func (c *Client) Shutdown() error {
 	return c.doJSON("POST", "/v1/shutdown", nil, nil)
 }
+
+// --- Event stream ---
+
+// EventsRequest selects events for Events and EventsText.
+type EventsRequest struct {
+	Types []string // event types or prefixes (e.g. "peer", "path.upgraded"); empty = all
+	Peer  string   // peer name or ID; empty = all
+}
+
+// openEvents starts a GET /v1/events stream in the given format. The
+// caller must close the returned body.
+func (c *Client) openEvents(ctx context.Context, req EventsRequest, format string) (io.ReadCloser, error) {
+	q := url.Values{"format": {format}}
+	if len(req.Types) > 0 {
+		q.Set("types", strings.Join(req.Types, ","))
+	}
+	if req.Peer != "" {
+		q.Set("peer", req.Peer)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", "http://daemon/v1/events?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.authToken)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var errResp ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&errResp) == nil && errResp.Error != "" {
+			return nil, fmt.Errorf("daemon: %s", errResp.Error)
+		}
+		return nil, fmt.Errorf("daemon returned HTTP %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// Events streams daemon events to fn until ctx is cancelled, the daemon
+// stops, or fn returns an error. Returns nil when ctx is cancelled or the
+// daemon closes the stream.
+func (c *Client) Events(ctx context.Context, req EventsRequest, fn func(p2pnet.Event) error) error {
+	body, err := c.openEvents(ctx, req, "ndjson")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var e p2pnet.Event
+		if err := dec.Decode(&e); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("event stream: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+// EventsText copies the human-readable event stream to w until ctx is
+// cancelled or the daemon stops.
+func (c *Client) EventsText(ctx context.Context, req EventsRequest, w io.Writer) error {
+	body, err := c.openEvents(ctx, req, "text")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if _, err := io.Copy(w, body); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("event stream: %w", err)
+	}
+	return nil
+}
@@ -39,6 +39,11 @@ func (m *mockRuntime) Interfaces() *p2pnet.InterfaceSummary             { return
 func (m *mockRuntime) PathTracker() *p2pnet.PathTracker                 { return nil }
 func (m *mockRuntime) STUNResult() *p2pnet.STUNResult                   { return nil }
 func (m *mockRuntime) IsRelaying() bool                                  { return false }
+func (m *mockRuntime) RelayHealth() *p2pnet.RelayHealth                   { return nil }
+func (m *mockRuntime) Revoker() Revoker                                   { return nil }
+func (m *mockRuntime) Directory() DirectorySyncer                         { return nil }
+func (m *mockRuntime) Inviter() Inviter                                   { return nil }
+func (m *mockRuntime) Tunnels() *p2pnet.ReverseTunnels                    { return nil }
 
 func newMockRuntime() *mockRuntime {
 	return &mockRuntime{
@@ -972,3 +977,120 @@ func TestComputePingStats_AllErrors(t *testing.T) {
 		t.Errorf("expected all RTT stats to be 0, got min=%f avg=%f max=%f", stats.MinMs, stats.AvgMs, stats.MaxMs)
 	}
 }
+
+// startEventsServer starts a daemon server on a test network and returns a
+// client for it.
+func startEventsServer(t *testing.T) (*Server, *Client, *p2pnet.Network) {
+	t.Helper()
+	dir := t.TempDir()
+	socketPath := filepath.Join(dir, "test.sock")
+	cookiePath := filepath.Join(dir, ".test-cookie")
+
+	net := newTestNetwork(t)
+	rt := &networkMockRuntime{net: net, version: "test-0.1.0", startTime: time.Now(), pingProto: "/peerup/ping/1.0.0"}
+	srv := NewServer(rt, socketPath, cookiePath, "test-0.1.0")
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	client, err := NewClient(socketPath, cookiePath)
+	if err != nil {
+		srv.Stop()
+		t.Fatalf("NewClient: %v", err)
+	}
+	return srv, client, net
+}
+
+// waitForSubscribers blocks until the feed has n subscribers.
+func waitForSubscribers(t *testing.T, f *p2pnet.EventFeed, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for f.SubscriberCount() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d event subscribers", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	srv, client, net := startEventsServer(t)
+	defer srv.Stop()
+
+	events := make(chan p2pnet.Event, 4)
+	errCh := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		errCh <- client.Events(ctx, EventsRequest{Types: []string{"service"}}, func(e p2pnet.Event) error {
+			events <- e
+			return nil
+		})
+	}()
+	waitForSubscribers(t, net.Events(), 1)
+
+	// Filtered out by type.
+	net.Events().Publish(p2pnet.EventPeerConnected, "", nil)
+	if err := client.Expose("web", "localhost:8080"); err != nil {
+		t.Fatalf("Expose: %v", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != p2pnet.EventServiceExposed || e.Data["service"] != "web" {
+			t.Errorf("event = %+v", e)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for service.exposed event")
+	}
+
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Events returned %v after cancel", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Events did not return after cancel")
+	}
+}
+
+func TestEventsSSEAndStop(t *testing.T) {
+	srv, client, net := startEventsServer(t)
+
+	req, _ := http.NewRequest("GET", "http://daemon/v1/events", nil)
+	req.Header.Set("Authorization", "Bearer "+client.authToken)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /v1/events: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	waitForSubscribers(t, net.Events(), 1)
+
+	net.Events().Publish(p2pnet.EventNetworkChanged, "", map[string]any{"added": []string{"203.0.113.7"}})
+
+	// Stop must end the open stream rather than wait out the shutdown timeout.
+	start := time.Now()
+	srv.Stop()
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Stop took %v with an open event stream", elapsed)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "event: network.changed\n") || !strings.Contains(string(body), `"203.0.113.7"`) {
+		t.Errorf("SSE body = %q", body)
+	}
+}
+
+func TestEventsUnknownPeer(t *testing.T) {
+	srv, client, _ := startEventsServer(t)
+	defer srv.Stop()
+
+	err := client.Events(context.Background(), EventsRequest{Peer: "nobody"}, func(p2pnet.Event) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "cannot resolve peer") {
+		t.Errorf("err = %v, want cannot resolve peer", err)
+	}
+}
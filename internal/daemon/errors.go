@@ -17,4 +17,8 @@ var (
 
 	// ErrUnauthorized is returned when a request lacks valid authentication.
 	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrInviteNotFound is returned when cancelling an asynchronous invite
+	// that does not exist, was already redeemed, or has expired.
+	ErrInviteNotFound = errors.New("invite not found")
 )
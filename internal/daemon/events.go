@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
+)
+
+// sseKeepaliveInterval is how often an idle SSE stream gets a comment line,
+// so proxies and clients can tell a quiet feed from a dead connection.
+const sseKeepaliveInterval = 15 * time.Second
+
+// Event stream formats for GET /v1/events.
+const (
+	eventFormatNDJSON = "ndjson" // one JSON event per line (default)
+	eventFormatSSE    = "sse"    // Server-Sent Events
+	eventFormatText   = "text"   // one human-readable line per event
+)
+
+// eventStreamFormat picks the stream format from ?format= or the Accept header.
+func eventStreamFormat(r *http.Request) string {
+	switch f := r.URL.Query().Get("format"); f {
+	case eventFormatSSE, eventFormatText, eventFormatNDJSON:
+		return f
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "text/event-stream"):
+		return eventFormatSSE
+	case strings.Contains(accept, "text/plain"):
+		return eventFormatText
+	}
+	return eventFormatNDJSON
+}
+
+// handleEvents streams runtime events until the client disconnects or the
+// daemon stops. Query parameters: types (comma-separated types or
+// prefixes, e.g. "peer,path.upgraded"), peer (name or peer ID), format
+// (ndjson, sse or text).
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	pnet := s.runtime.Network()
+
+	var filter p2pnet.EventFilter
+	if types := r.URL.Query().Get("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				filter.Types = append(filter.Types, t)
+			}
+		}
+	}
+	if name := r.URL.Query().Get("peer"); name != "" {
+		pid, err := pnet.ResolveName(name)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("cannot resolve peer %q: %v", name, err))
+			return
+		}
+		filter.Peer = pid.String()
+	}
+
+	format := eventStreamFormat(r)
+	sub := pnet.Events().Subscribe(filter, 0)
+	defer sub.Close()
+
+	// The server-wide write timeout would cut the stream; the handler
+	// ends on client disconnect or Stop instead.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	switch format {
+	case eventFormatSSE:
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	case eventFormatText:
+		w.Header().Set("Content-Type", "text/plain")
+	default:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.stopCh:
+			return
+		case <-keepalive.C:
+			if format != eventFormatSSE {
+				continue
+			}
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			var err error
+			switch format {
+			case eventFormatSSE:
+				data, _ := json.Marshal(e)
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+			case eventFormatText:
+				_, err = fmt.Fprintln(w, formatEventText(e))
+			default:
+				err = enc.Encode(e)
+			}
+			if err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// formatEventText renders an event as "time type [peer] key=value ...".
+func formatEventText(e p2pnet.Event) string {
+	var sb strings.Builder
+	sb.WriteString(e.Time)
+	sb.WriteString(" ")
+	sb.WriteString(e.Type)
+	if e.Peer != "" {
+		sb.WriteString(" ")
+		sb.WriteString(e.Peer[:min(16, len(e.Peer))] + "...")
+	}
+	keys := make([]string, 0, len(e.Data))
+	for k := range e.Data {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, " %s=%v", k, e.Data[k])
+	}
+	return sb.String()
+}
@@ -3,17 +3,21 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 
 	"github.com/satindergrewal/peer-up/internal/auth"
+	"github.com/satindergrewal/peer-up/internal/validate"
 	"github.com/satindergrewal/peer-up/pkg/p2pnet"
 )
 
@@ -27,18 +31,30 @@ func (s *Server) registerRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /v1/status", s.handleStatus)
 	mux.HandleFunc("GET /v1/services", s.handleServiceList)
 	mux.HandleFunc("GET /v1/peers", s.handlePeerList)
+	mux.HandleFunc("GET /v1/peers/{peer}/services", s.handlePeerServices)
 	mux.HandleFunc("GET /v1/auth", s.handleAuthList)
 
 	mux.HandleFunc("GET /v1/paths", s.handlePaths)
+	mux.HandleFunc("GET /v1/events", s.handleEvents)
+	mux.HandleFunc("GET /v1/names", s.handleNames)
+	mux.HandleFunc("GET /v1/tunnels", s.handleTunnelList)
+	mux.HandleFunc("GET /v1/invites", s.handleInviteList)
 
 	// Mutations
 	mux.HandleFunc("POST /v1/auth", s.handleAuthAdd)
 	mux.HandleFunc("DELETE /v1/auth/{peer_id}", s.handleAuthRemove)
+	mux.HandleFunc("POST /v1/auth/revoke", s.handleAuthRevoke)
+	mux.HandleFunc("POST /v1/key/rotate", s.handleKeyRotate)
 	mux.HandleFunc("POST /v1/ping", s.handlePing)
 	mux.HandleFunc("POST /v1/traceroute", s.handleTraceroute)
 	mux.HandleFunc("POST /v1/resolve", s.handleResolve)
+	mux.HandleFunc("POST /v1/names/sync", s.handleNamesSync)
 	mux.HandleFunc("POST /v1/connect", s.handleConnect)
 	mux.HandleFunc("DELETE /v1/connect/{id}", s.handleDisconnect)
+	mux.HandleFunc("POST /v1/tunnels/reverse", s.handleReverseTunnel)
+	mux.HandleFunc("DELETE /v1/tunnels/{id}", s.handleTunnelClose)
+	mux.HandleFunc("POST /v1/invites", s.handleInviteCreate)
+	mux.HandleFunc("DELETE /v1/invites/{id}", s.handleInviteCancel)
 	mux.HandleFunc("POST /v1/expose", s.handleExpose)
 	mux.HandleFunc("DELETE /v1/expose/{name}", s.handleUnexpose)
 	mux.HandleFunc("POST /v1/shutdown", s.handleShutdown)
@@ -127,6 +143,11 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	grade := p2pnet.ComputeReachabilityGrade(rt.Interfaces(), rt.STUNResult())
 	resp.Reachability = &grade
 
+	// Per-relay health
+	if rh := rt.RelayHealth(); rh != nil {
+		resp.Relays = rh.Status()
+	}
+
 	if wantsText(r) {
 		var sb strings.Builder
 		fmt.Fprintf(&sb, "peer_id: %s\n", resp.PeerID)
@@ -157,6 +178,13 @@ func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 		for _, a := range resp.RelayAddrs {
 			fmt.Fprintf(&sb, "  %s\n", a)
 		}
+		if len(resp.Relays) > 0 {
+			fmt.Fprintf(&sb, "relays: %d\n", len(resp.Relays))
+			for _, rs := range resp.Relays {
+				fmt.Fprintf(&sb, "  %s score=%.2f healthy=%v rtt=%.1fms reserved=%v\n",
+					rs.PeerID[:16]+"...", rs.Score, rs.Healthy, rs.RTTMs, rs.Reserved)
+			}
+		}
 		respondText(w, http.StatusOK, sb.String())
 		return
 	}
@@ -239,6 +267,47 @@ func (s *Server) handlePeerList(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, peers)
 }
 
+// handlePeerServices asks a remote peer which of its services this node
+// may use. Services the peer denies us are never part of its answer.
+func (s *Server) handlePeerServices(w http.ResponseWriter, r *http.Request) {
+	target := r.PathValue("peer")
+	pid, err := s.runtime.Network().ResolveName(target)
+	if err != nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("cannot resolve peer %q: %v", target, err))
+		return
+	}
+
+	if err := s.runtime.ConnectToPeer(r.Context(), pid); err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("cannot reach peer %q: %v", target, err))
+		return
+	}
+	services, err := s.runtime.Network().QueryServices(r.Context(), pid)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("service query to %q failed: %v", target, err))
+		return
+	}
+
+	resp := PeerServicesResponse{PeerID: pid.String(), Services: make([]RemoteServiceInfo, 0, len(services))}
+	for _, svc := range services {
+		resp.Services = append(resp.Services, RemoteServiceInfo{
+			Name:        svc.Name,
+			Transport:   svc.Transport,
+			Description: svc.Description,
+		})
+	}
+
+	if wantsText(r) {
+		var sb strings.Builder
+		for _, svc := range resp.Services {
+			fmt.Fprintf(&sb, "%s\t%s\t%s\n", svc.Name, svc.Transport, svc.Description)
+		}
+		respondText(w, http.StatusOK, sb.String())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
 func (s *Server) handlePaths(w http.ResponseWriter, r *http.Request) {
 	tracker := s.runtime.PathTracker()
 	if tracker == nil {
@@ -259,8 +328,12 @@ func (s *Server) handlePaths(w http.ResponseWriter, r *http.Request) {
 			if p.LastRTTMs > 0 {
 				rttStr = fmt.Sprintf("%.1fms", p.LastRTTMs)
 			}
-			fmt.Fprintf(&sb, "%s\t%s\t%s\t%s\trtt=%s\n",
-				peerShort, p.PathType, p.Transport, p.IPVersion, rttStr)
+			upgraded := ""
+			if p.UpgradedAt != "" {
+				upgraded = "\tupgraded=" + p.UpgradedAt
+			}
+			fmt.Fprintf(&sb, "%s\t%s\t%s\t%s\trtt=%s%s\n",
+				peerShort, p.PathType, p.Transport, p.IPVersion, rttStr, upgraded)
 		}
 		respondText(w, http.StatusOK, sb.String())
 		return
@@ -289,6 +362,7 @@ func (s *Server) handleAuthList(w http.ResponseWriter, r *http.Request) {
 			Comment:  p.Comment,
 			Verified: p.Verified,
 			Group:    p.Group,
+			Roles:    p.Roles,
 		}
 		if !p.ExpiresAt.IsZero() {
 			e.ExpiresAt = p.ExpiresAt.Format(time.RFC3339)
@@ -299,10 +373,14 @@ func (s *Server) handleAuthList(w http.ResponseWriter, r *http.Request) {
 	if wantsText(r) {
 		var sb strings.Builder
 		for _, e := range entries {
+			line := e.PeerID
+			if len(e.Roles) > 0 {
+				line += "\trole=" + strings.Join(e.Roles, ",")
+			}
 			if e.Comment != "" {
-				fmt.Fprintf(&sb, "%s\t# %s\n", e.PeerID, e.Comment)
+				fmt.Fprintf(&sb, "%s\t# %s\n", line, e.Comment)
 			} else {
-				fmt.Fprintf(&sb, "%s\n", e.PeerID)
+				fmt.Fprintf(&sb, "%s\n", line)
 			}
 		}
 		respondText(w, http.StatusOK, sb.String())
@@ -346,6 +424,74 @@ func (s *Server) handleAuthAdd(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{"status": "added"})
 }
 
+// handleKeyRotate announces a key rotation statement, signed by the
+// caller with the old and new keys, to every connected authorized peer.
+// The daemon holds no new key material: it only vouches with its live
+// connections, so the statement's old peer ID must be this node.
+func (s *Server) handleKeyRotate(w http.ResponseWriter, r *http.Request) {
+	var kr p2pnet.KeyRotation
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&kr); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	authPath := s.runtime.AuthKeysPath()
+	if authPath == "" {
+		respondError(w, http.StatusBadRequest, "connection gating is not enabled")
+		return
+	}
+
+	pnet := s.runtime.Network()
+	oldID, newID, err := kr.Verify(time.Now())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if oldID != pnet.PeerID() {
+		respondError(w, http.StatusBadRequest, "statement is not for this node's identity")
+		return
+	}
+
+	entries, err := auth.ListPeers(authPath)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := KeyRotateResponse{
+		OldPeerID:    oldID.String(),
+		NewPeerID:    newID.String(),
+		Notified:     []string{},
+		Failed:       []KeyRotateFailure{},
+		NotConnected: []string{},
+	}
+	var targets []peer.ID
+	h := pnet.Host()
+	for _, e := range entries {
+		if h.Network().Connectedness(e.PeerID) == network.Connected {
+			targets = append(targets, e.PeerID)
+		} else {
+			resp.NotConnected = append(resp.NotConnected, e.PeerID.String())
+		}
+	}
+
+	for _, res := range pnet.AnnounceKeyRotation(r.Context(), &kr, targets) {
+		if res.Err != nil {
+			resp.Failed = append(resp.Failed, KeyRotateFailure{PeerID: res.Peer.String(), Error: res.Err.Error()})
+			s.audit.KeyRotation("announce_failed", kr.OldPeerID, kr.NewPeerID, res.Peer.String(), res.Err.Error())
+			continue
+		}
+		resp.Notified = append(resp.Notified, res.Peer.String())
+		s.audit.KeyRotation("announced", kr.OldPeerID, kr.NewPeerID, res.Peer.String(), "")
+	}
+
+	slog.Info("key rotation announced",
+		"new", kr.NewPeerID[:16]+"...",
+		"notified", len(resp.Notified),
+		"failed", len(resp.Failed),
+		"not_connected", len(resp.NotConnected))
+	respondJSON(w, http.StatusOK, resp)
+}
+
 func (s *Server) handleAuthRemove(w http.ResponseWriter, r *http.Request) {
 	peerID := r.PathValue("peer_id")
 	if peerID == "" {
@@ -373,6 +519,60 @@ func (s *Server) handleAuthRemove(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{"status": "removed"})
 }
 
+// handleAuthRevoke signs a revocation of a pairing group member with the
+// daemon's key, removes the peer locally and gossips the notice to the
+// connected members of its group.
+func (s *Server) handleAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	var req AuthRevokeRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.PeerID == "" {
+		respondError(w, http.StatusBadRequest, "peer_id is required")
+		return
+	}
+	pid, err := peer.Decode(req.PeerID)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "invalid peer_id: "+err.Error())
+		return
+	}
+
+	revoker := s.runtime.Revoker()
+	if revoker == nil {
+		respondError(w, http.StatusBadRequest, "connection gating is not enabled")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	rev, removed, delivered, err := revoker.Revoke(ctx, pid, req.Reason)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, auth.ErrPeerNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, auth.ErrNoPairingGroup), errors.Is(err, auth.ErrInvalidRevocation), errors.Is(err, auth.ErrRevocationNotAllowed):
+			status = http.StatusBadRequest
+		}
+		respondError(w, status, err.Error())
+		return
+	}
+
+	resp := AuthRevokeResponse{
+		PeerID:    rev.PeerID,
+		Group:     rev.Group,
+		Removed:   removed,
+		Delivered: []string{},
+	}
+	for _, p := range delivered {
+		resp.Delivered = append(resp.Delivered, p.String())
+	}
+
+	slog.Info("peer revoked via API", "peer", req.PeerID[:16]+"...", "group", rev.Group, "delivered", len(delivered))
+	respondJSON(w, http.StatusOK, resp)
+}
+
 // reloadGater reloads the authorized_keys file and updates the connection gater.
 func (s *Server) reloadGater() error {
 	gater := s.runtime.GaterForHotReload()
@@ -534,6 +734,14 @@ func (s *Server) handleResolve(w http.ResponseWriter, r *http.Request) {
 	// Check if the input was already a peer ID (not a name lookup)
 	if _, parseErr := peer.Decode(req.Name); parseErr == nil {
 		source = "peer_id"
+	} else if dir := s.runtime.Directory(); dir != nil {
+		self := net.PeerID()
+		for _, e := range dir.DirectoryNames() {
+			if e.Name == req.Name && e.Origin != self {
+				source = "directory"
+				break
+			}
+		}
 	}
 
 	resp := ResolveResponse{
@@ -560,6 +768,35 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "peer, service, and listen are required")
 		return
 	}
+	if req.Protocol == "" {
+		req.Protocol = p2pnet.ServiceTransportTCP
+	}
+	if req.Protocol != p2pnet.ServiceTransportTCP && req.Protocol != p2pnet.ServiceTransportUDP {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("protocol must be %q or %q", p2pnet.ServiceTransportTCP, p2pnet.ServiceTransportUDP))
+		return
+	}
+
+	// Unix socket listeners: stream-only, with optional permissions
+	var sockOpts *p2pnet.SocketOptions
+	if p2pnet.IsUnixAddr(req.Listen) {
+		if err := validate.LocalAddress(req.Listen); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Protocol == p2pnet.ServiceTransportUDP {
+			respondError(w, http.StatusBadRequest, "unix socket listeners cannot carry UDP")
+			return
+		}
+		mode, err := p2pnet.ParseSocketMode(req.SocketMode)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		sockOpts = &p2pnet.SocketOptions{Mode: mode, Group: req.SocketGroup}
+	} else if req.SocketMode != "" || req.SocketGroup != "" {
+		respondError(w, http.StatusBadRequest, "socket_mode and socket_group apply only to unix: listen addresses")
+		return
+	}
 
 	pnet := s.runtime.Network()
 
@@ -576,15 +813,30 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create dial function with retry
-	dialFunc := p2pnet.DialWithRetry(func() (p2pnet.ServiceConn, error) {
-		return pnet.ConnectToService(targetPeerID, req.Service)
-	}, 3)
-
-	// Create TCP listener
-	listener, err := p2pnet.NewTCPListener(req.Listen, dialFunc)
+	// Create dial function with retry and a listener for the requested protocol
+	var listener proxyListener
+	if req.Protocol == p2pnet.ServiceTransportUDP {
+		dialFunc := p2pnet.DialWithRetry(func() (p2pnet.ServiceConn, error) {
+			return pnet.ConnectToUDPService(targetPeerID, req.Service)
+		}, 3)
+		listener, err = p2pnet.NewUDPListener(req.Listen, dialFunc)
+	} else {
+		dialFunc := p2pnet.DialWithRetry(pnet.ServiceDialFunc(targetPeerID, req.Service), 3)
+		listener, err = p2pnet.NewTCPListenerWithOptions(req.Listen, sockOpts, dialFunc)
+		if err == nil {
+			// Pre-open streams so the first client connection doesn't pay for stream setup.
+			// Unused warm streams are closed by the pool's idle eviction.
+			if pool := pnet.StreamPool(); pool != nil {
+				pool.Warm(targetPeerID, req.Service)
+			}
+		}
+	}
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create listener: %v", err))
+		status := http.StatusInternalServerError
+		if errors.Is(err, p2pnet.ErrSocketInUse) {
+			status = http.StatusConflict
+		}
+		respondError(w, status, fmt.Sprintf("failed to create listener: %v", err))
 		return
 	}
 
@@ -594,14 +846,26 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 	id := fmt.Sprintf("proxy-%d", s.nextID)
 	ctx, cancel := context.WithCancel(context.Background())
 	done := make(chan struct{})
+
+	// Keep the path to the peer warm so clients connecting long after the
+	// proxy was created don't wait for DHT lookup and relay setup.
+	var keepalive *p2pnet.PeerKeepalive
+	warmup := req.Warmup || s.proxyWarmup
+	if warmup {
+		keepalive = p2pnet.NewPeerKeepalive(pnet.Host(), s.runtime.ConnectToPeer, targetPeerID, s.runtime.PingProtocolID(), s.keepaliveInterval)
+		keepalive.Start(ctx)
+	}
+
 	proxy := &activeProxy{
-		ID:       id,
-		Peer:     req.Peer,
-		Service:  req.Service,
-		Listen:   listener.Addr().String(),
-		listener: listener,
-		cancel:   cancel,
-		done:     done,
+		ID:        id,
+		Peer:      req.Peer,
+		Service:   req.Service,
+		Protocol:  req.Protocol,
+		Listen:    p2pnet.FormatLocalAddr(listener.Addr()),
+		listener:  listener,
+		keepalive: keepalive,
+		cancel:    cancel,
+		done:      done,
 	}
 	s.proxies[id] = proxy
 	s.mu.Unlock()
@@ -611,6 +875,10 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 		defer close(done)
 		<-ctx.Done()
 		listener.Close()
+		if keepalive != nil {
+			keepalive.Stop()
+		}
+		pnet.Events().Publish(p2pnet.EventProxyClosed, targetPeerID.String(), map[string]any{"id": id, "service": req.Service})
 	}()
 
 	go func() {
@@ -625,7 +893,13 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	slog.Info("proxy created via API", "id", id, "peer", req.Peer, "service", req.Service, "listen", proxy.Listen)
+	pnet.Events().Publish(p2pnet.EventProxyOpened, targetPeerID.String(), map[string]any{
+		"id":       id,
+		"service":  req.Service,
+		"protocol": req.Protocol,
+		"listen":   proxy.Listen,
+	})
+	slog.Info("proxy created via API", "id", id, "peer", req.Peer, "service", req.Service, "protocol", req.Protocol, "listen", proxy.Listen, "warmup", warmup)
 	respondJSON(w, http.StatusOK, ConnectResponse{ID: id, ListenAddress: proxy.Listen})
 }
 
@@ -658,6 +932,187 @@ func (s *Server) handleDisconnect(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, map[string]string{"status": "disconnected"})
 }
 
+func (s *Server) handleTunnelList(w http.ResponseWriter, r *http.Request) {
+	resp := []TunnelInfo{}
+	if tunnels := s.runtime.Tunnels(); tunnels != nil {
+		for _, t := range tunnels.List() {
+			resp = append(resp, tunnelInfo(t))
+		}
+	}
+
+	if wantsText(r) {
+		var sb strings.Builder
+		for _, t := range resp {
+			peerShort := t.PeerID
+			if len(peerShort) > 16 {
+				peerShort = peerShort[:16] + "..."
+			}
+			target := t.LocalAddr
+			if target == "" {
+				target = "-"
+			}
+			fmt.Fprintf(&sb, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Direction, peerShort, t.Listen, target)
+		}
+		respondText(w, http.StatusOK, sb.String())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// handleReverseTunnel asks a peer to listen on remote_listen and forward
+// accepted connections back to local_addr on this node.
+func (s *Server) handleReverseTunnel(w http.ResponseWriter, r *http.Request) {
+	var req ReverseTunnelRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Peer == "" || req.RemoteListen == "" || req.LocalAddr == "" {
+		respondError(w, http.StatusBadRequest, "peer, remote_listen, and local_addr are required")
+		return
+	}
+	if err := validate.LocalAddress(req.LocalAddr); err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid local_addr: %v", err))
+		return
+	}
+	tunnels := s.runtime.Tunnels()
+	if tunnels == nil {
+		respondError(w, http.StatusServiceUnavailable, "reverse tunnels are not available yet")
+		return
+	}
+
+	pid, err := s.runtime.Network().ResolveName(req.Peer)
+	if err != nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("cannot resolve peer %q: %v", req.Peer, err))
+		return
+	}
+	if err := s.runtime.ConnectToPeer(r.Context(), pid); err != nil {
+		respondError(w, http.StatusBadGateway, fmt.Sprintf("cannot reach peer %q: %v", req.Peer, err))
+		return
+	}
+
+	t, err := tunnels.Open(r.Context(), pid, req.RemoteListen, req.LocalAddr)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, p2pnet.ErrReverseTunnelRejected) {
+			status = http.StatusForbidden
+		}
+		respondError(w, status, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, tunnelInfo(t))
+}
+
+func (s *Server) handleTunnelClose(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	tunnels := s.runtime.Tunnels()
+	if tunnels == nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("%v: %s", p2pnet.ErrTunnelNotFound, id))
+		return
+	}
+	if err := tunnels.Close(id); err != nil {
+		respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "closed"})
+}
+
+func tunnelInfo(t *p2pnet.ReverseTunnel) TunnelInfo {
+	direction := "outgoing"
+	if t.Incoming {
+		direction = "incoming"
+	}
+	return TunnelInfo{
+		ID:        t.ID,
+		PeerID:    t.Peer.String(),
+		Direction: direction,
+		Listen:    t.Listen,
+		LocalAddr: t.LocalAddr,
+		Created:   t.Created.UTC().Format(time.RFC3339),
+	}
+}
+
+// defaultInviteTTL applies when POST /v1/invites has no ttl_seconds.
+const defaultInviteTTL = 24 * time.Hour
+
+// handleInviteCreate creates an asynchronous invite held in relay mailboxes.
+func (s *Server) handleInviteCreate(w http.ResponseWriter, r *http.Request) {
+	var req InviteRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.TTLSeconds < 0 {
+		respondError(w, http.StatusBadRequest, "ttl_seconds must not be negative")
+		return
+	}
+	inviter := s.runtime.Inviter()
+	if inviter == nil {
+		respondError(w, http.StatusBadRequest, "asynchronous invites need relay addresses and connection gating")
+		return
+	}
+
+	ttl := defaultInviteTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+	info, err := inviter.CreateInvite(ctx, req.Name, ttl)
+	if err != nil {
+		respondError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	slog.Info("asynchronous invite created via API", "id", info.ID, "relays", len(info.Relays))
+	respondJSON(w, http.StatusOK, info)
+}
+
+// handleInviteList lists pending asynchronous invites.
+func (s *Server) handleInviteList(w http.ResponseWriter, r *http.Request) {
+	resp := []InviteInfo{}
+	if inviter := s.runtime.Inviter(); inviter != nil {
+		resp = append(resp, inviter.Invites()...)
+	}
+
+	if wantsText(r) {
+		var sb strings.Builder
+		for _, inv := range resp {
+			name := inv.Name
+			if name == "" {
+				name = "-"
+			}
+			fmt.Fprintf(&sb, "%s\t%s\t%d relay(s)\texpires %s\n", inv.ID, name, len(inv.Relays), inv.Expires)
+		}
+		respondText(w, http.StatusOK, sb.String())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// handleInviteCancel withdraws a pending asynchronous invite.
+func (s *Server) handleInviteCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	inviter := s.runtime.Inviter()
+	if inviter == nil {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("%v: %s", ErrInviteNotFound, id))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	if err := inviter.CancelInvite(ctx, id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInviteNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error())
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
+}
+
 func (s *Server) handleExpose(w http.ResponseWriter, r *http.Request) {
 	var req ExposeRequest
 	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&req); err != nil {
@@ -668,6 +1123,10 @@ func (s *Server) handleExpose(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "name and local_address are required")
 		return
 	}
+	if err := validate.LocalAddress(req.LocalAddress); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	if err := s.runtime.Network().ExposeService(req.Name, req.LocalAddress, nil); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
@@ -713,3 +1172,95 @@ func (s *Server) SocketPath() string {
 func (s *Server) Listener() net.Listener {
 	return s.listener
 }
+
+// handleNames returns the merged name view. With directory sync enabled
+// every entry carries the origin whose edit won; otherwise the local
+// resolver's names are listed with this node as origin.
+func (s *Server) handleNames(w http.ResponseWriter, r *http.Request) {
+	resp := NamesResponse{Names: []NameEntry{}, Services: []AdvertisedService{}}
+
+	if dir := s.runtime.Directory(); dir != nil {
+		resp.Directory = true
+		for _, e := range dir.DirectoryNames() {
+			resp.Names = append(resp.Names, NameEntry{
+				Name:    e.Name,
+				PeerID:  e.PeerID.String(),
+				Origin:  e.Origin.String(),
+				Clock:   e.Clock,
+				Updated: e.Updated.UTC().Format(time.RFC3339),
+			})
+		}
+		for _, svc := range dir.DirectoryServices() {
+			resp.Services = append(resp.Services, AdvertisedService{
+				Origin:   svc.Origin.String(),
+				Name:     svc.Name,
+				Protocol: svc.Protocol,
+			})
+		}
+	} else {
+		net := s.runtime.Network()
+		self := net.PeerID().String()
+		for name, pid := range net.ListNames() {
+			resp.Names = append(resp.Names, NameEntry{Name: name, PeerID: pid.String(), Origin: self})
+		}
+		sort.Slice(resp.Names, func(i, j int) bool { return resp.Names[i].Name < resp.Names[j].Name })
+	}
+
+	if wantsText(r) {
+		var sb strings.Builder
+		for _, e := range resp.Names {
+			fmt.Fprintf(&sb, "%s → %s (origin: %s)\n", e.Name, e.PeerID, e.Origin)
+		}
+		respondText(w, http.StatusOK, sb.String())
+		return
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// handleNamesSync publishes local name changes and syncs the directory
+// with one peer or every connected authorized peer.
+func (s *Server) handleNamesSync(w http.ResponseWriter, r *http.Request) {
+	var req NamesSyncRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBodySize)).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	dir := s.runtime.Directory()
+	if dir == nil {
+		respondError(w, http.StatusBadRequest, "directory sync is not enabled (set directory.enabled in config)")
+		return
+	}
+
+	var target peer.ID
+	if req.Peer != "" {
+		pid, err := s.runtime.Network().ResolveName(req.Peer)
+		if err != nil {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("cannot resolve %q: %v", req.Peer, err))
+			return
+		}
+		target = pid
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+	published, results, err := dir.SyncDirectory(ctx, target)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrPeerNotFound) {
+			status = http.StatusNotFound
+		}
+		respondError(w, status, err.Error())
+		return
+	}
+
+	resp := NamesSyncResponse{Published: published, Results: []NamesSyncResult{}}
+	for _, res := range results {
+		out := NamesSyncResult{PeerID: res.Peer.String(), Updated: res.Updated}
+		if res.Err != nil {
+			out.Error = res.Err.Error()
+		}
+		resp.Results = append(resp.Results, out)
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -14,8 +15,10 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 
+	"github.com/satindergrewal/peer-up/internal/auth"
 	"github.com/satindergrewal/peer-up/internal/config"
 	"github.com/satindergrewal/peer-up/pkg/p2pnet"
 )
@@ -29,6 +32,10 @@ type networkMockRuntime struct {
 	pingProto    string
 	authKeysPath string
 	gater        GaterReloader
+	revoker      Revoker
+	directory    DirectorySyncer
+	tunnels      *p2pnet.ReverseTunnels
+	inviter      Inviter
 }
 
 func (m *networkMockRuntime) Network() *p2pnet.Network         { return m.net }
@@ -45,6 +52,11 @@ func (m *networkMockRuntime) Interfaces() *p2pnet.InterfaceSummary { return nil
 func (m *networkMockRuntime) PathTracker() *p2pnet.PathTracker     { return nil }
 func (m *networkMockRuntime) STUNResult() *p2pnet.STUNResult       { return nil }
 func (m *networkMockRuntime) IsRelaying() bool                      { return false }
+func (m *networkMockRuntime) RelayHealth() *p2pnet.RelayHealth       { return nil }
+func (m *networkMockRuntime) Revoker() Revoker                       { return m.revoker }
+func (m *networkMockRuntime) Directory() DirectorySyncer             { return m.directory }
+func (m *networkMockRuntime) Tunnels() *p2pnet.ReverseTunnels       { return m.tunnels }
+func (m *networkMockRuntime) Inviter() Inviter                       { return m.inviter }
 
 // mockGater implements GaterReloader for testing auth add/remove.
 type mockGater struct {
@@ -390,6 +402,40 @@ func TestHandleAuthList_Text(t *testing.T) {
 	}
 }
 
+func TestHandleAuthList_Roles(t *testing.T) {
+	srv, rt := newNetworkServer(t)
+	dir := t.TempDir()
+	authPath := filepath.Join(dir, "authorized_keys")
+
+	pid := genHandlerPeerID(t)
+	os.WriteFile(authPath, []byte(pid.String()+"  role=admin,ops  # teammate\n"), 0600)
+	rt.authKeysPath = authPath
+
+	req := httptest.NewRequest("GET", "/v1/auth", nil)
+	rec := httptest.NewRecorder()
+	srv.handleAuthList(rec, req)
+
+	var envelope DataResponse
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	dataBytes, _ := json.Marshal(envelope.Data)
+	var entries []AuthEntry
+	json.Unmarshal(dataBytes, &entries)
+
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if got := strings.Join(entries[0].Roles, ","); got != "admin,ops" {
+		t.Errorf("Roles = %v, want [admin ops]", entries[0].Roles)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/auth?format=text", nil)
+	rec = httptest.NewRecorder()
+	srv.handleAuthList(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "role=admin,ops") {
+		t.Errorf("text output missing roles: %q", body)
+	}
+}
+
 // --- handleAuthAdd ---
 
 func TestHandleAuthAdd_Success(t *testing.T) {
@@ -789,6 +835,101 @@ func TestHandleConnect_MissingFields(t *testing.T) {
 	}
 }
 
+func TestHandleConnect_InvalidProtocol(t *testing.T) {
+	srv, _ := newNetworkServer(t)
+
+	body, _ := json.Marshal(ConnectRequest{Peer: "home", Service: "dns", Listen: ":0", Protocol: "sctp"})
+	req := httptest.NewRequest("POST", "/v1/connect", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	srv.handleConnect(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+}
+
+func TestHandleConnect_UnixSocket(t *testing.T) {
+	srv, rt := newNetworkServer(t)
+	rt.net.RegisterName("home", genHandlerPeerID(t))
+	sock := filepath.Join(t.TempDir(), "p.sock")
+
+	post := func(req ConnectRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		srv.handleConnect(rec, httptest.NewRequest("POST", "/v1/connect", bytes.NewReader(body)))
+		return rec
+	}
+
+	tests := []struct {
+		name string
+		req  ConnectRequest
+	}{
+		{"relative path", ConnectRequest{Peer: "home", Service: "docker", Listen: "unix:p.sock"}},
+		{"udp", ConnectRequest{Peer: "home", Service: "dns", Listen: "unix:" + sock, Protocol: "udp"}},
+		{"bad mode", ConnectRequest{Peer: "home", Service: "docker", Listen: "unix:" + sock, SocketMode: "rw"}},
+		{"mode on tcp", ConnectRequest{Peer: "home", Service: "ssh", Listen: "127.0.0.1:0", SocketMode: "0600"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.req); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400 (body %s)", rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	rec := post(ConnectRequest{Peer: "home", Service: "docker", Listen: "unix:" + sock, SocketMode: "0600"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var envelope DataResponse
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	dataBytes, _ := json.Marshal(envelope.Data)
+	var resp ConnectResponse
+	json.Unmarshal(dataBytes, &resp)
+	if resp.ListenAddress != "unix:"+sock {
+		t.Errorf("listen_address = %q, want unix:%s", resp.ListenAddress, sock)
+	}
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %v (err %v), want 0600", fi.Mode().Perm(), err)
+	}
+
+	if rec := post(ConnectRequest{Peer: "home", Service: "docker", Listen: "unix:" + sock}); rec.Code != http.StatusConflict {
+		t.Errorf("second listener on the socket: status = %d, want 409", rec.Code)
+	}
+
+	req := httptest.NewRequest("DELETE", "/v1/connect/"+resp.ID, nil)
+	req.SetPathValue("id", resp.ID)
+	rec = httptest.NewRecorder()
+	srv.handleDisconnect(rec, req)
+	if _, err := os.Stat(sock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket file left after disconnect: %v", err)
+	}
+}
+
+func TestHandleConnect_ConfigWarmup(t *testing.T) {
+	srv, rt := newNetworkServer(t)
+	rt.net.RegisterName("home", genHandlerPeerID(t))
+	srv.SetProxyWarmup(true, time.Minute)
+
+	body, _ := json.Marshal(ConnectRequest{Peer: "home", Service: "ssh", Listen: "127.0.0.1:0"})
+	rec := httptest.NewRecorder()
+	srv.handleConnect(rec, httptest.NewRequest("POST", "/v1/connect", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	srv.mu.Lock()
+	var warm bool
+	for _, p := range srv.proxies {
+		warm = p.keepalive != nil
+		p.cancel()
+	}
+	srv.mu.Unlock()
+	if !warm {
+		t.Error("proxy.warmup in config did not keep the proxy warm")
+	}
+}
+
 func TestHandleConnect_InvalidBody(t *testing.T) {
 	srv, _ := newNetworkServer(t)
 
@@ -1087,3 +1228,536 @@ func TestStopProxies(t *testing.T) {
 		t.Errorf("expected 0 proxies after Stop, got %d", count)
 	}
 }
+
+// --- handleEvents ---
+
+func TestFormatEventText(t *testing.T) {
+	e := p2pnet.Event{
+		Time: "2026-10-16T12:00:00Z",
+		Type: p2pnet.EventProxyOpened,
+		Peer: "12D3KooWNq8c1fNjXwhRoWxSXT419bumWQFoTbowCwHEa96RJRg6",
+		Data: map[string]any{"service": "ssh", "id": "proxy-1"},
+	}
+	want := "2026-10-16T12:00:00Z proxy.opened 12D3KooWNq8c1fNj... id=proxy-1 service=ssh"
+	if got := formatEventText(e); got != want {
+		t.Errorf("formatEventText = %q, want %q", got, want)
+	}
+}
+
+func TestEventStreamFormat(t *testing.T) {
+	tests := []struct {
+		query, accept, want string
+	}{
+		{"", "", eventFormatNDJSON},
+		{"?format=sse", "", eventFormatSSE},
+		{"?format=text", "", eventFormatText},
+		{"", "text/event-stream", eventFormatSSE},
+		{"", "text/plain", eventFormatText},
+		{"?format=ndjson", "text/event-stream", eventFormatNDJSON},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/v1/events"+tt.query, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if got := eventStreamFormat(req); got != tt.want {
+			t.Errorf("query=%q accept=%q: format = %q, want %q", tt.query, tt.accept, got, tt.want)
+		}
+	}
+}
+
+// --- handleKeyRotate ---
+
+func TestHandleKeyRotate(t *testing.T) {
+	dir := t.TempDir()
+	netA := newListeningTestNetwork(t)
+	netB := newListeningTestNetwork(t)
+	bInfo := peer.AddrInfo{ID: netB.Host().ID(), Addrs: netB.Host().Addrs()}
+	if err := netA.Host().Connect(context.Background(), bInfo); err != nil {
+		t.Fatalf("connect A→B: %v", err)
+	}
+	netB.Host().SetStreamHandler(p2pnet.KeyRotationProtocol, func(s network.Stream) {
+		defer s.Close()
+		_, err := p2pnet.ReadKeyRotation(s)
+		p2pnet.WriteKeyRotationReply(s, err)
+	})
+
+	offline := genHandlerPeerID(t)
+	authPath := filepath.Join(dir, "authorized_keys")
+	os.WriteFile(authPath, []byte(netB.PeerID().String()+"\n"+offline.String()+"\n"), 0600)
+
+	rt := &networkMockRuntime{net: netA, version: "test-0.1.0", startTime: time.Now(), authKeysPath: authPath}
+	srv := NewServer(rt, filepath.Join(dir, "test.sock"), filepath.Join(dir, ".cookie"), "test-0.1.0")
+
+	newKey, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	oldKey := netA.Host().Peerstore().PrivKey(netA.PeerID())
+
+	t.Run("announces to connected authorized peers", func(t *testing.T) {
+		kr, err := p2pnet.NewKeyRotation(oldKey, newKey, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(kr)
+		rec := httptest.NewRecorder()
+		srv.handleKeyRotate(rec, httptest.NewRequest("POST", "/v1/key/rotate", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+
+		var envelope DataResponse
+		json.NewDecoder(rec.Body).Decode(&envelope)
+		dataBytes, _ := json.Marshal(envelope.Data)
+		var resp KeyRotateResponse
+		json.Unmarshal(dataBytes, &resp)
+
+		if resp.NewPeerID != kr.NewPeerID {
+			t.Errorf("NewPeerID = %q, want %q", resp.NewPeerID, kr.NewPeerID)
+		}
+		if len(resp.Notified) != 1 || resp.Notified[0] != netB.PeerID().String() {
+			t.Errorf("Notified = %v, want [B]", resp.Notified)
+		}
+		if len(resp.NotConnected) != 1 || resp.NotConnected[0] != offline.String() {
+			t.Errorf("NotConnected = %v, want [offline]", resp.NotConnected)
+		}
+		if len(resp.Failed) != 0 {
+			t.Errorf("Failed = %v, want none", resp.Failed)
+		}
+	})
+
+	t.Run("rejects a statement for another identity", func(t *testing.T) {
+		otherKey, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+		kr, _ := p2pnet.NewKeyRotation(otherKey, newKey, time.Now())
+		body, _ := json.Marshal(kr)
+		rec := httptest.NewRecorder()
+		srv.handleKeyRotate(rec, httptest.NewRequest("POST", "/v1/key/rotate", bytes.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("rejects a bad signature", func(t *testing.T) {
+		kr, _ := p2pnet.NewKeyRotation(oldKey, newKey, time.Now())
+		kr.NewSig[0] ^= 0xff
+		body, _ := json.Marshal(kr)
+		rec := httptest.NewRecorder()
+		srv.handleKeyRotate(rec, httptest.NewRequest("POST", "/v1/key/rotate", bytes.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", rec.Code)
+		}
+	})
+}
+
+// --- handleAuthRevoke ---
+
+type mockRevoker struct {
+	err    error
+	peerID peer.ID
+	reason string
+}
+
+func (m *mockRevoker) Revoke(_ context.Context, p peer.ID, reason string) (*auth.Revocation, bool, []peer.ID, error) {
+	m.peerID, m.reason = p, reason
+	if m.err != nil {
+		return nil, false, nil, m.err
+	}
+	return &auth.Revocation{PeerID: p.String(), Group: "g1"}, true, []peer.ID{p}, nil
+}
+
+func TestHandleAuthRevoke(t *testing.T) {
+	target := genHandlerPeerID(t)
+	post := func(rt RuntimeInfo, body string) *httptest.ResponseRecorder {
+		srv := NewServer(rt, "/tmp/test.sock", "/tmp/test.cookie", "test")
+		rec := httptest.NewRecorder()
+		srv.handleAuthRevoke(rec, httptest.NewRequest("POST", "/v1/auth/revoke", strings.NewReader(body)))
+		return rec
+	}
+
+	t.Run("success", func(t *testing.T) {
+		rv := &mockRevoker{}
+		rec := post(&networkMockRuntime{revoker: rv}, fmt.Sprintf(`{"peer_id":%q,"reason":"stolen"}`, target))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		if rv.peerID != target || rv.reason != "stolen" {
+			t.Errorf("revoker got %s, %q", rv.peerID, rv.reason)
+		}
+		var envelope DataResponse
+		json.NewDecoder(rec.Body).Decode(&envelope)
+		dataBytes, _ := json.Marshal(envelope.Data)
+		var resp AuthRevokeResponse
+		json.Unmarshal(dataBytes, &resp)
+		if resp.Group != "g1" || !resp.Removed || len(resp.Delivered) != 1 {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+
+	tests := []struct {
+		name string
+		rt   RuntimeInfo
+		body string
+		want int
+	}{
+		{"gating disabled", &networkMockRuntime{}, fmt.Sprintf(`{"peer_id":%q}`, target), http.StatusBadRequest},
+		{"missing peer_id", &networkMockRuntime{revoker: &mockRevoker{}}, `{}`, http.StatusBadRequest},
+		{"invalid peer_id", &networkMockRuntime{revoker: &mockRevoker{}}, `{"peer_id":"nope"}`, http.StatusBadRequest},
+		{"unknown peer", &networkMockRuntime{revoker: &mockRevoker{err: auth.ErrPeerNotFound}}, fmt.Sprintf(`{"peer_id":%q}`, target), http.StatusNotFound},
+		{"no group", &networkMockRuntime{revoker: &mockRevoker{err: auth.ErrNoPairingGroup}}, fmt.Sprintf(`{"peer_id":%q}`, target), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.rt, tt.body); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// --- handleNames / handleNamesSync ---
+
+type mockDirectory struct {
+	names    []p2pnet.DirectoryEntry
+	services []p2pnet.DirectoryServiceEntry
+	results  []p2pnet.DirectorySyncResult
+	err      error
+	synced   []peer.ID
+}
+
+func (m *mockDirectory) DirectoryNames() []p2pnet.DirectoryEntry            { return m.names }
+func (m *mockDirectory) DirectoryServices() []p2pnet.DirectoryServiceEntry { return m.services }
+func (m *mockDirectory) SyncDirectory(_ context.Context, p peer.ID) (bool, []p2pnet.DirectorySyncResult, error) {
+	m.synced = append(m.synced, p)
+	return true, m.results, m.err
+}
+
+func TestHandleNames(t *testing.T) {
+	net := newTestNetwork(t)
+	laptop, origin := genHandlerPeerID(t), genHandlerPeerID(t)
+
+	get := func(rt RuntimeInfo) NamesResponse {
+		t.Helper()
+		srv := NewServer(rt, "/tmp/test.sock", "/tmp/test.cookie", "test")
+		rec := httptest.NewRecorder()
+		srv.handleNames(rec, httptest.NewRequest("GET", "/v1/names", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		var envelope DataResponse
+		json.NewDecoder(rec.Body).Decode(&envelope)
+		dataBytes, _ := json.Marshal(envelope.Data)
+		var resp NamesResponse
+		json.Unmarshal(dataBytes, &resp)
+		return resp
+	}
+
+	t.Run("directory enabled", func(t *testing.T) {
+		dir := &mockDirectory{
+			names:    []p2pnet.DirectoryEntry{{Name: "laptop", PeerID: laptop, Origin: origin, Clock: 3, Updated: time.Unix(1700000000, 0)}},
+			services: []p2pnet.DirectoryServiceEntry{{Origin: origin, Name: "ssh"}},
+		}
+		resp := get(&networkMockRuntime{net: net, directory: dir})
+		if !resp.Directory || len(resp.Names) != 1 || len(resp.Services) != 1 {
+			t.Fatalf("response = %+v", resp)
+		}
+		e := resp.Names[0]
+		if e.Name != "laptop" || e.PeerID != laptop.String() || e.Origin != origin.String() || e.Clock != 3 {
+			t.Errorf("entry = %+v", e)
+		}
+		if e.Updated != "2023-11-14T22:13:20Z" {
+			t.Errorf("Updated = %q", e.Updated)
+		}
+	})
+
+	t.Run("directory disabled lists local names", func(t *testing.T) {
+		net.RegisterName("laptop", laptop)
+		resp := get(&networkMockRuntime{net: net})
+		if resp.Directory || len(resp.Names) != 1 {
+			t.Fatalf("response = %+v", resp)
+		}
+		if resp.Names[0].Origin != net.PeerID().String() {
+			t.Errorf("origin = %s, want this node", resp.Names[0].Origin)
+		}
+	})
+}
+
+func TestHandleNamesSync(t *testing.T) {
+	net := newTestNetwork(t)
+	target := genHandlerPeerID(t)
+	net.RegisterName("laptop", target)
+
+	post := func(rt RuntimeInfo, body string) *httptest.ResponseRecorder {
+		srv := NewServer(rt, "/tmp/test.sock", "/tmp/test.cookie", "test")
+		rec := httptest.NewRecorder()
+		srv.handleNamesSync(rec, httptest.NewRequest("POST", "/v1/names/sync", strings.NewReader(body)))
+		return rec
+	}
+
+	t.Run("by name", func(t *testing.T) {
+		dir := &mockDirectory{results: []p2pnet.DirectorySyncResult{
+			{Peer: target, Updated: 2},
+			{Peer: genHandlerPeerID(t), Err: errors.New("stream reset")},
+		}}
+		rec := post(&networkMockRuntime{net: net, directory: dir}, `{"peer":"laptop"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		if len(dir.synced) != 1 || dir.synced[0] != target {
+			t.Errorf("synced = %v, want [%s]", dir.synced, target)
+		}
+		var envelope DataResponse
+		json.NewDecoder(rec.Body).Decode(&envelope)
+		dataBytes, _ := json.Marshal(envelope.Data)
+		var resp NamesSyncResponse
+		json.Unmarshal(dataBytes, &resp)
+		if !resp.Published || len(resp.Results) != 2 || resp.Results[0].Updated != 2 || resp.Results[1].Error == "" {
+			t.Errorf("response = %+v", resp)
+		}
+	})
+
+	t.Run("all peers with empty body", func(t *testing.T) {
+		dir := &mockDirectory{}
+		if rec := post(&networkMockRuntime{net: net, directory: dir}, ""); rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+		}
+		if len(dir.synced) != 1 || dir.synced[0] != "" {
+			t.Errorf("synced = %v, want one sync with all peers", dir.synced)
+		}
+	})
+
+	tests := []struct {
+		name string
+		rt   RuntimeInfo
+		body string
+		want int
+	}{
+		{"disabled", &networkMockRuntime{net: net}, `{}`, http.StatusBadRequest},
+		{"unknown name", &networkMockRuntime{net: net, directory: &mockDirectory{}}, `{"peer":"nas"}`, http.StatusNotFound},
+		{"unauthorized peer", &networkMockRuntime{net: net, directory: &mockDirectory{err: auth.ErrPeerNotFound}}, `{"peer":"laptop"}`, http.StatusNotFound},
+		{"bad body", &networkMockRuntime{net: net, directory: &mockDirectory{}}, `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.rt, tt.body); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlePeerServices(t *testing.T) {
+	netA := newListeningTestNetwork(t)
+	netB := newListeningTestNetwork(t)
+
+	netB.SetServiceDescription("ssh", "Shell on the NAS")
+	if err := netB.ExposeService("ssh", "localhost:22", nil); err != nil {
+		t.Fatal(err)
+	}
+	other := map[peer.ID]struct{}{netB.Host().ID(): {}}
+	if err := netB.ExposeService("db", "localhost:5432", other); err != nil {
+		t.Fatal(err)
+	}
+
+	bInfo := peer.AddrInfo{ID: netB.Host().ID(), Addrs: netB.Host().Addrs()}
+	if err := netA.Host().Connect(context.Background(), bInfo); err != nil {
+		t.Fatalf("connect A→B: %v", err)
+	}
+	srv := NewServer(&networkMockRuntime{net: netA}, "", "", "test")
+
+	get := func(target, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/peers/"+target+"/services"+query, nil)
+		req.SetPathValue("peer", target)
+		rec := httptest.NewRecorder()
+		srv.handlePeerServices(rec, req)
+		return rec
+	}
+
+	rec := get(netB.Host().ID().String(), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var envelope struct {
+		Data PeerServicesResponse `json:"data"`
+	}
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	got := envelope.Data.Services
+	if len(got) != 1 || got[0].Name != "ssh" || got[0].Transport != "tcp" || got[0].Description != "Shell on the NAS" {
+		t.Errorf("services = %+v, want only ssh (db is denied to A)", got)
+	}
+
+	rec = get(netB.Host().ID().String(), "?format=text")
+	if body := rec.Body.String(); !strings.Contains(body, "ssh\ttcp\tShell on the NAS") || strings.Contains(body, "db") {
+		t.Errorf("text output = %q", body)
+	}
+
+	if rec := get("nas", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown name: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleReverseTunnel(t *testing.T) {
+	netA := newListeningTestNetwork(t)
+	netB := newListeningTestNetwork(t)
+	if err := netA.Host().Connect(context.Background(), peer.AddrInfo{ID: netB.Host().ID(), Addrs: netB.Host().Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	netA.RegisterName("server", netB.Host().ID())
+
+	onA := p2pnet.NewReverseTunnels(netA.Host(), nil, nil, nil)
+	onB := p2pnet.NewReverseTunnels(netB.Host(), func(p peer.ID, listen string) bool {
+		return p == netA.Host().ID() && listen == "127.0.0.1:0"
+	}, nil, nil)
+	t.Cleanup(onA.CloseAll)
+	t.Cleanup(onB.CloseAll)
+	srv := NewServer(&networkMockRuntime{net: netA, tunnels: onA}, "/tmp/test.sock", "/tmp/test.cookie", "test")
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.handleReverseTunnel(rec, httptest.NewRequest("POST", "/v1/tunnels/reverse", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"peer":"server","remote_listen":"127.0.0.1:0","local_addr":"127.0.0.1:3000"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	var envelope DataResponse
+	json.NewDecoder(rec.Body).Decode(&envelope)
+	dataBytes, _ := json.Marshal(envelope.Data)
+	var info TunnelInfo
+	json.Unmarshal(dataBytes, &info)
+	if info.Direction != "outgoing" || info.PeerID != netB.Host().ID().String() || info.LocalAddr != "127.0.0.1:3000" {
+		t.Errorf("tunnel = %+v", info)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.handleTunnelList(rec, httptest.NewRequest("GET", "/v1/tunnels?format=text", nil))
+	if !strings.Contains(rec.Body.String(), info.ID+"\toutgoing") {
+		t.Errorf("text list = %q", rec.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"bad body", `{`, http.StatusBadRequest},
+		{"missing fields", `{"peer":"server"}`, http.StatusBadRequest},
+		{"bad local_addr", `{"peer":"server","remote_listen":"127.0.0.1:0","local_addr":"3000"}`, http.StatusBadRequest},
+		{"unknown name", `{"peer":"nas","remote_listen":"127.0.0.1:0","local_addr":"127.0.0.1:3000"}`, http.StatusNotFound},
+		{"not allowed", `{"peer":"server","remote_listen":"0.0.0.0:80","local_addr":"127.0.0.1:3000"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := post(tt.body); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	del := func(id string) int {
+		req := httptest.NewRequest("DELETE", "/v1/tunnels/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		srv.handleTunnelClose(rec, req)
+		return rec.Code
+	}
+	if code := del(info.ID); code != http.StatusOK {
+		t.Errorf("close status = %d, want 200", code)
+	}
+	if code := del(info.ID); code != http.StatusNotFound {
+		t.Errorf("second close status = %d, want 404", code)
+	}
+}
+
+// --- handleInviteCreate / handleInviteList / handleInviteCancel ---
+
+type mockInviter struct {
+	invites []InviteInfo
+	name    string
+	ttl     time.Duration
+	err     error
+}
+
+func (m *mockInviter) CreateInvite(_ context.Context, name string, ttl time.Duration) (*InviteInfo, error) {
+	m.name, m.ttl = name, ttl
+	if m.err != nil {
+		return nil, m.err
+	}
+	inv := InviteInfo{ID: "0123abcd", Code: "AAAA-BBBB", Name: name, Relays: []string{"relay"}}
+	m.invites = append(m.invites, inv)
+	return &inv, nil
+}
+
+func (m *mockInviter) Invites() []InviteInfo { return m.invites }
+
+func (m *mockInviter) CancelInvite(_ context.Context, id string) error {
+	for i, inv := range m.invites {
+		if inv.ID == id {
+			m.invites = append(m.invites[:i], m.invites[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrInviteNotFound, id)
+}
+
+func TestHandleInvites(t *testing.T) {
+	inv := &mockInviter{}
+	srv := NewServer(&networkMockRuntime{inviter: inv}, "/tmp/test.sock", "/tmp/test.cookie", "test")
+
+	post := func(srv *Server, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.handleInviteCreate(rec, httptest.NewRequest("POST", "/v1/invites", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(srv, `{"name":"home"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if inv.name != "home" || inv.ttl != defaultInviteTTL {
+		t.Errorf("inviter got %q, %v", inv.name, inv.ttl)
+	}
+	post(srv, `{"ttl_seconds":3600}`)
+	if inv.ttl != time.Hour {
+		t.Errorf("ttl = %v, want 1h", inv.ttl)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.handleInviteList(rec, httptest.NewRequest("GET", "/v1/invites?format=text", nil))
+	if !strings.Contains(rec.Body.String(), "0123abcd\thome") {
+		t.Errorf("text list = %q", rec.Body.String())
+	}
+
+	del := func(srv *Server, id string) int {
+		req := httptest.NewRequest("DELETE", "/v1/invites/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		srv.handleInviteCancel(rec, req)
+		return rec.Code
+	}
+	if code := del(srv, "0123abcd"); code != http.StatusOK {
+		t.Errorf("cancel status = %d, want 200", code)
+	}
+	if code := del(srv, "ffff"); code != http.StatusNotFound {
+		t.Errorf("cancel unknown status = %d, want 404", code)
+	}
+
+	tests := []struct {
+		name string
+		rt   RuntimeInfo
+		body string
+		want int
+	}{
+		{"bad body", &networkMockRuntime{inviter: inv}, `{`, http.StatusBadRequest},
+		{"negative ttl", &networkMockRuntime{inviter: inv}, `{"ttl_seconds":-1}`, http.StatusBadRequest},
+		{"disabled", &networkMockRuntime{}, `{}`, http.StatusBadRequest},
+		{"no relay accepted", &networkMockRuntime{inviter: &mockInviter{err: errors.New("no relay accepted the invite")}}, `{}`, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(tt.rt, "/tmp/test.sock", "/tmp/test.cookie", "test")
+			if rec := post(srv, tt.body); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -20,6 +20,12 @@ func (sr *statusRecorder) WriteHeader(code int) {
 	sr.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer
+// (Flush, SetWriteDeadline) for streaming responses.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
 // InstrumentHandler wraps an HTTP handler with Prometheus metrics and audit logging.
 // If both metrics and audit are nil, the handler is returned unchanged (zero overhead).
 func InstrumentHandler(next http.Handler, metrics *p2pnet.Metrics, audit *p2pnet.AuditLogger) http.Handler {
@@ -15,6 +15,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/peer"
 
+	"github.com/satindergrewal/peer-up/internal/auth"
 	"github.com/satindergrewal/peer-up/pkg/p2pnet"
 )
 
@@ -33,6 +34,11 @@ type RuntimeInfo interface {
 	PathTracker() *p2pnet.PathTracker                        // nil before bootstrap
 	STUNResult() *p2pnet.STUNResult                          // nil before probe
 	IsRelaying() bool                                        // true if peer relay enabled
+	RelayHealth() *p2pnet.RelayHealth                        // nil before bootstrap
+	Revoker() Revoker                                        // nil if gating disabled
+	Directory() DirectorySyncer                              // nil if directory sync disabled
+	Tunnels() *p2pnet.ReverseTunnels                         // nil before setup
+	Inviter() Inviter                                        // nil if no relays or gating disabled
 }
 
 // GaterReloader allows hot-reloading the authorized peers list.
@@ -40,15 +46,48 @@ type GaterReloader interface {
 	ReloadFromFile() error // reload authorized_keys and update the gater
 }
 
-// activeProxy tracks a dynamically created TCP proxy.
+// Revoker issues a signed revocation of a pairing group member and gossips
+// it to the rest of the group.
+type Revoker interface {
+	Revoke(ctx context.Context, peerID peer.ID, reason string) (rev *auth.Revocation, removed bool, delivered []peer.ID, err error)
+}
+
+// DirectorySyncer exposes the name and service directory shared with
+// authorized peers.
+type DirectorySyncer interface {
+	DirectoryNames() []p2pnet.DirectoryEntry
+	DirectoryServices() []p2pnet.DirectoryServiceEntry
+	// SyncDirectory syncs with peerID, or every connected authorized peer if empty.
+	SyncDirectory(ctx context.Context, peerID peer.ID) (published bool, results []p2pnet.DirectorySyncResult, err error)
+}
+
+// Inviter creates asynchronous invites: a sealed introduction is left in
+// the mailbox of the configured relays, and the joiner's reply is accepted
+// whenever it arrives, even if this daemon was offline when the code was used.
+type Inviter interface {
+	CreateInvite(ctx context.Context, name string, ttl time.Duration) (*InviteInfo, error)
+	Invites() []InviteInfo
+	CancelInvite(ctx context.Context, id string) error
+}
+
+// proxyListener is the common surface of p2pnet.TCPListener and p2pnet.UDPListener.
+type proxyListener interface {
+	Serve() error
+	Close() error
+	Addr() net.Addr
+}
+
+// activeProxy tracks a dynamically created TCP or UDP proxy.
 type activeProxy struct {
-	ID       string
-	Peer     string
-	Service  string
-	Listen   string
-	listener *p2pnet.TCPListener
-	cancel   context.CancelFunc
-	done     chan struct{} // closed when the proxy goroutine exits
+	ID        string
+	Peer      string
+	Service   string
+	Protocol  string // "tcp" or "udp"
+	Listen    string
+	listener  proxyListener
+	keepalive *p2pnet.PeerKeepalive // nil unless the proxy was created with warmup
+	cancel    context.CancelFunc
+	done      chan struct{} // closed when the proxy goroutine exits
 }
 
 // Server is the daemon's Unix socket HTTP API server.
@@ -61,11 +100,15 @@ type Server struct {
 	authToken  string
 	version    string
 	shutdownCh chan struct{} // closed to signal shutdown to the daemon main loop
+	stopCh     chan struct{} // closed by Stop to end long-lived event streams
 
 	// Optional observability (nil when telemetry disabled)
 	metrics *p2pnet.Metrics
 	audit   *p2pnet.AuditLogger
 
+	proxyWarmup       bool          // proxy.warmup from config: keep every new proxy's path warm
+	keepaliveInterval time.Duration // proxy.keepalive_interval from config
+
 	mu      sync.Mutex
 	proxies map[string]*activeProxy
 	nextID  int
@@ -79,6 +122,7 @@ func NewServer(runtime RuntimeInfo, socketPath, cookiePath, version string) *Ser
 		cookiePath: cookiePath,
 		version:    version,
 		shutdownCh: make(chan struct{}),
+		stopCh:     make(chan struct{}),
 		proxies:    make(map[string]*activeProxy),
 	}
 }
@@ -90,6 +134,16 @@ func (s *Server) SetInstrumentation(metrics *p2pnet.Metrics, audit *p2pnet.Audit
 	s.audit = audit
 }
 
+// SetProxyWarmup makes every proxy created through the API keep its peer
+// connection warm, as proxy.warmup does for `peerup proxy`. A request can
+// still ask for warmup when this is off. interval is proxy.keepalive_interval
+// and applies to every warm proxy; <= 0 uses the keepalive default.
+// Must be called before Start().
+func (s *Server) SetProxyWarmup(enabled bool, interval time.Duration) {
+	s.proxyWarmup = enabled
+	s.keepaliveInterval = interval
+}
+
 // ShutdownCh returns a channel that is closed when a shutdown is requested
 // via the API (POST /v1/shutdown).
 func (s *Server) ShutdownCh() <-chan struct{} {
@@ -139,7 +193,7 @@ func (s *Server) Start() error {
 	s.httpServer = &http.Server{
 		Handler:      InstrumentHandler(s.authMiddleware(mux), s.metrics, s.audit),
 		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 60 * time.Second, // longer for streaming ping
+		WriteTimeout: 60 * time.Second, // longer for streaming ping; GET /v1/events clears it
 	}
 
 	go func() {
@@ -157,6 +211,9 @@ func (s *Server) Start() error {
 func (s *Server) Stop() {
 	slog.Info("daemon server shutting down")
 
+	// End event streams first - Shutdown waits for active requests.
+	close(s.stopCh)
+
 	// Shutdown HTTP server
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -17,6 +17,7 @@ type StatusResponse struct {
 	STUNExternalAddrs []string `json:"stun_external_addrs,omitempty"`
 	IsRelaying        bool     `json:"is_relaying"`
 	Reachability      *p2pnet.ReachabilityGrade `json:"reachability,omitempty"`
+	Relays            []p2pnet.RelayHealthStatus `json:"relays,omitempty"` // per-relay health, config order
 }
 
 // ServiceInfo is returned by GET /v1/services.
@@ -43,15 +44,17 @@ type PathInfo struct {
 	Transport   string `json:"transport"`
 	IPVersion   string `json:"ip_version"`
 	LastRTTMs   float64 `json:"last_rtt_ms,omitempty"`
+	UpgradedAt  string  `json:"upgraded_at,omitempty"`
 }
 
 // AuthEntry is returned by GET /v1/auth.
 type AuthEntry struct {
-	PeerID    string `json:"peer_id"`
-	Comment   string `json:"comment,omitempty"`
-	Verified  string `json:"verified,omitempty"`   // e.g. "sha256:a1b2c3d4"
-	ExpiresAt string `json:"expires_at,omitempty"` // RFC3339, empty = never
-	Group     string `json:"group,omitempty"`      // pairing group ID
+	PeerID    string   `json:"peer_id"`
+	Comment   string   `json:"comment,omitempty"`
+	Verified  string   `json:"verified,omitempty"`   // e.g. "sha256:a1b2c3d4"
+	ExpiresAt string   `json:"expires_at,omitempty"` // RFC3339, empty = never
+	Group     string   `json:"group,omitempty"`      // pairing group ID
+	Roles     []string `json:"roles,omitempty"`      // role= attribute, e.g. ["admin", "ops"]
 }
 
 // AuthAddRequest is the body for POST /v1/auth.
@@ -60,6 +63,90 @@ type AuthAddRequest struct {
 	Comment string `json:"comment,omitempty"`
 }
 
+// AuthRevokeRequest is the body for POST /v1/auth/revoke.
+type AuthRevokeRequest struct {
+	PeerID string `json:"peer_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// AuthRevokeResponse is returned by POST /v1/auth/revoke.
+type AuthRevokeResponse struct {
+	PeerID    string   `json:"peer_id"`
+	Group     string   `json:"group"`
+	Removed   bool     `json:"removed"`   // peer was in the local authorized_keys
+	Delivered []string `json:"delivered"` // connected group members (and relays) sent the notice
+}
+
+// NamesResponse is returned by GET /v1/names.
+type NamesResponse struct {
+	Directory bool                `json:"directory"` // directory sync enabled
+	Names     []NameEntry         `json:"names"`
+	Services  []AdvertisedService `json:"services"` // empty unless directory sync is enabled
+}
+
+// NameEntry is one name in the merged view.
+type NameEntry struct {
+	Name    string `json:"name"`
+	PeerID  string `json:"peer_id"`
+	Origin  string `json:"origin"`            // node whose edit won; this node for local config names
+	Clock   uint64 `json:"clock,omitempty"`   // Lamport clock of the winning edit
+	Updated string `json:"updated,omitempty"` // RFC3339, when the origin published it
+}
+
+// AdvertisedService is a service an origin advertises in the directory.
+type AdvertisedService struct {
+	Origin   string `json:"origin"`
+	Name     string `json:"name"`
+	Protocol string `json:"protocol,omitempty"` // "udp", or empty for TCP
+}
+
+// NamesSyncRequest is the body for POST /v1/names/sync.
+type NamesSyncRequest struct {
+	Peer string `json:"peer,omitempty"` // name or peer ID; empty = every connected authorized peer
+}
+
+// NamesSyncResponse is returned by POST /v1/names/sync.
+type NamesSyncResponse struct {
+	Published bool              `json:"published"` // this node signed a new record first
+	Results   []NamesSyncResult `json:"results"`
+}
+
+// NamesSyncResult is the outcome of syncing with one peer.
+type NamesSyncResult struct {
+	PeerID  string `json:"peer_id"`
+	Updated int    `json:"updated"` // records that were newer than ours
+	Error   string `json:"error,omitempty"`
+}
+
+// PeerServicesResponse is returned by GET /v1/peers/{peer}/services.
+type PeerServicesResponse struct {
+	PeerID   string              `json:"peer_id"`
+	Services []RemoteServiceInfo `json:"services"` // only services the peer lets this node use
+}
+
+// RemoteServiceInfo is a service offered by a remote peer.
+type RemoteServiceInfo struct {
+	Name        string `json:"name"`
+	Transport   string `json:"transport"` // "tcp" or "udp"
+	Description string `json:"description,omitempty"`
+}
+
+// KeyRotateResponse is returned by POST /v1/key/rotate. The request body
+// is a signed p2pnet.KeyRotation statement.
+type KeyRotateResponse struct {
+	OldPeerID    string             `json:"old_peer_id"`
+	NewPeerID    string             `json:"new_peer_id"`
+	Notified     []string           `json:"notified"`      // peers that applied the rotation
+	Failed       []KeyRotateFailure `json:"failed"`        // connected peers that refused or errored
+	NotConnected []string           `json:"not_connected"` // authorized peers not reachable right now
+}
+
+// KeyRotateFailure is one peer that did not accept a key rotation.
+type KeyRotateFailure struct {
+	PeerID string `json:"peer_id"`
+	Error  string `json:"error"`
+}
+
 // PingRequest is the body for POST /v1/ping.
 type PingRequest struct {
 	Peer       string `json:"peer"`
@@ -90,11 +177,52 @@ type ResolveResponse struct {
 	Source string `json:"source"` // "local_config", "peer_id" (direct parse)
 }
 
+// ReverseTunnelRequest is the body for POST /v1/tunnels/reverse.
+type ReverseTunnelRequest struct {
+	Peer         string `json:"peer"`          // name or peer ID
+	RemoteListen string `json:"remote_listen"` // address the peer listens on, e.g. "0.0.0.0:8080"
+	LocalAddr    string `json:"local_addr"`    // where connections are forwarded on this node
+}
+
+// TunnelInfo describes a reverse tunnel. Outgoing tunnels were requested
+// by this node; incoming ones listen here on behalf of a peer.
+type TunnelInfo struct {
+	ID        string `json:"id"`
+	PeerID    string `json:"peer_id"`
+	Direction string `json:"direction"` // "outgoing" or "incoming"
+	Listen    string `json:"listen"`    // listen address on the listening peer
+	LocalAddr string `json:"local_addr,omitempty"`
+	Created   string `json:"created"`
+}
+
+// InviteRequest is the body for POST /v1/invites.
+type InviteRequest struct {
+	Name       string `json:"name,omitempty"`        // inviter name shown to the joiner
+	TTLSeconds int    `json:"ttl_seconds,omitempty"` // 0 = default (24h)
+}
+
+// InviteInfo describes a pending asynchronous invite. Code is only
+// returned when the invite is created.
+type InviteInfo struct {
+	ID      string   `json:"id"`
+	Code    string   `json:"code,omitempty"`
+	Name    string   `json:"name,omitempty"`
+	Relays  []string `json:"relays"` // relay peer IDs holding the introduction
+	Created string   `json:"created"`
+	Expires string   `json:"expires"`
+}
+
 // ConnectRequest is the body for POST /v1/connect.
 type ConnectRequest struct {
-	Peer    string `json:"peer"`
-	Service string `json:"service"`
-	Listen  string `json:"listen"`
+	Peer     string `json:"peer"`
+	Service  string `json:"service"`
+	Listen   string `json:"listen"`
+	Protocol string `json:"protocol,omitempty"` // "tcp" (default) or "udp"
+	Warmup   bool   `json:"warmup,omitempty"`   // keep the peer connection alive between client connections
+
+	// Permissions for a unix: listen address (ignored for TCP).
+	SocketMode  string `json:"socket_mode,omitempty"`  // octal, e.g. "0660"
+	SocketGroup string `json:"socket_group,omitempty"` // group name or GID
 }
 
 // ConnectResponse is returned by POST /v1/connect.
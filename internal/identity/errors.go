@@ -0,0 +1,28 @@
+package identity
+
+import "errors"
+
+var (
+	// ErrPassphraseRequired is returned when an encrypted key file is loaded
+	// and no passphrase source is available.
+	ErrPassphraseRequired = errors.New("key file is encrypted; passphrase required")
+
+	// ErrWrongPassphrase is returned when an encrypted key cannot be opened,
+	// either because the passphrase is wrong or the file was modified.
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key file")
+
+	// ErrEmptyPassphrase is returned when encrypting with an empty passphrase.
+	ErrEmptyPassphrase = errors.New("passphrase must not be empty")
+
+	// ErrInvalidEncryptedKey is returned when an encrypted key file has a
+	// malformed header or unsupported parameters.
+	ErrInvalidEncryptedKey = errors.New("invalid encrypted key file")
+
+	// ErrKeyAlreadyEncrypted is returned when encrypting a key file that is
+	// already encrypted.
+	ErrKeyAlreadyEncrypted = errors.New("key file is already encrypted")
+
+	// ErrKeyNotEncrypted is returned when decrypting or re-keying a key file
+	// that is stored in plaintext.
+	ErrKeyNotEncrypted = errors.New("key file is not encrypted")
+)
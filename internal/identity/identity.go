@@ -26,16 +26,24 @@ func CheckKeyFilePermissions(path string) error {
 }
 
 // LoadOrCreateIdentity loads an existing identity from a file or creates a new one.
+// Encrypted key files are unlocked with PEERUP_KEY_PASSPHRASE.
 func LoadOrCreateIdentity(path string) (crypto.PrivKey, error) {
+	return LoadOrCreateIdentityWith(path, EnvPassphrase)
+}
+
+// LoadOrCreateIdentityWith is LoadOrCreateIdentity with an explicit
+// passphrase source for encrypted key files. New keys are written in
+// plaintext; use EncryptKey to protect them.
+func LoadOrCreateIdentityWith(path string, passphrase PassphraseFunc) (crypto.PrivKey, error) {
 	// Try to load existing key
 	if data, err := os.ReadFile(path); err == nil {
 		// Check permissions before using the key
 		if err := CheckKeyFilePermissions(path); err != nil {
 			return nil, err
 		}
-		priv, err := crypto.UnmarshalPrivateKey(data)
+		priv, err := ParseKeyFile(data, passphrase)
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal key from %s: %w", path, err)
+			return nil, fmt.Errorf("failed to load key from %s: %w", path, err)
 		}
 		return priv, nil
 	}
@@ -61,7 +69,12 @@ func LoadOrCreateIdentity(path string) (crypto.PrivKey, error) {
 
 // PeerIDFromKeyFile loads (or creates) a key file and returns the derived peer ID.
 func PeerIDFromKeyFile(path string) (peer.ID, error) {
-	priv, err := LoadOrCreateIdentity(path)
+	return PeerIDFromKeyFileWith(path, EnvPassphrase)
+}
+
+// PeerIDFromKeyFileWith is PeerIDFromKeyFile with an explicit passphrase source.
+func PeerIDFromKeyFileWith(path string, passphrase PassphraseFunc) (peer.ID, error) {
+	priv, err := LoadOrCreateIdentityWith(path, passphrase)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,166 @@
+package identity
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func staticPassphrase(p string) PassphraseFunc {
+	return func() ([]byte, error) { return []byte(p), nil }
+}
+
+func samePeer(t *testing.T, a, b crypto.PrivKey) {
+	t.Helper()
+	ida, _ := peer.IDFromPrivateKey(a)
+	idb, _ := peer.IDFromPrivateKey(b)
+	if ida != idb {
+		t.Fatalf("peer IDs differ: %s != %s", ida, idb)
+	}
+}
+
+func TestEncryptDecryptKey(t *testing.T) {
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := EncryptKey(priv, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("EncryptKey() error = %v", err)
+	}
+	if !IsEncryptedKey(enc) {
+		t.Fatal("IsEncryptedKey() = false for encrypted output")
+	}
+	raw, _ := crypto.MarshalPrivateKey(priv)
+	if IsEncryptedKey(raw) {
+		t.Fatal("IsEncryptedKey() = true for plaintext key")
+	}
+	if bytes.Contains(enc, raw) {
+		t.Fatal("encrypted file contains the plaintext key")
+	}
+
+	got, err := DecryptKey(enc, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("DecryptKey() error = %v", err)
+	}
+	samePeer(t, priv, got)
+
+	if _, err := DecryptKey(enc, []byte("wrong")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase: err = %v, want ErrWrongPassphrase", err)
+	}
+	if _, err := EncryptKey(priv, nil); !errors.Is(err, ErrEmptyPassphrase) {
+		t.Errorf("empty passphrase: err = %v, want ErrEmptyPassphrase", err)
+	}
+}
+
+func TestDecryptKey_TamperedHeader(t *testing.T) {
+	priv, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	enc, err := EncryptKey(priv, []byte("pw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lowering the KDF cost must not yield a usable key.
+	weakened := bytes.Replace(enc, []byte("Argon2-Time: 3"), []byte("Argon2-Time: 1"), 1)
+	if _, err := DecryptKey(weakened, []byte("pw")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("weakened header: err = %v, want ErrWrongPassphrase", err)
+	}
+
+	huge := bytes.Replace(enc, []byte("Argon2-Memory: 65536"), []byte("Argon2-Memory: 99999999"), 1)
+	if _, err := DecryptKey(huge, []byte("pw")); !errors.Is(err, ErrInvalidEncryptedKey) {
+		t.Errorf("oversized memory: err = %v, want ErrInvalidEncryptedKey", err)
+	}
+
+	badKDF := bytes.Replace(enc, []byte("KDF: argon2id"), []byte("KDF: md5"), 1)
+	if _, err := DecryptKey(badKDF, []byte("pw")); !errors.Is(err, ErrInvalidEncryptedKey) {
+		t.Errorf("unknown KDF: err = %v, want ErrInvalidEncryptedKey", err)
+	}
+}
+
+func TestLoadOrCreateIdentityWith_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "test.key")
+
+	priv, err := LoadOrCreateIdentity(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := EncryptKey(priv, []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteKeyFile(keyPath, enc); err != nil {
+		t.Fatalf("WriteKeyFile() error = %v", err)
+	}
+	if info, _ := os.Stat(keyPath); info.Mode().Perm() != 0600 {
+		t.Errorf("key file permissions = %04o, want 0600", info.Mode().Perm())
+	}
+
+	got, err := LoadOrCreateIdentityWith(keyPath, staticPassphrase("s3cret"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateIdentityWith() error = %v", err)
+	}
+	samePeer(t, priv, got)
+
+	if _, err := LoadOrCreateIdentityWith(keyPath, nil); !errors.Is(err, ErrPassphraseRequired) {
+		t.Errorf("nil passphrase: err = %v, want ErrPassphraseRequired", err)
+	}
+
+	t.Setenv(PassphraseEnv, "s3cret")
+	if _, err := PeerIDFromKeyFile(keyPath); err != nil {
+		t.Errorf("PeerIDFromKeyFile() with %s: %v", PassphraseEnv, err)
+	}
+}
+
+func TestLoadIdentity_PlaintextNeedsNoPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "test.key")
+	priv, err := LoadOrCreateIdentity(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	got, err := LoadIdentity(keyPath, func() ([]byte, error) {
+		called = true
+		return nil, ErrPassphraseRequired
+	})
+	if err != nil {
+		t.Fatalf("LoadIdentity() error = %v", err)
+	}
+	if called {
+		t.Error("passphrase source consulted for plaintext key")
+	}
+	samePeer(t, priv, got)
+
+	if _, err := LoadIdentity(filepath.Join(dir, "missing.key"), nil); err == nil {
+		t.Error("LoadIdentity() should not create missing keys")
+	}
+}
+
+func TestReadPassphraseFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pass")
+	if err := os.WriteFile(path, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadPassphraseFile(path)
+	if err != nil {
+		t.Fatalf("ReadPassphraseFile() error = %v", err)
+	}
+	if string(got) != "hunter2" {
+		t.Errorf("passphrase = %q, want %q", got, "hunter2")
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPassphraseFile(path); err == nil {
+		t.Error("world-readable passphrase file should be rejected")
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"crypto/rand"
 	"encoding/base32"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
 	ma "github.com/multiformats/go-multiaddr"
@@ -15,14 +18,26 @@ import (
 
 var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
 
+// ErrChecksum is returned by Decode when a v3 code fails its checksum,
+// which almost always means the code was mistyped.
+var ErrChecksum = errors.New("invite code checksum mismatch")
+
 // InviteData holds the payload encoded in an invite code.
 type InviteData struct {
-	Version   byte     // protocol version (VersionV1 = PAKE invite, VersionV2 = relay pairing)
-	Token     [8]byte  // v1 PAKE token (8 bytes)
-	TokenV2   []byte   // v2 pairing token (16 bytes)
-	RelayAddr string   // full relay multiaddr (e.g., /ip4/.../tcp/.../p2p/...)
-	PeerID    peer.ID  // inviter's peer ID (v1 only; empty for v2)
-	Network   string   // DHT namespace (empty = global network)
+	Version    byte      // protocol version (VersionV1 = PAKE invite, VersionV2/VersionV3 = relay pairing)
+	Token      [8]byte   // v1 PAKE token (8 bytes)
+	TokenV2    []byte    // v2/v3 pairing token (16 bytes)
+	RelayAddr  string    // full relay multiaddr (e.g., /ip4/.../tcp/.../p2p/...); first of RelayAddrs
+	RelayAddrs []string  // every relay multiaddr in the code (one for v1/v2)
+	PeerID     peer.ID   // inviter's peer ID (v1 only; empty for v2/v3)
+	Network    string    // DHT namespace (empty = global network)
+	Expires    time.Time // when the code stops working (v3 only; zero = not encoded)
+	Mailbox    bool      // v3 asynchronous invite: redeem from the relay mailbox, not a pairing group
+}
+
+// Expired reports whether the code carries an expiry that has passed.
+func (d *InviteData) Expired() bool {
+	return !d.Expires.IsZero() && time.Now().After(d.Expires)
 }
 
 // GenerateToken creates a cryptographically random 8-byte token.
@@ -103,18 +118,7 @@ func Encode(data *InviteData) (string, error) {
 	buf = append(buf, nsBytes...)
 	buf = append(buf, inviterIDBytes...)
 
-	encoded := encoding.EncodeToString(buf)
-
-	// Group with dashes every 4 characters for readability
-	var groups []string
-	for i := 0; i < len(encoded); i += 4 {
-		end := i + 4
-		if end > len(encoded) {
-			end = len(encoded)
-		}
-		groups = append(groups, encoded[i:end])
-	}
-	return strings.Join(groups, "-"), nil
+	return groupCode(encoding.EncodeToString(buf)), nil
 }
 
 // EncodeV2 serializes a v2 relay pairing invite code.
@@ -183,8 +187,178 @@ func EncodeV2(token []byte, relayAddr string, network string) (string, error) {
 	buf = append(buf, byte(len(nsBytes)))
 	buf = append(buf, nsBytes...)
 
-	encoded := encoding.EncodeToString(buf)
+	return groupCode(encoding.EncodeToString(buf)), nil
+}
+
+// v3 limits keep codes short enough to type and to fit in a QR code.
+const (
+	maxV3Relays        = 8 // distinct relay peer IDs per code
+	maxV3AddrsPerRelay = 8 // transport addresses per relay
+)
+
+// v3 transport kinds: low nibble is the IP version, high nibble the transport.
+const (
+	v3TCP4  byte = 0x04 // /ip4/<ip>/tcp/<port>
+	v3TCP6  byte = 0x06 // /ip6/<ip>/tcp/<port>
+	v3QUIC4 byte = 0x14 // /ip4/<ip>/udp/<port>/quic-v1
+	v3QUIC6 byte = 0x16 // /ip6/<ip>/udp/<port>/quic-v1
+)
+
+// v3Flags bits.
+const (
+	v3FlagExpires byte = 0x01 // expiry field present
+	v3FlagMailbox byte = 0x02 // asynchronous invite (see mailbox.go)
+)
+
+// EncodeV3 serializes a v3 relay pairing invite code. relayAddrs are full
+// relay multiaddrs over IPv4 or IPv6 with TCP or QUIC, each ending in
+// /p2p/<relay-id>; addresses of the same relay share one peer ID entry.
+// A zero expires leaves the expiry out of the code.
+//
+// v3 binary format (relay pairing, several relays):
+//
+//	[1]  version (0x03)
+//	[1]  flags (bit 0: expiry present, bit 1: mailbox invite)
+//	[16] token (128-bit random)
+//	[4]  expiry, unix seconds (big-endian; only if flag bit 0 is set)
+//	[1]  namespace length (0 = global network)
+//	[L]  namespace bytes (if length > 0)
+//	[1]  relay count (1-8)
+//	per relay:
+//	  [1] relay peer ID length
+//	  [N] relay peer ID (raw multihash bytes)
+//	  [1] address count (1-8)
+//	  per address:
+//	    [1]    transport (0x04 ip4/tcp, 0x06 ip6/tcp, 0x14 ip4/quic-v1, 0x16 ip6/quic-v1)
+//	    [4|16] IP address
+//	    [2]    port (big-endian)
+//	[4]  CRC-32 (IEEE) of all preceding bytes (big-endian)
+func EncodeV3(token []byte, relayAddrs []string, network string, expires time.Time) (string, error) {
+	return encodeV3(0, token, relayAddrs, network, expires)
+}
 
+// EncodeMailbox serializes an asynchronous invite code: a v3 code with the
+// mailbox flag set, pointing at the relays holding the sealed introduction.
+func EncodeMailbox(token []byte, relayAddrs []string, network string, expires time.Time) (string, error) {
+	return encodeV3(v3FlagMailbox, token, relayAddrs, network, expires)
+}
+
+func encodeV3(flags byte, token []byte, relayAddrs []string, network string, expires time.Time) (string, error) {
+	if len(token) != 16 {
+		return "", fmt.Errorf("v3 token must be 16 bytes, got %d", len(token))
+	}
+	if len(network) > 63 {
+		return "", fmt.Errorf("network namespace too long: %d bytes (max 63)", len(network))
+	}
+	if len(relayAddrs) == 0 {
+		return "", fmt.Errorf("at least one relay address is required")
+	}
+
+	// Group addresses by relay peer ID, keeping first-seen order.
+	var relayIDs []peer.ID
+	addrsByRelay := make(map[peer.ID][][]byte)
+	for _, a := range relayAddrs {
+		pid, endpoint, err := encodeV3RelayAddr(a)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := addrsByRelay[pid]; !ok {
+			relayIDs = append(relayIDs, pid)
+		}
+		addrsByRelay[pid] = append(addrsByRelay[pid], endpoint)
+	}
+	if len(relayIDs) > maxV3Relays {
+		return "", fmt.Errorf("too many relays: %d (max %d)", len(relayIDs), maxV3Relays)
+	}
+
+	if !expires.IsZero() {
+		flags |= v3FlagExpires
+	}
+
+	buf := make([]byte, 0, 128)
+	buf = append(buf, VersionV3, flags)
+	buf = append(buf, token...)
+	if flags&v3FlagExpires != 0 {
+		secs := expires.Unix()
+		if secs <= 0 || secs > int64(^uint32(0)) {
+			return "", fmt.Errorf("expiry out of range: %s", expires)
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(secs))
+	}
+	buf = append(buf, byte(len(network)))
+	buf = append(buf, network...)
+	buf = append(buf, byte(len(relayIDs)))
+	for _, pid := range relayIDs {
+		endpoints := addrsByRelay[pid]
+		if len(endpoints) > maxV3AddrsPerRelay {
+			return "", fmt.Errorf("too many addresses for relay %s: %d (max %d)", pid, len(endpoints), maxV3AddrsPerRelay)
+		}
+		buf = append(buf, byte(len(pid)))
+		buf = append(buf, pid...)
+		buf = append(buf, byte(len(endpoints)))
+		for _, e := range endpoints {
+			buf = append(buf, e...)
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	return groupCode(encoding.EncodeToString(buf)), nil
+}
+
+// ValidateV3RelayAddr reports whether addr can be carried in a v3 code.
+func ValidateV3RelayAddr(addr string) error {
+	_, _, err := encodeV3RelayAddr(addr)
+	return err
+}
+
+// encodeV3RelayAddr splits a relay multiaddr into its peer ID and the
+// binary transport entry of the v3 format.
+func encodeV3RelayAddr(addr string) (peer.ID, []byte, error) {
+	ai, err := peer.AddrInfoFromString(addr)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid relay address %q: %w", addr, err)
+	}
+	if len(ai.Addrs) != 1 {
+		return "", nil, fmt.Errorf("relay address %q has no transport", addr)
+	}
+
+	// Canonical multiaddr strings: /ip4/<ip>/tcp/<port> or /ip6/<ip>/udp/<port>/quic-v1.
+	parts := strings.Split(ai.Addrs[0].String(), "/")
+	var kind byte
+	switch {
+	case len(parts) == 5 && parts[1] == "ip4" && parts[3] == "tcp":
+		kind = v3TCP4
+	case len(parts) == 5 && parts[1] == "ip6" && parts[3] == "tcp":
+		kind = v3TCP6
+	case len(parts) == 6 && parts[1] == "ip4" && parts[3] == "udp" && parts[5] == "quic-v1":
+		kind = v3QUIC4
+	case len(parts) == 6 && parts[1] == "ip6" && parts[3] == "udp" && parts[5] == "quic-v1":
+		kind = v3QUIC6
+	default:
+		return "", nil, fmt.Errorf("unsupported relay address %q: need ip4 or ip6 with tcp or udp/quic-v1", addr)
+	}
+
+	ip := net.ParseIP(parts[2])
+	if kind&0x0f == 0x04 {
+		ip = ip.To4()
+	} else {
+		ip = ip.To16()
+	}
+	if ip == nil {
+		return "", nil, fmt.Errorf("invalid IP address in relay address %q", addr)
+	}
+	port, err := strconv.Atoi(parts[4])
+	if err != nil || port < 0 || port > 65535 {
+		return "", nil, fmt.Errorf("invalid port in relay address %q", addr)
+	}
+
+	entry := append([]byte{kind}, ip...)
+	entry = append(entry, byte(port>>8), byte(port))
+	return ai.ID, entry, nil
+}
+
+// groupCode splits an encoded code with dashes every 4 characters for readability.
+func groupCode(encoded string) string {
 	var groups []string
 	for i := 0; i < len(encoded); i += 4 {
 		end := i + 4
@@ -193,7 +367,7 @@ func EncodeV2(token []byte, relayAddr string, network string) (string, error) {
 		}
 		groups = append(groups, encoded[i:end])
 	}
-	return strings.Join(groups, "-"), nil
+	return strings.Join(groups, "-")
 }
 
 // Decode parses a dash-separated base32 invite code back into InviteData.
@@ -218,8 +392,10 @@ func Decode(code string) (*InviteData, error) {
 		return decodeV1(raw)
 	case VersionV2:
 		return decodeV2(raw)
+	case VersionV3:
+		return decodeV3(raw)
 	default:
-		if ver > VersionV2 {
+		if ver > VersionV3 {
 			return nil, fmt.Errorf("invite code version %d is newer than supported; please upgrade peerup", ver)
 		}
 		return nil, fmt.Errorf("unsupported invite code version: %d", ver)
@@ -263,6 +439,7 @@ func decodeV1(raw []byte) (*InviteData, error) {
 	}
 
 	data.RelayAddr = fmt.Sprintf("/ip4/%s/tcp/%d/p2p/%s", ip.String(), port, relayPeerID.String())
+	data.RelayAddrs = []string{data.RelayAddr}
 	data.PeerID = inviterPeerID
 
 	return &data, nil
@@ -316,6 +493,141 @@ func decodeV2(raw []byte) (*InviteData, error) {
 	}
 
 	data.RelayAddr = fmt.Sprintf("/ip4/%s/tcp/%d/p2p/%s", ip.String(), port, relayPeerID.String())
+	data.RelayAddrs = []string{data.RelayAddr}
+	return &data, nil
+}
+
+// decodeV3 parses a v3 relay pairing invite code. The checksum is verified
+// before anything else so a typo is reported as such.
+func decodeV3(raw []byte) (*InviteData, error) {
+	// Minimum: version(1) + flags(1) + token(16) + nsLen(1) + relayCount(1) + crc(4) = 24
+	if len(raw) < 24 {
+		return nil, fmt.Errorf("v3 invite code too short")
+	}
+	body := raw[:len(raw)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(raw[len(raw)-4:]) {
+		return nil, ErrChecksum
+	}
+
+	offset := 0
+	take := func(n int, what string) ([]byte, error) {
+		if n < 0 || len(body) < offset+n {
+			return nil, fmt.Errorf("v3 invite code truncated (%s)", what)
+		}
+		b := body[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+
+	var data InviteData
+	data.Version = VersionV3
+	flags := body[1]
+	if flags&^(v3FlagExpires|v3FlagMailbox) != 0 {
+		return nil, fmt.Errorf("v3 invite code has unknown flags 0x%02x; please upgrade peerup", flags)
+	}
+	data.Mailbox = flags&v3FlagMailbox != 0
+	offset = 2
+	tok, _ := take(16, "token")
+	data.TokenV2 = append([]byte(nil), tok...)
+
+	if flags&v3FlagExpires != 0 {
+		b, err := take(4, "expiry")
+		if err != nil {
+			return nil, err
+		}
+		data.Expires = time.Unix(int64(binary.BigEndian.Uint32(b)), 0)
+	}
+
+	b, err := take(1, "namespace length")
+	if err != nil {
+		return nil, err
+	}
+	ns, err := take(int(b[0]), "namespace data")
+	if err != nil {
+		return nil, err
+	}
+	data.Network = string(ns)
+
+	b, err = take(1, "relay count")
+	if err != nil {
+		return nil, err
+	}
+	relayCount := int(b[0])
+	if relayCount < 1 || relayCount > maxV3Relays {
+		return nil, fmt.Errorf("v3 invite code has %d relays (want 1-%d)", relayCount, maxV3Relays)
+	}
+	for i := 0; i < relayCount; i++ {
+		b, err := take(1, "relay peer ID length")
+		if err != nil {
+			return nil, err
+		}
+		idBytes, err := take(int(b[0]), "relay peer ID")
+		if err != nil {
+			return nil, err
+		}
+		relayPeerID := peer.ID(idBytes)
+		if err := relayPeerID.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid relay peer ID in invite code: %w", err)
+		}
+		if err := strictMultihashLen(idBytes); err != nil {
+			return nil, fmt.Errorf("invalid relay peer ID in invite code: %w", err)
+		}
+
+		b, err = take(1, "address count")
+		if err != nil {
+			return nil, err
+		}
+		addrCount := int(b[0])
+		if addrCount < 1 || addrCount > maxV3AddrsPerRelay {
+			return nil, fmt.Errorf("v3 invite code has %d addresses for a relay (want 1-%d)", addrCount, maxV3AddrsPerRelay)
+		}
+		for j := 0; j < addrCount; j++ {
+			b, err := take(1, "transport")
+			if err != nil {
+				return nil, err
+			}
+			kind := b[0]
+			ipLen := net.IPv4len
+			if kind&0x0f == 0x06 {
+				ipLen = net.IPv6len
+			}
+			ipBytes, err := take(ipLen, "relay IP")
+			if err != nil {
+				return nil, err
+			}
+			portBytes, err := take(2, "relay port")
+			if err != nil {
+				return nil, err
+			}
+			ip := net.IP(append([]byte(nil), ipBytes...))
+			port := int(portBytes[0])<<8 | int(portBytes[1])
+
+			var addr string
+			switch kind {
+			case v3TCP4:
+				addr = fmt.Sprintf("/ip4/%s/tcp/%d", ip, port)
+			case v3TCP6:
+				addr = fmt.Sprintf("/ip6/%s/tcp/%d", ip, port)
+			case v3QUIC4:
+				addr = fmt.Sprintf("/ip4/%s/udp/%d/quic-v1", ip, port)
+			case v3QUIC6:
+				addr = fmt.Sprintf("/ip6/%s/udp/%d/quic-v1", ip, port)
+			default:
+				return nil, fmt.Errorf("v3 invite code has unknown transport 0x%02x; please upgrade peerup", kind)
+			}
+			addr += "/p2p/" + relayPeerID.String()
+			if _, err := ma.NewMultiaddr(addr); err != nil {
+				return nil, fmt.Errorf("invalid relay address in invite code: %w", err)
+			}
+			data.RelayAddrs = append(data.RelayAddrs, addr)
+		}
+	}
+
+	if offset != len(body) {
+		return nil, fmt.Errorf("v3 invite code has %d trailing bytes", len(body)-offset)
+	}
+
+	data.RelayAddr = data.RelayAddrs[0]
 	return &data, nil
 }
 
@@ -1,8 +1,10 @@
 package invite
 
 import (
+	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -146,13 +148,13 @@ func TestDecodeInvalid(t *testing.T) {
 }
 
 func TestDecodeFutureVersion(t *testing.T) {
-	// Version 0x03 should be rejected with a helpful message
+	// Version 0x04 should be rejected with a helpful message
 	raw := make([]byte, 30)
-	raw[0] = 0x03
+	raw[0] = 0x04
 	encoded := encoding.EncodeToString(raw)
 	_, err := Decode(encoded)
 	if err == nil {
-		t.Error("expected error for version 3")
+		t.Error("expected error for version 4")
 	}
 	if !strings.Contains(err.Error(), "newer than supported") {
 		t.Errorf("error should mention upgrade, got: %v", err)
@@ -377,3 +379,166 @@ func TestV2ShorterThanV1(t *testing.T) {
 		t.Errorf("v2 code (%d chars) should be shorter than v1 (%d chars)", len(v2Code), len(v1Code))
 	}
 }
+
+// --- v3 multi-relay tests ---
+
+func TestV3EncodeDecodeRoundTrip(t *testing.T) {
+	token := make([]byte, 16)
+	for i := range token {
+		token[i] = byte(i + 1)
+	}
+	addrs := []string{
+		testRelayAddr,
+		"/ip6/2001:db8::50/tcp/7777/p2p/12D3KooWRzaGMTqQbRHNMZkAYj8ALUXoK99qSjhiFLanDoVWK9An",
+		"/ip6/2001:db8::51/udp/7777/quic-v1/p2p/12D3KooWQvzCBP1MdU6g3UC6rUwHtDkbMUWQKDapmHqQFPqZqTn7",
+		"/ip4/198.51.100.7/udp/443/quic-v1/p2p/12D3KooWQvzCBP1MdU6g3UC6rUwHtDkbMUWQKDapmHqQFPqZqTn7",
+	}
+	expires := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	code, err := EncodeV3(token, addrs, "family-net", expires)
+	if err != nil {
+		t.Fatalf("EncodeV3: %v", err)
+	}
+	t.Logf("v3 invite code (%d chars): %s", len(code), code)
+
+	decoded, err := Decode(code)
+	if err != nil {
+		t.Fatalf("Decode v3: %v", err)
+	}
+	if decoded.Version != VersionV3 {
+		t.Errorf("Version = %d, want %d", decoded.Version, VersionV3)
+	}
+	if string(decoded.TokenV2) != string(token) {
+		t.Errorf("TokenV2 = %x, want %x", decoded.TokenV2, token)
+	}
+	if decoded.Network != "family-net" {
+		t.Errorf("Network = %q, want family-net", decoded.Network)
+	}
+	if !decoded.Expires.Equal(expires) {
+		t.Errorf("Expires = %v, want %v", decoded.Expires, expires)
+	}
+	if decoded.Expired() {
+		t.Error("Expired() = true for a code valid for another hour")
+	}
+	if strings.Join(decoded.RelayAddrs, " ") != strings.Join(addrs, " ") {
+		t.Errorf("RelayAddrs = %v, want %v", decoded.RelayAddrs, addrs)
+	}
+	if decoded.RelayAddr != addrs[0] {
+		t.Errorf("RelayAddr = %s, want %s", decoded.RelayAddr, addrs[0])
+	}
+}
+
+func TestV3NoExpiry(t *testing.T) {
+	code, err := EncodeV3(make([]byte, 16), []string{testRelayAddr}, "", time.Time{})
+	if err != nil {
+		t.Fatalf("EncodeV3: %v", err)
+	}
+	decoded, err := Decode(code)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !decoded.Expires.IsZero() || decoded.Expired() {
+		t.Errorf("Expires = %v, want zero", decoded.Expires)
+	}
+
+	past, err := EncodeV3(make([]byte, 16), []string{testRelayAddr}, "", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("EncodeV3: %v", err)
+	}
+	decoded, err = Decode(past)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !decoded.Expired() {
+		t.Error("Expired() = false for a code that expired a minute ago")
+	}
+}
+
+func TestMailboxCodeFlag(t *testing.T) {
+	expires := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	code, err := EncodeMailbox(make([]byte, 16), []string{testRelayAddr}, "family-net", expires)
+	if err != nil {
+		t.Fatalf("EncodeMailbox: %v", err)
+	}
+	decoded, err := Decode(code)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !decoded.Mailbox || decoded.Version != VersionV3 || !decoded.Expires.Equal(expires) || decoded.Network != "family-net" {
+		t.Errorf("decoded = %+v", decoded)
+	}
+
+	plain, _ := EncodeV3(make([]byte, 16), []string{testRelayAddr}, "", time.Time{})
+	if decoded, _ := Decode(plain); decoded.Mailbox {
+		t.Error("pairing code decoded as a mailbox invite")
+	}
+}
+
+func TestV3DetectsTypos(t *testing.T) {
+	code, err := EncodeV3(make([]byte, 16), []string{testRelayAddr}, "", time.Time{})
+	if err != nil {
+		t.Fatalf("EncodeV3: %v", err)
+	}
+	clean := strings.ReplaceAll(code, "-", "")
+
+	// Change each character after the version byte to another base32 letter.
+	for i := 2; i < len(clean); i++ {
+		typo := []byte(clean)
+		if typo[i] == 'A' {
+			typo[i] = 'B'
+		} else {
+			typo[i] = 'A'
+		}
+		_, err := Decode(string(typo))
+		if err == nil {
+			t.Fatalf("typo at position %d was not detected", i)
+		}
+		if i < len(clean)-1 && !errors.Is(err, ErrChecksum) {
+			t.Errorf("typo at position %d: error = %v, want ErrChecksum", i, err)
+		}
+	}
+}
+
+func TestV3RejectsUnsupportedAddrs(t *testing.T) {
+	token := make([]byte, 16)
+	for _, addr := range []string{
+		"/dns4/relay.example.com/tcp/7777/p2p/12D3KooWRzaGMTqQbRHNMZkAYj8ALUXoK99qSjhiFLanDoVWK9An",
+		"/ip4/203.0.113.50/tcp/7777/ws/p2p/12D3KooWRzaGMTqQbRHNMZkAYj8ALUXoK99qSjhiFLanDoVWK9An",
+		"/ip4/203.0.113.50/tcp/7777",
+	} {
+		if _, err := EncodeV3(token, []string{addr}, "", time.Time{}); err == nil {
+			t.Errorf("EncodeV3(%s) should fail", addr)
+		}
+	}
+	if _, err := EncodeV3(token, nil, "", time.Time{}); err == nil {
+		t.Error("EncodeV3 without relays should fail")
+	}
+}
+
+func TestV3SingleRelayLength(t *testing.T) {
+	v2Code, _ := EncodeV2(make([]byte, 16), testRelayAddr, "")
+	v3Code, err := EncodeV3(make([]byte, 16), []string{testRelayAddr}, "", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("EncodeV3: %v", err)
+	}
+	t.Logf("v2 code length: %d chars, v3: %d chars", len(v2Code), len(v3Code))
+
+	// Flags, transport, address count, expiry and checksum cost 11 bytes.
+	if len(v3Code) > len(v2Code)+25 {
+		t.Errorf("v3 code (%d chars) is much longer than v2 (%d chars)", len(v3Code), len(v2Code))
+	}
+}
+
+func TestV1V2DecodeFillRelayAddrs(t *testing.T) {
+	code, _ := EncodeV2(make([]byte, 16), testRelayAddr, "")
+	decoded, err := Decode(code)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(decoded.RelayAddrs) != 1 || decoded.RelayAddrs[0] != decoded.RelayAddr {
+		t.Errorf("v2 RelayAddrs = %v, want [%s]", decoded.RelayAddrs, decoded.RelayAddr)
+	}
+	if !decoded.Expires.IsZero() {
+		t.Errorf("v2 Expires = %v, want zero", decoded.Expires)
+	}
+}
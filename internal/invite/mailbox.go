@@ -0,0 +1,291 @@
+package invite
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Asynchronous (mailbox) invites.
+//
+// The inviter's daemon leaves a sealed introduction in a relay mailbox and
+// goes on with its life. The joiner redeems it later with the code and
+// leaves a sealed reply, which the relay hands to the inviter's daemon the
+// next time it connects. The relay stores both but can read neither:
+//
+//	mailbox ID = SHA-256("peerup-mailbox-id" || token)[:16]
+//	intro      = AEAD(HKDF(token, "peerup-mailbox-intro-v1"),
+//	                  inviter peer ID, name, namespace, X25519 public key A)
+//	reply      = B || AEAD(HKDF(X25519(b, A) || token, "peerup-mailbox-reply-v1"),
+//	                       joiner peer ID, name)
+//
+// As in the interactive PAKE handshake, the reply key is bound to both the
+// DH exchange and the token, so only the holder of the code can produce a
+// reply the inviter accepts, and only the inviter (who kept the private key
+// for A) can open it. AEAD is XChaCha20-Poly1305 with the mailbox ID as
+// associated data, so sealed blobs cannot be moved between mailboxes.
+
+const (
+	// MailboxIDSize is the length of a mailbox ID derived from a token.
+	MailboxIDSize = 16
+
+	mailboxIDLabel    = "peerup-mailbox-id"
+	mailboxIntroInfo  = "peerup-mailbox-intro-v1"
+	mailboxReplyInfo  = "peerup-mailbox-reply-v1"
+	maxMailboxNameLen = 64
+)
+
+// ErrMailboxSeal is returned when a sealed introduction or reply does not
+// open, which means a wrong code or a tampered blob.
+var ErrMailboxSeal = errors.New("mailbox message does not decrypt (wrong invite code?)")
+
+// MailboxIntro is the inviter's side of an asynchronous invite.
+type MailboxIntro struct {
+	PeerID    peer.ID // inviter
+	Name      string  // inviter's friendly name (may be empty)
+	Network   string  // DHT namespace (empty = global network)
+	PublicKey []byte  // inviter's X25519 public key for the reply (32 bytes)
+}
+
+// MailboxReply is the joiner's answer to an asynchronous invite.
+type MailboxReply struct {
+	PeerID peer.ID // joiner
+	Name   string  // joiner's friendly name (may be empty)
+}
+
+// MailboxID derives the relay mailbox ID for a token. The relay only ever
+// sees this hash, never the token.
+func MailboxID(token []byte) [MailboxIDSize]byte {
+	h := sha256.New()
+	h.Write([]byte(mailboxIDLabel))
+	h.Write(token)
+	var id [MailboxIDSize]byte
+	copy(id[:], h.Sum(nil))
+	return id
+}
+
+// GenerateMailboxToken creates the 16-byte token of an asynchronous invite.
+func GenerateMailboxToken() ([]byte, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("token generation failed: %w", err)
+	}
+	return token, nil
+}
+
+// GenerateMailboxKey creates the inviter's X25519 key pair for one invite.
+// The private key must be kept until the reply arrives.
+func GenerateMailboxKey() (priv, pub []byte, err error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("X25519 key generation failed: %w", err)
+	}
+	return key.Bytes(), key.PublicKey().Bytes(), nil
+}
+
+// SealIntro encrypts the inviter's introduction under the token.
+func SealIntro(token []byte, intro *MailboxIntro) ([]byte, error) {
+	if len(intro.PublicKey) != 32 {
+		return nil, fmt.Errorf("mailbox public key must be 32 bytes, got %d", len(intro.PublicKey))
+	}
+	if len(intro.Network) > 63 {
+		return nil, fmt.Errorf("network namespace too long: %d bytes (max 63)", len(intro.Network))
+	}
+	buf, err := appendPeerAndName(nil, intro.PeerID, intro.Name)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, byte(len(intro.Network)))
+	buf = append(buf, intro.Network...)
+	buf = append(buf, intro.PublicKey...)
+
+	key, err := mailboxKey(token, mailboxIntroInfo)
+	if err != nil {
+		return nil, err
+	}
+	return sealMailbox(key, token, buf)
+}
+
+// OpenIntro decrypts an introduction left in a relay mailbox.
+func OpenIntro(token, sealed []byte) (*MailboxIntro, error) {
+	key, err := mailboxKey(token, mailboxIntroInfo)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openMailbox(key, token, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	var intro MailboxIntro
+	rest, err := readPeerAndName(plain, &intro.PeerID, &intro.Name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mailbox introduction: %w", err)
+	}
+	if len(rest) < 1 || len(rest) != 1+int(rest[0])+32 {
+		return nil, fmt.Errorf("invalid mailbox introduction: bad length")
+	}
+	intro.Network = string(rest[1 : 1+int(rest[0])])
+	intro.PublicKey = append([]byte(nil), rest[1+int(rest[0]):]...)
+	return &intro, nil
+}
+
+// SealReply encrypts the joiner's reply to the inviter's public key, bound
+// to the token. The output starts with the joiner's ephemeral public key.
+func SealReply(token, inviterPub []byte, reply *MailboxReply) ([]byte, error) {
+	session, err := NewPAKESession()
+	if err != nil {
+		return nil, err
+	}
+	key, err := mailboxReplyKey(session.privKey, inviterPub, token)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := appendPeerAndName(nil, reply.PeerID, reply.Name)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealMailbox(key, token, buf)
+	if err != nil {
+		return nil, err
+	}
+	return append(session.PublicKey(), sealed...), nil
+}
+
+// OpenReply decrypts a joiner's reply with the inviter's private key.
+func OpenReply(token, inviterPriv, sealed []byte) (*MailboxReply, error) {
+	if len(sealed) < 32 {
+		return nil, ErrMailboxSeal
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(inviterPriv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mailbox private key: %w", err)
+	}
+	key, err := mailboxReplyKey(priv, sealed[:32], token)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := openMailbox(key, token, sealed[32:])
+	if err != nil {
+		return nil, err
+	}
+
+	var reply MailboxReply
+	rest, err := readPeerAndName(plain, &reply.PeerID, &reply.Name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mailbox reply: %w", err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("invalid mailbox reply: %d trailing bytes", len(rest))
+	}
+	return &reply, nil
+}
+
+// mailboxKey derives a token-only key (used for the introduction).
+func mailboxKey(token []byte, info string) ([]byte, error) {
+	if len(token) != 16 {
+		return nil, fmt.Errorf("mailbox token must be 16 bytes, got %d", len(token))
+	}
+	return hkdfKey(token, info)
+}
+
+// mailboxReplyKey derives the reply key from the DH shared secret and token.
+func mailboxReplyKey(priv *ecdh.PrivateKey, remotePub, token []byte) ([]byte, error) {
+	if len(token) != 16 {
+		return nil, fmt.Errorf("mailbox token must be 16 bytes, got %d", len(token))
+	}
+	pub, err := ecdh.X25519().NewPublicKey(remotePub)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mailbox public key: %w", err)
+	}
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("X25519 key exchange failed: %w", err)
+	}
+	return hkdfKey(append(shared, token...), mailboxReplyInfo)
+}
+
+// hkdfKey derives an AEAD key from secret with HKDF-SHA256.
+func hkdfKey(secret []byte, info string) ([]byte, error) {
+	r := hkdf.New(sha256.New, secret, nil, []byte(info))
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, fmt.Errorf("HKDF key derivation failed: %w", err)
+	}
+	return key, nil
+}
+
+// sealMailbox encrypts plain with XChaCha20-Poly1305, authenticating the
+// mailbox ID. Output: nonce || ciphertext.
+func sealMailbox(key, token, plain []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("AEAD creation failed: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("nonce generation failed: %w", err)
+	}
+	id := MailboxID(token)
+	return aead.Seal(nonce, nonce, plain, id[:]), nil
+}
+
+// openMailbox reverses sealMailbox.
+func openMailbox(key, token, sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, fmt.Errorf("AEAD creation failed: %w", err)
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrMailboxSeal
+	}
+	id := MailboxID(token)
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], id[:])
+	if err != nil {
+		return nil, ErrMailboxSeal
+	}
+	return plain, nil
+}
+
+// appendPeerAndName encodes [1] peer ID length + [N] peer ID + [1] name length + [M] name.
+func appendPeerAndName(buf []byte, p peer.ID, name string) ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid peer ID: %w", err)
+	}
+	if len(name) > maxMailboxNameLen {
+		return nil, fmt.Errorf("name too long: %d bytes (max %d)", len(name), maxMailboxNameLen)
+	}
+	buf = append(buf, byte(len(p)))
+	buf = append(buf, p...)
+	buf = append(buf, byte(len(name)))
+	buf = append(buf, name...)
+	return buf, nil
+}
+
+// readPeerAndName decodes what appendPeerAndName wrote and returns the rest.
+func readPeerAndName(buf []byte, p *peer.ID, name *string) ([]byte, error) {
+	if len(buf) < 1 || len(buf) < 1+int(buf[0])+1 {
+		return nil, fmt.Errorf("truncated peer ID")
+	}
+	id := peer.ID(buf[1 : 1+int(buf[0])])
+	if err := id.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid peer ID: %w", err)
+	}
+	if err := strictMultihashLen([]byte(id)); err != nil {
+		return nil, fmt.Errorf("invalid peer ID: %w", err)
+	}
+	buf = buf[1+int(buf[0]):]
+	if len(buf) < 1+int(buf[0]) || int(buf[0]) > maxMailboxNameLen {
+		return nil, fmt.Errorf("truncated name")
+	}
+	*p = id
+	*name = string(buf[1 : 1+int(buf[0])])
+	return buf[1+int(buf[0]):], nil
+}
@@ -0,0 +1,180 @@
+package invite
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newMailboxInvite(t *testing.T) (token, priv, pub []byte) {
+	t.Helper()
+	token, err := GenerateMailboxToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, pub, err = GenerateMailboxKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, priv, pub
+}
+
+func TestMailboxRoundTrip(t *testing.T) {
+	token, priv, pub := newMailboxInvite(t)
+	inviter, joiner := generateTestPeerID(t), generateTestPeerID(t)
+
+	sealed, err := SealIntro(token, &MailboxIntro{PeerID: inviter, Name: "home", Network: "family", PublicKey: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	intro, err := OpenIntro(token, sealed)
+	if err != nil {
+		t.Fatalf("OpenIntro() error = %v", err)
+	}
+	if intro.PeerID != inviter || intro.Name != "home" || intro.Network != "family" || string(intro.PublicKey) != string(pub) {
+		t.Errorf("intro = %+v", intro)
+	}
+
+	reply, err := SealReply(token, intro.PublicKey, &MailboxReply{PeerID: joiner, Name: "laptop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenReply(token, priv, reply)
+	if err != nil {
+		t.Fatalf("OpenReply() error = %v", err)
+	}
+	if got.PeerID != joiner || got.Name != "laptop" {
+		t.Errorf("reply = %+v", got)
+	}
+}
+
+func TestMailboxWrongToken(t *testing.T) {
+	token, priv, pub := newMailboxInvite(t)
+	other, _, _ := newMailboxInvite(t)
+
+	sealed, err := SealIntro(token, &MailboxIntro{PeerID: generateTestPeerID(t), PublicKey: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenIntro(other, sealed); !errors.Is(err, ErrMailboxSeal) {
+		t.Errorf("OpenIntro(wrong token) error = %v, want ErrMailboxSeal", err)
+	}
+
+	// A reply from someone who only knows the public key, not the token,
+	// does not open.
+	reply, err := SealReply(other, pub, &MailboxReply{PeerID: generateTestPeerID(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenReply(token, priv, reply); !errors.Is(err, ErrMailboxSeal) {
+		t.Errorf("OpenReply(wrong token) error = %v, want ErrMailboxSeal", err)
+	}
+}
+
+func TestMailboxReplyBoundToKey(t *testing.T) {
+	token, _, pub := newMailboxInvite(t)
+	_, otherPriv, _ := newMailboxInvite(t)
+
+	reply, err := SealReply(token, pub, &MailboxReply{PeerID: generateTestPeerID(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenReply(token, otherPriv, reply); !errors.Is(err, ErrMailboxSeal) {
+		t.Errorf("OpenReply(other key) error = %v, want ErrMailboxSeal", err)
+	}
+
+	reply[len(reply)-1] ^= 0x01
+	if _, err := OpenReply(token, otherPriv, reply); !errors.Is(err, ErrMailboxSeal) {
+		t.Errorf("OpenReply(tampered) error = %v, want ErrMailboxSeal", err)
+	}
+}
+
+func TestMailboxIDDependsOnToken(t *testing.T) {
+	a, _, _ := newMailboxInvite(t)
+	b, _, _ := newMailboxInvite(t)
+	if MailboxID(a) == MailboxID(b) {
+		t.Error("different tokens share a mailbox ID")
+	}
+	if MailboxID(a) != MailboxID(a) {
+		t.Error("mailbox ID is not deterministic")
+	}
+}
+
+func TestSealIntroRejectsBadInput(t *testing.T) {
+	token, _, pub := newMailboxInvite(t)
+	p := generateTestPeerID(t)
+
+	if _, err := SealIntro(token, &MailboxIntro{PeerID: p, PublicKey: pub[:16]}); err == nil {
+		t.Error("accepted a short public key")
+	}
+	if _, err := SealIntro(token[:8], &MailboxIntro{PeerID: p, PublicKey: pub}); err == nil {
+		t.Error("accepted an 8-byte token")
+	}
+	long := make([]byte, maxMailboxNameLen+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if _, err := SealIntro(token, &MailboxIntro{PeerID: p, Name: string(long), PublicKey: pub}); err == nil {
+		t.Error("accepted an oversized name")
+	}
+}
+
+func TestPendingStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), PendingFileName)
+	store, err := OpenPendingStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, priv, _ := newMailboxInvite(t)
+	now := time.Now()
+	if err := store.Add(PendingInvite{Token: token, PrivateKey: priv, Name: "home", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	// Expired, but a reply may still be waiting at a relay.
+	late, _, _ := newMailboxInvite(t)
+	store.Add(PendingInvite{Token: late, PrivateKey: priv, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)})
+	// Past the reply window.
+	gone, _, _ := newMailboxInvite(t)
+	store.Add(PendingInvite{Token: gone, PrivateKey: priv, CreatedAt: now.Add(-9 * 24 * time.Hour), ExpiresAt: now.Add(-8 * 24 * time.Hour)})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("pending invites mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	reloaded, err := OpenPendingStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := MailboxID(token)
+	p, ok := reloaded.Get(hex.EncodeToString(id[:]))
+	if !ok || p.Name != "home" || string(p.Token) != string(token) || string(p.PrivateKey) != string(priv) {
+		t.Errorf("Get() = %+v, %v", p, ok)
+	}
+	lateID := MailboxID(late)
+	if _, ok := reloaded.Get(hex.EncodeToString(lateID[:])); !ok {
+		t.Error("expired invite dropped within its reply window")
+	}
+	goneID := MailboxID(gone)
+	if _, ok := reloaded.Get(hex.EncodeToString(goneID[:])); ok {
+		t.Error("invite kept past its reply window")
+	}
+	if list := reloaded.List(); len(list) != 1 || list[0].ID != p.ID {
+		t.Errorf("List() = %+v, want only the unexpired invite", list)
+	}
+
+	removed, err := reloaded.Remove(p.ID)
+	if err != nil || !removed {
+		t.Fatalf("Remove() = %v, %v", removed, err)
+	}
+	if removed, _ := reloaded.Remove(p.ID); removed {
+		t.Error("Remove() of a removed invite reported true")
+	}
+}
@@ -40,6 +40,11 @@ const (
 
 	// VersionV2 identifies the relay pairing protocol (relay-mediated).
 	VersionV2 byte = 0x02
+
+	// VersionV3 identifies relay pairing codes that carry several relay
+	// multiaddrs, an optional expiry and a checksum. The pairing protocol
+	// itself is the same as VersionV2.
+	VersionV3 byte = 0x03
 )
 
 // PAKESession holds the state for one side of a PAKE handshake.
@@ -0,0 +1,188 @@
+package invite
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PendingFileName is the inviter's asynchronous invite state, kept next to
+// the node config. It holds tokens and private keys, so it is written 0600.
+const PendingFileName = "pending_invites.json"
+
+// pendingFileVersion is bumped when the on-disk format changes incompatibly.
+const pendingFileVersion = 1
+
+// MailboxReplyTTL is how long a relay keeps a redeemed invite's reply for
+// the inviter. Pending invites are kept that long past their expiry, since
+// a code redeemed just before it expired may still be waiting at a relay.
+const MailboxReplyTTL = 7 * 24 * time.Hour
+
+// PendingInvite is an asynchronous invite waiting for its joiner.
+type PendingInvite struct {
+	ID         string    `json:"id"`          // hex mailbox ID
+	Token      []byte    `json:"token"`       // 16-byte invite token
+	PrivateKey []byte    `json:"private_key"` // X25519 key the reply is sealed to
+	Name       string    `json:"name,omitempty"`
+	Relays     []string  `json:"relays"` // relay multiaddrs holding the introduction
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// pendingFile is the on-disk representation of a PendingStore.
+type pendingFile struct {
+	Version int              `json:"version"`
+	Invites []*PendingInvite `json:"invites"`
+}
+
+// PendingStore persists the inviter's side of asynchronous invites until
+// the joiner's reply arrives or the invite expires. Every change rewrites
+// the file atomically (temp file + rename).
+type PendingStore struct {
+	path    string
+	mu      sync.Mutex
+	invites map[string]*PendingInvite
+}
+
+// OpenPendingStore loads the store at path, dropping invites past their
+// reply window. A missing file yields an empty store; the file is created
+// on first change.
+func OpenPendingStore(path string) (*PendingStore, error) {
+	s := &PendingStore{path: path, invites: make(map[string]*PendingInvite)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read pending invites: %w", err)
+	}
+	var file pendingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse pending invites %s: %w", path, err)
+	}
+	if file.Version != pendingFileVersion {
+		return nil, fmt.Errorf("unsupported pending invites version %d in %s", file.Version, path)
+	}
+	now := time.Now()
+	for _, p := range file.Invites {
+		if p.retained(now) {
+			s.invites[p.ID] = p
+		}
+	}
+	if len(s.invites) != len(file.Invites) {
+		if err := s.saveLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add stores a new pending invite. Its ID is derived from the token.
+func (s *PendingStore) Add(p PendingInvite) error {
+	id := MailboxID(p.Token)
+	p.ID = hex.EncodeToString(id[:])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invites[p.ID] = &p
+	if err := s.saveLocked(); err != nil {
+		delete(s.invites, p.ID)
+		return err
+	}
+	return nil
+}
+
+// Get returns the pending invite with the given ID. Expired invites are
+// still returned within their reply window, so a late reply is accepted.
+func (s *PendingStore) Get(id string) (PendingInvite, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.invites[id]
+	if !ok || !p.retained(time.Now()) {
+		return PendingInvite{}, false
+	}
+	return *p, true
+}
+
+// Remove deletes a pending invite. Reports whether it existed.
+func (s *PendingStore) Remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.invites[id]; !ok {
+		return false, nil
+	}
+	delete(s.invites, id)
+	return true, s.saveLocked()
+}
+
+// List returns the unexpired pending invites, oldest first, and drops
+// invites past their reply window from disk.
+func (s *PendingStore) List() []PendingInvite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var out []PendingInvite
+	pruned := false
+	for id, p := range s.invites {
+		if !p.retained(now) {
+			delete(s.invites, id)
+			pruned = true
+			continue
+		}
+		if now.Before(p.ExpiresAt) {
+			out = append(out, *p)
+		}
+	}
+	if pruned {
+		s.saveLocked() // best effort: such entries are ignored on load anyway
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// retained reports whether an invite is still within its reply window.
+func (p *PendingInvite) retained(now time.Time) bool {
+	return now.Before(p.ExpiresAt.Add(MailboxReplyTTL))
+}
+
+func (s *PendingStore) saveLocked() error {
+	file := pendingFile{Version: pendingFileVersion, Invites: []*PendingInvite{}}
+	for _, p := range s.invites {
+		file.Invites = append(file.Invites, p)
+	}
+	sort.Slice(file.Invites, func(i, j int) bool { return file.Invites[i].ID < file.Invites[j].ID })
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode pending invites: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".pending_invites.*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op after a successful rename
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to update pending invites: %w", err)
+	}
+	return nil
+}
@@ -6,15 +6,19 @@ import (
 	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
+	ma "github.com/multiformats/go-multiaddr"
+
 	"github.com/satindergrewal/peer-up/internal/invite"
 )
 
@@ -30,6 +34,7 @@ type PairRequest struct {
 	TTLSeconds int `json:"ttl_seconds"`
 	Namespace  string `json:"namespace,omitempty"`
 	ExpiresSeconds int `json:"expires_seconds,omitempty"`
+	LegacyCode bool `json:"legacy_code,omitempty"` // issue v2 codes for builds that cannot read v3
 }
 
 // PairResponse is the JSON response for POST /v1/pair.
@@ -37,36 +42,67 @@ type PairResponse struct {
 	GroupID   string   `json:"group_id"`
 	Codes    []string `json:"codes"`
 	ExpiresAt string  `json:"expires_at"`
+	Relays    []string `json:"relays,omitempty"` // federated relays that also accept the codes
+}
+
+// BanRequest is the JSON body for POST /v1/bans.
+type BanRequest struct {
+	Target          string `json:"target"`           // peer ID, IP address, or CIDR range
+	DurationSeconds int    `json:"duration_seconds"` // default: 3600
+	Reason          string `json:"reason,omitempty"`
 }
 
 // AdminServer provides a Unix socket HTTP API for the relay admin CLI.
 // It runs inside the relay serve process and allows relay pair to create
 // pairing groups, list them, and revoke them without direct access to
-// the in-memory token store.
+// the relay's token store. With a CircuitMonitor attached it also lists
+// reservations and circuits, closes circuits, and manages temporary bans.
+// With a UsageTracker attached it reports per-peer relay usage.
+// Federated relays are listed alongside new pairing codes.
 type AdminServer struct {
-	store      *TokenStore
+	store      TokenStore
 	gater      AdminGaterInterface
-	relayAddr  string
+	relayAddrs []string // this relay's addresses for pairing codes
 	namespace  string
 	httpServer *http.Server
 	listener   net.Listener
 	socketPath string
 	cookiePath string
 	authToken  string
+	circuits   *CircuitMonitor // nil = circuit endpoints unavailable
+	usage      *UsageTracker   // nil = usage endpoint unavailable
+	federated  []string        // multiaddrs of federated relays
 }
 
 // NewAdminServer creates a new relay admin server.
-func NewAdminServer(store *TokenStore, gater AdminGaterInterface, relayAddr, namespace, socketPath, cookiePath string) *AdminServer {
+func NewAdminServer(store TokenStore, gater AdminGaterInterface, relayAddrs []string, namespace, socketPath, cookiePath string) *AdminServer {
 	return &AdminServer{
 		store:      store,
 		gater:      gater,
-		relayAddr:  relayAddr,
+		relayAddrs: relayAddrs,
 		namespace:  namespace,
 		socketPath: socketPath,
 		cookiePath: cookiePath,
 	}
 }
 
+// SetCircuitMonitor attaches the relay's circuit monitor. Call before Start.
+func (s *AdminServer) SetCircuitMonitor(m *CircuitMonitor) {
+	s.circuits = m
+}
+
+// SetUsageTracker attaches the relay's per-peer usage tracker. Call before Start.
+func (s *AdminServer) SetUsageTracker(u *UsageTracker) {
+	s.usage = u
+}
+
+// SetFederatedRelays lists the other relays that accept this relay's
+// pairing codes. Those the code format can carry are added to new codes.
+// Call before Start.
+func (s *AdminServer) SetFederatedRelays(addrs []string) {
+	s.federated = addrs
+}
+
 // Start creates the Unix socket, writes the cookie file, and starts serving.
 func (s *AdminServer) Start() error {
 	token, err := generateAdminCookie()
@@ -100,6 +136,13 @@ func (s *AdminServer) Start() error {
 	mux.HandleFunc("POST /v1/pair", s.handleCreatePair)
 	mux.HandleFunc("GET /v1/pair", s.handleListPairs)
 	mux.HandleFunc("DELETE /v1/pair/{id}", s.handleRevokePair)
+	mux.HandleFunc("GET /v1/reservations", s.handleListReservations)
+	mux.HandleFunc("GET /v1/circuits", s.handleListCircuits)
+	mux.HandleFunc("DELETE /v1/circuits/{id}", s.handleCloseCircuit)
+	mux.HandleFunc("GET /v1/bans", s.handleListBans)
+	mux.HandleFunc("POST /v1/bans", s.handleBan)
+	mux.HandleFunc("DELETE /v1/bans/{target...}", s.handleUnban)
+	mux.HandleFunc("GET /v1/usage", s.handleUsage)
 
 	s.httpServer = &http.Server{
 		Handler:      s.authMiddleware(mux),
@@ -189,6 +232,16 @@ func (s *AdminServer) handleCreatePair(w http.ResponseWriter, r *http.Request) {
 		peerTTL = time.Duration(req.ExpiresSeconds) * time.Second
 	}
 
+	codeAddrs := s.codeRelayAddrs()
+	if req.LegacyCode {
+		i := slices.IndexFunc(codeAddrs, isPlainTCP4)
+		if i < 0 {
+			respondAdminError(w, http.StatusBadRequest, "legacy codes need an IPv4 TCP relay address")
+			return
+		}
+		codeAddrs = codeAddrs[i : i+1]
+	}
+
 	tokens, groupID, err := s.store.CreateGroup(req.Count, ttl, ns, peerTTL)
 	if err != nil {
 		respondAdminError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create group: %v", err))
@@ -200,10 +253,12 @@ func (s *AdminServer) handleCreatePair(w http.ResponseWriter, r *http.Request) {
 		s.gater.SetEnrollmentMode(true, 10, 15*time.Second)
 	}
 
-	// Encode tokens into v2 invite codes.
+	// Encode tokens into invite codes carrying this relay's addresses and
+	// the federated relays.
+	expiresAt := time.Now().Add(ttl)
 	codes := make([]string, len(tokens))
 	for i, tok := range tokens {
-		code, err := invite.EncodeV2(tok, s.relayAddr, ns)
+		code, err := encodePairCode(tok, codeAddrs, ns, expiresAt, req.LegacyCode)
 		if err != nil {
 			respondAdminError(w, http.StatusInternalServerError, fmt.Sprintf("failed to encode code: %v", err))
 			return
@@ -211,18 +266,53 @@ func (s *AdminServer) handleCreatePair(w http.ResponseWriter, r *http.Request) {
 		codes[i] = code
 	}
 
-	expiresAt := time.Now().Add(ttl)
-
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(PairResponse{
 		GroupID:   groupID,
 		Codes:    codes,
 		ExpiresAt: expiresAt.Format(time.RFC3339),
+		Relays:    s.federated,
 	})
 
 	slog.Info("pairing group created via admin", "group", groupID, "count", req.Count, "ttl", ttl)
 }
 
+// encodePairCode issues a v3 code, which carries every relay and the
+// expiry. legacy asks for a v2 code instead, for peerup builds without v3
+// support; it carries only relayAddrs[0], which must be IPv4 TCP.
+func encodePairCode(token []byte, relayAddrs []string, ns string, expires time.Time, legacy bool) (string, error) {
+	if legacy {
+		return invite.EncodeV2(token, relayAddrs[0], ns)
+	}
+	return invite.EncodeV3(token, relayAddrs, ns, expires)
+}
+
+// isPlainTCP4 reports whether addr is exactly /ip4/.../tcp/.../p2p/..., the
+// only shape v2 can carry without dropping part of the address.
+func isPlainTCP4(addr string) bool {
+	maddr, err := ma.NewMultiaddr(addr)
+	if err != nil {
+		return false
+	}
+	protos := maddr.Protocols()
+	return len(protos) == 3 &&
+		protos[0].Code == ma.P_IP4 && protos[1].Code == ma.P_TCP && protos[2].Code == ma.P_P2P
+}
+
+// codeRelayAddrs returns the relay addresses for pairing codes: this
+// relay's own, then each federated relay the code format can carry.
+func (s *AdminServer) codeRelayAddrs() []string {
+	addrs := slices.Clone(s.relayAddrs)
+	for _, a := range s.federated {
+		if err := invite.ValidateV3RelayAddr(a); err != nil {
+			slog.Debug("federated relay left out of pairing codes", "addr", a, "err", err)
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs
+}
+
 func (s *AdminServer) handleListPairs(w http.ResponseWriter, r *http.Request) {
 	groups := s.store.List()
 
@@ -292,6 +382,101 @@ func (s *AdminServer) handleRevokePair(w http.ResponseWriter, r *http.Request) {
 	slog.Info("pairing group revoked via admin", "group", groupID)
 }
 
+// requireCircuits reports whether a circuit monitor is attached, writing a
+// 503 if not.
+func (s *AdminServer) requireCircuits(w http.ResponseWriter) bool {
+	if s.circuits == nil {
+		respondAdminError(w, http.StatusServiceUnavailable, "circuit monitoring not available")
+		return false
+	}
+	return true
+}
+
+func (s *AdminServer) handleListReservations(w http.ResponseWriter, r *http.Request) {
+	if !s.requireCircuits(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.circuits.Reservations())
+}
+
+func (s *AdminServer) handleListCircuits(w http.ResponseWriter, r *http.Request) {
+	if !s.requireCircuits(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.circuits.Circuits())
+}
+
+func (s *AdminServer) handleCloseCircuit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireCircuits(w) {
+		return
+	}
+	if err := s.circuits.CloseCircuit(r.PathValue("id")); err != nil {
+		respondAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "closed"})
+}
+
+func (s *AdminServer) handleListBans(w http.ResponseWriter, r *http.Request) {
+	if !s.requireCircuits(w) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.circuits.Bans())
+}
+
+func (s *AdminServer) handleBan(w http.ResponseWriter, r *http.Request) {
+	if !s.requireCircuits(w) {
+		return
+	}
+	var req BanRequest
+	r.Body = http.MaxBytesReader(w, r.Body, 4096)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondAdminError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.DurationSeconds < 1 {
+		req.DurationSeconds = 3600 // 1 hour default
+	}
+
+	ban, err := s.circuits.Ban(req.Target, time.Duration(req.DurationSeconds)*time.Second, req.Reason)
+	if err != nil {
+		respondAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ban)
+}
+
+func (s *AdminServer) handleUnban(w http.ResponseWriter, r *http.Request) {
+	if !s.requireCircuits(w) {
+		return
+	}
+	err := s.circuits.Unban(r.PathValue("target"))
+	switch {
+	case errors.Is(err, ErrInvalidBanTarget):
+		respondAdminError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		respondAdminError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "unbanned"})
+}
+
+func (s *AdminServer) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if s.usage == nil {
+		respondAdminError(w, http.StatusServiceUnavailable, "usage accounting not available")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.usage.Usage())
+}
+
 func respondAdminError(w http.ResponseWriter, status int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -67,12 +68,14 @@ func (c *AdminClient) do(method, path string, body io.Reader) ([]byte, int, erro
 }
 
 // CreateGroup creates a pairing group and returns the invite codes.
-func (c *AdminClient) CreateGroup(count, ttlSec, expiresSec int, namespace string) (*PairResponse, error) {
+// legacy asks for v2 codes (see PairRequest.LegacyCode).
+func (c *AdminClient) CreateGroup(count, ttlSec, expiresSec int, namespace string, legacy bool) (*PairResponse, error) {
 	reqBody, _ := json.Marshal(PairRequest{
 		Count:          count,
 		TTLSeconds:     ttlSec,
 		Namespace:      namespace,
 		ExpiresSeconds: expiresSec,
+		LegacyCode:     legacy,
 	})
 
 	data, status, err := c.do("POST", "/v1/pair", strings.NewReader(string(reqBody)))
@@ -165,6 +168,112 @@ func (c *AdminClient) RevokeGroup(id string) error {
 	return nil
 }
 
+// Reservations returns the peers holding a slot on the relay.
+func (c *AdminClient) Reservations() ([]ReservationInfo, error) {
+	var result []ReservationInfo
+	if err := c.getJSON("/v1/reservations", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Circuits returns the connections the relay is forwarding.
+func (c *AdminClient) Circuits() ([]CircuitInfo, error) {
+	var result []CircuitInfo
+	if err := c.getJSON("/v1/circuits", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Usage returns the cumulative relay usage of each peer.
+func (c *AdminClient) Usage() ([]PeerUsage, error) {
+	var result []PeerUsage
+	if err := c.getJSON("/v1/usage", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// CloseCircuit forcibly closes a circuit by ID.
+func (c *AdminClient) CloseCircuit(id string) error {
+	data, status, err := c.do("DELETE", "/v1/circuits/"+url.PathEscape(id), nil)
+	if err != nil {
+		return err
+	}
+	return adminError(data, status)
+}
+
+// Bans returns the active bans.
+func (c *AdminClient) Bans() ([]BanInfo, error) {
+	var result []BanInfo
+	if err := c.getJSON("/v1/bans", &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Ban refuses relay service to a peer ID, IP address, or CIDR range for d.
+func (c *AdminClient) Ban(target string, d time.Duration, reason string) (*BanInfo, error) {
+	reqBody, _ := json.Marshal(BanRequest{
+		Target:          target,
+		DurationSeconds: int(d.Seconds()),
+		Reason:          reason,
+	})
+
+	data, status, err := c.do("POST", "/v1/bans", strings.NewReader(string(reqBody)))
+	if err != nil {
+		return nil, err
+	}
+	if err := adminError(data, status); err != nil {
+		return nil, err
+	}
+
+	var ban BanInfo
+	if err := json.Unmarshal(data, &ban); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &ban, nil
+}
+
+// Unban lifts a ban.
+func (c *AdminClient) Unban(target string) error {
+	data, status, err := c.do("DELETE", "/v1/bans/"+target, nil)
+	if err != nil {
+		return err
+	}
+	return adminError(data, status)
+}
+
+// getJSON fetches path and decodes the response into v.
+func (c *AdminClient) getJSON(path string, v any) error {
+	data, status, err := c.do("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if err := adminError(data, status); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// adminError converts an error response into an error, or returns nil.
+func adminError(data []byte, status int) error {
+	if status < 400 {
+		return nil
+	}
+	var errResp map[string]string
+	if json.Unmarshal(data, &errResp) == nil {
+		if msg, ok := errResp["error"]; ok {
+			return fmt.Errorf("relay: %s", msg)
+		}
+	}
+	return fmt.Errorf("relay returned HTTP %d", status)
+}
+
 // parseTimeStr parses common time formats.
 func parseTimeStr(s string) (time.Time, error) {
 	// Try RFC3339 first, then other common formats.
@@ -11,6 +11,10 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/libp2p/go-libp2p"
+
+	"github.com/satindergrewal/peer-up/internal/invite"
 )
 
 // mockGater implements AdminGaterInterface for testing.
@@ -57,7 +61,7 @@ func TestAdminServerStartStop(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -90,7 +94,7 @@ func TestAdminServerStaleSocket(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start should succeed with stale socket: %v", err)
 	}
@@ -102,7 +106,7 @@ func TestAdminServerAuthRequired(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -129,7 +133,7 @@ func TestAdminClientCreateGroup(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -140,7 +144,7 @@ func TestAdminClientCreateGroup(t *testing.T) {
 		t.Fatalf("NewAdminClient: %v", err)
 	}
 
-	resp, err := client.CreateGroup(2, 600, 0, "")
+	resp, err := client.CreateGroup(2, 600, 0, "", false)
 	if err != nil {
 		t.Fatalf("CreateGroup: %v", err)
 	}
@@ -163,12 +167,107 @@ func TestAdminClientCreateGroup(t *testing.T) {
 	}
 }
 
+func TestAdminCreateGroupCodeRelays(t *testing.T) {
+	sock, cookie := tempPaths(t)
+	srv := NewAdminServer(NewTokenStore(), &mockGater{}, []string{testRelayAddr}, "", sock, cookie)
+	federated := "/ip6/2001:db8::7/udp/7777/quic-v1/p2p/12D3KooWRzaGMTqQbRHNMZkAYj8ALUXoK99qSjhiFLanDoVWK9An"
+	srv.SetFederatedRelays([]string{federated, "/dns4/relay.example.com/tcp/7777/p2p/12D3KooWRzaGMTqQbRHNMZkAYj8ALUXoK99qSjhiFLanDoVWK9An"})
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer srv.Stop()
+
+	client, err := NewAdminClient(sock, cookie)
+	if err != nil {
+		t.Fatalf("NewAdminClient: %v", err)
+	}
+	resp, err := client.CreateGroup(1, 600, 0, "", false)
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+
+	data, err := invite.Decode(resp.Codes[0])
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if data.Version != invite.VersionV3 {
+		t.Errorf("code version = %d, want %d", data.Version, invite.VersionV3)
+	}
+	// The DNS relay cannot be carried and is left out.
+	if strings.Join(data.RelayAddrs, " ") != testRelayAddr+" "+federated {
+		t.Errorf("code relays = %v", data.RelayAddrs)
+	}
+	if until := time.Until(data.Expires); until < 590*time.Second || until > 600*time.Second {
+		t.Errorf("code expiry = %v, want about 10 minutes from now", data.Expires)
+	}
+}
+
+func TestAdminCreateGroupLegacyCode(t *testing.T) {
+	sock, cookie := tempPaths(t)
+	srv := NewAdminServer(NewTokenStore(), &mockGater{}, []string{testRelayAddr}, "", sock, cookie)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer srv.Stop()
+
+	client, err := NewAdminClient(sock, cookie)
+	if err != nil {
+		t.Fatalf("NewAdminClient: %v", err)
+	}
+
+	// v3 is the default even when a single IPv4 TCP relay would fit v2.
+	resp, err := client.CreateGroup(1, 600, 0, "", false)
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	if data, err := invite.Decode(resp.Codes[0]); err != nil || data.Version != invite.VersionV3 {
+		t.Errorf("default code = %+v, %v; want v3", data, err)
+	}
+
+	// legacy_code asks for v2, which older builds can decode.
+	resp, err = client.CreateGroup(1, 600, 0, "", true)
+	if err != nil {
+		t.Fatalf("CreateGroup legacy: %v", err)
+	}
+	data, err := invite.Decode(resp.Codes[0])
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if data.Version != invite.VersionV2 {
+		t.Errorf("legacy code version = %d, want %d", data.Version, invite.VersionV2)
+	}
+
+	for _, addr := range []string{
+		"/ip4/203.0.113.50/tcp/443/ws/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN",
+		"/ip4/203.0.113.50/udp/7777/quic-v1/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN",
+	} {
+		if isPlainTCP4(addr) {
+			t.Errorf("isPlainTCP4(%s) = true", addr)
+		}
+	}
+
+	// A relay without an IPv4 TCP address cannot issue legacy codes.
+	sock2, cookie2 := tempPaths(t)
+	quicOnly := NewAdminServer(NewTokenStore(), &mockGater{}, []string{"/ip4/203.0.113.50/udp/7777/quic-v1/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"}, "", sock2, cookie2)
+	if err := quicOnly.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer quicOnly.Stop()
+	client2, err := NewAdminClient(sock2, cookie2)
+	if err != nil {
+		t.Fatalf("NewAdminClient: %v", err)
+	}
+	if _, err := client2.CreateGroup(1, 600, 0, "", true); err == nil {
+		t.Error("legacy code issued without an IPv4 TCP relay")
+	}
+}
+
 func TestAdminClientCreateGroupEnrollment(t *testing.T) {
 	sock, cookie := tempPaths(t)
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -184,7 +283,7 @@ func TestAdminClientCreateGroupEnrollment(t *testing.T) {
 		t.Error("enrollment should be disabled initially")
 	}
 
-	_, err = client.CreateGroup(1, 600, 0, "")
+	_, err = client.CreateGroup(1, 600, 0, "", false)
 	if err != nil {
 		t.Fatalf("CreateGroup: %v", err)
 	}
@@ -200,7 +299,7 @@ func TestAdminClientListGroups(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -221,7 +320,7 @@ func TestAdminClientListGroups(t *testing.T) {
 	}
 
 	// Create one.
-	_, err = client.CreateGroup(1, 600, 0, "")
+	_, err = client.CreateGroup(1, 600, 0, "", false)
 	if err != nil {
 		t.Fatalf("CreateGroup: %v", err)
 	}
@@ -243,7 +342,7 @@ func TestAdminClientRevokeGroup(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -254,7 +353,7 @@ func TestAdminClientRevokeGroup(t *testing.T) {
 		t.Fatalf("NewAdminClient: %v", err)
 	}
 
-	resp, err := client.CreateGroup(1, 600, 0, "")
+	resp, err := client.CreateGroup(1, 600, 0, "", false)
 	if err != nil {
 		t.Fatalf("CreateGroup: %v", err)
 	}
@@ -289,7 +388,7 @@ func TestAdminClientRevokeNonexistent(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -324,7 +423,7 @@ func TestAdminClientMultipleGroupsEnrollment(t *testing.T) {
 	store := NewTokenStore()
 	gater := &mockGater{}
 
-	srv := NewAdminServer(store, gater, testRelayAddr, "", sock, cookie)
+	srv := NewAdminServer(store, gater, []string{testRelayAddr}, "", sock, cookie)
 	if err := srv.Start(); err != nil {
 		t.Fatalf("Start: %v", err)
 	}
@@ -336,8 +435,8 @@ func TestAdminClientMultipleGroupsEnrollment(t *testing.T) {
 	}
 
 	// Create two groups.
-	resp1, _ := client.CreateGroup(1, 600, 0, "")
-	_, _ = client.CreateGroup(1, 600, 0, "")
+	resp1, _ := client.CreateGroup(1, 600, 0, "", false)
+	_, _ = client.CreateGroup(1, 600, 0, "", false)
 
 	if !gater.IsEnrollmentEnabled() {
 		t.Error("enrollment should be enabled with active groups")
@@ -350,6 +449,76 @@ func TestAdminClientMultipleGroupsEnrollment(t *testing.T) {
 	}
 }
 
+func TestAdminClientCircuitsAndBans(t *testing.T) {
+	sock, cookie := tempPaths(t)
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	srv := NewAdminServer(NewTokenStore(), &mockGater{}, []string{testRelayAddr}, "", sock, cookie)
+	srv.SetCircuitMonitor(NewCircuitMonitor(h, 64<<20))
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer srv.Stop()
+
+	client, err := NewAdminClient(sock, cookie)
+	if err != nil {
+		t.Fatalf("NewAdminClient: %v", err)
+	}
+
+	if circuits, err := client.Circuits(); err != nil || len(circuits) != 0 {
+		t.Errorf("Circuits() = %v, %v; want empty", circuits, err)
+	}
+	if rsvps, err := client.Reservations(); err != nil || len(rsvps) != 0 {
+		t.Errorf("Reservations() = %v, %v; want empty", rsvps, err)
+	}
+	if err := client.CloseCircuit("nonexistent"); err == nil || !strings.Contains(err.Error(), "circuit not found") {
+		t.Errorf("CloseCircuit(nonexistent) error = %v", err)
+	}
+
+	ban, err := client.Ban("203.0.113.0/24", time.Hour, "bandwidth spike")
+	if err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if ban.Target != "203.0.113.0/24" || time.Until(ban.Expires) < 59*time.Minute {
+		t.Errorf("ban = %+v", ban)
+	}
+	if _, err := client.Ban("not-a-target", time.Hour, ""); err == nil {
+		t.Error("banning an invalid target should fail")
+	}
+	bans, err := client.Bans()
+	if err != nil || len(bans) != 1 || bans[0].Reason != "bandwidth spike" {
+		t.Errorf("Bans() = %+v, %v", bans, err)
+	}
+
+	if err := client.Unban("203.0.113.0/24"); err != nil {
+		t.Errorf("Unban: %v", err)
+	}
+	if err := client.Unban("203.0.113.0/24"); err == nil {
+		t.Error("unbanning twice should fail")
+	}
+}
+
+func TestAdminCircuitsUnavailable(t *testing.T) {
+	sock, cookie := tempPaths(t)
+	srv := NewAdminServer(NewTokenStore(), &mockGater{}, []string{testRelayAddr}, "", sock, cookie)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer srv.Stop()
+
+	client, err := NewAdminClient(sock, cookie)
+	if err != nil {
+		t.Fatalf("NewAdminClient: %v", err)
+	}
+	if _, err := client.Circuits(); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("Circuits() without a monitor error = %v", err)
+	}
+}
+
 // unixTransport returns an http.Transport that dials the given Unix socket.
 func unixTransport(socketPath string) *http.Transport {
 	return &http.Transport{
@@ -0,0 +1,621 @@
+package relay
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	asnutil "github.com/libp2p/go-libp2p-asn-util"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
+	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrCircuitNotFound  = errors.New("circuit not found")
+	ErrBanNotFound      = errors.New("ban not found")
+	ErrInvalidBanTarget = errors.New("ban target must be a peer ID, IP address, or CIDR range")
+)
+
+// maxHandshakeSize bounds the relay handshake messages the monitor decodes.
+// It matches the limit the relay itself enforces.
+const maxHandshakeSize = 4096
+
+// ReservationInfo describes a peer holding a slot on the relay.
+type ReservationInfo struct {
+	PeerID   string    `json:"peer_id"`
+	RemoteIP string    `json:"remote_ip,omitempty"`
+	ASN      uint32    `json:"asn,omitempty"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+}
+
+// CircuitInfo describes a connection the relay is forwarding between two
+// peers. Byte counts are per direction, like session_data_limit.
+type CircuitInfo struct {
+	ID         string    `json:"id"`
+	Src        string    `json:"src"`
+	SrcIP      string    `json:"src_ip,omitempty"`
+	SrcASN     uint32    `json:"src_asn,omitempty"`
+	Dst        string    `json:"dst"`
+	DstIP      string    `json:"dst_ip,omitempty"`
+	DstASN     uint32    `json:"dst_asn,omitempty"`
+	Started    time.Time `json:"started"`
+	BytesToDst int64     `json:"bytes_to_dst"`
+	BytesToSrc int64     `json:"bytes_to_src"`
+	DataLimit  int64     `json:"data_limit"` // per direction, 0 = unlimited
+}
+
+// BanInfo describes a temporary ban on a peer or IP range.
+type BanInfo struct {
+	Target  string    `json:"target"`
+	Reason  string    `json:"reason,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// CircuitMonitor tracks the reservations and circuits of a circuit relay v2
+// service and enforces temporary bans. The relay must be built on Host()
+// with the monitor as its ACL:
+//
+//	m := relay.NewCircuitMonitor(h, limit.Data)
+//	relayv2.New(m.Host(), relayv2.WithACL(m), ...)
+//
+// The relay exposes no per-circuit hooks, so the monitor reads the relay's
+// own handshake messages: the HOP response that grants a reservation and the
+// STOP request that names a circuit's source. Bans live in memory and end
+// when they expire or the relay restarts; authorized_keys is never touched.
+type CircuitMonitor struct {
+	host      host.Host
+	dataLimit int64
+
+	mu           sync.Mutex
+	reservations map[peer.ID]*reservation
+	circuits     map[string]*circuit
+	bans         map[string]*ban
+	usage        *UsageTracker // nil = no per-peer accounting
+}
+
+type reservation struct {
+	addr    ma.Multiaddr
+	created time.Time
+	expires time.Time
+}
+
+type circuit struct {
+	id       string
+	src, dst peer.ID
+	srcAddr  ma.Multiaddr
+	dstAddr  ma.Multiaddr
+	started  time.Time
+	stream   network.Stream // relay -> dst STOP stream
+	toDst    atomic.Int64
+	toSrc    atomic.Int64
+	usage    *circuitUsage // nil without a usage tracker
+}
+
+type ban struct {
+	peer    peer.ID      // set for peer bans
+	prefix  netip.Prefix // set for IP range bans
+	reason  string
+	expires time.Time
+}
+
+// NewCircuitMonitor creates a monitor for a relay running on h. dataLimit is
+// the relay's per-direction session data limit, reported alongside byte
+// counts (0 = unlimited).
+func NewCircuitMonitor(h host.Host, dataLimit int64) *CircuitMonitor {
+	m := &CircuitMonitor{
+		host:         h,
+		dataLimit:    dataLimit,
+		reservations: make(map[peer.ID]*reservation),
+		circuits:     make(map[string]*circuit),
+		bans:         make(map[string]*ban),
+	}
+	// The relay drops a reservation when its holder disconnects; so do we.
+	h.Network().Notify(&network.NotifyBundle{
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			if n.Connectedness(c.RemotePeer()) == network.Connected {
+				return
+			}
+			m.mu.Lock()
+			delete(m.reservations, c.RemotePeer())
+			m.mu.Unlock()
+		},
+	})
+	return m
+}
+
+// SetUsage makes the monitor account relayed traffic per peer and enforce
+// the tracker's quotas and bandwidth shares on new circuits.
+func (m *CircuitMonitor) SetUsage(u *UsageTracker) {
+	m.mu.Lock()
+	m.usage = u
+	m.mu.Unlock()
+}
+
+// Host returns h wrapped so the relay's HOP and STOP streams pass through
+// the monitor. Pass it to relayv2.New instead of the plain host.
+func (m *CircuitMonitor) Host() host.Host {
+	return &monitoredHost{Host: m.host, m: m}
+}
+
+// AllowReserve implements relayv2.ACLFilter. Banned peers and addresses
+// cannot reserve a slot.
+func (m *CircuitMonitor) AllowReserve(p peer.ID, a ma.Multiaddr) bool {
+	if target := m.bannedTarget(p, a); target != "" {
+		slog.Info("relay: reservation refused", "peer", p, "ban", target)
+		return false
+	}
+	return true
+}
+
+// AllowConnect implements relayv2.ACLFilter. A circuit is refused when
+// either end is banned or has used up its daily relay quota.
+func (m *CircuitMonitor) AllowConnect(src peer.ID, srcAddr ma.Multiaddr, dest peer.ID) bool {
+	if target := m.bannedTarget(src, srcAddr); target != "" {
+		slog.Info("relay: circuit refused", "src", src, "dst", dest, "ban", target)
+		return false
+	}
+	if target := m.bannedTarget(dest, m.remoteAddr(dest)); target != "" {
+		slog.Info("relay: circuit refused", "src", src, "dst", dest, "ban", target)
+		return false
+	}
+	if err := m.usageTracker().Admit(src, dest); err != nil {
+		slog.Info("relay: circuit refused", "src", src, "dst", dest, "err", err)
+		return false
+	}
+	return true
+}
+
+// Reservations returns the unexpired reservations, oldest first.
+func (m *CircuitMonitor) Reservations() []ReservationInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	result := make([]ReservationInfo, 0, len(m.reservations))
+	for p, r := range m.reservations {
+		if now.After(r.expires) {
+			delete(m.reservations, p)
+			continue
+		}
+		ip, asn := addrIPASN(r.addr)
+		result = append(result, ReservationInfo{
+			PeerID:   p.String(),
+			RemoteIP: ip,
+			ASN:      asn,
+			Created:  r.created,
+			Expires:  r.expires,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Created.Before(result[j].Created) })
+	return result
+}
+
+// Circuits returns the open circuits, oldest first.
+func (m *CircuitMonitor) Circuits() []CircuitInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]CircuitInfo, 0, len(m.circuits))
+	for _, c := range m.circuits {
+		srcIP, srcASN := addrIPASN(c.srcAddr)
+		dstIP, dstASN := addrIPASN(c.dstAddr)
+		result = append(result, CircuitInfo{
+			ID:         c.id,
+			Src:        c.src.String(),
+			SrcIP:      srcIP,
+			SrcASN:     srcASN,
+			Dst:        c.dst.String(),
+			DstIP:      dstIP,
+			DstASN:     dstASN,
+			Started:    c.started,
+			BytesToDst: c.toDst.Load(),
+			BytesToSrc: c.toSrc.Load(),
+			DataLimit:  m.dataLimit,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Started.Before(result[j].Started) })
+	return result
+}
+
+// CloseCircuit resets a circuit. The relay tears down both ends.
+func (m *CircuitMonitor) CloseCircuit(id string) error {
+	m.mu.Lock()
+	c, ok := m.circuits[id]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCircuitNotFound, id)
+	}
+	c.stream.Reset()
+	slog.Info("relay: circuit closed by admin", "id", id, "src", c.src, "dst", c.dst)
+	return nil
+}
+
+// Ban refuses reservations and circuits from target for d. target is a peer
+// ID, an IP address, or a CIDR range. Matching circuits are closed and
+// matching peers disconnected, which also drops their reservations.
+// Banning an existing target replaces its expiry and reason.
+func (m *CircuitMonitor) Ban(target string, d time.Duration, reason string) (*BanInfo, error) {
+	key, b, err := parseBanTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	b.reason = reason
+	b.expires = time.Now().Add(d)
+
+	m.mu.Lock()
+	m.bans[key] = b
+	var kick []network.Stream
+	for _, c := range m.circuits {
+		if b.matches(c.src, c.srcAddr) || b.matches(c.dst, c.dstAddr) {
+			kick = append(kick, c.stream)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, s := range kick {
+		s.Reset()
+	}
+	for _, p := range m.host.Network().Peers() {
+		for _, conn := range m.host.Network().ConnsToPeer(p) {
+			if b.matches(p, conn.RemoteMultiaddr()) {
+				m.host.Network().ClosePeer(p)
+				break
+			}
+		}
+	}
+
+	slog.Info("relay: ban added", "target", key, "expires", b.expires, "reason", reason, "circuits_closed", len(kick))
+	return &BanInfo{Target: key, Reason: reason, Expires: b.expires}, nil
+}
+
+// Unban lifts a ban before it expires.
+func (m *CircuitMonitor) Unban(target string) error {
+	key, _, err := parseBanTarget(target)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.bans[key]; !ok {
+		return fmt.Errorf("%w: %s", ErrBanNotFound, key)
+	}
+	delete(m.bans, key)
+	slog.Info("relay: ban removed", "target", key)
+	return nil
+}
+
+// Bans returns the active bans, soonest to expire first.
+func (m *CircuitMonitor) Bans() []BanInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	result := make([]BanInfo, 0, len(m.bans))
+	for key, b := range m.bans {
+		if now.After(b.expires) {
+			delete(m.bans, key)
+			continue
+		}
+		result = append(result, BanInfo{Target: key, Reason: b.reason, Expires: b.expires})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Expires.Before(result[j].Expires) })
+	return result
+}
+
+// bannedTarget returns the ban matching p or a, or "" when there is none.
+func (m *CircuitMonitor) bannedTarget(p peer.ID, a ma.Multiaddr) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for key, b := range m.bans {
+		if now.After(b.expires) {
+			delete(m.bans, key)
+			continue
+		}
+		if b.matches(p, a) {
+			return key
+		}
+	}
+	return ""
+}
+
+func (m *CircuitMonitor) usageTracker() *UsageTracker {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
+
+// remoteAddr returns the address of one of our connections to p, or nil.
+func (m *CircuitMonitor) remoteAddr(p peer.ID) ma.Multiaddr {
+	for _, c := range m.host.Network().ConnsToPeer(p) {
+		return c.RemoteMultiaddr()
+	}
+	return nil
+}
+
+// hopResponse records the reservation granted by a HOP response.
+func (m *CircuitMonitor) hopResponse(s network.Stream, msg *pbv2.HopMessage) {
+	rsvp := msg.GetReservation()
+	if msg.GetStatus() != pbv2.Status_OK || rsvp == nil {
+		return
+	}
+	p := s.Conn().RemotePeer()
+	expires := time.Unix(int64(rsvp.GetExpire()), 0)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.reservations[p]; ok {
+		r.addr = s.Conn().RemoteMultiaddr()
+		r.expires = expires
+		return
+	}
+	m.reservations[p] = &reservation{
+		addr:    s.Conn().RemoteMultiaddr(),
+		created: time.Now(),
+		expires: expires,
+	}
+}
+
+// stopRequest registers the circuit announced by a STOP CONNECT request.
+func (m *CircuitMonitor) stopRequest(s network.Stream, msg *pbv2.StopMessage) *circuit {
+	if msg.GetType() != pbv2.StopMessage_CONNECT {
+		return nil
+	}
+	src, err := peer.IDFromBytes(msg.GetPeer().GetId())
+	if err != nil {
+		return nil
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil
+	}
+
+	c := &circuit{
+		id:      hex.EncodeToString(idBytes),
+		src:     src,
+		dst:     s.Conn().RemotePeer(),
+		srcAddr: m.remoteAddr(src),
+		dstAddr: s.Conn().RemoteMultiaddr(),
+		started: time.Now(),
+		stream:  s,
+	}
+	m.mu.Lock()
+	m.circuits[c.id] = c
+	c.usage = m.usage.startCircuit(c.src, c.dst)
+	m.mu.Unlock()
+	return c
+}
+
+func (m *CircuitMonitor) removeCircuit(id string) {
+	m.mu.Lock()
+	delete(m.circuits, id)
+	m.mu.Unlock()
+}
+
+// matches reports whether the ban covers peer p or address a.
+func (b *ban) matches(p peer.ID, a ma.Multiaddr) bool {
+	if b.peer != "" {
+		return b.peer == p
+	}
+	ip, ok := addrIP(a)
+	return ok && b.prefix.Contains(ip)
+}
+
+// parseBanTarget returns the canonical key and ban for a peer ID, IP
+// address, or CIDR range. A bare IP becomes a single-address range.
+func parseBanTarget(target string) (string, *ban, error) {
+	if p, err := peer.Decode(target); err == nil {
+		return p.String(), &ban{peer: p}, nil
+	}
+	if prefix, err := netip.ParsePrefix(target); err == nil {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+		return prefix.String(), &ban{prefix: prefix}, nil
+	}
+	if ip, err := netip.ParseAddr(target); err == nil {
+		ip = ip.Unmap()
+		prefix := netip.PrefixFrom(ip, ip.BitLen())
+		return prefix.String(), &ban{prefix: prefix}, nil
+	}
+	return "", nil, fmt.Errorf("%w: %q", ErrInvalidBanTarget, target)
+}
+
+// addrIP extracts the IP address of a multiaddr.
+func addrIP(a ma.Multiaddr) (netip.Addr, bool) {
+	if a == nil {
+		return netip.Addr{}, false
+	}
+	ip, err := manet.ToIP(a)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
+
+// addrIPASN returns the IP of a multiaddr and, for IPv6, its ASN from the
+// table libp2p uses for max_reservations_per_asn (0 when unknown).
+func addrIPASN(a ma.Multiaddr) (string, uint32) {
+	ip, ok := addrIP(a)
+	if !ok {
+		return "", 0
+	}
+	if ip.Is6() {
+		return ip.String(), asnutil.AsnForIPv6(ip.AsSlice())
+	}
+	return ip.String(), 0
+}
+
+// monitoredHost hands the relay wrapped HOP and STOP streams.
+type monitoredHost struct {
+	host.Host
+	m *CircuitMonitor
+}
+
+func (h *monitoredHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	if pid == proto.ProtoIDv2Hop {
+		inner := handler
+		handler = func(s network.Stream) {
+			inner(&hopStream{Stream: s, m: h.m})
+		}
+	}
+	h.Host.SetStreamHandler(pid, handler)
+}
+
+func (h *monitoredHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	s, err := h.Host.NewStream(ctx, p, pids...)
+	if err != nil || len(pids) != 1 || pids[0] != proto.ProtoIDv2Stop {
+		return s, err
+	}
+	return &stopStream{Stream: s, m: h.m}, nil
+}
+
+// hopStream watches the relay's response on a HOP stream for a granted
+// reservation.
+type hopStream struct {
+	network.Stream
+	m     *CircuitMonitor
+	sniff msgSniffer
+}
+
+func (s *hopStream) Write(b []byte) (int, error) {
+	if body, ok := s.sniff.feed(b); ok {
+		var msg pbv2.HopMessage
+		if protobuf.Unmarshal(body, &msg) == nil {
+			s.m.hopResponse(s.Stream, &msg)
+		}
+	}
+	return s.Stream.Write(b)
+}
+
+// stopStream is the relay's stream to a circuit's destination. Its first
+// message names the source; after that it carries the relayed bytes.
+type stopStream struct {
+	network.Stream
+	m       *CircuitMonitor
+	sniff   msgSniffer
+	circuit *circuit // set by the handshake, before the copy goroutines start
+	once    sync.Once
+}
+
+func (s *stopStream) Write(b []byte) (int, error) {
+	if s.circuit == nil {
+		if body, ok := s.sniff.feed(b); ok {
+			var msg pbv2.StopMessage
+			if protobuf.Unmarshal(body, &msg) == nil {
+				s.circuit = s.m.stopRequest(s, &msg)
+			}
+		}
+		n, err := s.Stream.Write(b)
+		if s.circuit != nil {
+			s.circuit.toDst.Add(int64(n))
+		}
+		return n, err
+	}
+
+	// Relayed data: enforce the quota and bandwidth share chunk by chunk.
+	cu := s.circuit.usage
+	written := 0
+	for len(b) > 0 {
+		if err := cu.check(); err != nil {
+			return written, err
+		}
+		chunk := b
+		if c := cu.chunk(); c > 0 && len(chunk) > c {
+			chunk = chunk[:c]
+		}
+		cu.consume(len(chunk))
+		n, err := s.Stream.Write(chunk)
+		written += n
+		s.circuit.toDst.Add(int64(n))
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (s *stopStream) Read(b []byte) (int, error) {
+	if s.circuit == nil {
+		return s.Stream.Read(b)
+	}
+	cu := s.circuit.usage
+	if err := cu.check(); err != nil {
+		return 0, err
+	}
+	if c := cu.chunk(); c > 0 && len(b) > c {
+		b = b[:c]
+	}
+	n, err := s.Stream.Read(b)
+	s.circuit.toSrc.Add(int64(n))
+	cu.consume(n)
+	return n, err
+}
+
+func (s *stopStream) Close() error {
+	s.done()
+	return s.Stream.Close()
+}
+
+func (s *stopStream) Reset() error {
+	s.done()
+	return s.Stream.Reset()
+}
+
+func (s *stopStream) done() {
+	s.once.Do(func() {
+		if s.circuit != nil {
+			s.m.removeCircuit(s.circuit.id)
+			s.circuit.usage.Close()
+		}
+	})
+}
+
+// msgSniffer collects the first varint-delimited message written to a
+// stream. The relay may write the length and body separately.
+type msgSniffer struct {
+	buf  []byte
+	done bool
+}
+
+// feed adds written bytes and returns the message body once it is complete.
+func (m *msgSniffer) feed(b []byte) ([]byte, bool) {
+	if m.done {
+		return nil, false
+	}
+	m.buf = append(m.buf, b...)
+	size, n := binary.Uvarint(m.buf)
+	if n < 0 || size > maxHandshakeSize {
+		m.done = true
+		return nil, false
+	}
+	if n == 0 || uint64(len(m.buf)-n) < size {
+		if len(m.buf) > maxHandshakeSize+binary.MaxVarintLen64 {
+			m.done = true
+		}
+		return nil, false
+	}
+	m.done = true
+	body := m.buf[n : n+int(size)]
+	m.buf = nil
+	return body, true
+}
@@ -0,0 +1,209 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	circuitv2client "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestParseBanTarget(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN", "12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN"},
+		{"203.0.113.7", "203.0.113.7/32"},
+		{"203.0.113.7/24", "203.0.113.0/24"},
+		{"::ffff:203.0.113.7", "203.0.113.7/32"},
+		{"2001:db8::1/32", "2001:db8::/32"},
+	}
+	for _, tt := range tests {
+		got, _, err := parseBanTarget(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseBanTarget(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "home", "10.0.0.0/33"} {
+		if _, _, err := parseBanTarget(in); !errors.Is(err, ErrInvalidBanTarget) {
+			t.Errorf("parseBanTarget(%q) error = %v, want ErrInvalidBanTarget", in, err)
+		}
+	}
+}
+
+func TestBanMatches(t *testing.T) {
+	addr := ma.StringCast("/ip4/203.0.113.7/tcp/4001")
+	_, b, _ := parseBanTarget("203.0.113.0/24")
+	if !b.matches("", addr) {
+		t.Error("range ban does not match an address inside it")
+	}
+	if b.matches("", ma.StringCast("/ip4/198.51.100.1/tcp/4001")) || b.matches("", nil) {
+		t.Error("range ban matches an address outside it")
+	}
+}
+
+func TestMsgSniffer(t *testing.T) {
+	var s msgSniffer
+	if _, ok := s.feed([]byte{5}); ok {
+		t.Fatal("message complete after the length alone")
+	}
+	body, ok := s.feed([]byte("hello world"))
+	if !ok || string(body) != "hello" {
+		t.Fatalf("feed() = %q, %v; want \"hello\"", body, ok)
+	}
+	if _, ok := s.feed([]byte{1, 'x'}); ok {
+		t.Error("sniffer decoded a second message")
+	}
+}
+
+// TestCircuitMonitor runs a relay with the monitor between two peers and
+// checks reservations, circuit accounting, kicks, and bans.
+func TestCircuitMonitor(t *testing.T) {
+	newHost := func(opts ...libp2p.Option) host.Host {
+		h, err := libp2p.New(append(opts, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	relayHost := newHost(libp2p.DisableRelay())
+	dst := newHost(libp2p.EnableRelay())
+	src := newHost(libp2p.EnableRelay())
+
+	const dataLimit = 1 << 20
+	m := NewCircuitMonitor(relayHost, dataLimit)
+	r, err := relayv2.New(m.Host(), relayv2.WithACL(m), relayv2.WithLimit(&relayv2.RelayLimit{Duration: time.Minute, Data: dataLimit}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	relayInfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, h := range []host.Host{src, dst} {
+		if err := h.Connect(ctx, relayInfo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := circuitv2client.Reserve(ctx, dst, relayInfo); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	rsvps := m.Reservations()
+	if len(rsvps) != 1 || rsvps[0].PeerID != dst.ID().String() || rsvps[0].RemoteIP != "127.0.0.1" {
+		t.Fatalf("Reservations() = %+v", rsvps)
+	}
+
+	// Echo over a circuit from src to dst.
+	dst.SetStreamHandler("/test/echo", func(s network.Stream) { io.Copy(s, s); s.Close() })
+	circuitAddr := ma.StringCast("/p2p/" + relayHost.ID().String() + "/p2p-circuit")
+	src.Peerstore().AddAddrs(dst.ID(), []ma.Multiaddr{relayInfo.Addrs[0].Encapsulate(circuitAddr)}, time.Minute)
+	s, err := src.NewStream(network.WithAllowLimitedConn(ctx, "test"), dst.ID(), "/test/echo")
+	if err != nil {
+		t.Fatalf("NewStream() over circuit error = %v", err)
+	}
+	s.SetDeadline(time.Now().Add(5 * time.Second))
+	s.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(s, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	circuits := m.Circuits()
+	if len(circuits) != 1 {
+		t.Fatalf("Circuits() = %+v, want one", circuits)
+	}
+	c := circuits[0]
+	if c.Src != src.ID().String() || c.Dst != dst.ID().String() || c.SrcIP != "127.0.0.1" || c.DataLimit != dataLimit {
+		t.Errorf("circuit = %+v", c)
+	}
+	if c.BytesToDst < 5 || c.BytesToSrc < 5 {
+		t.Errorf("circuit bytes = %d to dst, %d to src; want at least 5 each", c.BytesToDst, c.BytesToSrc)
+	}
+
+	// Kicking the circuit breaks the stream and forgets it.
+	if err := m.CloseCircuit(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(s, buf); err == nil {
+		t.Error("stream still readable after the circuit was closed")
+	}
+	if len(m.Circuits()) != 0 {
+		t.Errorf("Circuits() after close = %+v", m.Circuits())
+	}
+	if err := m.CloseCircuit(c.ID); !errors.Is(err, ErrCircuitNotFound) {
+		t.Errorf("second CloseCircuit() error = %v, want ErrCircuitNotFound", err)
+	}
+
+	// Banning dst disconnects it and refuses a new reservation.
+	if _, err := m.Ban(dst.ID().String(), time.Minute, "bandwidth"); err != nil {
+		t.Fatal(err)
+	}
+	if bans := m.Bans(); len(bans) != 1 || bans[0].Reason != "bandwidth" {
+		t.Errorf("Bans() = %+v", bans)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.Reservations()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("banned peer kept its reservation")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err := dst.Connect(ctx, relayInfo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := circuitv2client.Reserve(ctx, dst, relayInfo); err == nil {
+		t.Error("Reserve() succeeded for a banned peer")
+	}
+
+	// Lifting the ban lets it back in.
+	if err := m.Unban(dst.ID().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Unban(dst.ID().String()); !errors.Is(err, ErrBanNotFound) {
+		t.Errorf("second Unban() error = %v, want ErrBanNotFound", err)
+	}
+	if _, err := circuitv2client.Reserve(ctx, dst, relayInfo); err != nil {
+		t.Errorf("Reserve() after unban error = %v", err)
+	}
+
+	// An IP range ban covers every peer connecting from it.
+	if _, err := m.Ban("127.0.0.0/8", time.Minute, ""); err != nil {
+		t.Fatal(err)
+	}
+	if m.AllowReserve(src.ID(), ma.StringCast("/ip4/127.0.0.1/tcp/1")) {
+		t.Error("AllowReserve() allowed an address in a banned range")
+	}
+	if _, err := m.Ban("relay-abuser", time.Minute, ""); err == nil || !strings.Contains(err.Error(), "peer ID, IP address, or CIDR") {
+		t.Errorf("Ban() with a bad target error = %v", err)
+	}
+}
+
+func TestCircuitMonitorBanExpires(t *testing.T) {
+	h, err := libp2p.New(libp2p.NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	m := NewCircuitMonitor(h, 0)
+	if _, err := m.Ban("198.51.100.0/24", 10*time.Millisecond, ""); err != nil {
+		t.Fatal(err)
+	}
+	addr := ma.StringCast("/ip4/198.51.100.9/udp/4001/quic-v1")
+	if m.AllowReserve(h.ID(), addr) {
+		t.Fatal("AllowReserve() allowed a banned address")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !m.AllowReserve(h.ID(), addr) || len(m.Bans()) != 0 {
+		t.Error("ban still active after expiry")
+	}
+}
@@ -0,0 +1,809 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+)
+
+// Protocol ID for replication between federated relays.
+const FederationProtocol = "/peerup/relay-federation/1.0.0"
+
+// FederationStateFileName is the federation state file kept next to the relay config.
+const FederationStateFileName = "relay_federation.json"
+
+// federationStateVersion is bumped when the on-disk format changes incompatibly.
+const federationStateVersion = 1
+
+// Federation wire limits and timers.
+const (
+	maxFederationMessages  = 4096
+	maxFederationLineSize  = 64 << 10
+	maxFederatedGroupSlots = 255 // the pairing wire format carries the group size in one byte
+	federationSendTimeout  = 10 * time.Second
+	federationSyncInterval = 30 * time.Second
+	federationTombstoneTTL = 30 * 24 * time.Hour
+)
+
+// Federation message types.
+const (
+	fedMsgGroup        = "group"         // pairing group snapshot
+	fedMsgGroupRevoked = "group_revoked" // pairing group revoked by an operator
+	fedMsgPeer         = "peer"          // authorized_keys entry added or removed
+	fedMsgIntroduce    = "introduce"     // a peer joined a group; introduce it to the members
+)
+
+// ErrNotFederated is returned for federation traffic from a relay that is
+// not listed in federation.peers.
+var ErrNotFederated = errors.New("relay is not a federation peer")
+
+// federationMessage is one line of a federation stream.
+type federationMessage struct {
+	Type    string          `json:"type"`
+	Group   *persistedGroup `json:"group,omitempty"`
+	GroupID string          `json:"group_id,omitempty"`
+	Expires time.Time       `json:"expires,omitzero"` // revoked group's own expiry
+	Peer    *federatedPeer  `json:"peer,omitempty"`
+}
+
+// federatedPeer is the replicated state of one authorized_keys entry.
+// Relays keep whichever version has the latest Updated time.
+type federatedPeer struct {
+	PeerID     string    `json:"peer_id"`
+	Authorized bool      `json:"authorized"`
+	Comment    string    `json:"comment,omitempty"`
+	Group      string    `json:"group,omitempty"`
+	Expires    time.Time `json:"expires,omitzero"` // from the pairing group's peer TTL
+	Updated    time.Time `json:"updated"`
+}
+
+// federationStateFile is the on-disk representation of a Federation.
+type federationStateFile struct {
+	Version       int                       `json:"version"`
+	Peers         map[string]*federatedPeer `json:"peers"`
+	RevokedGroups map[string]time.Time      `json:"revoked_groups,omitempty"` // group ID -> group expiry
+}
+
+// federatedStore is a TokenStore whose groups can be exported to and
+// merged from other relays. Both built-in stores implement it.
+type federatedStore interface {
+	TokenStore
+	snapshot() []persistedGroup
+	mergeGroup(pg persistedGroup) (bool, []peer.ID, error)
+}
+
+// Federation replicates pairing groups, authorized peers and introductions
+// between relays that trust each other's peer IDs, so a code created on one
+// relay can be redeemed on any of them. Each relay pushes its own changes
+// to the others as they happen and sends its full state whenever a
+// federated relay connects. Received updates are applied but not passed
+// on, so every relay must list all the others.
+//
+// authorized_keys entries replicate last-writer-wins: the file is scanned
+// periodically and local additions and removals are stamped with the time
+// they were noticed.
+type Federation struct {
+	host         host.Host
+	relays       []peer.AddrInfo
+	trusted      map[peer.ID]bool
+	store        federatedStore
+	authKeysPath string
+	statePath    string
+
+	// Notifier delivers introductions for peers that joined through
+	// another relay. nil = skip.
+	Notifier *PeerNotifier
+
+	// OnPeersChanged is called after replicated updates changed
+	// authorized_keys, and once when Run starts, with the authorization
+	// expiry of every federated peer that has one. Used to reload the gater.
+	OnPeersChanged func(expiry map[peer.ID]time.Time)
+
+	// OnGroupsChanged is called after replicated pairing groups were added
+	// or updated. Used to open enrollment for their code holders.
+	OnGroupsChanged func()
+
+	mu      sync.Mutex // guards peers, revoked, scanned and the authorized_keys writes made here
+	peers   map[peer.ID]*federatedPeer
+	revoked map[string]time.Time
+
+	// scanned is false until authorized_keys has been compared with state
+	// loaded from disk. Without saved state, the first scan cannot tell
+	// new local additions from entries other relays have since removed.
+	scanned bool
+}
+
+// NewFederation loads federation state from statePath and prepares to
+// replicate with relays. store must be the relay's own token store
+// (MemoryTokenStore or FileTokenStore); hand out Store() instead of it so
+// local changes are pushed. A missing state file yields empty state.
+func NewFederation(h host.Host, relays []peer.AddrInfo, store TokenStore, authKeysPath, statePath string) (*Federation, error) {
+	fstore, ok := store.(federatedStore)
+	if !ok {
+		return nil, fmt.Errorf("token store %T cannot be federated", store)
+	}
+
+	f := &Federation{
+		host:         h,
+		trusted:      make(map[peer.ID]bool),
+		store:        fstore,
+		authKeysPath: authKeysPath,
+		statePath:    statePath,
+		peers:        make(map[peer.ID]*federatedPeer),
+		revoked:      make(map[string]time.Time),
+	}
+	for _, ai := range relays {
+		if ai.ID == h.ID() || f.trusted[ai.ID] {
+			continue
+		}
+		f.trusted[ai.ID] = true
+		f.relays = append(f.relays, ai)
+		h.Peerstore().AddAddrs(ai.ID, ai.Addrs, peerstore.PermanentAddrTTL)
+	}
+
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return f, nil
+		}
+		return nil, fmt.Errorf("failed to read federation state: %w", err)
+	}
+	var file federationStateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse federation state %s: %w", statePath, err)
+	}
+	if file.Version != federationStateVersion {
+		return nil, fmt.Errorf("unsupported federation state version %d in %s", file.Version, statePath)
+	}
+	for id, fp := range file.Peers {
+		p, err := peer.Decode(id)
+		if err != nil || fp == nil {
+			continue
+		}
+		f.peers[p] = fp
+	}
+	f.scanned = true
+	for id, expires := range file.RevokedGroups {
+		f.revoked[id] = expires
+	}
+	return f, nil
+}
+
+// Relays returns the federated relays.
+func (f *Federation) Relays() []peer.AddrInfo {
+	return append([]peer.AddrInfo(nil), f.relays...)
+}
+
+// Store returns the token store wrapped so that groups created, burned or
+// revoked here are pushed to the federated relays.
+func (f *Federation) Store() TokenStore {
+	return &federatedTokenStore{federatedStore: f.store, f: f}
+}
+
+// PeerJoined replicates a redemption on this relay: the updated group, the
+// new authorized_keys entry and an introduction for the group's members.
+func (f *Federation) PeerJoined(ctx context.Context, groupID string, p peer.ID) {
+	var msgs []federationMessage
+	pg, ok := f.groupSnapshot(groupID)
+	if ok {
+		msgs = append(msgs, federationMessage{Type: fedMsgGroup, Group: &pg})
+	}
+
+	f.mu.Lock()
+	changed := f.scanLocked(time.Now())
+	if fp := f.peers[p]; fp != nil && fp.Authorized {
+		// The redemption is new even if a first scan seeded it unstamped.
+		if fp.Updated.IsZero() {
+			fp.Updated = time.Now()
+			changed[p] = true
+		}
+		if expires := peerExpiry(pg, p); ok && !expires.Equal(fp.Expires) {
+			fp.Expires = expires
+			fp.Updated = time.Now()
+			changed[p] = true
+		}
+	}
+	msgs = append(msgs, f.peerMessagesLocked(changed)...)
+	if len(changed) > 0 {
+		f.saveOrWarnLocked()
+	}
+	f.mu.Unlock()
+
+	msgs = append(msgs, federationMessage{Type: fedMsgIntroduce, GroupID: groupID, Peer: &federatedPeer{PeerID: p.String()}})
+	f.broadcast(ctx, msgs)
+}
+
+// ForwardRevocation sends a revocation notice applied here to the connected
+// federated relays, so they drop the peer and replay the notice to their
+// group members. Notices that came from a federated relay are not sent on.
+func (f *Federation) ForwardRevocation(ctx context.Context, r *auth.Revocation, from peer.ID) {
+	if f.trusted[from] {
+		return
+	}
+	for _, ai := range f.relays {
+		if f.host.Network().Connectedness(ai.ID) != network.Connected {
+			continue
+		}
+		if err := SendRevocations(ctx, f.host, ai.ID, []*auth.Revocation{r}); err != nil {
+			slog.Debug("federation: revocation forward failed", "relay", ai.ID.String()[:16]+"...", "err", err)
+		}
+	}
+}
+
+// HandleStream applies updates from a federated relay.
+func (f *Federation) HandleStream(s network.Stream) {
+	from := s.Conn().RemotePeer()
+	if !f.trusted[from] {
+		slog.Warn("federation: rejected stream", "peer", from.String()[:16]+"...", "err", ErrNotFederated)
+		s.Reset()
+		return
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(30 * time.Second))
+
+	msgs, err := readFederationMessages(s)
+	if err != nil {
+		slog.Warn("federation: read error", "relay", from.String()[:16]+"...", "err", err)
+	}
+	f.apply(context.Background(), from, msgs)
+}
+
+// Run keeps the federation in sync until ctx is done: it sends the full
+// state to federated relays as they are identified, redials disconnected
+// ones, and pushes local authorized_keys changes.
+func (f *Federation) Run(ctx context.Context) {
+	sub, err := f.host.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		slog.Error("federation: subscribe failed", "err", err)
+		return
+	}
+	defer sub.Close()
+
+	f.refresh(ctx)
+	f.mu.Lock()
+	expiry := f.expiryLocked()
+	f.mu.Unlock()
+	if f.OnPeersChanged != nil {
+		f.OnPeersChanged(expiry)
+	}
+
+	ticker := time.NewTicker(federationSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.refresh(ctx)
+		case evt, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			e := evt.(event.EvtPeerIdentificationCompleted)
+			if !f.trusted[e.Peer] {
+				continue
+			}
+			go func(p peer.ID) {
+				if err := f.sync(ctx, p); err != nil {
+					slog.Debug("federation: sync failed", "relay", p.String()[:16]+"...", "err", err)
+				}
+			}(e.Peer)
+		}
+	}
+}
+
+// refresh pushes local authorized_keys changes, drops stale tombstones
+// and redials federated relays that are not connected.
+func (f *Federation) refresh(ctx context.Context) {
+	now := time.Now()
+	f.mu.Lock()
+	changed := f.scanLocked(now)
+	pruned := f.pruneLocked(now)
+	msgs := f.peerMessagesLocked(changed)
+	if len(changed) > 0 || pruned {
+		f.saveOrWarnLocked()
+	}
+	f.mu.Unlock()
+
+	if len(msgs) > 0 {
+		f.broadcast(ctx, msgs)
+	}
+	for _, ai := range f.relays {
+		if f.host.Network().Connectedness(ai.ID) == network.Connected {
+			continue
+		}
+		go func(ai peer.AddrInfo) {
+			dialCtx, cancel := context.WithTimeout(ctx, federationSendTimeout)
+			defer cancel()
+			if err := f.host.Connect(dialCtx, ai); err != nil {
+				slog.Debug("federation: relay unreachable", "relay", ai.ID.String()[:16]+"...", "err", err)
+			}
+		}(ai)
+	}
+}
+
+// sync sends the full replicated state to relay p.
+func (f *Federation) sync(ctx context.Context, p peer.ID) error {
+	now := time.Now()
+	var msgs []federationMessage
+	f.mu.Lock()
+	for _, pg := range f.store.snapshot() {
+		if _, revoked := f.revoked[pg.ID]; revoked || now.After(pg.ExpiresAt) {
+			continue
+		}
+		msgs = append(msgs, federationMessage{Type: fedMsgGroup, Group: &pg})
+	}
+	for id, expires := range f.revoked {
+		msgs = append(msgs, federationMessage{Type: fedMsgGroupRevoked, GroupID: id, Expires: expires})
+	}
+	for _, fp := range f.peers {
+		fp := *fp
+		msgs = append(msgs, federationMessage{Type: fedMsgPeer, Peer: &fp})
+	}
+	f.mu.Unlock()
+
+	if len(msgs) > maxFederationMessages {
+		slog.Warn("federation: state too large for one sync, truncating", "messages", len(msgs))
+		msgs = msgs[:maxFederationMessages]
+	}
+	return f.send(ctx, p, msgs)
+}
+
+// broadcast sends msgs to every federated relay. Relays that miss an
+// update catch up on the full sync when they next connect.
+func (f *Federation) broadcast(ctx context.Context, msgs []federationMessage) {
+	var wg sync.WaitGroup
+	for _, ai := range f.relays {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			if err := f.send(ctx, p, msgs); err != nil {
+				slog.Debug("federation: push failed", "relay", p.String()[:16]+"...", "err", err)
+			}
+		}(ai.ID)
+	}
+	wg.Wait()
+}
+
+// send opens a federation stream to p and writes msgs.
+func (f *Federation) send(ctx context.Context, p peer.ID, msgs []federationMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, federationSendTimeout)
+	defer cancel()
+
+	s, err := f.host.NewStream(ctx, p, protocol.ID(FederationProtocol))
+	if err != nil {
+		return fmt.Errorf("failed to open stream to %s: %w", p.String()[:16], err)
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := writeFederationMessages(s, msgs); err != nil {
+		s.Reset()
+		return err
+	}
+	return nil
+}
+
+// apply merges updates received from relay from.
+func (f *Federation) apply(ctx context.Context, from peer.ID, msgs []federationMessage) {
+	short := from.String()[:16] + "..."
+	var groupsChanged, peersChanged, stateChanged bool
+	var intros, deauth []federationMessage
+	var removed []peer.ID
+
+	f.mu.Lock()
+	for _, m := range msgs {
+		switch m.Type {
+		case fedMsgGroup:
+			if m.Group == nil || !validGroupID(m.Group.ID) || len(m.Group.Slots) == 0 || len(m.Group.Slots) > maxFederatedGroupSlots {
+				slog.Warn("federation: invalid group", "relay", short)
+				continue
+			}
+			if _, revoked := f.revoked[m.Group.ID]; revoked {
+				continue
+			}
+			changed, displaced, err := f.store.mergeGroup(*m.Group)
+			if err != nil {
+				slog.Warn("federation: group merge failed", "relay", short, "err", err)
+				continue
+			}
+			groupsChanged = groupsChanged || changed
+			// A code redeemed here that another relay handed out first:
+			// the later redeemer loses its authorization everywhere.
+			for _, p := range displaced {
+				fp := federatedPeer{PeerID: p.String(), Updated: time.Now()}
+				if ok, err := f.applyPeerLocked(fp); err != nil || !ok {
+					if err != nil {
+						slog.Warn("federation: failed to deauthorize displaced peer", "peer", fp.PeerID[:16]+"...", "err", err)
+					}
+					continue
+				}
+				slog.Info("federation: redemption lost to an earlier one", "peer", fp.PeerID[:16]+"...", "group", m.Group.ID, "relay", short)
+				peersChanged, stateChanged = true, true
+				removed = append(removed, p)
+				deauth = append(deauth, federationMessage{Type: fedMsgPeer, Peer: &fp})
+			}
+		case fedMsgGroupRevoked:
+			if !validGroupID(m.GroupID) {
+				continue
+			}
+			if _, ok := f.revoked[m.GroupID]; !ok {
+				expires := m.Expires
+				if expires.IsZero() {
+					expires = time.Now().Add(24 * time.Hour)
+				}
+				f.revoked[m.GroupID] = expires
+				stateChanged = true
+			}
+			if err := f.store.Revoke(m.GroupID); err == nil {
+				slog.Info("federation: pairing group revoked", "group", m.GroupID, "relay", short)
+			}
+		case fedMsgPeer:
+			if m.Peer == nil {
+				continue
+			}
+			changed, err := f.applyPeerLocked(*m.Peer)
+			if err != nil {
+				slog.Warn("federation: peer update failed", "relay", short, "err", err)
+				continue
+			}
+			if changed {
+				peersChanged, stateChanged = true, true
+				if !m.Peer.Authorized {
+					if p, err := peer.Decode(m.Peer.PeerID); err == nil {
+						removed = append(removed, p)
+					}
+				}
+			}
+		case fedMsgIntroduce:
+			intros = append(intros, m)
+		}
+	}
+	if stateChanged {
+		f.saveOrWarnLocked()
+	}
+	expiry := f.expiryLocked()
+	f.mu.Unlock()
+
+	if groupsChanged && f.OnGroupsChanged != nil {
+		f.OnGroupsChanged()
+	}
+	if peersChanged && f.OnPeersChanged != nil {
+		f.OnPeersChanged(expiry)
+	}
+	for _, p := range removed {
+		f.host.Network().ClosePeer(p)
+	}
+	if len(deauth) > 0 {
+		go f.broadcast(ctx, deauth)
+	}
+	if f.Notifier == nil {
+		return
+	}
+	for _, m := range intros {
+		if m.Peer == nil || !validGroupID(m.GroupID) {
+			continue
+		}
+		joined, err := peer.Decode(m.Peer.PeerID)
+		if err != nil {
+			continue
+		}
+		go f.Notifier.NotifyGroupMembers(ctx, m.GroupID, joined)
+	}
+}
+
+// applyPeerLocked writes a replicated authorized_keys entry if it is newer
+// than the one known here. Entries for relays and this host are ignored.
+func (f *Federation) applyPeerLocked(fp federatedPeer) (bool, error) {
+	id, err := peer.Decode(fp.PeerID)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", auth.ErrInvalidPeerID, err)
+	}
+	if id == f.host.ID() || f.trusted[id] {
+		return false, nil
+	}
+	if fp.Group != "" && !validGroupID(fp.Group) {
+		return false, fmt.Errorf("invalid group %q for %s", fp.Group, fp.PeerID[:16]+"...")
+	}
+	if local := f.peers[id]; local != nil && !fp.Updated.After(local.Updated) {
+		return false, nil
+	}
+
+	if fp.Authorized {
+		if err := auth.AddPeer(f.authKeysPath, fp.PeerID, fp.Comment); err != nil && !errors.Is(err, auth.ErrPeerAlreadyAuthorized) {
+			return false, err
+		}
+		if fp.Group != "" {
+			if err := auth.SetPeerAttr(f.authKeysPath, fp.PeerID, "group", fp.Group); err != nil {
+				return false, err
+			}
+		}
+	} else if err := auth.RemovePeer(f.authKeysPath, fp.PeerID); err != nil &&
+		!errors.Is(err, auth.ErrPeerNotFound) && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	f.peers[id] = &fp
+	return true, nil
+}
+
+// scanLocked compares authorized_keys with the replicated state and stamps
+// local additions, group changes and removals with now. Returns the peers
+// whose state changed.
+//
+// The first scan without saved state seeds entries with the zero time
+// instead, so removals other relays made in the meantime still win.
+func (f *Federation) scanLocked(now time.Time) map[peer.ID]bool {
+	changed := make(map[peer.ID]bool)
+	entries, err := auth.ListPeers(f.authKeysPath)
+	if err != nil {
+		slog.Warn("federation: failed to read authorized_keys", "err", err)
+		return changed
+	}
+	added := now
+	if !f.scanned {
+		added = time.Time{}
+		f.scanned = true
+	}
+
+	seen := make(map[peer.ID]bool, len(entries))
+	for _, e := range entries {
+		if e.PeerID == f.host.ID() || f.trusted[e.PeerID] {
+			continue
+		}
+		seen[e.PeerID] = true
+		fp := f.peers[e.PeerID]
+		if fp != nil && fp.Authorized && fp.Group == e.Group {
+			continue
+		}
+		updated := now
+		if fp == nil {
+			updated = added
+		}
+		f.peers[e.PeerID] = &federatedPeer{
+			PeerID:     e.PeerID.String(),
+			Authorized: true,
+			Comment:    e.Comment,
+			Group:      e.Group,
+			Updated:    updated,
+		}
+		changed[e.PeerID] = true
+	}
+	for id, fp := range f.peers {
+		if fp.Authorized && !seen[id] {
+			f.peers[id] = &federatedPeer{PeerID: fp.PeerID, Updated: now}
+			changed[id] = true
+		}
+	}
+	return changed
+}
+
+// pruneLocked drops tombstones for expired groups and long-removed peers.
+func (f *Federation) pruneLocked(now time.Time) bool {
+	pruned := false
+	for id, expires := range f.revoked {
+		if now.After(expires) {
+			delete(f.revoked, id)
+			pruned = true
+		}
+	}
+	for id, fp := range f.peers {
+		if !fp.Authorized && now.Sub(fp.Updated) > federationTombstoneTTL {
+			delete(f.peers, id)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// peerMessagesLocked returns peer updates for the given peers.
+func (f *Federation) peerMessagesLocked(ids map[peer.ID]bool) []federationMessage {
+	var msgs []federationMessage
+	for id := range ids {
+		if fp := f.peers[id]; fp != nil {
+			fp := *fp
+			msgs = append(msgs, federationMessage{Type: fedMsgPeer, Peer: &fp})
+		}
+	}
+	return msgs
+}
+
+// expiryLocked returns the authorization expiry of federated peers that have one.
+func (f *Federation) expiryLocked() map[peer.ID]time.Time {
+	expiry := make(map[peer.ID]time.Time)
+	for id, fp := range f.peers {
+		if fp.Authorized && !fp.Expires.IsZero() {
+			expiry[id] = fp.Expires
+		}
+	}
+	return expiry
+}
+
+// groupRevoked records a tombstone for a group revoked here and pushes it.
+func (f *Federation) groupRevoked(groupID string, expires time.Time) {
+	f.mu.Lock()
+	f.revoked[groupID] = expires
+	f.saveOrWarnLocked()
+	f.mu.Unlock()
+
+	go f.broadcast(context.Background(), []federationMessage{{Type: fedMsgGroupRevoked, GroupID: groupID, Expires: expires}})
+}
+
+// pushGroup sends the current state of a group to the federated relays.
+func (f *Federation) pushGroup(groupID string) {
+	if pg, ok := f.groupSnapshot(groupID); ok {
+		f.broadcast(context.Background(), []federationMessage{{Type: fedMsgGroup, Group: &pg}})
+	}
+}
+
+func (f *Federation) groupSnapshot(groupID string) (persistedGroup, bool) {
+	for _, pg := range f.store.snapshot() {
+		if pg.ID == groupID {
+			return pg, true
+		}
+	}
+	return persistedGroup{}, false
+}
+
+// groupForToken returns the ID of the group holding token, or "".
+func (f *Federation) groupForToken(token []byte) string {
+	hash := sha256.Sum256(token)
+	want := hex.EncodeToString(hash[:])
+	for _, pg := range f.store.snapshot() {
+		for _, ps := range pg.Slots {
+			if ps.TokenHash == want {
+				return pg.ID
+			}
+		}
+	}
+	return ""
+}
+
+// saveOrWarnLocked writes the federation state atomically, logging on failure.
+func (f *Federation) saveOrWarnLocked() {
+	if f.statePath == "" {
+		return
+	}
+	file := federationStateFile{
+		Version:       federationStateVersion,
+		Peers:         make(map[string]*federatedPeer, len(f.peers)),
+		RevokedGroups: f.revoked,
+	}
+	for id, fp := range f.peers {
+		file.Peers[id.String()] = fp
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		slog.Warn("federation: failed to marshal state", "err", err)
+		return
+	}
+	if err := writeFileAtomic(f.statePath, data); err != nil {
+		slog.Warn("federation: failed to save state", "path", f.statePath, "err", err)
+	}
+}
+
+// federatedTokenStore pushes local changes to pairing groups to the
+// federated relays. Redemptions are pushed by Federation.PeerJoined once
+// the HMAC proof is recorded.
+type federatedTokenStore struct {
+	federatedStore
+	f *Federation
+}
+
+func (s *federatedTokenStore) CreateGroup(count int, ttl time.Duration, ns string, peerTTL time.Duration) ([][]byte, string, error) {
+	tokens, groupID, err := s.federatedStore.CreateGroup(count, ttl, ns, peerTTL)
+	if err == nil {
+		go s.f.pushGroup(groupID)
+	}
+	return tokens, groupID, err
+}
+
+func (s *federatedTokenStore) RecordFailedAttempt(token []byte) {
+	s.federatedStore.RecordFailedAttempt(token)
+	if groupID := s.f.groupForToken(token); groupID != "" {
+		go s.f.pushGroup(groupID)
+	}
+}
+
+func (s *federatedTokenStore) Revoke(groupID string) error {
+	var expires time.Time
+	for _, g := range s.federatedStore.List() {
+		if g.ID == groupID {
+			expires = g.ExpiresAt
+		}
+	}
+	if err := s.federatedStore.Revoke(groupID); err != nil {
+		return err
+	}
+	s.f.groupRevoked(groupID, expires)
+	return nil
+}
+
+// peerExpiry returns when p's authorization ends under the group's peer
+// TTL, or zero if it does not.
+func peerExpiry(pg persistedGroup, p peer.ID) time.Time {
+	if pg.PeerTTL == "" {
+		return time.Time{}
+	}
+	ttl, err := time.ParseDuration(pg.PeerTTL)
+	if err != nil || ttl <= 0 {
+		return time.Time{}
+	}
+	for _, ps := range pg.Slots {
+		if ps.PeerID == p.String() && !ps.UsedAt.IsZero() {
+			return ps.UsedAt.Add(ttl)
+		}
+	}
+	return time.Time{}
+}
+
+// validGroupID reports whether id looks like a group ID from CreateGroup.
+// Group IDs end up in authorized_keys attributes, so nothing else is taken
+// from the wire.
+func validGroupID(id string) bool {
+	if len(id) == 0 || len(id) > 16 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFederationMessages writes msgs as newline-delimited JSON.
+func writeFederationMessages(w io.Writer, msgs []federationMessage) error {
+	enc := json.NewEncoder(w)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			return fmt.Errorf("failed to write federation message: %w", err)
+		}
+	}
+	return nil
+}
+
+// readFederationMessages reads newline-delimited JSON messages until EOF.
+func readFederationMessages(r io.Reader) ([]federationMessage, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), maxFederationLineSize)
+
+	var msgs []federationMessage
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if len(msgs) == maxFederationMessages {
+			return msgs, fmt.Errorf("more than %d messages in one stream", maxFederationMessages)
+		}
+		var m federationMessage
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			return msgs, fmt.Errorf("invalid federation message: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	if err := sc.Err(); err != nil {
+		return msgs, fmt.Errorf("failed to read federation messages: %w", err)
+	}
+	return msgs, nil
+}
@@ -0,0 +1,343 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+)
+
+// testFederatedRelay is one relay of a test federation.
+type testFederatedRelay struct {
+	host     host.Host
+	store    *MemoryTokenStore
+	fed      *Federation
+	keysPath string
+
+	mu     sync.Mutex
+	expiry map[peer.ID]time.Time
+}
+
+func newTestFederation(t *testing.T, n int) []*testFederatedRelay {
+	t.Helper()
+	relays := make([]*testFederatedRelay, n)
+	for i := range relays {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		relays[i] = &testFederatedRelay{host: h, store: NewTokenStore()}
+	}
+
+	for _, r := range relays {
+		var others []peer.AddrInfo
+		for _, o := range relays {
+			if o != r {
+				others = append(others, peer.AddrInfo{ID: o.host.ID(), Addrs: o.host.Addrs()})
+			}
+		}
+		dir := t.TempDir()
+		r.keysPath = filepath.Join(dir, "authorized_keys")
+		fed, err := NewFederation(r.host, others, r.store, r.keysPath, filepath.Join(dir, FederationStateFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fed.OnPeersChanged = func(expiry map[peer.ID]time.Time) {
+			r.mu.Lock()
+			r.expiry = expiry
+			r.mu.Unlock()
+		}
+		r.fed = fed
+		r.host.SetStreamHandler(protocol.ID(FederationProtocol), fed.HandleStream)
+	}
+	return relays
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func groupOf(t *testing.T, keysPath string, p peer.ID) (string, bool) {
+	t.Helper()
+	entries, err := auth.ListPeers(keysPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.PeerID == p {
+			return e.Group, true
+		}
+	}
+	return "", false
+}
+
+// TestFederationPairing creates a group on one relay, redeems a code on the
+// other, and checks the redemption, authorization and revocation replicate.
+func TestFederationPairing(t *testing.T) {
+	relays := newTestFederation(t, 2)
+	a, b := relays[0], relays[1]
+
+	tokens, groupID, err := a.fed.Store().CreateGroup(2, time.Hour, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the group on relay B", func() bool { return b.store.GroupCount(groupID) == 2 })
+
+	// Redeem on B the way PairingHandler does.
+	joiner := genPeerID(t)
+	_, idx, err := b.fed.Store().ValidateAndUse(tokens[0], joiner, "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.store.SetHMACProof(groupID, idx, []byte("proof"))
+	if err := auth.AddPeer(b.keysPath, joiner.String(), "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	auth.SetPeerAttr(b.keysPath, joiner.String(), "group", groupID)
+	b.fed.PeerJoined(context.Background(), groupID, joiner)
+
+	waitFor(t, "the joiner on relay A", func() bool {
+		group, ok := groupOf(t, a.keysPath, joiner)
+		return ok && group == groupID
+	})
+	peers := a.store.GetGroupPeers(groupID, -1)
+	if len(peers) != 1 || peers[0].PeerID != joiner || string(peers[0].HMACProof) != "proof" {
+		t.Errorf("relay A group peers = %+v", peers)
+	}
+	if _, _, err := a.store.ValidateAndUse(tokens[0], genPeerID(t), ""); !errors.Is(err, ErrTokenUsed) {
+		t.Errorf("redeeming the code again on relay A error = %v, want ErrTokenUsed", err)
+	}
+	a.mu.Lock()
+	expires := a.expiry[joiner]
+	a.mu.Unlock()
+	if until := time.Until(expires); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("relay A expiry for the joiner = %v", expires)
+	}
+
+	// Removing the peer from authorized_keys on A removes it on B.
+	if err := auth.RemovePeer(a.keysPath, joiner.String()); err != nil {
+		t.Fatal(err)
+	}
+	a.fed.refresh(context.Background())
+	waitFor(t, "the joiner removed on relay B", func() bool {
+		_, ok := groupOf(t, b.keysPath, joiner)
+		return !ok
+	})
+
+	// A revoked group stays revoked when B syncs it back.
+	if err := a.fed.Store().Revoke(groupID); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the group revoked on relay B", func() bool { return b.store.GroupCount(groupID) == 0 })
+	if err := b.fed.sync(context.Background(), a.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if a.store.GroupCount(groupID) != 0 {
+		t.Error("revoked group came back after a sync")
+	}
+}
+
+// TestFederationDisplacedRedemption redeems one code on both relays and
+// checks that the later redeemer is deauthorized on both once they merge.
+func TestFederationDisplacedRedemption(t *testing.T) {
+	relays := newTestFederation(t, 2)
+	a, b := relays[0], relays[1]
+
+	tokens, groupID, err := a.fed.Store().CreateGroup(2, time.Hour, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the group on relay B", func() bool { return b.store.GroupCount(groupID) == 2 })
+
+	redeem := func(r *testFederatedRelay, p peer.ID) {
+		t.Helper()
+		if _, _, err := r.store.ValidateAndUse(tokens[0], p, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := auth.AddPeer(r.keysPath, p.String(), ""); err != nil {
+			t.Fatal(err)
+		}
+		auth.SetPeerAttr(r.keysPath, p.String(), "group", groupID)
+	}
+	first, second := genPeerID(t), genPeerID(t)
+	redeem(a, first)
+	time.Sleep(time.Millisecond)
+	redeem(b, second)
+
+	// B's redemption reaches A first, so A authorizes the later redeemer
+	// until B learns it lost the slot.
+	b.fed.PeerJoined(context.Background(), groupID, second)
+	waitFor(t, "the later redeemer on relay A", func() bool {
+		_, ok := groupOf(t, a.keysPath, second)
+		return ok
+	})
+	a.fed.PeerJoined(context.Background(), groupID, first)
+
+	for name, r := range map[string]*testFederatedRelay{"A": a, "B": b} {
+		waitFor(t, "the later redeemer removed on relay "+name, func() bool {
+			_, ok := groupOf(t, r.keysPath, second)
+			return !ok
+		})
+		if _, ok := groupOf(t, r.keysPath, first); !ok {
+			t.Errorf("relay %s lost the earlier redeemer", name)
+		}
+	}
+}
+
+// TestFederationSync checks that a relay that was offline catches up from
+// the full state sent when it connects.
+func TestFederationSync(t *testing.T) {
+	relays := newTestFederation(t, 2)
+	a, b := relays[0], relays[1]
+
+	_, groupID, _ := a.store.CreateGroup(1, time.Hour, "", 0)
+	member := genPeerID(t)
+	a.fed.mu.Lock()
+	a.fed.scanLocked(time.Now())
+	a.fed.mu.Unlock()
+	auth.AddPeer(a.keysPath, member.String(), "desktop")
+	auth.SetPeerAttr(a.keysPath, member.String(), "group", groupID)
+	a.fed.mu.Lock()
+	a.fed.scanLocked(time.Now())
+	a.fed.mu.Unlock()
+
+	if err := a.fed.sync(context.Background(), b.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the member on relay B", func() bool {
+		group, ok := groupOf(t, b.keysPath, member)
+		return ok && group == groupID
+	})
+	if b.store.GroupCount(groupID) != 1 {
+		t.Error("group not replicated by sync")
+	}
+
+	// An older update does not undo a newer one.
+	stale := federatedPeer{PeerID: member.String(), Updated: time.Now().Add(-time.Hour)}
+	b.fed.mu.Lock()
+	changed, err := b.fed.applyPeerLocked(stale)
+	b.fed.mu.Unlock()
+	if err != nil || changed {
+		t.Errorf("applyPeerLocked(stale) = %v, %v", changed, err)
+	}
+
+	// Group IDs end up in authorized_keys, so odd ones are refused.
+	bad := federatedPeer{PeerID: genPeerID(t).String(), Authorized: true, Group: "x  role=admin", Updated: time.Now()}
+	b.fed.mu.Lock()
+	_, err = b.fed.applyPeerLocked(bad)
+	b.fed.mu.Unlock()
+	if err == nil || !strings.Contains(err.Error(), "invalid group") {
+		t.Errorf("applyPeerLocked(bad group) error = %v", err)
+	}
+}
+
+// TestFederationFirstScanKeepsTombstones checks that a relay starting
+// without saved state does not resurrect peers other relays removed.
+func TestFederationFirstScanKeepsTombstones(t *testing.T) {
+	relays := newTestFederation(t, 2)
+	a, b := relays[0], relays[1]
+
+	removed := genPeerID(t)
+	b.fed.mu.Lock()
+	b.fed.scanLocked(time.Now())
+	b.fed.peers[removed] = &federatedPeer{PeerID: removed.String(), Updated: time.Now().Add(-time.Hour)}
+	b.fed.mu.Unlock()
+
+	// Relay A lost its state but still lists the removed peer.
+	auth.AddPeer(a.keysPath, removed.String(), "")
+	a.fed.mu.Lock()
+	a.fed.scanLocked(time.Now())
+	if fp := a.fed.peers[removed]; fp == nil || !fp.Updated.IsZero() {
+		t.Errorf("first scan entry = %+v, want zero Updated", fp)
+	}
+	a.fed.mu.Unlock()
+
+	if err := a.fed.sync(context.Background(), b.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.fed.sync(context.Background(), a.host.ID()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the tombstone to remove the peer on relay A", func() bool {
+		_, ok := groupOf(t, a.keysPath, removed)
+		return !ok
+	})
+	if _, ok := groupOf(t, b.keysPath, removed); ok {
+		t.Error("first scan on relay A resurrected the peer on relay B")
+	}
+
+	// Later additions are stamped as usual.
+	added := genPeerID(t)
+	auth.AddPeer(a.keysPath, added.String(), "")
+	a.fed.mu.Lock()
+	a.fed.scanLocked(time.Now())
+	if fp := a.fed.peers[added]; fp == nil || fp.Updated.IsZero() {
+		t.Errorf("later addition = %+v, want a timestamp", fp)
+	}
+	a.fed.mu.Unlock()
+}
+
+func TestFederationRejectsUnknownRelay(t *testing.T) {
+	relays := newTestFederation(t, 1)
+	a := relays[0]
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	outsider, err := NewFederation(h, []peer.AddrInfo{{ID: a.host.ID(), Addrs: a.host.Addrs()}}, NewTokenStore(), filepath.Join(t.TempDir(), "authorized_keys"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, groupID, _ := outsider.store.CreateGroup(1, time.Hour, "", 0)
+	outsider.pushGroup(groupID)
+
+	time.Sleep(100 * time.Millisecond)
+	if a.store.GroupCount(groupID) != 0 {
+		t.Error("relay accepted a group from a relay outside the federation")
+	}
+}
+
+func TestFederationStatePersists(t *testing.T) {
+	relays := newTestFederation(t, 1)
+	a := relays[0]
+
+	member := genPeerID(t)
+	auth.AddPeer(a.keysPath, member.String(), "")
+	a.fed.refresh(context.Background())
+	a.fed.groupRevoked("deadbeef", time.Now().Add(time.Hour))
+
+	reloaded, err := NewFederation(a.host, nil, a.store, a.keysPath, a.fed.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp := reloaded.peers[member]; fp == nil || !fp.Authorized {
+		t.Errorf("reloaded peer state = %+v", fp)
+	}
+	if _, ok := reloaded.revoked["deadbeef"]; !ok {
+		t.Error("revoked group not persisted")
+	}
+
+	if _, err := NewFederation(a.host, nil, struct{ TokenStore }{a.store}, a.keysPath, ""); err == nil {
+		t.Error("NewFederation() accepted a store it cannot replicate")
+	}
+}
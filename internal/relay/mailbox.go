@@ -0,0 +1,722 @@
+package relay
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+	"github.com/satindergrewal/peer-up/internal/invite"
+)
+
+// Protocol ID for the relay mailbox used by asynchronous invites.
+const MailboxProtocol = "/peerup/relay-mailbox/1.0.0"
+
+// MailboxFileName is the mailbox state file kept next to the relay config.
+const MailboxFileName = "relay_mailbox.json"
+
+// MaxMailboxTTL caps how long an introduction waits for its joiner. A reply
+// then waits invite.MailboxReplyTTL for the inviter.
+const MaxMailboxTTL = 7 * 24 * time.Hour
+
+const (
+	mailboxFileVersion   = 1
+	maxMailboxBlob       = 1024 // sealed introduction or reply
+	maxMailboxesPerOwner = 16
+	maxMailboxes         = 1024
+)
+
+// Mailbox stream operations. Clients open a stream and send one op byte;
+// the relay opens a stream to the inviter with mailboxOpDeliver.
+const (
+	mailboxOpDeposit byte = 0x01
+	mailboxOpRedeem  byte = 0x02
+	mailboxOpCancel  byte = 0x03
+	mailboxOpDeliver byte = 0x10
+)
+
+var (
+	ErrMailboxNotFound = errors.New("invite not found or already used")
+	ErrMailboxFull     = errors.New("too many pending invites")
+)
+
+// mailboxEntry is one deposited introduction and, once redeemed, the reply.
+type mailboxEntry struct {
+	ID         string    `json:"id"` // hex mailbox ID
+	Owner      string    `json:"owner"`
+	Intro      []byte    `json:"intro"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Joiner     string    `json:"joiner,omitempty"`
+	Reply      []byte    `json:"reply,omitempty"`
+	RedeemedAt time.Time `json:"redeemed_at,omitzero"`
+}
+
+// mailboxFile is the on-disk representation of a Mailbox.
+type mailboxFile struct {
+	Version int             `json:"version"`
+	Entries []*mailboxEntry `json:"entries"`
+}
+
+// MailboxDelivery is a redeemed invite handed back to the inviter.
+type MailboxDelivery struct {
+	ID     string // hex mailbox ID
+	Joiner peer.ID
+	Reply  []byte // sealed reply, opened by the inviter
+}
+
+// Mailbox is the relay's store-and-forward box for asynchronous invites.
+// Inviters deposit sealed introductions, joiners redeem them later and
+// leave sealed replies, and the replies are delivered to the inviter the
+// next time it is connected. The relay cannot read any of it. State is
+// persisted so invites survive a restart (temp file + rename).
+type Mailbox struct {
+	path    string // "" = memory only
+	mu      sync.Mutex
+	entries map[string]*mailboxEntry
+}
+
+// NewMailbox loads the mailbox at path, dropping expired entries. A missing
+// file yields an empty mailbox; an empty path keeps it in memory only.
+func NewMailbox(path string) (*Mailbox, error) {
+	m := &Mailbox{path: path, entries: make(map[string]*mailboxEntry)}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("failed to read mailbox: %w", err)
+	}
+	var file mailboxFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse mailbox %s: %w", path, err)
+	}
+	if file.Version != mailboxFileVersion {
+		return nil, fmt.Errorf("unsupported mailbox version %d in %s", file.Version, path)
+	}
+	now := time.Now()
+	for _, e := range file.Entries {
+		if now.Before(e.ExpiresAt) {
+			m.entries[e.ID] = e
+		}
+	}
+	return m, nil
+}
+
+// Deposit stores a sealed introduction from owner for ttl (capped at
+// MaxMailboxTTL). Depositing again under the same ID replaces it.
+func (m *Mailbox) Deposit(owner peer.ID, id string, intro []byte, ttl time.Duration) error {
+	if len(intro) == 0 || len(intro) > maxMailboxBlob {
+		return fmt.Errorf("introduction must be 1-%d bytes", maxMailboxBlob)
+	}
+	if ttl <= 0 || ttl > MaxMailboxTTL {
+		ttl = MaxMailboxTTL
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(time.Now())
+
+	if e, ok := m.entries[id]; ok && (e.Owner != owner.String() || e.Joiner != "") {
+		return fmt.Errorf("mailbox ID already in use")
+	}
+	owned := 0
+	for _, e := range m.entries {
+		if e.Owner == owner.String() && e.ID != id {
+			owned++
+		}
+	}
+	if owned >= maxMailboxesPerOwner || len(m.entries) >= maxMailboxes {
+		return ErrMailboxFull
+	}
+
+	m.entries[id] = &mailboxEntry{
+		ID:        id,
+		Owner:     owner.String(),
+		Intro:     append([]byte(nil), intro...),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	m.saveLocked()
+	return nil
+}
+
+// Intro returns the sealed introduction of an open (unredeemed) mailbox.
+func (m *Mailbox) Intro(id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok || e.Joiner != "" || time.Now().After(e.ExpiresAt) {
+		return nil, ErrMailboxNotFound
+	}
+	return e.Intro, nil
+}
+
+// Redeem records joiner's sealed reply. Each mailbox can be redeemed once;
+// the reply is then kept for invite.MailboxReplyTTL or until delivered.
+func (m *Mailbox) Redeem(id string, joiner peer.ID, reply []byte) (peer.ID, error) {
+	if len(reply) == 0 || len(reply) > maxMailboxBlob {
+		return "", fmt.Errorf("reply must be 1-%d bytes", maxMailboxBlob)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	now := time.Now()
+	if !ok || e.Joiner != "" || now.After(e.ExpiresAt) {
+		return "", ErrMailboxNotFound
+	}
+	owner, err := peer.Decode(e.Owner)
+	if err != nil {
+		return "", ErrMailboxNotFound
+	}
+	e.Joiner = joiner.String()
+	e.Reply = append([]byte(nil), reply...)
+	e.RedeemedAt = now
+	e.Intro = nil
+	e.ExpiresAt = now.Add(invite.MailboxReplyTTL)
+	m.saveLocked()
+	return owner, nil
+}
+
+// Cancel removes an owner's mailbox.
+func (m *Mailbox) Cancel(owner peer.ID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok || e.Owner != owner.String() {
+		return ErrMailboxNotFound
+	}
+	delete(m.entries, id)
+	m.saveLocked()
+	return nil
+}
+
+// Deliveries returns the redeemed mailboxes waiting for owner.
+func (m *Mailbox) Deliveries(owner peer.ID) []MailboxDelivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []MailboxDelivery
+	now := time.Now()
+	for _, e := range m.entries {
+		if e.Owner != owner.String() || e.Joiner == "" || now.After(e.ExpiresAt) {
+			continue
+		}
+		joiner, err := peer.Decode(e.Joiner)
+		if err != nil {
+			continue
+		}
+		out = append(out, MailboxDelivery{ID: e.ID, Joiner: joiner, Reply: e.Reply})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Delivered removes redeemed mailboxes the owner has acknowledged and
+// returns their joiners, keyed by mailbox ID.
+func (m *Mailbox) Delivered(owner peer.ID, ids []string) map[string]peer.ID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	joiners := make(map[string]peer.ID)
+	for _, id := range ids {
+		e, ok := m.entries[id]
+		if !ok || e.Owner != owner.String() || e.Joiner == "" {
+			continue
+		}
+		if joiner, err := peer.Decode(e.Joiner); err == nil {
+			joiners[id] = joiner
+		}
+		delete(m.entries, id)
+	}
+	if len(joiners) > 0 {
+		m.saveLocked()
+	}
+	return joiners
+}
+
+// OpenCount returns the number of unredeemed, unexpired introductions.
+// While it is non-zero the relay keeps enrollment open for joiners.
+func (m *Mailbox) OpenCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for _, e := range m.entries {
+		if e.Joiner == "" && now.Before(e.ExpiresAt) {
+			n++
+		}
+	}
+	return n
+}
+
+// CleanExpired removes expired mailboxes and returns how many were removed.
+func (m *Mailbox) CleanExpired() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := m.pruneLocked(time.Now())
+	if removed > 0 {
+		m.saveLocked()
+	}
+	return removed
+}
+
+func (m *Mailbox) pruneLocked(now time.Time) int {
+	removed := 0
+	for id, e := range m.entries {
+		if now.After(e.ExpiresAt) {
+			delete(m.entries, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// saveLocked persists the mailbox, logging on failure: the in-memory state
+// has already changed and the callers have no error path.
+func (m *Mailbox) saveLocked() {
+	if m.path == "" {
+		return
+	}
+	if err := m.writeLocked(); err != nil {
+		slog.Warn("failed to persist relay mailbox", "path", m.path, "err", err)
+	}
+}
+
+func (m *Mailbox) writeLocked() error {
+	file := mailboxFile{Version: mailboxFileVersion, Entries: []*mailboxEntry{}}
+	for _, e := range m.entries {
+		file.Entries = append(file.Entries, e)
+	}
+	sort.Slice(file.Entries, func(i, j int) bool { return file.Entries[i].ID < file.Entries[j].ID })
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mailbox: %w", err)
+	}
+
+	return writeFileAtomic(m.path, data)
+}
+
+// MailboxHandler handles the relay side of the mailbox protocol, next to
+// PairingHandler: authorized inviters deposit and cancel introductions,
+// and joiners (admitted through enrollment like pairing peers) redeem them.
+// Redeeming does not authorize the joiner; that waits until the inviter has
+// checked the reply (see DeliverMailbox).
+type MailboxHandler struct {
+	Mailbox      *Mailbox
+	AuthKeysPath string
+
+	// OnDeposit runs after an introduction is stored (e.g. to open enrollment).
+	OnDeposit func()
+	// OnRedeemed runs after a joiner redeemed an invite of owner.
+	OnRedeemed func(owner, joiner peer.ID)
+}
+
+// HandleStream processes one mailbox request.
+//
+// Wire format (client -> relay):
+//
+//	[1]  op (0x01 deposit, 0x02 redeem, 0x03 cancel)
+//	[16] mailbox ID
+//	deposit: [4 BE] TTL seconds + [2 BE] length + sealed introduction
+//	redeem:  relay answers with a status and the introduction, then the
+//	         joiner sends [2 BE] length + sealed reply
+//
+// Every answer starts with a status byte: StatusOK, or StatusErr followed
+// by a length-prefixed message.
+func (mh *MailboxHandler) HandleStream(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(30 * time.Second))
+	remotePeer := s.Conn().RemotePeer()
+	short := remotePeer.String()[:16] + "..."
+
+	var hdr [1 + invite.MailboxIDSize]byte
+	if _, err := io.ReadFull(s, hdr[:]); err != nil {
+		slog.Warn("mailbox: failed to read request", "peer", short, "err", err)
+		return
+	}
+	op := hdr[0]
+	id := hex.EncodeToString(hdr[1:])
+
+	switch op {
+	case mailboxOpDeposit:
+		if !mh.isAuthorized(remotePeer) {
+			slog.Warn("mailbox: deposit from unauthorized peer", "peer", short)
+			writeMailboxStatus(s, fmt.Errorf("not authorized"))
+			return
+		}
+		var ttl [4]byte
+		if _, err := io.ReadFull(s, ttl[:]); err != nil {
+			return
+		}
+		intro, err := readMailboxBlob(s)
+		if err != nil {
+			writeMailboxStatus(s, err)
+			return
+		}
+		err = mh.Mailbox.Deposit(remotePeer, id, intro, time.Duration(binary.BigEndian.Uint32(ttl[:]))*time.Second)
+		writeMailboxStatus(s, err)
+		if err != nil {
+			slog.Warn("mailbox: deposit refused", "peer", short, "err", err)
+			return
+		}
+		slog.Info("mailbox: introduction deposited", "peer", short, "mailbox", id[:8])
+		if mh.OnDeposit != nil {
+			mh.OnDeposit()
+		}
+
+	case mailboxOpCancel:
+		err := mh.Mailbox.Cancel(remotePeer, id)
+		writeMailboxStatus(s, err)
+		if err == nil {
+			slog.Info("mailbox: invite cancelled", "peer", short, "mailbox", id[:8])
+		}
+
+	case mailboxOpRedeem:
+		intro, err := mh.Mailbox.Intro(id)
+		if err != nil {
+			slog.Warn("mailbox: redeem of unknown invite", "peer", short)
+			writeMailboxStatus(s, err)
+			return
+		}
+		if err := writeMailboxStatus(s, nil); err != nil {
+			return
+		}
+		if err := writeMailboxBlob(s, intro); err != nil {
+			return
+		}
+		reply, err := readMailboxBlob(s)
+		if err != nil {
+			writeMailboxStatus(s, err)
+			return
+		}
+		owner, err := mh.Mailbox.Redeem(id, remotePeer, reply)
+		writeMailboxStatus(s, err)
+		if err != nil {
+			return
+		}
+		slog.Info("mailbox: invite redeemed", "joiner", short, "owner", owner.String()[:16]+"...", "mailbox", id[:8])
+		if mh.OnRedeemed != nil {
+			mh.OnRedeemed(owner, remotePeer)
+		}
+
+	default:
+		slog.Warn("mailbox: unknown op", "peer", short, "op", op)
+	}
+}
+
+func (mh *MailboxHandler) isAuthorized(p peer.ID) bool {
+	if mh.AuthKeysPath == "" {
+		return false
+	}
+	peers, err := auth.LoadAuthorizedKeys(mh.AuthKeysPath)
+	return err == nil && peers[p]
+}
+
+// DeliverMailbox pushes redeemed invites to their inviter and forgets the
+// ones it acknowledges. Extends the notifier's post office role: replies
+// wait at the relay until the inviter's daemon is connected. Joiners the
+// inviter accepted are then authorized here, tagged invited_by=<inviter>.
+//
+// Wire format (relay -> inviter):
+//
+//	[1] op (0x10)
+//	[1] count
+//	per invite: [16] mailbox ID + [1] joiner ID length + [N] joiner ID + [2 BE] length + sealed reply
+//
+// The inviter answers [1] count + per handled invite [16] ID + [1] verdict
+// (StatusOK accepted, StatusErr rejected).
+func (pn *PeerNotifier) DeliverMailbox(ctx context.Context, owner peer.ID) error {
+	if pn.Mailbox == nil {
+		return nil
+	}
+	deliveries := pn.Mailbox.Deliveries(owner)
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if len(deliveries) > 255 {
+		deliveries = deliveries[:255]
+	}
+
+	streamCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	streamCtx = network.WithAllowLimitedConn(streamCtx, MailboxProtocol)
+	s, err := pn.Host.NewStream(streamCtx, owner, protocol.ID(MailboxProtocol))
+	if err != nil {
+		return fmt.Errorf("failed to open stream to %s: %w", owner.String()[:16], err)
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(30 * time.Second))
+
+	buf := []byte{mailboxOpDeliver, byte(len(deliveries))}
+	for _, d := range deliveries {
+		id, _ := hex.DecodeString(d.ID)
+		buf = append(buf, id...)
+		buf = append(buf, byte(len(d.Joiner)))
+		buf = append(buf, d.Joiner...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(d.Reply)))
+		buf = append(buf, d.Reply...)
+	}
+	if _, err := s.Write(buf); err != nil {
+		return fmt.Errorf("failed to write deliveries: %w", err)
+	}
+	s.CloseWrite()
+
+	var count [1]byte
+	if _, err := io.ReadFull(s, count[:]); err != nil {
+		return fmt.Errorf("failed to read acknowledgement: %w", err)
+	}
+	acked := make([]string, 0, count[0])
+	accepted := make(map[string]bool)
+	for i := 0; i < int(count[0]); i++ {
+		var ack [invite.MailboxIDSize + 1]byte
+		if _, err := io.ReadFull(s, ack[:]); err != nil {
+			return fmt.Errorf("failed to read acknowledgement: %w", err)
+		}
+		id := hex.EncodeToString(ack[:invite.MailboxIDSize])
+		acked = append(acked, id)
+		accepted[id] = ack[invite.MailboxIDSize] == StatusOK
+	}
+
+	authorized := 0
+	for id, joiner := range pn.Mailbox.Delivered(owner, acked) {
+		if !accepted[id] {
+			continue
+		}
+		if err := authorizeInvitee(pn.AuthKeysPath, joiner, owner); err != nil {
+			slog.Error("mailbox: failed to authorize joiner", "peer", joiner.String()[:16]+"...", "err", err)
+			continue
+		}
+		authorized++
+		if pn.OnInviteAccepted != nil {
+			pn.OnInviteAccepted(owner, joiner)
+		}
+	}
+
+	slog.Info("mailbox: delivered redeemed invites",
+		"owner", owner.String()[:16]+"...", "count", len(deliveries), "acked", len(acked), "authorized", authorized)
+	return nil
+}
+
+// authorizeInvitee adds a joiner the inviter accepted to authorized_keys.
+// The invited_by attribute records who vouched for it.
+func authorizeInvitee(authKeysPath string, joiner, owner peer.ID) error {
+	if authKeysPath == "" {
+		return nil
+	}
+	comment := "invited-" + time.Now().Format("2006-01-02")
+	if err := auth.AddPeer(authKeysPath, joiner.String(), comment); err != nil && !errors.Is(err, auth.ErrPeerAlreadyAuthorized) {
+		return err
+	}
+	return auth.SetPeerAttr(authKeysPath, joiner.String(), "invited_by", owner.String())
+}
+
+// ReadMailboxDelivery reads the relay's delivery of redeemed invites on the
+// inviter's side of a mailbox stream.
+func ReadMailboxDelivery(r io.Reader) ([]MailboxDelivery, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("failed to read delivery header: %w", err)
+	}
+	if hdr[0] != mailboxOpDeliver {
+		return nil, fmt.Errorf("unexpected mailbox op 0x%02x", hdr[0])
+	}
+	out := make([]MailboxDelivery, 0, hdr[1])
+	for i := 0; i < int(hdr[1]); i++ {
+		var id [invite.MailboxIDSize]byte
+		if _, err := io.ReadFull(r, id[:]); err != nil {
+			return nil, fmt.Errorf("truncated delivery %d: %w", i, err)
+		}
+		var pidLen [1]byte
+		if _, err := io.ReadFull(r, pidLen[:]); err != nil {
+			return nil, fmt.Errorf("truncated delivery %d: %w", i, err)
+		}
+		pid := make([]byte, pidLen[0])
+		if _, err := io.ReadFull(r, pid); err != nil {
+			return nil, fmt.Errorf("truncated delivery %d: %w", i, err)
+		}
+		joiner := peer.ID(pid)
+		if err := joiner.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid joiner in delivery %d: %w", i, err)
+		}
+		reply, err := readMailboxBlob(r)
+		if err != nil {
+			return nil, fmt.Errorf("delivery %d: %w", i, err)
+		}
+		out = append(out, MailboxDelivery{ID: hex.EncodeToString(id[:]), Joiner: joiner, Reply: reply})
+	}
+	return out, nil
+}
+
+// WriteMailboxAck acknowledges handled deliveries so the relay forgets them.
+// acks maps each handled mailbox ID to whether the joiner was accepted.
+func WriteMailboxAck(w io.Writer, acks map[string]bool) error {
+	ids := make([]string, 0, len(acks))
+	for id := range acks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) > 255 {
+		ids = ids[:255]
+	}
+	buf := []byte{byte(len(ids))}
+	for _, id := range ids {
+		raw, err := hex.DecodeString(id)
+		if err != nil || len(raw) != invite.MailboxIDSize {
+			return fmt.Errorf("invalid mailbox ID %q", id)
+		}
+		verdict := StatusErr
+		if acks[id] {
+			verdict = StatusOK
+		}
+		buf = append(buf, raw...)
+		buf = append(buf, verdict)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// DepositMailbox leaves a sealed introduction at relayID for ttl.
+func DepositMailbox(ctx context.Context, h host.Host, relayID peer.ID, id [invite.MailboxIDSize]byte, intro []byte, ttl time.Duration) error {
+	s, err := openMailboxStream(ctx, h, relayID, mailboxOpDeposit, id)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	buf := binary.BigEndian.AppendUint32(nil, uint32(ttl/time.Second))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(intro)))
+	buf = append(buf, intro...)
+	if _, err := s.Write(buf); err != nil {
+		return fmt.Errorf("failed to send introduction: %w", err)
+	}
+	return readMailboxStatus(s)
+}
+
+// CancelMailbox removes an unredeemed introduction from relayID.
+func CancelMailbox(ctx context.Context, h host.Host, relayID peer.ID, id [invite.MailboxIDSize]byte) error {
+	s, err := openMailboxStream(ctx, h, relayID, mailboxOpCancel, id)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return readMailboxStatus(s)
+}
+
+// RedeemMailbox fetches the sealed introduction from relayID and answers it
+// with the reply built by makeReply.
+func RedeemMailbox(ctx context.Context, h host.Host, relayID peer.ID, id [invite.MailboxIDSize]byte, makeReply func(intro []byte) ([]byte, error)) error {
+	s, err := openMailboxStream(ctx, h, relayID, mailboxOpRedeem, id)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := readMailboxStatus(s); err != nil {
+		return err
+	}
+	intro, err := readMailboxBlob(s)
+	if err != nil {
+		return err
+	}
+	reply, err := makeReply(intro)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Write(binary.BigEndian.AppendUint16(nil, uint16(len(reply)))); err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	if _, err := s.Write(reply); err != nil {
+		return fmt.Errorf("failed to send reply: %w", err)
+	}
+	return readMailboxStatus(s)
+}
+
+func openMailboxStream(ctx context.Context, h host.Host, relayID peer.ID, op byte, id [invite.MailboxIDSize]byte) (network.Stream, error) {
+	ctx = network.WithAllowLimitedConn(ctx, MailboxProtocol)
+	s, err := h.NewStream(ctx, relayID, protocol.ID(MailboxProtocol))
+	if err != nil {
+		return nil, fmt.Errorf("relay does not accept invites: %w", err)
+	}
+	s.SetDeadline(time.Now().Add(30 * time.Second))
+	if _, err := s.Write(append([]byte{op}, id[:]...)); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return s, nil
+}
+
+// writeMailboxStatus sends StatusOK, or StatusErr with err's message.
+func writeMailboxStatus(w io.Writer, err error) error {
+	if err == nil {
+		_, werr := w.Write([]byte{StatusOK})
+		return werr
+	}
+	msg := err.Error()
+	if len(msg) > 255 {
+		msg = msg[:255]
+	}
+	_, werr := w.Write(append([]byte{StatusErr, byte(len(msg))}, msg...))
+	return werr
+}
+
+// readMailboxStatus reads a status written by writeMailboxStatus.
+func readMailboxStatus(r io.Reader) error {
+	var status [1]byte
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return fmt.Errorf("failed to read status: %w", err)
+	}
+	switch status[0] {
+	case StatusOK:
+		return nil
+	case StatusErr:
+		var msgLen [1]byte
+		if _, err := io.ReadFull(r, msgLen[:]); err != nil {
+			return fmt.Errorf("mailbox request failed")
+		}
+		msg := make([]byte, msgLen[0])
+		io.ReadFull(r, msg)
+		if string(msg) == ErrMailboxNotFound.Error() {
+			return ErrMailboxNotFound
+		}
+		return fmt.Errorf("%s", msg)
+	default:
+		return fmt.Errorf("unexpected status: 0x%02x", status[0])
+	}
+}
+
+func readMailboxBlob(r io.Reader) ([]byte, error) {
+	var n [2]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, fmt.Errorf("failed to read length: %w", err)
+	}
+	size := int(binary.BigEndian.Uint16(n[:]))
+	if size == 0 || size > maxMailboxBlob {
+		return nil, fmt.Errorf("mailbox message must be 1-%d bytes", maxMailboxBlob)
+	}
+	blob := make([]byte, size)
+	if _, err := io.ReadFull(r, blob); err != nil {
+		return nil, fmt.Errorf("failed to read mailbox message: %w", err)
+	}
+	return blob, nil
+}
+
+func writeMailboxBlob(w io.Writer, blob []byte) error {
+	_, err := w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(blob))), blob...))
+	return err
+}
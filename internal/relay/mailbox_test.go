@@ -0,0 +1,301 @@
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+	"github.com/satindergrewal/peer-up/internal/invite"
+)
+
+func TestMailboxStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), MailboxFileName)
+	m, err := NewMailbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	owner, joiner := genPeerID(t), genPeerID(t)
+
+	if err := m.Deposit(owner, "aa", []byte("intro"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Deposit(genPeerID(t), "aa", []byte("other"), time.Hour); err == nil {
+		t.Error("another peer took over an existing mailbox")
+	}
+	if m.OpenCount() != 1 {
+		t.Errorf("OpenCount() = %d, want 1", m.OpenCount())
+	}
+	if intro, err := m.Intro("aa"); err != nil || string(intro) != "intro" {
+		t.Errorf("Intro() = %q, %v", intro, err)
+	}
+
+	got, err := m.Redeem("aa", joiner, []byte("reply"))
+	if err != nil || got != owner {
+		t.Fatalf("Redeem() = %s, %v", got, err)
+	}
+	if _, err := m.Redeem("aa", genPeerID(t), []byte("again")); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("second Redeem() error = %v, want ErrMailboxNotFound", err)
+	}
+	if _, err := m.Intro("aa"); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("Intro() after redeem error = %v, want ErrMailboxNotFound", err)
+	}
+	if m.OpenCount() != 0 {
+		t.Errorf("OpenCount() after redeem = %d, want 0", m.OpenCount())
+	}
+
+	// Replies survive a restart until the owner acknowledges them.
+	reloaded, err := NewMailbox(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := reloaded.Deliveries(owner)
+	if len(d) != 1 || d[0].ID != "aa" || d[0].Joiner != joiner || string(d[0].Reply) != "reply" {
+		t.Fatalf("Deliveries() = %+v", d)
+	}
+	if len(reloaded.Deliveries(joiner)) != 0 {
+		t.Error("deliveries offered to a peer that does not own them")
+	}
+	reloaded.Delivered(genPeerID(t), []string{"aa"})
+	if len(reloaded.Deliveries(owner)) != 1 {
+		t.Error("another peer acknowledged the owner's delivery")
+	}
+	if got := reloaded.Delivered(owner, []string{"aa"}); got["aa"] != joiner {
+		t.Errorf("Delivered() = %v, want the joiner", got)
+	}
+	if len(reloaded.Deliveries(owner)) != 0 {
+		t.Error("acknowledged delivery still pending")
+	}
+
+	// Only the owner cancels.
+	m.Deposit(owner, "bb", []byte("intro"), time.Hour)
+	if err := m.Cancel(joiner, "bb"); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("Cancel() by another peer error = %v", err)
+	}
+	if err := m.Cancel(owner, "bb"); err != nil {
+		t.Errorf("Cancel() error = %v", err)
+	}
+}
+
+func TestMailboxLimits(t *testing.T) {
+	m, _ := NewMailbox("")
+	owner := genPeerID(t)
+
+	if err := m.Deposit(owner, "big", make([]byte, maxMailboxBlob+1), time.Hour); err == nil {
+		t.Error("accepted an oversized introduction")
+	}
+	for i := range maxMailboxesPerOwner {
+		if err := m.Deposit(owner, hex.EncodeToString([]byte{byte(i)}), []byte("x"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Deposit(owner, "ff00", []byte("x"), time.Hour); !errors.Is(err, ErrMailboxFull) {
+		t.Errorf("Deposit() over the per-owner limit error = %v, want ErrMailboxFull", err)
+	}
+
+	// TTLs are capped, and expired entries are cleaned up.
+	m.Deposit(genPeerID(t), "long", []byte("x"), 30*24*time.Hour)
+	m.mu.Lock()
+	if until := time.Until(m.entries["long"].ExpiresAt); until > MaxMailboxTTL {
+		t.Errorf("TTL not capped: %v", until)
+	}
+	m.entries["long"].ExpiresAt = time.Now().Add(-time.Second)
+	m.mu.Unlock()
+	if removed := m.CleanExpired(); removed != 1 {
+		t.Errorf("CleanExpired() = %d, want 1", removed)
+	}
+}
+
+// TestMailboxProtocol runs an asynchronous invite through a relay: the
+// inviter deposits and goes away, the joiner redeems, and the reply is
+// delivered when the inviter's daemon is back.
+func TestMailboxProtocol(t *testing.T) {
+	relayHost, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relayHost.Close()
+	inviter, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inviter.Close()
+	joiner, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer joiner.Close()
+
+	keysPath := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := auth.AddPeer(keysPath, inviter.ID().String(), "home"); err != nil {
+		t.Fatal(err)
+	}
+	mailbox, _ := NewMailbox("")
+	redeemed := make(chan peer.ID, 1)
+	handler := &MailboxHandler{
+		Mailbox:      mailbox,
+		AuthKeysPath: keysPath,
+		OnRedeemed:   func(owner, _ peer.ID) { redeemed <- owner },
+	}
+	relayHost.SetStreamHandler(protocol.ID(MailboxProtocol), handler.HandleStream)
+	relayInfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, h := range []host.Host{inviter, joiner} {
+		if err := h.Connect(ctx, relayInfo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, _ := invite.GenerateMailboxToken()
+	priv, pub, _ := invite.GenerateMailboxKey()
+	id := invite.MailboxID(token)
+	sealed, err := invite.SealIntro(token, &invite.MailboxIntro{PeerID: inviter.ID(), Name: "home", PublicKey: pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only authorized peers deposit.
+	if err := DepositMailbox(ctx, joiner, relayHost.ID(), id, sealed, time.Hour); err == nil {
+		t.Error("unauthorized peer deposited an introduction")
+	}
+	if err := DepositMailbox(ctx, inviter, relayHost.ID(), id, sealed, time.Hour); err != nil {
+		t.Fatalf("DepositMailbox() error = %v", err)
+	}
+
+	// The joiner redeems while the inviter is away.
+	relayHost.Network().ClosePeer(inviter.ID())
+	err = RedeemMailbox(ctx, joiner, relayHost.ID(), id, func(blob []byte) ([]byte, error) {
+		intro, err := invite.OpenIntro(token, blob)
+		if err != nil {
+			return nil, err
+		}
+		return invite.SealReply(token, intro.PublicKey, &invite.MailboxReply{PeerID: joiner.ID(), Name: "laptop"})
+	})
+	if err != nil {
+		t.Fatalf("RedeemMailbox() error = %v", err)
+	}
+	if owner := <-redeemed; owner != inviter.ID() {
+		t.Errorf("OnRedeemed owner = %s", owner)
+	}
+	if peers, _ := auth.LoadAuthorizedKeys(keysPath); peers[joiner.ID()] {
+		t.Error("joiner authorized before the inviter accepted it")
+	}
+	if err := RedeemMailbox(ctx, joiner, relayHost.ID(), id, nil); !errors.Is(err, ErrMailboxNotFound) {
+		t.Errorf("second RedeemMailbox() error = %v, want ErrMailboxNotFound", err)
+	}
+
+	// The inviter comes back and receives the reply.
+	got := make(chan *invite.MailboxReply, 1)
+	inviter.SetStreamHandler(protocol.ID(MailboxProtocol), func(s network.Stream) {
+		defer s.Close()
+		deliveries, err := ReadMailboxDelivery(s)
+		if err != nil || len(deliveries) != 1 {
+			t.Errorf("ReadMailboxDelivery() = %v, %v", deliveries, err)
+			return
+		}
+		reply, err := invite.OpenReply(token, priv, deliveries[0].Reply)
+		if err != nil {
+			t.Errorf("OpenReply() error = %v", err)
+			return
+		}
+		WriteMailboxAck(s, map[string]bool{deliveries[0].ID: true})
+		got <- reply
+	})
+	if err := inviter.Connect(ctx, relayInfo); err != nil {
+		t.Fatal(err)
+	}
+	var accepted peer.ID
+	notifier := &PeerNotifier{
+		Host:             relayHost,
+		AuthKeysPath:     keysPath,
+		Mailbox:          mailbox,
+		OnInviteAccepted: func(_, joiner peer.ID) { accepted = joiner },
+	}
+	if err := notifier.DeliverMailbox(ctx, inviter.ID()); err != nil {
+		t.Fatalf("DeliverMailbox() error = %v", err)
+	}
+	reply := <-got
+	if reply.PeerID != joiner.ID() || reply.Name != "laptop" {
+		t.Errorf("reply = %+v", reply)
+	}
+	if len(mailbox.Deliveries(inviter.ID())) != 0 {
+		t.Error("acknowledged delivery still pending at the relay")
+	}
+	if accepted != joiner.ID() {
+		t.Errorf("OnInviteAccepted joiner = %s", accepted)
+	}
+	entries, _ := auth.ListPeers(keysPath)
+	authorized := false
+	for _, e := range entries {
+		if e.PeerID == joiner.ID() {
+			authorized = true
+		}
+	}
+	if !authorized {
+		t.Error("accepted joiner not authorized on the relay")
+	}
+}
+
+// TestMailboxRejectedReply checks that a reply the inviter rejects is
+// dropped without authorizing the joiner.
+func TestMailboxRejectedReply(t *testing.T) {
+	relayHost, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relayHost.Close()
+	inviter, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inviter.Close()
+
+	keysPath := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := auth.AddPeer(keysPath, inviter.ID().String(), "home"); err != nil {
+		t.Fatal(err)
+	}
+	mailbox, _ := NewMailbox("")
+	joiner := genPeerID(t)
+	id := strings.Repeat("ab", invite.MailboxIDSize)
+	mailbox.Deposit(inviter.ID(), id, []byte("intro"), time.Hour)
+	if _, err := mailbox.Redeem(id, joiner, []byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+
+	inviter.SetStreamHandler(protocol.ID(MailboxProtocol), func(s network.Stream) {
+		defer s.Close()
+		deliveries, err := ReadMailboxDelivery(s)
+		if err != nil || len(deliveries) != 1 {
+			t.Errorf("ReadMailboxDelivery() = %v, %v", deliveries, err)
+			return
+		}
+		WriteMailboxAck(s, map[string]bool{deliveries[0].ID: false})
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := inviter.Connect(ctx, peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	notifier := &PeerNotifier{Host: relayHost, AuthKeysPath: keysPath, Mailbox: mailbox}
+	if err := notifier.DeliverMailbox(ctx, inviter.ID()); err != nil {
+		t.Fatalf("DeliverMailbox() error = %v", err)
+	}
+	if len(mailbox.Deliveries(inviter.ID())) != 0 {
+		t.Error("rejected delivery still pending at the relay")
+	}
+	if peers, _ := auth.LoadAuthorizedKeys(keysPath); peers[joiner] {
+		t.Error("rejected joiner authorized on the relay")
+	}
+}
@@ -31,7 +31,13 @@ const notifyVersion byte = 0x01
 type PeerNotifier struct {
 	Host         host.Host
 	AuthKeysPath string
-	Store        *TokenStore // for HMAC proofs
+	Store        TokenStore        // for HMAC proofs
+	Revocations  *RevocationGossip // nil = don't replay revocations
+	Mailbox      *Mailbox          // nil = no asynchronous invites to deliver
+
+	// OnInviteAccepted runs after an inviter accepted an asynchronous invite
+	// and the joiner was authorized here (e.g. to reload the gater).
+	OnInviteAccepted func(owner, joiner peer.ID)
 }
 
 // NotifyPeer delivers peer introductions to a single target peer.
@@ -263,7 +269,8 @@ func ReadPeerNotify(r io.Reader) (peers []NotifyPeerInfo, groupID string, groupS
 }
 
 // RunReconnectNotifier subscribes to peer identification events and pushes
-// introductions when an authorized peer with a group attribute reconnects.
+// introductions (and any stored revocations for the group) when an
+// authorized peer with a group attribute reconnects.
 // Uses EvtPeerIdentificationCompleted (not EvtPeerConnectednessChanged) so
 // the peer's supported protocols are known before opening a stream.
 func RunReconnectNotifier(ctx context.Context, h host.Host, notifier *PeerNotifier, authKeysPath string) {
@@ -306,6 +313,18 @@ func RunReconnectNotifier(ctx context.Context, h host.Host, notifier *PeerNotifi
 				continue
 			}
 
+			// Redeemed asynchronous invites wait here for their inviter,
+			// who need not belong to a pairing group.
+			if notifier.Mailbox != nil && len(notifier.Mailbox.Deliveries(e.Peer)) > 0 {
+				recentlyNotified[e.Peer] = time.Now()
+				go func(pid peer.ID) {
+					if err := notifier.DeliverMailbox(ctx, pid); err != nil {
+						slog.Warn("reconnect-notifier: mailbox delivery failed",
+							"peer", pid.String()[:16]+"...", "err", err)
+					}
+				}(e.Peer)
+			}
+
 			// Look up identified peer in authorized_keys.
 			entries, err := auth.ListPeers(authKeysPath)
 			if err != nil {
@@ -320,6 +339,13 @@ func RunReconnectNotifier(ctx context.Context, h host.Host, notifier *PeerNotifi
 								"peer", pid.String()[:16]+"...",
 								"group", gid, "err", err)
 						}
+						if notifier.Revocations != nil {
+							if err := notifier.Revocations.SendStored(ctx, pid); err != nil {
+								slog.Warn("reconnect-notifier: revocation replay failed",
+									"peer", pid.String()[:16]+"...",
+									"group", gid, "err", err)
+							}
+						}
 					}(e.Peer, entry.Group)
 					break
 				}
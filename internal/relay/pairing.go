@@ -39,7 +39,7 @@ type WaitingStream struct {
 
 // PairingHandler handles the relay-side pairing protocol.
 type PairingHandler struct {
-	Store        *TokenStore
+	Store        TokenStore
 	AuthKeysPath string
 	Gater        GaterInterface
 }
@@ -0,0 +1,253 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+)
+
+// Protocol ID for revocation gossip between pairing group members.
+const RevocationProtocol = "/peerup/revocation/1.0.0"
+
+// Revocation wire limits.
+const (
+	maxRevocationsPerStream = 256
+	maxRevocationLineSize   = 4096
+	revocationSendTimeout   = 10 * time.Second
+)
+
+// WriteRevocations writes notices as newline-delimited JSON.
+func WriteRevocations(w io.Writer, revs []*auth.Revocation) error {
+	enc := json.NewEncoder(w)
+	for _, r := range revs {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to write revocation: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadRevocations reads newline-delimited JSON notices until EOF.
+func ReadRevocations(r io.Reader) ([]*auth.Revocation, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 1024), maxRevocationLineSize)
+
+	var revs []*auth.Revocation
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if len(revs) == maxRevocationsPerStream {
+			return revs, fmt.Errorf("more than %d revocations in one stream", maxRevocationsPerStream)
+		}
+		var rev auth.Revocation
+		if err := json.Unmarshal(sc.Bytes(), &rev); err != nil {
+			return revs, fmt.Errorf("%w: %w", auth.ErrInvalidRevocation, err)
+		}
+		revs = append(revs, &rev)
+	}
+	if err := sc.Err(); err != nil {
+		return revs, fmt.Errorf("failed to read revocations: %w", err)
+	}
+	return revs, nil
+}
+
+// SendRevocations opens a revocation stream to p and writes revs.
+func SendRevocations(ctx context.Context, h host.Host, p peer.ID, revs []*auth.Revocation) error {
+	ctx, cancel := context.WithTimeout(ctx, revocationSendTimeout)
+	defer cancel()
+
+	ctx = network.WithAllowLimitedConn(ctx, RevocationProtocol)
+	s, err := h.NewStream(ctx, p, protocol.ID(RevocationProtocol))
+	if err != nil {
+		return fmt.Errorf("failed to open stream to %s: %w", p.String()[:16], err)
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if err := WriteRevocations(s, revs); err != nil {
+		s.Reset()
+		return err
+	}
+	return nil
+}
+
+// RevocationGossip accepts, stores and forwards signed revocation notices
+// for pairing groups. Nodes and the relay run the same logic: a notice is
+// checked against the local authorized_keys, stored, applied, then passed
+// on to connected members of the group. Stored notices are replayed to
+// members as they reconnect, so nodes that were offline catch up. The
+// store doubles as the dedup set that stops the gossip.
+type RevocationGossip struct {
+	Host         host.Host
+	AuthKeysPath string
+	Store        *auth.RevocationStore
+
+	// OnApplied is called after a new notice is stored and the peer removed
+	// from authorized_keys (removed is false if it was not listed), before
+	// the revoked peer is disconnected. Used to reload the gater and record
+	// audit events. from is the local peer ID for locally issued notices.
+	OnApplied func(from peer.ID, r *auth.Revocation, removed bool)
+
+	// OnRejected is called for notices that fail verification or may not
+	// be applied here.
+	OnRejected func(from peer.ID, r *auth.Revocation, err error)
+}
+
+// HandleStream processes an inbound revocation stream.
+func (g *RevocationGossip) HandleStream(s network.Stream) {
+	defer s.Close()
+	from := s.Conn().RemotePeer()
+	s.SetDeadline(time.Now().Add(30 * time.Second))
+
+	revs, err := ReadRevocations(s)
+	if err != nil {
+		slog.Warn("revocation: read error", "peer", from.String()[:16]+"...", "err", err)
+	}
+	for _, r := range revs {
+		if added, err := g.Accept(from, r); err == nil && added {
+			go g.Forward(context.Background(), r, from)
+		}
+	}
+}
+
+// Accept verifies a notice received from peer from and, if it is new and
+// allowed here, stores and applies it. Returns true for newly applied
+// notices (which the caller should forward).
+func (g *RevocationGossip) Accept(from peer.ID, r *auth.Revocation) (bool, error) {
+	added, removed, err := g.Store.Apply(g.AuthKeysPath, r, g.Host.ID(), time.Now())
+	if err != nil {
+		if g.OnRejected != nil && (errors.Is(err, auth.ErrInvalidRevocation) || errors.Is(err, auth.ErrRevocationNotAllowed)) {
+			g.OnRejected(from, r, err)
+		}
+		return false, err
+	}
+	if !added {
+		return false, nil
+	}
+	if g.OnApplied != nil {
+		g.OnApplied(from, r, removed)
+	}
+	if revoked, err := peer.Decode(r.PeerID); err == nil {
+		g.Host.Network().ClosePeer(revoked)
+	}
+	return true, nil
+}
+
+// Issue applies a notice signed by this node and sends it to the connected
+// members of its group. Returns whether the peer was removed locally and
+// the peers the notice was delivered to.
+func (g *RevocationGossip) Issue(ctx context.Context, r *auth.Revocation) (removed bool, delivered []peer.ID, err error) {
+	entries, err := auth.ListPeers(g.AuthKeysPath)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to read authorized_keys: %w", err)
+	}
+	for _, e := range entries {
+		if e.PeerID.String() == r.PeerID {
+			removed = true
+			break
+		}
+	}
+	if _, err := g.Accept(g.Host.ID(), r); err != nil {
+		return false, nil, err
+	}
+	return removed, g.Forward(ctx, r, ""), nil
+}
+
+// Forward sends r to every connected member of its group except exclude
+// and the revoked peer. Returns the peers it was delivered to.
+func (g *RevocationGossip) Forward(ctx context.Context, r *auth.Revocation, exclude peer.ID) []peer.ID {
+	entries, err := auth.ListPeers(g.AuthKeysPath)
+	if err != nil {
+		slog.Error("revocation: failed to read authorized_keys", "err", err)
+		return nil
+	}
+
+	var delivered []peer.ID
+	for _, e := range entries {
+		if e.Group != r.Group || e.PeerID == exclude || e.PeerID.String() == r.PeerID {
+			continue
+		}
+		if g.Host.Network().Connectedness(e.PeerID) != network.Connected {
+			continue
+		}
+		if err := SendRevocations(ctx, g.Host, e.PeerID, []*auth.Revocation{r}); err != nil {
+			slog.Debug("revocation: forward failed",
+				"target", e.PeerID.String()[:16]+"...", "err", err)
+			continue
+		}
+		delivered = append(delivered, e.PeerID)
+	}
+	return delivered
+}
+
+// SendStored replays stored notices for every group p belongs to, so a
+// member that was offline when they were issued catches up on reconnect.
+func (g *RevocationGossip) SendStored(ctx context.Context, p peer.ID) error {
+	entries, err := auth.ListPeers(g.AuthKeysPath)
+	if err != nil {
+		return fmt.Errorf("failed to read authorized_keys: %w", err)
+	}
+	var revs []*auth.Revocation
+	for _, e := range entries {
+		if e.PeerID != p || e.Group == "" {
+			continue
+		}
+		for _, r := range g.Store.ForGroup(e.Group) {
+			if r.PeerID != p.String() {
+				revs = append(revs, r)
+			}
+		}
+	}
+	if len(revs) == 0 {
+		return nil
+	}
+	if len(revs) > maxRevocationsPerStream {
+		revs = revs[len(revs)-maxRevocationsPerStream:]
+	}
+	return SendRevocations(ctx, g.Host, p, revs)
+}
+
+// Run replays stored notices to group members as they are identified.
+// Uses EvtPeerIdentificationCompleted so the peer's protocols are known.
+func (g *RevocationGossip) Run(ctx context.Context) {
+	sub, err := g.Host.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		slog.Error("revocation: subscribe failed", "err", err)
+		return
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			e := evt.(event.EvtPeerIdentificationCompleted)
+			go func(p peer.ID) {
+				if err := g.SendStored(ctx, p); err != nil {
+					slog.Debug("revocation: replay failed",
+						"peer", p.String()[:16]+"...", "err", err)
+				}
+			}(e.Peer)
+		}
+	}
+}
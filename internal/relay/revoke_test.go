@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+)
+
+func TestRevocationsWireRoundTrip(t *testing.T) {
+	key, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	_, targetPub, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	target, _ := peer.IDFromPublicKey(targetPub)
+	r1, _ := auth.NewRevocation(key, "g1", target, "lost", time.Now())
+	r2, _ := auth.NewRevocation(key, "g2", target, "", time.Now())
+
+	var buf bytes.Buffer
+	if err := WriteRevocations(&buf, []*auth.Revocation{r1, r2}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadRevocations(&buf)
+	if err != nil {
+		t.Fatalf("ReadRevocations() error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID() != r1.ID() || got[1].ID() != r2.ID() {
+		t.Fatalf("round trip mismatch: %+v", got)
+	}
+	if _, _, err := got[0].Verify(); err != nil {
+		t.Errorf("decoded notice does not verify: %v", err)
+	}
+
+	if _, err := ReadRevocations(strings.NewReader("{not json}\n")); err == nil {
+		t.Error("expected error for malformed line")
+	}
+}
+
+// gossipNode is a host running RevocationGossip over its own authorized_keys.
+type gossipNode struct {
+	host     host.Host
+	key      crypto.PrivKey
+	authPath string
+	gossip   *RevocationGossip
+}
+
+func newGossipNode(t *testing.T) *gossipNode {
+	t.Helper()
+	key, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	h, err := libp2p.New(libp2p.Identity(key), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	dir := t.TempDir()
+	authPath := filepath.Join(dir, "authorized_keys")
+	store, err := auth.OpenRevocationStore(auth.RevocationsPath(authPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &gossipNode{host: h, key: key, authPath: authPath}
+	n.gossip = &RevocationGossip{Host: h, AuthKeysPath: authPath, Store: store}
+	h.SetStreamHandler(protocol.ID(RevocationProtocol), n.gossip.HandleStream)
+	return n
+}
+
+func (n *gossipNode) authorize(t *testing.T, group string, peers ...peer.ID) {
+	t.Helper()
+	var b strings.Builder
+	for _, p := range peers {
+		b.WriteString(p.String() + "  group=" + group + "\n")
+	}
+	if err := os.WriteFile(n.authPath, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (n *gossipNode) connect(t *testing.T, other *gossipNode) {
+	t.Helper()
+	info := peer.AddrInfo{ID: other.host.ID(), Addrs: other.host.Addrs()}
+	if err := n.host.Connect(context.Background(), info); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitRevoked(t *testing.T, n *gossipNode, target peer.ID) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, _ := auth.ListPeers(n.authPath)
+		found := false
+		for _, e := range entries {
+			if e.PeerID == target {
+				found = true
+			}
+		}
+		if !found && n.gossip.Store.IsRevoked(target) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("%s still authorizes %s", n.host.ID().String()[:16], target.String()[:16])
+}
+
+func TestRevocationGossip(t *testing.T) {
+	a, b, c := newGossipNode(t), newGossipNode(t), newGossipNode(t)
+	_, targetPub, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	target, _ := peer.IDFromPublicKey(targetPub)
+
+	a.authorize(t, "g1", b.host.ID(), c.host.ID(), target)
+	b.authorize(t, "g1", a.host.ID(), c.host.ID(), target)
+	c.authorize(t, "g1", a.host.ID(), b.host.ID(), target)
+
+	// a - b - c: c only hears about the revocation through b.
+	a.connect(t, b)
+	b.connect(t, c)
+
+	r, err := auth.NewRevocation(a.key, "g1", target, "stolen", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, delivered, err := a.gossip.Issue(context.Background(), r)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if !removed {
+		t.Error("Issue() did not remove the peer locally")
+	}
+	if len(delivered) != 1 || delivered[0] != b.host.ID() {
+		t.Errorf("delivered = %v, want [b]", delivered)
+	}
+	waitRevoked(t, a, target)
+	waitRevoked(t, b, target)
+	waitRevoked(t, c, target)
+
+	t.Run("replayed to a member that was offline", func(t *testing.T) {
+		d := newGossipNode(t)
+		d.authorize(t, "g1", a.host.ID(), b.host.ID(), target)
+		b.authorize(t, "g1", a.host.ID(), c.host.ID(), d.host.ID())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go b.gossip.Run(ctx)
+		time.Sleep(50 * time.Millisecond) // let Run subscribe
+
+		d.connect(t, b)
+		waitRevoked(t, d, target)
+	})
+
+	t.Run("rejects notice from outside the group", func(t *testing.T) {
+		outsiderKey, _, _ := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+		bad, _ := auth.NewRevocation(outsiderKey, "g1", a.host.ID(), "", time.Now())
+		if _, err := b.gossip.Accept(c.host.ID(), bad); err == nil {
+			t.Fatal("expected rejection")
+		}
+		entries, _ := auth.ListPeers(b.authPath)
+		if len(entries) != 3 {
+			t.Errorf("authorized_keys changed: %d entries, want 3", len(entries))
+		}
+	})
+}
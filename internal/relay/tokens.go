@@ -66,23 +66,39 @@ type GroupInfo struct {
 	Peers     []PeerInfo
 }
 
-// TokenStore manages in-memory pairing tokens for the relay.
-// All tokens are lost on relay restart (by design).
-type TokenStore struct {
+// TokenStore manages pairing groups and their codes for the relay.
+// Implementations must be safe for concurrent use.
+type TokenStore interface {
+	CreateGroup(count int, ttl time.Duration, ns string, peerTTL time.Duration) (tokens [][]byte, groupID string, err error)
+	ValidateAndUse(token []byte, peerID peer.ID, name string) (*PairingGroup, int, error)
+	RecordFailedAttempt(token []byte)
+	SetHMACProof(groupID string, slotIdx int, proof []byte)
+	GetGroupPeers(groupID string, excludeIdx int) []PeerInfo
+	IsGroupComplete(groupID string) bool
+	GroupCount(groupID string) int
+	CleanExpired() int
+	List() []GroupInfo
+	ActiveGroupCount() int
+	Revoke(groupID string) error
+}
+
+// MemoryTokenStore keeps pairing tokens in memory only.
+// All tokens are lost on relay restart; use FileTokenStore to persist them.
+type MemoryTokenStore struct {
 	mu     sync.RWMutex
 	groups map[string]*PairingGroup
 }
 
-// NewTokenStore creates an empty token store.
-func NewTokenStore() *TokenStore {
-	return &TokenStore{
+// NewTokenStore creates an empty in-memory token store.
+func NewTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
 		groups: make(map[string]*PairingGroup),
 	}
 }
 
 // CreateGroup generates a pairing group with count codes.
 // Returns the raw tokens (caller encodes into invite codes) and the group ID.
-func (ts *TokenStore) CreateGroup(count int, ttl time.Duration, ns string, peerTTL time.Duration) (tokens [][]byte, groupID string, err error) {
+func (ts *MemoryTokenStore) CreateGroup(count int, ttl time.Duration, ns string, peerTTL time.Duration) (tokens [][]byte, groupID string, err error) {
 	if count < 1 {
 		return nil, "", fmt.Errorf("count must be at least 1")
 	}
@@ -125,7 +141,7 @@ func (ts *TokenStore) CreateGroup(count int, ttl time.Duration, ns string, peerT
 
 // ValidateAndUse atomically validates a token and marks it as used.
 // Returns the group and the slot index on success.
-func (ts *TokenStore) ValidateAndUse(token []byte, peerID peer.ID, name string) (*PairingGroup, int, error) {
+func (ts *MemoryTokenStore) ValidateAndUse(token []byte, peerID peer.ID, name string) (*PairingGroup, int, error) {
 	if len(token) != TokenSize {
 		return nil, -1, ErrTokenNotFound
 	}
@@ -176,9 +192,15 @@ func (ts *TokenStore) ValidateAndUse(token []byte, peerID peer.ID, name string)
 
 // RecordFailedAttempt increments the attempt counter for a token.
 // Used when authentication succeeds (token found) but downstream steps fail.
-func (ts *TokenStore) RecordFailedAttempt(token []byte) {
+func (ts *MemoryTokenStore) RecordFailedAttempt(token []byte) {
+	ts.recordFailedAttempt(token)
+}
+
+// recordFailedAttempt is RecordFailedAttempt, reporting whether a code slot
+// matched so callers persist only real changes.
+func (ts *MemoryTokenStore) recordFailedAttempt(token []byte) bool {
 	if len(token) != TokenSize {
-		return
+		return false
 	}
 
 	hash := sha256.Sum256(token)
@@ -192,15 +214,16 @@ func (ts *TokenStore) RecordFailedAttempt(token []byte) {
 			if subtle.ConstantTimeCompare(group.codes[i].TokenHash[:], hash[:]) == 1 {
 				group.codes[i].Attempts++
 				group.mu.Unlock()
-				return
+				return true
 			}
 		}
 		group.mu.Unlock()
 	}
+	return false
 }
 
 // SetHMACProof stores the HMAC commitment proof for a code slot.
-func (ts *TokenStore) SetHMACProof(groupID string, slotIdx int, proof []byte) {
+func (ts *MemoryTokenStore) SetHMACProof(groupID string, slotIdx int, proof []byte) {
 	ts.mu.RLock()
 	group, ok := ts.groups[groupID]
 	ts.mu.RUnlock()
@@ -215,7 +238,7 @@ func (ts *TokenStore) SetHMACProof(groupID string, slotIdx int, proof []byte) {
 }
 
 // GetGroupPeers returns all joined peers in the group except the one at excludeIdx.
-func (ts *TokenStore) GetGroupPeers(groupID string, excludeIdx int) []PeerInfo {
+func (ts *MemoryTokenStore) GetGroupPeers(groupID string, excludeIdx int) []PeerInfo {
 	ts.mu.RLock()
 	group, ok := ts.groups[groupID]
 	ts.mu.RUnlock()
@@ -242,7 +265,7 @@ func (ts *TokenStore) GetGroupPeers(groupID string, excludeIdx int) []PeerInfo {
 }
 
 // IsGroupComplete returns true if all codes in the group have been used.
-func (ts *TokenStore) IsGroupComplete(groupID string) bool {
+func (ts *MemoryTokenStore) IsGroupComplete(groupID string) bool {
 	ts.mu.RLock()
 	group, ok := ts.groups[groupID]
 	ts.mu.RUnlock()
@@ -263,7 +286,7 @@ func (ts *TokenStore) IsGroupComplete(groupID string) bool {
 }
 
 // GroupCount returns the total number of codes in a group.
-func (ts *TokenStore) GroupCount(groupID string) int {
+func (ts *MemoryTokenStore) GroupCount(groupID string) int {
 	ts.mu.RLock()
 	group, ok := ts.groups[groupID]
 	ts.mu.RUnlock()
@@ -279,7 +302,7 @@ func (ts *TokenStore) GroupCount(groupID string) int {
 }
 
 // CleanExpired removes all expired groups and returns how many were removed.
-func (ts *TokenStore) CleanExpired() int {
+func (ts *MemoryTokenStore) CleanExpired() int {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
@@ -295,7 +318,7 @@ func (ts *TokenStore) CleanExpired() int {
 }
 
 // List returns a snapshot of all groups (active and expired).
-func (ts *TokenStore) List() []GroupInfo {
+func (ts *MemoryTokenStore) List() []GroupInfo {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
 
@@ -325,7 +348,7 @@ func (ts *TokenStore) List() []GroupInfo {
 }
 
 // ActiveGroupCount returns the number of non-expired groups.
-func (ts *TokenStore) ActiveGroupCount() int {
+func (ts *MemoryTokenStore) ActiveGroupCount() int {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
 
@@ -340,7 +363,7 @@ func (ts *TokenStore) ActiveGroupCount() int {
 }
 
 // Revoke removes a pairing group by ID.
-func (ts *TokenStore) Revoke(groupID string) error {
+func (ts *MemoryTokenStore) Revoke(groupID string) error {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
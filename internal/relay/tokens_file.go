@@ -0,0 +1,373 @@
+package relay
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TokenStoreFileName is the pairing state file kept next to the relay config.
+const TokenStoreFileName = "relay_pairing.json"
+
+// tokenStoreFileVersion is bumped when the on-disk format changes incompatibly.
+const tokenStoreFileVersion = 1
+
+// tokenStoreFile is the on-disk representation of a FileTokenStore.
+// Only token hashes are stored - raw tokens never touch disk.
+type tokenStoreFile struct {
+	Version int              `json:"version"`
+	Groups  []persistedGroup `json:"groups"`
+}
+
+type persistedGroup struct {
+	ID        string          `json:"id"`
+	Namespace string          `json:"namespace,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	PeerTTL   string          `json:"peer_ttl,omitempty"`
+	Slots     []persistedSlot `json:"slots"`
+}
+
+type persistedSlot struct {
+	TokenHash string    `json:"token_hash"` // hex SHA-256
+	Attempts  int       `json:"attempts,omitempty"`
+	PeerID    string    `json:"peer_id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	UsedAt    time.Time `json:"used_at,omitzero"`
+	HMACProof []byte    `json:"hmac_proof,omitempty"`
+}
+
+// FileTokenStore is a TokenStore that persists pairing groups to disk so
+// outstanding codes and joined slots survive a relay restart. Every mutation
+// rewrites the file atomically (temp file + rename).
+type FileTokenStore struct {
+	*MemoryTokenStore
+	path   string
+	saveMu sync.Mutex // serializes writes to path
+}
+
+var _ TokenStore = (*FileTokenStore)(nil)
+
+// NewFileTokenStore loads the token store at path, pruning expired groups.
+// A missing file yields an empty store; the file is created on first change.
+func NewFileTokenStore(path string) (*FileTokenStore, error) {
+	fts := &FileTokenStore{
+		MemoryTokenStore: NewTokenStore(),
+		path:             path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fts, nil
+		}
+		return nil, fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	var file tokenStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse token store %s: %w", path, err)
+	}
+	if file.Version != tokenStoreFileVersion {
+		return nil, fmt.Errorf("unsupported token store version %d in %s", file.Version, path)
+	}
+
+	now := time.Now()
+	pruned := 0
+	for _, pg := range file.Groups {
+		if now.After(pg.ExpiresAt) {
+			pruned++
+			continue
+		}
+		group, err := pg.toGroup()
+		if err != nil {
+			return nil, fmt.Errorf("token store group %s: %w", pg.ID, err)
+		}
+		fts.groups[group.ID] = group
+	}
+
+	if pruned > 0 {
+		slog.Info("pruned expired pairing groups", "removed", pruned)
+		if err := fts.save(); err != nil {
+			return nil, err
+		}
+	}
+	return fts, nil
+}
+
+// CreateGroup generates a pairing group and persists it.
+func (fts *FileTokenStore) CreateGroup(count int, ttl time.Duration, ns string, peerTTL time.Duration) ([][]byte, string, error) {
+	tokens, groupID, err := fts.MemoryTokenStore.CreateGroup(count, ttl, ns, peerTTL)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := fts.save(); err != nil {
+		// Codes that would vanish on restart are worse than no codes.
+		fts.MemoryTokenStore.Revoke(groupID)
+		return nil, "", err
+	}
+	return tokens, groupID, nil
+}
+
+// ValidateAndUse validates a token, marks it as used and persists the slot.
+func (fts *FileTokenStore) ValidateAndUse(token []byte, peerID peer.ID, name string) (*PairingGroup, int, error) {
+	group, idx, err := fts.MemoryTokenStore.ValidateAndUse(token, peerID, name)
+	if err == nil {
+		fts.saveOrWarn()
+	}
+	return group, idx, err
+}
+
+// RecordFailedAttempt increments the attempt counter for a token and
+// persists it. Unknown tokens change nothing and skip the write.
+func (fts *FileTokenStore) RecordFailedAttempt(token []byte) {
+	if fts.MemoryTokenStore.recordFailedAttempt(token) {
+		fts.saveOrWarn()
+	}
+}
+
+// SetHMACProof stores the HMAC commitment proof for a code slot and persists it.
+func (fts *FileTokenStore) SetHMACProof(groupID string, slotIdx int, proof []byte) {
+	fts.MemoryTokenStore.SetHMACProof(groupID, slotIdx, proof)
+	fts.saveOrWarn()
+}
+
+// CleanExpired removes expired groups and persists the result if anything changed.
+func (fts *FileTokenStore) CleanExpired() int {
+	removed := fts.MemoryTokenStore.CleanExpired()
+	if removed > 0 {
+		fts.saveOrWarn()
+	}
+	return removed
+}
+
+// Revoke removes a pairing group by ID and persists the result.
+func (fts *FileTokenStore) Revoke(groupID string) error {
+	if err := fts.MemoryTokenStore.Revoke(groupID); err != nil {
+		return err
+	}
+	return fts.save()
+}
+
+// mergeGroup merges a group replicated from a federated relay and persists
+// the result if anything changed.
+func (fts *FileTokenStore) mergeGroup(pg persistedGroup) (bool, []peer.ID, error) {
+	changed, displaced, err := fts.MemoryTokenStore.mergeGroup(pg)
+	if changed {
+		fts.saveOrWarn()
+	}
+	return changed, displaced, err
+}
+
+// Path returns the file backing this store.
+func (fts *FileTokenStore) Path() string {
+	return fts.path
+}
+
+// saveOrWarn persists the store, logging instead of failing. Used where the
+// in-memory change has already been applied and the caller has no error path.
+func (fts *FileTokenStore) saveOrWarn() {
+	if err := fts.save(); err != nil {
+		slog.Warn("failed to persist pairing tokens", "path", fts.path, "err", err)
+	}
+}
+
+// save writes the current state to disk atomically.
+func (fts *FileTokenStore) save() error {
+	fts.saveMu.Lock()
+	defer fts.saveMu.Unlock()
+
+	file := tokenStoreFile{
+		Version: tokenStoreFileVersion,
+		Groups:  fts.snapshot(),
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal token store: %w", err)
+	}
+
+	return writeFileAtomic(fts.path, data)
+}
+
+// writeFileAtomic replaces path with data via temp file + fsync + rename,
+// so a crash never leaves a truncated state file behind. Shared by the
+// relay's persisted stores.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to update %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// snapshot copies all groups into their persisted form.
+func (ts *MemoryTokenStore) snapshot() []persistedGroup {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	groups := make([]persistedGroup, 0, len(ts.groups))
+	for _, group := range ts.groups {
+		group.mu.Lock()
+		pg := persistedGroup{
+			ID:        group.ID,
+			Namespace: group.Namespace,
+			CreatedAt: group.CreatedAt,
+			ExpiresAt: group.ExpiresAt,
+			Slots:     make([]persistedSlot, len(group.codes)),
+		}
+		if group.PeerTTL > 0 {
+			pg.PeerTTL = group.PeerTTL.String()
+		}
+		for i, slot := range group.codes {
+			ps := persistedSlot{
+				TokenHash: hex.EncodeToString(slot.TokenHash[:]),
+				Attempts:  slot.Attempts,
+				Name:      slot.Name,
+				UsedAt:    slot.UsedAt,
+				HMACProof: slot.HMACProof,
+			}
+			if slot.PeerID != "" {
+				ps.PeerID = slot.PeerID.String()
+			}
+			pg.Slots[i] = ps
+		}
+		group.mu.Unlock()
+		groups = append(groups, pg)
+	}
+	return groups
+}
+
+// toGroup converts a persisted group back into its in-memory form.
+func (pg persistedGroup) toGroup() (*PairingGroup, error) {
+	group := &PairingGroup{
+		ID:        pg.ID,
+		Namespace: pg.Namespace,
+		CreatedAt: pg.CreatedAt,
+		ExpiresAt: pg.ExpiresAt,
+		codes:     make([]CodeSlot, len(pg.Slots)),
+	}
+	if pg.PeerTTL != "" {
+		d, err := time.ParseDuration(pg.PeerTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer_ttl: %w", err)
+		}
+		group.PeerTTL = d
+	}
+
+	for i, ps := range pg.Slots {
+		hash, err := hex.DecodeString(ps.TokenHash)
+		if err != nil || len(hash) != 32 {
+			return nil, fmt.Errorf("invalid token hash in slot %d", i)
+		}
+		slot := CodeSlot{
+			Attempts:  ps.Attempts,
+			Name:      ps.Name,
+			UsedAt:    ps.UsedAt,
+			HMACProof: ps.HMACProof,
+		}
+		copy(slot.TokenHash[:], hash)
+		if ps.PeerID != "" {
+			pid, err := peer.Decode(ps.PeerID)
+			if err != nil {
+				return nil, fmt.Errorf("invalid peer ID in slot %d: %w", i, err)
+			}
+			slot.PeerID = pid
+		}
+		group.codes[i] = slot
+	}
+	return group, nil
+}
+
+// mergeGroup merges a group replicated from a federated relay into the
+// store. Unknown groups are added as-is. For known groups, attempt counters
+// take the higher value and a used slot wins over an unused one; if both
+// relays handed out the same slot, the earlier redemption wins. Returns
+// whether the local copy changed and the peers whose local redemption lost
+// to an earlier one, which the caller must deauthorize.
+func (ts *MemoryTokenStore) mergeGroup(pg persistedGroup) (bool, []peer.ID, error) {
+	if time.Now().After(pg.ExpiresAt) {
+		return false, nil, nil
+	}
+	remote, err := pg.toGroup()
+	if err != nil {
+		return false, nil, fmt.Errorf("group %s: %w", pg.ID, err)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	local, ok := ts.groups[remote.ID]
+	if !ok {
+		ts.groups[remote.ID] = remote
+		return true, nil, nil
+	}
+
+	local.mu.Lock()
+	defer local.mu.Unlock()
+
+	if len(local.codes) != len(remote.codes) {
+		return false, nil, fmt.Errorf("group %s: %d slots here, %d remote", remote.ID, len(local.codes), len(remote.codes))
+	}
+	for i := range local.codes {
+		if local.codes[i].TokenHash != remote.codes[i].TokenHash {
+			return false, nil, fmt.Errorf("group %s: token hash mismatch in slot %d", remote.ID, i)
+		}
+	}
+
+	changed := false
+	var displaced []peer.ID
+	for i := range local.codes {
+		l, r := &local.codes[i], remote.codes[i]
+		if r.Attempts > l.Attempts {
+			l.Attempts = r.Attempts
+			changed = true
+		}
+		if r.UsedAt.IsZero() {
+			continue
+		}
+		switch {
+		case l.UsedAt.IsZero(), r.PeerID != l.PeerID && r.UsedAt.Before(l.UsedAt):
+			if !l.UsedAt.IsZero() {
+				displaced = append(displaced, l.PeerID)
+			}
+			attempts := l.Attempts
+			*l = r
+			l.Attempts = attempts
+			changed = true
+		case r.PeerID == l.PeerID && len(l.HMACProof) == 0 && len(r.HMACProof) > 0:
+			l.HMACProof = r.HMACProof
+			changed = true
+		}
+	}
+	return changed, displaced, nil
+}
@@ -0,0 +1,267 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTokenStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokenStoreFileName)
+
+	ts, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTokenStore: %v", err)
+	}
+	tokens, groupID, err := ts.CreateGroup(3, time.Hour, "office", 30*time.Minute)
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+
+	joiner := genPeerID(t)
+	_, idx, err := ts.ValidateAndUse(tokens[0], joiner, "laptop")
+	if err != nil {
+		t.Fatalf("ValidateAndUse: %v", err)
+	}
+	proof := []byte("hmac-proof")
+	ts.SetHMACProof(groupID, idx, proof)
+	ts.RecordFailedAttempt(tokens[1])
+
+	// Simulate a relay restart.
+	reloaded, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	groups := reloaded.List()
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups after reload, want 1", len(groups))
+	}
+	g := groups[0]
+	if g.ID != groupID || g.Namespace != "office" || g.Total != 3 || g.Used != 1 {
+		t.Errorf("reloaded group = %+v", g)
+	}
+
+	peers := reloaded.GetGroupPeers(groupID, -1)
+	if len(peers) != 1 || peers[0].PeerID != joiner || peers[0].Name != "laptop" {
+		t.Fatalf("reloaded peers = %+v", peers)
+	}
+	if !bytes.Equal(peers[0].HMACProof, proof) {
+		t.Errorf("HMAC proof not preserved: %q", peers[0].HMACProof)
+	}
+
+	reloaded.mu.RLock()
+	group := reloaded.groups[groupID]
+	reloaded.mu.RUnlock()
+	if group.PeerTTL != 30*time.Minute {
+		t.Errorf("PeerTTL = %v, want 30m", group.PeerTTL)
+	}
+	if group.codes[1].Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", group.codes[1].Attempts)
+	}
+
+	// Used code stays used; unused codes still work.
+	if _, _, err := reloaded.ValidateAndUse(tokens[0], genPeerID(t), "x"); !errors.Is(err, ErrTokenUsed) {
+		t.Errorf("reused token: got %v, want ErrTokenUsed", err)
+	}
+	if _, _, err := reloaded.ValidateAndUse(tokens[2], genPeerID(t), "desktop"); err != nil {
+		t.Errorf("unused token after reload: %v", err)
+	}
+}
+
+func TestFileTokenStoreNoRawTokensOnDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokenStoreFileName)
+
+	ts, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTokenStore: %v", err)
+	}
+	tokens, _, err := ts.CreateGroup(2, time.Hour, "", 0)
+	if err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("file mode = %o, want 600", perm)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, tok := range tokens {
+		if bytes.Contains(data, []byte(hex.EncodeToString(tok))) || bytes.Contains(data, tok) {
+			t.Error("raw token found in token store file")
+		}
+	}
+}
+
+func TestFileTokenStorePrunesExpiredOnLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokenStoreFileName)
+
+	ts, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTokenStore: %v", err)
+	}
+	ts.CreateGroup(1, time.Millisecond, "", 0)
+	_, liveID, _ := ts.CreateGroup(1, time.Hour, "", 0)
+	time.Sleep(5 * time.Millisecond)
+
+	reloaded, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	groups := reloaded.List()
+	if len(groups) != 1 || groups[0].ID != liveID {
+		t.Fatalf("groups after reload = %+v, want only %s", groups, liveID)
+	}
+
+	// The pruned state is written back to disk.
+	again, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("second reload: %v", err)
+	}
+	if n := len(again.snapshot()); n != 1 {
+		t.Errorf("file still holds %d groups, want 1", n)
+	}
+}
+
+func TestFileTokenStoreRevokePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokenStoreFileName)
+
+	ts, _ := NewFileTokenStore(path)
+	_, groupID, _ := ts.CreateGroup(1, time.Hour, "", 0)
+	if err := ts.Revoke(groupID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := ts.Revoke(groupID); !errors.Is(err, ErrGroupNotFound) {
+		t.Errorf("second Revoke: got %v, want ErrGroupNotFound", err)
+	}
+
+	reloaded, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(reloaded.List()) != 0 {
+		t.Error("revoked group came back after reload")
+	}
+}
+
+func TestFileTokenStoreMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokenStoreFileName)
+
+	ts, err := NewFileTokenStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTokenStore: %v", err)
+	}
+	if len(ts.List()) != 0 {
+		t.Error("new store should be empty")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("file should not be created until the first change")
+	}
+}
+
+func TestFileTokenStoreFailedAttemptOnlySavesChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokenStoreFileName)
+
+	ts, _ := NewFileTokenStore(path)
+	ts.RecordFailedAttempt(bytes.Repeat([]byte{0xab}, TokenSize))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("unknown token wrote the store")
+	}
+
+	tokens, _, _ := ts.CreateGroup(1, time.Hour, "", 0)
+	os.Remove(path)
+	ts.RecordFailedAttempt(tokens[0])
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("known token did not write the store: %v", err)
+	}
+}
+
+func TestFileTokenStoreCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokenStoreFileName)
+
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileTokenStore(path); err == nil {
+		t.Error("expected error for corrupt file")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 99, "groups": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileTokenStore(path); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+}
+
+func TestMergeGroup(t *testing.T) {
+	origin := NewTokenStore()
+	tokens, groupID, err := origin.CreateGroup(2, time.Hour, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown group is copied as-is.
+	replica := NewTokenStore()
+	if changed, _, err := replica.mergeGroup(origin.snapshot()[0]); err != nil || !changed {
+		t.Fatalf("mergeGroup() of a new group = %v, %v", changed, err)
+	}
+	if replica.GroupCount(groupID) != 2 {
+		t.Fatalf("replica GroupCount = %d, want 2", replica.GroupCount(groupID))
+	}
+
+	// Both relays redeem the same code; the earlier redemption wins.
+	first, second := genPeerID(t), genPeerID(t)
+	if _, _, err := replica.ValidateAndUse(tokens[0], first, "first"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, _, err := origin.ValidateAndUse(tokens[0], second, "second"); err != nil {
+		t.Fatal(err)
+	}
+	origin.RecordFailedAttempt(tokens[1])
+	if changed, displaced, _ := replica.mergeGroup(origin.snapshot()[0]); !changed || len(displaced) != 0 {
+		t.Errorf("mergeGroup() of a failed attempt = %v, %v", changed, displaced)
+	}
+	changed, displaced, _ := origin.mergeGroup(replica.snapshot()[0])
+	if !changed {
+		t.Error("mergeGroup() kept the later redemption")
+	}
+	if len(displaced) != 1 || displaced[0] != second {
+		t.Errorf("displaced = %v, want the later redeemer", displaced)
+	}
+	for _, s := range []*MemoryTokenStore{origin, replica} {
+		peers := s.GetGroupPeers(groupID, -1)
+		if len(peers) != 1 || peers[0].PeerID != first {
+			t.Errorf("group peers = %+v, want only the first redeemer", peers)
+		}
+		if attempts := s.snapshot()[0].Slots[1].Attempts; attempts != 1 {
+			t.Errorf("slot 1 attempts = %d, want 1", attempts)
+		}
+	}
+	if changed, _, _ := replica.mergeGroup(origin.snapshot()[0]); changed {
+		t.Error("mergeGroup() of an identical group reported a change")
+	}
+
+	// Groups that share an ID but not their codes are refused.
+	other := NewTokenStore()
+	other.CreateGroup(2, time.Hour, "", 0)
+	pg := other.snapshot()[0]
+	pg.ID = groupID
+	if _, _, err := replica.mergeGroup(pg); err == nil {
+		t.Error("mergeGroup() accepted a group with different token hashes")
+	}
+
+	pg.ID, pg.ExpiresAt = "0badc0de", time.Now().Add(-time.Minute)
+	if changed, _, _ := replica.mergeGroup(pg); changed || replica.GroupCount("0badc0de") != 0 {
+		t.Error("mergeGroup() added an expired group")
+	}
+}
@@ -0,0 +1,502 @@
+package relay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/satindergrewal/peer-up/internal/auth"
+	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/pkg/p2pnet"
+)
+
+// UsageFileName is the per-peer relay usage file kept next to the relay config.
+const UsageFileName = "relay_usage.json"
+
+// usageFileVersion is bumped when the on-disk format changes incompatibly.
+const usageFileVersion = 1
+
+// Shared-bandwidth transfers are split into chunks of about 1/8 s worth of
+// tokens so a slow share never blocks one Read or Write for long.
+const (
+	minShareChunk = 512
+	maxShareChunk = 32 << 10
+)
+
+// ErrRelayQuotaExceeded is returned when a peer has used up its daily relay
+// data budget.
+var ErrRelayQuotaExceeded = errors.New("relay quota exceeded")
+
+// PeerLimits are the relay allowances of one authorized peer, read from the
+// relay_quota and relay_weight attributes in authorized_keys.
+type PeerLimits struct {
+	DailyQuota int64 // bytes per UTC calendar day, 0 = unlimited
+	Weight     int   // share of resources.bandwidth, 0 = 1
+}
+
+// PeerUsage is the cumulative relay usage of one peer. Bytes count every
+// byte relayed on circuits the peer is an end of, in both directions.
+type PeerUsage struct {
+	PeerID         string  `json:"peer_id"`
+	Bytes          int64   `json:"bytes"`
+	CircuitSeconds float64 `json:"circuit_seconds"`
+	DayBytes       int64   `json:"day_bytes"`
+	DailyQuota     int64   `json:"daily_quota,omitempty"`
+	Weight         int     `json:"weight"`
+	ActiveCircuits int     `json:"active_circuits"`
+}
+
+// peerUsage is the persisted usage of one peer.
+type peerUsage struct {
+	Bytes          int64   `json:"bytes"`
+	CircuitSeconds float64 `json:"circuit_seconds"`
+	Day            string  `json:"day"` // 2006-01-02 (UTC)
+	DayBytes       int64   `json:"day_bytes"`
+}
+
+// roll resets the daily counter once its day has ended.
+func (u *peerUsage) roll(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); u.Day != day {
+		u.Day, u.DayBytes = day, 0
+	}
+}
+
+// usageFile is the on-disk representation of a UsageTracker.
+type usageFile struct {
+	Version int                   `json:"version"`
+	Peers   map[string]*peerUsage `json:"peers"`
+}
+
+// UsageTracker accounts relayed bytes and circuit time per peer, enforces
+// daily relay quotas, and splits the relay's total bandwidth between the
+// peers with open circuits in proportion to their weights. Usage is
+// persisted so a restart doesn't hand out a fresh allowance. All methods are
+// nil-safe: a nil *UsageTracker records nothing and limits nothing.
+type UsageTracker struct {
+	path      string // empty = memory only
+	bandwidth int64  // bytes/sec shared by all circuits, 0 = unlimited
+	metrics   *p2pnet.Metrics
+	now       func() time.Time
+
+	mu     sync.Mutex
+	usage  map[peer.ID]*peerUsage
+	limits map[peer.ID]PeerLimits
+	open   map[peer.ID]int          // open circuits per peer, either end
+	shares map[peer.ID]*shareBucket // bandwidth shares of circuit sources
+	dirty  bool
+}
+
+// NewUsageTracker loads relay usage from path. A missing file yields an
+// empty tracker; the file is created on the first Save. An empty path keeps
+// usage in memory only. bandwidth caps all relayed traffic in bytes/sec
+// (0 = unlimited); metrics may be nil.
+func NewUsageTracker(path string, bandwidth int64, metrics *p2pnet.Metrics) (*UsageTracker, error) {
+	u := &UsageTracker{
+		path:      path,
+		bandwidth: bandwidth,
+		metrics:   metrics,
+		now:       time.Now,
+		usage:     make(map[peer.ID]*peerUsage),
+		limits:    make(map[peer.ID]PeerLimits),
+		open:      make(map[peer.ID]int),
+		shares:    make(map[peer.ID]*shareBucket),
+	}
+	if path == "" {
+		return u, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return u, nil
+		}
+		return nil, fmt.Errorf("failed to read relay usage: %w", err)
+	}
+
+	var file usageFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse relay usage %s: %w", path, err)
+	}
+	if file.Version != usageFileVersion {
+		return nil, fmt.Errorf("unsupported relay usage version %d in %s", file.Version, path)
+	}
+	for id, pu := range file.Peers {
+		p, err := peer.Decode(id)
+		if err != nil || pu == nil {
+			continue
+		}
+		u.usage[p] = pu
+		if metrics != nil {
+			metrics.RelayPeerBytesTotal.WithLabelValues(id).Add(float64(pu.Bytes))
+			metrics.RelayPeerCircuitSecondsTotal.WithLabelValues(id).Add(pu.CircuitSeconds)
+		}
+	}
+	return u, nil
+}
+
+// LoadPeerLimits reads the relay_quota and relay_weight attributes of the
+// peers in an authorized_keys file. Peers without either are omitted.
+func LoadPeerLimits(authKeysPath string) (map[peer.ID]PeerLimits, error) {
+	entries, err := auth.ListPeers(authKeysPath)
+	if err != nil {
+		return nil, err
+	}
+	limits := make(map[peer.ID]PeerLimits)
+	for _, e := range entries {
+		var l PeerLimits
+		if e.RelayQuota != "" {
+			quota, err := config.ParseDataSize(e.RelayQuota)
+			if err != nil {
+				return nil, fmt.Errorf("relay_quota for %s: %w", e.PeerID, err)
+			}
+			l.DailyQuota = quota
+		}
+		l.Weight = e.RelayWeight
+		if l != (PeerLimits{}) {
+			limits[e.PeerID] = l
+		}
+	}
+	return limits, nil
+}
+
+// SetLimits replaces the per-peer allowances. Open circuits pick up new
+// weights immediately and new quotas on their next transfer.
+func (u *UsageTracker) SetLimits(limits map[peer.ID]PeerLimits) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.limits = make(map[peer.ID]PeerLimits, len(limits))
+	for p, l := range limits {
+		u.limits[p] = l
+	}
+	u.rebalanceLocked()
+}
+
+// Usage returns the usage of every peer the relay has served or holds
+// limits for, heaviest users today first.
+func (u *UsageTracker) Usage() []PeerUsage {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	seen := make(map[peer.ID]bool)
+	result := make([]PeerUsage, 0, len(u.usage))
+	add := func(p peer.ID) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		pu := u.usageLocked(p, now)
+		l := u.limits[p]
+		result = append(result, PeerUsage{
+			PeerID:         p.String(),
+			Bytes:          pu.Bytes,
+			CircuitSeconds: pu.CircuitSeconds,
+			DayBytes:       pu.DayBytes,
+			DailyQuota:     l.DailyQuota,
+			Weight:         max(l.Weight, 1),
+			ActiveCircuits: u.open[p],
+		})
+	}
+	for p := range u.usage {
+		add(p)
+	}
+	for p := range u.limits {
+		add(p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].DayBytes != result[j].DayBytes {
+			return result[i].DayBytes > result[j].DayBytes
+		}
+		return result[i].PeerID < result[j].PeerID
+	})
+	return result
+}
+
+// Admit checks whether a circuit between src and dst may open. It returns
+// ErrRelayQuotaExceeded when either end has used up its daily quota.
+func (u *UsageTracker) Admit(src, dst peer.ID) error {
+	if u == nil {
+		return nil
+	}
+	if p := u.exhausted(src, dst); p != "" {
+		u.recordQuotaExceeded(p)
+		return fmt.Errorf("%w: %s", ErrRelayQuotaExceeded, p)
+	}
+	return nil
+}
+
+// startCircuit starts accounting for a circuit. The circuit's source is paced by its
+// bandwidth share. The caller must Close the returned usage.
+func (u *UsageTracker) startCircuit(src, dst peer.ID) *circuitUsage {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.open[src]++
+	u.open[dst]++
+	cu := &circuitUsage{u: u, src: src, dst: dst, started: u.now()}
+	if u.bandwidth > 0 {
+		sb, ok := u.shares[src]
+		if !ok {
+			sb = &shareBucket{last: cu.started}
+			u.shares[src] = sb
+		}
+		sb.refs++
+		cu.share = sb
+		u.rebalanceLocked()
+	}
+	return cu
+}
+
+// Save writes usage to disk atomically if it changed since the last save.
+func (u *UsageTracker) Save() error {
+	if u == nil || u.path == "" {
+		return nil
+	}
+
+	u.mu.Lock()
+	if !u.dirty {
+		u.mu.Unlock()
+		return nil
+	}
+	file := usageFile{Version: usageFileVersion, Peers: make(map[string]*peerUsage, len(u.usage))}
+	for p, pu := range u.usage {
+		file.Peers[p.String()] = pu
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	u.dirty = false
+	u.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal relay usage: %w", err)
+	}
+
+	if err := writeFileAtomic(u.path, data); err != nil {
+		u.markDirty()
+		return err
+	}
+	return nil
+}
+
+func (u *UsageTracker) markDirty() {
+	u.mu.Lock()
+	u.dirty = true
+	u.mu.Unlock()
+}
+
+func (u *UsageTracker) usageLocked(p peer.ID, now time.Time) *peerUsage {
+	pu, ok := u.usage[p]
+	if !ok {
+		pu = &peerUsage{}
+		u.usage[p] = pu
+	}
+	pu.roll(now)
+	return pu
+}
+
+// exhausted returns the first of peers that has used up its daily quota,
+// or "".
+func (u *UsageTracker) exhausted(peers ...peer.ID) peer.ID {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	for _, p := range peers {
+		l := u.limits[p]
+		if l.DailyQuota > 0 && u.usageLocked(p, now).DayBytes >= l.DailyQuota {
+			return p
+		}
+	}
+	return ""
+}
+
+// account records n relayed bytes for both ends of a circuit.
+func (u *UsageTracker) account(src, dst peer.ID, n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := u.now()
+	for _, p := range []peer.ID{src, dst} {
+		pu := u.usageLocked(p, now)
+		pu.Bytes += int64(n)
+		pu.DayBytes += int64(n)
+		if u.metrics != nil {
+			u.metrics.RelayPeerBytesTotal.WithLabelValues(p.String()).Add(float64(n))
+			u.metrics.RelayPeerDailyBytes.WithLabelValues(p.String()).Set(float64(pu.DayBytes))
+		}
+	}
+	u.dirty = true
+}
+
+// rebalanceLocked gives each circuit source bandwidth × weight / Σ weights.
+func (u *UsageTracker) rebalanceLocked() {
+	if u.bandwidth <= 0 || len(u.shares) == 0 {
+		return
+	}
+	total := 0
+	for p := range u.shares {
+		total += max(u.limits[p].Weight, 1)
+	}
+	now := u.now()
+	for p, sb := range u.shares {
+		sb.setRate(float64(u.bandwidth)*float64(max(u.limits[p].Weight, 1))/float64(total), now)
+	}
+}
+
+func (u *UsageTracker) recordQuotaExceeded(p peer.ID) {
+	slog.Warn("relay: peer quota exceeded", "peer", p)
+	if u.metrics != nil {
+		u.metrics.RelayPeerQuotaExceededTotal.WithLabelValues(p.String()).Inc()
+	}
+}
+
+// circuitUsage accounts the traffic and lifetime of one circuit.
+type circuitUsage struct {
+	u        *UsageTracker
+	src, dst peer.ID
+	started  time.Time
+	share    *shareBucket // nil when bandwidth is unlimited
+
+	exceeded  atomic.Bool // quota hit reported once per circuit
+	closeOnce sync.Once
+}
+
+// check fails the transfer once either end has used up its daily quota.
+func (cu *circuitUsage) check() error {
+	if cu == nil {
+		return nil
+	}
+	if p := cu.u.exhausted(cu.src, cu.dst); p != "" {
+		if cu.exceeded.CompareAndSwap(false, true) {
+			cu.u.recordQuotaExceeded(p)
+		}
+		return fmt.Errorf("%w: %s", ErrRelayQuotaExceeded, p)
+	}
+	return nil
+}
+
+// chunk returns the largest transfer that should be made in one call, or 0
+// for no limit.
+func (cu *circuitUsage) chunk() int {
+	if cu == nil || cu.share == nil {
+		return 0
+	}
+	return int(min(max(cu.share.currentRate()/8, minShareChunk), maxShareChunk))
+}
+
+// consume records n relayed bytes and waits for the source's bandwidth
+// share to cover them.
+func (cu *circuitUsage) consume(n int) {
+	if cu == nil || n <= 0 {
+		return
+	}
+	cu.u.account(cu.src, cu.dst, n)
+	if cu.share == nil {
+		return
+	}
+	if wait := cu.share.reserve(n, time.Now()); wait > 0 {
+		if cu.u.metrics != nil {
+			cu.u.metrics.RelayPeerThrottledTotal.WithLabelValues(cu.src.String()).Inc()
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Close adds the circuit's lifetime to both ends and releases its share.
+func (cu *circuitUsage) Close() {
+	if cu == nil {
+		return
+	}
+	cu.closeOnce.Do(func() {
+		u := cu.u
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		now := u.now()
+		secs := now.Sub(cu.started).Seconds()
+		for _, p := range []peer.ID{cu.src, cu.dst} {
+			u.usageLocked(p, now).CircuitSeconds += secs
+			if u.open[p]--; u.open[p] <= 0 {
+				delete(u.open, p)
+			}
+			if u.metrics != nil {
+				u.metrics.RelayPeerCircuitSecondsTotal.WithLabelValues(p.String()).Add(secs)
+			}
+		}
+		u.dirty = true
+
+		if cu.share != nil {
+			if cu.share.refs--; cu.share.refs <= 0 {
+				delete(u.shares, cu.src)
+			}
+			u.rebalanceLocked()
+		}
+	})
+}
+
+// shareBucket is a byte-rate limiter whose rate changes as peers open and
+// close circuits. Like the service limiter it may go into debt so a
+// transfer larger than the burst is still paced correctly.
+type shareBucket struct {
+	refs int // guarded by UsageTracker.mu
+
+	mu     sync.Mutex
+	rate   float64 // bytes per second, burst is one second of traffic
+	tokens float64
+	last   time.Time
+}
+
+func (b *shareBucket) setRate(rate float64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refillLocked(now)
+	if b.rate == 0 {
+		b.tokens = rate
+	}
+	b.rate = rate
+	b.tokens = min(b.tokens, rate)
+}
+
+func (b *shareBucket) currentRate() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rate
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller
+// must wait before sending them.
+func (b *shareBucket) reserve(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refillLocked(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *shareBucket) refillLocked(now time.Time) {
+	if b.rate > 0 {
+		b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
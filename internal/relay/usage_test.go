@@ -0,0 +1,281 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	circuitv2client "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func testPeerIDs(t *testing.T, n int) []peer.ID {
+	t.Helper()
+	ids := make([]peer.ID, n)
+	for i := range ids {
+		h, err := libp2p.New(libp2p.NoListenAddrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = h.ID()
+		h.Close()
+	}
+	return ids
+}
+
+func findUsage(usage []PeerUsage, p peer.ID) PeerUsage {
+	for _, u := range usage {
+		if u.PeerID == p.String() {
+			return u
+		}
+	}
+	return PeerUsage{}
+}
+
+func TestUsageTrackerPersistence(t *testing.T) {
+	ids := testPeerIDs(t, 2)
+	src, dst := ids[0], ids[1]
+	path := filepath.Join(t.TempDir(), UsageFileName)
+
+	u, err := NewUsageTracker(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	u.now = func() time.Time { return now }
+
+	cu := u.startCircuit(src, dst)
+	cu.consume(4096)
+	if got := findUsage(u.Usage(), src); got.ActiveCircuits != 1 || got.DayBytes != 4096 {
+		t.Errorf("usage while open = %+v", got)
+	}
+	now = now.Add(90 * time.Second)
+	cu.Close()
+	cu.Close() // idempotent
+
+	if err := u.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Fatalf("usage file mode = %v (err %v), want 0600", fi.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+
+	reloaded, err := NewUsageTracker(path, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.now = u.now
+	for _, p := range []peer.ID{src, dst} {
+		got := findUsage(reloaded.Usage(), p)
+		if got.Bytes != 4096 || got.DayBytes != 4096 || got.CircuitSeconds != 90 || got.ActiveCircuits != 0 || got.Weight != 1 {
+			t.Errorf("reloaded usage of %s = %+v", p, got)
+		}
+	}
+
+	os.WriteFile(path, []byte(`{"version": 99}`), 0600)
+	if _, err := NewUsageTracker(path, 0, nil); err == nil {
+		t.Error("NewUsageTracker() accepted an unknown version")
+	}
+}
+
+func TestUsageTrackerQuota(t *testing.T) {
+	ids := testPeerIDs(t, 3)
+	src, dst := ids[0], ids[1]
+	u, _ := NewUsageTracker("", 0, nil)
+	now := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	u.now = func() time.Time { return now }
+	u.SetLimits(map[peer.ID]PeerLimits{dst: {DailyQuota: 1000}})
+
+	if err := u.Admit(src, dst); err != nil {
+		t.Fatalf("Admit() under quota error = %v", err)
+	}
+	cu := u.startCircuit(src, dst)
+	cu.consume(600)
+	if err := cu.check(); err != nil {
+		t.Errorf("check() under quota error = %v", err)
+	}
+	cu.consume(600)
+	if err := cu.check(); !errors.Is(err, ErrRelayQuotaExceeded) {
+		t.Errorf("check() over quota error = %v, want ErrRelayQuotaExceeded", err)
+	}
+	if err := u.Admit(src, dst); !errors.Is(err, ErrRelayQuotaExceeded) {
+		t.Errorf("Admit() over quota error = %v, want ErrRelayQuotaExceeded", err)
+	}
+	// The source has no quota of its own; only circuits with dst are refused.
+	if err := u.Admit(src, ids[2]); err != nil {
+		t.Errorf("Admit() without dst error = %v", err)
+	}
+
+	// A new UTC day brings a fresh allowance; the total keeps counting.
+	now = now.Add(2 * time.Hour)
+	if err := u.Admit(src, dst); err != nil {
+		t.Errorf("Admit() on a new day error = %v", err)
+	}
+	if got := findUsage(u.Usage(), dst); got.DayBytes != 0 || got.Bytes != 1200 || got.DailyQuota != 1000 {
+		t.Errorf("usage on a new day = %+v", got)
+	}
+	cu.Close()
+}
+
+func TestUsageTrackerWeights(t *testing.T) {
+	ids := testPeerIDs(t, 3)
+	heavy, light, dst := ids[0], ids[1], ids[2]
+	u, _ := NewUsageTracker("", 3000, nil)
+	u.SetLimits(map[peer.ID]PeerLimits{heavy: {Weight: 2}})
+
+	a := u.startCircuit(heavy, dst)
+	if rate := a.share.currentRate(); rate != 3000 {
+		t.Errorf("sole circuit rate = %v, want 3000", rate)
+	}
+	b := u.startCircuit(light, dst)
+	c := u.startCircuit(light, dst)
+	if c.share != b.share {
+		t.Error("circuits from the same source have separate shares")
+	}
+	if ra, rb := a.share.currentRate(), b.share.currentRate(); ra != 2000 || rb != 1000 {
+		t.Errorf("shares = %v and %v, want 2000 and 1000", ra, rb)
+	}
+
+	// Weights change with authorized_keys.
+	u.SetLimits(map[peer.ID]PeerLimits{heavy: {Weight: 1}, light: {Weight: 2}})
+	if ra, rb := a.share.currentRate(), b.share.currentRate(); ra != 1000 || rb != 2000 {
+		t.Errorf("shares after SetLimits = %v and %v, want 1000 and 2000", ra, rb)
+	}
+
+	// The share goes back to the pool only when the last circuit closes.
+	b.Close()
+	if rate := a.share.currentRate(); rate != 1000 {
+		t.Errorf("rate with light still open = %v, want 1000", rate)
+	}
+	c.Close()
+	if rate := a.share.currentRate(); rate != 3000 {
+		t.Errorf("rate after light closed = %v, want 3000", rate)
+	}
+	if chunk := a.chunk(); chunk != 512 {
+		t.Errorf("chunk() = %d, want the 512 byte minimum", chunk)
+	}
+	a.Close()
+
+	var unlimited *UsageTracker
+	if unlimited.startCircuit(heavy, dst).chunk() != 0 || unlimited.Admit(heavy, dst) != nil || unlimited.Usage() != nil {
+		t.Error("nil tracker applied limits")
+	}
+}
+
+func TestLoadPeerLimits(t *testing.T) {
+	ids := testPeerIDs(t, 3)
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	content := ids[0].String() + "  relay_quota=5GB relay_weight=3  # kid\n" +
+		ids[1].String() + "  role=admin\n" +
+		ids[2].String() + "  relay_weight=2\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	limits, err := LoadPeerLimits(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 2 {
+		t.Fatalf("LoadPeerLimits() = %v, want two peers", limits)
+	}
+	if l := limits[ids[0]]; l.DailyQuota != 5<<30 || l.Weight != 3 {
+		t.Errorf("limits[0] = %+v", l)
+	}
+	if l := limits[ids[2]]; l.DailyQuota != 0 || l.Weight != 2 {
+		t.Errorf("limits[2] = %+v", l)
+	}
+
+	os.WriteFile(path, []byte(ids[0].String()+"  relay_quota=lots\n"), 0600)
+	if _, err := LoadPeerLimits(path); err == nil {
+		t.Error("LoadPeerLimits() accepted an invalid relay_quota")
+	}
+}
+
+// TestCircuitMonitorUsage relays data between two peers and checks that it
+// is accounted to both and that a used-up quota breaks the circuit.
+func TestCircuitMonitorUsage(t *testing.T) {
+	newHost := func(opts ...libp2p.Option) host.Host {
+		h, err := libp2p.New(append(opts, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	relayHost := newHost(libp2p.DisableRelay())
+	dst := newHost(libp2p.EnableRelay())
+	src := newHost(libp2p.EnableRelay())
+
+	u, _ := NewUsageTracker("", 0, nil)
+	u.SetLimits(map[peer.ID]PeerLimits{src.ID(): {DailyQuota: 64 << 10}})
+	m := NewCircuitMonitor(relayHost, 0)
+	m.SetUsage(u)
+	r, err := relayv2.New(m.Host(), relayv2.WithACL(m), relayv2.WithLimit(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	relayInfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, h := range []host.Host{src, dst} {
+		if err := h.Connect(ctx, relayInfo); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := circuitv2client.Reserve(ctx, dst, relayInfo); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	dst.SetStreamHandler("/test/sink", func(s network.Stream) { io.Copy(io.Discard, s); s.Close() })
+	circuitAddr := ma.StringCast("/p2p/" + relayHost.ID().String() + "/p2p-circuit")
+	src.Peerstore().AddAddrs(dst.ID(), []ma.Multiaddr{relayInfo.Addrs[0].Encapsulate(circuitAddr)}, time.Minute)
+	s, err := src.NewStream(network.WithAllowLimitedConn(ctx, "test"), dst.ID(), "/test/sink")
+	if err != nil {
+		t.Fatalf("NewStream() over circuit error = %v", err)
+	}
+	s.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Keep writing until the relay cuts the circuit at the quota.
+	chunk := make([]byte, 8<<10)
+	var sent int
+	for sent < 1<<20 {
+		n, err := s.Write(chunk)
+		sent += n
+		if err != nil {
+			break
+		}
+	}
+	if sent >= 1<<20 {
+		t.Fatal("relay forwarded far more than the quota")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.Circuits()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("circuit still open after the quota was used up")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	srcUsage, dstUsage := findUsage(u.Usage(), src.ID()), findUsage(u.Usage(), dst.ID())
+	if srcUsage.DayBytes < 64<<10 || dstUsage.Bytes != srcUsage.Bytes {
+		t.Errorf("usage = src %+v, dst %+v", srcUsage, dstUsage)
+	}
+	if m.AllowConnect(src.ID(), ma.StringCast("/ip4/127.0.0.1/tcp/1"), dst.ID()) {
+		t.Error("AllowConnect() allowed a peer over its quota")
+	}
+}
@@ -0,0 +1,26 @@
+package validate
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// unixPrefix marks a local address as a Unix domain socket path.
+const unixPrefix = "unix:"
+
+// LocalAddress checks a service or listener address: "host:port" for TCP,
+// or "unix:" followed by an absolute socket path.
+func LocalAddress(addr string) error {
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("%w: %q must be unix: followed by an absolute path", ErrInvalidLocalAddress, addr)
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("%w: %q must be host:port or unix:/path/to.sock", ErrInvalidLocalAddress, addr)
+	}
+	return nil
+}
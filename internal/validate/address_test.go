@@ -0,0 +1,37 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLocalAddress(t *testing.T) {
+	valid := []string{
+		"localhost:22",
+		"127.0.0.1:8080",
+		"[::1]:5432",
+		":2222",
+		"unix:/var/run/docker.sock",
+		"unix:/tmp/peerup/ssh-agent.sock",
+	}
+	for _, addr := range valid {
+		if err := LocalAddress(addr); err != nil {
+			t.Errorf("LocalAddress(%q) = %v, want nil", addr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"localhost",
+		"22",
+		"unix:",
+		"unix:relative.sock",
+		"unix:./docker.sock",
+		"/var/run/docker.sock",
+	}
+	for _, addr := range invalid {
+		if err := LocalAddress(addr); !errors.Is(err, ErrInvalidLocalAddress) {
+			t.Errorf("LocalAddress(%q) = %v, want ErrInvalidLocalAddress", addr, err)
+		}
+	}
+}
@@ -10,4 +10,12 @@ var (
 	// ErrInvalidNetworkName is returned when a network namespace does not match
 	// the DNS-label format (1-63 lowercase alphanumeric + hyphens).
 	ErrInvalidNetworkName = errors.New("invalid network name")
+
+	// ErrInvalidRoleName is returned when a role name does not match
+	// the DNS-label format (1-63 lowercase alphanumeric + hyphens).
+	ErrInvalidRoleName = errors.New("invalid role name")
+
+	// ErrInvalidLocalAddress is returned when a local address is neither
+	// host:port nor unix: followed by an absolute socket path.
+	ErrInvalidLocalAddress = errors.New("invalid local address")
 )
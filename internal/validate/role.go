@@ -0,0 +1,22 @@
+package validate
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// roleNameRe matches DNS-label-style role names, the same shape as service
+// names. Excludes ',' and '=' so roles round-trip through the comma-separated
+// role= attribute in authorized_keys.
+var roleNameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// RoleName checks that a role name is safe to store in authorized_keys.
+func RoleName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidRoleName)
+	}
+	if !roleNameRe.MatchString(name) {
+		return fmt.Errorf("%w: %q must be 1-63 lowercase alphanumeric characters or hyphens, starting and ending with alphanumeric", ErrInvalidRoleName, name)
+	}
+	return nil
+}
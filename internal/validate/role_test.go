@@ -0,0 +1,39 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRoleName(t *testing.T) {
+	for _, name := range []string{"admin", "ops", "on-call", "team2", "a"} {
+		if err := RoleName(name); err != nil {
+			t.Errorf("RoleName(%q) = %v, want nil", name, err)
+		}
+	}
+
+	invalid := []struct {
+		name string
+		desc string
+	}{
+		{"", "empty"},
+		{"Admin", "uppercase"},
+		{"admin,ops", "comma (role list separator)"},
+		{"role=ops", "equals (attribute separator)"},
+		{"on call", "space"},
+		{"-ops", "starts with hyphen"},
+		{"#ops", "comment marker"},
+		{strings.Repeat("a", 64), "too long (64 chars)"},
+	}
+	for _, tc := range invalid {
+		err := RoleName(tc.name)
+		if err == nil {
+			t.Errorf("RoleName(%q) [%s] = nil, want error", tc.name, tc.desc)
+			continue
+		}
+		if !errors.Is(err, ErrInvalidRoleName) {
+			t.Errorf("RoleName(%q) error should wrap ErrInvalidRoleName, got: %v", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package p2pnet
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Access denial reasons, reported in the audit log.
+const (
+	AccessDeniedNotAllowed    = "not_allowed"    // not in the service's allowed peers or roles
+	AccessDeniedOutsideWindow = "outside_window" // no access window is open
+	AccessDeniedNotYetValid   = "not_yet_valid"  // before the rule's not-before time
+	AccessDeniedExpired       = "expired"        // after the rule's not-after time
+)
+
+var weekdayNames = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// AccessWindow is a recurring weekly time window, e.g. weekdays 09:00-18:00.
+type AccessWindow struct {
+	Days  [7]bool       // indexed by time.Weekday
+	Start time.Duration // offset from midnight
+	End   time.Duration // exclusive; End <= Start wraps past midnight
+}
+
+// ParseAccessWindow parses a cron-like window spec: an optional day list and
+// an optional time range, e.g. "mon-fri 09:00-18:00", "sat,sun",
+// "22:00-06:00" or "*". Day lists take names and ranges (ranges may wrap,
+// "fri-mon"). A time range that ends before it starts runs past midnight
+// and belongs to the day it started on. Times use the rule's timezone.
+func ParseAccessWindow(spec string) (AccessWindow, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 || len(fields) > 2 {
+		return AccessWindow{}, fmt.Errorf("invalid access window %q: want \"[days] [HH:MM-HH:MM]\"", spec)
+	}
+
+	w := AccessWindow{End: 24 * time.Hour}
+	var haveDays, haveHours bool
+	for _, f := range fields {
+		if strings.Contains(f, ":") {
+			if haveHours {
+				return AccessWindow{}, fmt.Errorf("invalid access window %q: more than one time range", spec)
+			}
+			start, end, err := parseTimeRange(f)
+			if err != nil {
+				return AccessWindow{}, fmt.Errorf("invalid access window %q: %w", spec, err)
+			}
+			w.Start, w.End = start, end
+			haveHours = true
+			continue
+		}
+		if haveDays {
+			return AccessWindow{}, fmt.Errorf("invalid access window %q: more than one day list", spec)
+		}
+		days, err := parseDayList(f)
+		if err != nil {
+			return AccessWindow{}, fmt.Errorf("invalid access window %q: %w", spec, err)
+		}
+		w.Days = days
+		haveDays = true
+	}
+	if !haveDays {
+		w.Days = [7]bool{true, true, true, true, true, true, true}
+	}
+	return w, nil
+}
+
+func parseDayList(s string) ([7]bool, error) {
+	var days [7]bool
+	if s == "*" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		a, err := parseWeekday(from)
+		if err != nil {
+			return days, err
+		}
+		b := a
+		if isRange {
+			if b, err = parseWeekday(to); err != nil {
+				return days, err
+			}
+		}
+		for d := a; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == b {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for i, name := range weekdayNames {
+		if s == name {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q (use sun, mon, tue, wed, thu, fri, sat)", s)
+}
+
+func parseTimeRange(s string) (start, end time.Duration, err error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("time range %q must be HH:MM-HH:MM", s)
+	}
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parseClock(to); err != nil {
+		return 0, 0, err
+	}
+	if start == 24*time.Hour {
+		return 0, 0, fmt.Errorf("time range %q cannot start at 24:00", s)
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("time range %q is empty", s)
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, herr := strconv.Atoi(hh)
+	m, merr := strconv.Atoi(mm)
+	if !ok || herr != nil || merr != nil || len(mm) != 2 || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM, 00:00-24:00)", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// end returns when the occurrence of w that contains t closes. t must be in
+// the rule's timezone. ok is false if t is outside w.
+func (w AccessWindow) end(t time.Time) (end time.Time, ok bool) {
+	y, mo, d := t.Date()
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	at := func(day int, off time.Duration) time.Time {
+		return time.Date(y, mo, day, int(off/time.Hour), int(off%time.Hour/time.Minute), 0, 0, t.Location())
+	}
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	if w.Start < w.End {
+		if w.Days[today] && offset >= w.Start && offset < w.End {
+			return at(d, w.End), true
+		}
+		return time.Time{}, false
+	}
+	// Wraps past midnight: the late part of today's window, or the early
+	// part of yesterday's.
+	if w.Days[today] && offset >= w.Start {
+		return at(d+1, w.End), true
+	}
+	if w.Days[yesterday] && offset < w.End {
+		return at(d, w.End), true
+	}
+	return time.Time{}, false
+}
+
+// String returns the window in ParseAccessWindow syntax.
+func (w AccessWindow) String() string {
+	var parts []string
+	if days := formatDays(w.Days); days != "*" || (w.Start == 0 && w.End == 24*time.Hour) {
+		parts = append(parts, days)
+	}
+	if w.Start != 0 || w.End != 24*time.Hour {
+		parts = append(parts, formatClock(w.Start)+"-"+formatClock(w.End))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatDays renders a day set as monday-first runs, e.g. "mon-fri,sun".
+func formatDays(days [7]bool) string {
+	all := true
+	for _, on := range days {
+		all = all && on
+	}
+	if all {
+		return "*"
+	}
+	var runs []string
+	order := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+	for i := 0; i < len(order); i++ {
+		if !days[order[i]] {
+			continue
+		}
+		j := i
+		for j+1 < len(order) && days[order[j+1]] {
+			j++
+		}
+		if j > i {
+			runs = append(runs, weekdayNames[order[i]]+"-"+weekdayNames[order[j]])
+		} else {
+			runs = append(runs, weekdayNames[order[i]])
+		}
+		i = j
+	}
+	return strings.Join(runs, ",")
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// AccessRule limits when peers may use a service. A peer that one or more
+// rules apply to is allowed only while at least one of them is open; peers
+// no rule applies to are unaffected. Rules narrow access and never widen
+// it: the service's AllowedPeers and allowed roles are checked first.
+type AccessRule struct {
+	Peers     map[peer.ID]struct{} // peers the rule applies to (nil = all peers)
+	Windows   []AccessWindow       // recurring windows (empty = any time)
+	Location  *time.Location       // timezone for Windows (nil = local time)
+	NotBefore time.Time            // zero = no start
+	NotAfter  time.Time            // zero = no end
+}
+
+// AppliesTo reports whether the rule restricts peerID.
+func (r *AccessRule) AppliesTo(peerID peer.ID) bool {
+	if r.Peers == nil {
+		return true
+	}
+	_, ok := r.Peers[peerID]
+	return ok
+}
+
+// Check returns "" if the rule is open at now, otherwise one of the
+// AccessDenied reasons.
+func (r *AccessRule) Check(now time.Time) string {
+	_, reason := r.openUntil(now)
+	return reason
+}
+
+// openUntil returns when the rule next closes (zero = never) if it is open
+// at now, or the reason it is closed.
+func (r *AccessRule) openUntil(now time.Time) (time.Time, string) {
+	if !r.NotBefore.IsZero() && now.Before(r.NotBefore) {
+		return time.Time{}, AccessDeniedNotYetValid
+	}
+	if !r.NotAfter.IsZero() && !now.Before(r.NotAfter) {
+		return time.Time{}, AccessDeniedExpired
+	}
+
+	until := r.NotAfter
+	if len(r.Windows) > 0 {
+		loc := r.Location
+		if loc == nil {
+			loc = time.Local
+		}
+		local := now.In(loc)
+		var windowEnd time.Time
+		for _, w := range r.Windows {
+			if end, ok := w.end(local); ok && end.After(windowEnd) {
+				windowEnd = end
+			}
+		}
+		if windowEnd.IsZero() {
+			return time.Time{}, AccessDeniedOutsideWindow
+		}
+		if until.IsZero() || windowEnd.Before(until) {
+			until = windowEnd
+		}
+	}
+	return until, ""
+}
+
+// String describes the rule's windows and validity period.
+func (r *AccessRule) String() string {
+	var parts []string
+	if len(r.Windows) > 0 {
+		ws := make([]string, len(r.Windows))
+		for i, w := range r.Windows {
+			ws[i] = w.String()
+		}
+		s := strings.Join(ws, ", ")
+		if r.Location != nil {
+			s += " (" + r.Location.String() + ")"
+		}
+		parts = append(parts, s)
+	}
+	if !r.NotBefore.IsZero() {
+		parts = append(parts, "from "+r.NotBefore.Format(time.RFC3339))
+	}
+	if !r.NotAfter.IsZero() {
+		parts = append(parts, "until "+r.NotAfter.Format(time.RFC3339))
+	}
+	if len(parts) == 0 {
+		return "any time"
+	}
+	return strings.Join(parts, " ")
+}
+
+// SetAccessRules restricts when peers may use service. Rules are kept by
+// service name, so set them before exposing the service to avoid a window
+// of unrestricted access. Nil or empty rules remove the restriction.
+func (r *ServiceRegistry) SetAccessRules(service string, rules []*AccessRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(rules) == 0 {
+		delete(r.accessRules, service)
+		return
+	}
+	r.accessRules[service] = rules
+}
+
+// AccessRules returns the access rules set for service.
+func (r *ServiceRegistry) AccessRules(service string) []*AccessRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.accessRules[service]
+}
+
+// RoleChecker reports whether a peer holds any of the named roles.
+// Implemented by auth.AuthorizedPeerGater from authorized_keys role= attributes.
+type RoleChecker interface {
+	HasAnyRole(p peer.ID, roles []string) bool
+}
+
+// SetRoleChecker sets where allowed roles are looked up. Without one, only
+// AllowedPeers can admit a peer to a service that has allowed roles.
+func (r *ServiceRegistry) SetRoleChecker(rc RoleChecker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles = rc
+}
+
+// SetAllowedRoles restricts service to peers holding one of roles, in
+// addition to the service's AllowedPeers. Roles are kept by service name,
+// so set them before exposing the service. Empty roles remove the
+// restriction.
+func (r *ServiceRegistry) SetAllowedRoles(service string, roles []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(roles) == 0 {
+		delete(r.allowedRoles, service)
+		return
+	}
+	r.allowedRoles[service] = roles
+}
+
+// IsRestricted reports whether svc limits who may use it or when: allowed
+// peers, allowed roles or access rules. Restricted services must not be
+// advertised to every authorized peer (see ServicesFor).
+func (r *ServiceRegistry) IsRestricted(svc *Service) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return svc.AllowedPeers != nil || len(r.allowedRoles[svc.Name]) > 0 || len(r.accessRules[svc.Name]) > 0
+}
+
+// AllowedRoles returns the roles allowed to use service.
+func (r *ServiceRegistry) AllowedRoles(service string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.allowedRoles[service]
+}
+
+// ReplaceAllowedPeer swaps oldID for newID in every service's allowed
+// peers, used when an authorized peer rotates its identity key. Maps are
+// replaced rather than mutated so concurrent readers see a consistent set.
+func (r *ServiceRegistry) ReplaceAllowedPeer(oldID, newID peer.ID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, svc := range r.services {
+		if _, ok := svc.AllowedPeers[oldID]; !ok {
+			continue
+		}
+		allowed := make(map[peer.ID]struct{}, len(svc.AllowedPeers))
+		for p := range svc.AllowedPeers {
+			if p != oldID {
+				allowed[p] = struct{}{}
+			}
+		}
+		allowed[newID] = struct{}{}
+		svc.AllowedPeers = allowed
+	}
+}
+
+// isAllowed reports whether remotePeer passes svc's allowed peers and
+// allowed roles. A peer listed in either is allowed; a service with
+// neither allows every authorized peer.
+func (r *ServiceRegistry) isAllowed(svc *Service, remotePeer peer.ID) bool {
+	r.mu.RLock()
+	roles, rc := r.allowedRoles[svc.Name], r.roles
+	allowed := svc.AllowedPeers
+	r.mu.RUnlock()
+
+	if allowed == nil && len(roles) == 0 {
+		return true
+	}
+	if _, ok := allowed[remotePeer]; ok {
+		return true
+	}
+	return len(roles) > 0 && rc != nil && rc.HasAnyRole(remotePeer, roles)
+}
+
+// checkAccess applies svc's allowed peers, allowed roles and access rules
+// to remotePeer at now. It returns "" and when access next ends (zero =
+// never) if allowed, otherwise the denial reason.
+func (r *ServiceRegistry) checkAccess(svc *Service, remotePeer peer.ID, now time.Time) (time.Time, string) {
+	if !r.isAllowed(svc, remotePeer) {
+		return time.Time{}, AccessDeniedNotAllowed
+	}
+
+	var reason string
+	var until time.Time
+	applied, open := false, false
+	for _, rule := range r.AccessRules(svc.Name) {
+		if !rule.AppliesTo(remotePeer) {
+			continue
+		}
+		applied = true
+		end, why := rule.openUntil(now)
+		if why != "" {
+			if reason == "" {
+				reason = why
+			}
+			continue
+		}
+		// Open rules combine: access lasts until the last of them closes.
+		if !open || (!until.IsZero() && (end.IsZero() || end.After(until))) {
+			until = end
+		}
+		open = true
+	}
+	if applied && !open {
+		return time.Time{}, reason
+	}
+	return until, ""
+}
+
+// denyAccess records an access denial for remotePeer.
+func (r *ServiceRegistry) denyAccess(svc *Service, remotePeer peer.ID, reason string) {
+	slog.Warn("service access denied", "service", svc.Name, "peer", remotePeer.String()[:16]+"...", "reason", reason)
+	r.audit.ServiceACLDenied(remotePeer.String(), svc.Name, reason)
+}
+
+// accessWatch ends a connection when the peer's access to its service ends.
+type accessWatch struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+// watchAccess calls kill once remotePeer's access to svc ends (a window
+// closes or a rule expires), re-checking at each boundary so back-to-back
+// windows don't cut the connection. until is from checkAccess. The
+// returned function stops the watch.
+func (r *ServiceRegistry) watchAccess(svc *Service, remotePeer peer.ID, until time.Time, kill func()) (stop func()) {
+	if until.IsZero() {
+		return func() {}
+	}
+	w := &accessWatch{}
+	var arm func(time.Time)
+	arm = func(at time.Time) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.stopped {
+			return
+		}
+		w.timer = time.AfterFunc(time.Until(at), func() {
+			next, reason := r.checkAccess(svc, remotePeer, time.Now())
+			if reason != "" {
+				r.denyAccess(svc, remotePeer, reason)
+				kill()
+				return
+			}
+			if !next.IsZero() {
+				arm(next)
+			}
+		})
+	}
+	arm(until)
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.stopped = true
+		if w.timer != nil {
+			w.timer.Stop()
+		}
+	}
+}
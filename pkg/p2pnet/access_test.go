@@ -0,0 +1,314 @@
+package p2pnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func mustWindow(t *testing.T, spec string) AccessWindow {
+	t.Helper()
+	w, err := ParseAccessWindow(spec)
+	if err != nil {
+		t.Fatalf("ParseAccessWindow(%q): %v", spec, err)
+	}
+	return w
+}
+
+func TestParseAccessWindow(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string // String() of the parsed window
+	}{
+		{"mon-fri 09:00-18:00", "mon-fri 09:00-18:00"},
+		{"MON-FRI 09:00-18:00", "mon-fri 09:00-18:00"},
+		{"09:00-18:00 sat,sun", "sat-sun 09:00-18:00"},
+		{"sat,sun", "sat-sun"},
+		{"fri-mon", "mon,fri-sun"},
+		{"22:00-06:00", "22:00-06:00"},
+		{"*", "*"},
+		{"* 00:00-24:00", "*"},
+		{"mon,wed,fri", "mon,wed,fri"},
+	}
+	for _, tt := range tests {
+		if got := mustWindow(t, tt.spec).String(); got != tt.want {
+			t.Errorf("ParseAccessWindow(%q).String() = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "someday", "mon 9-17", "mon 09:00-09:00", "25:00-26:00", "mon 09:60-10:00", "24:00-01:00", "mon tue", "09:00-10:00 11:00-12:00", "a b c"} {
+		if _, err := ParseAccessWindow(bad); err == nil {
+			t.Errorf("ParseAccessWindow(%q) should fail", bad)
+		}
+	}
+}
+
+func TestAccessWindowEnd(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	at := func(day, hour, min int) time.Time { return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		spec    string
+		t       time.Time
+		wantOK  bool
+		wantEnd time.Time
+	}{
+		{"mon-fri 09:00-18:00", at(16, 12, 0), true, at(16, 18, 0)},
+		{"mon-fri 09:00-18:00", at(16, 18, 0), false, time.Time{}},
+		{"mon-fri 09:00-18:00", at(16, 8, 59), false, time.Time{}},
+		{"mon-fri 09:00-18:00", at(17, 12, 0), false, time.Time{}}, // Saturday
+		{"fri 22:00-06:00", at(16, 23, 0), true, at(17, 6, 0)},
+		{"fri 22:00-06:00", at(17, 5, 0), true, at(17, 6, 0)}, // Saturday morning, Friday's window
+		{"fri 22:00-06:00", at(16, 5, 0), false, time.Time{}}, // Friday morning belongs to Thursday
+		{"sat,sun", at(18, 23, 30), true, at(19, 0, 0)},
+	}
+	for _, tt := range tests {
+		end, ok := mustWindow(t, tt.spec).end(tt.t)
+		if ok != tt.wantOK || !end.Equal(tt.wantEnd) {
+			t.Errorf("%q at %v: end = %v, %v; want %v, %v", tt.spec, tt.t, end, ok, tt.wantEnd, tt.wantOK)
+		}
+	}
+}
+
+func TestAccessRuleTimezone(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	rule := &AccessRule{Windows: []AccessWindow{mustWindow(t, "09:00-18:00")}, Location: tokyo}
+
+	// 01:00 UTC is 10:00 in Tokyo.
+	if reason := rule.Check(time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC)); reason != "" {
+		t.Errorf("10:00 Tokyo denied: %s", reason)
+	}
+	// 12:00 UTC is 21:00 in Tokyo.
+	if reason := rule.Check(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)); reason != AccessDeniedOutsideWindow {
+		t.Errorf("21:00 Tokyo: reason = %q, want %q", reason, AccessDeniedOutsideWindow)
+	}
+}
+
+func TestAccessRuleValidity(t *testing.T) {
+	now := time.Now()
+	rule := &AccessRule{NotBefore: now.Add(time.Hour), NotAfter: now.Add(48 * time.Hour)}
+
+	if reason := rule.Check(now); reason != AccessDeniedNotYetValid {
+		t.Errorf("before not_before: reason = %q", reason)
+	}
+	if reason := rule.Check(now.Add(2 * time.Hour)); reason != "" {
+		t.Errorf("inside validity: reason = %q", reason)
+	}
+	if reason := rule.Check(now.Add(48 * time.Hour)); reason != AccessDeniedExpired {
+		t.Errorf("at not_after: reason = %q", reason)
+	}
+}
+
+func TestServiceRegistryCheckAccess(t *testing.T) {
+	reg := newTestHost(t)
+	contractor, staff := genTestPeerID(t), genTestPeerID(t)
+	svc := &Service{Name: "rdp"}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) // Friday noon
+
+	// No rules: everyone allowed, no deadline.
+	if until, reason := reg.checkAccess(svc, contractor, now); reason != "" || !until.IsZero() {
+		t.Errorf("no rules: until=%v reason=%q", until, reason)
+	}
+
+	reg.SetAccessRules("rdp", []*AccessRule{{
+		Peers:    map[peer.ID]struct{}{contractor: {}},
+		Windows:  []AccessWindow{mustWindow(t, "mon-fri 09:00-18:00")},
+		Location: time.UTC,
+	}})
+
+	if until, reason := reg.checkAccess(svc, contractor, now); reason != "" || !until.Equal(now.Add(6*time.Hour)) {
+		t.Errorf("contractor in window: until=%v reason=%q", until, reason)
+	}
+	if _, reason := reg.checkAccess(svc, contractor, now.Add(24*time.Hour)); reason != AccessDeniedOutsideWindow {
+		t.Errorf("contractor on Saturday: reason = %q", reason)
+	}
+	if until, reason := reg.checkAccess(svc, staff, now.Add(24*time.Hour)); reason != "" || !until.IsZero() {
+		t.Errorf("staff not covered by rule: until=%v reason=%q", until, reason)
+	}
+
+	// A second open rule for the contractor extends access.
+	reg.SetAccessRules("rdp", append(reg.AccessRules("rdp"), &AccessRule{
+		Peers:    map[peer.ID]struct{}{contractor: {}},
+		NotAfter: now.Add(48 * time.Hour),
+	}))
+	if until, reason := reg.checkAccess(svc, contractor, now); reason != "" || !until.Equal(now.Add(48*time.Hour)) {
+		t.Errorf("two open rules: until=%v reason=%q", until, reason)
+	}
+
+	// allowed_peers is checked first; rules never widen it.
+	svc.AllowedPeers = map[peer.ID]struct{}{staff: {}}
+	if _, reason := reg.checkAccess(svc, contractor, now); reason != AccessDeniedNotAllowed {
+		t.Errorf("contractor not in allowed_peers: reason = %q", reason)
+	}
+
+	reg.SetAccessRules("rdp", nil)
+	if rules := reg.AccessRules("rdp"); rules != nil {
+		t.Errorf("rules after removal = %v", rules)
+	}
+}
+
+// fakeRoles implements RoleChecker from a fixed peer -> roles table.
+type fakeRoles map[peer.ID][]string
+
+func (f fakeRoles) HasAnyRole(p peer.ID, roles []string) bool {
+	for _, have := range f[p] {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestServiceRegistryAllowedRoles(t *testing.T) {
+	reg := newTestHost(t)
+	ops, dev, listed := genTestPeerID(t), genTestPeerID(t), genTestPeerID(t)
+	svc := &Service{Name: "grafana"}
+	now := time.Now()
+
+	reg.SetAllowedRoles("grafana", []string{"ops"})
+
+	// No role checker: roles never match.
+	if _, reason := reg.checkAccess(svc, ops, now); reason != AccessDeniedNotAllowed {
+		t.Errorf("no role checker: reason = %q", reason)
+	}
+
+	reg.SetRoleChecker(fakeRoles{ops: {"admin", "ops"}, dev: {"dev"}})
+	if _, reason := reg.checkAccess(svc, ops, now); reason != "" {
+		t.Errorf("ops peer: reason = %q", reason)
+	}
+	if _, reason := reg.checkAccess(svc, dev, now); reason != AccessDeniedNotAllowed {
+		t.Errorf("dev peer: reason = %q", reason)
+	}
+
+	// allowed_peers and allowed_roles combine: either admits the peer.
+	svc.AllowedPeers = map[peer.ID]struct{}{listed: {}}
+	if _, reason := reg.checkAccess(svc, listed, now); reason != "" {
+		t.Errorf("listed peer: reason = %q", reason)
+	}
+	if _, reason := reg.checkAccess(svc, ops, now); reason != "" {
+		t.Errorf("ops peer with allowed_peers set: reason = %q", reason)
+	}
+
+	reg.SetAllowedRoles("grafana", nil)
+	if _, reason := reg.checkAccess(svc, ops, now); reason != AccessDeniedNotAllowed {
+		t.Errorf("roles removed: reason = %q", reason)
+	}
+	if roles := reg.AllowedRoles("grafana"); roles != nil {
+		t.Errorf("roles after removal = %v", roles)
+	}
+}
+
+func TestServiceRegistryIsRestricted(t *testing.T) {
+	reg := newTestHost(t)
+	svc := &Service{Name: "grafana"}
+
+	if reg.IsRestricted(svc) {
+		t.Error("open service reported as restricted")
+	}
+
+	reg.SetAllowedRoles("grafana", []string{"ops"})
+	if !reg.IsRestricted(svc) {
+		t.Error("allowed_roles not treated as restricted")
+	}
+	reg.SetAllowedRoles("grafana", nil)
+
+	reg.SetAccessRules("grafana", []*AccessRule{{
+		Windows:  []AccessWindow{mustWindow(t, "mon-fri 09:00-18:00")},
+		Location: time.UTC,
+	}})
+	if !reg.IsRestricted(svc) {
+		t.Error("access rules not treated as restricted")
+	}
+	reg.SetAccessRules("grafana", nil)
+
+	svc.AllowedPeers = map[peer.ID]struct{}{genTestPeerID(t): {}}
+	if !reg.IsRestricted(svc) {
+		t.Error("allowed_peers not treated as restricted")
+	}
+}
+
+func TestServiceAccessDeniedIsAudited(t *testing.T) {
+	server, client := resumeTestPair(t)
+	var buf bytes.Buffer
+	server.SetAuditLogger(NewAuditLogger(slog.NewJSONHandler(&buf, nil)))
+	server.SetAccessRules("echo", []*AccessRule{{NotAfter: time.Now().Add(-time.Hour)}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.DialResumableService(ctx, server.host.ID(), "echo"); !errors.Is(err, errResumeRejected) {
+		t.Fatalf("err = %v, want errResumeRejected", err)
+	}
+
+	waitFor(t, func() bool { return strings.Contains(buf.String(), "service_acl_denied") })
+	if !strings.Contains(buf.String(), `"reason":"expired"`) {
+		t.Errorf("audit entry missing reason: %s", buf.String())
+	}
+}
+
+func TestServiceAccessEndsOpenSession(t *testing.T) {
+	server, client := resumeTestPair(t)
+	server.SetAccessRules("echo", []*AccessRule{{NotAfter: time.Now().Add(500 * time.Millisecond)}})
+
+	conn := dialResumable(t, server, client)
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read before expiry: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(conn)
+		done <- err
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("session still open after access expired")
+	}
+}
+
+func TestServiceRegistryReplaceAllowedPeer(t *testing.T) {
+	reg := newTestHost(t)
+	oldID, newID, other := genTestPeerID(t), genTestPeerID(t), genTestPeerID(t)
+	restricted := &Service{Name: "ssh", Protocol: "/peerup/ssh/1.0.0", LocalAddress: "localhost:22",
+		AllowedPeers: map[peer.ID]struct{}{oldID: {}, other: {}}}
+	open := &Service{Name: "web", Protocol: "/peerup/web/1.0.0", LocalAddress: "localhost:80"}
+	for _, svc := range []*Service{restricted, open} {
+		if err := reg.RegisterService(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := restricted.AllowedPeers
+
+	reg.ReplaceAllowedPeer(oldID, newID)
+
+	now := time.Now()
+	if _, reason := reg.checkAccess(restricted, newID, now); reason != "" {
+		t.Errorf("new peer ID: reason = %q", reason)
+	}
+	if _, reason := reg.checkAccess(restricted, oldID, now); reason != AccessDeniedNotAllowed {
+		t.Errorf("old peer ID: reason = %q", reason)
+	}
+	if _, reason := reg.checkAccess(restricted, other, now); reason != "" {
+		t.Errorf("other peer: reason = %q", reason)
+	}
+	if _, ok := before[oldID]; !ok {
+		t.Error("original map was mutated; readers holding it would race")
+	}
+	if open.AllowedPeers != nil {
+		t.Error("unrestricted service gained an allowed peers list")
+	}
+}
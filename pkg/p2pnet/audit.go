@@ -31,14 +31,92 @@ func (a *AuditLogger) AuthDecision(peerID, direction, result string) {
 	)
 }
 
-// ServiceACLDenied logs a per-service access control denial.
-func (a *AuditLogger) ServiceACLDenied(peerID, service string) {
+// ServiceACLDenied logs a per-service access control denial. reason is one
+// of the AccessDenied constants (not in allowed peers, outside an access
+// window, not yet valid, expired).
+func (a *AuditLogger) ServiceACLDenied(peerID, service, reason string) {
 	if a == nil {
 		return
 	}
 	a.logger.Warn("service_acl_denied",
 		"peer", peerID,
 		"service", service,
+		"reason", reason,
+	)
+}
+
+// ServiceThrottled logs that a peer's traffic to a service was slowed by a
+// rate limit. scope is "peer" or "total". Logged once per connection.
+func (a *AuditLogger) ServiceThrottled(peerID, service, scope string) {
+	if a == nil {
+		return
+	}
+	a.logger.Info("service_throttled",
+		"peer", peerID,
+		"service", service,
+		"scope", scope,
+	)
+}
+
+// ServiceQuotaExceeded logs a connection refused or cut because a service
+// used up its daily or monthly quota.
+func (a *AuditLogger) ServiceQuotaExceeded(peerID, service, period string) {
+	if a == nil {
+		return
+	}
+	a.logger.Warn("service_quota_exceeded",
+		"peer", peerID,
+		"service", service,
+		"period", period,
+	)
+}
+
+// KeyRotation logs one step of an identity key rotation. action is
+// "announced" or "announce_failed" on the rotating node, and "applied" or
+// "rejected" on a receiving node; peerID is the other side of the step.
+func (a *AuditLogger) KeyRotation(action, oldPeerID, newPeerID, peerID, detail string) {
+	if a == nil {
+		return
+	}
+	a.logger.Info("key_rotation",
+		"action", action,
+		"old_peer", oldPeerID,
+		"new_peer", newPeerID,
+		"peer", peerID,
+		"detail", detail,
+	)
+}
+
+// Revocation logs a pairing group revocation. action is "issued" for a
+// notice signed by this node, "applied" or "rejected" for one received
+// from peer from.
+func (a *AuditLogger) Revocation(action, peerID, group, issuer, from, detail string) {
+	if a == nil {
+		return
+	}
+	a.logger.Info("revocation",
+		"action", action,
+		"peer", peerID,
+		"group", group,
+		"issuer", issuer,
+		"from", from,
+		"detail", detail,
+	)
+}
+
+// Invite logs an asynchronous invite event. action is "created",
+// "cancelled", "accepted" (joiner authorized) or "rejected" (reply did
+// not open); peerID is the joiner where known.
+func (a *AuditLogger) Invite(action, inviteID, peerID, relay, detail string) {
+	if a == nil {
+		return
+	}
+	a.logger.Info("invite",
+		"action", action,
+		"invite", inviteID,
+		"peer", peerID,
+		"relay", relay,
+		"detail", detail,
 	)
 }
 
@@ -12,9 +12,12 @@ func TestAuditLoggerNilSafe(t *testing.T) {
 
 	// All methods must not panic when called on nil
 	a.AuthDecision("12D3KooWTest...", "inbound", "denied")
-	a.ServiceACLDenied("12D3KooWTest...", "ssh")
+	a.ServiceACLDenied("12D3KooWTest...", "ssh", AccessDeniedExpired)
 	a.DaemonAPIAccess("GET", "/v1/status", 200)
 	a.AuthChange("add", "12D3KooWTest...")
+	a.ServiceThrottled("12D3KooWTest...", "ssh", "peer")
+	a.ServiceQuotaExceeded("12D3KooWTest...", "ssh", "daily")
+	a.Invite("accepted", "0123abcd", "12D3KooWTest...", "12D3KooWRelay...", "")
 }
 
 func TestAuditLoggerAuthDecision(t *testing.T) {
@@ -54,7 +57,7 @@ func TestAuditLoggerServiceACLDenied(t *testing.T) {
 	handler := slog.NewJSONHandler(&buf, nil)
 	a := NewAuditLogger(handler)
 
-	a.ServiceACLDenied("12D3KooWTest...", "ssh")
+	a.ServiceACLDenied("12D3KooWTest...", "ssh", AccessDeniedOutsideWindow)
 
 	var entry map[string]any
 	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
@@ -73,6 +76,9 @@ func TestAuditLoggerServiceACLDenied(t *testing.T) {
 	if audit["service"] != "ssh" {
 		t.Errorf("service = %q, want %q", audit["service"], "ssh")
 	}
+	if audit["reason"] != AccessDeniedOutsideWindow {
+		t.Errorf("reason = %q, want %q", audit["reason"], AccessDeniedOutsideWindow)
+	}
 }
 
 func TestAuditLoggerDaemonAPIAccess(t *testing.T) {
@@ -128,3 +134,32 @@ func TestAuditLoggerAuthChange(t *testing.T) {
 		t.Errorf("peer = %q, want %q", audit["peer"], "12D3KooWTest...")
 	}
 }
+
+func TestAuditLoggerServiceQuotaExceeded(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, nil)
+	a := NewAuditLogger(handler)
+
+	a.ServiceQuotaExceeded("12D3KooWTest...", "backup", "monthly")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to parse JSON log: %v", err)
+	}
+
+	if entry["msg"] != "service_quota_exceeded" {
+		t.Errorf("msg = %q, want %q", entry["msg"], "service_quota_exceeded")
+	}
+
+	audit, ok := entry["audit"].(map[string]any)
+	if !ok {
+		t.Fatal("missing audit group in log entry")
+	}
+
+	if audit["service"] != "backup" {
+		t.Errorf("service = %q, want %q", audit["service"], "backup")
+	}
+	if audit["period"] != "monthly" {
+		t.Errorf("period = %q, want %q", audit["period"], "monthly")
+	}
+}
@@ -0,0 +1,565 @@
+package p2pnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// QuotaStoreFileName is the quota usage file kept next to the node config.
+const QuotaStoreFileName = "service_quota.json"
+
+// quotaStoreFileVersion is bumped when the on-disk format changes incompatibly.
+const quotaStoreFileVersion = 1
+
+// Quota periods, used as metric and audit labels.
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+)
+
+// Rate-limited transfers are split into chunks of about 1/8 s worth of
+// tokens so a slow limit never blocks one Read or Write for long.
+const (
+	minLimitedChunk = 512
+	maxLimitedChunk = 32 << 10
+)
+
+// ServiceLimits shapes and caps the bandwidth of one exposed service.
+// Bytes in both directions count. Zero fields are unlimited.
+type ServiceLimits struct {
+	PerPeerRate  int64 // bytes/sec for each remote peer
+	TotalRate    int64 // bytes/sec for all peers combined
+	DailyQuota   int64 // bytes per UTC calendar day
+	MonthlyQuota int64 // bytes per UTC calendar month
+}
+
+// IsZero reports whether no limit is set.
+func (l ServiceLimits) IsZero() bool {
+	return l == ServiceLimits{}
+}
+
+// tokenBucket is a byte-rate limiter. Callers reserve bytes up front and
+// sleep for the returned delay; the bucket may go into debt so a transfer
+// larger than the burst is still paced correctly.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate int64) *tokenBucket {
+	return &tokenBucket{
+		rate:   float64(rate),
+		burst:  float64(rate), // one second of traffic
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller
+// must wait before sending them.
+func (b *tokenBucket) reserve(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// quotaUsage is the byte count for one service in the current periods.
+type quotaUsage struct {
+	Day        string `json:"day"` // 2006-01-02 (UTC)
+	DayBytes   int64  `json:"day_bytes"`
+	Month      string `json:"month"` // 2006-01 (UTC)
+	MonthBytes int64  `json:"month_bytes"`
+}
+
+// roll resets counters whose period has ended.
+func (u *quotaUsage) roll(now time.Time) {
+	now = now.UTC()
+	if day := now.Format(time.DateOnly); u.Day != day {
+		u.Day, u.DayBytes = day, 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month, u.MonthBytes = month, 0
+	}
+}
+
+// quotaStoreFile is the on-disk representation of a QuotaStore.
+type quotaStoreFile struct {
+	Version  int                    `json:"version"`
+	Services map[string]*quotaUsage `json:"services"`
+}
+
+// QuotaStore tracks per-service data usage for daily and monthly quotas and
+// persists it so a daemon restart doesn't hand out a fresh allowance.
+type QuotaStore struct {
+	path string // empty = memory only
+
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+	dirty bool
+}
+
+// NewQuotaStore loads quota usage from path. A missing file yields an empty
+// store; the file is created on the first Save. An empty path keeps usage in
+// memory only.
+func NewQuotaStore(path string) (*QuotaStore, error) {
+	qs := &QuotaStore{path: path, usage: make(map[string]*quotaUsage)}
+	if path == "" {
+		return qs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return qs, nil
+		}
+		return nil, fmt.Errorf("failed to read quota store: %w", err)
+	}
+
+	var file quotaStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse quota store %s: %w", path, err)
+	}
+	if file.Version != quotaStoreFileVersion {
+		return nil, fmt.Errorf("unsupported quota store version %d in %s", file.Version, path)
+	}
+	for name, u := range file.Services {
+		if u != nil {
+			qs.usage[name] = u
+		}
+	}
+	return qs, nil
+}
+
+// Add records n bytes for service and returns the usage in the current day
+// and month.
+func (qs *QuotaStore) Add(service string, n int64, now time.Time) (day, month int64) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	u := qs.usageLocked(service, now)
+	u.DayBytes += n
+	u.MonthBytes += n
+	qs.dirty = true
+	return u.DayBytes, u.MonthBytes
+}
+
+// Usage returns the bytes used by service in the current day and month.
+func (qs *QuotaStore) Usage(service string, now time.Time) (day, month int64) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	u := qs.usageLocked(service, now)
+	return u.DayBytes, u.MonthBytes
+}
+
+func (qs *QuotaStore) usageLocked(service string, now time.Time) *quotaUsage {
+	u, ok := qs.usage[service]
+	if !ok {
+		u = &quotaUsage{}
+		qs.usage[service] = u
+	}
+	u.roll(now)
+	return u
+}
+
+// Save writes usage to disk atomically if it changed since the last save.
+func (qs *QuotaStore) Save() error {
+	if qs.path == "" {
+		return nil
+	}
+
+	qs.mu.Lock()
+	if !qs.dirty {
+		qs.mu.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(quotaStoreFile{Version: quotaStoreFileVersion, Services: qs.usage}, "", "  ")
+	qs.dirty = false
+	qs.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal quota store: %w", err)
+	}
+
+	if err := qs.writeFile(data); err != nil {
+		qs.markDirty()
+		return err
+	}
+	return nil
+}
+
+// writeFile replaces the quota file atomically via temp file + fsync + rename.
+func (qs *QuotaStore) writeFile(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(qs.path), ".service_quota.*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	tmp.Close()
+
+	if err := os.Rename(tmpPath, qs.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to update quota store: %w", err)
+	}
+	return nil
+}
+
+func (qs *QuotaStore) markDirty() {
+	qs.mu.Lock()
+	qs.dirty = true
+	qs.mu.Unlock()
+}
+
+// BandwidthManager enforces per-service rate limits and quotas on the
+// serving side of the proxy path. All methods are nil-safe: a nil
+// *BandwidthManager applies no limits.
+type BandwidthManager struct {
+	quota   *QuotaStore
+	metrics *Metrics     // nil-safe
+	audit   *AuditLogger // nil-safe
+
+	mu       sync.RWMutex
+	services map[string]*serviceLimiter
+}
+
+// serviceLimiter holds the buckets for one service.
+type serviceLimiter struct {
+	name   string
+	limits ServiceLimits
+	total  *tokenBucket // nil if no aggregate rate
+
+	mu      sync.Mutex
+	perPeer map[peer.ID]*peerBucket
+}
+
+// peerBucket is a per-peer bucket shared by all of that peer's connections.
+type peerBucket struct {
+	bucket *tokenBucket
+	refs   int
+}
+
+// NewBandwidthManager creates a manager that records quota usage in store
+// (required when any service has a quota). metrics and audit may be nil.
+func NewBandwidthManager(store *QuotaStore, metrics *Metrics, audit *AuditLogger) *BandwidthManager {
+	return &BandwidthManager{
+		quota:    store,
+		metrics:  metrics,
+		audit:    audit,
+		services: make(map[string]*serviceLimiter),
+	}
+}
+
+// SetLimits applies limits to service, replacing any previous limits.
+// Connections already open keep the buckets they started with.
+func (bm *BandwidthManager) SetLimits(service string, limits ServiceLimits) {
+	if bm == nil {
+		return
+	}
+	if limits.IsZero() {
+		bm.RemoveLimits(service)
+		return
+	}
+	sl := &serviceLimiter{
+		name:    service,
+		limits:  limits,
+		perPeer: make(map[peer.ID]*peerBucket),
+	}
+	if limits.TotalRate > 0 {
+		sl.total = newTokenBucket(limits.TotalRate)
+	}
+
+	bm.mu.Lock()
+	bm.services[service] = sl
+	bm.mu.Unlock()
+	bm.updateQuotaGauges(service, time.Now())
+}
+
+// RemoveLimits removes all limits from service.
+func (bm *BandwidthManager) RemoveLimits(service string) {
+	if bm == nil {
+		return
+	}
+	bm.mu.Lock()
+	delete(bm.services, service)
+	bm.mu.Unlock()
+}
+
+// Limits returns the limits configured for service.
+func (bm *BandwidthManager) Limits(service string) (ServiceLimits, bool) {
+	if bm == nil {
+		return ServiceLimits{}, false
+	}
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	sl, ok := bm.services[service]
+	if !ok {
+		return ServiceLimits{}, false
+	}
+	return sl.limits, true
+}
+
+func (bm *BandwidthManager) limiter(service string) *serviceLimiter {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	return bm.services[service]
+}
+
+// Admit checks whether peerID may open a new connection to service. It
+// returns ErrQuotaExceeded (and logs an audit event) when the service has
+// used up its daily or monthly quota.
+func (bm *BandwidthManager) Admit(service string, peerID peer.ID) error {
+	if bm == nil {
+		return nil
+	}
+	sl := bm.limiter(service)
+	if sl == nil {
+		return nil
+	}
+	if period := bm.exhausted(sl, time.Now()); period != "" {
+		bm.recordQuotaExceeded(sl.name, peerID, period)
+		return fmt.Errorf("%w: %s %s quota", ErrQuotaExceeded, service, period)
+	}
+	return nil
+}
+
+// Wrap returns conn with the service's limits applied to data in both
+// directions. conn is returned unchanged when service has no limits.
+func (bm *BandwidthManager) Wrap(service string, peerID peer.ID, conn HalfCloseConn) HalfCloseConn {
+	if bm == nil {
+		return conn
+	}
+	sl := bm.limiter(service)
+	if sl == nil {
+		return conn
+	}
+
+	lc := &limitedConn{
+		HalfCloseConn: conn,
+		bm:            bm,
+		sl:            sl,
+		peer:          peerID,
+		chunk:         maxLimitedChunk,
+	}
+	rate := sl.limits.TotalRate
+	if sl.limits.PerPeerRate > 0 {
+		lc.peerBucket = sl.acquire(peerID)
+		if rate == 0 || sl.limits.PerPeerRate < rate {
+			rate = sl.limits.PerPeerRate
+		}
+	}
+	if rate > 0 {
+		lc.chunk = int(min(max(rate/8, minLimitedChunk), maxLimitedChunk))
+	}
+	return lc
+}
+
+// acquire returns the shared bucket for peerID, creating it if needed.
+func (sl *serviceLimiter) acquire(peerID peer.ID) *tokenBucket {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	pb, ok := sl.perPeer[peerID]
+	if !ok {
+		pb = &peerBucket{bucket: newTokenBucket(sl.limits.PerPeerRate)}
+		sl.perPeer[peerID] = pb
+	}
+	pb.refs++
+	return pb.bucket
+}
+
+// release drops a reference to peerID's bucket, deleting it with the last one.
+func (sl *serviceLimiter) release(peerID peer.ID) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+	if pb, ok := sl.perPeer[peerID]; ok {
+		pb.refs--
+		if pb.refs <= 0 {
+			delete(sl.perPeer, peerID)
+		}
+	}
+}
+
+// exhausted returns the quota period that is used up, or "".
+func (bm *BandwidthManager) exhausted(sl *serviceLimiter, now time.Time) string {
+	if bm.quota == nil || (sl.limits.DailyQuota == 0 && sl.limits.MonthlyQuota == 0) {
+		return ""
+	}
+	day, month := bm.quota.Usage(sl.name, now)
+	switch {
+	case sl.limits.DailyQuota > 0 && day >= sl.limits.DailyQuota:
+		return QuotaPeriodDaily
+	case sl.limits.MonthlyQuota > 0 && month >= sl.limits.MonthlyQuota:
+		return QuotaPeriodMonthly
+	}
+	return ""
+}
+
+// account records n transferred bytes against the service's quotas.
+func (bm *BandwidthManager) account(sl *serviceLimiter, n int, now time.Time) {
+	if bm.quota == nil || (sl.limits.DailyQuota == 0 && sl.limits.MonthlyQuota == 0) {
+		return
+	}
+	day, month := bm.quota.Add(sl.name, int64(n), now)
+	if bm.metrics != nil {
+		bm.metrics.ServiceQuotaUsedBytes.WithLabelValues(sl.name, QuotaPeriodDaily).Set(float64(day))
+		bm.metrics.ServiceQuotaUsedBytes.WithLabelValues(sl.name, QuotaPeriodMonthly).Set(float64(month))
+	}
+}
+
+func (bm *BandwidthManager) updateQuotaGauges(service string, now time.Time) {
+	if bm.metrics == nil || bm.quota == nil {
+		return
+	}
+	day, month := bm.quota.Usage(service, now)
+	bm.metrics.ServiceQuotaUsedBytes.WithLabelValues(service, QuotaPeriodDaily).Set(float64(day))
+	bm.metrics.ServiceQuotaUsedBytes.WithLabelValues(service, QuotaPeriodMonthly).Set(float64(month))
+}
+
+func (bm *BandwidthManager) recordQuotaExceeded(service string, peerID peer.ID, period string) {
+	slog.Warn("service quota exceeded", "service", service, "peer", peerID.String()[:16]+"...", "period", period)
+	if bm.metrics != nil {
+		bm.metrics.ServiceQuotaExceededTotal.WithLabelValues(service, period).Inc()
+	}
+	bm.audit.ServiceQuotaExceeded(peerID.String(), service, period)
+}
+
+// limitedConn applies a service's rate limits and quotas to one connection.
+type limitedConn struct {
+	HalfCloseConn
+	bm         *BandwidthManager
+	sl         *serviceLimiter
+	peer       peer.ID
+	peerBucket *tokenBucket // nil if no per-peer rate
+	chunk      int
+
+	throttled   [2]atomic.Bool // audit once per scope: [peer, total]
+	exceeded    [2]atomic.Bool // record once per period: [daily, monthly]
+	releaseOnce sync.Once
+}
+
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if err := c.checkQuota(); err != nil {
+		return 0, err
+	}
+	if len(p) > c.chunk {
+		p = p[:c.chunk]
+	}
+	n, err := c.HalfCloseConn.Read(p)
+	if n > 0 {
+		c.consume(n)
+	}
+	return n, err
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if err := c.checkQuota(); err != nil {
+			return written, err
+		}
+		chunk := p[:min(len(p), c.chunk)]
+		c.consume(len(chunk))
+		n, err := c.HalfCloseConn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (c *limitedConn) Close() error {
+	c.releaseOnce.Do(func() {
+		if c.peerBucket != nil {
+			c.sl.release(c.peer)
+		}
+	})
+	return c.HalfCloseConn.Close()
+}
+
+// checkQuota fails the transfer once the service's quota is used up.
+// The overrun is logged and audited once per connection and period, not on
+// every Read or Write that follows.
+func (c *limitedConn) checkQuota() error {
+	if period := c.bm.exhausted(c.sl, time.Now()); period != "" {
+		idx := 0
+		if period == QuotaPeriodMonthly {
+			idx = 1
+		}
+		if c.exceeded[idx].CompareAndSwap(false, true) {
+			c.bm.recordQuotaExceeded(c.sl.name, c.peer, period)
+		}
+		return fmt.Errorf("%w: %s %s quota", ErrQuotaExceeded, c.sl.name, period)
+	}
+	return nil
+}
+
+// consume charges n bytes to the quota and waits for rate limit tokens.
+func (c *limitedConn) consume(n int) {
+	now := time.Now()
+	c.bm.account(c.sl, n, now)
+
+	var peerWait, totalWait time.Duration
+	if c.peerBucket != nil {
+		peerWait = c.peerBucket.reserve(n, now)
+	}
+	if c.sl.total != nil {
+		totalWait = c.sl.total.reserve(n, now)
+	}
+	if peerWait == 0 && totalWait == 0 {
+		return
+	}
+
+	scope := "peer"
+	if totalWait > peerWait {
+		scope = "total"
+	}
+	c.recordThrottle(scope)
+	time.Sleep(max(peerWait, totalWait))
+}
+
+func (c *limitedConn) recordThrottle(scope string) {
+	if c.bm.metrics != nil {
+		c.bm.metrics.ServiceThrottledTotal.WithLabelValues(c.sl.name, scope).Inc()
+	}
+	idx := 0
+	if scope == "total" {
+		idx = 1
+	}
+	if c.throttled[idx].CompareAndSwap(false, true) {
+		c.bm.audit.ServiceThrottled(c.peer.String(), c.sl.name, scope)
+	}
+}
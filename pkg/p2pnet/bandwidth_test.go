@@ -0,0 +1,213 @@
+package p2pnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTokenBucketPacesAfterBurst(t *testing.T) {
+	start := time.Now()
+	b := newTokenBucket(1000)
+	b.last = start
+
+	if d := b.reserve(1000, start); d != 0 {
+		t.Errorf("first second of traffic should be free, got wait %v", d)
+	}
+	if d := b.reserve(500, start); d != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms", d)
+	}
+	// After the debt is repaid, tokens accrue again up to the burst.
+	if d := b.reserve(100, start.Add(2*time.Second)); d != 0 {
+		t.Errorf("wait after refill = %v, want 0", d)
+	}
+}
+
+func TestQuotaStoreRollsOverPeriods(t *testing.T) {
+	qs, _ := NewQuotaStore("")
+	day1 := time.Date(2026, 3, 30, 23, 0, 0, 0, time.UTC)
+
+	qs.Add("ssh", 100, day1)
+	if d, m := qs.Usage("ssh", day1); d != 100 || m != 100 {
+		t.Fatalf("usage = %d/%d, want 100/100", d, m)
+	}
+
+	// Next day, same month: daily resets, monthly carries on.
+	day2 := day1.Add(2 * time.Hour)
+	qs.Add("ssh", 50, day2)
+	if d, m := qs.Usage("ssh", day2); d != 50 || m != 150 {
+		t.Errorf("usage on next day = %d/%d, want 50/150", d, m)
+	}
+
+	// New month: both reset.
+	if d, m := qs.Usage("ssh", day2.Add(24*time.Hour)); d != 0 || m != 0 {
+		t.Errorf("usage in new month = %d/%d, want 0/0", d, m)
+	}
+}
+
+func TestQuotaStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), QuotaStoreFileName)
+	now := time.Now()
+
+	qs, err := NewQuotaStore(path)
+	if err != nil {
+		t.Fatalf("NewQuotaStore: %v", err)
+	}
+	qs.Add("backup", 4096, now)
+	if err := qs.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	reloaded, err := NewQuotaStore(path)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if d, m := reloaded.Usage("backup", now); d != 4096 || m != 4096 {
+		t.Errorf("reloaded usage = %d/%d, want 4096/4096", d, m)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("quota file mode = %v, err = %v", info.Mode().Perm(), err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+}
+
+func TestQuotaStoreRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), QuotaStoreFileName)
+	data, _ := json.Marshal(quotaStoreFile{Version: 99})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewQuotaStore(path); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("err = %v, want version error", err)
+	}
+}
+
+func TestBandwidthManagerNilSafe(t *testing.T) {
+	var bm *BandwidthManager
+	bm.SetLimits("ssh", ServiceLimits{TotalRate: 1})
+	if err := bm.Admit("ssh", genTestPeerID(t)); err != nil {
+		t.Errorf("Admit on nil manager: %v", err)
+	}
+	conn := &pipeConn{}
+	if got := bm.Wrap("ssh", genTestPeerID(t), conn); got != conn {
+		t.Error("nil manager should return conn unchanged")
+	}
+}
+
+func TestBandwidthManagerUnlimitedServicePassesThrough(t *testing.T) {
+	bm := NewBandwidthManager(nil, nil, nil)
+	bm.SetLimits("ssh", ServiceLimits{TotalRate: 1000})
+
+	conn := &pipeConn{}
+	if got := bm.Wrap("web", genTestPeerID(t), conn); got != conn {
+		t.Error("service without limits should not be wrapped")
+	}
+	bm.SetLimits("ssh", ServiceLimits{})
+	if _, ok := bm.Limits("ssh"); ok {
+		t.Error("zero limits should remove the service's limits")
+	}
+}
+
+func TestBandwidthManagerRateLimit(t *testing.T) {
+	m := NewMetrics("test", "go1.0")
+	bm := NewBandwidthManager(nil, m, nil)
+	bm.SetLimits("backup", ServiceLimits{PerPeerRate: 64 << 10})
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go io.Copy(io.Discard, remote)
+
+	conn := bm.Wrap("backup", genTestPeerID(t), &pipeConn{local})
+	defer conn.Close()
+
+	// 64 KiB burst + 32 KiB more must take about half a second.
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, 96<<10)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("96 KiB at 64 KiB/s took %v, want >= ~500ms", elapsed)
+	}
+	if got := testutil.ToFloat64(m.ServiceThrottledTotal.WithLabelValues("backup", "peer")); got == 0 {
+		t.Error("expected throttled counter to increase")
+	}
+}
+
+func TestBandwidthManagerPerPeerBucketShared(t *testing.T) {
+	bm := NewBandwidthManager(nil, nil, nil)
+	bm.SetLimits("ssh", ServiceLimits{PerPeerRate: 1000})
+	sl := bm.limiter("ssh")
+	pid := genTestPeerID(t)
+
+	c1 := bm.Wrap("ssh", pid, &pipeConn{})
+	c2 := bm.Wrap("ssh", pid, &pipeConn{})
+	if c1.(*limitedConn).peerBucket != c2.(*limitedConn).peerBucket {
+		t.Error("connections from one peer should share a bucket")
+	}
+	c3 := bm.Wrap("ssh", genTestPeerID(t), &pipeConn{})
+	if c3.(*limitedConn).peerBucket == c1.(*limitedConn).peerBucket {
+		t.Error("different peers should have separate buckets")
+	}
+
+	c1.(*limitedConn).releaseOnce.Do(func() { sl.release(pid) })
+	c2.(*limitedConn).releaseOnce.Do(func() { sl.release(pid) })
+	if len(sl.perPeer) != 1 {
+		t.Errorf("perPeer buckets = %d, want 1 after releasing both of one peer's conns", len(sl.perPeer))
+	}
+}
+
+func TestBandwidthManagerQuota(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLogger(slog.NewJSONHandler(&buf, nil))
+	m := NewMetrics("test", "go1.0")
+	store, _ := NewQuotaStore("")
+	bm := NewBandwidthManager(store, m, audit)
+	bm.SetLimits("backup", ServiceLimits{DailyQuota: 1000})
+	pid := genTestPeerID(t)
+
+	if err := bm.Admit("backup", pid); err != nil {
+		t.Fatalf("Admit before use: %v", err)
+	}
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	go io.Copy(io.Discard, remote)
+	conn := bm.Wrap("backup", pid, &pipeConn{local})
+	defer conn.Close()
+
+	if _, err := conn.Write(make([]byte, 1000)); err != nil {
+		t.Fatalf("Write within quota: %v", err)
+	}
+	if _, err := conn.Write([]byte("x")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Write over quota: err = %v, want ErrQuotaExceeded", err)
+	}
+	// Retries on the same connection fail without recording again.
+	for range 3 {
+		conn.Write([]byte("x"))
+	}
+	if err := bm.Admit("backup", pid); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Admit over quota: err = %v, want ErrQuotaExceeded", err)
+	}
+
+	if got := testutil.ToFloat64(m.ServiceQuotaUsedBytes.WithLabelValues("backup", QuotaPeriodDaily)); got != 1000 {
+		t.Errorf("quota used gauge = %v, want 1000", got)
+	}
+	if got := testutil.ToFloat64(m.ServiceQuotaExceededTotal.WithLabelValues("backup", QuotaPeriodDaily)); got != 2 {
+		t.Errorf("quota exceeded counter = %v, want 2", got)
+	}
+	if !strings.Contains(buf.String(), "service_quota_exceeded") {
+		t.Errorf("audit log missing service_quota_exceeded: %s", buf.String())
+	}
+}
@@ -0,0 +1,474 @@
+package p2pnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/satindergrewal/peer-up/internal/validate"
+)
+
+// DirectoryFileName is the directory store kept next to peerup.yaml.
+const DirectoryFileName = "directory.json"
+
+// Directory limits.
+const (
+	directoryFileVersion = 1
+	directorySignedTag   = "peerup-directory/1"
+	maxDirectoryEntries  = 256 // names (including tombstones) or services per record
+	maxDirectoryNameLen  = 63
+
+	// maxDirectoryClock bounds name clocks. It is far above any clock
+	// reached by real edits, and keeps a forged record from pushing the
+	// next clock past the uint64 range so this node's edits stop winning.
+	maxDirectoryClock = 1 << 53
+)
+
+// DirectoryName is one name → peer ID binding published by an origin.
+// Clock is a Lamport timestamp: a node stamps a new or changed binding
+// with one more than the highest clock it has seen anywhere, so the
+// latest edit wins across origins. Deleted bindings are kept as
+// tombstones so removals propagate.
+type DirectoryName struct {
+	Name    string `json:"name"`
+	PeerID  string `json:"peer_id,omitempty"` // empty for tombstones
+	Clock   uint64 `json:"clock"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// DirectoryService is a service an origin advertises.
+type DirectoryService struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol,omitempty"` // "udp", or empty for TCP
+}
+
+// DirectoryRecord is one node's signed contribution to the shared
+// directory. Only the origin can sign its record, and receivers keep the
+// highest Version per origin.
+type DirectoryRecord struct {
+	Origin   string             `json:"origin"`
+	Version  uint64             `json:"version"` // bumped on every change
+	Updated  int64              `json:"updated"` // unix seconds
+	Names    []DirectoryName    `json:"names,omitempty"`
+	Services []DirectoryService `json:"services,omitempty"`
+	Sig      []byte             `json:"sig"`
+}
+
+// DirectoryEntry is a name in the merged directory view.
+type DirectoryEntry struct {
+	Name    string
+	PeerID  peer.ID
+	Origin  peer.ID // node whose edit won
+	Clock   uint64
+	Updated time.Time
+}
+
+// DirectoryServiceEntry is an advertised service in the merged view.
+type DirectoryServiceEntry struct {
+	Origin   peer.ID
+	Name     string
+	Protocol string
+}
+
+// signedBytes is the message the origin signs: the canonical JSON of the
+// record without its signature. Names and services are kept sorted.
+func (r *DirectoryRecord) signedBytes() ([]byte, error) {
+	unsigned := *r
+	unsigned.Sig = nil
+	data, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(directorySignedTag+"\n"), data...), nil
+}
+
+// Verify checks the record's contents and the origin's signature and
+// returns the decoded origin.
+func (r *DirectoryRecord) Verify() (peer.ID, error) {
+	origin, err := peer.Decode(r.Origin)
+	if err != nil {
+		return "", fmt.Errorf("%w: bad origin peer ID: %w", ErrInvalidDirectoryRecord, err)
+	}
+	if len(r.Names) > maxDirectoryEntries || len(r.Services) > maxDirectoryEntries {
+		return "", fmt.Errorf("%w: more than %d entries", ErrInvalidDirectoryRecord, maxDirectoryEntries)
+	}
+	seen := make(map[string]bool, len(r.Names))
+	for _, n := range r.Names {
+		if err := validDirectoryName(n.Name); err != nil {
+			return "", err
+		}
+		if seen[n.Name] {
+			return "", fmt.Errorf("%w: duplicate name %q", ErrInvalidDirectoryRecord, n.Name)
+		}
+		seen[n.Name] = true
+		if n.Clock > maxDirectoryClock {
+			return "", fmt.Errorf("%w: clock %d for %q exceeds %d", ErrInvalidDirectoryRecord, n.Clock, n.Name, uint64(maxDirectoryClock))
+		}
+		if !n.Deleted {
+			if _, err := peer.Decode(n.PeerID); err != nil {
+				return "", fmt.Errorf("%w: bad peer ID for %q: %w", ErrInvalidDirectoryRecord, n.Name, err)
+			}
+		}
+	}
+	for _, s := range r.Services {
+		if err := validate.ServiceName(s.Name); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidDirectoryRecord, err)
+		}
+	}
+
+	msg, err := r.signedBytes()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidDirectoryRecord, err)
+	}
+	pub, err := origin.ExtractPublicKey()
+	if err != nil {
+		return "", fmt.Errorf("%w: cannot extract origin public key: %w", ErrInvalidDirectoryRecord, err)
+	}
+	ok, err := pub.Verify(msg, r.Sig)
+	if err != nil || !ok {
+		return "", fmt.Errorf("%w: bad signature", ErrInvalidDirectoryRecord)
+	}
+	return origin, nil
+}
+
+// validDirectoryName accepts 1-63 letters, digits, '-', '_' or '.'.
+func validDirectoryName(name string) error {
+	if name == "" || len(name) > maxDirectoryNameLen {
+		return fmt.Errorf("%w: name %q must be 1-%d characters", ErrInvalidDirectoryRecord, name, maxDirectoryNameLen)
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return fmt.Errorf("%w: name %q contains %q", ErrInvalidDirectoryRecord, name, c)
+		}
+	}
+	return nil
+}
+
+// directoryFile is the on-disk representation of a Directory.
+type directoryFile struct {
+	Version int                `json:"version"`
+	Records []*DirectoryRecord `json:"records"`
+}
+
+// Directory holds the latest signed record from every origin (this node
+// included) and computes the merged name view. Every change rewrites the
+// file atomically (temp file + rename).
+type Directory struct {
+	path    string
+	mu      sync.RWMutex
+	records map[peer.ID]*DirectoryRecord
+}
+
+// OpenDirectory loads the directory store at path. A missing file yields
+// an empty directory; the file is created on the first change.
+func OpenDirectory(path string) (*Directory, error) {
+	d := &Directory{path: path, records: make(map[peer.ID]*DirectoryRecord)}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	var file directoryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse directory %s: %w", path, err)
+	}
+	if file.Version != directoryFileVersion {
+		return nil, fmt.Errorf("unsupported directory version %d in %s", file.Version, path)
+	}
+	for _, r := range file.Records {
+		origin, err := r.Verify()
+		if err != nil {
+			slog.Warn("directory: dropping stored record", "origin", r.Origin, "err", err)
+			continue
+		}
+		d.records[origin] = r
+	}
+	return d, nil
+}
+
+// Record returns the stored record for origin, or nil.
+func (d *Directory) Record(origin peer.ID) *DirectoryRecord {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.records[origin]
+}
+
+// Records returns every stored record, ordered by origin.
+func (d *Directory) Records() []*DirectoryRecord {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.sortedLocked()
+}
+
+// Merge stores r if it verifies and is newer than the record held for its
+// origin. Returns false for stale or duplicate records.
+func (d *Directory) Merge(r *DirectoryRecord) (bool, error) {
+	origin, err := r.Verify()
+	if err != nil {
+		return false, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev := d.records[origin]
+	if prev != nil && prev.Version >= r.Version {
+		return false, nil
+	}
+	d.records[origin] = r
+	if err := d.saveLocked(); err != nil {
+		if prev != nil {
+			d.records[origin] = prev
+		} else {
+			delete(d.records, origin)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Prune drops the records of origins for which keep returns false, e.g.
+// peers removed from authorized_keys. Returns the number dropped.
+func (d *Directory) Prune(keep func(peer.ID) bool) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	dropped := 0
+	for origin := range d.records {
+		if !keep(origin) {
+			delete(d.records, origin)
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		return 0, nil
+	}
+	return dropped, d.saveLocked()
+}
+
+// Publish signs a new record for the key's peer ID from its current names
+// and services. Bindings that did not change keep their clock; new or
+// changed ones, and tombstones for removed ones, get a clock above every
+// clock in the directory so they win over earlier edits from any origin.
+// Returns the current record and whether a new version was published.
+// Names that are not valid directory names are skipped.
+func (d *Directory) Publish(key crypto.PrivKey, names map[string]string, services []DirectoryService, now time.Time) (*DirectoryRecord, bool, error) {
+	self, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to derive peer ID: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	prev := d.records[self]
+	next := min(d.maxClockLocked(), maxDirectoryClock-1) + 1
+
+	prevNames := make(map[string]DirectoryName)
+	if prev != nil {
+		for _, n := range prev.Names {
+			prevNames[n.Name] = n
+		}
+	}
+
+	var out []DirectoryName
+	for name, pidStr := range names {
+		if err := validDirectoryName(name); err != nil {
+			slog.Warn("directory: skipping name", "err", err)
+			continue
+		}
+		pid, err := peer.Decode(pidStr)
+		if err != nil {
+			slog.Warn("directory: skipping name", "name", name, "err", err)
+			continue
+		}
+		if old, ok := prevNames[name]; ok && !old.Deleted && old.PeerID == pid.String() {
+			out = append(out, old)
+		} else {
+			out = append(out, DirectoryName{Name: name, PeerID: pid.String(), Clock: next})
+		}
+	}
+	var tombstones []DirectoryName
+	for name, old := range prevNames {
+		if _, ok := names[name]; ok {
+			continue
+		}
+		if old.Deleted {
+			tombstones = append(tombstones, old)
+		} else {
+			tombstones = append(tombstones, DirectoryName{Name: name, Clock: next, Deleted: true})
+		}
+	}
+	// Oldest tombstones are forgotten first when the record is full.
+	sort.Slice(tombstones, func(i, j int) bool { return tombstones[i].Clock > tombstones[j].Clock })
+	if room := maxDirectoryEntries - len(out); room < len(tombstones) {
+		tombstones = tombstones[:max(room, 0)]
+	}
+	out = append(out, tombstones...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	if len(out) > maxDirectoryEntries {
+		return nil, false, fmt.Errorf("too many names: %d (max %d)", len(out), maxDirectoryEntries)
+	}
+
+	svcs := append([]DirectoryService(nil), services...)
+	sort.Slice(svcs, func(i, j int) bool { return svcs[i].Name < svcs[j].Name })
+	if len(svcs) > maxDirectoryEntries {
+		return nil, false, fmt.Errorf("too many services: %d (max %d)", len(svcs), maxDirectoryEntries)
+	}
+
+	if prev != nil && slices.Equal(prev.Names, out) && slices.Equal(prev.Services, svcs) {
+		return prev, false, nil
+	}
+
+	r := &DirectoryRecord{
+		Origin:   self.String(),
+		Updated:  now.Unix(),
+		Names:    out,
+		Services: svcs,
+	}
+	if prev != nil {
+		r.Version = prev.Version + 1
+	} else {
+		r.Version = 1
+	}
+	msg, err := r.signedBytes()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode directory record: %w", err)
+	}
+	if r.Sig, err = key.Sign(msg); err != nil {
+		return nil, false, fmt.Errorf("failed to sign directory record: %w", err)
+	}
+
+	d.records[self] = r
+	if err := d.saveLocked(); err != nil {
+		if prev != nil {
+			d.records[self] = prev
+		} else {
+			delete(d.records, self)
+		}
+		return nil, false, err
+	}
+	return r, true, nil
+}
+
+// Names returns the merged name view. For each name the binding with the
+// highest clock wins (ties go to the higher origin peer ID, so every node
+// picks the same winner); names whose winner is a tombstone are omitted.
+func (d *Directory) Names() []DirectoryEntry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	type candidate struct {
+		n      DirectoryName
+		origin peer.ID
+		rec    *DirectoryRecord
+	}
+	winners := make(map[string]candidate)
+	for origin, r := range d.records {
+		for _, n := range r.Names {
+			cur, ok := winners[n.Name]
+			if ok && (cur.n.Clock > n.Clock || (cur.n.Clock == n.Clock && cur.origin > origin)) {
+				continue
+			}
+			winners[n.Name] = candidate{n: n, origin: origin, rec: r}
+		}
+	}
+
+	var out []DirectoryEntry
+	for name, c := range winners {
+		if c.n.Deleted {
+			continue
+		}
+		pid, err := peer.Decode(c.n.PeerID)
+		if err != nil {
+			continue // rejected by Verify; defensive
+		}
+		out = append(out, DirectoryEntry{
+			Name:    name,
+			PeerID:  pid,
+			Origin:  c.origin,
+			Clock:   c.n.Clock,
+			Updated: time.Unix(c.rec.Updated, 0),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Services returns every advertised service, ordered by origin then name.
+func (d *Directory) Services() []DirectoryServiceEntry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var out []DirectoryServiceEntry
+	for _, r := range d.sortedLocked() {
+		origin, _ := peer.Decode(r.Origin)
+		for _, s := range r.Services {
+			out = append(out, DirectoryServiceEntry{Origin: origin, Name: s.Name, Protocol: s.Protocol})
+		}
+	}
+	return out
+}
+
+func (d *Directory) maxClockLocked() uint64 {
+	var clock uint64
+	for _, r := range d.records {
+		for _, n := range r.Names {
+			clock = max(clock, n.Clock)
+		}
+	}
+	return clock
+}
+
+func (d *Directory) sortedLocked() []*DirectoryRecord {
+	out := make([]*DirectoryRecord, 0, len(d.records))
+	for _, r := range d.records {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Origin < out[j].Origin })
+	return out
+}
+
+func (d *Directory) saveLocked() error {
+	data, err := json.MarshalIndent(directoryFile{
+		Version: directoryFileVersion,
+		Records: d.sortedLocked(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), ".directory.*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op after a successful rename
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set temp file permissions: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		return fmt.Errorf("failed to update directory: %w", err)
+	}
+	return nil
+}
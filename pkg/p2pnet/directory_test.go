@@ -0,0 +1,264 @@
+package p2pnet
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+func dirKey(t *testing.T) (crypto.PrivKey, peer.ID) {
+	t.Helper()
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := peer.IDFromPrivateKey(priv)
+	return priv, pid
+}
+
+func openTestDirectory(t *testing.T) *Directory {
+	t.Helper()
+	d, err := OpenDirectory(filepath.Join(t.TempDir(), DirectoryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func namesByName(d *Directory) map[string]DirectoryEntry {
+	out := make(map[string]DirectoryEntry)
+	for _, e := range d.Names() {
+		out[e.Name] = e
+	}
+	return out
+}
+
+func TestDirectoryPublish(t *testing.T) {
+	key, self := dirKey(t)
+	_, home := dirKey(t)
+	_, nas := dirKey(t)
+	d := openTestDirectory(t)
+	now := time.Now()
+
+	r1, published, err := d.Publish(key, map[string]string{"home": home.String()}, []DirectoryService{{Name: "ssh"}}, now)
+	if err != nil || !published {
+		t.Fatalf("Publish() = %v, %v", published, err)
+	}
+	if r1.Version != 1 || r1.Names[0].Clock != 1 {
+		t.Errorf("first record = version %d, clock %d", r1.Version, r1.Names[0].Clock)
+	}
+	if origin, err := r1.Verify(); err != nil || origin != self {
+		t.Fatalf("Verify() = %s, %v", origin, err)
+	}
+
+	if _, published, _ := d.Publish(key, map[string]string{"home": home.String()}, []DirectoryService{{Name: "ssh"}}, now); published {
+		t.Error("unchanged names and services should not publish a new version")
+	}
+
+	// Replacing home with nas: nas is new, home becomes a tombstone.
+	r2, published, err := d.Publish(key, map[string]string{"nas": nas.String()}, nil, now)
+	if err != nil || !published || r2.Version != 2 {
+		t.Fatalf("Publish() = %+v, %v, %v", r2, published, err)
+	}
+	if len(r2.Names) != 2 || !r2.Names[0].Deleted || r2.Names[0].Clock != 2 || r2.Names[1].Clock != 2 {
+		t.Errorf("names = %+v, want home tombstone and nas at clock 2", r2.Names)
+	}
+	got := namesByName(d)
+	if _, ok := got["home"]; ok || got["nas"].PeerID != nas {
+		t.Errorf("merged view = %+v", got)
+	}
+
+	tampered := *r2
+	tampered.Version = 99
+	if _, err := tampered.Verify(); !errors.Is(err, ErrInvalidDirectoryRecord) {
+		t.Errorf("tampered record: err = %v, want ErrInvalidDirectoryRecord", err)
+	}
+
+	reopened, err := OpenDirectory(d.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := reopened.Record(self); r == nil || r.Version != 2 {
+		t.Errorf("reopened record = %+v", r)
+	}
+}
+
+func TestDirectoryLastWriterWins(t *testing.T) {
+	keyA, originA := dirKey(t)
+	keyB, originB := dirKey(t)
+	_, old := dirKey(t)
+	_, replacement := dirKey(t)
+	a, b := openTestDirectory(t), openTestDirectory(t)
+	now := time.Now()
+
+	// A names the NAS; B learns it, then points the name elsewhere.
+	rA, _, _ := a.Publish(keyA, map[string]string{"nas": old.String()}, nil, now)
+	if ok, err := b.Merge(rA); err != nil || !ok {
+		t.Fatalf("Merge() = %v, %v", ok, err)
+	}
+	rB, _, _ := b.Publish(keyB, map[string]string{"nas": replacement.String()}, nil, now)
+	if ok, _ := a.Merge(rB); !ok {
+		t.Fatal("Merge() rejected newer record")
+	}
+
+	for name, d := range map[string]*Directory{"a": a, "b": b} {
+		e := namesByName(d)["nas"]
+		if e.PeerID != replacement || e.Origin != originB {
+			t.Errorf("%s: nas = %s from %s, want later edit from B", name, e.PeerID, e.Origin)
+		}
+	}
+
+	// Re-merging an old version is a no-op.
+	if ok, err := a.Merge(rA); err != nil || ok {
+		t.Errorf("stale Merge() = %v, %v", ok, err)
+	}
+
+	// A then removes the name; the deletion is the latest edit and wins.
+	rA2, _, _ := a.Publish(keyA, nil, nil, now)
+	b.Merge(rA2)
+	if e, ok := namesByName(b)["nas"]; ok {
+		t.Errorf("nas = %s after a later deletion, want it gone", e.PeerID)
+	}
+
+	// B re-adding it stamps a higher clock, so the name comes back.
+	rB2, _, _ := b.Publish(keyB, map[string]string{"nas": old.String()}, nil, now)
+	a.Merge(rB2)
+	if e := namesByName(a)["nas"]; e.PeerID != old || e.Origin != originB {
+		t.Errorf("nas = %s from %s after B re-added it", e.PeerID, e.Origin)
+	}
+
+	// Pruning B's origin leaves only A's tombstone, so the name disappears.
+	if n, err := a.Prune(func(p peer.ID) bool { return p == originA }); err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v", n, err)
+	}
+	if _, ok := namesByName(a)["nas"]; ok {
+		t.Error("nas should be gone after pruning its only live binding")
+	}
+}
+
+// TestDirectoryClockBound checks that a record cannot push clocks to the
+// end of the uint64 range, where this node's next edit would wrap to 0.
+func TestDirectoryClockBound(t *testing.T) {
+	keyA, _ := dirKey(t)
+	keyB, originB := dirKey(t)
+	_, target := dirKey(t)
+	a := openTestDirectory(t)
+
+	forge := func(clock uint64) *DirectoryRecord {
+		r := &DirectoryRecord{
+			Origin:  originB.String(),
+			Version: clock,
+			Updated: time.Now().Unix(),
+			Names:   []DirectoryName{{Name: "nas", PeerID: target.String(), Clock: clock}},
+		}
+		msg, err := r.signedBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Sig, err = keyB.Sign(msg); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	if _, err := a.Merge(forge(math.MaxUint64)); !errors.Is(err, ErrInvalidDirectoryRecord) {
+		t.Errorf("Merge(max clock) error = %v, want ErrInvalidDirectoryRecord", err)
+	}
+	if ok, err := a.Merge(forge(maxDirectoryClock)); err != nil || !ok {
+		t.Fatalf("Merge(bound clock) = %v, %v", ok, err)
+	}
+	r, _, err := a.Publish(keyA, map[string]string{"nas": target.String()}, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Names[0].Clock != maxDirectoryClock {
+		t.Errorf("clock = %d, want it to saturate at %d", r.Names[0].Clock, uint64(maxDirectoryClock))
+	}
+}
+
+func TestDirectorySync(t *testing.T) {
+	type node struct {
+		key  crypto.PrivKey
+		sync *DirectorySync
+	}
+	newNode := func(authorized *map[peer.ID]bool) *node {
+		key, _ := dirKey(t)
+		h, err := libp2p.New(libp2p.Identity(key), libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		n := &node{key: key, sync: &DirectorySync{
+			Host:       h,
+			Directory:  openTestDirectory(t),
+			Authorized: func(p peer.ID) bool { return (*authorized)[p] },
+		}}
+		h.SetStreamHandler(protocol.ID(DirectoryProtocol), n.sync.HandleStream)
+		return n
+	}
+
+	authA, authB := map[peer.ID]bool{}, map[peer.ID]bool{}
+	a, b := newNode(&authA), newNode(&authB)
+	authA[b.sync.Host.ID()] = true
+	authB[a.sync.Host.ID()] = true
+
+	_, laptop := dirKey(t)
+	_, nas := dirKey(t)
+	now := time.Now()
+	a.sync.Directory.Publish(a.key, map[string]string{"laptop": laptop.String()}, []DirectoryService{{Name: "ssh"}}, now)
+	b.sync.Directory.Publish(b.key, map[string]string{"nas": nas.String()}, nil, now)
+
+	// A record from an origin B does not authorize is not passed on.
+	strangerKey, _ := dirKey(t)
+	stranger := openTestDirectory(t)
+	rec, _, _ := stranger.Publish(strangerKey, map[string]string{"evil": laptop.String()}, nil, now)
+	a.sync.Directory.Merge(rec)
+
+	var updates atomic.Int32
+	b.sync.OnUpdate = func(from peer.ID, updated []*DirectoryRecord) { updates.Add(int32(len(updated))) }
+
+	info := peer.AddrInfo{ID: b.sync.Host.ID(), Addrs: b.sync.Host.Addrs()}
+	if err := a.sync.Host.Connect(context.Background(), info); err != nil {
+		t.Fatal(err)
+	}
+	n, err := a.sync.SyncPeer(context.Background(), b.sync.Host.ID())
+	if err != nil {
+		t.Fatalf("SyncPeer() error = %v", err)
+	}
+	if n != 1 {
+		t.Errorf("SyncPeer() updated %d records on A, want 1", n)
+	}
+	if got := updates.Load(); got != 1 {
+		t.Errorf("B merged %d records, want 1 (stranger's record must be dropped)", got)
+	}
+
+	for name, d := range map[string]*Directory{"a": a.sync.Directory, "b": b.sync.Directory} {
+		got := namesByName(d)
+		if got["laptop"].PeerID != laptop || got["nas"].PeerID != nas {
+			t.Errorf("%s: merged view = %+v", name, got)
+		}
+	}
+	if _, ok := namesByName(b.sync.Directory)["evil"]; ok {
+		t.Error("B accepted a record from an unauthorized origin")
+	}
+	if svcs := b.sync.Directory.Services(); len(svcs) != 1 || svcs[0].Origin != a.sync.Host.ID() {
+		t.Errorf("B services = %+v", svcs)
+	}
+
+	t.Run("unauthorized peer is refused", func(t *testing.T) {
+		delete(authB, a.sync.Host.ID())
+		defer func() { authB[a.sync.Host.ID()] = true }()
+		if _, err := a.sync.SyncPeer(context.Background(), b.sync.Host.ID()); err == nil {
+			t.Error("expected error syncing with a peer that does not authorize us")
+		}
+	})
+}
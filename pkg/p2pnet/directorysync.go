@@ -0,0 +1,228 @@
+package p2pnet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DirectoryProtocol exchanges signed directory records between authorized
+// peers.
+const DirectoryProtocol = "/peerup/directory/1.0.0"
+
+// Directory sync wire limits.
+const (
+	maxDirectoryRecordsPerStream = 1024
+	maxDirectoryRecordSize       = 64 << 10
+	directorySyncTimeout         = 30 * time.Second
+)
+
+// DirectorySyncResult is the outcome of syncing with one peer.
+type DirectorySyncResult struct {
+	Peer    peer.ID
+	Updated int // records from this peer that were newer than ours
+	Err     error
+}
+
+// DirectorySync keeps a Directory in step with authorized peers. Each sync
+// is a full push-pull exchange: the initiator sends every record it holds,
+// the responder merges them and answers with its own. Records are only
+// accepted from authorized peers and only for origins that are this node
+// or authorized here, so a member cannot inject names on behalf of
+// strangers.
+type DirectorySync struct {
+	Host       host.Host
+	Directory  *Directory
+	Authorized func(peer.ID) bool
+
+	// OnUpdate is called after records received from peer from were merged.
+	OnUpdate func(from peer.ID, updated []*DirectoryRecord)
+}
+
+// WriteDirectoryRecords writes records as newline-delimited JSON.
+func WriteDirectoryRecords(w io.Writer, records []*DirectoryRecord) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return fmt.Errorf("failed to write directory record: %w", err)
+		}
+	}
+	return nil
+}
+
+// ReadDirectoryRecords reads newline-delimited JSON records until EOF.
+func ReadDirectoryRecords(r io.Reader) ([]*DirectoryRecord, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), maxDirectoryRecordSize)
+
+	var records []*DirectoryRecord
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		if len(records) == maxDirectoryRecordsPerStream {
+			return records, fmt.Errorf("more than %d directory records in one stream", maxDirectoryRecordsPerStream)
+		}
+		var rec DirectoryRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return records, fmt.Errorf("%w: %w", ErrInvalidDirectoryRecord, err)
+		}
+		records = append(records, &rec)
+	}
+	if err := sc.Err(); err != nil {
+		return records, fmt.Errorf("failed to read directory records: %w", err)
+	}
+	return records, nil
+}
+
+// HandleStream answers a sync started by an authorized peer.
+func (s *DirectorySync) HandleStream(st network.Stream) {
+	from := st.Conn().RemotePeer()
+	if !s.Authorized(from) {
+		st.Reset()
+		return
+	}
+	defer st.Close()
+	st.SetDeadline(time.Now().Add(directorySyncTimeout))
+
+	records, err := ReadDirectoryRecords(st)
+	if err != nil {
+		slog.Warn("directory: read error", "peer", from.String()[:16]+"...", "err", err)
+		st.Reset()
+		return
+	}
+	s.merge(from, records)
+	if err := WriteDirectoryRecords(st, s.Directory.Records()); err != nil {
+		slog.Debug("directory: reply failed", "peer", from.String()[:16]+"...", "err", err)
+	}
+}
+
+// SyncPeer runs one exchange with p and returns the number of records
+// from p that updated the local directory.
+func (s *DirectorySync) SyncPeer(ctx context.Context, p peer.ID) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, directorySyncTimeout)
+	defer cancel()
+
+	st, err := s.Host.NewStream(ctx, p, DirectoryProtocol)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer st.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		st.SetDeadline(deadline)
+	}
+
+	if err := WriteDirectoryRecords(st, s.Directory.Records()); err != nil {
+		st.Reset()
+		return 0, err
+	}
+	st.CloseWrite()
+
+	records, err := ReadDirectoryRecords(st)
+	if err != nil {
+		st.Reset()
+		return 0, err
+	}
+	return len(s.merge(p, records)), nil
+}
+
+// SyncAll syncs with every connected authorized peer that speaks
+// DirectoryProtocol, in parallel.
+func (s *DirectorySync) SyncAll(ctx context.Context) []DirectorySyncResult {
+	var targets []peer.ID
+	for _, p := range s.Host.Network().Peers() {
+		if s.Authorized(p) && s.supports(p) {
+			targets = append(targets, p)
+		}
+	}
+
+	results := make([]DirectorySyncResult, len(targets))
+	var wg sync.WaitGroup
+	for i, p := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := s.SyncPeer(ctx, p)
+			results[i] = DirectorySyncResult{Peer: p, Updated: n, Err: err}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Run syncs with authorized peers as they are identified, so a node that
+// was offline catches up as soon as it reconnects. Uses
+// EvtPeerIdentificationCompleted so the peer's protocols are known.
+func (s *DirectorySync) Run(ctx context.Context) {
+	sub, err := s.Host.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	if err != nil {
+		slog.Error("directory: subscribe failed", "err", err)
+		return
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			p := evt.(event.EvtPeerIdentificationCompleted).Peer
+			if !s.Authorized(p) || !s.supports(p) {
+				continue
+			}
+			go func() {
+				if _, err := s.SyncPeer(ctx, p); err != nil {
+					slog.Debug("directory: sync failed", "peer", p.String()[:16]+"...", "err", err)
+				}
+			}()
+		}
+	}
+}
+
+func (s *DirectorySync) supports(p peer.ID) bool {
+	protos, err := s.Host.Peerstore().SupportsProtocols(p, DirectoryProtocol)
+	return err == nil && len(protos) > 0
+}
+
+// merge applies records received from peer from and returns the ones that
+// were newer than the local copy.
+func (s *DirectorySync) merge(from peer.ID, records []*DirectoryRecord) []*DirectoryRecord {
+	self := s.Host.ID()
+	var updated []*DirectoryRecord
+	for _, r := range records {
+		origin, err := peer.Decode(r.Origin)
+		if err != nil || (origin != self && !s.Authorized(origin)) {
+			continue // not ours to vouch for
+		}
+		ok, err := s.Directory.Merge(r)
+		if err != nil {
+			if errors.Is(err, ErrInvalidDirectoryRecord) {
+				slog.Warn("directory: rejected record", "from", from.String()[:16]+"...", "err", err)
+			} else {
+				slog.Error("directory: merge failed", "err", err)
+			}
+			continue
+		}
+		if ok {
+			updated = append(updated, r)
+		}
+	}
+	if len(updated) > 0 && s.OnUpdate != nil {
+		s.OnUpdate(from, updated)
+	}
+	return updated
+}
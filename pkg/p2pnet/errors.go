@@ -14,4 +14,37 @@ var (
 	// ErrNameNotFound is returned when a name cannot be resolved to a peer ID
 	// and is not a valid peer ID itself.
 	ErrNameNotFound = errors.New("name not found")
+
+	// ErrQuotaExceeded is returned when a service has used up its daily or
+	// monthly data quota.
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrInvalidKeyRotation is returned when a key rotation statement is
+	// malformed, expired or carries a bad signature.
+	ErrInvalidKeyRotation = errors.New("invalid key rotation")
+
+	// ErrKeyRotationRejected is returned when a peer refuses a key rotation
+	// statement.
+	ErrKeyRotationRejected = errors.New("key rotation rejected")
+
+	// ErrInvalidDirectoryRecord is returned when a directory record is
+	// malformed or carries a bad signature.
+	ErrInvalidDirectoryRecord = errors.New("invalid directory record")
+
+	// ErrNotMeshHost is returned when a SOCKS5 or HTTP CONNECT destination
+	// does not name a peer and service, so it is refused rather than
+	// dialed on the internet.
+	ErrNotMeshHost = errors.New("not a mesh host")
+
+	// ErrReverseTunnelRejected is returned when a peer refuses to open a
+	// reverse tunnel listener, for example because this node is not
+	// allowed to listen on the requested address there.
+	ErrReverseTunnelRejected = errors.New("reverse tunnel rejected")
+
+	// ErrTunnelNotFound is returned when closing a tunnel that does not exist.
+	ErrTunnelNotFound = errors.New("tunnel not found")
+
+	// ErrSocketInUse is returned when a listener would replace a Unix
+	// socket that another process is still serving.
+	ErrSocketInUse = errors.New("socket in use")
 )
@@ -0,0 +1,173 @@
+package p2pnet
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types published on the EventFeed. Types are dot-separated so
+// subscribers can filter on a prefix ("peer" matches both peer events).
+const (
+	EventPeerConnected    = "peer.connected"    // first connection to a peer
+	EventPeerDisconnected = "peer.disconnected" // last connection to a peer closed
+	EventPeerKeyRotated   = "peer.key_rotated"  // authorized peer moved to a new identity
+	EventPeerRevoked      = "peer.revoked"      // group member revoked by a signed notice
+	EventPeerInvited      = "peer.invited"      // asynchronous invite redeemed, joiner authorized
+	EventPathUpgraded     = "path.upgraded"     // relayed peer gained a direct connection
+	EventNetworkChanged   = "network.changed"   // global IP addresses added or removed
+	EventHolePunch        = "holepunch.result"  // DCUtR hole punch finished
+	EventAuthDecision     = "auth.decision"     // inbound connection allowed or denied
+	EventServiceExposed   = "service.exposed"   // service registered
+	EventServiceUnexposed = "service.unexposed" // service removed
+	EventProxyOpened      = "proxy.opened"      // daemon proxy created
+	EventProxyClosed      = "proxy.closed"      // daemon proxy stopped
+	EventDirectoryUpdated = "directory.updated" // newer directory records merged from a peer
+	EventTunnelOpened     = "tunnel.opened"     // reverse tunnel established (either side)
+	EventTunnelClosed     = "tunnel.closed"     // reverse tunnel torn down
+)
+
+// DefaultEventBuffer is the per-subscriber queue length. Events published
+// while a subscriber's queue is full are dropped for that subscriber.
+const DefaultEventBuffer = 256
+
+// Event is a single entry on the EventFeed.
+type Event struct {
+	Seq  uint64         `json:"seq"`            // increases by one per published event
+	Time string         `json:"time"`           // RFC 3339 with nanoseconds
+	Type string         `json:"type"`           // one of the Event* constants
+	Peer string         `json:"peer,omitempty"` // full peer ID, if the event concerns one peer
+	Data map[string]any `json:"data,omitempty"` // type-specific fields
+}
+
+// EventFilter selects events for a subscriber. Zero value matches everything.
+type EventFilter struct {
+	Types []string // exact types or prefixes ("peer", "service"); empty = all
+	Peer  string   // full peer ID; empty = all
+}
+
+// Match reports whether e passes the filter.
+func (f EventFilter) Match(e Event) bool {
+	if f.Peer != "" && e.Peer != f.Peer {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if e.Type == t || strings.HasPrefix(e.Type, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// EventFeed fans out runtime events (peer, path, network, auth, service,
+// proxy and tunnel changes) to subscribers. Publishing never blocks: a slow
+// subscriber misses events, which shows up as a gap in Seq. A nil
+// *EventFeed is valid and discards everything.
+type EventFeed struct {
+	mu   sync.Mutex
+	seq  uint64
+	subs map[*EventSubscription]struct{}
+}
+
+// NewEventFeed creates an empty feed.
+func NewEventFeed() *EventFeed {
+	return &EventFeed{subs: make(map[*EventSubscription]struct{})}
+}
+
+// EventSubscription receives filtered events until closed.
+type EventSubscription struct {
+	feed    *EventFeed // nil when subscribed to a nil feed
+	filter  EventFilter
+	ch      chan Event
+	dropped uint64 // guarded by feed.mu
+	closed  bool   // guarded by feed.mu
+}
+
+// Publish sends an event to all matching subscribers.
+func (f *EventFeed) Publish(typ, peerID string, data map[string]any) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	e := Event{
+		Seq:  f.seq,
+		Time: time.Now().UTC().Format(time.RFC3339Nano),
+		Type: typ,
+		Peer: peerID,
+		Data: data,
+	}
+	for sub := range f.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Subscribe registers a subscriber with a queue of buffer events
+// (DefaultEventBuffer if buffer <= 0). Call Close when done. On a nil feed
+// it returns a subscription whose channel is already closed.
+func (f *EventFeed) Subscribe(filter EventFilter, buffer int) *EventSubscription {
+	if f == nil {
+		sub := &EventSubscription{ch: make(chan Event), closed: true}
+		close(sub.ch)
+		return sub
+	}
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+	sub := &EventSubscription{feed: f, filter: filter, ch: make(chan Event, buffer)}
+	f.mu.Lock()
+	f.subs[sub] = struct{}{}
+	f.mu.Unlock()
+	return sub
+}
+
+// SubscriberCount returns the number of open subscriptions.
+func (f *EventFeed) SubscriberCount() int {
+	if f == nil {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs)
+}
+
+// C returns the channel events are delivered on. It is closed by Close.
+func (s *EventSubscription) C() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns how many events were discarded because the queue was full.
+func (s *EventSubscription) Dropped() uint64 {
+	if s.feed == nil {
+		return 0
+	}
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	return s.dropped
+}
+
+// Close unsubscribes and closes the event channel. Safe to call twice.
+func (s *EventSubscription) Close() {
+	if s.feed == nil {
+		return // from a nil feed, closed at creation
+	}
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(s.feed.subs, s)
+	close(s.ch)
+}
@@ -0,0 +1,138 @@
+package p2pnet
+
+import (
+	"testing"
+	"time"
+)
+
+func recvEvent(t *testing.T, sub *EventSubscription) Event {
+	t.Helper()
+	select {
+	case e := <-sub.C():
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	e := Event{Type: EventPeerConnected, Peer: "12D3KooWA"}
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   bool
+	}{
+		{"empty", EventFilter{}, true},
+		{"exact type", EventFilter{Types: []string{"peer.connected"}}, true},
+		{"prefix", EventFilter{Types: []string{"peer"}}, true},
+		{"partial word is not a prefix", EventFilter{Types: []string{"pe"}}, false},
+		{"other type", EventFilter{Types: []string{"service", "proxy"}}, false},
+		{"peer match", EventFilter{Peer: "12D3KooWA"}, true},
+		{"peer mismatch", EventFilter{Peer: "12D3KooWB"}, false},
+		{"type and peer", EventFilter{Types: []string{"peer"}, Peer: "12D3KooWB"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(e); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventFeedPublishSubscribe(t *testing.T) {
+	f := NewEventFeed()
+	all := f.Subscribe(EventFilter{}, 0)
+	services := f.Subscribe(EventFilter{Types: []string{"service"}}, 0)
+	defer all.Close()
+	defer services.Close()
+
+	f.Publish(EventPeerConnected, "12D3KooWA", nil)
+	f.Publish(EventServiceExposed, "", map[string]any{"service": "ssh"})
+
+	if e := recvEvent(t, all); e.Type != EventPeerConnected || e.Seq != 1 || e.Time == "" {
+		t.Errorf("first event = %+v", e)
+	}
+	if e := recvEvent(t, all); e.Type != EventServiceExposed || e.Seq != 2 {
+		t.Errorf("second event = %+v", e)
+	}
+	e := recvEvent(t, services)
+	if e.Type != EventServiceExposed || e.Data["service"] != "ssh" {
+		t.Errorf("filtered event = %+v", e)
+	}
+	if f.SubscriberCount() != 2 {
+		t.Errorf("SubscriberCount = %d, want 2", f.SubscriberCount())
+	}
+}
+
+func TestEventFeedDropsForSlowSubscriber(t *testing.T) {
+	f := NewEventFeed()
+	sub := f.Subscribe(EventFilter{}, 2)
+	defer sub.Close()
+
+	for range 5 {
+		f.Publish(EventNetworkChanged, "", nil)
+	}
+	if got := sub.Dropped(); got != 3 {
+		t.Errorf("Dropped = %d, want 3", got)
+	}
+	if e := recvEvent(t, sub); e.Seq != 1 {
+		t.Errorf("first queued Seq = %d, want 1", e.Seq)
+	}
+}
+
+func TestEventSubscriptionClose(t *testing.T) {
+	f := NewEventFeed()
+	sub := f.Subscribe(EventFilter{}, 0)
+	sub.Close()
+	sub.Close() // idempotent
+
+	if _, ok := <-sub.C(); ok {
+		t.Error("channel should be closed")
+	}
+	if f.SubscriberCount() != 0 {
+		t.Errorf("SubscriberCount = %d, want 0", f.SubscriberCount())
+	}
+	f.Publish(EventPeerConnected, "", nil) // must not panic on closed subscriber
+}
+
+func TestEventFeedNilSafe(t *testing.T) {
+	var f *EventFeed
+	f.Publish(EventPeerConnected, "", nil)
+	if f.SubscriberCount() != 0 {
+		t.Error("nil feed should have no subscribers")
+	}
+
+	sub := f.Subscribe(EventFilter{}, 0)
+	if _, ok := <-sub.C(); ok {
+		t.Error("subscription to a nil feed should be closed")
+	}
+	if sub.Dropped() != 0 {
+		t.Error("subscription to a nil feed reported drops")
+	}
+	sub.Close()
+}
+
+func TestServiceRegistryPublishesEvents(t *testing.T) {
+	reg := newTestHost(t)
+	f := NewEventFeed()
+	reg.SetEventFeed(f)
+	sub := f.Subscribe(EventFilter{Types: []string{"service"}}, 0)
+	defer sub.Close()
+
+	svc := &Service{Name: "ssh", Protocol: "/peerup/ssh/1.0.0", LocalAddress: "localhost:22"}
+	if err := reg.RegisterService(svc); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.UnregisterService("ssh"); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := recvEvent(t, sub); e.Type != EventServiceExposed || e.Data["local_address"] != "localhost:22" {
+		t.Errorf("expose event = %+v", e)
+	}
+	if e := recvEvent(t, sub); e.Type != EventServiceUnexposed || e.Data["service"] != "ssh" {
+		t.Errorf("unexpose event = %+v", e)
+	}
+}
@@ -16,3 +16,9 @@ func LoadOrCreateIdentity(path string) (crypto.PrivKey, error) {
 func PeerIDFromKeyFile(path string) (peer.ID, error) {
 	return identity.PeerIDFromKeyFile(path)
 }
+
+// PeerIDFromKeyFileWith is PeerIDFromKeyFile with an explicit passphrase
+// source for encrypted key files.
+func PeerIDFromKeyFileWith(path string, passphrase func() ([]byte, error)) (peer.ID, error) {
+	return identity.PeerIDFromKeyFileWith(path, passphrase)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -286,6 +287,85 @@ func TestTCPListenerWithLocalService(t *testing.T) {
 	}
 }
 
+func TestStreamPoolThroughTCPListener(t *testing.T) {
+	// Local TCP echo service on the server side
+	echoListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create echo listener: %v", err)
+	}
+	defer echoListener.Close()
+	go func() {
+		for {
+			conn, err := echoListener.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				io.Copy(c, c)
+			}(conn)
+		}
+	}()
+
+	server := newTestHost(t)
+	client := newTestHost(t)
+
+	serverReg := p2pnet.NewServiceRegistry(server, nil)
+	if err := serverReg.RegisterService(&p2pnet.Service{
+		Name:         "echo",
+		Protocol:     "/peerup/echo/1.0.0",
+		LocalAddress: echoListener.Addr().String(),
+		Enabled:      true,
+	}); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	connectHosts(t, server, client)
+
+	clientReg := p2pnet.NewServiceRegistry(client, nil)
+	dial := func(ctx context.Context, pid peer.ID, svc string) (p2pnet.ServiceConn, error) {
+		return clientReg.DialService(ctx, pid, "/peerup/"+svc+"/1.0.0")
+	}
+	pool := p2pnet.NewStreamPool(dial, p2pnet.StreamPoolConfig{Size: 2, IdleTimeout: time.Minute}, nil)
+	defer pool.Close()
+
+	pool.Warm(server.ID(), "echo")
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Idle(server.ID(), "echo") < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := pool.Idle(server.ID(), "echo"); got != 2 {
+		t.Fatalf("warm streams = %d, want 2", got)
+	}
+
+	listener, err := p2pnet.NewTCPListener("127.0.0.1:0", pool.DialFunc(server.ID(), "echo"))
+	if err != nil {
+		t.Fatalf("NewTCPListener: %v", err)
+	}
+	defer listener.Close()
+	go listener.Serve()
+
+	// Several sequential connections, each served by a warm stream.
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("dial %d: %v", i, err)
+		}
+		msg := fmt.Sprintf("pooled-%d", i)
+		conn.Write([]byte(msg))
+		conn.(*net.TCPConn).CloseWrite()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		resp, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if string(resp) != msg {
+			t.Errorf("conn %d: got %q, want %q", i, resp, msg)
+		}
+	}
+}
+
 func TestUserAgentExchange(t *testing.T) {
 	// Create two hosts with distinct UserAgent strings.
 	// libp2p's Identify protocol exchanges UserAgent on connect.
@@ -471,3 +551,146 @@ func (m *mockServiceConn) Read(p []byte) (int, error)  { return 0, io.EOF }
 func (m *mockServiceConn) Write(p []byte) (int, error)  { return len(p), nil }
 func (m *mockServiceConn) Close() error                 { return nil }
 func (m *mockServiceConn) CloseWrite() error             { return nil }
+
+// --- Keepalive tests ---
+
+// hostDialFunc returns a PeerDialFunc that connects from to the given host.
+func hostDialFunc(from, to host.Host) p2pnet.PeerDialFunc {
+	return func(ctx context.Context, _ peer.ID) error {
+		return from.Connect(ctx, peer.AddrInfo{ID: to.ID(), Addrs: to.Addrs()})
+	}
+}
+
+func TestPeerKeepalive_WarmupAndPing(t *testing.T) {
+	const pingProto = "/peerup/ping/1.0.0"
+
+	server := newTestHost(t)
+	client := newTestHost(t)
+
+	pinged := make(chan struct{}, 1)
+	server.SetStreamHandler(protocol.ID(pingProto), func(s network.Stream) {
+		defer s.Close()
+		buf := make([]byte, 64)
+		n, _ := s.Read(buf)
+		if strings.TrimSpace(string(buf[:n])) == "ping" {
+			s.Write([]byte("pong\n"))
+			select {
+			case pinged <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	ka := p2pnet.NewPeerKeepalive(client, hostDialFunc(client, server), server.ID(), pingProto, 50*time.Millisecond)
+	ka.Start(context.Background())
+	defer ka.Stop()
+
+	// Connects without any proxied traffic, then pings the peer.
+	select {
+	case <-pinged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no keepalive ping received")
+	}
+	if client.Network().Connectedness(server.ID()) != network.Connected {
+		t.Error("expected connection after warmup")
+	}
+}
+
+func TestPeerKeepalive_RedialsAfterDisconnect(t *testing.T) {
+	server := newTestHost(t)
+	client := newTestHost(t)
+
+	var dials atomic.Int32
+	dial := hostDialFunc(client, server)
+	countingDial := func(ctx context.Context, id peer.ID) error {
+		dials.Add(1)
+		return dial(ctx, id)
+	}
+
+	ka := p2pnet.NewPeerKeepalive(client, countingDial, server.ID(), "", time.Hour)
+	ka.Start(context.Background())
+	defer ka.Stop()
+
+	waitConnected := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for client.Network().Connectedness(server.ID()) != network.Connected {
+			if time.Now().After(deadline) {
+				t.Fatal("keepalive did not connect to peer")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	waitConnected()
+
+	// Drop the connection; the keepalive must restore it well before the
+	// hour-long ping interval elapses.
+	client.Network().ClosePeer(server.ID())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for dials.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no redial after disconnect: %d dials", dials.Load())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	waitConnected()
+}
+
+func TestPeerKeepalive_StopEndsLoop(t *testing.T) {
+	server := newTestHost(t)
+	client := newTestHost(t)
+
+	ka := p2pnet.NewPeerKeepalive(client, hostDialFunc(client, server), server.ID(), "", time.Hour)
+	ka.Start(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		ka.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+
+	// Stop on a keepalive that was never started is a no-op.
+	p2pnet.NewPeerKeepalive(client, hostDialFunc(client, server), server.ID(), "", 0).Stop()
+}
+
+// --- Relay health tests ---
+
+func TestRelayHealth_ProbeRanksLiveRelayFirst(t *testing.T) {
+	client := newTestHost(t)
+	live := newTestHost(t)
+
+	// A peer that was shut down: its address refuses connections.
+	gone := newTestHost(t)
+	deadAddr := fmt.Sprintf("%s/p2p/%s", gone.Addrs()[0], gone.ID())
+	gone.Close()
+
+	liveAddr := fmt.Sprintf("%s/p2p/%s", live.Addrs()[0], live.ID())
+
+	m := p2pnet.NewMetrics("test", "go1.0")
+	rh := p2pnet.NewRelayHealth(client, []string{deadAddr, liveAddr}, m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	for range 3 {
+		rh.ProbeAll(ctx)
+	}
+
+	best := rh.Best(1)
+	if len(best) != 1 || best[0] != liveAddr {
+		t.Fatalf("Best(1) = %v, want live relay", best)
+	}
+
+	status := rh.Status()
+	if status[0].Healthy || status[0].Failures != 3 {
+		t.Errorf("dead relay status = %+v", status[0])
+	}
+	if !status[1].Healthy || status[1].Successes != 3 || status[1].RTTMs <= 0 {
+		t.Errorf("live relay status = %+v", status[1])
+	}
+}
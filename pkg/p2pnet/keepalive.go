@@ -0,0 +1,182 @@
+package p2pnet
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// DefaultKeepaliveInterval is how often a warmed-up peer connection is pinged.
+// Relay circuits and most NAT mappings survive at least a minute of silence,
+// so 30s keeps the path open with a comfortable margin.
+const DefaultKeepaliveInterval = 30 * time.Second
+
+// keepaliveDialTimeout bounds one warmup/redial attempt. Matches the
+// timeout peerup proxy uses for its initial PathDialer race.
+const keepaliveDialTimeout = 45 * time.Second
+
+// Redial backoff after a failed dial: 1s, 2s, 4s ... capped at 1 minute.
+const (
+	keepaliveMinBackoff = time.Second
+	keepaliveMaxBackoff = time.Minute
+)
+
+// PeerDialFunc establishes a connection to a peer, e.g. PathDialer.DialPeer
+// or the daemon's ConnectToPeer (DHT + relay racing).
+type PeerDialFunc func(ctx context.Context, peerID peer.ID) error
+
+// PeerKeepalive keeps a ready connection to one peer so the first proxied
+// connection doesn't wait for path discovery. It dials the peer up front,
+// pings it periodically over the ping-pong protocol to keep relay circuits
+// and NAT mappings alive, and redials in the background when the peer
+// disconnects.
+type PeerKeepalive struct {
+	host       host.Host
+	dial       PeerDialFunc
+	peerID     peer.ID
+	protocolID string
+	interval   time.Duration
+
+	disconnected chan struct{} // signalled when the last connection to peerID closes
+	notifiee     *network.NotifyBundle
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPeerKeepalive creates a keepalive for peerID. protocolID is the
+// ping-pong protocol; interval <= 0 uses DefaultKeepaliveInterval.
+func NewPeerKeepalive(h host.Host, dial PeerDialFunc, peerID peer.ID, protocolID string, interval time.Duration) *PeerKeepalive {
+	if interval <= 0 {
+		interval = DefaultKeepaliveInterval
+	}
+	return &PeerKeepalive{
+		host:         h,
+		dial:         dial,
+		peerID:       peerID,
+		protocolID:   protocolID,
+		interval:     interval,
+		disconnected: make(chan struct{}, 1),
+	}
+}
+
+// Start dials the peer in the background and keeps the connection warm
+// until ctx is cancelled or Stop is called.
+func (k *PeerKeepalive) Start(ctx context.Context) {
+	ctx, k.cancel = context.WithCancel(ctx)
+	k.done = make(chan struct{})
+
+	k.notifiee = &network.NotifyBundle{
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			if c.RemotePeer() != k.peerID || n.Connectedness(k.peerID) == network.Connected {
+				return
+			}
+			select {
+			case k.disconnected <- struct{}{}:
+			default:
+			}
+		},
+	}
+	k.host.Network().Notify(k.notifiee)
+
+	go k.run(ctx)
+}
+
+// Stop ends the keepalive loop and waits for it to exit.
+// The peer connection itself is left open.
+func (k *PeerKeepalive) Stop() {
+	if k.cancel == nil {
+		return
+	}
+	k.cancel()
+	<-k.done
+}
+
+func (k *PeerKeepalive) run(ctx context.Context) {
+	defer close(k.done)
+	defer k.host.Network().StopNotify(k.notifiee)
+
+	short := k.peerID.String()[:16] + "..."
+	backoff := keepaliveMinBackoff
+	first := true
+
+	for {
+		// (Re)dial until connected.
+		if k.host.Network().Connectedness(k.peerID) != network.Connected {
+			if !first {
+				slog.Info("keepalive: redialing peer", "peer", short)
+			}
+			dialCtx, cancel := context.WithTimeout(ctx, keepaliveDialTimeout)
+			err := k.dial(dialCtx, k.peerID)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Warn("keepalive: dial failed", "peer", short, "error", err, "retry_in", backoff)
+				if !sleepCtx(ctx, backoff) {
+					return
+				}
+				backoff = min(backoff*2, keepaliveMaxBackoff)
+				continue
+			}
+			backoff = keepaliveMinBackoff
+			slog.Info("keepalive: peer ready", "peer", short)
+		}
+		first = false
+
+		// Drain a stale disconnect signal from before the dial completed.
+		select {
+		case <-k.disconnected:
+			if k.host.Network().Connectedness(k.peerID) != network.Connected {
+				continue
+			}
+		default:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-k.disconnected:
+			slog.Info("keepalive: peer disconnected", "peer", short)
+		case <-time.After(k.interval):
+			k.ping(ctx, short)
+		}
+	}
+}
+
+// ping sends one ping-pong round trip. Failures are logged only: a dead
+// connection shows up as a disconnect and triggers a redial.
+func (k *PeerKeepalive) ping(ctx context.Context, short string) {
+	if k.protocolID == "" {
+		return
+	}
+	result := doPing(ctx, k.host, k.peerID, k.protocolID, 0)
+	if result.Error != "" {
+		slog.Debug("keepalive: ping failed", "peer", short, "error", result.Error)
+	}
+}
+
+// PathDialerFunc adapts a PathDialer for use with NewPeerKeepalive.
+func PathDialerFunc(pd *PathDialer) PeerDialFunc {
+	return func(ctx context.Context, peerID peer.ID) error {
+		_, err := pd.DialPeer(ctx, peerID)
+		return err
+	}
+}
+
+// sleepCtx waits for d or until ctx is done. Returns false if ctx ended.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
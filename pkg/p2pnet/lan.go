@@ -0,0 +1,187 @@
+package p2pnet
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// LAN discovery timing.
+const (
+	lanAddrTTL        = 10 * time.Minute // mDNS re-announces well within this
+	lanConnectTimeout = 10 * time.Second
+)
+
+// LANServiceName returns the mDNS service name for a discovery.network
+// namespace. Nodes in different namespaces use different service names, so
+// they never see each other's announcements. The namespace is hashed to fit
+// the 63-byte DNS label limit.
+func LANServiceName(namespace string) string {
+	if namespace == "" {
+		return "_peerup._udp"
+	}
+	sum := sha256.Sum256([]byte(namespace))
+	return "_peerup-" + hex.EncodeToString(sum[:6]) + "._udp"
+}
+
+// LANDiscovery finds peers on the local network with mDNS. Announcements
+// from peers that Authorized rejects are ignored. For the rest, the
+// announced local addresses go into the peerstore and the peer is dialed
+// directly, even when a relayed connection already exists, so same-LAN
+// peers stop waiting for hole punching.
+//
+// Only peers found this way are reported on the LAN path (see Found);
+// other connections to private addresses stay DIRECT.
+type LANDiscovery struct {
+	host       host.Host
+	authorized func(peer.ID) bool
+	metrics    *Metrics // nil-safe
+	service    mdns.Service
+
+	mu    sync.Mutex
+	found map[peer.ID]time.Time // last announcement per authorized peer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewLANDiscovery creates LAN discovery for namespace. authorized must not
+// be nil. Metrics is optional (nil-safe).
+func NewLANDiscovery(h host.Host, namespace string, authorized func(peer.ID) bool, m *Metrics) *LANDiscovery {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &LANDiscovery{
+		host:       h,
+		authorized: authorized,
+		metrics:    m,
+		found:      make(map[peer.ID]time.Time),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	d.service = mdns.NewMdnsService(h, LANServiceName(namespace), d)
+	return d
+}
+
+// Start begins announcing this node and listening for others.
+func (d *LANDiscovery) Start() error {
+	return d.service.Start()
+}
+
+// Close stops mDNS and cancels in-flight dials.
+func (d *LANDiscovery) Close() error {
+	d.cancel()
+	return d.service.Close()
+}
+
+// HandlePeerFound implements mdns.Notifee.
+func (d *LANDiscovery) HandlePeerFound(pi peer.AddrInfo) {
+	if pi.ID == d.host.ID() {
+		return
+	}
+	short := pi.ID.String()[:16] + "..."
+	if !d.authorized(pi.ID) {
+		slog.Debug("lan: ignoring unauthorized peer", "peer", short)
+		d.record("unauthorized")
+		return
+	}
+
+	addrs := lanAddrs(pi.Addrs)
+	if len(addrs) == 0 {
+		return
+	}
+	d.host.Peerstore().AddAddrs(pi.ID, addrs, lanAddrTTL)
+	d.mu.Lock()
+	d.found[pi.ID] = time.Now()
+	d.mu.Unlock()
+
+	if hasLANConn(d.host, pi.ID) {
+		return
+	}
+	go d.connect(pi.ID, addrs)
+}
+
+// connect dials p on its LAN addresses. WithForceDirectDial makes the host
+// dial even if it already holds a relayed connection to p.
+func (d *LANDiscovery) connect(p peer.ID, addrs []ma.Multiaddr) {
+	ctx, cancel := context.WithTimeout(d.ctx, lanConnectTimeout)
+	defer cancel()
+	ctx = network.WithForceDirectDial(ctx, "lan discovery")
+
+	short := p.String()[:16] + "..."
+	if err := d.host.Connect(ctx, peer.AddrInfo{ID: p, Addrs: addrs}); err != nil {
+		slog.Debug("lan: dial failed", "peer", short, "err", err)
+		d.record("failed")
+		return
+	}
+	slog.Info("lan: connected to peer", "peer", short)
+	d.record("connected")
+}
+
+// Found reports whether p announced itself on the local network within the
+// last lanAddrTTL. Nil-safe: a nil LANDiscovery has found nobody.
+func (d *LANDiscovery) Found(p peer.ID) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	seen, ok := d.found[p]
+	if ok && time.Since(seen) > lanAddrTTL {
+		delete(d.found, p)
+		return false
+	}
+	return ok
+}
+
+func (d *LANDiscovery) record(result string) {
+	if d.metrics == nil {
+		return
+	}
+	d.metrics.LANDiscoveryTotal.WithLabelValues(result).Inc()
+}
+
+// lanAddrs keeps the addresses that can only be reached locally: private,
+// link-local and loopback IPs, without relay circuits.
+func lanAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
+	var out []ma.Multiaddr
+	for _, a := range addrs {
+		if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+			continue
+		}
+		ip, err := manet.ToIP(a)
+		if err != nil {
+			continue
+		}
+		if isLANIP(ip) || ip.IsLoopback() {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// hasLANConn reports whether a direct connection to a LAN address of p is
+// already open.
+func hasLANConn(h host.Host, p peer.ID) bool {
+	for _, c := range h.Network().ConnsToPeer(p) {
+		if !c.Stat().Limited && isLANMultiaddr(c.RemoteMultiaddr().String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLANIP reports whether ip is a private (RFC 1918, RFC 4193) or
+// link-local unicast address.
+func isLANIP(ip net.IP) bool {
+	return ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
@@ -0,0 +1,127 @@
+package p2pnet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLANServiceName(t *testing.T) {
+	if got := LANServiceName(""); got != "_peerup._udp" {
+		t.Errorf("global service name = %q", got)
+	}
+	a, b := LANServiceName("family"), LANServiceName("office")
+	if a == b || !strings.HasPrefix(a, "_peerup-") || !strings.HasSuffix(a, "._udp") {
+		t.Errorf("namespaced service names = %q, %q", a, b)
+	}
+	if long := LANServiceName(strings.Repeat("a", 63)); len(strings.Split(long, ".")[0]) > 63 {
+		t.Errorf("service label too long: %q", long)
+	}
+}
+
+func TestLANAddrs(t *testing.T) {
+	var in []ma.Multiaddr
+	for _, s := range []string{
+		"/ip4/192.168.1.20/tcp/4001",
+		"/ip4/203.0.113.50/tcp/4001",
+		"/ip6/fe80::1/udp/4001/quic-v1",
+		"/ip4/127.0.0.1/tcp/4001",
+		"/ip4/10.0.0.1/tcp/4001/p2p/12D3KooWDpJ7As7BWAwRMfu1VU2WCqNjvq387JEYKDBj4kx6nXTN/p2p-circuit",
+		"/dns4/example.com/tcp/4001",
+	} {
+		in = append(in, ma.StringCast(s))
+	}
+	got := lanAddrs(in)
+	want := []string{"/ip4/192.168.1.20/tcp/4001", "/ip6/fe80::1/udp/4001/quic-v1", "/ip4/127.0.0.1/tcp/4001"}
+	if len(got) != len(want) {
+		t.Fatalf("lanAddrs() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("lanAddrs()[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIsLANMultiaddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"/ip4/10.0.1.50/udp/4001/quic/p2p/12D3KooWTestPeer1", true},
+		{"/ip4/192.168.1.20/tcp/4001", true},
+		{"/ip6/fd12:3456::1/udp/4001/quic-v1", true},
+		{"/ip6zone/eth0/ip6/fe80::1/tcp/4001", true},
+		{"/ip4/100.64.0.7/tcp/4001", false}, // CGNAT
+		{"/ip4/127.0.0.1/tcp/4001", false},
+		{"/ip4/203.0.113.50/tcp/4001", false},
+		{"/dns4/relay.example.com/tcp/443", false},
+	}
+	for _, tt := range tests {
+		if got := isLANMultiaddr(tt.addr); got != tt.want {
+			t.Errorf("isLANMultiaddr(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestLANDiscoveryHandlePeerFound(t *testing.T) {
+	newHost := func() peer.AddrInfo {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}
+	}
+
+	h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	friend, stranger := newHost(), newHost()
+	m := NewMetrics("test", "go")
+	d := NewLANDiscovery(h, "family", func(p peer.ID) bool { return p == friend.ID }, m)
+	t.Cleanup(func() { d.Close() })
+
+	d.HandlePeerFound(stranger)
+	if len(h.Peerstore().Addrs(stranger.ID)) != 0 {
+		t.Error("addresses of an unauthorized peer were stored")
+	}
+	if got := testutil.ToFloat64(m.LANDiscoveryTotal.WithLabelValues("unauthorized")); got != 1 {
+		t.Errorf("unauthorized count = %v, want 1", got)
+	}
+
+	d.HandlePeerFound(friend)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(h.Network().ConnsToPeer(friend.ID)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("authorized LAN peer was not dialed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	for testutil.ToFloat64(m.LANDiscoveryTotal.WithLabelValues("connected")) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("connected count not recorded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(h.Network().ConnsToPeer(stranger.ID)) != 0 {
+		t.Error("unauthorized peer was dialed")
+	}
+	if !d.Found(friend.ID) || d.Found(stranger.ID) {
+		t.Error("Found should report only the authorized peer")
+	}
+	if (*LANDiscovery)(nil).Found(friend.ID) {
+		t.Error("nil LANDiscovery reported a peer")
+	}
+
+	// Our own announcement is ignored.
+	d.HandlePeerFound(peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()})
+}
@@ -0,0 +1,349 @@
+package p2pnet
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Mesh proxy timeouts.
+const (
+	meshHandshakeTimeout = 10 * time.Second
+	meshDialTimeout      = 30 * time.Second
+)
+
+// SOCKS5 protocol constants (RFC 1928).
+const (
+	socks5Version        = 0x05
+	socks5NoAuth         = 0x00
+	socks5NoAcceptable   = 0xFF
+	socks5CmdConnect     = 0x01
+	socks5AddrIPv4       = 0x01
+	socks5AddrDomain     = 0x03
+	socks5AddrIPv6       = 0x04
+	socks5Succeeded      = 0x00
+	socks5NotAllowed     = 0x02
+	socks5HostUnreach    = 0x04
+	socks5ConnRefused    = 0x05
+	socks5CmdUnsupported = 0x07
+)
+
+// MeshProxy is a local SOCKS5 and HTTP CONNECT proxy into the peer mesh.
+// Both protocols share one listener; the first byte of a connection tells
+// them apart. A destination must name a peer and a service:
+//
+//	<service>.<peer>.<domain>:<any port>   e.g. ssh.home.peerup:22
+//	<peer>.<domain>:<port>                 service looked up in PortServices
+//	<peer>.<service>:<any port>            e.g. home.ssh:22
+//
+// Anything else, including IP addresses, is refused, so traffic meant for
+// the mesh never leaks to the internet. Sessions are recorded in the proxy
+// metrics under the service name.
+type MeshProxy struct {
+	Domain       string                                                                    // pseudo-TLD, e.g. "peerup"
+	PortServices map[int]string                                                            // port → service for <peer>.<domain>; optional
+	Resolve      func(name string) (peer.ID, error)                                        // name or peer ID → peer
+	Dial         func(ctx context.Context, p peer.ID, service string) (ServiceConn, error) // connects if needed
+	Metrics      *Metrics                                                                  // nil-safe
+
+	listener net.Listener
+	ctx      context.Context // bounds peer dials; cancelled by Close
+	cancel   context.CancelFunc
+}
+
+// Start listens on addr and serves connections in the background. Peer
+// dials are abandoned once ctx is cancelled.
+func (m *MeshProxy) Start(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	m.listener = ln
+	m.ctx, m.cancel = context.WithCancel(ctx)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.handleConn(conn)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the listen address, or "" before Start.
+func (m *MeshProxy) Addr() string {
+	if m.listener == nil {
+		return ""
+	}
+	return m.listener.Addr().String()
+}
+
+// Close stops accepting connections and abandons dials in progress.
+// Open sessions run to completion.
+func (m *MeshProxy) Close() error {
+	if m.listener == nil {
+		return nil
+	}
+	m.cancel()
+	return m.listener.Close()
+}
+
+// Target maps a destination host and port to a peer and service name.
+// It returns an error wrapping ErrNotMeshHost for destinations outside
+// the mesh and ErrNameNotFound for unknown peers.
+func (m *MeshProxy) Target(host string, port int) (peer.ID, string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if net.ParseIP(host) != nil {
+		return "", "", fmt.Errorf("%w: %s is an IP address", ErrNotMeshHost, host)
+	}
+
+	var peerName, service string
+	labels := strings.Split(host, ".")
+	suffix := "." + m.Domain
+	switch {
+	case len(host) > len(suffix) && strings.EqualFold(host[len(host)-len(suffix):], suffix):
+		rest := strings.Split(host[:len(host)-len(suffix)], ".")
+		switch len(rest) {
+		case 2:
+			service, peerName = rest[0], rest[1]
+		case 1:
+			peerName = rest[0]
+			service = m.PortServices[port]
+			if service == "" {
+				return "", "", fmt.Errorf("%w: no service mapped to port %d", ErrNotMeshHost, port)
+			}
+		default:
+			return "", "", fmt.Errorf("%w: %s", ErrNotMeshHost, host)
+		}
+	case len(labels) == 2:
+		peerName, service = labels[0], labels[1]
+	default:
+		return "", "", fmt.Errorf("%w: %s", ErrNotMeshHost, host)
+	}
+
+	service = strings.ToLower(service)
+	if err := ValidateServiceName(service); err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrNotMeshHost, err)
+	}
+	p, err := m.Resolve(peerName)
+	if err != nil {
+		return "", "", err
+	}
+	return p, service, nil
+}
+
+// handleConn sniffs the protocol and runs the matching handshake.
+func (m *MeshProxy) handleConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(meshHandshakeTimeout))
+	br := bufio.NewReader(conn)
+	first, err := br.Peek(1)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	client := &bufferedConn{Conn: conn, r: br}
+	if first[0] == socks5Version {
+		m.handleSOCKS5(client)
+	} else {
+		m.handleHTTPConnect(client)
+	}
+}
+
+// handleSOCKS5 serves one SOCKS5 CONNECT request without authentication.
+func (m *MeshProxy) handleSOCKS5(client *bufferedConn) {
+	// Greeting: VER NMETHODS METHODS...
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(client, hdr); err != nil {
+		client.Close()
+		return
+	}
+	methods := make([]byte, hdr[1])
+	if _, err := io.ReadFull(client, methods); err != nil {
+		client.Close()
+		return
+	}
+	if !containsByte(methods, socks5NoAuth) {
+		client.Write([]byte{socks5Version, socks5NoAcceptable})
+		client.Close()
+		return
+	}
+	if _, err := client.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		client.Close()
+		return
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(client, req); err != nil {
+		client.Close()
+		return
+	}
+	if req[1] != socks5CmdConnect {
+		socks5Reply(client, socks5CmdUnsupported)
+		client.Close()
+		return
+	}
+	var host string
+	switch req[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		n := net.IPv4len
+		if req[3] == socks5AddrIPv6 {
+			n = net.IPv6len
+		}
+		ip := make([]byte, n)
+		if _, err := io.ReadFull(client, ip); err != nil {
+			client.Close()
+			return
+		}
+		host = net.IP(ip).String()
+	case socks5AddrDomain:
+		l := make([]byte, 1)
+		if _, err := io.ReadFull(client, l); err != nil {
+			client.Close()
+			return
+		}
+		name := make([]byte, l[0])
+		if _, err := io.ReadFull(client, name); err != nil {
+			client.Close()
+			return
+		}
+		host = string(name)
+	default:
+		socks5Reply(client, socks5NotAllowed)
+		client.Close()
+		return
+	}
+	portBuf := make([]byte, 2)
+	if _, err := io.ReadFull(client, portBuf); err != nil {
+		client.Close()
+		return
+	}
+	port := int(binary.BigEndian.Uint16(portBuf))
+
+	p, service, err := m.Target(host, port)
+	if err != nil {
+		slog.Info("mesh proxy: rejected", "proto", "socks5", "host", host, "err", err)
+		code := byte(socks5NotAllowed)
+		if errors.Is(err, ErrNameNotFound) {
+			code = socks5HostUnreach
+		}
+		socks5Reply(client, code)
+		client.Close()
+		return
+	}
+	client.SetDeadline(time.Time{}) // the dial has its own timeout
+	remote, err := m.dial(p, service)
+	if err != nil {
+		slog.Info("mesh proxy: dial failed", "proto", "socks5", "host", host, "err", err)
+		socks5Reply(client, socks5ConnRefused)
+		client.Close()
+		return
+	}
+	if err := socks5Reply(client, socks5Succeeded); err != nil {
+		remote.Close()
+		client.Close()
+		return
+	}
+	InstrumentedBidirectionalProxy(remote, client, service, m.Metrics)
+}
+
+// socks5Reply writes a reply with an all-zero bound address.
+func socks5Reply(w io.Writer, code byte) error {
+	_, err := w.Write([]byte{socks5Version, code, 0x00, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// handleHTTPConnect serves one HTTP CONNECT request. Other methods are
+// refused: this is a tunnel, not a forward proxy.
+func (m *MeshProxy) handleHTTPConnect(client *bufferedConn) {
+	req, err := http.ReadRequest(client.r)
+	if err != nil {
+		client.Close()
+		return
+	}
+	if req.Method != http.MethodConnect {
+		httpReply(client, http.StatusMethodNotAllowed)
+		client.Close()
+		return
+	}
+	host, portStr, err := net.SplitHostPort(req.Host)
+	if err != nil {
+		httpReply(client, http.StatusBadRequest)
+		client.Close()
+		return
+	}
+	port, _ := strconv.Atoi(portStr)
+
+	p, service, err := m.Target(host, port)
+	if err != nil {
+		slog.Info("mesh proxy: rejected", "proto", "http", "host", host, "err", err)
+		status := http.StatusForbidden
+		if errors.Is(err, ErrNameNotFound) {
+			status = http.StatusNotFound
+		}
+		httpReply(client, status)
+		client.Close()
+		return
+	}
+	client.SetDeadline(time.Time{}) // the dial has its own timeout
+	remote, err := m.dial(p, service)
+	if err != nil {
+		slog.Info("mesh proxy: dial failed", "proto", "http", "host", host, "err", err)
+		httpReply(client, http.StatusBadGateway)
+		client.Close()
+		return
+	}
+	if err := httpReply(client, http.StatusOK); err != nil {
+		remote.Close()
+		client.Close()
+		return
+	}
+	InstrumentedBidirectionalProxy(remote, client, service, m.Metrics)
+}
+
+// httpReply writes a bodyless HTTP/1.1 response line.
+func httpReply(w io.Writer, status int) error {
+	_, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n\r\n", status, http.StatusText(status))
+	return err
+}
+
+func (m *MeshProxy) dial(p peer.ID, service string) (ServiceConn, error) {
+	ctx, cancel := context.WithTimeout(m.ctx, meshDialTimeout)
+	defer cancel()
+	return m.Dial(ctx, p, service)
+}
+
+// bufferedConn reads through the reader used to sniff the protocol, so
+// bytes the client sent early are not lost.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+func (c *bufferedConn) CloseWrite() error {
+	return (&tcpHalfCloser{c.Conn}).CloseWrite()
+}
+
+func containsByte(b []byte, v byte) bool {
+	for _, x := range b {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package p2pnet
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestMeshProxy starts a MeshProxy whose Dial connects every service to
+// a local TCP echo server.
+func newTestMeshProxy(t *testing.T, home peer.ID) (*MeshProxy, *Metrics) {
+	t.Helper()
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { echo.Close() })
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(c, c); c.Close() }()
+		}
+	}()
+
+	m := NewMetrics("test", "go")
+	names := NewNameResolver()
+	names.Register("home", home)
+	mp := &MeshProxy{
+		Domain:       "peerup",
+		PortServices: map[int]string{22: "ssh"},
+		Resolve:      names.Resolve,
+		Dial: func(ctx context.Context, p peer.ID, service string) (ServiceConn, error) {
+			if service == "down" {
+				return nil, errors.New("service refused")
+			}
+			c, err := net.Dial("tcp", echo.Addr().String())
+			if err != nil {
+				return nil, err
+			}
+			return &tcpHalfCloser{c}, nil
+		},
+		Metrics: m,
+	}
+	if err := mp.Start(context.Background(), "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mp.Close() })
+	return mp, m
+}
+
+func TestMeshProxyTarget(t *testing.T) {
+	home := genTestPeerID(t)
+	names := NewNameResolver()
+	names.Register("home", home)
+	mp := &MeshProxy{Domain: "peerup", PortServices: map[int]string{22: "ssh"}, Resolve: names.Resolve}
+
+	tests := []struct {
+		host    string
+		port    int
+		service string
+		wantErr error
+	}{
+		{"ssh.home.peerup", 2222, "ssh", nil},
+		{"SSH.home.PeerUp.", 22, "ssh", nil},
+		{"home.peerup", 22, "ssh", nil},
+		{"home.ssh", 443, "ssh", nil},
+		{"home.peerup", 80, "", ErrNotMeshHost},
+		{"laptop.peerup", 22, "", ErrNameNotFound},
+		{"ssh.laptop.peerup", 22, "", ErrNameNotFound},
+		{"example.com", 443, "", ErrNameNotFound},
+		{"www.example.com", 443, "", ErrNotMeshHost},
+		{"a.b.home.peerup", 22, "", ErrNotMeshHost},
+		{"home.bad_svc", 22, "", ErrNotMeshHost},
+		{"10.0.0.1", 22, "", ErrNotMeshHost},
+		{"::1", 22, "", ErrNotMeshHost},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s:%d", tt.host, tt.port), func(t *testing.T) {
+			p, service, err := mp.Target(tt.host, tt.port)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Target() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || p != home || service != tt.service {
+				t.Errorf("Target() = %s, %q, %v; want home, %q", p, service, err, tt.service)
+			}
+		})
+	}
+}
+
+func TestMeshProxySOCKS5(t *testing.T) {
+	mp, m := newTestMeshProxy(t, genTestPeerID(t))
+
+	connect := func(t *testing.T, host string) (net.Conn, byte) {
+		t.Helper()
+		c, err := net.Dial("tcp", mp.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		c.Write([]byte{0x05, 0x01, 0x00})
+		greet := make([]byte, 2)
+		if _, err := io.ReadFull(c, greet); err != nil || greet[1] != 0x00 {
+			t.Fatalf("greeting reply = %v, %v", greet, err)
+		}
+		req := append([]byte{0x05, 0x01, 0x00, 0x03, byte(len(host))}, host...)
+		c.Write(append(req, 0x00, 0x16)) // port 22
+		reply := make([]byte, 10)
+		if _, err := io.ReadFull(c, reply); err != nil {
+			t.Fatalf("reading reply: %v", err)
+		}
+		return c, reply[1]
+	}
+
+	c, code := connect(t, "ssh.home.peerup")
+	if code != 0x00 {
+		t.Fatalf("reply code = %#x, want success", code)
+	}
+	c.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo = %q, %v", buf, err)
+	}
+	c.Close()
+
+	for host, want := range map[string]byte{
+		"laptop.peerup":   0x04, // unknown peer
+		"www.example.com": 0x02, // outside the mesh
+		"home.down":       0x05, // dial failed
+	} {
+		c, code := connect(t, host)
+		if code != want {
+			t.Errorf("%s: reply code = %#x, want %#x", host, code, want)
+		}
+		c.Close()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for testutil.ToFloat64(m.ProxyConnectionsTotal.WithLabelValues("ssh")) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("session not recorded in proxy metrics")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMeshProxyHTTPConnect(t *testing.T) {
+	mp, _ := newTestMeshProxy(t, genTestPeerID(t))
+
+	do := func(t *testing.T, request string) (net.Conn, *bufio.Reader, string) {
+		t.Helper()
+		c, err := net.Dial("tcp", mp.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		fmt.Fprint(c, request)
+		br := bufio.NewReader(c)
+		status, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading status: %v", err)
+		}
+		br.ReadString('\n') // blank line
+		return c, br, strings.TrimSpace(status)
+	}
+
+	c, br, status := do(t, "CONNECT home.peerup:22 HTTP/1.1\r\nHost: home.peerup:22\r\n\r\n")
+	if status != "HTTP/1.1 200 OK" {
+		t.Fatalf("status = %q", status)
+	}
+	c.Write([]byte("pong"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(br, buf); err != nil || string(buf) != "pong" {
+		t.Errorf("echo = %q, %v", buf, err)
+	}
+	c.Close()
+
+	for request, want := range map[string]string{
+		"CONNECT 192.0.2.1:443 HTTP/1.1\r\nHost: 192.0.2.1:443\r\n\r\n":               "HTTP/1.1 403 Forbidden",
+		"CONNECT ssh.laptop.peerup:22 HTTP/1.1\r\nHost: ssh.laptop.peerup:22\r\n\r\n": "HTTP/1.1 404 Not Found",
+		"CONNECT down.home.peerup:1 HTTP/1.1\r\nHost: down.home.peerup:1\r\n\r\n":     "HTTP/1.1 502 Bad Gateway",
+		"GET http://example.com/ HTTP/1.1\r\nHost: example.com\r\n\r\n":               "HTTP/1.1 405 Method Not Allowed",
+	} {
+		c, _, status := do(t, request)
+		if status != want {
+			t.Errorf("%q: status = %q, want %q", strings.SplitN(request, "\r", 2)[0], status, want)
+		}
+		c.Close()
+	}
+}
+
+func TestMeshProxyDialFollowsLifetime(t *testing.T) {
+	home := genTestPeerID(t)
+	names := NewNameResolver()
+	names.Register("home", home)
+	dialing := make(chan struct{})
+	mp := &MeshProxy{
+		Domain:  "peerup",
+		Resolve: names.Resolve,
+		Dial: func(ctx context.Context, p peer.ID, service string) (ServiceConn, error) {
+			close(dialing)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := mp.Start(ctx, "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mp.Close() })
+
+	c, err := net.Dial("tcp", mp.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprint(c, "CONNECT ssh.home.peerup:22 HTTP/1.1\r\nHost: ssh.home.peerup:22\r\n\r\n")
+	<-dialing
+
+	// Cancelling the proxy's context abandons the dial in progress.
+	cancel()
+	status, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading status: %v", err)
+	}
+	if status = strings.TrimSpace(status); status != "HTTP/1.1 502 Bad Gateway" {
+		t.Errorf("status = %q, want 502 after cancel", status)
+	}
+}
@@ -18,6 +18,17 @@ type Metrics struct {
 	ProxyConnectionsTotal *prometheus.CounterVec
 	ProxyActiveConns      *prometheus.GaugeVec
 	ProxyDurationSeconds  *prometheus.HistogramVec
+	ProxyDatagramsTotal   *prometheus.CounterVec
+
+	// Bandwidth shaping and quota metrics (tracked by BandwidthManager)
+	ServiceThrottledTotal     *prometheus.CounterVec
+	ServiceQuotaUsedBytes     *prometheus.GaugeVec
+	ServiceQuotaExceededTotal *prometheus.CounterVec
+
+	// Stream pool metrics (warm streams for proxy dials)
+	StreamPoolRequestsTotal  *prometheus.CounterVec
+	StreamPoolIdle           *prometheus.GaugeVec
+	StreamPoolEvictionsTotal *prometheus.CounterVec
 
 	// Auth metrics
 	AuthDecisionsTotal *prometheus.CounterVec
@@ -34,9 +45,33 @@ type Metrics struct {
 	PathDialTotal           *prometheus.CounterVec
 	PathDialDurationSeconds *prometheus.HistogramVec
 
+	// Relay health metrics (tracked by RelayHealth)
+	RelayHealthScore *prometheus.GaugeVec
+	RelayRTTSeconds  *prometheus.GaugeVec
+	RelayProbeTotal  *prometheus.CounterVec
+
+	// Per-peer relay server usage (tracked by relay.UsageTracker)
+	RelayPeerBytesTotal          *prometheus.CounterVec
+	RelayPeerCircuitSecondsTotal *prometheus.CounterVec
+	RelayPeerDailyBytes          *prometheus.GaugeVec
+	RelayPeerQuotaExceededTotal  *prometheus.CounterVec
+	RelayPeerThrottledTotal      *prometheus.CounterVec
+
 	// Connected peers (tracked by PathTracker)
 	ConnectedPeers *prometheus.GaugeVec
 
+	// Relayed-to-direct path upgrades (tracked by PathTracker)
+	PathUpgradesTotal *prometheus.CounterVec
+
+	// LAN (mDNS) discovery outcomes (tracked by LANDiscovery)
+	LANDiscoveryTotal *prometheus.CounterVec
+
+	// Local name server queries (tracked by NameServer)
+	DNSQueriesTotal *prometheus.CounterVec
+
+	// Resumable session metrics
+	SessionResumesTotal *prometheus.CounterVec
+
 	// Network change events (tracked by NetworkMonitor)
 	NetworkChangeTotal *prometheus.CounterVec
 
@@ -92,6 +127,55 @@ func NewMetrics(version, goVersion string) *Metrics {
 			},
 			[]string{"service"},
 		),
+		ProxyDatagramsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_proxy_datagrams_total",
+				Help: "Total UDP datagrams forwarded through proxy flows.",
+			},
+			[]string{"direction", "service"},
+		),
+		ServiceThrottledTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_service_throttled_total",
+				Help: "Total times a service transfer was delayed by a rate limit, by scope (peer, total).",
+			},
+			[]string{"service", "scope"},
+		),
+		ServiceQuotaUsedBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "peerup_service_quota_used_bytes",
+				Help: "Bytes used against a service quota in the current period (daily, monthly).",
+			},
+			[]string{"service", "period"},
+		),
+		ServiceQuotaExceededTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_service_quota_exceeded_total",
+				Help: "Total connections or transfers refused because a service quota was used up.",
+			},
+			[]string{"service", "period"},
+		),
+		StreamPoolRequestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_stream_pool_requests_total",
+				Help: "Total stream pool requests by result (hit, miss).",
+			},
+			[]string{"service", "result"},
+		),
+		StreamPoolIdle: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "peerup_stream_pool_idle_streams",
+				Help: "Number of warm streams waiting in the pool.",
+			},
+			[]string{"service"},
+		),
+		StreamPoolEvictionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_stream_pool_evictions_total",
+				Help: "Total warm streams closed without being used, by reason (idle, closed).",
+			},
+			[]string{"service", "reason"},
+		),
 
 		AuthDecisionsTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
@@ -149,10 +233,95 @@ func NewMetrics(version, goVersion string) *Metrics {
 			[]string{"path_type"},
 		),
 
+		RelayHealthScore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "peerup_relay_health_score",
+				Help: "Rolling health score of each configured relay (0 = unusable, 1 = best).",
+			},
+			[]string{"relay"},
+		),
+		RelayRTTSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "peerup_relay_rtt_seconds",
+				Help: "Smoothed round-trip time to each configured relay in seconds.",
+			},
+			[]string{"relay"},
+		),
+		RelayProbeTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_relay_probe_total",
+				Help: "Total number of relay health probes.",
+			},
+			[]string{"relay", "result"},
+		),
+		RelayPeerBytesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_relay_peer_bytes_total",
+				Help: "Total bytes relayed on circuits to or from each peer, both directions.",
+			},
+			[]string{"peer"},
+		),
+		RelayPeerCircuitSecondsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_relay_peer_circuit_seconds_total",
+				Help: "Total seconds of closed relay circuits each peer took part in.",
+			},
+			[]string{"peer"},
+		),
+		RelayPeerDailyBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "peerup_relay_peer_daily_bytes",
+				Help: "Bytes relayed for each peer in the current UTC day (counted against relay_quota).",
+			},
+			[]string{"peer"},
+		),
+		RelayPeerQuotaExceededTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_relay_peer_quota_exceeded_total",
+				Help: "Total number of circuits refused or closed because a peer used up its relay_quota.",
+			},
+			[]string{"peer"},
+		),
+		RelayPeerThrottledTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_relay_peer_throttled_total",
+				Help: "Total number of relayed transfers delayed to keep a peer within its bandwidth share.",
+			},
+			[]string{"peer"},
+		),
+		PathUpgradesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_path_upgrades_total",
+				Help: "Total number of peers upgraded from a relayed to a direct connection.",
+			},
+			[]string{"transport"},
+		),
+		LANDiscoveryTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_lan_discovery_total",
+				Help: "Total number of peers found via mDNS by result (connected, failed, unauthorized).",
+			},
+			[]string{"result"},
+		),
+		DNSQueriesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_dns_queries_total",
+				Help: "Total number of local name server queries by result (answered, nodata, nxdomain, refused).",
+			},
+			[]string{"result"},
+		),
+		SessionResumesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "peerup_session_resumes_total",
+				Help: "Total number of resumable session reattachments by reason (reconnect, upgrade) and result.",
+			},
+			[]string{"reason", "result"},
+		),
+
 		ConnectedPeers: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "peerup_connected_peers",
-				Help: "Number of connected peers by path type, transport, and IP version.",
+				Help: "Number of connected peers by path type (DIRECT, LAN, RELAYED), transport, and IP version.",
 			},
 			[]string{"path_type", "transport", "ip_version"},
 		),
@@ -196,12 +365,31 @@ func NewMetrics(version, goVersion string) *Metrics {
 		m.ProxyConnectionsTotal,
 		m.ProxyActiveConns,
 		m.ProxyDurationSeconds,
+		m.ProxyDatagramsTotal,
+		m.ServiceThrottledTotal,
+		m.ServiceQuotaUsedBytes,
+		m.ServiceQuotaExceededTotal,
+		m.StreamPoolRequestsTotal,
+		m.StreamPoolIdle,
+		m.StreamPoolEvictionsTotal,
 		m.AuthDecisionsTotal,
 		m.HolePunchTotal,
 		m.HolePunchDurationSeconds,
 		m.DaemonRequestsTotal,
 		m.DaemonRequestDurationSeconds,
 		m.ConnectedPeers,
+		m.RelayHealthScore,
+		m.RelayRTTSeconds,
+		m.RelayProbeTotal,
+		m.RelayPeerBytesTotal,
+		m.RelayPeerCircuitSecondsTotal,
+		m.RelayPeerDailyBytes,
+		m.RelayPeerQuotaExceededTotal,
+		m.RelayPeerThrottledTotal,
+		m.PathUpgradesTotal,
+		m.LANDiscoveryTotal,
+		m.DNSQueriesTotal,
+		m.SessionResumesTotal,
 		m.NetworkChangeTotal,
 		m.STUNProbeTotal,
 		m.InterfaceCount,
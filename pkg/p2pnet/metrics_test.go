@@ -51,6 +51,25 @@ func TestMetricsCounters(t *testing.T) {
 	m.ProxyConnectionsTotal.WithLabelValues("ssh").Inc()
 	m.ProxyActiveConns.WithLabelValues("ssh").Inc()
 	m.ProxyDurationSeconds.WithLabelValues("ssh").Observe(5.0)
+	m.ProxyDatagramsTotal.WithLabelValues("rx", "dns").Inc()
+	m.StreamPoolRequestsTotal.WithLabelValues("ssh", "hit").Inc()
+	m.StreamPoolIdle.WithLabelValues("ssh").Set(2)
+	m.StreamPoolEvictionsTotal.WithLabelValues("ssh", "idle").Inc()
+	m.RelayHealthScore.WithLabelValues("12D3KooWRelay").Set(0.9)
+	m.RelayRTTSeconds.WithLabelValues("12D3KooWRelay").Set(0.04)
+	m.RelayProbeTotal.WithLabelValues("12D3KooWRelay", "success").Inc()
+	m.RelayPeerBytesTotal.WithLabelValues("12D3KooWPeer").Add(4096)
+	m.RelayPeerCircuitSecondsTotal.WithLabelValues("12D3KooWPeer").Add(60)
+	m.RelayPeerDailyBytes.WithLabelValues("12D3KooWPeer").Set(4096)
+	m.RelayPeerQuotaExceededTotal.WithLabelValues("12D3KooWPeer").Inc()
+	m.RelayPeerThrottledTotal.WithLabelValues("12D3KooWPeer").Inc()
+	m.PathUpgradesTotal.WithLabelValues("quic").Inc()
+	m.LANDiscoveryTotal.WithLabelValues("connected").Inc()
+	m.DNSQueriesTotal.WithLabelValues("answered").Inc()
+	m.ServiceThrottledTotal.WithLabelValues("ssh", "peer").Inc()
+	m.ServiceQuotaUsedBytes.WithLabelValues("ssh", "daily").Set(1024)
+	m.ServiceQuotaExceededTotal.WithLabelValues("ssh", "daily").Inc()
+	m.SessionResumesTotal.WithLabelValues("upgrade", "success").Inc()
 	m.AuthDecisionsTotal.WithLabelValues("allow").Inc()
 	m.AuthDecisionsTotal.WithLabelValues("deny").Inc()
 	m.HolePunchTotal.WithLabelValues("success").Inc()
@@ -65,16 +84,35 @@ func TestMetricsCounters(t *testing.T) {
 	}
 
 	expected := map[string]bool{
-		"peerup_proxy_bytes_total":              false,
-		"peerup_proxy_connections_total":        false,
-		"peerup_proxy_active_connections":       false,
-		"peerup_proxy_duration_seconds":         false,
-		"peerup_auth_decisions_total":           false,
-		"peerup_holepunch_total":                false,
-		"peerup_holepunch_duration_seconds":     false,
-		"peerup_daemon_requests_total":          false,
-		"peerup_daemon_request_duration_seconds": false,
-		"peerup_info":                           false,
+		"peerup_proxy_bytes_total":                false,
+		"peerup_proxy_connections_total":          false,
+		"peerup_proxy_active_connections":         false,
+		"peerup_proxy_duration_seconds":           false,
+		"peerup_proxy_datagrams_total":            false,
+		"peerup_stream_pool_requests_total":       false,
+		"peerup_stream_pool_idle_streams":         false,
+		"peerup_stream_pool_evictions_total":      false,
+		"peerup_relay_health_score":               false,
+		"peerup_relay_rtt_seconds":                false,
+		"peerup_relay_probe_total":                false,
+		"peerup_relay_peer_bytes_total":           false,
+		"peerup_relay_peer_circuit_seconds_total": false,
+		"peerup_relay_peer_daily_bytes":           false,
+		"peerup_relay_peer_quota_exceeded_total":  false,
+		"peerup_relay_peer_throttled_total":       false,
+		"peerup_path_upgrades_total":              false,
+		"peerup_lan_discovery_total":              false,
+		"peerup_dns_queries_total":                false,
+		"peerup_session_resumes_total":            false,
+		"peerup_service_throttled_total":          false,
+		"peerup_service_quota_used_bytes":         false,
+		"peerup_service_quota_exceeded_total":     false,
+		"peerup_auth_decisions_total":             false,
+		"peerup_holepunch_total":                  false,
+		"peerup_holepunch_duration_seconds":       false,
+		"peerup_daemon_requests_total":            false,
+		"peerup_daemon_request_duration_seconds":  false,
+		"peerup_info":                             false,
 	}
 
 	for _, f := range families {
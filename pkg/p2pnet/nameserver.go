@@ -0,0 +1,212 @@
+package p2pnet
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/miekg/dns"
+)
+
+// nameServerTTL is the TTL of answered records. Names can be re-pointed by
+// pairing, directory sync or key rotation, so it stays short.
+const nameServerTTL = 60
+
+// NameServer is a small DNS server that answers A queries for
+// <name>.<domain> from the peer name map. Each peer gets its own loopback
+// address (127.x.y.z) for the life of the process, so local proxies for
+// that peer's services can listen on it with the services' usual ports.
+//
+// Unknown names get NXDOMAIN; queries outside the domain are refused, so
+// the server is not an open resolver.
+type NameServer struct {
+	domain    string                    // FQDN with trailing dot, e.g. "peerup."
+	names     func() map[string]peer.ID // current name → peer map
+	onResolve func(peer.ID, net.IP)     // optional; called before each answer
+	metrics   *Metrics                  // nil-safe
+
+	mu       sync.Mutex
+	assigned map[peer.ID]net.IP
+	used     map[string]peer.ID // IP string → owner
+
+	servers []*dns.Server
+}
+
+// NewNameServer creates a name server for domain (e.g. "peerup"). names is
+// called on every query so pairing and directory changes apply at once.
+// onResolve, if non-nil, runs before a name is answered; the daemon uses it
+// to open that peer's loopback proxies. Metrics is optional (nil-safe).
+func NewNameServer(domain string, names func() map[string]peer.ID, onResolve func(peer.ID, net.IP), m *Metrics) *NameServer {
+	return &NameServer{
+		domain:    dns.Fqdn(strings.ToLower(domain)),
+		names:     names,
+		onResolve: onResolve,
+		metrics:   m,
+		assigned:  make(map[peer.ID]net.IP),
+		used:      make(map[string]peer.ID),
+	}
+}
+
+// Start listens for UDP and TCP queries on addr (host:port).
+func (s *NameServer) Start(addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+	// Use the bound port for TCP too, so ":0" works in tests.
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		return fmt.Errorf("failed to listen on tcp %s: %w", addr, err)
+	}
+
+	handler := dns.HandlerFunc(s.ServeDNS)
+	s.servers = []*dns.Server{
+		{PacketConn: pc, Handler: handler},
+		{Listener: ln, Handler: handler},
+	}
+	for _, srv := range s.servers {
+		go func(srv *dns.Server) {
+			if err := srv.ActivateAndServe(); err != nil {
+				slog.Debug("name server stopped", "err", err)
+			}
+		}(srv)
+	}
+	return nil
+}
+
+// Addr returns the UDP address the server listens on, or "" before Start.
+func (s *NameServer) Addr() string {
+	if len(s.servers) == 0 {
+		return ""
+	}
+	return s.servers[0].PacketConn.LocalAddr().String()
+}
+
+// Close stops the server.
+func (s *NameServer) Close() error {
+	for _, srv := range s.servers {
+		srv.Shutdown()
+	}
+	return nil
+}
+
+// ServeDNS implements dns.Handler.
+func (s *NameServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+
+	if len(req.Question) != 1 {
+		resp.Rcode = dns.RcodeFormatError
+		w.WriteMsg(resp)
+		return
+	}
+	q := req.Question[0]
+	qname := strings.ToLower(q.Name)
+
+	if qname != s.domain && !strings.HasSuffix(qname, "."+s.domain) {
+		s.record("refused")
+		resp.Rcode = dns.RcodeRefused
+		w.WriteMsg(resp)
+		return
+	}
+	resp.Authoritative = true
+
+	if qname == s.domain {
+		s.record("nodata")
+		w.WriteMsg(resp)
+		return
+	}
+
+	name := strings.TrimSuffix(qname, "."+s.domain)
+	p, ok := s.lookup(name)
+	if !ok {
+		s.record("nxdomain")
+		resp.Rcode = dns.RcodeNameError
+		w.WriteMsg(resp)
+		return
+	}
+
+	ip := s.AddrFor(p)
+	if s.onResolve != nil {
+		s.onResolve(p, ip)
+	}
+	if q.Qtype != dns.TypeA && q.Qtype != dns.TypeANY {
+		// The name exists, but only as an IPv4 loopback address.
+		s.record("nodata")
+		w.WriteMsg(resp)
+		return
+	}
+	resp.Answer = append(resp.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: nameServerTTL},
+		A:   ip,
+	})
+	s.record("answered")
+	w.WriteMsg(resp)
+}
+
+// lookup finds name case-insensitively. Only single-label names match.
+func (s *NameServer) lookup(name string) (peer.ID, bool) {
+	if strings.Contains(name, ".") {
+		return "", false
+	}
+	for n, p := range s.names() {
+		if strings.EqualFold(n, name) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// AddrFor returns the loopback address of p, assigning one on first use.
+// The address is derived from the peer ID, so it is usually the same
+// across restarts; on a collision the next free address is taken.
+func (s *NameServer) AddrFor(p peer.ID) net.IP {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ip, ok := s.assigned[p]; ok {
+		return ip
+	}
+	ip := loopbackFor(p)
+	for {
+		if _, taken := s.used[ip.String()]; !taken {
+			break
+		}
+		ip = nextLoopback(ip)
+	}
+	s.assigned[p] = ip
+	s.used[ip.String()] = p
+	return ip
+}
+
+func (s *NameServer) record(result string) {
+	if s.metrics == nil {
+		return
+	}
+	s.metrics.DNSQueriesTotal.WithLabelValues(result).Inc()
+}
+
+// loopbackFor derives a 127.x.y.z address from p. The second octet is
+// never 0, keeping clear of 127.0.0.1 and 127.0.0.53 (systemd-resolved),
+// and the last octet is never 0 or 255.
+func loopbackFor(p peer.ID) net.IP {
+	sum := sha256.Sum256([]byte(p))
+	return net.IPv4(127, 1+sum[0]%255, sum[1], 1+sum[2]%254).To4()
+}
+
+// nextLoopback returns the address after ip within the same scheme.
+func nextLoopback(ip net.IP) net.IP {
+	next := net.IPv4(127, ip[1], ip[2], ip[3]+1).To4()
+	if next[3] == 255 {
+		next[3] = 1
+		next[2]++
+		if next[2] == 0 {
+			next[1] = 1 + next[1]%255
+		}
+	}
+	return next
+}
@@ -0,0 +1,104 @@
+package p2pnet
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNameServer(t *testing.T) {
+	nas := genTestPeerID(t)
+	m := NewMetrics("test", "go")
+
+	var mu sync.Mutex
+	resolved := map[peer.ID]net.IP{}
+	s := NewNameServer("peerup", func() map[string]peer.ID {
+		return map[string]peer.ID{"NAS": nas}
+	}, func(p peer.ID, ip net.IP) {
+		mu.Lock()
+		resolved[p] = ip
+		mu.Unlock()
+	}, m)
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	query := func(t *testing.T, network, name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		msg := new(dns.Msg)
+		msg.SetQuestion(name, qtype)
+		c := &dns.Client{Net: network}
+		resp, _, err := c.Exchange(msg, s.Addr())
+		if err != nil {
+			t.Fatalf("Exchange(%s): %v", name, err)
+		}
+		return resp
+	}
+
+	want := s.AddrFor(nas)
+	if !want.IsLoopback() || want.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("AddrFor() = %s, want a loopback address other than 127.0.0.1", want)
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		resp := query(t, network, "nas.peerup.", dns.TypeA)
+		if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+			t.Fatalf("%s: A nas.peerup = %v", network, resp)
+		}
+		if a := resp.Answer[0].(*dns.A); !a.A.Equal(want) {
+			t.Errorf("%s: A = %s, want %s", network, a.A, want)
+		}
+	}
+	mu.Lock()
+	if !resolved[nas].Equal(want) {
+		t.Errorf("onResolve got %v, want %s", resolved, want)
+	}
+	mu.Unlock()
+
+	if resp := query(t, "udp", "NAS.PeerUp.", dns.TypeAAAA); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 0 {
+		t.Errorf("AAAA nas.peerup = %v, want empty NOERROR", resp)
+	}
+	if resp := query(t, "udp", "laptop.peerup.", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("unknown name rcode = %s, want NXDOMAIN", dns.RcodeToString[resp.Rcode])
+	}
+	if resp := query(t, "udp", "ssh.nas.peerup.", dns.TypeA); resp.Rcode != dns.RcodeNameError {
+		t.Errorf("multi-label name rcode = %s, want NXDOMAIN", dns.RcodeToString[resp.Rcode])
+	}
+	if resp := query(t, "udp", "example.com.", dns.TypeA); resp.Rcode != dns.RcodeRefused {
+		t.Errorf("outside domain rcode = %s, want REFUSED", dns.RcodeToString[resp.Rcode])
+	}
+
+	for result, want := range map[string]float64{"answered": 2, "nodata": 1, "nxdomain": 2, "refused": 1} {
+		if got := testutil.ToFloat64(m.DNSQueriesTotal.WithLabelValues(result)); got != want {
+			t.Errorf("%s queries = %v, want %v", result, got, want)
+		}
+	}
+}
+
+func TestNameServerAddrFor(t *testing.T) {
+	s := NewNameServer("peerup", func() map[string]peer.ID { return nil }, nil, nil)
+	a, b := genTestPeerID(t), genTestPeerID(t)
+
+	ipA := s.AddrFor(a)
+	if !s.AddrFor(a).Equal(ipA) {
+		t.Error("address changed between calls")
+	}
+	if !ipA.Equal(loopbackFor(a)) {
+		t.Errorf("AddrFor() = %s, want derived %s", ipA, loopbackFor(a))
+	}
+
+	// Force a collision: b's derived address is already taken.
+	s.used[loopbackFor(b).String()] = a
+	if ipB := s.AddrFor(b); ipB.Equal(loopbackFor(b)) || !ipB.IsLoopback() {
+		t.Errorf("AddrFor() on collision = %s", ipB)
+	}
+
+	if got := nextLoopback(net.IPv4(127, 9, 255, 254).To4()); !got.Equal(net.IPv4(127, 10, 0, 1)) {
+		t.Errorf("nextLoopback() = %s, want 127.10.0.1", got)
+	}
+}
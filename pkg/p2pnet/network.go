@@ -20,6 +20,7 @@ import (
 
 	"github.com/satindergrewal/peer-up/internal/auth"
 	"github.com/satindergrewal/peer-up/internal/config"
+	"github.com/satindergrewal/peer-up/internal/identity"
 )
 
 // DHTProtocolPrefix is the default protocol prefix for the private peerup Kademlia DHT.
@@ -42,7 +43,8 @@ func DHTProtocolPrefixForNamespace(namespace string) string {
 
 // holePunchTracer logs DCUtR hole-punching events and records metrics when available.
 type holePunchTracer struct {
-	metrics *Metrics // nil when metrics disabled
+	metrics *Metrics   // nil when metrics disabled
+	events  *EventFeed // nil-safe
 }
 
 // truncateError returns the first line of an error string, capped at 200 chars.
@@ -81,6 +83,11 @@ func (t *holePunchTracer) Trace(evt *holepunch.Event) {
 			t.metrics.HolePunchTotal.WithLabelValues(result).Inc()
 			t.metrics.HolePunchDurationSeconds.WithLabelValues(result).Observe(e.EllapsedTime.Seconds())
 		}
+		data := map[string]any{"success": e.Success, "elapsed_ms": e.EllapsedTime.Milliseconds()}
+		if !e.Success {
+			data["error"] = truncateError(e.Error)
+		}
+		t.events.Publish(EventHolePunch, evt.Remote.String(), data)
 	case *holepunch.DirectDialEvt:
 		if e.Success {
 			slog.Info("direct dial succeeded", "peer", short, "elapsed", e.EllapsedTime)
@@ -96,6 +103,9 @@ type Network struct {
 	config          *config.Config
 	serviceRegistry *ServiceRegistry
 	nameResolver    *NameResolver
+	events          *EventFeed
+	streamPool      *StreamPool // nil until EnableStreamPool
+	sessionResume   bool        // set by EnableSessionResume
 	ctx             context.Context
 	cancel          context.CancelFunc
 }
@@ -103,6 +113,7 @@ type Network struct {
 // Config for creating a new P2P network
 type Config struct {
 	KeyFile         string
+	KeyPassphrase   func() ([]byte, error)        // Passphrase source for an encrypted key file (nil = PEERUP_KEY_PASSPHRASE)
 	AuthorizedKeys  string                       // Path to authorized_keys file (auto-creates gater if Gater is nil)
 	Gater           *auth.AuthorizedPeerGater     // Pre-created gater (for hot-reload support). Takes precedence over AuthorizedKeys.
 	Config          *config.Config
@@ -120,6 +131,7 @@ type Config struct {
 
 	// Observability
 	Metrics *Metrics // Custom peerup metrics (nil = disabled). When non-nil, libp2p metrics are registered on Metrics.Registry.
+	Events  *EventFeed // Runtime event feed (nil = created by New). Pre-create to publish events from hooks that run before New returns.
 }
 
 // New creates a new P2P network instance
@@ -129,9 +141,17 @@ func New(cfg *Config) (*Network, error) {
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	events := cfg.Events
+	if events == nil {
+		events = NewEventFeed()
+	}
 
 	// Load identity
-	priv, err := LoadOrCreateIdentity(cfg.KeyFile)
+	passphrase := identity.EnvPassphrase
+	if cfg.KeyPassphrase != nil {
+		passphrase = cfg.KeyPassphrase
+	}
+	priv, err := identity.LoadOrCreateIdentityWith(cfg.KeyFile, passphrase)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to load identity: %w", err)
@@ -184,7 +204,7 @@ func New(cfg *Config) (*Network, error) {
 		}
 
 		if cfg.EnableHolePunching {
-			hostOpts = append(hostOpts, libp2p.EnableHolePunching(holepunch.WithTracer(&holePunchTracer{metrics: cfg.Metrics})))
+			hostOpts = append(hostOpts, libp2p.EnableHolePunching(holepunch.WithTracer(&holePunchTracer{metrics: cfg.Metrics, events: events})))
 		}
 
 		if cfg.ForcePrivate {
@@ -222,16 +242,23 @@ func New(cfg *Config) (*Network, error) {
 	// Add connection gater: use pre-created Gater if provided (enables hot-reload),
 	// otherwise auto-create from AuthorizedKeys file path (simpler for commands that
 	// don't need runtime auth management).
-	if cfg.Gater != nil {
-		hostOpts = append(hostOpts, libp2p.ConnectionGater(cfg.Gater))
-	} else if cfg.AuthorizedKeys != "" {
+	gater := cfg.Gater
+	if gater == nil && cfg.AuthorizedKeys != "" {
 		authorizedPeers, err := auth.LoadAuthorizedKeys(cfg.AuthorizedKeys)
 		if err != nil {
 			cancel()
 			return nil, fmt.Errorf("failed to load authorized_keys: %w", err)
 		}
+		roles, err := auth.LoadPeerRoles(cfg.AuthorizedKeys)
+		if err != nil {
+			cancel()
+			return nil, fmt.Errorf("failed to load authorized_keys roles: %w", err)
+		}
 
-		gater := auth.NewAuthorizedPeerGater(authorizedPeers)
+		gater = auth.NewAuthorizedPeerGater(authorizedPeers)
+		gater.UpdatePeerRoles(roles)
+	}
+	if gater != nil {
 		hostOpts = append(hostOpts, libp2p.ConnectionGater(gater))
 	}
 
@@ -247,9 +274,15 @@ func New(cfg *Config) (*Network, error) {
 		config:          cfg.Config,
 		serviceRegistry: NewServiceRegistry(h, cfg.Metrics),
 		nameResolver:    NewNameResolver(),
+		events:          events,
 		ctx:             ctx,
 		cancel:          cancel,
 	}
+	net.serviceRegistry.SetEventFeed(events)
+	// Services with allowed_roles look up roles in the connection gater.
+	if gater != nil {
+		net.serviceRegistry.SetRoleChecker(gater)
+	}
 
 	return net, nil
 }
@@ -259,6 +292,12 @@ func (n *Network) Host() host.Host {
 	return n.host
 }
 
+// Events returns the feed of runtime events (peer, path, hole punch,
+// service changes). Callers may publish their own events on it.
+func (n *Network) Events() *EventFeed {
+	return n.events
+}
+
 // PeerID returns the peer ID of this network node
 func (n *Network) PeerID() peer.ID {
 	return n.host.ID()
@@ -272,8 +311,25 @@ func (n *Network) ExposeService(name, localAddress string, allowedPeers map[peer
 	}
 	return n.serviceRegistry.RegisterService(&Service{
 		Name:         name,
-		Protocol:     fmt.Sprintf("/peerup/%s/1.0.0", name),
+		Protocol:     serviceProtocolID(name),
+		LocalAddress: localAddress,
+		Enabled:      true,
+		AllowedPeers: allowedPeers,
+	})
+}
+
+// ExposeUDPService exposes a local UDP service through the P2P network.
+// Datagrams are framed over one libp2p stream per client flow.
+// If allowedPeers is nil, all authorized peers can access the service.
+func (n *Network) ExposeUDPService(name, localAddress string, allowedPeers map[peer.ID]struct{}) error {
+	if err := ValidateServiceName(name); err != nil {
+		return err
+	}
+	return n.serviceRegistry.RegisterService(&Service{
+		Name:         name,
+		Protocol:     udpServiceProtocolID(name),
 		LocalAddress: localAddress,
+		Transport:    ServiceTransportUDP,
 		Enabled:      true,
 		AllowedPeers: allowedPeers,
 	})
@@ -292,6 +348,12 @@ func (n *Network) ListServices() []*Service {
 	return n.serviceRegistry.ListServices()
 }
 
+// IsServiceRestricted reports whether svc has allowed peers, allowed roles
+// or access rules (see ServiceRegistry.IsRestricted).
+func (n *Network) IsServiceRestricted(svc *Service) bool {
+	return n.serviceRegistry.IsRestricted(svc)
+}
+
 // ConnectToService connects to a remote peer's service with a default 30s timeout.
 func (n *Network) ConnectToService(peerID peer.ID, serviceName string) (ServiceConn, error) {
 	ctx, cancel := context.WithTimeout(n.ctx, 30*time.Second)
@@ -304,8 +366,130 @@ func (n *Network) ConnectToServiceContext(ctx context.Context, peerID peer.ID, s
 	if err := ValidateServiceName(serviceName); err != nil {
 		return nil, err
 	}
-	protocol := fmt.Sprintf("/peerup/%s/1.0.0", serviceName)
-	return n.serviceRegistry.DialService(ctx, peerID, protocol)
+	if n.sessionResume {
+		return n.serviceRegistry.DialResumableService(ctx, peerID, serviceName)
+	}
+	return n.serviceRegistry.DialService(ctx, peerID, serviceProtocolID(serviceName))
+}
+
+// SetBandwidthManager applies bm's per-service rate limits and quotas to
+// incoming connections on exposed services. Call before exposing services.
+func (n *Network) SetBandwidthManager(bm *BandwidthManager) {
+	n.serviceRegistry.SetBandwidthManager(bm)
+}
+
+// SetAuditLogger records service access denials in a. a may be nil.
+func (n *Network) SetAuditLogger(a *AuditLogger) {
+	n.serviceRegistry.SetAuditLogger(a)
+}
+
+// SetServiceAccessRules restricts when peers may use the named service.
+// Set rules before exposing the service. Nil rules remove the restriction.
+func (n *Network) SetServiceAccessRules(name string, rules []*AccessRule) {
+	n.serviceRegistry.SetAccessRules(name, rules)
+}
+
+// SetServiceAllowedRoles restricts the named service to peers holding one
+// of roles (see ServiceRegistry.SetAllowedRoles). Set roles before exposing
+// the service. Empty roles remove the restriction.
+func (n *Network) SetServiceAllowedRoles(name string, roles []string) {
+	n.serviceRegistry.SetAllowedRoles(name, roles)
+}
+
+// SetServiceDescription sets the description peers see when they browse
+// this node's services. An empty description removes it.
+func (n *Network) SetServiceDescription(name, description string) {
+	n.serviceRegistry.SetDescription(name, description)
+}
+
+// QueryServices asks peerID which of its services this node may use.
+// Services the peer denies us are never included.
+func (n *Network) QueryServices(ctx context.Context, peerID peer.ID) ([]RemoteService, error) {
+	return n.serviceRegistry.QueryServices(ctx, peerID)
+}
+
+// ReplaceAllowedPeer moves service ACL entries from oldID to newID after a
+// peer's key rotation.
+func (n *Network) ReplaceAllowedPeer(oldID, newID peer.ID) {
+	n.serviceRegistry.ReplaceAllowedPeer(oldID, newID)
+}
+
+// EnableSessionResume makes TCP service connections resumable: they survive
+// the loss of their stream and can be moved to a direct connection with
+// HandlePathUpgrade. Peers without resume support get plain streams.
+// Must be called before any proxy starts dialing.
+func (n *Network) EnableSessionResume() {
+	n.sessionResume = true
+}
+
+// HandlePathUpgrade reacts to a peer going from a relayed to a direct
+// connection: warm pooled streams to it are replaced, and resumable
+// sessions are migrated onto the direct connection. Suitable as a
+// PathTracker.OnPathUpgrade callback.
+func (n *Network) HandlePathUpgrade(peerID peer.ID) {
+	if n.streamPool != nil {
+		n.streamPool.DrainPeer(peerID)
+	}
+	if count := n.serviceRegistry.MigrateSessions(peerID); count > 0 {
+		slog.Info("migrating sessions to direct path", "peer", peerID.String()[:16]+"...", "sessions", count)
+	}
+}
+
+// EnableStreamPool creates a pool of warm streams used by ServiceDialFunc.
+// Warm streams only negotiate StreamPoolProtocolID; the remote side admits
+// and dials its service when one is taken. Pooled connections are plain
+// streams, not resumable sessions. Peers without pool support, and pool
+// misses, go through ConnectToServiceContext. Must be called before any
+// proxy starts dialing. metrics may be nil.
+func (n *Network) EnableStreamPool(cfg StreamPoolConfig, metrics *Metrics) *StreamPool {
+	n.streamPool = NewStreamPool(n.ConnectToServiceContext, cfg, metrics)
+	n.streamPool.warm = n.serviceRegistry.dialPooledService
+	return n.streamPool
+}
+
+// StreamPool returns the network's stream pool, or nil if pooling is disabled.
+func (n *Network) StreamPool() *StreamPool {
+	return n.streamPool
+}
+
+// ServiceDialFunc returns a dial function for TCPListener that opens a
+// stream to serviceName on peerID, drawing from the stream pool when enabled.
+func (n *Network) ServiceDialFunc(peerID peer.ID, serviceName string) func() (ServiceConn, error) {
+	if n.streamPool != nil {
+		return n.streamPool.DialFunc(peerID, serviceName)
+	}
+	return func() (ServiceConn, error) {
+		return n.ConnectToService(peerID, serviceName)
+	}
+}
+
+// ConnectToUDPService opens a datagram stream to a remote peer's UDP service
+// with a default 30s timeout. Each call carries one client flow.
+func (n *Network) ConnectToUDPService(peerID peer.ID, serviceName string) (ServiceConn, error) {
+	ctx, cancel := context.WithTimeout(n.ctx, 30*time.Second)
+	defer cancel()
+	return n.ConnectToUDPServiceContext(ctx, peerID, serviceName)
+}
+
+// ConnectToUDPServiceContext opens a datagram stream to a remote peer's UDP
+// service using the provided context.
+func (n *Network) ConnectToUDPServiceContext(ctx context.Context, peerID peer.ID, serviceName string) (ServiceConn, error) {
+	if err := ValidateServiceName(serviceName); err != nil {
+		return nil, err
+	}
+	return n.serviceRegistry.DialService(ctx, peerID, udpServiceProtocolID(serviceName))
+}
+
+// serviceProtocolID returns the libp2p protocol ID for a TCP service.
+func serviceProtocolID(name string) string {
+	return fmt.Sprintf("/peerup/%s/1.0.0", name)
+}
+
+// udpServiceProtocolID returns the libp2p protocol ID for a UDP service.
+// It differs from the TCP ID so a TCP client can never be handed a
+// datagram stream (or vice versa) for a same-named service.
+func udpServiceProtocolID(name string) string {
+	return fmt.Sprintf("/peerup/%s/udp/1.0.0", name)
 }
 
 // ResolveName resolves a name to a peer ID
@@ -318,6 +502,16 @@ func (n *Network) RegisterName(name string, peerID peer.ID) error {
 	return n.nameResolver.Register(name, peerID)
 }
 
+// UnregisterName removes a local name mapping
+func (n *Network) UnregisterName(name string) {
+	n.nameResolver.Unregister(name)
+}
+
+// ListNames returns a copy of all name mappings
+func (n *Network) ListNames() map[string]peer.ID {
+	return n.nameResolver.List()
+}
+
 // LoadNames loads name-to-peer-ID mappings from a string map (e.g., from YAML config)
 func (n *Network) LoadNames(names map[string]string) error {
 	return n.nameResolver.LoadFromMap(names)
@@ -340,6 +534,9 @@ func (n *Network) AddRelayAddressesForPeer(relayAddrs []string, targetPeerID pee
 // Close shuts down the network
 func (n *Network) Close() error {
 	n.cancel()
+	if n.streamPool != nil {
+		n.streamPool.Close()
+	}
 	return n.host.Close()
 }
 
@@ -2,7 +2,9 @@ package p2pnet
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
@@ -18,6 +20,7 @@ type PathType string
 const (
 	PathDirect  PathType = "DIRECT"
 	PathRelayed PathType = "RELAYED"
+	PathLAN     PathType = "LAN" // direct, to a LAN address of a peer found by mDNS (see LANDiscovery)
 )
 
 // DialResult is the outcome of a successful PathDialer.DialPeer call.
@@ -35,6 +38,9 @@ type PathDialer struct {
 	kdht       *dht.IpfsDHT // may be nil (no DHT)
 	relayAddrs []string
 	metrics    *Metrics // nil-safe
+
+	relayHealth *RelayHealth // nil: race every configured relay
+	relayRace   int          // relays raced when relayHealth is set
 }
 
 // NewPathDialer creates a PathDialer. The DHT and metrics are optional (nil-safe).
@@ -47,6 +53,16 @@ func NewPathDialer(h host.Host, kdht *dht.IpfsDHT, relayAddrs []string, m *Metri
 	}
 }
 
+// SetRelayHealth makes the relay leg race circuit dials through only the
+// raceCount healthiest relays (DefaultRelayRaceCount if <= 0), as ranked by rh.
+func (pd *PathDialer) SetRelayHealth(rh *RelayHealth, raceCount int) {
+	if raceCount <= 0 {
+		raceCount = DefaultRelayRaceCount
+	}
+	pd.relayHealth = rh
+	pd.relayRace = raceCount
+}
+
 // DialPeer connects to the target peer using parallel path racing.
 // If already connected, it returns immediately with the current path type.
 // Otherwise it races DHT discovery against relay circuit, returning the
@@ -111,16 +127,11 @@ func (pd *PathDialer) DialPeer(ctx context.Context, peerID peer.ID) (*DialResult
 	// Leg 2: Relay circuit
 	if len(pd.relayAddrs) > 0 {
 		go func() {
-			if err := AddRelayAddressesForPeerFunc(pd.host, pd.relayAddrs, peerID); err != nil {
-				resultCh <- raceResult{err: fmt.Errorf("relay addrs: %w", err)}
-				return
-			}
-
 			connectCtx, connectCancel := context.WithTimeout(raceCtx, 30*time.Second)
 			defer connectCancel()
 
-			if err := pd.host.Connect(connectCtx, peer.AddrInfo{ID: peerID}); err != nil {
-				resultCh <- raceResult{err: fmt.Errorf("relay connect: %w", err)}
+			if err := pd.dialRelayed(connectCtx, peerID); err != nil {
+				resultCh <- raceResult{err: err}
 				return
 			}
 
@@ -145,6 +156,9 @@ func (pd *PathDialer) DialPeer(ctx context.Context, peerID peer.ID) (*DialResult
 			if r.err == nil {
 				// Winner - cancel the other leg
 				raceCancel()
+				if pd.relayHealth != nil {
+					pd.relayHealth.RecordDialSuccess(r.addr)
+				}
 				result := &DialResult{
 					PathType: r.pathType,
 					Duration: time.Since(start),
@@ -166,6 +180,74 @@ func (pd *PathDialer) DialPeer(ctx context.Context, peerID peer.ID) (*DialResult
 	return nil, fmt.Errorf("all paths failed: %v; %v", firstErr, secondErr)
 }
 
+// dialRelayed connects to peerID through a relay circuit. Without relay
+// health tracking every configured relay's circuit is handed to libp2p at
+// once; with it, only the healthiest relays are raced (see raceRelays).
+func (pd *PathDialer) dialRelayed(ctx context.Context, peerID peer.ID) error {
+	if pd.relayHealth != nil {
+		return pd.raceRelays(ctx, peerID, pd.relayHealth.Best(pd.relayRace))
+	}
+	if err := AddRelayAddressesForPeerFunc(pd.host, pd.relayAddrs, peerID); err != nil {
+		return fmt.Errorf("relay addrs: %w", err)
+	}
+	if err := pd.host.Connect(ctx, peer.AddrInfo{ID: peerID}); err != nil {
+		return fmt.Errorf("relay connect: %w", err)
+	}
+	return nil
+}
+
+// raceRelays dials peerID through each of relays in parallel, one attempt
+// per relay, and returns as soon as one circuit is up, cancelling the rest.
+// Each attempt reaches its relay before asking for the circuit, so a dead
+// relay fails on its own without holding up the others. Circuit addresses
+// learned earlier through other relays stay in the peerstore.
+func (pd *PathDialer) raceRelays(ctx context.Context, peerID peer.ID, relays []string) error {
+	circuits, err := relayCircuitAddrs(relays, peerID)
+	if err != nil {
+		return fmt.Errorf("relay addrs: %w", err)
+	}
+	if len(circuits) == 0 {
+		return fmt.Errorf("relay: no relay addresses configured")
+	}
+
+	raceCtx, raceCancel := context.WithCancel(ctx)
+	defer raceCancel()
+
+	errCh := make(chan error, len(circuits))
+	for i, relayAddr := range relays {
+		go func() {
+			errCh <- pd.dialViaRelay(raceCtx, relayAddr, circuits[i])
+		}()
+	}
+
+	errs := make([]error, 0, len(circuits))
+	for range circuits {
+		if err := <-errCh; err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("relay connect: %w", errors.Join(errs...))
+}
+
+// dialViaRelay connects to the relay at relayAddr, then to the target over
+// circuit, the target's circuit address through that relay.
+func (pd *PathDialer) dialViaRelay(ctx context.Context, relayAddr string, circuit peer.AddrInfo) error {
+	relayInfo, err := peer.AddrInfoFromString(relayAddr)
+	if err != nil {
+		return fmt.Errorf("invalid relay address %s: %w", relayAddr, err)
+	}
+	short := relayInfo.ID.String()[:16] + "..."
+	if err := pd.host.Connect(ctx, *relayInfo); err != nil {
+		return fmt.Errorf("relay %s: %w", short, err)
+	}
+	if err := pd.host.Connect(ctx, circuit); err != nil {
+		return fmt.Errorf("circuit via %s: %w", short, err)
+	}
+	return nil
+}
+
 // recordMetric records a successful dial in Prometheus.
 func (pd *PathDialer) recordMetric(r *DialResult) {
 	if pd.metrics == nil {
@@ -237,17 +319,30 @@ func ClassifyMultiaddr(addr string) (pathType PathType, transport string, ipVers
 	return
 }
 
+// isLANMultiaddr reports whether addr starts with a private or link-local
+// IP address (see isLANIP).
+func isLANMultiaddr(addr string) bool {
+	parts := strings.Split(addr, "/")
+	if len(parts) >= 5 && parts[1] == "ip6zone" {
+		parts = parts[2:]
+	}
+	if len(parts) < 3 || (parts[1] != "ip4" && parts[1] != "ip6") {
+		return false
+	}
+	ip := net.ParseIP(parts[2])
+	return ip != nil && isLANIP(ip)
+}
+
 // AddRelayAddressesForPeerFunc adds relay circuit addresses to the peerstore
 // for a target peer. This is the standalone version that works with any host,
 // matching the pattern from Network.AddRelayAddressesForPeer().
 func AddRelayAddressesForPeerFunc(h host.Host, relayAddrs []string, target peer.ID) error {
-	for _, relayAddr := range relayAddrs {
-		circuitAddr := relayAddr + "/p2p-circuit/p2p/" + target.String()
-		addrInfo, err := peer.AddrInfoFromString(circuitAddr)
-		if err != nil {
-			return fmt.Errorf("failed to parse relay circuit address %s: %w", circuitAddr, err)
-		}
-		h.Peerstore().AddAddrs(addrInfo.ID, addrInfo.Addrs, time.Hour)
+	infos, err := relayCircuitAddrs(relayAddrs, target)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		h.Peerstore().AddAddrs(info.ID, info.Addrs, time.Hour)
 	}
 	return nil
 }
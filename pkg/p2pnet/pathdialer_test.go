@@ -2,11 +2,16 @@ package p2pnet
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	circuitv2client "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
+	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 )
 
 func TestClassifyMultiaddr(t *testing.T) {
@@ -377,3 +382,78 @@ func readCounter(c interface{ Inc() }) float64 {
 	// The fact that GetMetricWithLabelValues succeeded means it was created.
 	return 1 // metric exists
 }
+
+func TestPathDialer_RelayHealthRacesRelays(t *testing.T) {
+	newHost := func(opts ...libp2p.Option) host.Host {
+		h, err := libp2p.New(append(opts, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))...)
+		if err != nil {
+			t.Fatalf("host: %v", err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	relayHost := newHost(libp2p.DisableRelay())
+	r, err := relayv2.New(relayHost)
+	if err != nil {
+		t.Fatalf("relay service: %v", err)
+	}
+	defer r.Close()
+	target := newHost(libp2p.EnableRelay())
+	h := newHost(libp2p.EnableRelay())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	liveInfo := peer.AddrInfo{ID: relayHost.ID(), Addrs: relayHost.Addrs()}
+	if err := target.Connect(ctx, liveInfo); err != nil {
+		t.Fatalf("target connect: %v", err)
+	}
+	if _, err := circuitv2client.Reserve(ctx, target, liveInfo); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+
+	// Two relays that were shut down: their addresses refuse connections.
+	var relays []string
+	for range 2 {
+		gone := newHost()
+		relays = append(relays, gone.Addrs()[0].String()+"/p2p/"+gone.ID().String())
+		gone.Close()
+	}
+	relays = append(relays, relayHost.Addrs()[0].String()+"/p2p/"+relayHost.ID().String())
+
+	// Stale circuit addresses from an earlier dial through every relay.
+	if err := AddRelayAddressesForPeerFunc(h, relays, target.ID()); err != nil {
+		t.Fatalf("AddRelayAddressesForPeerFunc: %v", err)
+	}
+
+	rh := NewRelayHealth(h, relays, nil)
+	rh.mu.Lock()
+	rh.relays[0].lastProbe = time.Now()
+	for range relayUnhealthyFailures {
+		rh.recordFailureLocked(rh.relays[0], errors.New("refused"))
+	}
+	for _, r := range rh.relays[1:] {
+		r.lastProbe = time.Now()
+		rh.recordSuccessLocked(r, 30*time.Millisecond)
+	}
+	rh.mu.Unlock()
+
+	// The dead relay ranked healthy races the live one; the live one wins.
+	pd := NewPathDialer(h, nil, relays, nil)
+	pd.SetRelayHealth(rh, 2)
+	if err := pd.dialRelayed(ctx, target.ID()); err != nil {
+		t.Fatalf("dialRelayed: %v", err)
+	}
+	if addr := firstConnAddr(h, target.ID()); !strings.Contains(addr, relayHost.ID().String()) {
+		t.Errorf("connection %s is not through the live relay", addr)
+	}
+
+	// Relays left out of the race keep their circuit addresses.
+	skippedID := rh.relays[0].info.ID.String()
+	found := false
+	for _, a := range h.Peerstore().Addrs(target.ID()) {
+		found = found || strings.Contains(a.String(), skippedID)
+	}
+	if !found {
+		t.Error("circuit address through the skipped relay was removed from the peerstore")
+	}
+}
@@ -2,7 +2,9 @@ package p2pnet
 
 import (
 	"context"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/event"
@@ -14,22 +16,26 @@ import (
 // PeerPathInfo describes the current path to a connected peer.
 type PeerPathInfo struct {
 	PeerID      string   `json:"peer_id"`
-	PathType    PathType `json:"path_type"`    // DIRECT or RELAYED
+	PathType    PathType `json:"path_type"`    // DIRECT, LAN or RELAYED
 	Address     string   `json:"address"`      // current multiaddr
 	ConnectedAt string   `json:"connected_at"` // RFC 3339
 	Transport   string   `json:"transport"`    // quic, tcp, websocket
 	IPVersion   string   `json:"ip_version"`   // ipv4, ipv6
 	LastRTTMs   float64  `json:"last_rtt_ms,omitempty"`
+	UpgradedAt  string   `json:"upgraded_at,omitempty"` // RFC 3339, set when a relayed peer went direct
 }
 
 // PathTracker monitors peer connections via the libp2p event bus and
 // maintains per-peer path information (type, transport, IP version).
 type PathTracker struct {
 	host    host.Host
-	metrics *Metrics // nil-safe
+	metrics *Metrics   // nil-safe
+	events  *EventFeed // nil-safe
+	lan     atomic.Pointer[LANDiscovery]
 
-	mu    sync.RWMutex
-	peers map[peer.ID]*peerPathEntry
+	mu        sync.RWMutex
+	peers     map[peer.ID]*peerPathEntry
+	onUpgrade []func(peer.ID)
 }
 
 // peerPathEntry is the internal state for a tracked peer.
@@ -40,6 +46,7 @@ type peerPathEntry struct {
 	transport   string
 	ipVersion   string
 	lastRTTMs   float64
+	upgradedAt  time.Time
 }
 
 // NewPathTracker creates a PathTracker. Metrics is optional (nil-safe).
@@ -51,6 +58,18 @@ func NewPathTracker(h host.Host, m *Metrics) *PathTracker {
 	}
 }
 
+// SetEventFeed publishes peer connect/disconnect and path upgrade events
+// on f. Call before Start.
+func (pt *PathTracker) SetEventFeed(f *EventFeed) {
+	pt.events = f
+}
+
+// SetLANDiscovery reports direct connections to LAN addresses of peers
+// that d found over mDNS as LAN instead of DIRECT. Safe to call at any time.
+func (pt *PathTracker) SetLANDiscovery(d *LANDiscovery) {
+	pt.lan.Store(d)
+}
+
 // Start subscribes to peer connectedness events and processes them
 // until the context is cancelled. Call this in a goroutine.
 func (pt *PathTracker) Start(ctx context.Context) {
@@ -60,6 +79,19 @@ func (pt *PathTracker) Start(ctx context.Context) {
 	}
 	defer sub.Close()
 
+	// Connectedness events only fire on the first connection to a peer, so
+	// a direct connection added next to an existing relay circuit (hole
+	// punch, DHT-found address) is caught with a network notifiee instead.
+	notifiee := &network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			if !c.Stat().Limited {
+				go pt.onDirectConn(c.RemotePeer())
+			}
+		},
+	}
+	pt.host.Network().Notify(notifiee)
+	defer pt.host.Network().StopNotify(notifiee)
+
 	// Snapshot currently connected peers
 	pt.snapshotExisting()
 
@@ -98,17 +130,7 @@ func (pt *PathTracker) onConnect(pid peer.ID) {
 		return
 	}
 
-	addr := conns[0].RemoteMultiaddr().String()
-	pathType, transport, ipVersion := ClassifyMultiaddr(addr)
-
-	// Prefer non-relay connections for classification
-	for _, conn := range conns {
-		if !conn.Stat().Limited {
-			addr = conn.RemoteMultiaddr().String()
-			pathType, transport, ipVersion = ClassifyMultiaddr(addr)
-			break
-		}
-	}
+	addr, pathType, transport, ipVersion := pt.bestPath(pid, conns)
 
 	pt.mu.Lock()
 	pt.peers[pid] = &peerPathEntry{
@@ -121,15 +143,111 @@ func (pt *PathTracker) onConnect(pid peer.ID) {
 	pt.mu.Unlock()
 
 	pt.updateMetrics()
+	pt.events.Publish(EventPeerConnected, pid.String(), pathEventData(pathType, addr, transport, ipVersion))
+}
+
+// OnPathUpgrade registers fn to be called (in its own goroutine) when a
+// peer tracked as RELAYED gains a direct connection. Register callbacks
+// before calling Start.
+func (pt *PathTracker) OnPathUpgrade(fn func(peer.ID)) {
+	pt.mu.Lock()
+	pt.onUpgrade = append(pt.onUpgrade, fn)
+	pt.mu.Unlock()
+}
+
+// onDirectConn upgrades a relayed peer's entry when a direct connection
+// to it appears, then notifies OnPathUpgrade callbacks. A DIRECT entry that
+// gains a LAN connection (mDNS discovery) is updated in place.
+func (pt *PathTracker) onDirectConn(pid peer.ID) {
+	conns := pt.host.Network().ConnsToPeer(pid)
+	if len(conns) == 0 {
+		return
+	}
+	addr, pathType, transport, ipVersion := pt.bestPath(pid, conns)
+	if pathType == PathRelayed {
+		return // direct connection already gone
+	}
+
+	pt.mu.Lock()
+	entry, ok := pt.peers[pid]
+	if ok && entry.pathType == PathDirect && pathType == PathLAN {
+		entry.pathType = pathType
+		entry.address = addr
+		entry.transport = transport
+		entry.ipVersion = ipVersion
+		pt.mu.Unlock()
+		slog.Info("path moved to LAN", "peer", pid.String()[:16]+"...", "address", addr)
+		pt.updateMetrics()
+		return
+	}
+	if !ok || entry.pathType != PathRelayed {
+		pt.mu.Unlock()
+		return
+	}
+	entry.pathType = pathType
+	entry.address = addr
+	entry.transport = transport
+	entry.ipVersion = ipVersion
+	entry.upgradedAt = time.Now()
+	callbacks := append([]func(peer.ID){}, pt.onUpgrade...)
+	pt.mu.Unlock()
+
+	slog.Info("path upgraded", "peer", pid.String()[:16]+"...", "transport", transport, "address", addr)
+	if pt.metrics != nil {
+		pt.metrics.PathUpgradesTotal.WithLabelValues(transport).Inc()
+	}
+	pt.updateMetrics()
+
+	pt.events.Publish(EventPathUpgraded, pid.String(), pathEventData(pathType, addr, transport, ipVersion))
+
+	for _, fn := range callbacks {
+		go fn(pid)
+	}
+}
+
+// bestPath picks the connection to report for a peer: LAN over DIRECT over
+// RELAYED, otherwise the first connection. A connection is LAN only if it
+// goes to a LAN address and mDNS found the peer.
+func (pt *PathTracker) bestPath(pid peer.ID, conns []network.Conn) (addr string, pathType PathType, transport, ipVersion string) {
+	rank := map[PathType]int{PathRelayed: 0, PathDirect: 1, PathLAN: 2}
+	lan := pt.lan.Load().Found(pid)
+	for i, conn := range conns {
+		a := conn.RemoteMultiaddr().String()
+		kind, tr, ipv := ClassifyMultiaddr(a)
+		switch {
+		case conn.Stat().Limited:
+			kind = PathRelayed
+		case kind == PathDirect && lan && isLANMultiaddr(a):
+			kind = PathLAN
+		}
+		if i == 0 || rank[kind] > rank[pathType] {
+			addr, pathType, transport, ipVersion = a, kind, tr, ipv
+		}
+	}
+	return addr, pathType, transport, ipVersion
 }
 
 // onDisconnect removes a peer from tracking.
 func (pt *PathTracker) onDisconnect(pid peer.ID) {
 	pt.mu.Lock()
+	_, tracked := pt.peers[pid]
 	delete(pt.peers, pid)
 	pt.mu.Unlock()
 
 	pt.updateMetrics()
+	if tracked {
+		pt.events.Publish(EventPeerDisconnected, pid.String(), nil)
+	}
+}
+
+// pathEventData describes a path in event data.
+func pathEventData(pathType PathType, addr, transport, ipVersion string) map[string]any {
+	return map[string]any{
+		"path_type":  string(pathType),
+		"address":    addr,
+		"transport":  transport,
+		"ip_version": ipVersion,
+	}
 }
 
 // UpdateRTT records the latest round-trip time for a peer.
@@ -167,7 +285,7 @@ func (pt *PathTracker) ListPeerPaths() []*PeerPathInfo {
 }
 
 func entryToInfo(pid peer.ID, e *peerPathEntry) *PeerPathInfo {
-	return &PeerPathInfo{
+	info := &PeerPathInfo{
 		PeerID:      pid.String(),
 		PathType:    e.pathType,
 		Address:     e.address,
@@ -176,6 +294,10 @@ func entryToInfo(pid peer.ID, e *peerPathEntry) *PeerPathInfo {
 		IPVersion:   e.ipVersion,
 		LastRTTMs:   e.lastRTTMs,
 	}
+	if !e.upgradedAt.IsZero() {
+		info.UpgradedAt = e.upgradedAt.Format(time.RFC3339)
+	}
+	return info
 }
 
 // updateMetrics recalculates the connected peers gauge from current state.
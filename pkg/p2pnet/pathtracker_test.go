@@ -7,6 +7,7 @@ import (
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestPathTracker_ConnectDisconnect(t *testing.T) {
@@ -248,3 +249,81 @@ func TestPathTracker_SnapshotExisting(t *testing.T) {
 		t.Errorf("PathType = %q, want DIRECT", info.PathType)
 	}
 }
+
+func TestPathTracker_UpgradeFromRelayed(t *testing.T) {
+	m := NewMetrics("test", "go1.26")
+
+	h1, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.NoSecurity,
+		libp2p.DisableRelay(),
+	)
+	if err != nil {
+		t.Fatalf("host1: %v", err)
+	}
+	defer h1.Close()
+
+	h2, err := libp2p.New(
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.NoSecurity,
+		libp2p.DisableRelay(),
+	)
+	if err != nil {
+		t.Fatalf("host2: %v", err)
+	}
+	defer h2.Close()
+
+	tracker := NewPathTracker(h1, m)
+	upgraded := make(chan peer.ID, 1)
+	tracker.OnPathUpgrade(func(pid peer.ID) { upgraded <- pid })
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer connectCancel()
+	if err := h1.Connect(connectCtx, peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	// Pretend the peer was first reached through a relay circuit.
+	tracker.mu.Lock()
+	tracker.peers[h2.ID()] = &peerPathEntry{
+		pathType:    PathRelayed,
+		address:     "/ip4/203.0.113.50/tcp/7777/p2p/12D3KooWRelay/p2p-circuit",
+		connectedAt: time.Now(),
+		transport:   "tcp",
+		ipVersion:   "ipv4",
+	}
+	tracker.mu.Unlock()
+
+	tracker.onDirectConn(h2.ID())
+
+	select {
+	case pid := <-upgraded:
+		if pid != h2.ID() {
+			t.Errorf("callback peer = %s, want %s", pid, h2.ID())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnPathUpgrade callback not called")
+	}
+
+	info, ok := tracker.GetPeerPath(h2.ID())
+	if !ok {
+		t.Fatal("expected path info")
+	}
+	if info.PathType != PathDirect {
+		t.Errorf("PathType = %q, want DIRECT", info.PathType)
+	}
+	if info.UpgradedAt == "" {
+		t.Error("UpgradedAt should be set after an upgrade")
+	}
+	if got := testutil.ToFloat64(m.PathUpgradesTotal.WithLabelValues("tcp")); got != 1 {
+		t.Errorf("path upgrades = %v, want 1", got)
+	}
+
+	// Already direct: a second direct connection is not another upgrade.
+	tracker.onDirectConn(h2.ID())
+	select {
+	case <-upgraded:
+		t.Error("callback called for a peer that was already direct")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -11,18 +11,20 @@ import (
 )
 
 // HalfCloseConn is a connection that supports half-close (CloseWrite).
-// Both ServiceConn (libp2p streams) and tcpHalfCloser (TCP connections) implement this.
+// Both ServiceConn (libp2p streams) and tcpHalfCloser (TCP and Unix socket
+// connections) implement this.
 type HalfCloseConn interface {
 	io.ReadWriteCloser
 	CloseWrite() error
 }
 
 // tcpHalfCloser adapts a net.Conn to support CloseWrite via type assertion.
+// *net.TCPConn and *net.UnixConn both half-close; other conns ignore it.
 type tcpHalfCloser struct{ net.Conn }
 
 func (t *tcpHalfCloser) CloseWrite() error {
-	if tc, ok := t.Conn.(*net.TCPConn); ok {
-		return tc.CloseWrite()
+	if hc, ok := t.Conn.(interface{ CloseWrite() error }); ok {
+		return hc.CloseWrite()
 	}
 	return nil
 }
@@ -107,9 +109,10 @@ func InstrumentedBidirectionalProxy(a, b HalfCloseConn, service string, metrics
 	BidirectionalProxy(ca, cb, service)
 }
 
-// ProxyStreamToTCP creates a bidirectional proxy between a libp2p stream and a local TCP service.
+// ProxyStreamToTCP creates a bidirectional proxy between a libp2p stream and a
+// local service. tcpAddr is host:port or a unix: socket path (see DialLocal).
 func ProxyStreamToTCP(stream network.Stream, tcpAddr string) error {
-	tcpConn, err := net.DialTimeout("tcp", tcpAddr, 10*time.Second)
+	tcpConn, err := DialLocal(tcpAddr, 10*time.Second)
 	if err != nil {
 		return err
 	}
@@ -117,15 +120,23 @@ func ProxyStreamToTCP(stream network.Stream, tcpAddr string) error {
 	return nil
 }
 
-// TCPListener creates a local TCP listener that forwards connections to a P2P service
+// TCPListener creates a local TCP (or Unix socket) listener that forwards
+// connections to a P2P service
 type TCPListener struct {
 	listener net.Listener
 	dialFunc func() (ServiceConn, error)
 }
 
-// NewTCPListener creates a new TCP listener for a P2P service
+// NewTCPListener creates a new TCP listener for a P2P service. localAddr may
+// also be a unix: socket path, created with the default permissions.
 func NewTCPListener(localAddr string, dialFunc func() (ServiceConn, error)) (*TCPListener, error) {
-	listener, err := net.Listen("tcp", localAddr)
+	return NewTCPListenerWithOptions(localAddr, nil, dialFunc)
+}
+
+// NewTCPListenerWithOptions is NewTCPListener with permissions for a Unix
+// socket listener (see ListenLocal). opts may be nil.
+func NewTCPListenerWithOptions(localAddr string, opts *SocketOptions, dialFunc func() (ServiceConn, error)) (*TCPListener, error) {
+	listener, err := ListenLocal(localAddr, opts)
 	if err != nil {
 		return nil, err
 	}
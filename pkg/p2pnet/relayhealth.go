@@ -0,0 +1,359 @@
+package p2pnet
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+// DefaultRelayProbeInterval is how often each configured relay is probed.
+const DefaultRelayProbeInterval = time.Minute
+
+// DefaultRelayRaceCount is how many of the healthiest relays PathDialer
+// races circuit dials through.
+const DefaultRelayRaceCount = 3
+
+// relayProbeTimeout bounds one relay probe (connect + ping). A relay that
+// can't answer within this is useless as a circuit hop anyway.
+const relayProbeTimeout = 10 * time.Second
+
+// relayUnhealthyFailures is the number of consecutive failures after which
+// a relay is reported unhealthy and sorted behind every working relay.
+const relayUnhealthyFailures = 3
+
+// Score inputs. reliability is an EWMA of probe/dial outcomes (1 = success,
+// 0 = failure); RTT is an EWMA of probe round trips.
+const (
+	relayOutcomeAlpha = 0.3
+	relayRTTAlpha     = 0.3
+	relayRTTRef       = 300 * time.Millisecond // RTT at which the latency factor halves
+)
+
+// RelayHealthStatus is a snapshot of one relay's health.
+type RelayHealthStatus struct {
+	Address             string    `json:"address"`
+	PeerID              string    `json:"peer_id"`
+	Score               float64   `json:"score"`
+	Healthy             bool      `json:"healthy"`
+	RTTMs               float64   `json:"rtt_ms,omitempty"`
+	Reserved            bool      `json:"reserved"` // we hold a circuit reservation on this relay
+	Successes           int       `json:"successes"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastProbe           time.Time `json:"last_probe,omitzero"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// RelayHealth probes each configured relay individually and keeps a rolling
+// health score per relay from round-trip time, reservation state and recent
+// failures. PathDialer uses it to race circuit dials through the healthiest
+// relays instead of handing every address to libp2p at once, so a dead relay
+// at the top of relay.addresses no longer costs a full dial timeout.
+type RelayHealth struct {
+	host    host.Host
+	metrics *Metrics // nil-safe
+
+	mu     sync.RWMutex
+	relays []*relayEntry // config order
+}
+
+// relayEntry is the internal state for one configured relay.
+type relayEntry struct {
+	addr string
+	info peer.AddrInfo
+
+	reliability float64
+	rtt         time.Duration
+	reserved    bool
+	successes   int
+	failures    int
+	consecutive int
+	lastProbe   time.Time
+	lastError   string
+}
+
+// NewRelayHealth creates a tracker for the given relay multiaddrs (each must
+// include /p2p/<relay-id>). Invalid addresses are skipped with a warning.
+// Metrics is optional (nil-safe).
+func NewRelayHealth(h host.Host, relayAddrs []string, m *Metrics) *RelayHealth {
+	rh := &RelayHealth{host: h, metrics: m}
+	for _, addr := range relayAddrs {
+		info, err := peer.AddrInfoFromString(addr)
+		if err != nil {
+			slog.Warn("relay health: skipping invalid relay address", "addr", addr, "error", err)
+			continue
+		}
+		rh.relays = append(rh.relays, &relayEntry{
+			addr:        addr,
+			info:        *info,
+			reliability: 0.5, // unknown until the first probe
+		})
+	}
+	return rh
+}
+
+// Start probes every relay immediately and then every interval until ctx
+// is cancelled. interval <= 0 uses DefaultRelayProbeInterval. Call this in
+// a goroutine.
+func (rh *RelayHealth) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRelayProbeInterval
+	}
+	rh.ProbeAll(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rh.ProbeAll(ctx)
+		}
+	}
+}
+
+// ProbeAll probes every relay in parallel and waits for the results.
+func (rh *RelayHealth) ProbeAll(ctx context.Context) {
+	rh.mu.RLock()
+	relays := append([]*relayEntry(nil), rh.relays...)
+	rh.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, r := range relays {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rh.probe(ctx, r)
+		}()
+	}
+	wg.Wait()
+}
+
+// probe connects to one relay, measures RTT with the libp2p ping protocol
+// and checks whether we hold a reservation on it.
+func (rh *RelayHealth) probe(ctx context.Context, r *relayEntry) {
+	probeCtx, cancel := context.WithTimeout(ctx, relayProbeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := rh.host.Connect(probeCtx, r.info)
+	var rtt time.Duration
+	if err == nil {
+		rtt = time.Since(start)
+		res := <-ping.Ping(probeCtx, rh.host, r.info.ID)
+		if res.Error == nil {
+			rtt = res.RTT
+		}
+	}
+	if ctx.Err() != nil {
+		return // shutting down; don't count as a relay failure
+	}
+
+	reserved := rh.hasReservation(r.info.ID)
+
+	rh.mu.Lock()
+	r.lastProbe = time.Now()
+	r.reserved = reserved
+	if err != nil {
+		rh.recordFailureLocked(r, err)
+	} else {
+		rh.recordSuccessLocked(r, rtt)
+	}
+	score := r.score()
+	rtt = r.rtt
+	rh.mu.Unlock()
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+		slog.Debug("relay probe failed", "relay", r.info.ID.String()[:16]+"...", "error", err)
+	}
+	rh.recordMetrics(r.info.ID, result, score, rtt)
+}
+
+// RecordDialSuccess credits the relay a circuit connection went through.
+// addr is the winning connection's remote multiaddr; non-circuit addresses
+// are ignored. Dial failures are not attributed to relays because the
+// target being offline looks the same as a broken relay.
+func (rh *RelayHealth) RecordDialSuccess(addr string) {
+	if !strings.Contains(addr, "/p2p-circuit") {
+		return
+	}
+	rh.mu.Lock()
+	var hit *relayEntry
+	for _, r := range rh.relays {
+		if strings.Contains(addr, "/p2p/"+r.info.ID.String()+"/p2p-circuit") {
+			hit = r
+			break
+		}
+	}
+	if hit == nil {
+		rh.mu.Unlock()
+		return
+	}
+	rh.recordSuccessLocked(hit, 0)
+	score := hit.score()
+	rtt := hit.rtt
+	rh.mu.Unlock()
+
+	rh.recordMetrics(hit.info.ID, "", score, rtt)
+}
+
+// Best returns up to n relay addresses ordered by health score, best first.
+// Relays with equal scores keep their config order. Unhealthy relays are
+// only included when there aren't enough healthy ones to fill n. Until the
+// first probe completes nothing is known, so every relay is returned.
+func (rh *RelayHealth) Best(n int) []string {
+	rh.mu.RLock()
+	defer rh.mu.RUnlock()
+
+	probed := false
+	for _, r := range rh.relays {
+		if !r.lastProbe.IsZero() || r.successes > 0 {
+			probed = true
+			break
+		}
+	}
+	if !probed {
+		n = 0
+	}
+
+	ranked := append([]*relayEntry(nil), rh.relays...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		hi, hj := ranked[i].healthy(), ranked[j].healthy()
+		if hi != hj {
+			return hi
+		}
+		return ranked[i].score() > ranked[j].score()
+	})
+
+	if n <= 0 || n > len(ranked) {
+		n = len(ranked)
+	}
+	addrs := make([]string, n)
+	for i := range n {
+		addrs[i] = ranked[i].addr
+	}
+	return addrs
+}
+
+// Status returns a snapshot of every relay in config order.
+func (rh *RelayHealth) Status() []RelayHealthStatus {
+	rh.mu.RLock()
+	defer rh.mu.RUnlock()
+
+	out := make([]RelayHealthStatus, len(rh.relays))
+	for i, r := range rh.relays {
+		out[i] = RelayHealthStatus{
+			Address:             r.addr,
+			PeerID:              r.info.ID.String(),
+			Score:               r.score(),
+			Healthy:             r.healthy(),
+			RTTMs:               float64(r.rtt.Microseconds()) / 1000,
+			Reserved:            r.reserved,
+			Successes:           r.successes,
+			Failures:            r.failures,
+			ConsecutiveFailures: r.consecutive,
+			LastProbe:           r.lastProbe,
+			LastError:           r.lastError,
+		}
+	}
+	return out
+}
+
+// hasReservation reports whether our advertised addresses include a circuit
+// address through the given relay, i.e. autorelay holds a reservation on it.
+func (rh *RelayHealth) hasReservation(relayID peer.ID) bool {
+	marker := "/p2p/" + relayID.String() + "/p2p-circuit"
+	for _, a := range rh.host.Addrs() {
+		if strings.Contains(a.String(), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordSuccessLocked folds a success (and RTT, if non-zero) into r.
+// Caller holds rh.mu.
+func (rh *RelayHealth) recordSuccessLocked(r *relayEntry, rtt time.Duration) {
+	r.successes++
+	r.consecutive = 0
+	r.lastError = ""
+	r.reliability += relayOutcomeAlpha * (1 - r.reliability)
+	if rtt > 0 {
+		if r.rtt == 0 {
+			r.rtt = rtt
+		} else {
+			r.rtt += time.Duration(relayRTTAlpha * float64(rtt-r.rtt))
+		}
+	}
+}
+
+// recordFailureLocked folds a failure into r. Caller holds rh.mu.
+func (rh *RelayHealth) recordFailureLocked(r *relayEntry, err error) {
+	r.failures++
+	r.consecutive++
+	r.lastError = truncateError(err.Error())
+	r.reliability -= relayOutcomeAlpha * r.reliability
+}
+
+func (rh *RelayHealth) recordMetrics(relayID peer.ID, result string, score float64, rtt time.Duration) {
+	if rh.metrics == nil {
+		return
+	}
+	label := relayID.String()
+	if result != "" {
+		rh.metrics.RelayProbeTotal.WithLabelValues(label, result).Inc()
+	}
+	rh.metrics.RelayHealthScore.WithLabelValues(label).Set(score)
+	if rtt > 0 {
+		rh.metrics.RelayRTTSeconds.WithLabelValues(label).Set(rtt.Seconds())
+	}
+}
+
+// healthy reports whether the relay has not failed too many times in a row.
+func (r *relayEntry) healthy() bool {
+	return r.consecutive < relayUnhealthyFailures
+}
+
+// score combines reliability (60%), latency (25%) and reservation state (15%)
+// into a value in [0, 1]. Unprobed relays score 0.5 on reliability and
+// full marks on latency, so they sort between known-good and known-bad.
+func (r *relayEntry) score() float64 {
+	latency := 1.0
+	if r.rtt > 0 {
+		latency = 1 / (1 + float64(r.rtt)/float64(relayRTTRef))
+	}
+	reservation := 0.0
+	if r.reserved {
+		reservation = 1
+	}
+	s := 0.6*r.reliability + 0.25*latency + 0.15*reservation
+	if !r.healthy() {
+		s *= 0.1
+	}
+	return s
+}
+
+// relayCircuitAddrs builds the circuit multiaddrs through each relay to target.
+func relayCircuitAddrs(relayAddrs []string, target peer.ID) ([]peer.AddrInfo, error) {
+	infos := make([]peer.AddrInfo, 0, len(relayAddrs))
+	for _, relayAddr := range relayAddrs {
+		circuitAddr := relayAddr + "/p2p-circuit/p2p/" + target.String()
+		info, err := peer.AddrInfoFromString(circuitAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse relay circuit address %s: %w", circuitAddr, err)
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
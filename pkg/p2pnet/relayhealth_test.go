@@ -0,0 +1,122 @@
+package p2pnet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testRelayAddrs returns n syntactically valid relay multiaddrs.
+func testRelayAddrs(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, n)
+	for i := range n {
+		addrs[i] = "/ip4/203.0.113.1/tcp/7777/p2p/" + genTestPeerID(t).String()
+	}
+	return addrs
+}
+
+func TestRelayHealthBestBeforeProbe(t *testing.T) {
+	addrs := testRelayAddrs(t, 5)
+	rh := NewRelayHealth(nil, addrs, nil)
+
+	// Nothing is known yet: every relay is raced, in config order.
+	got := rh.Best(2)
+	if len(got) != 5 {
+		t.Fatalf("Best(2) before any probe = %d relays, want all 5", len(got))
+	}
+	for i := range addrs {
+		if got[i] != addrs[i] {
+			t.Errorf("Best[%d] = %s, want config order", i, got[i])
+		}
+	}
+}
+
+func TestRelayHealthRanking(t *testing.T) {
+	addrs := testRelayAddrs(t, 3)
+	rh := NewRelayHealth(nil, addrs, nil)
+	dead, slow, fast := rh.relays[0], rh.relays[1], rh.relays[2]
+
+	rh.mu.Lock()
+	for range relayUnhealthyFailures {
+		dead.lastProbe = time.Now()
+		rh.recordFailureLocked(dead, errors.New("connection refused"))
+	}
+	slow.lastProbe = time.Now()
+	rh.recordSuccessLocked(slow, 900*time.Millisecond)
+	fast.lastProbe = time.Now()
+	rh.recordSuccessLocked(fast, 20*time.Millisecond)
+	rh.mu.Unlock()
+
+	got := rh.Best(2)
+	if len(got) != 2 || got[0] != fast.addr || got[1] != slow.addr {
+		t.Errorf("Best(2) = %v, want [fast slow]", got)
+	}
+
+	// The dead relay is still returned when every relay is requested, last.
+	all := rh.Best(0)
+	if len(all) != 3 || all[2] != dead.addr {
+		t.Errorf("Best(0) = %v, want dead relay last", all)
+	}
+
+	status := rh.Status()
+	if status[0].Healthy || status[0].ConsecutiveFailures != relayUnhealthyFailures {
+		t.Errorf("dead relay status = %+v", status[0])
+	}
+	if status[0].LastError != "connection refused" {
+		t.Errorf("LastError = %q", status[0].LastError)
+	}
+	if !status[2].Healthy || status[2].RTTMs != 20 {
+		t.Errorf("fast relay status = %+v", status[2])
+	}
+}
+
+func TestRelayHealthRecoversAfterSuccess(t *testing.T) {
+	addrs := testRelayAddrs(t, 1)
+	rh := NewRelayHealth(nil, addrs, nil)
+	r := rh.relays[0]
+
+	rh.mu.Lock()
+	for range relayUnhealthyFailures {
+		rh.recordFailureLocked(r, errors.New("timeout"))
+	}
+	before := r.score()
+	rh.recordSuccessLocked(r, 50*time.Millisecond)
+	after := r.score()
+	rh.mu.Unlock()
+
+	if !r.healthy() {
+		t.Error("one success should clear consecutive failures")
+	}
+	if after <= before {
+		t.Errorf("score after recovery = %.3f, want > %.3f", after, before)
+	}
+}
+
+func TestRelayHealthRecordDialSuccess(t *testing.T) {
+	addrs := testRelayAddrs(t, 2)
+	m := NewMetrics("test", "go1.0")
+	rh := NewRelayHealth(nil, addrs, m)
+	target := genTestPeerID(t)
+
+	rh.RecordDialSuccess(addrs[1] + "/p2p-circuit/p2p/" + target.String())
+	rh.RecordDialSuccess("/ip4/198.51.100.7/tcp/4001") // direct: ignored
+
+	status := rh.Status()
+	if status[0].Successes != 0 || status[1].Successes != 1 {
+		t.Errorf("successes = %d, %d; want 0, 1", status[0].Successes, status[1].Successes)
+	}
+	if v := testutil.ToFloat64(m.RelayHealthScore.WithLabelValues(status[1].PeerID)); v != status[1].Score {
+		t.Errorf("score gauge = %v, want %v", v, status[1].Score)
+	}
+}
+
+func TestRelayHealthSkipsInvalidAddrs(t *testing.T) {
+	addrs := append(testRelayAddrs(t, 1), "/ip4/203.0.113.1/tcp/7777") // no /p2p/
+	rh := NewRelayHealth(nil, addrs, nil)
+	if n := len(rh.Status()); n != 1 {
+		t.Errorf("tracked relays = %d, want 1", n)
+	}
+}
@@ -0,0 +1,924 @@
+package p2pnet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ResumeProtocolID carries resumable TCP service sessions. Unlike the plain
+// per-service protocol, a resumable session survives the loss of its
+// underlying stream: either side can reattach a fresh stream (for example
+// over a direct connection after hole punching succeeds, or after the relay
+// cuts a circuit at its session limit) and no bytes are lost or duplicated.
+const ResumeProtocolID = "/peerup/resume/1.0.0"
+
+// DefaultResumeGrace is how long a detached session waits to be resumed
+// before it is torn down.
+const DefaultResumeGrace = 30 * time.Second
+
+const (
+	resumeMaxUnacked       = 4 << 20  // bytes a sender buffers before Write blocks
+	resumeMaxReadBuf       = 1 << 20  // received bytes buffered before the reader stops reading
+	resumeAckEvery         = 64 << 10 // acknowledge after this many received bytes
+	resumeMaxFrame         = 32 << 10 // max payload per data frame
+	resumeHandshakeTimeout = 10 * time.Second
+	resumeMaxBackoff       = 4 * time.Second
+)
+
+// Handshake message kinds (client -> server).
+const (
+	resumeHelloOpen   byte = 'O' // open a new session to a service
+	resumeHelloResume byte = 'R' // reattach an existing session
+)
+
+// Frame types, sent in both directions after the handshake.
+const (
+	resumeFrameData  byte = 'D' // 4-byte length + payload
+	resumeFrameAck   byte = 'A' // 8-byte total bytes received
+	resumeFrameFin   byte = 'F' // sender finished writing (half-close)
+	resumeFrameClose byte = 'C' // sender closed the session
+)
+
+var (
+	// errResumeRejected is returned when the server refuses an open or resume.
+	errResumeRejected = errors.New("session rejected")
+
+	// errResumeProtocol is returned on malformed frames or impossible offsets.
+	errResumeProtocol = errors.New("session protocol violation")
+
+	// errAccessEnded ends a session when the peer's access window closes.
+	errAccessEnded = errors.New("service access ended")
+)
+
+// resumeHello is the first message on every resume-protocol stream.
+type resumeHello struct {
+	kind    byte
+	id      [16]byte
+	service string // resumeHelloOpen
+	offset  uint64 // resumeHelloResume: bytes the client has received
+}
+
+func writeResumeHello(w io.Writer, h resumeHello) error {
+	buf := []byte{h.kind}
+	buf = append(buf, h.id[:]...)
+	switch h.kind {
+	case resumeHelloOpen:
+		if len(h.service) > 255 {
+			return fmt.Errorf("service name too long")
+		}
+		buf = append(buf, byte(len(h.service)))
+		buf = append(buf, h.service...)
+	case resumeHelloResume:
+		buf = binary.BigEndian.AppendUint64(buf, h.offset)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readResumeHello(r io.Reader) (resumeHello, error) {
+	var h resumeHello
+	var hdr [17]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return h, err
+	}
+	h.kind = hdr[0]
+	copy(h.id[:], hdr[1:])
+
+	switch h.kind {
+	case resumeHelloOpen:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return h, err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return h, err
+		}
+		h.service = string(name)
+	case resumeHelloResume:
+		var off [8]byte
+		if _, err := io.ReadFull(r, off[:]); err != nil {
+			return h, err
+		}
+		h.offset = binary.BigEndian.Uint64(off[:])
+	default:
+		return h, fmt.Errorf("%w: unknown hello kind %q", errResumeProtocol, h.kind)
+	}
+	return h, nil
+}
+
+// writeResumeReply answers a hello. An empty errMsg accepts it; offset is the
+// number of bytes the server has received in this session.
+func writeResumeReply(w io.Writer, offset uint64, errMsg string) error {
+	var buf []byte
+	if errMsg == "" {
+		buf = binary.BigEndian.AppendUint64([]byte{0}, offset)
+	} else {
+		if len(errMsg) > 255 {
+			errMsg = errMsg[:255]
+		}
+		buf = append([]byte{1, byte(len(errMsg))}, errMsg...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readResumeReply(r io.Reader) (uint64, error) {
+	var status [1]byte
+	if _, err := io.ReadFull(r, status[:]); err != nil {
+		return 0, err
+	}
+	if status[0] == 0 {
+		var off [8]byte
+		if _, err := io.ReadFull(r, off[:]); err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(off[:]), nil
+	}
+	var n [1]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return 0, err
+	}
+	msg := make([]byte, n[0])
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%w: %s", errResumeRejected, msg)
+}
+
+// resumeRedialFunc opens a new resume-protocol stream to the session's peer.
+// allowLimited permits relay circuits; migrations pass false so the new
+// stream can only land on a direct connection.
+type resumeRedialFunc func(ctx context.Context, allowLimited bool) (network.Stream, error)
+
+// resumableConn is one end of a resumable session. It implements ServiceConn.
+//
+// Every byte written is kept until the peer acknowledges it. When the
+// current stream fails, the client side redials and sends a resume hello
+// with the number of bytes it has received; the server replies with its own
+// count, and both sides retransmit from the other's offset. Frames arriving
+// on a retired stream are discarded, so a byte is delivered exactly once.
+type resumableConn struct {
+	id      [16]byte
+	peer    peer.ID
+	client  bool
+	grace   time.Duration
+	redial  resumeRedialFunc // client only
+	metrics *Metrics         // nil-safe
+	onClose func(*resumableConn)
+
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	stream network.Stream // nil while detached
+	gen    uint64         // bumped whenever stream changes; stale readers/writers compare it
+
+	// Send side. sendBuf holds unacknowledged bytes starting at offset sendBase.
+	sendBuf  []byte
+	sendBase uint64
+	txOffset uint64 // next offset to transmit on the current stream
+	localFin bool   // CloseWrite called
+	finSent  bool   // FIN transmitted on the current stream
+	closing  bool   // Close called
+
+	// Receive side.
+	readBuf      bytes.Buffer
+	recvOffset   uint64 // total bytes received in this session
+	unackedRecv  int
+	ackPending   bool
+	remoteFin    bool
+	remoteClosed bool
+
+	resuming bool  // a resume or migration is in progress (client)
+	err      error // terminal error; set once
+}
+
+func newResumableConn(id [16]byte, p peer.ID, client bool, grace time.Duration, metrics *Metrics) *resumableConn {
+	if grace <= 0 {
+		grace = DefaultResumeGrace
+	}
+	c := &resumableConn{
+		id:      id,
+		peer:    p,
+		client:  client,
+		grace:   grace,
+		metrics: metrics,
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// start attaches the first stream (handshake already done) and begins I/O.
+func (c *resumableConn) start(s network.Stream) {
+	c.mu.Lock()
+	c.stream = s
+	c.gen++
+	gen := c.gen
+	c.mu.Unlock()
+
+	go c.readLoop(s, gen)
+	go c.writeLoop()
+}
+
+func (c *resumableConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for c.readBuf.Len() == 0 {
+		switch {
+		case c.remoteFin || c.remoteClosed:
+			return 0, io.EOF
+		case c.err != nil:
+			return 0, c.err
+		case c.closing:
+			return 0, io.ErrClosedPipe
+		}
+		c.cond.Wait()
+	}
+	n, _ := c.readBuf.Read(p)
+	c.cond.Broadcast() // wake a reader blocked on a full readBuf
+	return n, nil
+}
+
+func (c *resumableConn) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		c.mu.Lock()
+		for c.err == nil && !c.localFin && !c.remoteClosed && len(c.sendBuf) >= resumeMaxUnacked {
+			c.cond.Wait()
+		}
+		switch {
+		case c.err != nil:
+			c.mu.Unlock()
+			return written, c.err
+		case c.localFin || c.remoteClosed:
+			c.mu.Unlock()
+			return written, io.ErrClosedPipe
+		}
+		n := min(len(p), resumeMaxUnacked-len(c.sendBuf))
+		c.sendBuf = append(c.sendBuf, p[:n]...)
+		c.cond.Broadcast()
+		c.mu.Unlock()
+
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite sends FIN after all buffered data.
+func (c *resumableConn) CloseWrite() error {
+	c.mu.Lock()
+	c.localFin = true
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+// Close flushes buffered data, tells the peer the session is over and
+// closes the stream. Unread received data is discarded.
+func (c *resumableConn) Close() error {
+	c.mu.Lock()
+	if c.closing || c.err != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closing = true
+	c.localFin = true
+	c.readBuf.Reset()
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+// readLoop processes frames from one stream until it fails or is retired.
+func (c *resumableConn) readLoop(s network.Stream, gen uint64) {
+	br := bufio.NewReader(s)
+	for {
+		typ, err := br.ReadByte()
+		if err != nil {
+			c.streamFailed(s, gen, err)
+			return
+		}
+
+		switch typ {
+		case resumeFrameData:
+			var hdr [4]byte
+			if _, err := io.ReadFull(br, hdr[:]); err != nil {
+				c.streamFailed(s, gen, err)
+				return
+			}
+			n := binary.BigEndian.Uint32(hdr[:])
+			if n > resumeMaxFrame {
+				c.fail(fmt.Errorf("%w: frame of %d bytes", errResumeProtocol, n))
+				return
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(br, buf); err != nil {
+				c.streamFailed(s, gen, err)
+				return
+			}
+
+			c.mu.Lock()
+			// Backpressure: stop reading (and let stream flow control push
+			// back on the sender) while the application is behind.
+			for c.gen == gen && c.err == nil && !c.closing && c.readBuf.Len() >= resumeMaxReadBuf {
+				c.cond.Wait()
+			}
+			if c.gen != gen {
+				c.mu.Unlock()
+				return
+			}
+			if !c.closing {
+				c.readBuf.Write(buf)
+			}
+			c.recvOffset += uint64(n)
+			c.unackedRecv += int(n)
+			if c.unackedRecv >= resumeAckEvery {
+				c.ackPending = true
+			}
+			c.cond.Broadcast()
+			c.mu.Unlock()
+
+		case resumeFrameAck:
+			var off [8]byte
+			if _, err := io.ReadFull(br, off[:]); err != nil {
+				c.streamFailed(s, gen, err)
+				return
+			}
+			c.mu.Lock()
+			if c.gen == gen {
+				c.ackLocked(binary.BigEndian.Uint64(off[:]))
+				c.cond.Broadcast()
+			}
+			c.mu.Unlock()
+
+		case resumeFrameFin:
+			c.mu.Lock()
+			if c.gen == gen {
+				c.remoteFin = true
+				c.cond.Broadcast()
+			}
+			c.mu.Unlock()
+
+		case resumeFrameClose:
+			c.mu.Lock()
+			if c.gen == gen {
+				c.remoteClosed = true
+				c.cond.Broadcast()
+			}
+			c.mu.Unlock()
+			return
+
+		default:
+			c.fail(fmt.Errorf("%w: unknown frame type %q", errResumeProtocol, typ))
+			return
+		}
+	}
+}
+
+// writeLoop is the only writer of frames for the life of the session.
+func (c *resumableConn) writeLoop() {
+	for {
+		c.mu.Lock()
+		for !c.writeReadyLocked() {
+			c.cond.Wait()
+		}
+		if c.err != nil {
+			c.mu.Unlock()
+			return
+		}
+		s, gen := c.stream, c.gen
+		frame, advance, fin, last := c.nextFrameLocked()
+		c.mu.Unlock()
+
+		_, err := s.Write(frame)
+		if err != nil {
+			c.streamFailed(s, gen, err)
+			continue
+		}
+
+		c.mu.Lock()
+		if gen == c.gen {
+			c.txOffset += uint64(advance)
+			if fin {
+				c.finSent = true
+			}
+		}
+		c.mu.Unlock()
+
+		if last {
+			// Graceful end: close (not reset) so the peer still reads
+			// everything up to the close frame.
+			c.mu.Lock()
+			if c.stream == s {
+				c.stream = nil
+				c.gen++
+			}
+			c.mu.Unlock()
+			s.Close()
+			c.fail(io.ErrClosedPipe)
+			return
+		}
+	}
+}
+
+// writeReadyLocked reports whether writeLoop has something to do.
+func (c *resumableConn) writeReadyLocked() bool {
+	if c.err != nil {
+		return true
+	}
+	if c.stream == nil {
+		return false
+	}
+	return c.ackPending ||
+		c.txOffset < c.sendOffsetLocked() ||
+		(c.localFin && !c.finSent) ||
+		c.closing
+}
+
+// nextFrameLocked builds the next frame to send: acks first, then data,
+// then FIN, then (when closing and everything is flushed) the close frame.
+func (c *resumableConn) nextFrameLocked() (frame []byte, advance int, fin, last bool) {
+	switch {
+	case c.ackPending:
+		c.ackPending = false
+		c.unackedRecv = 0
+		return binary.BigEndian.AppendUint64([]byte{resumeFrameAck}, c.recvOffset), 0, false, false
+
+	case c.txOffset < c.sendOffsetLocked():
+		start := int(c.txOffset - c.sendBase)
+		end := min(len(c.sendBuf), start+resumeMaxFrame)
+		chunk := c.sendBuf[start:end]
+		frame = make([]byte, 5, 5+len(chunk))
+		frame[0] = resumeFrameData
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(chunk)))
+		return append(frame, chunk...), len(chunk), false, false
+
+	case c.localFin && !c.finSent:
+		return []byte{resumeFrameFin}, 0, true, false
+
+	default: // closing
+		return []byte{resumeFrameClose}, 0, false, true
+	}
+}
+
+func (c *resumableConn) sendOffsetLocked() uint64 {
+	return c.sendBase + uint64(len(c.sendBuf))
+}
+
+// ackLocked drops acknowledged bytes from the send buffer.
+func (c *resumableConn) ackLocked(off uint64) {
+	if off <= c.sendBase || off > c.sendOffsetLocked() {
+		return
+	}
+	c.sendBuf = c.sendBuf[off-c.sendBase:]
+	c.sendBase = off
+	if c.txOffset < off {
+		c.txOffset = off
+	}
+}
+
+// streamFailed detaches a broken stream. The client starts resuming; the
+// server waits up to the grace period for the client to come back.
+func (c *resumableConn) streamFailed(s network.Stream, gen uint64, cause error) {
+	c.mu.Lock()
+	if c.gen != gen || c.err != nil {
+		c.mu.Unlock()
+		return
+	}
+	flushed := c.txOffset == c.sendOffsetLocked() && (!c.localFin || c.finSent)
+	if c.remoteClosed || (c.closing && flushed) {
+		// Session was ending anyway; nothing to resume.
+		c.mu.Unlock()
+		c.fail(io.ErrClosedPipe)
+		return
+	}
+	c.stream = nil
+	c.gen++
+	detachedGen := c.gen
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	s.Reset()
+	slog.Info("session stream lost, resuming", "peer", c.peer.String()[:16]+"...", "error", truncateError(cause.Error()))
+
+	if c.client {
+		c.startResume()
+		return
+	}
+	time.AfterFunc(c.grace, func() {
+		c.mu.Lock()
+		expired := c.gen == detachedGen && c.stream == nil
+		c.mu.Unlock()
+		if expired {
+			c.fail(fmt.Errorf("session not resumed within %s", c.grace))
+		}
+	})
+}
+
+// fail ends the session with err and releases the stream.
+func (c *resumableConn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	s := c.stream
+	c.stream = nil
+	c.gen++
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	if s != nil {
+		s.Reset()
+	}
+	c.closeOnce.Do(func() {
+		if c.onClose != nil {
+			c.onClose(c)
+		}
+	})
+}
+
+// beginResume claims the right to swap streams. Returns false if another
+// resume or migration is already running or the session is over.
+func (c *resumableConn) beginResume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resuming || c.err != nil {
+		return false
+	}
+	c.resuming = true
+	return true
+}
+
+func (c *resumableConn) endResume() {
+	c.mu.Lock()
+	c.resuming = false
+	c.mu.Unlock()
+}
+
+// startResume redials in the background until the session is reattached,
+// the server rejects it, or the grace period runs out.
+func (c *resumableConn) startResume() {
+	if !c.beginResume() {
+		return
+	}
+	go func() {
+		defer c.endResume()
+
+		deadline := time.Now().Add(c.grace)
+		backoff := 250 * time.Millisecond
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), min(resumeHandshakeTimeout, time.Until(deadline)))
+			s, err := c.redial(ctx, true)
+			if err == nil {
+				if err = c.resumeOn(s); err != nil {
+					s.Reset()
+				}
+			}
+			cancel()
+
+			if err == nil {
+				c.recordResume("reconnect", "success")
+				return
+			}
+			if errors.Is(err, errResumeRejected) || time.Now().Add(backoff).After(deadline) {
+				c.recordResume("reconnect", "failure")
+				c.fail(fmt.Errorf("session could not be resumed: %w", err))
+				return
+			}
+			time.Sleep(backoff)
+			backoff = min(backoff*2, resumeMaxBackoff)
+
+			c.mu.Lock()
+			done := c.err != nil
+			c.mu.Unlock()
+			if done {
+				return
+			}
+		}
+	}()
+}
+
+// migrate moves a session running over a relay circuit onto a direct
+// connection. Called after PathTracker reports a path upgrade.
+func (c *resumableConn) migrate() {
+	c.mu.Lock()
+	relayed := c.stream != nil && c.stream.Conn().Stat().Limited
+	c.mu.Unlock()
+	if !relayed || !c.beginResume() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resumeHandshakeTimeout)
+	s, err := c.redial(ctx, false)
+	if err == nil && s.Conn().Stat().Limited {
+		s.Reset()
+		err = errors.New("no direct connection")
+	}
+	if err == nil {
+		if err = c.resumeOn(s); err != nil {
+			s.Reset()
+		}
+	}
+	cancel()
+	c.endResume()
+
+	if err != nil {
+		c.recordResume("upgrade", "failure")
+		slog.Warn("session migration failed", "peer", c.peer.String()[:16]+"...", "error", truncateError(err.Error()))
+		// resumeOn retires the old stream before the handshake; recover
+		// over whatever path is available.
+		c.mu.Lock()
+		detached := c.stream == nil && c.err == nil
+		c.mu.Unlock()
+		if detached {
+			c.startResume()
+		}
+		return
+	}
+	c.recordResume("upgrade", "success")
+}
+
+// resumeOn reattaches the session to a freshly opened stream (client side).
+// The caller holds the resuming claim.
+func (c *resumableConn) resumeOn(s network.Stream) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	// Retire the current stream first so frames still in flight on it are
+	// dropped; the server retransmits everything past recv.
+	old := c.stream
+	c.stream = nil
+	c.gen++
+	recv := c.recvOffset
+	c.mu.Unlock()
+	if old != nil {
+		old.Reset()
+	}
+
+	s.SetDeadline(time.Now().Add(resumeHandshakeTimeout))
+	if err := writeResumeHello(s, resumeHello{kind: resumeHelloResume, id: c.id, offset: recv}); err != nil {
+		return err
+	}
+	peerRecv, err := readResumeReply(s)
+	if err != nil {
+		return err
+	}
+	s.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	if err := c.reattachLocked(s, peerRecv); err != nil {
+		c.mu.Unlock()
+		c.fail(err)
+		return err
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	go c.readLoop(s, gen)
+	slog.Info("session resumed", "peer", c.peer.String()[:16]+"...", "path", connectionTag(s))
+	return nil
+}
+
+// attach reattaches the session to a stream on which the client sent a
+// resume hello with clientRecv (server side). The reply is written before
+// the stream becomes current so it precedes any retransmitted data.
+func (c *resumableConn) attach(s network.Stream, clientRecv uint64) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	if clientRecv < c.sendBase || clientRecv > c.sendOffsetLocked() {
+		c.mu.Unlock()
+		return fmt.Errorf("%w: resume offset %d outside [%d, %d]", errResumeProtocol, clientRecv, c.sendBase, c.sendOffsetLocked())
+	}
+	old := c.stream
+	if err := writeResumeReply(s, c.recvOffset, ""); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	if err := c.reattachLocked(s, clientRecv); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	gen := c.gen
+	c.mu.Unlock()
+
+	if old != nil {
+		old.Reset()
+	}
+	go c.readLoop(s, gen)
+	slog.Info("session resumed", "peer", c.peer.String()[:16]+"...", "path", connectionTag(s))
+	return nil
+}
+
+// reattachLocked makes s the current stream and rewinds transmission to
+// peerRecv, the number of bytes the peer has received.
+func (c *resumableConn) reattachLocked(s network.Stream, peerRecv uint64) error {
+	if peerRecv < c.sendBase || peerRecv > c.sendOffsetLocked() {
+		return fmt.Errorf("%w: peer offset %d outside [%d, %d]", errResumeProtocol, peerRecv, c.sendBase, c.sendOffsetLocked())
+	}
+	c.ackLocked(peerRecv)
+	c.txOffset = peerRecv
+	c.finSent = false
+	c.stream = s
+	c.gen++
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *resumableConn) recordResume(reason, result string) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.SessionResumesTotal.WithLabelValues(reason, result).Inc()
+}
+
+// resumeKey identifies a server-side session. Including the peer ID means
+// only the peer that opened a session can resume it.
+type resumeKey struct {
+	peer peer.ID
+	id   [16]byte
+}
+
+// handleResumeStream serves the resume protocol: it either opens a new
+// session to a local TCP service or reattaches an existing one.
+func (r *ServiceRegistry) handleResumeStream(s network.Stream) {
+	remotePeer := s.Conn().RemotePeer()
+	short := remotePeer.String()[:16] + "..."
+
+	s.SetDeadline(time.Now().Add(resumeHandshakeTimeout))
+	hello, err := readResumeHello(s)
+	if err != nil {
+		slog.Debug("bad session hello", "peer", short, "error", err)
+		s.Reset()
+		return
+	}
+	s.SetDeadline(time.Time{})
+
+	if hello.kind == resumeHelloResume {
+		r.resumeMu.Lock()
+		conn, ok := r.resumeSessions[resumeKey{peer: remotePeer, id: hello.id}]
+		r.resumeMu.Unlock()
+		if !ok {
+			writeResumeReply(s, 0, "unknown session")
+			s.Close()
+			return
+		}
+		if err := conn.attach(s, hello.offset); err != nil {
+			slog.Warn("session resume failed", "peer", short, "error", err)
+			s.Reset()
+		}
+		return
+	}
+
+	svc, ok := r.GetService(hello.service)
+	if !ok || svc.IsUDP() {
+		writeResumeReply(s, 0, "unknown service")
+		s.Close()
+		return
+	}
+	tag := connectionTag(s)
+	slog.Info("incoming connection", "path", tag, "service", svc.Name, "peer", short, "resumable", true)
+
+	localConn, until, refusal := r.admitStream(svc, remotePeer)
+	if refusal != "" {
+		writeResumeReply(s, 0, refusal)
+		s.Close()
+		return
+	}
+
+	key := resumeKey{peer: remotePeer, id: hello.id}
+	conn := newResumableConn(hello.id, remotePeer, false, r.resumeGrace, r.metrics)
+	conn.onClose = func(*resumableConn) {
+		r.resumeMu.Lock()
+		if r.resumeSessions[key] == conn {
+			delete(r.resumeSessions, key)
+		}
+		r.resumeMu.Unlock()
+	}
+
+	r.resumeMu.Lock()
+	_, dup := r.resumeSessions[key]
+	if !dup {
+		r.resumeSessions[key] = conn
+	}
+	r.resumeMu.Unlock()
+	if dup {
+		localConn.Close()
+		writeResumeReply(s, 0, "duplicate session")
+		s.Close()
+		return
+	}
+
+	if err := writeResumeReply(s, 0, ""); err != nil {
+		localConn.Close()
+		conn.fail(err)
+		s.Reset()
+		return
+	}
+	conn.start(s)
+
+	stopWatch := r.watchAccess(svc, remotePeer, until, func() { conn.fail(errAccessEnded) })
+	defer stopWatch()
+
+	InstrumentedBidirectionalProxy(r.bandwidth.Wrap(svc.Name, remotePeer, conn), &tcpHalfCloser{localConn}, svc.Name, r.metrics)
+
+	slog.Info("closed connection", "service", svc.Name, "peer", short)
+}
+
+// DialResumableService opens a resumable session to a remote peer's TCP
+// service. The session survives the loss of its stream (relay circuit
+// limits, a relay restart) and can move to a direct connection with
+// MigrateSessions. Peers that don't support the resume protocol get a
+// plain service stream instead.
+func (r *ServiceRegistry) DialResumableService(ctx context.Context, peerID peer.ID, serviceName string) (ServiceConn, error) {
+	// Connect first so identify has told us which protocols the peer speaks.
+	if err := r.host.Connect(network.WithAllowLimitedConn(ctx, ResumeProtocolID), peer.AddrInfo{ID: peerID}); err != nil {
+		return nil, fmt.Errorf("failed to connect to peer: %w", err)
+	}
+	if protos, _ := r.host.Peerstore().SupportsProtocols(peerID, ResumeProtocolID); len(protos) == 0 {
+		return r.DialService(ctx, peerID, serviceProtocolID(serviceName))
+	}
+
+	slog.Info("dialing service", "peer", peerID.String()[:16]+"...", "service", serviceName, "resumable", true)
+
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	redial := func(ctx context.Context, allowLimited bool) (network.Stream, error) {
+		if allowLimited {
+			ctx = network.WithAllowLimitedConn(ctx, ResumeProtocolID)
+		}
+		return r.host.NewStream(ctx, peerID, ResumeProtocolID)
+	}
+
+	s, err := redial(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	s.SetDeadline(time.Now().Add(resumeHandshakeTimeout))
+	if err := writeResumeHello(s, resumeHello{kind: resumeHelloOpen, id: id, service: serviceName}); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	if _, err := readResumeReply(s); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to open session: %w", err)
+	}
+	s.SetDeadline(time.Time{})
+
+	conn := newResumableConn(id, peerID, true, r.resumeGrace, r.metrics)
+	conn.redial = redial
+	conn.onClose = func(c *resumableConn) {
+		r.resumeMu.Lock()
+		delete(r.resumeClients, c)
+		r.resumeMu.Unlock()
+	}
+	r.resumeMu.Lock()
+	r.resumeClients[conn] = struct{}{}
+	r.resumeMu.Unlock()
+	conn.start(s)
+
+	slog.Info("connected to peer", "path", connectionTag(s), "peer", peerID.String()[:16]+"...", "service", serviceName, "resumable", true)
+	return conn, nil
+}
+
+// MigrateSessions moves this node's resumable sessions to peerID off relay
+// circuits and onto a direct connection, without interrupting them.
+// Returns the number of sessions considered; migrations run in the
+// background and sessions already on a direct path are left alone.
+func (r *ServiceRegistry) MigrateSessions(peerID peer.ID) int {
+	r.resumeMu.Lock()
+	var conns []*resumableConn
+	for c := range r.resumeClients {
+		if c.peer == peerID {
+			conns = append(conns, c)
+		}
+	}
+	r.resumeMu.Unlock()
+
+	for _, c := range conns {
+		go c.migrate()
+	}
+	return len(conns)
+}
@@ -0,0 +1,306 @@
+package p2pnet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// resumeTestPair returns a server registry exposing an echo service and a
+// client registry on a second host connected to it.
+func resumeTestPair(t *testing.T) (server, client *ServiceRegistry) {
+	t.Helper()
+
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { echo.Close() })
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.(*net.TCPConn).CloseWrite()
+			}()
+		}
+	}()
+
+	newHost := func() host.Host {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), libp2p.DisableRelay())
+		if err != nil {
+			t.Fatalf("create host: %v", err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	sh, ch := newHost(), newHost()
+
+	server = NewServiceRegistry(sh, nil)
+	if err := server.RegisterService(&Service{
+		Name:         "echo",
+		Protocol:     serviceProtocolID("echo"),
+		LocalAddress: echo.Addr().String(),
+		Enabled:      true,
+	}); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	client = NewServiceRegistry(ch, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Connect(ctx, peer.AddrInfo{ID: sh.ID(), Addrs: sh.Addrs()}); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	return server, client
+}
+
+func dialResumable(t *testing.T, server, client *ServiceRegistry) *resumableConn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := client.DialResumableService(ctx, server.host.ID(), "echo")
+	if err != nil {
+		t.Fatalf("DialResumableService: %v", err)
+	}
+	rc, ok := conn.(*resumableConn)
+	if !ok {
+		t.Fatalf("got %T, want *resumableConn", conn)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
+
+// resetStream kills the session's current stream as a relay cutoff would.
+// It returns the stream that was reset.
+func resetStream(t *testing.T, c *resumableConn) network.Stream {
+	t.Helper()
+	c.mu.Lock()
+	s := c.stream
+	c.mu.Unlock()
+	if s == nil {
+		t.Fatal("session has no stream")
+	}
+	s.Reset()
+	return s
+}
+
+func TestResumeHelloRoundTrip(t *testing.T) {
+	var id [16]byte
+	rand.Read(id[:])
+
+	for _, h := range []resumeHello{
+		{kind: resumeHelloOpen, id: id, service: "ssh"},
+		{kind: resumeHelloResume, id: id, offset: 1 << 40},
+	} {
+		var buf bytes.Buffer
+		if err := writeResumeHello(&buf, h); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		got, err := readResumeHello(&buf)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if got != h {
+			t.Errorf("round trip = %+v, want %+v", got, h)
+		}
+	}
+
+	if _, err := readResumeHello(bytes.NewReader(append([]byte{'X'}, id[:]...))); !errors.Is(err, errResumeProtocol) {
+		t.Errorf("unknown kind: err = %v, want errResumeProtocol", err)
+	}
+}
+
+func TestResumeReply(t *testing.T) {
+	var buf bytes.Buffer
+	writeResumeReply(&buf, 12345, "")
+	if off, err := readResumeReply(&buf); err != nil || off != 12345 {
+		t.Errorf("accept: off=%d err=%v, want 12345, nil", off, err)
+	}
+
+	buf.Reset()
+	writeResumeReply(&buf, 0, "unknown session")
+	if _, err := readResumeReply(&buf); !errors.Is(err, errResumeRejected) {
+		t.Errorf("reject: err = %v, want errResumeRejected", err)
+	}
+}
+
+func TestResumableSessionEcho(t *testing.T) {
+	server, client := resumeTestPair(t)
+	conn := dialResumable(t, server, client)
+
+	want := []byte("hello over a resumable session")
+	conn.Write(want)
+	conn.CloseWrite()
+
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("echo = %q, want %q", got, want)
+	}
+}
+
+func TestResumableSessionSurvivesStreamReset(t *testing.T) {
+	server, client := resumeTestPair(t)
+	m := NewMetrics("test", "go1.0")
+	client.metrics = m
+	conn := dialResumable(t, server, client)
+
+	// 2 MiB of random data, with the stream reset twice mid-transfer.
+	want := make([]byte, 2<<20)
+	rand.Read(want)
+
+	readDone := make(chan []byte)
+	go func() {
+		got, _ := io.ReadAll(conn)
+		readDone <- got
+	}()
+
+	chunk := len(want) / 4
+	for i := 0; i < 4; i++ {
+		if _, err := conn.Write(want[i*chunk : (i+1)*chunk]); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+		if i == 1 || i == 2 {
+			old := resetStream(t, conn)
+			waitFor(t, func() bool {
+				conn.mu.Lock()
+				defer conn.mu.Unlock()
+				return conn.stream != nil && conn.stream != old && !conn.resuming
+			})
+		}
+	}
+	conn.CloseWrite()
+
+	select {
+	case got := <-readDone:
+		if !bytes.Equal(got, want) {
+			t.Fatalf("echoed %d bytes, want %d identical bytes", len(got), len(want))
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("timed out waiting for echo")
+	}
+
+	if got := testutil.ToFloat64(m.SessionResumesTotal.WithLabelValues("reconnect", "success")); got != 2 {
+		t.Errorf("reconnect successes = %v, want 2", got)
+	}
+}
+
+func TestResumableSessionUnknownServiceRejected(t *testing.T) {
+	server, client := resumeTestPair(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.DialResumableService(ctx, server.host.ID(), "nope")
+	if !errors.Is(err, errResumeRejected) {
+		t.Errorf("err = %v, want errResumeRejected", err)
+	}
+}
+
+func TestResumableSessionDeniedByACL(t *testing.T) {
+	server, client := resumeTestPair(t)
+	svc, _ := server.GetService("echo")
+	svc.AllowedPeers = map[peer.ID]struct{}{server.host.ID(): {}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.DialResumableService(ctx, server.host.ID(), "echo")
+	if !errors.Is(err, errResumeRejected) {
+		t.Errorf("err = %v, want errResumeRejected", err)
+	}
+}
+
+func TestResumableSessionExpiresWithoutClient(t *testing.T) {
+	server, client := resumeTestPair(t)
+	server.resumeGrace = 200 * time.Millisecond
+	conn := dialResumable(t, server, client)
+
+	waitFor(t, func() bool {
+		server.resumeMu.Lock()
+		defer server.resumeMu.Unlock()
+		return len(server.resumeSessions) == 1
+	})
+
+	// Stop the client from coming back, then cut the stream.
+	conn.mu.Lock()
+	conn.err = errors.New("client gone")
+	conn.mu.Unlock()
+	resetStream(t, conn)
+
+	waitFor(t, func() bool {
+		server.resumeMu.Lock()
+		defer server.resumeMu.Unlock()
+		return len(server.resumeSessions) == 0
+	})
+}
+
+func TestMigrateSessionsSkipsDirectSessions(t *testing.T) {
+	server, client := resumeTestPair(t)
+	conn := dialResumable(t, server, client)
+
+	conn.mu.Lock()
+	gen := conn.gen
+	conn.mu.Unlock()
+
+	if n := client.MigrateSessions(server.host.ID()); n != 1 {
+		t.Fatalf("MigrateSessions = %d, want 1", n)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.gen != gen {
+		t.Error("direct session was re-attached; migration should be a no-op")
+	}
+}
+
+func TestResumableSessionMigrateRetransmits(t *testing.T) {
+	server, client := resumeTestPair(t)
+	conn := dialResumable(t, server, client)
+
+	conn.Write([]byte("before "))
+	buf := make([]byte, 7)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read before: %v", err)
+	}
+
+	// Swap streams the way a migration does (the test hosts have no relay,
+	// so drive resumeOn directly).
+	if !conn.beginResume() {
+		t.Fatal("beginResume refused")
+	}
+	s, err := conn.redial(context.Background(), false)
+	if err != nil {
+		t.Fatalf("redial: %v", err)
+	}
+	if err := conn.resumeOn(s); err != nil {
+		t.Fatalf("resumeOn: %v", err)
+	}
+	conn.endResume()
+
+	conn.Write([]byte("after"))
+	conn.CloseWrite()
+	rest, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(buf)+string(rest) != "before after" {
+		t.Errorf("echo = %q, want %q", string(buf)+string(rest), "before after")
+	}
+}
@@ -0,0 +1,446 @@
+package p2pnet
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Reverse tunnel protocols. The requester opens a control stream and keeps
+// it open for the life of the tunnel; the listening peer opens one data
+// stream back to the requester for each connection it accepts.
+const (
+	ReverseTunnelProtocol     = "/peerup/reverse-tunnel/1.0.0"
+	ReverseTunnelDataProtocol = "/peerup/reverse-tunnel/data/1.0.0"
+)
+
+// Reverse tunnel wire limits.
+const (
+	maxReverseTunnelMessage  = 4 << 10
+	maxReverseTunnelID       = 64
+	reverseTunnelTimeout     = 15 * time.Second
+	reverseTunnelDialTimeout = 10 * time.Second
+	maxReverseTunnelsPerPeer = 8 // incoming tunnels one peer may hold here
+)
+
+// reverseTunnelMetricsLabel is the service label for tunnel traffic in the
+// proxy metrics.
+const reverseTunnelMetricsLabel = "reverse-tunnel"
+
+type reverseTunnelRequest struct {
+	ID     string `json:"id"`
+	Listen string `json:"listen"`
+}
+
+type reverseTunnelResponse struct {
+	Listen string `json:"listen,omitempty"` // bound address on success
+	Error  string `json:"error,omitempty"`
+}
+
+type reverseTunnelDataHeader struct {
+	ID string `json:"id"`
+}
+
+// ReverseTunnel is one tunnel as seen from either end. On the requesting
+// side, connections accepted on Listen at Peer are forwarded to LocalAddr.
+// On the listening side (Incoming), LocalAddr is empty.
+type ReverseTunnel struct {
+	ID        string
+	Peer      peer.ID // the other end
+	Incoming  bool    // true if this node listens on behalf of Peer
+	Listen    string  // listen address on the listening side
+	LocalAddr string  // requesting side: where connections are forwarded
+	Created   time.Time
+
+	stream    network.Stream // control stream; closing it ends the tunnel
+	listener  net.Listener   // incoming only
+	requested string         // incoming only: listen address as requested, for Recheck
+}
+
+// ReverseTunnels implements reverse tunnels, the equivalent of ssh -R: a
+// peer asks this node to listen on a local address and forward every
+// accepted connection back to it over libp2p. Which peers may open
+// listeners, and where, is decided by Allowed.
+type ReverseTunnels struct {
+	host    host.Host
+	allowed func(p peer.ID, listen string) bool // nil: no incoming tunnels
+	events  *EventFeed                          // nil-safe
+	metrics *Metrics                            // nil-safe
+
+	mu       sync.Mutex
+	outgoing map[string]*ReverseTunnel // by ID
+	incoming map[string]*ReverseTunnel // by peer + "/" + ID
+}
+
+// NewReverseTunnels registers the reverse tunnel handlers on h. allowed
+// decides whether a peer may listen on an address here; nil refuses all
+// incoming requests. Events and metrics are optional (nil-safe).
+func NewReverseTunnels(h host.Host, allowed func(peer.ID, string) bool, events *EventFeed, m *Metrics) *ReverseTunnels {
+	t := &ReverseTunnels{
+		host:     h,
+		allowed:  allowed,
+		events:   events,
+		metrics:  m,
+		outgoing: make(map[string]*ReverseTunnel),
+		incoming: make(map[string]*ReverseTunnel),
+	}
+	h.SetStreamHandler(protocol.ID(ReverseTunnelProtocol), t.handleControl)
+	h.SetStreamHandler(protocol.ID(ReverseTunnelDataProtocol), t.handleData)
+	return t
+}
+
+// Open asks p to listen on listen and forward accepted connections to
+// localAddr on this node. The tunnel lasts until Close or until either
+// side goes away.
+func (t *ReverseTunnels) Open(ctx context.Context, p peer.ID, listen, localAddr string) (*ReverseTunnel, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(idBytes)
+
+	ctx, cancel := context.WithTimeout(ctx, reverseTunnelTimeout)
+	defer cancel()
+	s, err := t.host.NewStream(network.WithAllowLimitedConn(ctx, ReverseTunnelProtocol), p, ReverseTunnelProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	s.SetDeadline(time.Now().Add(reverseTunnelTimeout))
+
+	if err := json.NewEncoder(s).Encode(reverseTunnelRequest{ID: id, Listen: listen}); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to send tunnel request: %w", err)
+	}
+	var resp reverseTunnelResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxReverseTunnelMessage)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to read tunnel response: %w", err)
+	}
+	if resp.Error != "" {
+		s.Reset()
+		return nil, fmt.Errorf("%w: %s", ErrReverseTunnelRejected, resp.Error)
+	}
+	s.SetDeadline(time.Time{})
+
+	tun := &ReverseTunnel{
+		ID:        id,
+		Peer:      p,
+		Listen:    resp.Listen,
+		LocalAddr: localAddr,
+		Created:   time.Now(),
+		stream:    s,
+	}
+	t.mu.Lock()
+	t.outgoing[id] = tun
+	t.mu.Unlock()
+	t.publish(EventTunnelOpened, tun)
+	slog.Info("reverse tunnel opened", "id", id, "peer", p.String()[:16]+"...", "listen", resp.Listen, "local", localAddr)
+
+	go t.watch(tun)
+	return tun, nil
+}
+
+// Close tears down the tunnel with the given ID, from either side.
+func (t *ReverseTunnels) Close(id string) error {
+	t.mu.Lock()
+	tun, ok := t.outgoing[id]
+	if !ok {
+		for _, in := range t.incoming {
+			if in.ID == id {
+				tun, ok = in, true
+				break
+			}
+		}
+	}
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTunnelNotFound, id)
+	}
+	t.remove(tun)
+	return nil
+}
+
+// CloseAll tears down every tunnel.
+func (t *ReverseTunnels) CloseAll() {
+	for _, tun := range t.List() {
+		t.remove(tun)
+	}
+}
+
+// Recheck closes incoming tunnels whose peer may no longer listen on the
+// requested address, e.g. after authorized_keys was reloaded. Nil-safe.
+func (t *ReverseTunnels) Recheck() {
+	if t == nil {
+		return
+	}
+	for _, tun := range t.List() {
+		if !tun.Incoming || (t.allowed != nil && t.allowed(tun.Peer, tun.requested)) {
+			continue
+		}
+		slog.Info("reverse tunnel no longer allowed", "id", tun.ID, "peer", tun.Peer.String()[:16]+"...", "listen", tun.Listen)
+		t.remove(tun)
+	}
+}
+
+func (t *ReverseTunnels) countIncomingLocked(p peer.ID) int {
+	n := 0
+	for _, tun := range t.incoming {
+		if tun.Peer == p {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns all tunnels, oldest first.
+func (t *ReverseTunnels) List() []*ReverseTunnel {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]*ReverseTunnel, 0, len(t.outgoing)+len(t.incoming))
+	for _, tun := range t.outgoing {
+		out = append(out, tun)
+	}
+	for _, tun := range t.incoming {
+		out = append(out, tun)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out
+}
+
+// handleControl serves a tunnel request: check the policy, listen, reply
+// with the bound address and keep the listener open until the requester
+// closes the control stream.
+func (t *ReverseTunnels) handleControl(s network.Stream) {
+	remotePeer := s.Conn().RemotePeer()
+	short := remotePeer.String()[:16] + "..."
+	s.SetDeadline(time.Now().Add(reverseTunnelTimeout))
+
+	var req reverseTunnelRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxReverseTunnelMessage)).Decode(&req); err != nil {
+		s.Reset()
+		return
+	}
+	reject := func(msg string) {
+		slog.Warn("reverse tunnel refused", "peer", short, "listen", req.Listen, "reason", msg)
+		json.NewEncoder(s).Encode(reverseTunnelResponse{Error: msg})
+		s.Close()
+	}
+	if req.ID == "" || len(req.ID) > maxReverseTunnelID {
+		reject("invalid tunnel id")
+		return
+	}
+	if t.allowed == nil || !t.allowed(remotePeer, req.Listen) {
+		reject(fmt.Sprintf("not allowed to listen on %s", req.Listen))
+		return
+	}
+	ln, err := net.Listen("tcp", req.Listen)
+	if err != nil {
+		reject(fmt.Sprintf("listen failed: %v", err))
+		return
+	}
+	tun := &ReverseTunnel{
+		ID:        req.ID,
+		Peer:      remotePeer,
+		Incoming:  true,
+		Listen:    ln.Addr().String(),
+		Created:   time.Now(),
+		stream:    s,
+		listener:  ln,
+		requested: req.Listen,
+	}
+
+	// Check and register under one lock so concurrent requests cannot
+	// exceed the per-peer cap.
+	key := remotePeer.String() + "/" + req.ID
+	refusal := ""
+	t.mu.Lock()
+	switch {
+	case t.incoming[key] != nil:
+		refusal = "duplicate tunnel id"
+	case t.countIncomingLocked(remotePeer) >= maxReverseTunnelsPerPeer:
+		refusal = fmt.Sprintf("too many tunnels (max %d per peer)", maxReverseTunnelsPerPeer)
+	default:
+		t.incoming[key] = tun
+	}
+	t.mu.Unlock()
+	if refusal != "" {
+		ln.Close()
+		reject(refusal)
+		return
+	}
+
+	if err := json.NewEncoder(s).Encode(reverseTunnelResponse{Listen: tun.Listen}); err != nil {
+		t.mu.Lock()
+		delete(t.incoming, key)
+		t.mu.Unlock()
+		ln.Close()
+		s.Reset()
+		return
+	}
+	s.SetDeadline(time.Time{})
+	t.publish(EventTunnelOpened, tun)
+	slog.Info("reverse tunnel listening", "id", req.ID, "peer", short, "listen", tun.Listen)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go t.forward(tun, conn)
+		}
+	}()
+	t.watch(tun)
+}
+
+// forward carries one accepted connection back to the requester.
+func (t *ReverseTunnels) forward(tun *ReverseTunnel, conn net.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), reverseTunnelTimeout)
+	defer cancel()
+	s, err := t.host.NewStream(network.WithAllowLimitedConn(ctx, ReverseTunnelDataProtocol), tun.Peer, ReverseTunnelDataProtocol)
+	if err != nil {
+		slog.Warn("reverse tunnel: stream to requester failed", "id", tun.ID, "err", err)
+		conn.Close()
+		return
+	}
+	if err := json.NewEncoder(s).Encode(reverseTunnelDataHeader{ID: tun.ID}); err != nil {
+		s.Reset()
+		conn.Close()
+		return
+	}
+	InstrumentedBidirectionalProxy(&serviceStream{stream: s}, &tcpHalfCloser{conn}, reverseTunnelMetricsLabel, t.metrics)
+}
+
+// handleData accepts a forwarded connection for one of our tunnels and
+// connects it to the tunnel's local address. Only the peer the tunnel was
+// opened with may use it.
+func (t *ReverseTunnels) handleData(s network.Stream) {
+	s.SetReadDeadline(time.Now().Add(reverseTunnelTimeout))
+	line, err := readLine(s, maxReverseTunnelMessage)
+	if err != nil {
+		s.Reset()
+		return
+	}
+	var hdr reverseTunnelDataHeader
+	if err := json.Unmarshal(line, &hdr); err != nil {
+		s.Reset()
+		return
+	}
+	t.mu.Lock()
+	tun, ok := t.outgoing[hdr.ID]
+	t.mu.Unlock()
+	if !ok || tun.Peer != s.Conn().RemotePeer() {
+		s.Reset()
+		return
+	}
+	s.SetReadDeadline(time.Time{})
+
+	conn, err := DialLocal(tun.LocalAddr, reverseTunnelDialTimeout)
+	if err != nil {
+		slog.Warn("reverse tunnel: local dial failed", "id", tun.ID, "local", tun.LocalAddr, "err", err)
+		s.Reset()
+		return
+	}
+	InstrumentedBidirectionalProxy(&serviceStream{stream: s}, &tcpHalfCloser{conn}, reverseTunnelMetricsLabel, t.metrics)
+}
+
+// watch blocks until the control stream ends, then removes the tunnel.
+// Nothing is sent on the control stream after the handshake.
+func (t *ReverseTunnels) watch(tun *ReverseTunnel) {
+	io.Copy(io.Discard, tun.stream)
+	t.remove(tun)
+}
+
+// remove forgets tun and releases its stream and listener. Safe to call
+// more than once.
+func (t *ReverseTunnels) remove(tun *ReverseTunnel) {
+	t.mu.Lock()
+	var found bool
+	if tun.Incoming {
+		key := tun.Peer.String() + "/" + tun.ID
+		if t.incoming[key] == tun {
+			delete(t.incoming, key)
+			found = true
+		}
+	} else if t.outgoing[tun.ID] == tun {
+		delete(t.outgoing, tun.ID)
+		found = true
+	}
+	t.mu.Unlock()
+	if !found {
+		return
+	}
+
+	tun.stream.Reset()
+	if tun.listener != nil {
+		tun.listener.Close()
+	}
+	t.publish(EventTunnelClosed, tun)
+	slog.Info("reverse tunnel closed", "id", tun.ID, "peer", tun.Peer.String()[:16]+"...")
+}
+
+func (t *ReverseTunnels) publish(typ string, tun *ReverseTunnel) {
+	data := map[string]any{"id": tun.ID, "listen": tun.Listen, "incoming": tun.Incoming}
+	if tun.LocalAddr != "" {
+		data["local"] = tun.LocalAddr
+	}
+	t.events.Publish(typ, tun.Peer.String(), data)
+}
+
+// MatchListenRule reports whether a reverse tunnel may listen on listen
+// under rule. Rules are "host:port" or "host:*"; the wildcard allows any
+// unprivileged port (1024-65535). Hosts must be IP addresses and are
+// compared as such.
+func MatchListenRule(rule, listen string) bool {
+	rh, rp, err := net.SplitHostPort(rule)
+	if err != nil {
+		return false
+	}
+	lh, lp, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	rip, lip := net.ParseIP(rh), net.ParseIP(lh)
+	if rip == nil || lip == nil || !rip.Equal(lip) {
+		return false
+	}
+	port, err := strconv.Atoi(lp)
+	if err != nil || port < 1 || port > 65535 {
+		return false
+	}
+	if rp == "*" {
+		return port >= 1024
+	}
+	return rp == lp
+}
+
+// readLine reads up to and including the first newline, one byte at a
+// time so nothing after the line is consumed.
+func readLine(r io.Reader, max int) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < max {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		if b[0] == '\n' {
+			return line, nil
+		}
+		line = append(line, b[0])
+	}
+	return nil, fmt.Errorf("line longer than %d bytes", max)
+}
@@ -0,0 +1,185 @@
+package p2pnet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestMatchListenRule(t *testing.T) {
+	tests := []struct {
+		rule, listen string
+		want         bool
+	}{
+		{"0.0.0.0:8080", "0.0.0.0:8080", true},
+		{"0.0.0.0:8080", "0.0.0.0:8081", false},
+		{"0.0.0.0:8080", "127.0.0.1:8080", false},
+		{"127.0.0.1:*", "127.0.0.1:3000", true},
+		{"127.0.0.1:*", "127.0.0.1:22", false},
+		{"127.0.0.1:*", "127.0.0.1:0", false},
+		{"[::]:8080", "[::]:8080", true},
+		{"[::]:8080", "[0::0]:8080", true},
+		{"0.0.0.0:8080", ":8080", false},
+		{"0.0.0.0:8080", "example.com:8080", false},
+		{"bad", "0.0.0.0:8080", false},
+	}
+	for _, tt := range tests {
+		if got := MatchListenRule(tt.rule, tt.listen); got != tt.want {
+			t.Errorf("MatchListenRule(%q, %q) = %v, want %v", tt.rule, tt.listen, got, tt.want)
+		}
+	}
+}
+
+func TestReverseTunnel(t *testing.T) {
+	newHost := func() host.Host {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	server, laptop := newHost(), newHost()
+	if err := laptop.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The laptop's "dev server".
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		for {
+			c, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(c, c); c.Close() }()
+		}
+	}()
+
+	onServer := NewReverseTunnels(server, func(p peer.ID, listen string) bool {
+		return p == laptop.ID() && listen == "127.0.0.1:0"
+	}, nil, nil)
+	onLaptop := NewReverseTunnels(laptop, nil, nil, nil)
+	t.Cleanup(onServer.CloseAll)
+	t.Cleanup(onLaptop.CloseAll)
+
+	if _, err := onLaptop.Open(context.Background(), server.ID(), "0.0.0.0:8080", echo.Addr().String()); !errors.Is(err, ErrReverseTunnelRejected) {
+		t.Fatalf("Open() on a disallowed address error = %v, want ErrReverseTunnelRejected", err)
+	}
+	if _, err := onServer.Open(context.Background(), laptop.ID(), "127.0.0.1:0", echo.Addr().String()); !errors.Is(err, ErrReverseTunnelRejected) {
+		t.Fatalf("Open() to a node with no policy error = %v, want ErrReverseTunnelRejected", err)
+	}
+
+	tun, err := onLaptop.Open(context.Background(), server.ID(), "127.0.0.1:0", echo.Addr().String())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if len(onServer.List()) != 1 || !onServer.List()[0].Incoming || onServer.List()[0].Listen != tun.Listen {
+		t.Errorf("server tunnels = %+v", onServer.List())
+	}
+
+	// A connection to the server's listener reaches the laptop's local port.
+	c, err := net.Dial("tcp", tun.Listen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	c.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("echo through tunnel = %q, %v", buf, err)
+	}
+	c.Close()
+
+	// Closing on the laptop tears down the server's listener.
+	if err := onLaptop.Close(tun.ID); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(onServer.List()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("server kept the tunnel after the requester closed it")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if c, err := net.Dial("tcp", tun.Listen); err == nil {
+		c.Close()
+		t.Error("server listener still open after close")
+	}
+	if err := onLaptop.Close(tun.ID); !errors.Is(err, ErrTunnelNotFound) {
+		t.Errorf("second Close() error = %v, want ErrTunnelNotFound", err)
+	}
+}
+
+func TestReverseTunnelCapAndRecheck(t *testing.T) {
+	newHost := func() host.Host {
+		h, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	server, laptop := newHost(), newHost()
+	if err := laptop.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	allow := true
+	onServer := NewReverseTunnels(server, func(p peer.ID, listen string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return allow && p == laptop.ID() && listen == "127.0.0.1:0"
+	}, nil, nil)
+	onLaptop := NewReverseTunnels(laptop, nil, nil, nil)
+	t.Cleanup(onServer.CloseAll)
+	t.Cleanup(onLaptop.CloseAll)
+
+	for i := 0; i < maxReverseTunnelsPerPeer; i++ {
+		if _, err := onLaptop.Open(context.Background(), server.ID(), "127.0.0.1:0", "127.0.0.1:1"); err != nil {
+			t.Fatalf("Open() #%d error = %v", i+1, err)
+		}
+	}
+	if _, err := onLaptop.Open(context.Background(), server.ID(), "127.0.0.1:0", "127.0.0.1:1"); !errors.Is(err, ErrReverseTunnelRejected) {
+		t.Fatalf("Open() past the per-peer cap error = %v, want ErrReverseTunnelRejected", err)
+	}
+	if n := len(onServer.List()); n != maxReverseTunnelsPerPeer {
+		t.Fatalf("server tunnels = %d, want %d", n, maxReverseTunnelsPerPeer)
+	}
+
+	// Still allowed: Recheck keeps everything.
+	onServer.Recheck()
+	if n := len(onServer.List()); n != maxReverseTunnelsPerPeer {
+		t.Fatalf("server tunnels after Recheck = %d, want %d", n, maxReverseTunnelsPerPeer)
+	}
+
+	// Access withdrawn: Recheck closes the peer's tunnels.
+	mu.Lock()
+	allow = false
+	mu.Unlock()
+	onServer.Recheck()
+	if n := len(onServer.List()); n != 0 {
+		t.Errorf("server tunnels after access withdrawn = %d, want 0", n)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(onLaptop.List()) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("laptop kept its tunnels after the server closed them")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	(*ReverseTunnels)(nil).Recheck()
+}
@@ -0,0 +1,200 @@
+package p2pnet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// KeyRotationProtocol carries signed key rotation statements from a
+// rotating node to its authorized peers.
+const KeyRotationProtocol = "/peerup/key-rotation/1.0.0"
+
+// Key rotation statement limits.
+const (
+	MaxKeyRotationAge    = 24 * time.Hour  // statements older than this are rejected
+	maxKeyRotationSkew   = 5 * time.Minute // tolerated clock skew for future timestamps
+	maxKeyRotationSize   = 4096            // bytes on the wire
+	keyRotationTimeout   = 15 * time.Second
+	keyRotationSignedTag = "peerup-key-rotation/1"
+)
+
+// KeyRotation is a continuity statement "OldPeerID is now NewPeerID".
+// OldSig proves the statement comes from the old identity; NewSig proves
+// the rotating node holds the new key, so nobody can redirect their
+// identity to someone else's peer ID.
+type KeyRotation struct {
+	OldPeerID string `json:"old_peer_id"`
+	NewPeerID string `json:"new_peer_id"`
+	Timestamp int64  `json:"timestamp"` // unix seconds
+	OldSig    []byte `json:"old_sig"`
+	NewSig    []byte `json:"new_sig"`
+}
+
+// KeyRotationResult is the outcome of announcing a rotation to one peer.
+type KeyRotationResult struct {
+	Peer peer.ID
+	Err  error
+}
+
+// NewKeyRotation builds and signs a rotation statement from oldKey to newKey.
+func NewKeyRotation(oldKey, newKey crypto.PrivKey, now time.Time) (*KeyRotation, error) {
+	oldID, err := peer.IDFromPrivateKey(oldKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive old peer ID: %w", err)
+	}
+	newID, err := peer.IDFromPrivateKey(newKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive new peer ID: %w", err)
+	}
+	if oldID == newID {
+		return nil, fmt.Errorf("%w: old and new keys are the same", ErrInvalidKeyRotation)
+	}
+
+	kr := &KeyRotation{
+		OldPeerID: oldID.String(),
+		NewPeerID: newID.String(),
+		Timestamp: now.Unix(),
+	}
+	msg := kr.signedBytes()
+	if kr.OldSig, err = oldKey.Sign(msg); err != nil {
+		return nil, fmt.Errorf("failed to sign with old key: %w", err)
+	}
+	if kr.NewSig, err = newKey.Sign(msg); err != nil {
+		return nil, fmt.Errorf("failed to sign with new key: %w", err)
+	}
+	return kr, nil
+}
+
+// signedBytes is the message both keys sign.
+func (k *KeyRotation) signedBytes() []byte {
+	return fmt.Appendf(nil, "%s\nold=%s\nnew=%s\nts=%d", keyRotationSignedTag, k.OldPeerID, k.NewPeerID, k.Timestamp)
+}
+
+// Verify checks both signatures and the timestamp window, returning the
+// decoded old and new peer IDs.
+func (k *KeyRotation) Verify(now time.Time) (oldID, newID peer.ID, err error) {
+	if oldID, err = peer.Decode(k.OldPeerID); err != nil {
+		return "", "", fmt.Errorf("%w: bad old peer ID: %w", ErrInvalidKeyRotation, err)
+	}
+	if newID, err = peer.Decode(k.NewPeerID); err != nil {
+		return "", "", fmt.Errorf("%w: bad new peer ID: %w", ErrInvalidKeyRotation, err)
+	}
+	if oldID == newID {
+		return "", "", fmt.Errorf("%w: old and new peer IDs are the same", ErrInvalidKeyRotation)
+	}
+
+	ts := time.Unix(k.Timestamp, 0)
+	if ts.After(now.Add(maxKeyRotationSkew)) {
+		return "", "", fmt.Errorf("%w: timestamp in the future", ErrInvalidKeyRotation)
+	}
+	if now.Sub(ts) > MaxKeyRotationAge {
+		return "", "", fmt.Errorf("%w: statement expired", ErrInvalidKeyRotation)
+	}
+
+	msg := k.signedBytes()
+	for _, c := range []struct {
+		id   peer.ID
+		sig  []byte
+		name string
+	}{{oldID, k.OldSig, "old"}, {newID, k.NewSig, "new"}} {
+		pub, err := c.id.ExtractPublicKey()
+		if err != nil {
+			return "", "", fmt.Errorf("%w: cannot extract %s public key: %w", ErrInvalidKeyRotation, c.name, err)
+		}
+		ok, err := pub.Verify(msg, c.sig)
+		if err != nil || !ok {
+			return "", "", fmt.Errorf("%w: bad %s key signature", ErrInvalidKeyRotation, c.name)
+		}
+	}
+	return oldID, newID, nil
+}
+
+// ReadKeyRotation reads one JSON statement from a key rotation stream.
+func ReadKeyRotation(r io.Reader) (*KeyRotation, error) {
+	line, err := bufio.NewReader(io.LimitReader(r, maxKeyRotationSize)).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("failed to read key rotation: %w", err)
+	}
+	var kr KeyRotation
+	if err := json.Unmarshal(line, &kr); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKeyRotation, err)
+	}
+	return &kr, nil
+}
+
+// WriteKeyRotationReply answers a key rotation stream: "ok" if err is nil,
+// otherwise "error: <reason>".
+func WriteKeyRotationReply(w io.Writer, err error) error {
+	reply := "ok\n"
+	if err != nil {
+		reply = "error: " + strings.ReplaceAll(err.Error(), "\n", " ") + "\n"
+	}
+	_, werr := io.WriteString(w, reply)
+	return werr
+}
+
+// AnnounceKeyRotation sends kr to each target over KeyRotationProtocol in
+// parallel and returns one result per target, in order. It uses the
+// existing connections, so it must run while the old identity is live.
+func (n *Network) AnnounceKeyRotation(ctx context.Context, kr *KeyRotation, targets []peer.ID) []KeyRotationResult {
+	data, err := json.Marshal(kr)
+	if err != nil {
+		results := make([]KeyRotationResult, len(targets))
+		for i, p := range targets {
+			results[i] = KeyRotationResult{Peer: p, Err: err}
+		}
+		return results
+	}
+	data = append(data, '\n')
+
+	results := make([]KeyRotationResult, len(targets))
+	var wg sync.WaitGroup
+	for i, p := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = KeyRotationResult{Peer: p, Err: n.sendKeyRotation(ctx, p, data)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (n *Network) sendKeyRotation(ctx context.Context, p peer.ID, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, keyRotationTimeout)
+	defer cancel()
+
+	s, err := n.host.NewStream(ctx, p, KeyRotationProtocol)
+	if err != nil {
+		return fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+
+	if _, err := s.Write(data); err != nil {
+		s.Reset()
+		return fmt.Errorf("failed to send statement: %w", err)
+	}
+	s.CloseWrite()
+
+	reply, err := bufio.NewReader(io.LimitReader(s, 512)).ReadString('\n')
+	if err != nil && reply == "" {
+		return fmt.Errorf("no reply: %w", err)
+	}
+	reply = strings.TrimSpace(reply)
+	if reply != "ok" {
+		return fmt.Errorf("%w: %s", ErrKeyRotationRejected, strings.TrimPrefix(reply, "error: "))
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package p2pnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func genRotationKeys(t *testing.T) (crypto.PrivKey, crypto.PrivKey) {
+	t.Helper()
+	oldKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oldKey, newKey
+}
+
+func TestKeyRotationVerify(t *testing.T) {
+	oldKey, newKey := genRotationKeys(t)
+	now := time.Now()
+	kr, err := NewKeyRotation(oldKey, newKey, now)
+	if err != nil {
+		t.Fatalf("NewKeyRotation() error = %v", err)
+	}
+
+	oldID, newID, err := kr.Verify(now)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if want, _ := peer.IDFromPrivateKey(oldKey); oldID != want {
+		t.Errorf("old ID = %s, want %s", oldID, want)
+	}
+	if want, _ := peer.IDFromPrivateKey(newKey); newID != want {
+		t.Errorf("new ID = %s, want %s", newID, want)
+	}
+
+	_, otherKey := genRotationKeys(t)
+	otherID, _ := peer.IDFromPrivateKey(otherKey)
+
+	tests := []struct {
+		name   string
+		mutate func(k *KeyRotation)
+		at     time.Time
+	}{
+		{"redirected new ID", func(k *KeyRotation) { k.NewPeerID = otherID.String() }, now},
+		{"swapped signatures", func(k *KeyRotation) { k.OldSig, k.NewSig = k.NewSig, k.OldSig }, now},
+		{"changed timestamp", func(k *KeyRotation) { k.Timestamp++ }, now},
+		{"expired", func(k *KeyRotation) {}, now.Add(MaxKeyRotationAge + time.Minute)},
+		{"future", func(k *KeyRotation) {}, now.Add(-time.Hour)},
+		{"bad peer ID", func(k *KeyRotation) { k.OldPeerID = "not-a-peer" }, now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := *kr
+			tt.mutate(&k)
+			if _, _, err := k.Verify(tt.at); !errors.Is(err, ErrInvalidKeyRotation) {
+				t.Errorf("Verify() err = %v, want ErrInvalidKeyRotation", err)
+			}
+		})
+	}
+
+	if _, err := NewKeyRotation(oldKey, oldKey, now); !errors.Is(err, ErrInvalidKeyRotation) {
+		t.Errorf("same key: err = %v, want ErrInvalidKeyRotation", err)
+	}
+}
+
+func TestKeyRotationWire(t *testing.T) {
+	oldKey, newKey := genRotationKeys(t)
+	kr, _ := NewKeyRotation(oldKey, newKey, time.Now())
+
+	data, err := json.Marshal(kr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(append(data, '\n'))
+	got, err := ReadKeyRotation(buf)
+	if err != nil {
+		t.Fatalf("ReadKeyRotation() error = %v", err)
+	}
+	if _, _, err := got.Verify(time.Now()); err != nil {
+		t.Errorf("round-tripped statement does not verify: %v", err)
+	}
+
+	if _, err := ReadKeyRotation(bytes.NewBufferString("{garbage\n")); !errors.Is(err, ErrInvalidKeyRotation) {
+		t.Errorf("garbage: err = %v, want ErrInvalidKeyRotation", err)
+	}
+
+	buf.Reset()
+	WriteKeyRotationReply(buf, errors.New("nope\nreally"))
+	if buf.String() != "error: nope really\n" {
+		t.Errorf("reply = %q", buf.String())
+	}
+}
+
+func TestAnnounceKeyRotation(t *testing.T) {
+	a := newListeningNetwork(t)
+	b := newListeningNetwork(t)
+	c := newListeningNetwork(t)
+	connectNetworks(t, a, b)
+	connectNetworks(t, a, c)
+
+	received := make(chan *KeyRotation, 1)
+	b.Host().SetStreamHandler(KeyRotationProtocol, func(s network.Stream) {
+		defer s.Close()
+		kr, err := ReadKeyRotation(s)
+		if err == nil {
+			received <- kr
+		}
+		WriteKeyRotationReply(s, err)
+	})
+	c.Host().SetStreamHandler(KeyRotationProtocol, func(s network.Stream) {
+		defer s.Close()
+		ReadKeyRotation(s)
+		WriteKeyRotationReply(s, errors.New("not authorized"))
+	})
+
+	oldKey := a.Host().Peerstore().PrivKey(a.PeerID())
+	_, newKey := genRotationKeys(t)
+	kr, err := NewKeyRotation(oldKey, newKey, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	results := a.AnnounceKeyRotation(ctx, kr, []peer.ID{b.PeerID(), c.PeerID()})
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if results[0].Peer != b.PeerID() || results[0].Err != nil {
+		t.Errorf("b result = %+v, want success", results[0])
+	}
+	if results[1].Peer != c.PeerID() || !errors.Is(results[1].Err, ErrKeyRotationRejected) {
+		t.Errorf("c result = %+v, want ErrKeyRotationRejected", results[1])
+	}
+
+	select {
+	case got := <-received:
+		if got.NewPeerID != kr.NewPeerID {
+			t.Errorf("received new ID %s, want %s", got.NewPeerID, kr.NewPeerID)
+		}
+	default:
+		t.Error("b did not receive the statement")
+	}
+}
@@ -32,15 +32,27 @@ func ValidateServiceName(name string) error {
 	return validate.ServiceName(name)
 }
 
+// Service transports. TCP is the default when Service.Transport is empty.
+const (
+	ServiceTransportTCP = "tcp"
+	ServiceTransportUDP = "udp"
+)
+
 // Service represents a service that can be exposed over the P2P network
 type Service struct {
 	Name         string              // Service name (e.g., "ssh", "http")
 	Protocol     string              // libp2p protocol ID (e.g., "/peerup/ssh/1.0.0")
-	LocalAddress string              // Local TCP address (e.g., "localhost:22")
+	LocalAddress string              // Local address (e.g., "localhost:22" or "unix:/var/run/docker.sock")
+	Transport    string              // "tcp" (default) or "udp"
 	Enabled      bool                // Whether this service is enabled
 	AllowedPeers map[peer.ID]struct{} // Per-service ACL (nil = all authorized peers allowed)
 }
 
+// IsUDP reports whether the service forwards UDP datagrams instead of a TCP stream.
+func (s *Service) IsUDP() bool {
+	return s.Transport == ServiceTransportUDP
+}
+
 // ServiceConn represents a connection to a remote service
 type ServiceConn interface {
 	io.ReadWriteCloser
@@ -53,16 +65,61 @@ type ServiceRegistry struct {
 	services map[string]*Service
 	metrics  *Metrics // nil when metrics disabled
 	mu       sync.RWMutex
+
+	bandwidth    *BandwidthManager        // nil = no rate limits or quotas
+	audit        *AuditLogger             // nil-safe
+	events       *EventFeed               // nil-safe
+	accessRules  map[string][]*AccessRule // by service name (see access.go)
+	allowedRoles map[string][]string      // by service name (see access.go)
+	roles        RoleChecker              // nil = roles never match
+	descriptions map[string]string        // by service name (see servicequery.go)
+
+	// Resumable sessions (see resume.go)
+	resumeGrace    time.Duration
+	resumeMu       sync.Mutex
+	resumeSessions map[resumeKey]*resumableConn // server side, by (peer, session ID)
+	resumeClients  map[*resumableConn]struct{}  // client side
+
+	// Warm pool streams waiting for their service name (see streampool.go)
+	poolMu     sync.Mutex
+	poolHellos map[peer.ID]int
 }
 
 // NewServiceRegistry creates a new service registry.
 // Pass nil for metrics to disable instrumentation.
 func NewServiceRegistry(h host.Host, metrics *Metrics) *ServiceRegistry {
-	return &ServiceRegistry{
-		host:     h,
-		services: make(map[string]*Service),
-		metrics:  metrics,
+	r := &ServiceRegistry{
+		host:           h,
+		services:       make(map[string]*Service),
+		metrics:        metrics,
+		accessRules:    make(map[string][]*AccessRule),
+		allowedRoles:   make(map[string][]string),
+		descriptions:   make(map[string]string),
+		resumeGrace:    DefaultResumeGrace,
+		resumeSessions: make(map[resumeKey]*resumableConn),
+		resumeClients:  make(map[*resumableConn]struct{}),
+		poolHellos:     make(map[peer.ID]int),
 	}
+	h.SetStreamHandler(ResumeProtocolID, r.handleResumeStream)
+	h.SetStreamHandler(StreamPoolProtocolID, r.handlePooledStream)
+	h.SetStreamHandler(ServiceQueryProtocol, r.handleServiceQuery)
+	return r
+}
+
+// SetBandwidthManager applies bm's per-service rate limits and quotas to
+// incoming service connections. Call before registering services.
+func (r *ServiceRegistry) SetBandwidthManager(bm *BandwidthManager) {
+	r.bandwidth = bm
+}
+
+// SetAuditLogger records service access denials in a. a may be nil.
+func (r *ServiceRegistry) SetAuditLogger(a *AuditLogger) {
+	r.audit = a
+}
+
+// SetEventFeed publishes service expose/unexpose events on f. f may be nil.
+func (r *ServiceRegistry) SetEventFeed(f *EventFeed) {
+	r.events = f
 }
 
 // RegisterService registers a new service and sets up its stream handler
@@ -79,6 +136,18 @@ func (r *ServiceRegistry) RegisterService(svc *Service) error {
 		return fmt.Errorf("service local_address cannot be empty")
 	}
 
+	if svc.Transport != "" && svc.Transport != ServiceTransportTCP && svc.Transport != ServiceTransportUDP {
+		return fmt.Errorf("service transport must be %q or %q, got %q", ServiceTransportTCP, ServiceTransportUDP, svc.Transport)
+	}
+
+	if err := validate.LocalAddress(svc.LocalAddress); err != nil {
+		return fmt.Errorf("service local_address: %w", err)
+	}
+
+	if svc.IsUDP() && IsUnixAddr(svc.LocalAddress) {
+		return fmt.Errorf("service %s: unix sockets are stream-only and cannot carry UDP", svc.Name)
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -95,6 +164,11 @@ func (r *ServiceRegistry) RegisterService(svc *Service) error {
 	r.host.SetStreamHandler(pid, r.handleServiceStream(svc))
 
 	slog.Info("registered service", "service", svc.Name, "protocol", svc.Protocol, "local", svc.LocalAddress)
+	r.events.Publish(EventServiceExposed, "", map[string]any{
+		"service":       svc.Name,
+		"protocol":      svc.Protocol,
+		"local_address": svc.LocalAddress,
+	})
 
 	return nil
 }
@@ -107,30 +181,63 @@ func (r *ServiceRegistry) handleServiceStream(svc *Service) func(network.Stream)
 		short := remotePeer.String()[:16] + "..."
 		slog.Info("incoming connection", "path", tag, "service", svc.Name, "peer", short)
 
-		// Per-service access control
-		if svc.AllowedPeers != nil {
-			if _, ok := svc.AllowedPeers[remotePeer]; !ok {
-				slog.Warn("peer not in service ACL", "service", svc.Name, "peer", short)
-				s.Reset()
-				return
-			}
+		local, until, refusal := r.admitStream(svc, remotePeer)
+		if refusal != "" {
+			s.Reset()
+			return
 		}
+		stopWatch := r.watchAccess(svc, remotePeer, until, func() { s.Reset() })
+		defer stopWatch()
 
-		// Connect to local service (with timeout to avoid hanging on unreachable services)
-		localConn, err := net.DialTimeout("tcp", svc.LocalAddress, 10*time.Second)
-		if err != nil {
-			slog.Error("failed to connect to local service", "service", svc.Name, "addr", svc.LocalAddress, "error", err)
-			s.Reset()
+		if svc.IsUDP() {
+			// One stream per client flow; closes after the flow goes idle
+			conn := r.bandwidth.Wrap(svc.Name, remotePeer, &serviceStream{stream: s})
+			instrumentedRelayDatagrams(conn, local, DefaultUDPIdleTimeout, svc.Name, r.metrics)
+
+			slog.Info("closed connection", "service", svc.Name, "peer", short)
 			return
 		}
 
 		// Bidirectional proxy with half-close propagation and optional metrics
-		InstrumentedBidirectionalProxy(&serviceStream{stream: s}, &tcpHalfCloser{localConn}, svc.Name, r.metrics)
+		conn := r.bandwidth.Wrap(svc.Name, remotePeer, &serviceStream{stream: s})
+		InstrumentedBidirectionalProxy(conn, &tcpHalfCloser{local}, svc.Name, r.metrics)
 
 		slog.Info("closed connection", "service", svc.Name, "peer", short)
 	}
 }
 
+// admitStream runs the checks every incoming service connection passes
+// before it reaches the local service, whichever protocol carried it:
+// per-service access (allowed peers/roles + access windows), the
+// bandwidth quota, then the dial to the local service. until is when the
+// peer's access window closes (zero = never). On refusal local is nil and
+// refusal is a short reason that may be shown to the remote peer.
+func (r *ServiceRegistry) admitStream(svc *Service, remotePeer peer.ID) (local net.Conn, until time.Time, refusal string) {
+	until, reason := r.checkAccess(svc, remotePeer, time.Now())
+	if reason != "" {
+		r.denyAccess(svc, remotePeer, reason)
+		return nil, time.Time{}, "not authorized"
+	}
+
+	// Quota check before touching the local service
+	if err := r.bandwidth.Admit(svc.Name, remotePeer); err != nil {
+		return nil, time.Time{}, "quota exceeded"
+	}
+
+	// Connect with a timeout to avoid hanging on unreachable services
+	var err error
+	if svc.IsUDP() {
+		local, err = net.DialTimeout("udp", svc.LocalAddress, 10*time.Second)
+	} else {
+		local, err = DialLocal(svc.LocalAddress, 10*time.Second)
+	}
+	if err != nil {
+		slog.Error("failed to connect to local service", "service", svc.Name, "addr", svc.LocalAddress, "error", err)
+		return nil, time.Time{}, "local service unavailable"
+	}
+	return local, until, ""
+}
+
 // DialService connects to a remote peer's service
 func (r *ServiceRegistry) DialService(ctx context.Context, peerID peer.ID, protocolID string) (ServiceConn, error) {
 	pid := protocol.ID(protocolID)
@@ -171,6 +278,7 @@ func (r *ServiceRegistry) UnregisterService(name string) error {
 	delete(r.services, name)
 
 	slog.Info("unregistered service", "service", name, "protocol", svc.Protocol)
+	r.events.Publish(EventServiceUnexposed, "", map[string]any{"service": name, "protocol": svc.Protocol})
 	return nil
 }
 
@@ -91,6 +91,37 @@ func TestRegisterService(t *testing.T) {
 			t.Errorf("expected ErrServiceAlreadyRegistered, got: %v", err)
 		}
 	})
+
+	t.Run("udp transport", func(t *testing.T) {
+		svc := &Service{
+			Name:         "dns",
+			Protocol:     "/peerup/dns/udp/1.0.0",
+			LocalAddress: "localhost:53",
+			Transport:    ServiceTransportUDP,
+		}
+		if err := reg.RegisterService(svc); err != nil {
+			t.Fatalf("RegisterService: %v", err)
+		}
+		got, ok := reg.GetService("dns")
+		if !ok {
+			t.Fatal("GetService: dns not found")
+		}
+		if !got.IsUDP() {
+			t.Error("expected UDP service")
+		}
+	})
+
+	t.Run("invalid transport", func(t *testing.T) {
+		svc := &Service{
+			Name:         "quic",
+			Protocol:     "/peerup/quic/1.0.0",
+			LocalAddress: "localhost:443",
+			Transport:    "sctp",
+		}
+		if err := reg.RegisterService(svc); err == nil {
+			t.Error("expected error for invalid transport")
+		}
+	})
 }
 
 func TestUnregisterService(t *testing.T) {
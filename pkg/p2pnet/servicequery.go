@@ -0,0 +1,133 @@
+package p2pnet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ServiceQueryProtocol lets a peer ask which services it may use here.
+const ServiceQueryProtocol = "/peerup/services/1.0.0"
+
+// Service query wire limits.
+const (
+	maxServiceQueryResponse  = 64 << 10
+	maxServiceDescriptionLen = 200
+	serviceQueryTimeout      = 15 * time.Second
+)
+
+// RemoteService is a service offered to the querying peer.
+type RemoteService struct {
+	Name        string `json:"name"`
+	Transport   string `json:"transport"` // "tcp" or "udp"
+	Description string `json:"description,omitempty"`
+}
+
+// serviceQueryResponse is the single JSON message sent in reply to a query.
+type serviceQueryResponse struct {
+	Services []RemoteService `json:"services"`
+}
+
+// SetDescription attaches a human-readable description to service, shown
+// to peers that browse this node's services. Descriptions are kept by
+// service name; an empty description removes it.
+func (r *ServiceRegistry) SetDescription(service, description string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if description == "" {
+		delete(r.descriptions, service)
+		return
+	}
+	if len(description) > maxServiceDescriptionLen {
+		// Cut on a rune boundary so the stored text stays valid UTF-8.
+		n := maxServiceDescriptionLen
+		for n > 0 && !utf8.RuneStart(description[n]) {
+			n--
+		}
+		description = description[:n]
+	}
+	r.descriptions[service] = description
+}
+
+// Description returns the description set for service.
+func (r *ServiceRegistry) Description(service string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.descriptions[service]
+}
+
+// ServicesFor returns the enabled services remotePeer may use at now,
+// sorted by name. Services the peer is denied, whether by allowed peers,
+// allowed roles or a closed access window, are left out entirely so a
+// query never reveals that they exist.
+func (r *ServiceRegistry) ServicesFor(remotePeer peer.ID, now time.Time) []RemoteService {
+	out := []RemoteService{}
+	for _, svc := range r.ListServices() {
+		if !svc.Enabled {
+			continue
+		}
+		if _, reason := r.checkAccess(svc, remotePeer, now); reason != "" {
+			continue
+		}
+		transport := ServiceTransportTCP
+		if svc.IsUDP() {
+			transport = ServiceTransportUDP
+		}
+		out = append(out, RemoteService{Name: svc.Name, Transport: transport, Description: r.Description(svc.Name)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// handleServiceQuery answers a query with the services the remote peer
+// may use. The request carries no payload.
+func (r *ServiceRegistry) handleServiceQuery(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(serviceQueryTimeout))
+
+	remotePeer := s.Conn().RemotePeer()
+	services := r.ServicesFor(remotePeer, time.Now())
+	slog.Debug("service query", "peer", remotePeer.String()[:16]+"...", "offered", len(services))
+
+	if err := json.NewEncoder(s).Encode(serviceQueryResponse{Services: services}); err != nil {
+		slog.Debug("service query: reply failed", "peer", remotePeer.String()[:16]+"...", "err", err)
+		s.Reset()
+	}
+}
+
+// QueryServices asks peerID which of its services this node may use.
+func (r *ServiceRegistry) QueryServices(ctx context.Context, peerID peer.ID) ([]RemoteService, error) {
+	ctx, cancel := context.WithTimeout(ctx, serviceQueryTimeout)
+	defer cancel()
+
+	// The query is tiny, so it is fine over relay circuits.
+	ctx = network.WithAllowLimitedConn(ctx, ServiceQueryProtocol)
+
+	s, err := r.host.NewStream(ctx, peerID, ServiceQueryProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer s.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
+	s.CloseWrite()
+
+	var resp serviceQueryResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxServiceQueryResponse)).Decode(&resp); err != nil {
+		s.Reset()
+		return nil, fmt.Errorf("failed to read service list: %w", err)
+	}
+	if resp.Services == nil {
+		resp.Services = []RemoteService{}
+	}
+	return resp.Services, nil
+}
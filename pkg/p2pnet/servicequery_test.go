@@ -0,0 +1,100 @@
+package p2pnet
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestServicesFor(t *testing.T) {
+	reg := newTestHost(t)
+	ops, contractor := genTestPeerID(t), genTestPeerID(t)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) // Saturday noon
+
+	for _, svc := range []*Service{
+		{Name: "ssh", Protocol: "/peerup/ssh/1.0.0", LocalAddress: "localhost:22", Enabled: true},
+		{Name: "dns", Protocol: "/peerup/dns/udp/1.0.0", LocalAddress: "localhost:53", Transport: ServiceTransportUDP, Enabled: true},
+		{Name: "grafana", Protocol: "/peerup/grafana/1.0.0", LocalAddress: "localhost:3000", Enabled: true},
+		{Name: "rdp", Protocol: "/peerup/rdp/1.0.0", LocalAddress: "localhost:3389", Enabled: true},
+		{Name: "old", Protocol: "/peerup/old/1.0.0", LocalAddress: "localhost:1", Enabled: false},
+	} {
+		if err := reg.RegisterService(svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reg.SetDescription("ssh", "Shell")
+	reg.SetRoleChecker(fakeRoles{ops: {"ops"}})
+	reg.SetAllowedRoles("grafana", []string{"ops"})
+	reg.SetAccessRules("rdp", []*AccessRule{{
+		Peers:    map[peer.ID]struct{}{contractor: {}},
+		Windows:  []AccessWindow{mustWindow(t, "mon-fri 09:00-18:00")},
+		Location: time.UTC,
+	}})
+
+	names := func(svcs []RemoteService) string {
+		var out []string
+		for _, s := range svcs {
+			out = append(out, s.Name+"/"+s.Transport)
+		}
+		return strings.Join(out, ",")
+	}
+
+	if got := names(reg.ServicesFor(ops, now)); got != "dns/udp,grafana/tcp,rdp/tcp,ssh/tcp" {
+		t.Errorf("ops sees %s", got)
+	}
+	// Denied by role, outside the access window, or disabled: not listed.
+	if got := names(reg.ServicesFor(contractor, now)); got != "dns/udp,ssh/tcp" {
+		t.Errorf("contractor on Saturday sees %s", got)
+	}
+	if got := names(reg.ServicesFor(contractor, now.Add(48*time.Hour))); got != "dns/udp,rdp/tcp,ssh/tcp" {
+		t.Errorf("contractor on Monday sees %s", got)
+	}
+
+	if svcs := reg.ServicesFor(ops, now); svcs[3].Description != "Shell" || svcs[0].Description != "" {
+		t.Errorf("descriptions = %+v", svcs)
+	}
+	reg.SetDescription("ssh", strings.Repeat("x", maxServiceDescriptionLen+10))
+	if d := reg.Description("ssh"); len(d) != maxServiceDescriptionLen {
+		t.Errorf("description length = %d, want truncated to %d", len(d), maxServiceDescriptionLen)
+	}
+	// A multi-byte rune straddling the limit is dropped, not split.
+	reg.SetDescription("ssh", strings.Repeat("x", maxServiceDescriptionLen-1)+"é")
+	if d := reg.Description("ssh"); !utf8.ValidString(d) || len(d) != maxServiceDescriptionLen-1 {
+		t.Errorf("description = %q (len %d), want valid UTF-8 of length %d", d, len(d), maxServiceDescriptionLen-1)
+	}
+}
+
+func TestQueryServices(t *testing.T) {
+	server, client := newTestHost(t), newTestHost(t)
+	other := genTestPeerID(t)
+
+	server.RegisterService(&Service{Name: "ssh", Protocol: "/peerup/ssh/1.0.0", LocalAddress: "localhost:22", Enabled: true})
+	server.RegisterService(&Service{
+		Name: "db", Protocol: "/peerup/db/1.0.0", LocalAddress: "localhost:5432", Enabled: true,
+		AllowedPeers: map[peer.ID]struct{}{other: {}},
+	})
+	server.SetDescription("ssh", "Shell on the NAS")
+
+	info := peer.AddrInfo{ID: server.host.ID(), Addrs: server.host.Addrs()}
+	if err := client.host.Connect(context.Background(), info); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.QueryServices(context.Background(), server.host.ID())
+	if err != nil {
+		t.Fatalf("QueryServices() error = %v", err)
+	}
+	if len(got) != 1 || got[0] != (RemoteService{Name: "ssh", Transport: "tcp", Description: "Shell on the NAS"}) {
+		t.Errorf("QueryServices() = %+v, want only ssh", got)
+	}
+
+	server.UnregisterService("ssh")
+	got, err = client.QueryServices(context.Background(), server.host.ID())
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("QueryServices() with nothing allowed = %+v, %v; want empty list", got, err)
+	}
+}
@@ -0,0 +1,493 @@
+package p2pnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// StreamPoolProtocolID carries pooled streams. A warm stream negotiates it
+// ahead of time but names its service only when it is taken from the pool,
+// so the remote side checks access and dials its local service when the
+// connection is used rather than when the stream is warmed.
+const StreamPoolProtocolID = "/peerup/stream-pool/1.0.0"
+
+// DefaultStreamPoolSize is the number of warm streams kept per (peer, service).
+const DefaultStreamPoolSize = 2
+
+// DefaultStreamPoolIdleTimeout is how long a warm stream may wait unused
+// before it is closed.
+const DefaultStreamPoolIdleTimeout = 30 * time.Second
+
+// MaxStreamPoolIdleTimeout caps StreamPoolConfig.IdleTimeout so warm
+// streams are evicted locally before the remote side gives up on them.
+const MaxStreamPoolIdleTimeout = time.Minute
+
+// streamPoolDialTimeout bounds each background refill dial.
+const streamPoolDialTimeout = 30 * time.Second
+
+// streamPoolHelloTimeout bounds how long the remote side holds a warm
+// stream that has not named its service yet.
+const streamPoolHelloTimeout = MaxStreamPoolIdleTimeout + 15*time.Second
+
+// maxPendingPoolStreams caps the unnamed warm streams one peer may hold
+// open here; further pool streams from that peer are reset.
+const maxPendingPoolStreams = 32
+
+// errStreamPoolUnsupported is returned when warming streams to a peer that
+// does not speak StreamPoolProtocolID; its connections are dialed fresh.
+var errStreamPoolUnsupported = errors.New("peer does not support pooled streams")
+
+// StreamDialFunc opens a new stream to a service on a peer.
+// Network.ConnectToServiceContext satisfies this signature.
+type StreamDialFunc func(ctx context.Context, peerID peer.ID, serviceName string) (ServiceConn, error)
+
+// StreamPoolConfig controls a StreamPool. Zero values use the defaults.
+type StreamPoolConfig struct {
+	Size        int           // warm streams per (peer, service)
+	IdleTimeout time.Duration // close warm streams unused for this long
+}
+
+// StreamPool keeps a few pre-opened, protocol-negotiated streams per
+// (peer, service) so a new proxy connection can start sending immediately
+// instead of paying for stream setup and multistream negotiation, which
+// costs several round trips over relayed paths.
+//
+// libp2p streams carry exactly one proxied connection (half-close ends it),
+// so pooled streams are handed out once and never returned. The pool refills
+// in the background after every Get. Warm streams that sit unused for
+// IdleTimeout are closed.
+type StreamPool struct {
+	dial        StreamDialFunc // fresh dials on a miss
+	warm        StreamDialFunc // background refills; defaults to dial
+	size        int
+	idleTimeout time.Duration
+	metrics     *Metrics
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	pools map[poolKey]*servicePool
+}
+
+type poolKey struct {
+	peer    peer.ID
+	service string
+}
+
+// warmStream is an unused stream waiting in the pool.
+type warmStream struct {
+	conn     ServiceConn
+	openedAt time.Time
+}
+
+// servicePool holds the warm streams for one (peer, service).
+type servicePool struct {
+	idle    []warmStream // oldest first
+	pending int          // refill dials in flight
+}
+
+// NewStreamPool creates a pool that opens streams with dial.
+// metrics may be nil.
+func NewStreamPool(dial StreamDialFunc, cfg StreamPoolConfig, metrics *Metrics) *StreamPool {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultStreamPoolSize
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = DefaultStreamPoolIdleTimeout
+	}
+	cfg.IdleTimeout = min(cfg.IdleTimeout, MaxStreamPoolIdleTimeout)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &StreamPool{
+		dial:        dial,
+		warm:        dial,
+		size:        cfg.Size,
+		idleTimeout: cfg.IdleTimeout,
+		metrics:     metrics,
+		ctx:         ctx,
+		cancel:      cancel,
+		pools:       make(map[poolKey]*servicePool),
+	}
+
+	p.wg.Add(1)
+	go p.evictLoop()
+	return p
+}
+
+// Warm starts filling the pool for (peerID, service) without taking a stream.
+func (p *StreamPool) Warm(peerID peer.ID, service string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refillLocked(poolKey{peer: peerID, service: service})
+}
+
+// Get returns a warm stream for (peerID, service) if one is available,
+// otherwise dials a fresh one with ctx. Either way the pool is topped up
+// in the background for the next caller.
+func (p *StreamPool) Get(ctx context.Context, peerID peer.ID, service string) (ServiceConn, error) {
+	key := poolKey{peer: peerID, service: service}
+
+	p.mu.Lock()
+	conn := p.takeLocked(key)
+	p.refillLocked(key)
+	p.mu.Unlock()
+
+	if pc, ok := conn.(*pooledStream); ok {
+		if err := pc.activate(); err != nil {
+			slog.Debug("warm stream activation failed", "peer", peerID.String()[:16]+"...", "service", service, "error", err)
+			pc.Close()
+			conn = nil
+		}
+	}
+	if conn != nil {
+		p.recordRequest(service, "hit")
+		return conn, nil
+	}
+
+	p.recordRequest(service, "miss")
+	return p.dial(ctx, peerID, service)
+}
+
+// DialFunc returns a dial function for TCPListener that draws from the pool.
+// Fresh dials (pool misses) use a 30s timeout.
+func (p *StreamPool) DialFunc(peerID peer.ID, service string) func() (ServiceConn, error) {
+	return func() (ServiceConn, error) {
+		ctx, cancel := context.WithTimeout(p.ctx, streamPoolDialTimeout)
+		defer cancel()
+		return p.Get(ctx, peerID, service)
+	}
+}
+
+// Idle returns the number of warm streams waiting for (peerID, service).
+func (p *StreamPool) Idle(peerID peer.ID, service string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sp, ok := p.pools[poolKey{peer: peerID, service: service}]; ok {
+		return len(sp.idle)
+	}
+	return 0
+}
+
+// Drain closes all warm streams for (peerID, service) and stops refilling
+// them until the next Get or Warm.
+func (p *StreamPool) Drain(peerID peer.ID, service string) {
+	key := poolKey{peer: peerID, service: service}
+
+	p.mu.Lock()
+	sp, ok := p.pools[key]
+	if ok {
+		delete(p.pools, key)
+	}
+	p.mu.Unlock()
+
+	if ok {
+		p.closeIdle(service, sp.idle, "closed")
+	}
+}
+
+// DrainPeer closes every warm stream to peerID and refills each of its
+// pools with fresh streams. Called after a path upgrade so warm streams
+// opened over a relay circuit are replaced by ones on the direct connection.
+func (p *StreamPool) DrainPeer(peerID peer.ID) {
+	type drained struct {
+		service string
+		streams []warmStream
+	}
+	var toClose []drained
+
+	p.mu.Lock()
+	var keys []poolKey
+	for key := range p.pools {
+		if key.peer == peerID {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		toClose = append(toClose, drained{service: key.service, streams: p.pools[key].idle})
+		// Replacing the servicePool makes in-flight fills for the old one
+		// discard their stream, which may also be on the relay.
+		delete(p.pools, key)
+		p.refillLocked(key)
+	}
+	p.mu.Unlock()
+
+	for _, d := range toClose {
+		p.closeIdle(d.service, d.streams, "upgrade")
+	}
+}
+
+// Close stops background refills and closes every warm stream.
+func (p *StreamPool) Close() error {
+	// Cancel under p.mu so no refill can start after wg.Wait begins.
+	p.mu.Lock()
+	p.cancel()
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	p.mu.Lock()
+	pools := p.pools
+	p.pools = make(map[poolKey]*servicePool)
+	p.mu.Unlock()
+
+	for key, sp := range pools {
+		p.closeIdle(key.service, sp.idle, "closed")
+	}
+	return nil
+}
+
+// takeLocked pops the oldest warm stream that has not expired.
+// Expired streams found along the way are closed. Caller holds p.mu.
+func (p *StreamPool) takeLocked(key poolKey) ServiceConn {
+	sp, ok := p.pools[key]
+	if !ok {
+		return nil
+	}
+	for len(sp.idle) > 0 {
+		ws := sp.idle[0]
+		sp.idle = sp.idle[1:]
+		p.setIdleGauge(key.service, -1)
+		if time.Since(ws.openedAt) < p.idleTimeout {
+			return ws.conn
+		}
+		ws.conn.Close()
+		p.recordEviction(key.service, "idle")
+	}
+	return nil
+}
+
+// refillLocked starts enough background dials to bring the pool for key
+// back up to size. Caller holds p.mu.
+func (p *StreamPool) refillLocked(key poolKey) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	sp, ok := p.pools[key]
+	if !ok {
+		sp = &servicePool{}
+		p.pools[key] = sp
+	}
+
+	for len(sp.idle)+sp.pending < p.size {
+		sp.pending++
+		p.wg.Add(1)
+		go p.fill(key, sp)
+	}
+}
+
+// fill dials one warm stream and adds it to sp.
+func (p *StreamPool) fill(key poolKey, sp *servicePool) {
+	defer p.wg.Done()
+
+	ctx, cancel := context.WithTimeout(p.ctx, streamPoolDialTimeout)
+	conn, err := p.warm(ctx, key.peer, key.service)
+	cancel()
+
+	if err == nil {
+		// A zero-length write completes lazy multistream negotiation now,
+		// so the first real write on this stream carries only payload.
+		if _, werr := conn.Write(nil); werr != nil {
+			conn.Close()
+			err = werr
+		}
+	}
+
+	p.mu.Lock()
+	sp.pending--
+	current, stillPooled := p.pools[key]
+	if err != nil || p.ctx.Err() != nil || !stillPooled || current != sp {
+		p.mu.Unlock()
+		if err != nil {
+			slog.Debug("stream pool refill failed", "peer", key.peer.String()[:16]+"...", "service", key.service, "error", err)
+		} else {
+			conn.Close()
+		}
+		return
+	}
+	sp.idle = append(sp.idle, warmStream{conn: conn, openedAt: time.Now()})
+	p.setIdleGauge(key.service, 1)
+	p.mu.Unlock()
+}
+
+// evictLoop periodically closes warm streams that exceeded the idle timeout.
+func (p *StreamPool) evictLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.idleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+			p.evictExpired()
+		}
+	}
+}
+
+// evictExpired closes expired warm streams. Pools are not refilled here:
+// an idle (peer, service) pair stops holding streams until it is used again.
+func (p *StreamPool) evictExpired() {
+	type expired struct {
+		service string
+		streams []warmStream
+	}
+	var toClose []expired
+
+	p.mu.Lock()
+	for key, sp := range p.pools {
+		n := 0
+		for n < len(sp.idle) && time.Since(sp.idle[n].openedAt) >= p.idleTimeout {
+			n++
+		}
+		if n > 0 {
+			toClose = append(toClose, expired{service: key.service, streams: sp.idle[:n]})
+			sp.idle = sp.idle[n:]
+		}
+		if len(sp.idle) == 0 && sp.pending == 0 {
+			delete(p.pools, key)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, e := range toClose {
+		p.closeIdle(e.service, e.streams, "idle")
+	}
+}
+
+// closeIdle closes warm streams that were removed from the pool.
+func (p *StreamPool) closeIdle(service string, streams []warmStream, reason string) {
+	for _, ws := range streams {
+		ws.conn.Close()
+		p.setIdleGauge(service, -1)
+		p.recordEviction(service, reason)
+	}
+}
+
+func (p *StreamPool) recordRequest(service, result string) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.StreamPoolRequestsTotal.WithLabelValues(service, result).Inc()
+}
+
+func (p *StreamPool) recordEviction(service, reason string) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.StreamPoolEvictionsTotal.WithLabelValues(service, reason).Inc()
+}
+
+func (p *StreamPool) setIdleGauge(service string, delta float64) {
+	if p.metrics == nil {
+		return
+	}
+	p.metrics.StreamPoolIdle.WithLabelValues(service).Add(delta)
+}
+
+// pooledStream is a warm stream on StreamPoolProtocolID. It names its
+// service with activate when the pool hands it out.
+type pooledStream struct {
+	serviceStream
+	service string
+}
+
+// activate sends the service name: [1] length + name. The remote side
+// then runs the same admission as a plain service stream.
+func (ps *pooledStream) activate() error {
+	if _, err := ps.Write(append([]byte{byte(len(ps.service))}, ps.service...)); err != nil {
+		return fmt.Errorf("failed to name service: %w", err)
+	}
+	return nil
+}
+
+// dialPooledService opens a warm stream to peerID for serviceName.
+// Peers without StreamPoolProtocolID get errStreamPoolUnsupported.
+func (r *ServiceRegistry) dialPooledService(ctx context.Context, peerID peer.ID, serviceName string) (ServiceConn, error) {
+	if err := ValidateServiceName(serviceName); err != nil {
+		return nil, err
+	}
+	// Connect first so identify has told us which protocols the peer speaks.
+	ctx = network.WithAllowLimitedConn(ctx, StreamPoolProtocolID)
+	if err := r.host.Connect(ctx, peer.AddrInfo{ID: peerID}); err != nil {
+		return nil, fmt.Errorf("failed to connect to peer: %w", err)
+	}
+	if protos, _ := r.host.Peerstore().SupportsProtocols(peerID, StreamPoolProtocolID); len(protos) == 0 {
+		return nil, errStreamPoolUnsupported
+	}
+	s, err := r.host.NewStream(ctx, peerID, StreamPoolProtocolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	return &pooledStream{serviceStream: serviceStream{stream: s}, service: serviceName}, nil
+}
+
+// handlePooledStream serves StreamPoolProtocolID: it waits for the service
+// name and hands the stream to the service's normal handler.
+func (r *ServiceRegistry) handlePooledStream(s network.Stream) {
+	remote := s.Conn().RemotePeer()
+	if !r.addPoolHello(remote) {
+		slog.Debug("too many pending pooled streams", "peer", remote.String()[:16]+"...")
+		s.Reset()
+		return
+	}
+	name, err := readPoolHello(s)
+	r.donePoolHello(remote)
+	if err != nil {
+		s.Reset()
+		return
+	}
+
+	svc, ok := r.GetService(name)
+	if !ok || svc.IsUDP() {
+		slog.Debug("pooled stream for unknown service", "peer", remote.String()[:16]+"...", "service", name)
+		s.Reset()
+		return
+	}
+	r.handleServiceStream(svc)(s)
+}
+
+// readPoolHello reads the service name a warm stream sends when used.
+func readPoolHello(s network.Stream) (string, error) {
+	s.SetReadDeadline(time.Now().Add(streamPoolHelloTimeout))
+	var n [1]byte
+	if _, err := io.ReadFull(s, n[:]); err != nil {
+		return "", err
+	}
+	name := make([]byte, n[0])
+	if _, err := io.ReadFull(s, name); err != nil {
+		return "", err
+	}
+	s.SetReadDeadline(time.Time{})
+	return string(name), nil
+}
+
+// addPoolHello counts a warm stream from p that has not named its service.
+// Returns false if p already holds maxPendingPoolStreams.
+func (r *ServiceRegistry) addPoolHello(p peer.ID) bool {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+	if r.poolHellos[p] >= maxPendingPoolStreams {
+		return false
+	}
+	r.poolHellos[p]++
+	return true
+}
+
+func (r *ServiceRegistry) donePoolHello(p peer.ID) {
+	r.poolMu.Lock()
+	defer r.poolMu.Unlock()
+	if r.poolHellos[p]--; r.poolHellos[p] <= 0 {
+		delete(r.poolHellos, p)
+	}
+}
@@ -0,0 +1,355 @@
+package p2pnet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeStreamDialer hands out in-memory streams and counts dials and closes.
+type fakeStreamDialer struct {
+	dials  atomic.Int32
+	closed atomic.Int32
+	fail   atomic.Bool
+
+	mu    sync.Mutex
+	conns []*fakePoolConn
+}
+
+type fakePoolConn struct {
+	pipeConn
+	d         *fakeStreamDialer
+	closeOnce sync.Once
+}
+
+func (c *fakePoolConn) Close() error {
+	c.closeOnce.Do(func() { c.d.closed.Add(1) })
+	return c.pipeConn.Close()
+}
+
+func (d *fakeStreamDialer) dial(ctx context.Context, _ peer.ID, _ string) (ServiceConn, error) {
+	d.dials.Add(1)
+	if d.fail.Load() {
+		return nil, errors.New("dial failed")
+	}
+	local, remote := net.Pipe()
+	// Drain the remote end so writes on local never block.
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			if _, err := remote.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	c := &fakePoolConn{pipeConn: pipeConn{local}, d: d}
+	d.mu.Lock()
+	d.conns = append(d.conns, c)
+	d.mu.Unlock()
+	return c, nil
+}
+
+// waitFor polls cond until it is true or the deadline passes.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamPoolWarmAndHit(t *testing.T) {
+	d := &fakeStreamDialer{}
+	m := NewMetrics("test", "go1.0")
+	pool := NewStreamPool(d.dial, StreamPoolConfig{Size: 2, IdleTimeout: time.Minute}, m)
+	defer pool.Close()
+
+	pid := genTestPeerID(t)
+	pool.Warm(pid, "ssh")
+	waitFor(t, func() bool { return pool.Idle(pid, "ssh") == 2 })
+
+	conn, err := pool.Get(context.Background(), pid, "ssh")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer conn.Close()
+
+	// The pool refills back to size after a hit.
+	waitFor(t, func() bool { return pool.Idle(pid, "ssh") == 2 })
+	if got := d.dials.Load(); got != 3 {
+		t.Errorf("dials = %d, want 3", got)
+	}
+
+	if v := testutil.ToFloat64(m.StreamPoolRequestsTotal.WithLabelValues("ssh", "hit")); v != 1 {
+		t.Errorf("hit count = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(m.StreamPoolIdle.WithLabelValues("ssh")); v != 2 {
+		t.Errorf("idle gauge = %v, want 2", v)
+	}
+}
+
+func TestStreamPoolMissDialsDirectly(t *testing.T) {
+	d := &fakeStreamDialer{}
+	m := NewMetrics("test", "go1.0")
+	pool := NewStreamPool(d.dial, StreamPoolConfig{Size: 1, IdleTimeout: time.Minute}, m)
+	defer pool.Close()
+
+	pid := genTestPeerID(t)
+	conn, err := pool.Get(context.Background(), pid, "web")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	conn.Close()
+
+	if v := testutil.ToFloat64(m.StreamPoolRequestsTotal.WithLabelValues("web", "miss")); v != 1 {
+		t.Errorf("miss count = %v, want 1", v)
+	}
+	waitFor(t, func() bool { return pool.Idle(pid, "web") == 1 })
+}
+
+func TestStreamPoolIdleEviction(t *testing.T) {
+	d := &fakeStreamDialer{}
+	m := NewMetrics("test", "go1.0")
+	pool := NewStreamPool(d.dial, StreamPoolConfig{Size: 2, IdleTimeout: 100 * time.Millisecond}, m)
+	defer pool.Close()
+
+	pid := genTestPeerID(t)
+	pool.Warm(pid, "ssh")
+	waitFor(t, func() bool { return pool.Idle(pid, "ssh") == 2 })
+
+	// Eviction closes both warm streams and does not refill an unused pair.
+	waitFor(t, func() bool { return d.closed.Load() == 2 })
+	if got := pool.Idle(pid, "ssh"); got != 0 {
+		t.Errorf("Idle after eviction = %d, want 0", got)
+	}
+	if v := testutil.ToFloat64(m.StreamPoolEvictionsTotal.WithLabelValues("ssh", "idle")); v != 2 {
+		t.Errorf("idle evictions = %v, want 2", v)
+	}
+	if v := testutil.ToFloat64(m.StreamPoolIdle.WithLabelValues("ssh")); v != 0 {
+		t.Errorf("idle gauge = %v, want 0", v)
+	}
+}
+
+func TestStreamPoolDialFailure(t *testing.T) {
+	d := &fakeStreamDialer{}
+	d.fail.Store(true)
+	pool := NewStreamPool(d.dial, StreamPoolConfig{Size: 2}, nil)
+	defer pool.Close()
+
+	pid := genTestPeerID(t)
+	if _, err := pool.Get(context.Background(), pid, "ssh"); err == nil {
+		t.Fatal("expected dial error on miss")
+	}
+	// Failed refills leave the pool empty rather than holding broken streams.
+	waitFor(t, func() bool { return d.dials.Load() == 3 })
+	if got := pool.Idle(pid, "ssh"); got != 0 {
+		t.Errorf("Idle = %d, want 0", got)
+	}
+}
+
+func TestStreamPoolCloseClosesWarmStreams(t *testing.T) {
+	d := &fakeStreamDialer{}
+	pool := NewStreamPool(d.dial, StreamPoolConfig{Size: 3, IdleTimeout: time.Minute}, nil)
+
+	pid := genTestPeerID(t)
+	pool.Warm(pid, "ssh")
+	waitFor(t, func() bool { return pool.Idle(pid, "ssh") == 3 })
+
+	pool.Close()
+	if got := d.closed.Load(); got != 3 {
+		t.Errorf("closed = %d, want 3", got)
+	}
+
+	// No refills after Close.
+	pool.Warm(pid, "ssh")
+	if got := d.dials.Load(); got != 3 {
+		t.Errorf("dials after Close = %d, want 3", got)
+	}
+}
+
+func TestStreamPoolDrain(t *testing.T) {
+	d := &fakeStreamDialer{}
+	pool := NewStreamPool(d.dial, StreamPoolConfig{Size: 2, IdleTimeout: time.Minute}, nil)
+	defer pool.Close()
+
+	pid := genTestPeerID(t)
+	pool.Warm(pid, "ssh")
+	waitFor(t, func() bool { return pool.Idle(pid, "ssh") == 2 })
+
+	pool.Drain(pid, "ssh")
+	if got := pool.Idle(pid, "ssh"); got != 0 {
+		t.Errorf("Idle after Drain = %d, want 0", got)
+	}
+	if got := d.closed.Load(); got != 2 {
+		t.Errorf("closed = %d, want 2", got)
+	}
+}
+
+func TestStreamPoolDrainPeer(t *testing.T) {
+	d := &fakeStreamDialer{}
+	pool := NewStreamPool(d.dial, StreamPoolConfig{Size: 2, IdleTimeout: time.Minute}, nil)
+	defer pool.Close()
+
+	pid := genTestPeerID(t)
+	other := genTestPeerID(t)
+	pool.Warm(pid, "ssh")
+	pool.Warm(pid, "rdp")
+	pool.Warm(other, "ssh")
+	waitFor(t, func() bool {
+		return pool.Idle(pid, "ssh") == 2 && pool.Idle(pid, "rdp") == 2 && pool.Idle(other, "ssh") == 2
+	})
+
+	pool.DrainPeer(pid)
+	if got := d.closed.Load(); got != 4 {
+		t.Errorf("closed = %d, want 4", got)
+	}
+
+	// Both of pid's pools refill with fresh streams; other is untouched.
+	waitFor(t, func() bool { return pool.Idle(pid, "ssh") == 2 && pool.Idle(pid, "rdp") == 2 })
+	if got := d.dials.Load(); got != 10 {
+		t.Errorf("dials = %d, want 10", got)
+	}
+	if got := pool.Idle(other, "ssh"); got != 2 {
+		t.Errorf("other peer Idle = %d, want 2", got)
+	}
+}
+
+func TestStreamPoolDefaults(t *testing.T) {
+	pool := NewStreamPool((&fakeStreamDialer{}).dial, StreamPoolConfig{}, nil)
+	defer pool.Close()
+
+	if pool.size != DefaultStreamPoolSize {
+		t.Errorf("size = %d, want %d", pool.size, DefaultStreamPoolSize)
+	}
+	if pool.idleTimeout != DefaultStreamPoolIdleTimeout {
+		t.Errorf("idleTimeout = %v, want %v", pool.idleTimeout, DefaultStreamPoolIdleTimeout)
+	}
+
+	long := NewStreamPool((&fakeStreamDialer{}).dial, StreamPoolConfig{IdleTimeout: time.Hour}, nil)
+	defer long.Close()
+	if long.idleTimeout != MaxStreamPoolIdleTimeout {
+		t.Errorf("idleTimeout = %v, want capped at %v", long.idleTimeout, MaxStreamPoolIdleTimeout)
+	}
+}
+
+// TestStreamPoolDefersAdmission checks that warm streams on the pool
+// protocol reach the remote service only once they are taken, and that
+// access is checked at that point.
+func TestStreamPoolDefersAdmission(t *testing.T) {
+	server, client := resumeTestPair(t)
+	svc, _ := server.GetService("echo")
+
+	var accepted atomic.Int32
+	counting, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer counting.Close()
+	go func() {
+		for {
+			conn, err := counting.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				io.Copy(conn, conn)
+				conn.(*net.TCPConn).CloseWrite()
+			}()
+		}
+	}()
+	svc.LocalAddress = counting.Addr().String()
+
+	pool := NewStreamPool(func(context.Context, peer.ID, string) (ServiceConn, error) {
+		return nil, errors.New("unexpected fresh dial")
+	}, StreamPoolConfig{Size: 2, IdleTimeout: time.Minute}, nil)
+	pool.warm = client.dialPooledService
+	defer pool.Close()
+
+	pid := server.host.ID()
+	pool.Warm(pid, "echo")
+	waitFor(t, func() bool { return pool.Idle(pid, "echo") == 2 })
+	time.Sleep(100 * time.Millisecond)
+	if got := accepted.Load(); got != 0 {
+		t.Fatalf("local service dialed %d times while streams were warm", got)
+	}
+
+	conn, err := pool.Get(context.Background(), pid, "echo")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	conn.Write([]byte("hello"))
+	conn.(HalfCloseConn).CloseWrite()
+	resp, err := io.ReadAll(conn)
+	conn.Close()
+	if err != nil || string(resp) != "hello" {
+		t.Fatalf("echo = %q, %v", resp, err)
+	}
+	if got := accepted.Load(); got != 1 {
+		t.Errorf("local service dialed %d times, want 1", got)
+	}
+
+	// Access revoked after warming is enforced when the stream is used.
+	svc.AllowedPeers = map[peer.ID]struct{}{pid: {}}
+	waitFor(t, func() bool { return pool.Idle(pid, "echo") == 2 })
+	conn, err = pool.Get(context.Background(), pid, "echo")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("denied"))
+	if resp, _ := io.ReadAll(conn); len(resp) != 0 {
+		t.Errorf("denied peer got %q", resp)
+	}
+	if got := accepted.Load(); got != 1 {
+		t.Errorf("local service dialed for a denied peer")
+	}
+}
+
+// TestStreamPoolCapsPendingHellos checks that a peer cannot hold more than
+// maxPendingPoolStreams unnamed warm streams on the remote side.
+func TestStreamPoolCapsPendingHellos(t *testing.T) {
+	server, client := resumeTestPair(t)
+	pid := server.host.ID()
+	pending := func() int {
+		server.poolMu.Lock()
+		defer server.poolMu.Unlock()
+		return server.poolHellos[client.host.ID()]
+	}
+
+	for range maxPendingPoolStreams {
+		s, err := client.host.NewStream(context.Background(), pid, StreamPoolProtocolID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		s.Write(nil) // open the stream on the remote side
+	}
+	waitFor(t, func() bool { return pending() == maxPendingPoolStreams })
+
+	extra, err := client.host.NewStream(context.Background(), pid, StreamPoolProtocolID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer extra.Close()
+	extra.Write([]byte{4})
+	extra.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := extra.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("stream over the cap: Read err = %v, want reset", err)
+	}
+	if got := pending(); got != maxPendingPoolStreams {
+		t.Errorf("pending = %d, want %d", got, maxPendingPoolStreams)
+	}
+}
@@ -0,0 +1,363 @@
+package p2pnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// UDP datagrams are carried over a libp2p stream as length-prefixed frames:
+//
+//	[2 bytes big-endian length][payload]
+//
+// Each client source address gets its own stream (one stream per flow), so
+// the remote side can use a connected UDP socket and replies are routed back
+// to the right local client without any extra addressing in the frame.
+
+// MaxDatagramSize is the largest UDP payload that fits in a single frame.
+const MaxDatagramSize = 65535
+
+// DefaultUDPIdleTimeout is how long a UDP flow may stay silent (in both
+// directions) before its stream is closed. DNS and game traffic are bursty,
+// WireGuard sends keepalives every 25s, so 2 minutes covers common cases.
+const DefaultUDPIdleTimeout = 2 * time.Minute
+
+// udpSessionQueueSize bounds the number of datagrams buffered for a flow
+// while its stream is still being dialed. Excess datagrams are dropped,
+// matching UDP's best-effort semantics.
+const udpSessionQueueSize = 64
+
+// writeDatagram writes one length-prefixed frame. Header and payload are sent
+// in a single Write so concurrent writers can never interleave frames.
+func writeDatagram(w io.Writer, p []byte) error {
+	if len(p) > MaxDatagramSize {
+		return fmt.Errorf("datagram too large: %d bytes (max %d)", len(p), MaxDatagramSize)
+	}
+	frame := make([]byte, 2+len(p))
+	binary.BigEndian.PutUint16(frame, uint16(len(p)))
+	copy(frame[2:], p)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readDatagram reads one length-prefixed frame into buf and returns the
+// payload length. buf must be at least MaxDatagramSize bytes.
+func readDatagram(r io.Reader, buf []byte) (int, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(hdr[:]))
+	if n > len(buf) {
+		return 0, fmt.Errorf("datagram frame of %d bytes exceeds buffer", n)
+	}
+	if _, err := io.ReadFull(r, buf[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// activityClock records the last time a datagram moved in either direction.
+type activityClock struct {
+	last atomic.Int64 // unix nanos
+}
+
+func (c *activityClock) touch() { c.last.Store(time.Now().UnixNano()) }
+
+// idleFor returns how long the flow has been silent.
+func (c *activityClock) idleFor() time.Duration {
+	return time.Since(time.Unix(0, c.last.Load()))
+}
+
+// datagramCounter records per-datagram metrics. All methods are nil-safe.
+type datagramCounter struct {
+	metrics *Metrics
+	service string
+}
+
+func (d *datagramCounter) record(direction string, n int) {
+	if d == nil || d.metrics == nil {
+		return
+	}
+	d.metrics.ProxyBytesTotal.WithLabelValues(direction, d.service).Add(float64(n))
+	d.metrics.ProxyDatagramsTotal.WithLabelValues(direction, d.service).Inc()
+}
+
+// relayDatagrams moves datagrams between a framed stream and a connected UDP
+// socket until either side fails or the flow is idle for idleTimeout.
+// Both stream and udpConn are closed on return.
+func relayDatagrams(stream io.ReadWriteCloser, udpConn net.Conn, idleTimeout time.Duration, counter *datagramCounter) {
+	if counter == nil {
+		counter = &datagramCounter{}
+	}
+
+	var clock activityClock
+	clock.touch()
+
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			stream.Close()
+			udpConn.Close()
+		})
+	}
+	defer closeBoth()
+
+	done := make(chan struct{})
+
+	// stream → UDP
+	go func() {
+		defer close(done)
+		defer closeBoth()
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := readDatagram(stream, buf)
+			if err != nil {
+				if err != io.EOF {
+					slog.Debug("udp stream read ended", "service", counter.service, "error", err)
+				}
+				return
+			}
+			clock.touch()
+			if _, err := udpConn.Write(buf[:n]); err != nil {
+				slog.Debug("udp write failed", "service", counter.service, "error", err)
+				return
+			}
+			counter.record("rx", n)
+		}
+	}()
+
+	// UDP → stream, with idle detection via read deadlines
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		udpConn.SetReadDeadline(time.Now().Add(idleTimeout - clock.idleFor()))
+		n, err := udpConn.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if clock.idleFor() >= idleTimeout {
+					slog.Debug("udp flow idle, closing", "service", counter.service, "idle", idleTimeout)
+					break
+				}
+				continue
+			}
+			break
+		}
+		clock.touch()
+		if err := writeDatagram(stream, buf[:n]); err != nil {
+			break
+		}
+		counter.record("tx", n)
+	}
+
+	closeBoth()
+	<-done
+}
+
+// ProxyStreamToUDP relays framed datagrams between a libp2p stream and a local
+// UDP service. It blocks until the flow ends or is idle for DefaultUDPIdleTimeout.
+func ProxyStreamToUDP(stream network.Stream, udpAddr string) error {
+	udpConn, err := net.DialTimeout("udp", udpAddr, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	relayDatagrams(&serviceStream{stream: stream}, udpConn, DefaultUDPIdleTimeout, &datagramCounter{service: "proxy"})
+	return nil
+}
+
+// instrumentedRelayDatagrams wraps relayDatagrams with the same per-connection
+// metrics InstrumentedBidirectionalProxy records for TCP: each UDP flow counts
+// as one proxy connection. When metrics is nil, only the relay runs.
+func instrumentedRelayDatagrams(stream io.ReadWriteCloser, udpConn net.Conn, idleTimeout time.Duration, service string, metrics *Metrics) {
+	counter := &datagramCounter{metrics: metrics, service: service}
+	if metrics == nil {
+		relayDatagrams(stream, udpConn, idleTimeout, counter)
+		return
+	}
+
+	metrics.ProxyConnectionsTotal.WithLabelValues(service).Inc()
+	metrics.ProxyActiveConns.WithLabelValues(service).Inc()
+	start := time.Now()
+
+	defer func() {
+		metrics.ProxyActiveConns.WithLabelValues(service).Dec()
+		metrics.ProxyDurationSeconds.WithLabelValues(service).Observe(time.Since(start).Seconds())
+	}()
+
+	relayDatagrams(stream, udpConn, idleTimeout, counter)
+}
+
+// udpSession is a single client flow on a UDPListener, keyed by source address.
+type udpSession struct {
+	addr  net.Addr
+	queue chan []byte
+	clock activityClock
+}
+
+// UDPListener creates a local UDP socket that forwards datagrams to a P2P
+// service. Each distinct source address gets its own stream, opened lazily
+// on the first datagram and closed after IdleTimeout of silence.
+type UDPListener struct {
+	conn        net.PacketConn
+	dialFunc    func() (ServiceConn, error)
+	idleTimeout time.Duration
+
+	mu        sync.Mutex
+	sessions  map[string]*udpSession
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewUDPListener creates a new UDP listener for a P2P service.
+func NewUDPListener(localAddr string, dialFunc func() (ServiceConn, error)) (*UDPListener, error) {
+	conn, err := net.ListenPacket("udp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UDPListener{
+		conn:        conn,
+		dialFunc:    dialFunc,
+		idleTimeout: DefaultUDPIdleTimeout,
+		sessions:    make(map[string]*udpSession),
+		closed:      make(chan struct{}),
+	}, nil
+}
+
+// SetIdleTimeout changes how long a flow may stay silent before its stream
+// is closed. Must be called before Serve.
+func (l *UDPListener) SetIdleTimeout(d time.Duration) {
+	if d > 0 {
+		l.idleTimeout = d
+	}
+}
+
+// Serve reads datagrams and dispatches them to per-source sessions.
+// It returns when the listener is closed.
+func (l *UDPListener) Serve() error {
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, addr, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		p := make([]byte, n)
+		copy(p, buf[:n])
+
+		sess := l.session(addr)
+		select {
+		case sess.queue <- p:
+		default:
+			slog.Debug("udp session queue full, dropping datagram", "client", addr)
+		}
+	}
+}
+
+// session returns the flow for addr, starting a new one if needed.
+func (l *UDPListener) session(addr net.Addr) *udpSession {
+	key := addr.String()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if sess, ok := l.sessions[key]; ok {
+		return sess
+	}
+
+	sess := &udpSession{
+		addr:  addr,
+		queue: make(chan []byte, udpSessionQueueSize),
+	}
+	sess.clock.touch()
+	l.sessions[key] = sess
+
+	go l.runSession(key, sess)
+	return sess
+}
+
+// runSession dials the P2P service for one flow and pumps datagrams in both
+// directions until the flow goes idle or the stream fails.
+func (l *UDPListener) runSession(key string, sess *udpSession) {
+	defer func() {
+		l.mu.Lock()
+		delete(l.sessions, key)
+		l.mu.Unlock()
+	}()
+
+	serviceConn, err := l.dialFunc()
+	if err != nil {
+		slog.Error("failed to dial P2P service", "client", sess.addr, "error", err)
+		return
+	}
+	defer serviceConn.Close()
+
+	slog.Debug("udp flow opened", "client", sess.addr)
+
+	// stream → client
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := readDatagram(serviceConn, buf)
+			if err != nil {
+				return
+			}
+			sess.clock.touch()
+			if _, err := l.conn.WriteTo(buf[:n], sess.addr); err != nil {
+				return
+			}
+		}
+	}()
+
+	// client → stream, with idle detection
+	timer := time.NewTimer(l.idleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case p := <-sess.queue:
+			sess.clock.touch()
+			if err := writeDatagram(serviceConn, p); err != nil {
+				return
+			}
+		case <-readDone:
+			return
+		case <-l.closed:
+			return
+		case <-timer.C:
+			idle := sess.clock.idleFor()
+			if idle >= l.idleTimeout {
+				slog.Debug("udp flow idle, closing", "client", sess.addr, "idle", l.idleTimeout)
+				return
+			}
+			timer.Reset(l.idleTimeout - idle)
+		}
+	}
+}
+
+// Close closes the UDP socket and tears down all active flows.
+func (l *UDPListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return l.conn.Close()
+}
+
+// Addr returns the listener's network address
+func (l *UDPListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// ActiveSessions returns the number of client flows currently open.
+func (l *UDPListener) ActiveSessions() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.sessions)
+}
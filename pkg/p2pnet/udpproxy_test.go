@@ -0,0 +1,264 @@
+package p2pnet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeConn adapts a net.Conn (from net.Pipe) to ServiceConn.
+type pipeConn struct{ net.Conn }
+
+func (p *pipeConn) CloseWrite() error { return p.Close() }
+
+// startUDPEcho starts a UDP server that echoes every datagram back to its sender.
+func startUDPEcho(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(buf[:n], addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestDatagramFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	msgs := [][]byte{[]byte("hello"), {}, bytes.Repeat([]byte{0xAB}, 1500)}
+	for _, m := range msgs {
+		if err := writeDatagram(&buf, m); err != nil {
+			t.Fatalf("writeDatagram: %v", err)
+		}
+	}
+
+	out := make([]byte, MaxDatagramSize)
+	for i, want := range msgs {
+		n, err := readDatagram(&buf, out)
+		if err != nil {
+			t.Fatalf("readDatagram %d: %v", i, err)
+		}
+		if !bytes.Equal(out[:n], want) {
+			t.Errorf("frame %d: got %d bytes, want %d", i, n, len(want))
+		}
+	}
+}
+
+func TestWriteDatagramTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeDatagram(&buf, make([]byte, MaxDatagramSize+1)); err == nil {
+		t.Fatal("expected error for oversized datagram")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("oversized datagram wrote %d bytes", buf.Len())
+	}
+}
+
+func TestReadDatagramShortBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	writeDatagram(&buf, make([]byte, 100))
+	if _, err := readDatagram(&buf, make([]byte, 10)); err == nil {
+		t.Fatal("expected error when frame exceeds buffer")
+	}
+}
+
+func TestRelayDatagrams(t *testing.T) {
+	echoAddr := startUDPEcho(t)
+
+	udpConn, err := net.Dial("udp", echoAddr)
+	if err != nil {
+		t.Fatalf("dial udp: %v", err)
+	}
+	local, remote := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		relayDatagrams(remote, udpConn, time.Minute, &datagramCounter{service: "test"})
+		close(done)
+	}()
+
+	out := make([]byte, MaxDatagramSize)
+	for _, msg := range []string{"ping-1", "ping-2"} {
+		if err := writeDatagram(local, []byte(msg)); err != nil {
+			t.Fatalf("write frame: %v", err)
+		}
+		local.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := readDatagram(local, out)
+		if err != nil {
+			t.Fatalf("read frame: %v", err)
+		}
+		if string(out[:n]) != msg {
+			t.Errorf("got %q, want %q", out[:n], msg)
+		}
+	}
+
+	local.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relayDatagrams did not return after stream close")
+	}
+}
+
+func TestRelayDatagrams_IdleTimeout(t *testing.T) {
+	echoAddr := startUDPEcho(t)
+
+	udpConn, err := net.Dial("udp", echoAddr)
+	if err != nil {
+		t.Fatalf("dial udp: %v", err)
+	}
+	local, remote := net.Pipe()
+	defer local.Close()
+
+	done := make(chan struct{})
+	go func() {
+		relayDatagrams(remote, udpConn, 100*time.Millisecond, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("relayDatagrams did not close idle flow")
+	}
+}
+
+func TestRelayDatagrams_Metrics(t *testing.T) {
+	echoAddr := startUDPEcho(t)
+	m := NewMetrics("test", "go1.0")
+
+	udpConn, err := net.Dial("udp", echoAddr)
+	if err != nil {
+		t.Fatalf("dial udp: %v", err)
+	}
+	local, remote := net.Pipe()
+
+	done := make(chan struct{})
+	go func() {
+		instrumentedRelayDatagrams(remote, udpConn, time.Minute, "dns", m)
+		close(done)
+	}()
+
+	writeDatagram(local, []byte("query"))
+	out := make([]byte, MaxDatagramSize)
+	local.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := readDatagram(local, out); err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	local.Close()
+	<-done
+
+	families, err := m.Registry.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	counts := map[string]float64{}
+	for _, f := range families {
+		if f.GetName() != "peerup_proxy_datagrams_total" {
+			continue
+		}
+		for _, metric := range f.GetMetric() {
+			for _, l := range metric.GetLabel() {
+				if l.GetName() == "direction" {
+					counts[l.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if counts["rx"] != 1 || counts["tx"] != 1 {
+		t.Errorf("datagram counts = %v, want rx=1 tx=1", counts)
+	}
+}
+
+func TestUDPListener_PerSourceSessions(t *testing.T) {
+	echoAddr := startUDPEcho(t)
+
+	dialFunc := func() (ServiceConn, error) {
+		local, remote := net.Pipe()
+		udpConn, err := net.Dial("udp", echoAddr)
+		if err != nil {
+			return nil, err
+		}
+		go relayDatagrams(remote, udpConn, time.Minute, nil)
+		return &pipeConn{local}, nil
+	}
+
+	l, err := NewUDPListener("127.0.0.1:0", dialFunc)
+	if err != nil {
+		t.Fatalf("NewUDPListener: %v", err)
+	}
+	defer l.Close()
+	l.SetIdleTimeout(200 * time.Millisecond)
+	go l.Serve()
+
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("udp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("dial listener: %v", err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+
+	buf := make([]byte, 1500)
+	for i, c := range clients {
+		msg := []byte{'c', byte('0' + i)}
+		if _, err := c.Write(msg); err != nil {
+			t.Fatalf("client %d write: %v", i, err)
+		}
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := c.Read(buf)
+		if err != nil {
+			t.Fatalf("client %d read: %v", i, err)
+		}
+		if !bytes.Equal(buf[:n], msg) {
+			t.Errorf("client %d got %q, want %q", i, buf[:n], msg)
+		}
+	}
+
+	if got := l.ActiveSessions(); got != 2 {
+		t.Errorf("ActiveSessions = %d, want 2", got)
+	}
+
+	// Both flows go idle and are reaped.
+	deadline := time.Now().Add(5 * time.Second)
+	for l.ActiveSessions() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := l.ActiveSessions(); got != 0 {
+		t.Errorf("ActiveSessions after idle = %d, want 0", got)
+	}
+}
+
+func TestUDPListener_CloseStopsServe(t *testing.T) {
+	l, err := NewUDPListener("127.0.0.1:0", func() (ServiceConn, error) {
+		return nil, net.ErrClosed
+	})
+	if err != nil {
+		t.Fatalf("NewUDPListener: %v", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- l.Serve() }()
+	l.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("Serve returned nil after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after Close")
+	}
+}
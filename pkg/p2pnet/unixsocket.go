@@ -0,0 +1,154 @@
+package p2pnet
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnixAddrPrefix marks a local address as a Unix domain socket path, e.g.
+// "unix:/var/run/docker.sock". Service local addresses and proxy listen
+// addresses accept it anywhere they accept host:port.
+const UnixAddrPrefix = "unix:"
+
+// staleSocketDialTimeout bounds the liveness check on an existing socket file.
+const staleSocketDialTimeout = 2 * time.Second
+
+// SocketOptions sets the permissions of a Unix socket created by a listener.
+// They have no effect on TCP addresses.
+type SocketOptions struct {
+	Mode  os.FileMode // file mode, e.g. 0660 (0 = leave the umask default)
+	Group string      // group name or numeric GID to own the socket ("" = unchanged)
+}
+
+// SplitLocalAddr returns the network ("tcp" or "unix") and address to dial
+// or listen on for a local address.
+func SplitLocalAddr(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, UnixAddrPrefix); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
+
+// IsUnixAddr reports whether addr names a Unix domain socket.
+func IsUnixAddr(addr string) bool {
+	return strings.HasPrefix(addr, UnixAddrPrefix)
+}
+
+// FormatLocalAddr renders a listener address in the form SplitLocalAddr
+// accepts, so Unix socket paths keep their prefix.
+func FormatLocalAddr(a net.Addr) string {
+	if a.Network() == "unix" {
+		return UnixAddrPrefix + a.String()
+	}
+	return a.String()
+}
+
+// DialLocal connects to a local TCP address or Unix socket.
+func DialLocal(addr string, timeout time.Duration) (net.Conn, error) {
+	network, address := SplitLocalAddr(addr)
+	return net.DialTimeout(network, address, timeout)
+}
+
+// ListenLocal listens on a local TCP address or Unix socket. For a Unix
+// socket it first removes a stale socket file left by a process that exited
+// without cleaning up, then applies opts. It refuses to replace a socket
+// that still accepts connections or a file that is not a socket. The socket
+// file is removed when the listener closes.
+func ListenLocal(addr string, opts *SocketOptions) (net.Listener, error) {
+	network, address := SplitLocalAddr(addr)
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	if err := removeStaleSocket(address); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySocketOptions(address, opts); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStaleSocket deletes path if it is a socket nobody is listening on.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	// Socket file exists - if something answers, it is not ours to remove
+	conn, err := net.DialTimeout("unix", path, staleSocketDialTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: %s", ErrSocketInUse, path)
+	}
+	slog.Info("removing stale socket", "path", path)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// applySocketOptions sets the mode and group of a freshly created socket.
+func applySocketOptions(path string, opts *SocketOptions) error {
+	if opts == nil {
+		return nil
+	}
+	if opts.Group != "" {
+		gid, err := lookupGroupID(opts.Group)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			return fmt.Errorf("setting socket group: %w", err)
+		}
+	}
+	if opts.Mode != 0 {
+		if err := os.Chmod(path, opts.Mode); err != nil {
+			return fmt.Errorf("setting socket mode: %w", err)
+		}
+	}
+	return nil
+}
+
+// lookupGroupID resolves a group name or numeric GID.
+func lookupGroupID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("socket group: %w", err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// ParseSocketMode parses an octal file mode such as "0660" or "660".
+func ParseSocketMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("invalid socket mode %q: must be octal permissions like 0660", s)
+	}
+	return os.FileMode(m), nil
+}
@@ -0,0 +1,166 @@
+package p2pnet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestSplitLocalAddr(t *testing.T) {
+	tests := []struct{ addr, network, address string }{
+		{"localhost:22", "tcp", "localhost:22"},
+		{"unix:/var/run/docker.sock", "unix", "/var/run/docker.sock"},
+	}
+	for _, tt := range tests {
+		network, address := SplitLocalAddr(tt.addr)
+		if network != tt.network || address != tt.address {
+			t.Errorf("SplitLocalAddr(%q) = %q, %q; want %q, %q", tt.addr, network, address, tt.network, tt.address)
+		}
+	}
+}
+
+func TestParseSocketMode(t *testing.T) {
+	for in, want := range map[string]os.FileMode{"": 0, "0660": 0o660, "600": 0o600, "0777": 0o777} {
+		if got, err := ParseSocketMode(in); err != nil || got != want {
+			t.Errorf("ParseSocketMode(%q) = %o, %v; want %o", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"rw-rw----", "0888", "01777", "-1"} {
+		if _, err := ParseSocketMode(in); err == nil {
+			t.Errorf("ParseSocketMode(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestListenLocalUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "s.sock")
+	addr := UnixAddrPrefix + path
+
+	ln, err := ListenLocal(addr, &SocketOptions{Mode: 0o600})
+	if err != nil {
+		t.Fatalf("ListenLocal() error = %v", err)
+	}
+	if got := FormatLocalAddr(ln.Addr()); got != addr {
+		t.Errorf("FormatLocalAddr() = %q, want %q", got, addr)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("socket mode = %v (err %v), want 0600", fi.Mode().Perm(), err)
+	}
+
+	// A live socket is never replaced.
+	if _, err := ListenLocal(addr, nil); !errors.Is(err, ErrSocketInUse) {
+		t.Errorf("ListenLocal() on a live socket error = %v, want ErrSocketInUse", err)
+	}
+
+	// Closing removes the socket file.
+	ln.Close()
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("socket file left after Close: %v", err)
+	}
+
+	// A stale socket (owner exited without cleanup) is replaced.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	ln, err = ListenLocal(addr, nil)
+	if err != nil {
+		t.Fatalf("ListenLocal() over a stale socket error = %v", err)
+	}
+	ln.Close()
+
+	// Regular files are left alone.
+	file := filepath.Join(dir, "f.sock")
+	os.WriteFile(file, []byte("data"), 0o600)
+	if _, err := ListenLocal(UnixAddrPrefix+file, nil); err == nil {
+		t.Error("ListenLocal() replaced a regular file")
+	}
+	if data, _ := os.ReadFile(file); string(data) != "data" {
+		t.Error("regular file was modified")
+	}
+}
+
+// TestUnixSocketService exposes a service backed by a Unix socket and
+// consumes it through a Unix socket listener on another host.
+func TestUnixSocketService(t *testing.T) {
+	dir := t.TempDir()
+
+	backend, err := net.Listen("unix", filepath.Join(dir, "b.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		for {
+			c, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() { io.Copy(c, c); c.Close() }()
+		}
+	}()
+
+	server, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	serverReg := NewServiceRegistry(server, nil)
+	if err := serverReg.RegisterService(&Service{
+		Name:         "agent",
+		Protocol:     "/peerup/agent/1.0.0",
+		LocalAddress: UnixAddrPrefix + backend.Addr().String(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := serverReg.RegisterService(&Service{
+		Name:         "dns",
+		Protocol:     "/peerup/dns/1.0.0",
+		LocalAddress: UnixAddrPrefix + "/run/dns.sock",
+		Transport:    ServiceTransportUDP,
+	}); err == nil {
+		t.Error("RegisterService() accepted a UDP service on a unix socket")
+	}
+
+	clientReg := NewServiceRegistry(client, nil)
+	l, err := NewTCPListenerWithOptions(UnixAddrPrefix+filepath.Join(dir, "c.sock"), &SocketOptions{Mode: 0o600}, func() (ServiceConn, error) {
+		return clientReg.DialService(context.Background(), server.ID(), "/peerup/agent/1.0.0")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go l.Serve()
+
+	c, err := DialLocal(FormatLocalAddr(l.Addr()), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	c.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("echo over unix sockets = %q, %v", buf, err)
+	}
+}